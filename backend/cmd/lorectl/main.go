@@ -0,0 +1,529 @@
+// Command lorectl runs common admin tasks against a Lore server from the
+// shell: managing users, scanning libraries, importing, listing books
+// without provider metadata and exporting listening and download stats.
+//
+// It talks to the API with an admin's API key (LORE_URL and LORE_API_KEY).
+// The user commands can instead open the database directly with -db, e.g.
+// to reset the only admin's password while the server is down.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/models"
+)
+
+const usage = `Usage: lorectl [global flags] <command> [flags]
+
+Commands:
+  user list                                   List accounts
+  user create -username NAME [-admin]         Create an account
+  user reset-password -username NAME          Set a new password
+  scan [-library ID]                          Scan one library, or all of them
+  import -folder ID [-template T] PATH...     Import selections of an import folder
+  unmatched [-library ID]                     List books not linked to provider metadata
+  stats [-kind listening|downloads] [-since YYYY-MM-DD] [-until YYYY-MM-DD] [-format csv|json]
+                                              Export per-user listening or download totals
+
+Passwords are read from the first line of standard input unless -password
+is given, so they stay out of the shell history.
+
+Global flags:
+`
+
+// app holds the global flags.
+type app struct {
+	url    string
+	apiKey string
+	dbPath string
+	json   bool
+}
+
+func main() {
+	a := &app{}
+	flags := flag.NewFlagSet("lorectl", flag.ExitOnError)
+	flags.StringVar(&a.url, "url", envOr("LORE_URL", "http://localhost:8080"), "server address (LORE_URL)")
+	flags.StringVar(&a.apiKey, "api-key", os.Getenv("LORE_API_KEY"), "admin API key (LORE_API_KEY)")
+	flags.StringVar(&a.dbPath, "db", "", "open this database directly instead of calling the API (user commands only)")
+	flags.BoolVar(&a.json, "json", false, "print JSON instead of a table")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "user":
+		err = a.user(args[1:])
+	case "scan":
+		err = a.scan(args[1:])
+	case "import":
+		err = a.importFolder(args[1:])
+	case "unmatched":
+		err = a.unmatched(args[1:])
+	case "stats":
+		err = a.stats(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "lorectl: unknown command %q\n\n", args[0])
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lorectl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (a *app) client() *client {
+	return newClient(a.url, a.apiKey)
+}
+
+// openAuth opens the database given with -db.
+func (a *app) openAuth() (*auth.Service, func(), error) {
+	db, err := database.Open(a.dbPath, database.DefaultOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.NewService(db), func() { db.Close() }, nil
+}
+
+func (a *app) user(args []string) error {
+	if len(args) == 0 {
+		return errors.New("user needs a subcommand: list, create or reset-password")
+	}
+	switch args[0] {
+	case "list":
+		return a.userList(args[1:])
+	case "create":
+		return a.userCreate(args[1:])
+	case "reset-password":
+		return a.userResetPassword(args[1:])
+	}
+	return fmt.Errorf("unknown user subcommand %q", args[0])
+}
+
+func (a *app) userList(args []string) error {
+	flags := flag.NewFlagSet("user list", flag.ExitOnError)
+	flags.Parse(args)
+
+	var users []models.User
+	if a.dbPath != "" {
+		authSvc, closeDB, err := a.openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+		list, _, err := authSvc.ListUsers(context.Background(), models.UserFilter{}, 0, -1)
+		if err != nil {
+			return err
+		}
+		for _, user := range list {
+			users = append(users, *user)
+		}
+	} else {
+		for offset := 0; ; {
+			var page struct {
+				Data       []models.User `json:"data"`
+				Pagination struct {
+					Total int `json:"total"`
+				} `json:"pagination"`
+			}
+			query := url.Values{"offset": {strconv.Itoa(offset)}, "limit": {"100"}}
+			if err := a.client().do("GET", "/admin/users", query, nil, &page); err != nil {
+				return err
+			}
+			users = append(users, page.Data...)
+			offset += len(page.Data)
+			if len(page.Data) == 0 || offset >= page.Pagination.Total {
+				break
+			}
+		}
+	}
+
+	if a.json {
+		return printJSON(users)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSERNAME\tROLE\tSTATUS\tCREATED")
+	for _, user := range users {
+		role := models.RoleUser
+		if user.IsAdmin {
+			role = models.RoleAdmin
+		}
+		status := "active"
+		switch {
+		case user.Disabled:
+			status = "disabled"
+		case user.PendingApproval:
+			status = "pending"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", user.ID, user.Username, role, status, user.CreatedAt.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+func (a *app) userCreate(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	username := flags.String("username", "", "username")
+	password := flags.String("password", "", "password (read from standard input when empty)")
+	admin := flags.Bool("admin", false, "make the account an admin")
+	flags.Parse(args)
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	var user *models.User
+	if a.dbPath != "" {
+		authSvc, closeDB, err := a.openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+		if user, err = authSvc.CreateUser(context.Background(), *username, pass, *admin); err != nil {
+			return err
+		}
+	} else {
+		var resp envelope[*models.User]
+		body := map[string]interface{}{"username": *username, "password": pass, "is_admin": *admin}
+		if err := a.client().do("POST", "/admin/users", nil, body, &resp); err != nil {
+			return err
+		}
+		user = resp.Data
+	}
+
+	if a.json {
+		return printJSON(user)
+	}
+	fmt.Printf("created %s (%s)\n", user.Username, user.ID)
+	if user.APIKey != nil {
+		fmt.Printf("API key: %s\n", *user.APIKey)
+	}
+	return nil
+}
+
+func (a *app) userResetPassword(args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	username := flags.String("username", "", "username")
+	password := flags.String("password", "", "new password (read from standard input when empty)")
+	flags.Parse(args)
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	if a.dbPath != "" {
+		authSvc, closeDB, err := a.openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+		ctx := context.Background()
+		user, err := authSvc.GetUserByUsername(ctx, *username)
+		if err != nil {
+			return err
+		}
+		if err := authSvc.UpdatePassword(ctx, user.ID, pass); err != nil {
+			return err
+		}
+	} else {
+		c := a.client()
+		var resp envelope[[]models.User]
+		if err := c.do("GET", "/admin/users", url.Values{"username": {*username}, "limit": {"100"}}, nil, &resp); err != nil {
+			return err
+		}
+		var userID string
+		for _, user := range resp.Data {
+			if strings.EqualFold(user.Username, *username) {
+				userID = user.ID
+			}
+		}
+		if userID == "" {
+			return fmt.Errorf("no user named %q", *username)
+		}
+		if err := c.do("PATCH", "/admin/users/"+url.PathEscape(userID), nil, map[string]string{"password": pass}, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("password reset for %s\n", *username)
+	return nil
+}
+
+// readPassword returns flagValue, or the first line of standard input.
+func readPassword(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		return "", errors.New("password cannot be empty")
+	}
+	return line, nil
+}
+
+// scanResult is the part of a library scan result lorectl prints.
+type scanResult struct {
+	LibraryID     string   `json:"library_id"`
+	LibraryName   string   `json:"library_name"`
+	TotalBooks    int      `json:"total_books_found"`
+	TotalNewBooks int      `json:"total_new_books"`
+	TotalMissing  int      `json:"total_missing_books"`
+	ScanDuration  string   `json:"scan_duration"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+func (a *app) scan(args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	libraryID := flags.String("library", "", "library ID; all libraries when empty")
+	flags.Parse(args)
+
+	var results []scanResult
+	if *libraryID != "" {
+		var resp envelope[scanResult]
+		if err := a.client().do("POST", "/admin/libraries/"+url.PathEscape(*libraryID)+"/scan", nil, nil, &resp); err != nil {
+			return err
+		}
+		results = append(results, resp.Data)
+	} else {
+		var resp struct {
+			Results []scanResult `json:"results"`
+		}
+		if err := a.client().do("POST", "/admin/libraries/scan", nil, nil, &resp); err != nil {
+			return err
+		}
+		results = resp.Results
+	}
+
+	if a.json {
+		return printJSON(results)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIBRARY\tBOOKS\tNEW\tMISSING\tDURATION")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", result.LibraryName, result.TotalBooks, result.TotalNewBooks,
+			result.TotalMissing, result.ScanDuration)
+		for _, msg := range result.Errors {
+			fmt.Fprintf(tw, "  error: %s\t\t\t\t\n", msg)
+		}
+	}
+	return tw.Flush()
+}
+
+// importJob is the part of an import job lorectl prints.
+type importJob struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	ImportedBooks []struct {
+		ID        string `json:"id"`
+		AssetPath string `json:"asset_path"`
+	} `json:"imported_books"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (a *app) importFolder(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	folderID := flags.String("folder", "", "import folder ID")
+	template := flags.String("template", "", "destination template, e.g. {author}/{title}; the import setting when empty")
+	flags.Parse(args)
+	if *folderID == "" || flags.NArg() == 0 {
+		return errors.New("usage: lorectl import -folder ID PATH...")
+	}
+
+	c := a.client()
+	body := map[string]interface{}{"folder_id": *folderID, "selections": flags.Args()}
+	if *template != "" {
+		body["custom_template"] = *template
+	}
+	var resp envelope[importJob]
+	if err := c.do("POST", "/admin/import/execute", nil, body, &resp); err != nil {
+		return err
+	}
+	job := resp.Data
+	for job.Status == "processing" {
+		time.Sleep(2 * time.Second)
+		if err := c.do("GET", "/admin/import/history/"+url.PathEscape(job.ID), nil, nil, &resp); err != nil {
+			return err
+		}
+		job = resp.Data
+	}
+
+	if a.json {
+		return printJSON(job)
+	}
+	fmt.Printf("import %s: %s, %d imported\n", job.ID, job.Status, len(job.ImportedBooks))
+	for _, book := range job.ImportedBooks {
+		fmt.Printf("  %s  %s\n", book.ID, book.AssetPath)
+	}
+	for _, msg := range job.Errors {
+		fmt.Printf("  error: %s\n", msg)
+	}
+	if job.Status == "failed" {
+		return errors.New("import failed")
+	}
+	return nil
+}
+
+func (a *app) unmatched(args []string) error {
+	flags := flag.NewFlagSet("unmatched", flag.ExitOnError)
+	libraryID := flags.String("library", "", "library ID; all libraries when empty")
+	flags.Parse(args)
+
+	var books []models.MetadataGapBook
+	for offset := 0; ; {
+		var page struct {
+			Data       []models.MetadataGapBook `json:"data"`
+			Pagination struct {
+				Total int `json:"total"`
+			} `json:"pagination"`
+		}
+		query := url.Values{"gap": {models.GapUnmatched}, "offset": {strconv.Itoa(offset)}, "limit": {"100"}}
+		if *libraryID != "" {
+			query.Set("library_id", *libraryID)
+		}
+		if err := a.client().do("GET", "/admin/audiobooks/metadata-gaps", query, nil, &page); err != nil {
+			return err
+		}
+		books = append(books, page.Data...)
+		offset += len(page.Data)
+		if len(page.Data) == 0 || offset >= page.Pagination.Total {
+			break
+		}
+	}
+
+	if a.json {
+		return printJSON(books)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tPATH")
+	for _, book := range books {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", book.AudiobookID, book.Title, book.AssetPath)
+	}
+	return tw.Flush()
+}
+
+func (a *app) stats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	kind := flags.String("kind", "listening", "listening or downloads")
+	since := flags.String("since", "", "first day, YYYY-MM-DD")
+	until := flags.String("until", "", "last day, YYYY-MM-DD")
+	format := flags.String("format", "csv", "csv or json")
+	flags.Parse(args)
+	if *format != "csv" && *format != "json" {
+		return errors.New("-format must be csv or json")
+	}
+
+	var header []string
+	var rows [][]string
+	var out interface{}
+	switch *kind {
+	case "listening":
+		query := url.Values{}
+		if *since != "" {
+			query.Set("since", *since)
+		}
+		if *until != "" {
+			query.Set("until", *until)
+		}
+		var resp envelope[[]models.UserListeningSummary]
+		if err := a.client().do("GET", "/admin/listening-stats", query, nil, &resp); err != nil {
+			return err
+		}
+		out = resp.Data
+		header = []string{"user_id", "username", "listened_hours", "sessions", "active_days", "first_day", "last_day"}
+		for _, s := range resp.Data {
+			rows = append(rows, []string{s.UserID, s.Username, strconv.FormatFloat(s.ListenedSec/3600, 'f', 2, 64),
+				strconv.Itoa(s.Sessions), strconv.Itoa(s.ActiveDays), s.FirstDay, s.LastDay})
+		}
+	case "downloads":
+		// The download report takes timestamps; days cover all of their
+		// hours in UTC.
+		query := url.Values{}
+		if *since != "" {
+			day, err := time.Parse("2006-01-02", *since)
+			if err != nil {
+				return errors.New("-since must be YYYY-MM-DD")
+			}
+			query.Set("since", day.Format(time.RFC3339))
+		}
+		if *until != "" {
+			day, err := time.Parse("2006-01-02", *until)
+			if err != nil {
+				return errors.New("-until must be YYYY-MM-DD")
+			}
+			query.Set("until", day.Add(24*time.Hour-time.Second).Format(time.RFC3339))
+		}
+		var resp envelope[[]models.DownloadUserSummary]
+		if err := a.client().do("GET", "/admin/downloads/report", query, nil, &resp); err != nil {
+			return err
+		}
+		out = resp.Data
+		header = []string{"user_id", "username", "downloads", "bytes", "last_download_at"}
+		for _, s := range resp.Data {
+			var userID, last string
+			if s.UserID != nil {
+				userID = *s.UserID
+			}
+			if s.LastDownloadAt != nil {
+				last = s.LastDownloadAt.Format(time.RFC3339)
+			}
+			rows = append(rows, []string{userID, s.Username, strconv.Itoa(s.Downloads),
+				strconv.FormatInt(s.Bytes, 10), last})
+		}
+	default:
+		return errors.New("-kind must be listening or downloads")
+	}
+
+	if *format == "json" || a.json {
+		return printJSON(out)
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.Write(header)
+	w.WriteAll(rows)
+	return w.Error()
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -11,7 +11,8 @@ import (
 )
 
 func main() {
-	fmt.Println("📚 Flix Audio Test Data Seeder\n")
+	fmt.Println("📚 Flix Audio Test Data Seeder")
+	fmt.Println()
 
 	// Get database path from environment or use default
 	dbPath := os.Getenv("DATABASE_PATH")
@@ -20,7 +21,7 @@ func main() {
 	}
 
 	// Open database (applies schema automatically)
-	db, err := database.Open(dbPath)
+	db, err := database.Open(dbPath, database.DefaultOptions())
 	if err != nil {
 		log.Fatalf("❌ Failed to open database: %v", err)
 	}
@@ -9,4 +9,4 @@ require (
 	golang.org/x/crypto v0.28.0
 )
 
-require github.com/go-chi/cors v1.2.2 // indirect
+require github.com/go-chi/cors v1.2.2
@@ -0,0 +1,267 @@
+package abs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// timeLayouts are the formats Audiobookshelf's database stores times in.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999 -07:00",
+	"2006-01-02 15:04:05.999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999",
+}
+
+// ReadDatabase reads an Audiobookshelf database (absdatabase.sqlite, from
+// version 2.3 on) without modifying it. Podcast items are left out.
+func ReadDatabase(ctx context.Context, path string) (*Export, error) {
+	db, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("failed to open Audiobookshelf database: %w", err)
+	}
+
+	export := &Export{}
+	if export.Libraries, err = readLibraries(ctx, db); err != nil {
+		return nil, fmt.Errorf("failed to read libraries: %w", err)
+	}
+	if export.Items, err = readItems(ctx, db); err != nil {
+		return nil, fmt.Errorf("failed to read library items: %w", err)
+	}
+	if export.Users, err = readUsers(ctx, db); err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	return export, nil
+}
+
+func readLibraries(ctx context.Context, db *sql.DB) ([]Library, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, name, mediaType FROM libraries ORDER BY displayOrder`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var libraries []Library
+	index := make(map[string]int)
+	for rows.Next() {
+		var library Library
+		var mediaType sql.NullString
+		if err := rows.Scan(&library.ID, &library.Name, &mediaType); err != nil {
+			return nil, err
+		}
+		library.MediaType = mediaType.String
+		index[library.ID] = len(libraries)
+		libraries = append(libraries, library)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	folders, err := db.QueryContext(ctx, `SELECT libraryId, path FROM libraryFolders`)
+	if err != nil {
+		return nil, err
+	}
+	defer folders.Close()
+	for folders.Next() {
+		var libraryID, path string
+		if err := folders.Scan(&libraryID, &path); err != nil {
+			return nil, err
+		}
+		if i, ok := index[libraryID]; ok {
+			libraries[i].Folders = append(libraries[i].Folders, Folder{FullPath: path})
+		}
+	}
+	return libraries, folders.Err()
+}
+
+func readItems(ctx context.Context, db *sql.DB) ([]Item, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT li.id, li.libraryId, li.path, li.isFile, b.id,
+		       b.title, b.subtitle, b.publishedYear, b.publishedDate, b.publisher,
+		       b.description, b.isbn, b.asin, b.language, b.narrators, b.genres, b.duration
+		FROM libraryItems li
+		JOIN books b ON b.id = li.mediaId
+		WHERE li.mediaType = 'book'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Item
+	byBook := make(map[string]int)
+	for rows.Next() {
+		var item Item
+		var bookID string
+		var isFile sql.NullBool
+		var title, subtitle, year, date, publisher, description sql.NullString
+		var isbn, asin, language, narrators, genres sql.NullString
+		var duration sql.NullFloat64
+		if err := rows.Scan(&item.ID, &item.LibraryID, &item.Path, &isFile, &bookID,
+			&title, &subtitle, &year, &date, &publisher,
+			&description, &isbn, &asin, &language, &narrators, &genres, &duration); err != nil {
+			return nil, err
+		}
+		item.IsFile = isFile.Bool
+		item.Media = Media{
+			Metadata: Metadata{
+				Title:         title.String,
+				Subtitle:      subtitle.String,
+				PublishedYear: year.String,
+				PublishedDate: date.String,
+				Publisher:     publisher.String,
+				Description:   description.String,
+				ISBN:          isbn.String,
+				ASIN:          asin.String,
+				Language:      language.String,
+				Narrators:     jsonStrings(narrators.String),
+				Genres:        jsonStrings(genres.String),
+			},
+			Duration: duration.Float64,
+		}
+		byBook[bookID] = len(items)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	authors, err := db.QueryContext(ctx, `
+		SELECT ba.bookId, a.name
+		FROM bookAuthors ba
+		JOIN authors a ON a.id = ba.authorId
+		ORDER BY ba.createdAt
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer authors.Close()
+	for authors.Next() {
+		var bookID, name string
+		if err := authors.Scan(&bookID, &name); err != nil {
+			return nil, err
+		}
+		if i, ok := byBook[bookID]; ok {
+			items[i].Media.Metadata.Authors = append(items[i].Media.Metadata.Authors, Named{Name: name})
+		}
+	}
+	if err := authors.Err(); err != nil {
+		return nil, err
+	}
+
+	series, err := db.QueryContext(ctx, `
+		SELECT bs.bookId, s.name, bs.sequence
+		FROM bookSeries bs
+		JOIN series s ON s.id = bs.seriesId
+		ORDER BY bs.createdAt
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer series.Close()
+	for series.Next() {
+		var bookID, name string
+		var sequence sql.NullString
+		if err := series.Scan(&bookID, &name, &sequence); err != nil {
+			return nil, err
+		}
+		if i, ok := byBook[bookID]; ok {
+			items[i].Media.Metadata.Series = append(items[i].Media.Metadata.Series, Series{Name: name, Sequence: sequence.String})
+		}
+	}
+	return items, series.Err()
+}
+
+func readUsers(ctx context.Context, db *sql.DB) ([]User, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, username, type, bookmarks FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	index := make(map[string]int)
+	for rows.Next() {
+		var user User
+		var username, userType, bookmarks sql.NullString
+		if err := rows.Scan(&user.ID, &username, &userType, &bookmarks); err != nil {
+			return nil, err
+		}
+		user.Username = username.String
+		user.Type = userType.String
+		if bookmarks.String != "" {
+			if err := json.Unmarshal([]byte(bookmarks.String), &user.Bookmarks); err != nil {
+				return nil, fmt.Errorf("invalid bookmarks of user %s: %w", user.Username, err)
+			}
+		}
+		index[user.ID] = len(users)
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Times are read as text: the driver would otherwise try to parse
+	// Audiobookshelf's own DATETIME format.
+	progress, err := db.QueryContext(ctx, `
+		SELECT mp.userId, li.id, mp.currentTime, mp.duration, mp.isFinished, CAST(mp.updatedAt AS TEXT)
+		FROM mediaProgresses mp
+		JOIN libraryItems li ON li.mediaId = mp.mediaItemId
+		WHERE mp.mediaItemType = 'book'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer progress.Close()
+	for progress.Next() {
+		var userID string
+		var entry Progress
+		var currentTime, duration sql.NullFloat64
+		var finished sql.NullBool
+		var updatedAt sql.NullString
+		if err := progress.Scan(&userID, &entry.LibraryItemID, &currentTime, &duration, &finished, &updatedAt); err != nil {
+			return nil, err
+		}
+		entry.CurrentTime = currentTime.Float64
+		entry.Duration = duration.Float64
+		entry.IsFinished = finished.Bool
+		if t, ok := parseTime(updatedAt.String); ok {
+			entry.LastUpdate = t.UnixMilli()
+		}
+		if i, ok := index[userID]; ok {
+			users[i].Progress = append(users[i].Progress, entry)
+		}
+	}
+	return users, progress.Err()
+}
+
+// jsonStrings decodes a JSON array of strings, returning nil for anything
+// else.
+func jsonStrings(raw string) []string {
+	var values []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &values); err != nil {
+		return nil
+	}
+	return values
+}
+
+func parseTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,151 @@
+// Package abs reads the libraries, items, listening progress and bookmarks
+// of an Audiobookshelf server, from its SQLite database or from JSON saved
+// from its API, so they can be migrated to Lore.
+package abs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Export is everything read from an Audiobookshelf server. The JSON form
+// uses the shapes of Audiobookshelf's API: libraries as listed by
+// /api/libraries, expanded library items, and users with their
+// mediaProgress and bookmarks as returned by /api/users/{id}.
+type Export struct {
+	Libraries []Library `json:"libraries"`
+	Items     []Item    `json:"items"`
+	Users     []User    `json:"users"`
+}
+
+// Library is an Audiobookshelf library.
+type Library struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	MediaType string   `json:"mediaType"` // book or podcast
+	Folders   []Folder `json:"folders"`
+}
+
+// Folder is a directory of a library.
+type Folder struct {
+	FullPath string `json:"fullPath"`
+}
+
+// Item is a library item: one audiobook.
+type Item struct {
+	ID        string `json:"id"`
+	LibraryID string `json:"libraryId"`
+	// Path is the item's folder, or its file when IsFile is set, as seen
+	// by the Audiobookshelf server.
+	Path   string `json:"path"`
+	IsFile bool   `json:"isFile"`
+	Media  Media  `json:"media"`
+}
+
+// Media is the book of an item.
+type Media struct {
+	Metadata Metadata `json:"metadata"`
+	Duration float64  `json:"duration"`
+}
+
+// Metadata is the book metadata Audiobookshelf keeps for an item.
+type Metadata struct {
+	Title         string   `json:"title"`
+	Subtitle      string   `json:"subtitle"`
+	Authors       []Named  `json:"authors"`
+	AuthorName    string   `json:"authorName"` // minified items carry names only
+	Narrators     []string `json:"narrators"`
+	Series        []Series `json:"series"`
+	Genres        []string `json:"genres"`
+	PublishedYear string   `json:"publishedYear"`
+	PublishedDate string   `json:"publishedDate"`
+	Publisher     string   `json:"publisher"`
+	Description   string   `json:"description"`
+	ISBN          string   `json:"isbn"`
+	ASIN          string   `json:"asin"`
+	Language      string   `json:"language"`
+}
+
+// Named is an author.
+type Named struct {
+	Name string `json:"name"`
+}
+
+// Series places a book in a series.
+type Series struct {
+	Name     string `json:"name"`
+	Sequence string `json:"sequence"`
+}
+
+// User is an Audiobookshelf account with its listening data.
+type User struct {
+	ID        string     `json:"id"`
+	Username  string     `json:"username"`
+	Type      string     `json:"type"` // root, admin, user or guest
+	Progress  []Progress `json:"mediaProgress"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// Progress is a user's position in an item.
+type Progress struct {
+	LibraryItemID string  `json:"libraryItemId"`
+	CurrentTime   float64 `json:"currentTime"`
+	Duration      float64 `json:"duration"`
+	IsFinished    bool    `json:"isFinished"`
+	// LastUpdate is in milliseconds since the Unix epoch.
+	LastUpdate int64 `json:"lastUpdate"`
+}
+
+// Bookmark is a user's bookmark in an item.
+type Bookmark struct {
+	LibraryItemID string  `json:"libraryItemId"`
+	Title         string  `json:"title"`
+	Time          float64 `json:"time"`
+	// CreatedAt is in milliseconds since the Unix epoch.
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// ReadJSON decodes an export saved from Audiobookshelf's API.
+func ReadJSON(r io.Reader) (*Export, error) {
+	var export Export
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid Audiobookshelf export: %w", err)
+	}
+	return &export, nil
+}
+
+// AuthorNames joins the names of the book's authors.
+func (m Metadata) AuthorNames() string {
+	if len(m.Authors) == 0 {
+		return strings.TrimSpace(m.AuthorName)
+	}
+	names := make([]string, 0, len(m.Authors))
+	for _, author := range m.Authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// ReleaseDate returns the published date, or the year when only that is
+// known.
+func (m Metadata) ReleaseDate() string {
+	if date := strings.TrimSpace(m.PublishedDate); date != "" {
+		return date
+	}
+	return strings.TrimSpace(m.PublishedYear)
+}
+
+// Time converts an Audiobookshelf timestamp in milliseconds, returning nil
+// for zero.
+func Time(ms int64) *time.Time {
+	if ms <= 0 {
+		return nil
+	}
+	t := time.UnixMilli(ms).UTC()
+	return &t
+}
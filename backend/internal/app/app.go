@@ -4,18 +4,33 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"log"
+	"net"
 	"net/http"
+	"path/filepath"
 	"time"
 
 	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/backup"
+	"github.com/lore/backend/internal/cache"
 	"github.com/lore/backend/internal/config"
+	"github.com/lore/backend/internal/covers"
 	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/dlna"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/httpclient"
+	"github.com/lore/backend/internal/jobs"
+	"github.com/lore/backend/internal/media"
 	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/notify"
+	"github.com/lore/backend/internal/providers"
 	"github.com/lore/backend/internal/repository"
 	"github.com/lore/backend/internal/server"
 	audiobooksvc "github.com/lore/backend/internal/services/audiobooks"
 	importsvc "github.com/lore/backend/internal/services/import"
 	librarysvc "github.com/lore/backend/internal/services/library"
+	"github.com/lore/backend/internal/webhooks"
 )
 
 // Run configures dependencies and starts the HTTP server until the context ends.
@@ -24,7 +39,12 @@ func Run(ctx context.Context, cfg config.Config) error {
 		return err
 	}
 
-	db, err := database.Open(cfg.DatabasePath)
+	db, err := database.Open(cfg.DatabasePath, database.Options{
+		JournalMode:  cfg.DBJournalMode,
+		BusyTimeout:  cfg.DBBusyTimeout,
+		MaxOpenConns: cfg.DBMaxOpenConns,
+		MaxIdleConns: cfg.DBMaxIdleConns,
+	})
 	if err != nil {
 		return err
 	}
@@ -36,7 +56,10 @@ func Run(ctx context.Context, cfg config.Config) error {
 		return err
 	}
 
-	handler := buildHandler(db, cfg)
+	handler, flush := buildHandler(ctx, db, cfg)
+	if cfg.DLNAUser != "" {
+		go announceDLNA(ctx, cfg)
+	}
 	srv := &http.Server{
 		Addr:              cfg.Address,
 		Handler:           handler,
@@ -58,19 +81,176 @@ func Run(ctx context.Context, cfg config.Config) error {
 		defer cancel()
 		_ = srv.Shutdown(shutdownCtx)
 		<-errCh
+		flush()
 		return nil
 	case err := <-errCh:
+		flush()
 		return err
 	}
 }
 
-func buildHandler(db *sql.DB, cfg config.Config) http.Handler {
+// buildHandler wires the services into the HTTP handler. The returned flush
+// writes state buffered in memory, such as progress updates; call it once
+// the server has stopped taking requests.
+func buildHandler(ctx context.Context, db *sql.DB, cfg config.Config) (http.Handler, func()) {
 	repo := repository.New(db)
 	provider := metadata.NoopProvider{}
 	authSvc := auth.NewService(db)
-	librarySvc := librarysvc.NewService(repo, cfg.LibraryBrowseRoot)
-	importSvc := importsvc.NewService(repo, cfg.ImportBrowseRoot)
+	oidcCfg := auth.OIDCConfig{
+		IssuerURL:      cfg.OIDCIssuerURL,
+		ClientID:       cfg.OIDCClientID,
+		ClientSecret:   cfg.OIDCClientSecret,
+		RedirectURL:    cfg.OIDCRedirectURL,
+		Scopes:         cfg.OIDCScopes,
+		UsernameClaim:  cfg.OIDCUsernameClaim,
+		GroupsClaim:    cfg.OIDCGroupsClaim,
+		AdminGroups:    cfg.OIDCAdminGroups,
+		AllowedGroups:  cfg.OIDCAllowedGroups,
+		AllowedDomains: cfg.OIDCAllowedDomains,
+		AutoProvision:  cfg.OIDCAutoProvision,
+		DisplayName:    cfg.OIDCDisplayName,
+		PostLoginURL:   cfg.OIDCPostLoginRedirect,
+	}
+	if oidcCfg.Enabled() {
+		authSvc.EnableOIDC(auth.NewOIDCProvider(oidcCfg))
+	}
+	authSvc.SetRegistrationOpen(cfg.AllowRegistration)
+	detector := media.Detector{Sniff: cfg.MediaMimeSniffing}
+	// ffprobe is preferred when installed; the built-in parser covers
+	// deployments without ffmpeg.
+	prober := media.NewProber()
+	librarySvc := librarysvc.NewService(repo, cfg.LibraryBrowseRoot, detector)
+	librarySvc.SetScanWorkers(cfg.ScanWorkers)
+	librarySvc.SetProber(prober)
+	importSvc := importsvc.NewService(repo, cfg.ImportBrowseRoot, detector)
+	importSvc.SetProber(prober)
+
+	// Services publish their changes on the bus so cached reads go stale
+	// immediately rather than when they expire.
+	bus := events.NewBus()
+	readCache := cache.New(cfg.CacheTTL, cfg.CacheMaxEntries)
+	readCache.Subscribe(bus)
+	authSvc.SetEvents(bus)
+	librarySvc.SetEvents(bus)
+	importSvc.SetEvents(bus)
+	jobManager := jobs.NewManager(ctx)
+
+	senders := []notify.Sender{notify.NewWebhookSender()}
+	smtpCfg := notify.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}
+	if smtpCfg.Enabled() {
+		senders = append(senders, notify.NewSMTPSender(smtpCfg))
+	}
+	notifier := notify.New(repo, senders...)
+	librarySvc.SetNotifier(notifier)
+	importSvc.SetNotifier(notifier)
+
+	hooks := webhooks.NewService(ctx, repo)
+	librarySvc.SetWebhooks(hooks)
+	importSvc.SetWebhooks(hooks)
+	librarySvc.SetScanFailureLimit(cfg.ScanFailureLimit)
+
+	if cfg.StorageCheckInterval > 0 {
+		thresholds := librarysvc.StorageThresholds{
+			LowPercent:      float64(cfg.StorageLowPercent),
+			CriticalPercent: float64(cfg.StorageCriticalPercent),
+		}
+		dataDirs := []string{filepath.Dir(cfg.DatabasePath), cfg.CoversDir}
+		go librarySvc.WatchStorage(ctx, dataDirs, cfg.StorageCheckInterval, thresholds)
+	}
+
+	if cfg.StartupScan {
+		go startupScan(ctx, librarySvc, jobManager, cfg.StartupScanDelay)
+	}
+
+	imageProc := covers.NewProcessor(cfg.ImageWorkers)
+	svc := audiobooksvc.New(repo, provider, detector, covers.NewStore(cfg.CoversDir, imageProc))
+	svc.SetRemoteCovers(covers.NewRemoteCache(cfg.CoverCacheDir, imageProc,
+		httpclient.New(httpclient.Options{Name: "covers", Timeout: 30 * time.Second})))
+	svc.SetWebhooks(hooks)
+	svc.SetCache(readCache)
+	svc.SetEvents(bus)
+	svc.SetProber(prober)
+	hlsCache := media.NewHLSCache(cfg.HLSCacheDir, cfg.HLSCacheTTL)
+	svc.SetHLSCache(hlsCache)
+	go hlsCache.Watch(ctx, time.Hour)
+	svc.SetProviderConfig(&providers.ProviderConfig{
+		Timeout: providers.DefaultConfig().Timeout,
+		Cache:   providers.NewResponseCache(cfg.ProviderCacheTTL, cfg.ProviderCacheDir),
+		Workers: cfg.ProviderWorkers,
+	})
+	if err := svc.LoadMetadataAgents(ctx); err != nil {
+		log.Printf("metadata agents: %v", err)
+	}
+	librarySvc.SetProviders(svc.ProviderNames)
+	librarySvc.SetMatcher(svc.AutoMatch)
+	go librarySvc.WatchAutoScans(ctx, time.Minute, func(libraryID string) {
+		jobManager.Start(librarysvc.JobTypeScan, libraryID, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+			return librarySvc.ScanLibrary(ctx, libraryID)
+		})
+	})
+	svc.SetClientLogRetention(cfg.ClientLogRetention)
+	svc.SetSessionIdleTimeout(cfg.SessionIdleTimeout)
+	go svc.WatchSessions(ctx, time.Minute)
+	svc.SetProgressFlushInterval(cfg.ProgressFlushInterval)
+	go svc.WatchProgress(ctx)
+	svc.SetRetentionDefaults(models.RetentionSettings{
+		SessionDays:  cfg.SessionRetentionDays,
+		StatsDays:    cfg.StatsRetentionDays,
+		ActivityDays: cfg.ActivityRetentionDays,
+	})
+	go svc.WatchRetention(ctx, time.Hour)
+	dlnaCfg := server.DLNAConfig{
+		Username:     cfg.DLNAUser,
+		FriendlyName: cfg.DLNAName,
+		UUID:         dlna.DeviceUUID(cfg.DatabasePath),
+	}
+	backups := backup.NewService(db, cfg.BackupDir, cfg.CoversDir)
+	backups.SetKeep(cfg.BackupKeep)
+	if cfg.BackupInterval > 0 {
+		go backups.Watch(ctx, cfg.BackupInterval)
+	}
+	flush := func() { svc.FlushProgress(context.Background()) }
+	handler := server.New(svc, authSvc, librarySvc, importSvc, jobManager, notifier, hooks, backups, prober, cfg.MediaStreamBufferSize, dlnaCfg)
+	return server.CompressMiddleware(cfg.CompressionLevel)(handler), flush
+}
+
+// announceDLNA advertises the DLNA media server on the local network until
+// ctx ends. The description URL uses DLNA_BASE_URL when set, otherwise the
+// address a renderer reaches the server on and the listen port.
+func announceDLNA(ctx context.Context, cfg config.Config) {
+	_, port, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		log.Printf("dlna: cannot announce: %v", err)
+		return
+	}
+	announcer := dlna.NewAnnouncer(dlna.DeviceUUID(cfg.DatabasePath), func(local net.IP) string {
+		if cfg.DLNABaseURL != "" {
+			return cfg.DLNABaseURL + dlna.DevicePath
+		}
+		return "http://" + net.JoinHostPort(local.String(), port) + dlna.DevicePath
+	})
+	if err := announcer.Run(ctx); err != nil {
+		log.Printf("dlna: %v", err)
+	}
+}
+
+// startupScan waits for delay, then queues a low-priority scan of every
+// library so files added while the server was down show up without an
+// admin starting a scan. The scan is listed with the other background jobs.
+func startupScan(ctx context.Context, librarySvc *librarysvc.Service, jobManager *jobs.Manager, delay time.Duration) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
 
-	svc := audiobooksvc.New(repo, provider)
-	return server.New(svc, authSvc, librarySvc, importSvc)
+	jobManager.Start(librarysvc.JobTypeScan, "all", func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return librarySvc.ScanAllLibrariesLowPriority(ctx, report)
+	})
 }
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+var (
+	ErrAccountDisabled = apperrors.NewHTTPError(http.StatusForbidden, "Account is disabled", ErrForbidden)
+	ErrLastAdmin       = apperrors.NewHTTPError(http.StatusConflict, "Cannot remove the last active admin", ErrForbidden)
+	ErrAccountPending  = apperrors.NewHTTPError(http.StatusForbidden, "Account is awaiting approval", ErrForbidden)
+)
+
+// SetUserDisabled deactivates or reactivates an account. Disabled users cannot
+// sign in or use their API key or feed token, but their listening history is
+// kept so the account can be restored.
+func (s *Service) SetUserDisabled(ctx context.Context, userID string, disabled bool) (*models.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if disabled {
+		if err := ensureOtherAdmin(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	var res sql.Result
+	if disabled {
+		// Keep the original timestamp when the account is already disabled.
+		res, err = tx.ExecContext(ctx, `UPDATE users SET disabled_at = COALESCE(disabled_at, ?) WHERE id = ?`,
+			time.Now().UTC().Format(time.RFC3339), userID)
+	} else {
+		res, err = tx.ExecContext(ctx, `UPDATE users SET disabled_at = NULL WHERE id = ?`, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+// ApproveUser lets a self-registered account awaiting approval sign in.
+// Approving an account that is not pending changes nothing.
+func (s *Service) ApproveUser(ctx context.Context, userID string) (*models.User, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET pending_approval_at = NULL WHERE id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrUserNotFound
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+// DeleteUser permanently removes an account and everything stored for it:
+// listening progress, favourites, listening history, ratings, notification
+// settings and per-audiobook access grants. Download audit entries keep the username but lose the link
+// to the account. Prefer SetUserDisabled unless the data must go.
+func (s *Service) DeleteUser(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureOtherAdmin(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM user_audiobook_data WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM listening_sessions WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_listening_stats WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_reviews WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_goals WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_bookmarks WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_privacy WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM activity WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM erasure_requests WHERE user_id = ? AND status = ?`, []interface{}{userID, models.ErasurePending}},
+		{`DELETE FROM access_tokens WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM notification_settings WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM audiobook_access WHERE principal_type = ? AND principal_id = ?`, []interface{}{models.AccessPrincipalUser, userID}},
+		{`DELETE FROM library_members WHERE user_id = ?`, []interface{}{userID}},
+		{`UPDATE downloads SET user_id = NULL WHERE user_id = ?`, []interface{}{userID}},
+	} {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+
+	return tx.Commit()
+}
+
+// ensureOtherAdmin returns ErrLastAdmin when userID is the only active admin,
+// so that disabling, demoting or deleting it would lock everyone out of the
+// admin API.
+func ensureOtherAdmin(ctx context.Context, tx *sql.Tx, userID string) error {
+	var isAdmin bool
+	var disabledAt, pendingAt sql.NullString
+	err := tx.QueryRowContext(ctx, `
+		SELECT is_admin, disabled_at, pending_approval_at FROM users WHERE id = ?
+	`, userID).Scan(&isAdmin, &disabledAt, &pendingAt)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !isAdmin || disabledAt.Valid || pendingAt.Valid {
+		return nil
+	}
+
+	var others int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM users
+		WHERE is_admin = 1 AND disabled_at IS NULL AND pending_approval_at IS NULL AND id != ?
+	`, userID).Scan(&others); err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func setDisabled(user *models.User, disabledAt sql.NullString) {
+	if !disabledAt.Valid {
+		return
+	}
+	user.Disabled = true
+	if t, err := time.Parse(time.RFC3339, disabledAt.String); err == nil {
+		user.DisabledAt = &t
+	}
+}
+
+func setPendingApproval(user *models.User, pendingAt sql.NullString) {
+	if !pendingAt.Valid {
+		return
+	}
+	user.PendingApproval = true
+	if t, err := time.Parse(time.RFC3339, pendingAt.String); err == nil {
+		user.PendingApprovalAt = &t
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/lore/backend/internal/database"
 	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
 	"github.com/lore/backend/internal/models"
 )
 
@@ -37,7 +39,13 @@ const UserContextKey contextKey = "user"
 
 // Service handles authentication operations.
 type Service struct {
-	db *sql.DB
+	db   *sql.DB
+	oidc *OIDCProvider
+
+	// registrationOpen allows sign-ups without an invite.
+	registrationOpen bool
+
+	events *events.Bus
 }
 
 // NewService creates a new authentication service.
@@ -45,6 +53,12 @@ func NewService(db *sql.DB) *Service {
 	return &Service{db: db}
 }
 
+// SetEvents publishes role changes, which affect role-based audiobook
+// access, to bus.
+func (s *Service) SetEvents(bus *events.Bus) {
+	s.events = bus
+}
+
 // HashPassword hashes a password using bcrypt.
 func (s *Service) HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -97,12 +111,12 @@ func (s *Service) Login(ctx context.Context, username, password string) (*models
 	var passwordHash string
 	var createdAt string
 	var isAdminInt int
-	var apiKey sql.NullString
+	var apiKey, disabledAt, pendingAt sql.NullString
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, username, password_hash, is_admin, api_key, created_at
+		SELECT id, username, password_hash, is_admin, api_key, created_at, disabled_at, pending_approval_at
 		FROM users WHERE username = ?
-	`, username).Scan(&user.ID, &user.Username, &passwordHash, &isAdminInt, &apiKey, &createdAt)
+	`, username).Scan(&user.ID, &user.Username, &passwordHash, &isAdminInt, &apiKey, &createdAt, &disabledAt, &pendingAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -113,6 +127,12 @@ func (s *Service) Login(ctx context.Context, username, password string) (*models
 	if !s.CheckPassword(password, passwordHash) {
 		return nil, ErrInvalidCredentials
 	}
+	if disabledAt.Valid {
+		return nil, ErrAccountDisabled
+	}
+	if pendingAt.Valid {
+		return nil, ErrAccountPending
+	}
 
 	user.IsAdmin = isAdminInt == 1
 	if apiKey.Valid {
@@ -131,11 +151,12 @@ func (s *Service) GetUserByAPIKey(ctx context.Context, apiKey string) (*models.U
 	var user models.User
 	var createdAt string
 	var isAdminInt int
+	var disabledAt, pendingAt sql.NullString
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, username, is_admin, created_at
+		SELECT id, username, is_admin, created_at, disabled_at, pending_approval_at
 		FROM users WHERE api_key = ?
-	`, apiKey).Scan(&user.ID, &user.Username, &isAdminInt, &createdAt)
+	`, apiKey).Scan(&user.ID, &user.Username, &isAdminInt, &createdAt, &disabledAt, &pendingAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -145,6 +166,8 @@ func (s *Service) GetUserByAPIKey(ctx context.Context, apiKey string) (*models.U
 
 	user.IsAdmin = isAdminInt == 1
 	user.APIKey = &apiKey
+	setDisabled(&user, disabledAt)
+	setPendingApproval(&user, pendingAt)
 
 	if user.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
 		return nil, err
@@ -153,17 +176,30 @@ func (s *Service) GetUserByAPIKey(ctx context.Context, apiKey string) (*models.U
 	return &user, nil
 }
 
+// GetUserByUsername retrieves a user by their username.
+func (s *Service) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM users WHERE username = ?`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
 // GetUserByID retrieves a user by their ID.
 func (s *Service) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	var user models.User
 	var createdAt string
 	var isAdminInt int
-	var apiKey sql.NullString
+	var apiKey, disabledAt, pendingAt sql.NullString
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, username, is_admin, api_key, created_at
+		SELECT id, username, is_admin, api_key, created_at, disabled_at, pending_approval_at
 		FROM users WHERE id = ?
-	`, userID).Scan(&user.ID, &user.Username, &isAdminInt, &apiKey, &createdAt)
+	`, userID).Scan(&user.ID, &user.Username, &isAdminInt, &apiKey, &createdAt, &disabledAt, &pendingAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -175,6 +211,8 @@ func (s *Service) GetUserByID(ctx context.Context, userID string) (*models.User,
 	if apiKey.Valid {
 		user.APIKey = &apiKey.String
 	}
+	setDisabled(&user, disabledAt)
+	setPendingApproval(&user, pendingAt)
 
 	if user.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
 		return nil, err
@@ -195,39 +233,87 @@ func (s *Service) UpdateUserAPIKey(ctx context.Context, userID, newAPIKey string
 	return s.GetUserByID(ctx, userID)
 }
 
-// ListUsers returns all users with pagination.
-func (s *Service) ListUsers(ctx context.Context, offset, limit int) ([]*models.User, int, error) {
-	// Get total count
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"username":   "username COLLATE NOCASE",
+	"role":       "is_admin",
+}
+
+// ListUsers returns the users matching filter, one page at a time, along with
+// the total number of matches. Users are newest first unless filter.Sort names
+// another field.
+func (s *Service) ListUsers(ctx context.Context, filter models.UserFilter, offset, limit int) ([]*models.User, int, error) {
+	var conditions []string
+	var args []interface{}
+	switch filter.Role {
+	case models.RoleAdmin:
+		conditions = append(conditions, "is_admin = 1")
+	case models.RoleUser:
+		conditions = append(conditions, "is_admin = 0")
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			conditions = append(conditions, "disabled_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "disabled_at IS NULL")
+		}
+	}
+	if filter.Pending != nil {
+		if *filter.Pending {
+			conditions = append(conditions, "pending_approval_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "pending_approval_at IS NULL")
+		}
+	}
+	if filter.UsernamePrefix != "" {
+		conditions = append(conditions, `username LIKE ? ESCAPE '\'`)
+		args = append(args, database.LikeEscaper.Replace(filter.UsernamePrefix)+"%")
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
 	var total int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&total)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// Get users with pagination
+	order := "created_at DESC"
+	if column, ok := userSortColumns[filter.Sort.Field]; ok {
+		order = column + " ASC"
+		if filter.Sort.Desc {
+			order = column + " DESC"
+		}
+	}
+
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, username, is_admin, created_at
-		FROM users 
-		ORDER BY created_at DESC
+		SELECT id, username, is_admin, created_at, disabled_at, pending_approval_at
+		FROM users`+where+`
+		ORDER BY `+order+`, id
 		LIMIT ? OFFSET ?
-	`, limit, offset)
+	`, append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var users []*models.User
+	users := []*models.User{}
 	for rows.Next() {
 		var user models.User
 		var isAdminInt int
 		var createdAt string
+		var disabledAt, pendingAt sql.NullString
 
-		err := rows.Scan(&user.ID, &user.Username, &isAdminInt, &createdAt)
+		err := rows.Scan(&user.ID, &user.Username, &isAdminInt, &createdAt, &disabledAt, &pendingAt)
 		if err != nil {
 			return nil, 0, err
 		}
 
 		user.IsAdmin = isAdminInt == 1
+		setDisabled(&user, disabledAt)
+		setPendingApproval(&user, pendingAt)
 		if user.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
 			return nil, 0, err
 		}
@@ -235,7 +321,7 @@ func (s *Service) ListUsers(ctx context.Context, offset, limit int) ([]*models.U
 		users = append(users, &user)
 	}
 
-	return users, total, nil
+	return users, total, rows.Err()
 }
 
 // UpdateUser updates user information (admin status, username).
@@ -257,13 +343,30 @@ func (s *Service) UpdateUser(ctx context.Context, userID, username string, isAdm
 		return s.GetUserByID(ctx, userID) // Nothing to update
 	}
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if isAdmin != nil && !*isAdmin {
+		if err := ensureOtherAdmin(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
 	args = append(args, userID)
 	query := "UPDATE users SET " + strings.Join(setParts, ", ") + " WHERE id = ?"
 
-	_, err := s.db.ExecContext(ctx, query, args...)
-	if err != nil {
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
+	if isAdmin != nil {
+		s.events.Publish(events.Event{Type: events.AccessChanged})
+	}
 
 	return s.GetUserByID(ctx, userID)
 }
@@ -281,12 +384,6 @@ func (s *Service) UpdatePassword(ctx context.Context, userID, newPassword string
 	return err
 }
 
-// DeleteUser removes a user from the system.
-func (s *Service) DeleteUser(ctx context.Context, userID string) error {
-	_, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID)
-	return err
-}
-
 // Authenticate validates the Authorization header and returns the associated user.
 func (s *Service) Authenticate(ctx context.Context, authHeader string) (*models.User, error) {
 	if strings.TrimSpace(authHeader) == "" {
@@ -310,6 +407,12 @@ func (s *Service) Authenticate(ctx context.Context, authHeader string) (*models.
 		}
 		return nil, err
 	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	if user.PendingApproval {
+		return nil, ErrAccountPending
+	}
 
 	return user, nil
 }
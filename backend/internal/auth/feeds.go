@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+var (
+	// ErrInvalidFeedToken is returned for feed requests with an unknown,
+	// revoked or expired access token, or one outside its scope.
+	ErrInvalidFeedToken = apperrors.NewHTTPError(http.StatusUnauthorized, "Invalid feed token", ErrUnauthorized)
+	// ErrInvalidMediaToken is returned for signed media URLs that are
+	// malformed, forged, revoked or expired.
+	ErrInvalidMediaToken = apperrors.NewHTTPError(http.StatusUnauthorized, "Invalid or expired media token", ErrUnauthorized)
+)
+
+// feedTokenName names default feed tokens in token listings.
+const feedTokenName = "Feed token"
+
+// mediaScopes are the access token scopes that may stream media files.
+var mediaScopes = []string{models.TokenScopeFeed, models.TokenScopeShare, models.TokenScopeStream}
+
+// FeedToken returns the user's default feed token, the access token they put
+// in feed URLs, creating it on first use. Feed tokens only grant access to
+// feeds, so a leaked feed URL does not expose the account's API key.
+func (s *Service) FeedToken(ctx context.Context, userID string) (string, error) {
+	token, err := s.defaultFeedToken(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return token.Token, nil
+}
+
+// defaultFeedToken loads the user's default feed token, creating it if
+// there is none.
+func (s *Service) defaultFeedToken(ctx context.Context, userID string) (*tokenRecord, error) {
+	const where = `t.user_id = ? AND t.is_default = 1 AND t.revoked_at IS NULL`
+	token, err := s.lookupToken(ctx, where, userID)
+	if err == sql.ErrNoRows {
+		if _, err = s.RotateFeedToken(ctx, userID, ""); err != nil {
+			return nil, err
+		}
+		token, err = s.lookupToken(ctx, where, userID)
+	}
+	return token, err
+}
+
+// RotateFeedToken replaces a user's default feed token, invalidating feed
+// URLs and signed media URLs issued with the old one. ip is recorded in the
+// audit trail.
+func (s *Service) RotateFeedToken(ctx context.Context, userID, ip string) (string, error) {
+	secret, err := s.GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM users WHERE id = ?`, userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var oldID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM access_tokens WHERE user_id = ? AND is_default = 1 AND revoked_at IS NULL
+	`, userID).Scan(&oldID)
+	switch {
+	case err == nil:
+		if err := revokeToken(ctx, tx, &models.AccessToken{ID: oldID, UserID: userID}, userID, "rotated", ip); err != nil {
+			return "", err
+		}
+	case err != sql.ErrNoRows:
+		return "", err
+	}
+
+	token := &models.AccessToken{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Token:     secret,
+		Scope:     models.TokenScopeFeed,
+		Name:      feedTokenName,
+		IsDefault: true,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := insertToken(ctx, tx, token); err != nil {
+		return "", err
+	}
+	if err := recordTokenEvent(ctx, tx, token, userID, models.TokenEventIssued, "", ip); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// MediaSigner issues signed media tokens on behalf of an access token.
+type MediaSigner struct {
+	tokenID string
+	key     []byte
+}
+
+// MediaSigner returns a signer for userID's media tokens. Tokens are keyed
+// with the user's default feed token, so rotating or revoking it revokes
+// every URL issued so far.
+func (s *Service) MediaSigner(ctx context.Context, userID string) (*MediaSigner, error) {
+	token, err := s.defaultFeedToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return TokenSigner(&token.AccessToken), nil
+}
+
+// TokenSigner returns a signer for media tokens that carry the scope of
+// token, as returned by AuthenticateToken, and are revoked with it.
+func TokenSigner(token *models.AccessToken) *MediaSigner {
+	return &MediaSigner{tokenID: token.ID, key: []byte(token.Token)}
+}
+
+// Sign returns a token that lets its holder stream fileID as the signer's
+// user until expires. A zero expires never lapses.
+func (m *MediaSigner) Sign(fileID string, expires time.Time) string {
+	var exp int64
+	if !expires.IsZero() {
+		exp = expires.Unix()
+	}
+	expStr := strconv.FormatInt(exp, 10)
+	return m.tokenID + "." + expStr + "." + mediaSignature(m.key, fileID, m.tokenID, expStr)
+}
+
+// SignAudiobook returns a token that lets its holder stream every file of
+// audiobookID, as one playlist, until expires.
+func (m *MediaSigner) SignAudiobook(audiobookID string, expires time.Time) string {
+	return m.Sign(audiobookSubject(audiobookID), expires)
+}
+
+// VerifyMediaToken checks a token for streaming fileID and returns the user
+// it was issued to. The token is either signed by a MediaSigner or an access
+// token that may stream the file's audiobook.
+func (s *Service) VerifyMediaToken(ctx context.Context, fileID, token, ip string) (*models.User, error) {
+	var audiobookID string
+	err := s.db.QueryRowContext(ctx, `SELECT audiobook_id FROM media_files WHERE id = ?`, fileID).Scan(&audiobookID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidMediaToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.verifyMediaToken(ctx, fileID, audiobookID, token, ip)
+}
+
+// VerifyAudiobookToken checks a token for streaming the whole of
+// audiobookID, either from MediaSigner.SignAudiobook or an access token
+// that may stream it.
+func (s *Service) VerifyAudiobookToken(ctx context.Context, audiobookID, token, ip string) (*models.User, error) {
+	return s.verifyMediaToken(ctx, audiobookSubject(audiobookID), audiobookID, token, ip)
+}
+
+// verifyMediaToken checks token for subject, what the token was signed for,
+// within audiobookID.
+func (s *Service) verifyMediaToken(ctx context.Context, subject, audiobookID, token, ip string) (*models.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		user, _, err := s.AuthenticateToken(ctx, token, audiobookID, ip, mediaScopes...)
+		if err == ErrInvalidFeedToken {
+			return nil, ErrInvalidMediaToken
+		}
+		return user, err
+	}
+
+	signerID, expStr, sig := parts[0], parts[1], parts[2]
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || (exp != 0 && time.Now().Unix() > exp) {
+		return nil, ErrInvalidMediaToken
+	}
+
+	parent, err := s.lookupToken(ctx, `t.id = ?`, signerID)
+	if err == sql.ErrNoRows {
+		// URLs signed before access tokens existed name the user and are
+		// keyed with their default feed token.
+		parent, err = s.lookupToken(ctx, `t.user_id = ? AND t.is_default = 1`, signerID)
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidMediaToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expected := mediaSignature([]byte(parent.Token), subject, signerID, expStr)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return nil, ErrInvalidMediaToken
+	}
+	user, _, err := s.authorizeToken(ctx, parent, audiobookID, ip, mediaScopes)
+	if err == ErrInvalidFeedToken {
+		return nil, ErrInvalidMediaToken
+	}
+	return user, err
+}
+
+// audiobookSubject is what audiobook tokens are signed for; media file IDs
+// never contain a slash, so the two cannot be confused.
+func audiobookSubject(audiobookID string) string {
+	return "audiobook/" + audiobookID
+}
+
+func mediaSignature(key []byte, fileID, signerID, exp string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("media\n" + fileID + "\n" + signerID + "\n" + exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,563 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/httpclient"
+	"github.com/lore/backend/internal/models"
+)
+
+var (
+	// ErrInvalidOIDCState is returned when a callback does not match a pending login.
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCNotAllowed is returned for identities outside the allowed
+	// groups and domains.
+	ErrOIDCNotAllowed = apperrors.NewHTTPError(http.StatusForbidden, "Account is not allowed to sign in", ErrForbidden)
+)
+
+// OIDCStateTTL is how long a started login can be completed.
+const OIDCStateTTL = 10 * time.Minute
+
+// OIDCConfig configures single sign-on against an OpenID Connect provider.
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	AdminGroups   []string
+	// AllowedGroups and AllowedDomains, when either is set, limit sign-in to
+	// members of those groups (or AdminGroups) and to verified email
+	// addresses in those domains.
+	AllowedGroups  []string
+	AllowedDomains []string
+	// AutoProvision creates accounts for new identities even while
+	// self-registration is closed, e.g. when AllowedGroups already limits
+	// who can sign in.
+	AutoProvision bool
+	DisplayName   string
+	// PostLoginURL, when set, receives the browser after a successful login
+	// with the API key in the URL fragment instead of a JSON response.
+	PostLoginURL string
+}
+
+// Enabled reports whether enough configuration is present to offer OIDC login.
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != "" && c.RedirectURL != ""
+}
+
+// OIDCIdentity is the subset of provider claims used to map a login to a user.
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	Groups        []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type oidcPendingLogin struct {
+	verifier  string
+	expiresAt time.Time
+}
+
+// OIDCProvider drives the authorization code flow (with PKCE) against an
+// OpenID Connect provider such as Authentik, Keycloak, or Google.
+//
+// Identity claims are read from the provider's userinfo endpoint using the
+// access token obtained directly from the token endpoint, so the ID token
+// signature does not need to be verified locally.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	pending   map[string]oidcPendingLogin
+}
+
+// NewOIDCProvider creates a provider from configuration.
+func NewOIDCProvider(cfg OIDCConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = "SSO"
+	}
+	return &OIDCProvider{
+		cfg:     cfg,
+		client:  httpclient.New(httpclient.Options{Name: "oidc", Timeout: 15 * time.Second}),
+		pending: make(map[string]oidcPendingLogin),
+	}
+}
+
+// DisplayName returns the label shown on the login screen.
+func (p *OIDCProvider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+// PostLoginURL returns the frontend URL to redirect to after login, if any.
+func (p *OIDCProvider) PostLoginURL() string {
+	return p.cfg.PostLoginURL
+}
+
+// AuthCodeURL starts a login and returns the provider URL to redirect to
+// with the login's state, which the browser must present again on the
+// callback.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context) (string, string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	p.mu.Lock()
+	p.prunePendingLocked()
+	p.pending[state] = oidcPendingLogin{verifier: verifier, expiresAt: time.Now().Add(OIDCStateTTL)}
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// Exchange completes a login by trading the authorization code for tokens and
+// fetching the user's claims.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state string) (*OIDCIdentity, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(login.expiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+	if code == "" {
+		return nil, fmt.Errorf("authorization code missing")
+	}
+
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", login.verifier)
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange: no access token returned")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var claims map[string]interface{}
+	if err := p.doJSON(req, &claims); err != nil {
+		return nil, fmt.Errorf("userinfo: %w", err)
+	}
+
+	identity := &OIDCIdentity{
+		Issuer:   discovery.Issuer,
+		Subject:  claimString(claims, "sub"),
+		Username: claimString(claims, p.cfg.UsernameClaim),
+		Email:    claimString(claims, "email"),
+		Groups:   claimStrings(claims, p.cfg.GroupsClaim),
+		// Some providers send the flag as a string.
+		EmailVerified: claims["email_verified"] == true || claims["email_verified"] == "true",
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("userinfo: missing subject claim")
+	}
+
+	return identity, nil
+}
+
+// IsAdmin reports whether the identity belongs to one of the admin groups.
+// The second return value is false when no admin groups are configured, in
+// which case admin status is managed locally.
+func (p *OIDCProvider) IsAdmin(identity *OIDCIdentity) (isAdmin bool, managed bool) {
+	if len(p.cfg.AdminGroups) == 0 {
+		return false, false
+	}
+	return inGroups(identity, p.cfg.AdminGroups), true
+}
+
+// Allowed reports whether the identity may sign in. Without allowed groups
+// or domains every identity the provider authenticates may.
+func (p *OIDCProvider) Allowed(identity *OIDCIdentity) bool {
+	if len(p.cfg.AllowedGroups) == 0 && len(p.cfg.AllowedDomains) == 0 {
+		return true
+	}
+	if inGroups(identity, p.cfg.AllowedGroups) || inGroups(identity, p.cfg.AdminGroups) {
+		return true
+	}
+	at := strings.LastIndex(identity.Email, "@")
+	if !identity.EmailVerified || at < 0 {
+		return false
+	}
+	for _, domain := range p.cfg.AllowedDomains {
+		if strings.EqualFold(identity.Email[at+1:], strings.TrimPrefix(domain, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroups reports whether the identity belongs to any of groups.
+func inGroups(identity *OIDCIdentity, groups []string) bool {
+	for _, group := range identity.Groups {
+		for _, candidate := range groups {
+			if strings.EqualFold(group, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	endpoint := strings.TrimSuffix(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery oidcDiscovery
+	if err := p.doJSON(req, &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("oidc discovery: provider document is missing required endpoints")
+	}
+	if discovery.Issuer == "" {
+		discovery.Issuer = p.cfg.IssuerURL
+	}
+
+	p.mu.Lock()
+	p.discovery = &discovery
+	p.mu.Unlock()
+
+	return &discovery, nil
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *OIDCProvider) prunePendingLocked() {
+	now := time.Now()
+	for state, login := range p.pending {
+		if now.After(login.expiresAt) {
+			delete(p.pending, state)
+		}
+	}
+}
+
+func randomToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	if value, ok := claims[key].(string); ok {
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
+
+// claimStrings reads a claim that may be either a list or a single string.
+func claimStrings(claims map[string]interface{}, key string) []string {
+	switch value := claims[key].(type) {
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	return nil
+}
+
+// EnableOIDC registers an OIDC provider alongside local password logins.
+func (s *Service) EnableOIDC(provider *OIDCProvider) {
+	s.oidc = provider
+}
+
+// OIDC returns the configured OIDC provider, or nil when SSO is disabled.
+func (s *Service) OIDC() *OIDCProvider {
+	return s.oidc
+}
+
+// LoginOIDC maps an OIDC identity to a local user, provisioning the account on
+// first login as the registration settings allow. Identities outside the allowed groups and domains are refused.
+// When admin groups are configured, admin status is synchronised from the
+// identity's groups on every login.
+func (s *Service) LoginOIDC(ctx context.Context, identity *OIDCIdentity) (*models.User, error) {
+	if s.oidc == nil {
+		return nil, ErrUnauthorized
+	}
+	if !s.oidc.Allowed(identity) {
+		return nil, ErrOIDCNotAllowed
+	}
+	isAdmin, managed := s.oidc.IsAdmin(identity)
+
+	var userID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM users WHERE oidc_issuer = ? AND oidc_subject = ?
+	`, identity.Issuer, identity.Subject).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		userID, err = s.provisionOIDCUser(ctx, identity, isAdmin, managed)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	if user.PendingApproval {
+		return nil, ErrAccountPending
+	}
+	if managed && user.IsAdmin != isAdmin {
+		if err := s.syncOIDCAdmin(ctx, user, isAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	if user.APIKey == nil {
+		apiKey, err := s.GenerateAPIKey()
+		if err != nil {
+			return nil, err
+		}
+		if user, err = s.UpdateUserAPIKey(ctx, userID, apiKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// syncOIDCAdmin sets the user's admin flag from the identity's groups. The
+// last active admin keeps it, so the server is never left without one.
+func (s *Service) syncOIDCAdmin(ctx context.Context, user *models.User, isAdmin bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !isAdmin {
+		if err := ensureOtherAdmin(ctx, tx, user.ID); err != nil {
+			if errors.Is(err, ErrLastAdmin) {
+				fmt.Printf("Warning: %s left the OIDC admin groups but stays admin as the last active admin\n", user.Username)
+				return nil
+			}
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET is_admin = ? WHERE id = ?`, boolToInt(isAdmin), user.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	user.IsAdmin = isAdmin
+	return nil
+}
+
+// provisionOIDCUser creates a local account for a first-time SSO login. The
+// account has no usable password, so it can only sign in through the provider
+// until an admin or the user sets one.
+//
+// Like Register, it needs self-registration to be open (unless AutoProvision
+// is set), holds the account for approval when the settings require it and
+// makes it a member of the settings' libraries. Members of the admin groups
+// are not held.
+func (s *Service) provisionOIDCUser(ctx context.Context, identity *OIDCIdentity, isAdmin, managed bool) (string, error) {
+	settings, err := s.RegistrationSettings(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !settings.Open && !s.oidc.cfg.AutoProvision {
+		return "", ErrRegistrationClosed
+	}
+
+	base := identity.Username
+	if base == "" && identity.Email != "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	if base == "" {
+		base = "user-" + identity.Subject
+		if len(base) > 21 {
+			base = base[:21]
+		}
+	}
+
+	username, err := s.availableUsername(ctx, base)
+	if err != nil {
+		return "", err
+	}
+
+	apiKey, err := s.GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	userID := uuid.NewString()
+	now := time.Now().UTC().Format(time.RFC3339)
+	var pendingAt *string
+	if settings.RequireApproval && !isAdmin {
+		pendingAt = &now
+	}
+	if !managed && settings.DefaultRole == models.RoleAdmin && pendingAt != nil {
+		isAdmin = true
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (id, username, password_hash, is_admin, api_key, oidc_issuer, oidc_subject, created_at, pending_approval_at)
+		VALUES (?, ?, '', ?, ?, ?, ?, ?, ?)
+	`, userID, username, boolToInt(isAdmin), apiKey, identity.Issuer, identity.Subject, now, pendingAt)
+	if err != nil {
+		return "", err
+	}
+	if err := addLibraryMembers(ctx, tx, userID, settings.LibraryIDs, now); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// availableUsername returns base, or base with a numeric suffix if it is taken.
+func (s *Service) availableUsername(ctx context.Context, base string) (string, error) {
+	candidate := base
+	for i := 2; ; i++ {
+		var count int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE username = ?`, candidate).Scan(&count); err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+// DefaultInviteTTL is how long an invite stays valid when no lifetime is given.
+const DefaultInviteTTL = 7 * 24 * time.Hour
+
+var (
+	ErrRegistrationClosed = apperrors.NewHTTPError(http.StatusForbidden, "Self-registration is disabled", ErrForbidden)
+	ErrInvalidInvite      = apperrors.NewHTTPError(http.StatusBadRequest, "Invite is invalid, expired or already used", apperrors.ErrInvalidInput)
+	ErrUsernameTaken      = apperrors.NewHTTPError(http.StatusConflict, "Username is already taken", apperrors.ErrUserExists)
+)
+
+// SetRegistrationOpen sets whether accounts can be created without an
+// invite until an admin saves the registration settings.
+func (s *Service) SetRegistrationOpen(open bool) {
+	s.registrationOpen = open
+}
+
+// RegistrationSettings returns the self-registration policy. Before an admin
+// first saves it, registration is open as configured by SetRegistrationOpen,
+// without approval, and new accounts are regular users of no library.
+func (s *Service) RegistrationSettings(ctx context.Context) (*models.RegistrationSettings, error) {
+	var settings models.RegistrationSettings
+	var libraryIDsJSON, updatedAt string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT open, require_approval, default_role, library_ids, updated_at
+		FROM registration_settings WHERE id = 'default'
+	`).Scan(&settings.Open, &settings.RequireApproval, &settings.DefaultRole, &libraryIDsJSON, &updatedAt)
+	if err == sql.ErrNoRows {
+		return &models.RegistrationSettings{
+			Open:        s.registrationOpen,
+			DefaultRole: models.RoleUser,
+			LibraryIDs:  []string{},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(libraryIDsJSON), &settings.LibraryIDs); err != nil {
+		return nil, err
+	}
+	if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
+		settings.UpdatedAt = &t
+	}
+	return &settings, nil
+}
+
+// UpdateRegistrationSettings saves the self-registration policy.
+func (s *Service) UpdateRegistrationSettings(ctx context.Context, settings *models.RegistrationSettings) error {
+	if settings.LibraryIDs == nil {
+		settings.LibraryIDs = []string{}
+	}
+	libraryIDsJSON, err := json.Marshal(settings.LibraryIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO registration_settings (id, open, require_approval, default_role, library_ids, updated_at)
+		VALUES ('default', ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			open = excluded.open,
+			require_approval = excluded.require_approval,
+			default_role = excluded.default_role,
+			library_ids = excluded.library_ids,
+			updated_at = excluded.updated_at
+	`, boolToInt(settings.Open), boolToInt(settings.RequireApproval), settings.DefaultRole, string(libraryIDsJSON), now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	settings.UpdatedAt = &now
+	return nil
+}
+
+// Register creates an account that joins the registration settings'
+// libraries. With an invite token the invite is redeemed and the user also
+// joins its libraries; without one, self-registration must be open, and the
+// account waits for an admin's approval when the settings require it. Only
+// accounts waiting for approval get the admin default role; all others start
+// as regular users.
+func (s *Service) Register(ctx context.Context, username, password, inviteToken string) (*models.User, error) {
+	settings, err := s.RegistrationSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inviteToken = strings.TrimSpace(inviteToken)
+	if inviteToken == "" && !settings.Open {
+		return nil, ErrRegistrationClosed
+	}
+
+	hash, err := s.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := s.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE username = ?`, username).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrUsernameTaken
+	}
+
+	userID := uuid.NewString()
+	now := time.Now().UTC().Format(time.RFC3339)
+	var pendingAt *string
+	if inviteToken == "" && settings.RequireApproval {
+		pendingAt = &now
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (id, username, password_hash, is_admin, api_key, created_at, pending_approval_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, username, hash, boolToInt(settings.DefaultRole == models.RoleAdmin && pendingAt != nil), apiKey, now, pendingAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if inviteToken != "" {
+		if err := redeemInvite(ctx, tx, inviteToken, userID, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := addLibraryMembers(ctx, tx, userID, settings.LibraryIDs, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+// redeemInvite marks an unused, unexpired invite as used by userID and makes
+// the user a member of the invite's libraries.
+func redeemInvite(ctx context.Context, tx *sql.Tx, token, userID, now string) error {
+	var inviteID, libraryIDsJSON string
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, library_ids FROM invites
+		WHERE token = ? AND used_at IS NULL AND expires_at > ?
+	`, token, now).Scan(&inviteID, &libraryIDsJSON)
+	if err == sql.ErrNoRows {
+		return ErrInvalidInvite
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE invites SET used_by = ?, used_at = ? WHERE id = ? AND used_at IS NULL
+	`, userID, now, inviteID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrInvalidInvite
+	}
+
+	var libraryIDs []string
+	if err := json.Unmarshal([]byte(libraryIDsJSON), &libraryIDs); err != nil {
+		return err
+	}
+	return addLibraryMembers(ctx, tx, userID, libraryIDs, now)
+}
+
+// addLibraryMembers makes userID a member of each library, skipping
+// libraries deleted since they were chosen.
+func addLibraryMembers(ctx context.Context, tx *sql.Tx, userID string, libraryIDs []string, now string) error {
+	for _, libraryID := range libraryIDs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO library_members (library_id, user_id, created_at)
+			SELECT id, ?, ? FROM libraries WHERE id = ?
+		`, userID, now, libraryID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateInvite issues a single-use invite valid for ttl (DefaultInviteTTL
+// when zero) whose user joins the given libraries.
+func (s *Service) CreateInvite(ctx context.Context, createdBy string, libraryIDs []string, ttl time.Duration) (*models.Invite, error) {
+	if ttl <= 0 {
+		ttl = DefaultInviteTTL
+	}
+	if libraryIDs == nil {
+		libraryIDs = []string{}
+	}
+	token, err := s.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	libraryIDsJSON, err := json.Marshal(libraryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	invite := &models.Invite{
+		ID:         uuid.NewString(),
+		Token:      token,
+		LibraryIDs: libraryIDs,
+		CreatedBy:  &createdBy,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO invites (id, token, library_ids, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, invite.ID, invite.Token, string(libraryIDsJSON), createdBy, invite.CreatedAt.Format(time.RFC3339), invite.ExpiresAt.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// ListInvites returns every invite, newest first.
+func (s *Service) ListInvites(ctx context.Context) ([]models.Invite, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, token, library_ids, created_by, created_at, expires_at, used_by, used_at
+		FROM invites
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		var invite models.Invite
+		var libraryIDsJSON, createdAt, expiresAt string
+		var createdBy, usedBy, usedAt sql.NullString
+		if err := rows.Scan(&invite.ID, &invite.Token, &libraryIDsJSON, &createdBy, &createdAt, &expiresAt, &usedBy, &usedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(libraryIDsJSON), &invite.LibraryIDs); err != nil {
+			return nil, err
+		}
+		if createdBy.Valid {
+			invite.CreatedBy = &createdBy.String
+		}
+		if usedBy.Valid {
+			invite.UsedBy = &usedBy.String
+		}
+		invite.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		invite.ExpiresAt, _ = time.Parse(time.RFC3339, expiresAt)
+		if usedAt.Valid {
+			if t, err := time.Parse(time.RFC3339, usedAt.String); err == nil {
+				invite.UsedAt = &t
+			}
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// DeleteInvite revokes an invite. It returns sql.ErrNoRows if there is none.
+func (s *Service) DeleteInvite(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM invites WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
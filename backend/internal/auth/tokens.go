@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+const (
+	// maxActiveTokens bounds the unrevoked, unexpired access tokens a user
+	// may hold.
+	maxActiveTokens = 100
+	// maxTokenNameLength bounds the name of an access token, in characters.
+	maxTokenNameLength = 100
+	// tokenUseInterval is how often last_used_at is refreshed, so streaming
+	// with a token does not write on every range request.
+	tokenUseInterval = time.Minute
+)
+
+// ErrTooManyTokens is returned when issuing a token would exceed
+// maxActiveTokens.
+var ErrTooManyTokens = apperrors.NewHTTPError(http.StatusConflict, fmt.Sprintf("At most %d active access tokens are allowed", maxActiveTokens), apperrors.ErrInvalidInput)
+
+// execer runs statements on a database or inside a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// IssueToken creates an access token for userID on behalf of actorID, the
+// user or an admin, and records it in the audit trail. The caller checks
+// that userID may see the audiobook a token is limited to.
+func (s *Service) IssueToken(ctx context.Context, userID, actorID string, req models.AccessTokenRequest, ip string) (*models.AccessToken, error) {
+	if !validTokenScope(req.Scope) {
+		return nil, apperrors.NewValidationError("scope", "scope must be one of "+strings.Join(models.AccessTokenScopes, ", "), req.Scope)
+	}
+	if req.AudiobookID != nil && *req.AudiobookID == "" {
+		req.AudiobookID = nil
+	}
+	if req.LibraryID != nil && *req.LibraryID == "" {
+		req.LibraryID = nil
+	}
+	switch {
+	case req.Scope == models.TokenScopeShare && req.AudiobookID == nil:
+		return nil, apperrors.NewValidationError("audiobook_id", "share tokens need an audiobook_id", nil)
+	case req.Scope == models.TokenScopeFeed && req.AudiobookID != nil:
+		return nil, apperrors.NewValidationError("audiobook_id", "feed tokens cover every feed; use a share token for one audiobook", *req.AudiobookID)
+	case req.Scope == models.TokenScopeCatalog && req.LibraryID == nil:
+		return nil, apperrors.NewValidationError("library_id", "catalog tokens need a library_id", nil)
+	case req.Scope == models.TokenScopeCatalog && req.AudiobookID != nil:
+		return nil, apperrors.NewValidationError("audiobook_id", "catalog tokens open a whole library", *req.AudiobookID)
+	case req.Scope != models.TokenScopeCatalog && req.LibraryID != nil:
+		return nil, apperrors.NewValidationError("library_id", "only catalog tokens are limited to a library", *req.LibraryID)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, apperrors.NewValidationError("expires_at", "expires_at must be in the future", req.ExpiresAt)
+	}
+	name := strings.TrimSpace(req.Name)
+	if len([]rune(name)) > maxTokenNameLength {
+		return nil, apperrors.NewValidationError("name", fmt.Sprintf("name must be at most %d characters", maxTokenNameLength), name)
+	}
+
+	var active int
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM access_tokens
+		WHERE user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+	`, userID, now.Format(time.RFC3339)).Scan(&active); err != nil {
+		return nil, err
+	}
+	if active >= maxActiveTokens {
+		return nil, ErrTooManyTokens
+	}
+
+	secret, err := s.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	token := &models.AccessToken{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Token:       secret,
+		Scope:       req.Scope,
+		AudiobookID: req.AudiobookID,
+		LibraryID:   req.LibraryID,
+		Name:        name,
+		CreatedAt:   now,
+	}
+	if req.ExpiresAt != nil {
+		expires := req.ExpiresAt.UTC().Truncate(time.Second)
+		token.ExpiresAt = &expires
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := insertToken(ctx, tx, token); err != nil {
+		return nil, err
+	}
+	if err := recordTokenEvent(ctx, tx, token, actorID, models.TokenEventIssued, "", ip); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ListTokens returns the access tokens of userID, or of every user when
+// userID is empty, newest first and without their secrets.
+func (s *Service) ListTokens(ctx context.Context, userID string) ([]models.AccessToken, error) {
+	query := `
+		SELECT id, user_id, scope, audiobook_id, library_id, name, is_default, created_at, expires_at, last_used_at, revoked_at
+		FROM access_tokens`
+	var args []interface{}
+	if userID != "" {
+		query += ` WHERE user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY created_at DESC, id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.AccessToken{}
+	for rows.Next() {
+		var token models.AccessToken
+		var audiobookID, libraryID, expiresAt, lastUsedAt, revokedAt sql.NullString
+		var createdAt string
+		var isDefault int
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Scope, &audiobookID, &libraryID, &token.Name, &isDefault,
+			&createdAt, &expiresAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if audiobookID.Valid {
+			token.AudiobookID = &audiobookID.String
+		}
+		if libraryID.Valid {
+			token.LibraryID = &libraryID.String
+		}
+		token.IsDefault = isDefault == 1
+		token.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		token.ExpiresAt = parseNullTime(expiresAt)
+		token.LastUsedAt = parseNullTime(lastUsedAt)
+		token.RevokedAt = parseNullTime(revokedAt)
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes an access token of userID, or of any user when userID
+// is empty, on behalf of actorID. Revoking the default feed token leaves the
+// user without one until the next is created. It returns sql.ErrNoRows if
+// there is no such token; revoking a revoked token does nothing.
+func (s *Service) RevokeToken(ctx context.Context, id, userID, actorID, ip string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT user_id, revoked_at IS NOT NULL FROM access_tokens WHERE id = ?`
+	args := []interface{}{id}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	token := &models.AccessToken{ID: id}
+	var revoked bool
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&token.UserID, &revoked); err != nil {
+		return err
+	}
+	if revoked {
+		return nil
+	}
+	if err := revokeToken(ctx, tx, token, actorID, "", ip); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListTokenEvents returns a page of the access token audit trail, newest
+// first, optionally limited to one token or one owner.
+func (s *Service) ListTokenEvents(ctx context.Context, tokenID, userID string, offset, limit int) ([]models.AccessTokenEvent, error) {
+	query := `
+		SELECT id, token_id, user_id, actor_id, event, detail, ip, created_at
+		FROM access_token_events
+		WHERE 1 = 1`
+	var args []interface{}
+	if tokenID != "" {
+		query += ` AND token_id = ?`
+		args = append(args, tokenID)
+	}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AccessTokenEvent{}
+	for rows.Next() {
+		var event models.AccessTokenEvent
+		var actorID, detail, ip sql.NullString
+		var createdAt string
+		if err := rows.Scan(&event.ID, &event.TokenID, &event.UserID, &actorID, &event.Event, &detail, &ip, &createdAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			event.ActorID = &actorID.String
+		}
+		if detail.Valid {
+			event.Detail = &detail.String
+		}
+		if ip.Valid {
+			event.IP = &ip.String
+		}
+		event.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// AuthenticateToken resolves the owner of an access token presented for
+// audiobookID (empty for requests not about one audiobook). The token must
+// have one of scopes, be neither revoked nor expired, and, if it is limited
+// to an audiobook, be presented for that one. Refusals of a known token are
+// recorded in the audit trail. Every failure returns ErrInvalidFeedToken.
+func (s *Service) AuthenticateToken(ctx context.Context, secret, audiobookID, ip string, scopes ...string) (*models.User, *models.AccessToken, error) {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return nil, nil, ErrInvalidFeedToken
+	}
+	token, err := s.lookupToken(ctx, `t.token = ?`, secret)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidFeedToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.authorizeToken(ctx, token, audiobookID, ip, scopes)
+}
+
+// authorizeToken checks that token may be used for audiobookID with one of
+// scopes and returns its owner.
+func (s *Service) authorizeToken(ctx context.Context, token *tokenRecord, audiobookID, ip string, scopes []string) (*models.User, *models.AccessToken, error) {
+	now := time.Now().UTC()
+	var refusal string
+	switch {
+	case token.RevokedAt != nil:
+		refusal = "revoked"
+	case token.ExpiresAt != nil && !now.Before(*token.ExpiresAt):
+		refusal = "expired"
+	case !containsScope(scopes, token.Scope):
+		refusal = "scope " + token.Scope + " does not allow this request"
+	case token.AudiobookID != nil && *token.AudiobookID != audiobookID:
+		refusal = "token is limited to another audiobook"
+	case token.ownerDisabled:
+		// Disabled accounts are refused like unknown tokens, as before.
+		return nil, nil, ErrInvalidFeedToken
+	}
+	if refusal != "" {
+		if err := recordTokenEvent(ctx, s.db, &token.AccessToken, "", models.TokenEventRefused, refusal, ip); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidFeedToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= tokenUseInterval {
+		// Usage tracking is best effort.
+		s.db.ExecContext(ctx, `UPDATE access_tokens SET last_used_at = ? WHERE id = ?`, now.Format(time.RFC3339), token.ID)
+	}
+
+	user, err := s.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, &token.AccessToken, nil
+}
+
+// tokenRecord is a stored access token with its secret and whether its
+// owner is disabled.
+type tokenRecord struct {
+	models.AccessToken
+	ownerDisabled bool
+}
+
+// lookupToken loads the access token matching where, e.g. `t.id = ?`.
+func (s *Service) lookupToken(ctx context.Context, where string, args ...interface{}) (*tokenRecord, error) {
+	var token tokenRecord
+	var audiobookID, libraryID, expiresAt, lastUsedAt, revokedAt sql.NullString
+	var createdAt string
+	var isDefault int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, t.token, t.scope, t.audiobook_id, t.library_id, t.name, t.is_default,
+		       t.created_at, t.expires_at, t.last_used_at, t.revoked_at, u.disabled_at IS NOT NULL
+		FROM access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE `+where+`
+		ORDER BY t.revoked_at IS NOT NULL, t.created_at DESC
+		LIMIT 1
+	`, args...).Scan(&token.ID, &token.UserID, &token.Token, &token.Scope, &audiobookID, &libraryID, &token.Name, &isDefault,
+		&createdAt, &expiresAt, &lastUsedAt, &revokedAt, &token.ownerDisabled)
+	if err != nil {
+		return nil, err
+	}
+	if audiobookID.Valid {
+		token.AudiobookID = &audiobookID.String
+	}
+	if libraryID.Valid {
+		token.LibraryID = &libraryID.String
+	}
+	token.IsDefault = isDefault == 1
+	token.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	token.ExpiresAt = parseNullTime(expiresAt)
+	token.LastUsedAt = parseNullTime(lastUsedAt)
+	token.RevokedAt = parseNullTime(revokedAt)
+	return &token, nil
+}
+
+func insertToken(ctx context.Context, db execer, token *models.AccessToken) error {
+	var expiresAt interface{}
+	if token.ExpiresAt != nil {
+		expiresAt = token.ExpiresAt.Format(time.RFC3339)
+	}
+	var audiobookID, libraryID interface{}
+	if token.AudiobookID != nil {
+		audiobookID = *token.AudiobookID
+	}
+	if token.LibraryID != nil {
+		libraryID = *token.LibraryID
+	}
+	isDefault := 0
+	if token.IsDefault {
+		isDefault = 1
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO access_tokens (id, user_id, token, scope, audiobook_id, library_id, name, is_default, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.ID, token.UserID, token.Token, token.Scope, audiobookID, libraryID, token.Name, isDefault,
+		token.CreatedAt.Format(time.RFC3339), expiresAt)
+	return err
+}
+
+// revokeToken marks token revoked and records it in the audit trail.
+func revokeToken(ctx context.Context, db execer, token *models.AccessToken, actorID, detail, ip string) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := db.ExecContext(ctx, `
+		UPDATE access_tokens SET revoked_at = ? WHERE id = ?
+	`, now.Format(time.RFC3339), token.ID); err != nil {
+		return err
+	}
+	token.RevokedAt = &now
+	return recordTokenEvent(ctx, db, token, actorID, models.TokenEventRevoked, detail, ip)
+}
+
+func recordTokenEvent(ctx context.Context, db execer, token *models.AccessToken, actorID, event, detail, ip string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO access_token_events (token_id, user_id, actor_id, event, detail, ip, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, token.ID, token.UserID, nullIfEmpty(actorID), event, nullIfEmpty(detail), nullIfEmpty(ip),
+		time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func validTokenScope(scope string) bool {
+	return containsScope(models.AccessTokenScopes, scope)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNullTime(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,260 @@
+// Package backup writes archives of the database and uploaded covers, so a
+// server can be restored after losing its disk.
+//
+// An archive is a zip holding lore.db, a consistent snapshot of the database
+// taken with VACUUM INTO while the server keeps running, and the covers
+// directory under covers/. Restoring means stopping the server and putting
+// both back in place.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DatabaseEntry and CoversEntry name the database and covers in an archive.
+const (
+	DatabaseEntry = "lore.db"
+	CoversEntry   = "covers/"
+)
+
+// namePattern matches the archives this package writes.
+var namePattern = regexp.MustCompile(`^lore-backup-\d{8}-\d{6}\.zip$`)
+
+// Backup describes an archive in the backup directory.
+type Backup struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Service creates and lists backups in a directory.
+type Service struct {
+	db        *sql.DB
+	dir       string
+	coversDir string
+	// keep is how many archives are kept; older ones are removed after each
+	// backup. Zero keeps them all.
+	keep int
+
+	mu sync.Mutex
+}
+
+// NewService writes backups of db and coversDir to dir.
+func NewService(db *sql.DB, dir, coversDir string) *Service {
+	return &Service{db: db, dir: dir, coversDir: coversDir}
+}
+
+// SetKeep keeps the newest n archives, removing older ones after each
+// backup. Zero keeps them all.
+func (s *Service) SetKeep(n int) {
+	if n >= 0 {
+		s.keep = n
+	}
+}
+
+// Create writes a new archive and removes archives beyond the number kept.
+// Backups run one at a time.
+func (s *Service) Create(ctx context.Context) (*Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create backup dir: %w", err)
+	}
+	now := time.Now().UTC()
+	name := "lore-backup-" + now.Format("20060102-150405") + ".zip"
+	if _, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	// VACUUM INTO refuses to overwrite, so the snapshot gets a fresh name.
+	snapshot := filepath.Join(s.dir, "."+strings.TrimSuffix(name, ".zip")+".db")
+	os.Remove(snapshot)
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot database: %w", err)
+	}
+	defer os.Remove(snapshot)
+
+	partial := filepath.Join(s.dir, "."+name+".partial")
+	if err := s.writeArchive(ctx, partial, snapshot, now); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	path := filepath.Join(s.dir, name)
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.prune(); err != nil {
+		log.Printf("backup: prune old archives: %v", err)
+	}
+	return &Backup{Name: name, Size: info.Size(), CreatedAt: now.Truncate(time.Second)}, nil
+}
+
+func (s *Service) writeArchive(ctx context.Context, path, snapshot string, now time.Time) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	if err := addFile(zw, DatabaseEntry, snapshot, zip.Deflate, now); err != nil {
+		return fmt.Errorf("archive database: %w", err)
+	}
+
+	err = filepath.WalkDir(s.coversDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == s.coversDir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.coversDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Images are compressed already.
+		return addFile(zw, CoversEntry+filepath.ToSlash(rel), path, zip.Store, info.ModTime())
+	})
+	if err != nil {
+		return fmt.Errorf("archive covers: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func addFile(zw *zip.Writer, name, path string, method uint16, modified time.Time) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified.UTC()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// List returns the archives in the backup directory, newest first.
+func (s *Service) List() ([]Backup, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !namePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		created, err := time.Parse("20060102-150405", strings.TrimSuffix(strings.TrimPrefix(entry.Name(), "lore-backup-"), ".zip"))
+		if err != nil {
+			created = info.ModTime().UTC()
+		}
+		backups = append(backups, Backup{Name: entry.Name(), Size: info.Size(), CreatedAt: created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// Path returns the file of an archive, or an error wrapping fs.ErrNotExist
+// when name is not an archive in the backup directory.
+func (s *Service) Path(name string) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("backup %q: %w", name, fs.ErrNotExist)
+	}
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Delete removes an archive.
+func (s *Service) Delete(name string) error {
+	path, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune removes the archives beyond the number kept.
+func (s *Service) prune() error {
+	if s.keep <= 0 {
+		return nil
+	}
+	backups, err := s.List()
+	if err != nil {
+		return err
+	}
+	for i := s.keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(s.dir, backups[i].Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch creates a backup each interval until ctx ends.
+func (s *Service) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if backup, err := s.Create(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("backup: %v", err)
+			}
+		} else {
+			log.Printf("backup: wrote %s (%d bytes)", backup.Name, backup.Size)
+		}
+	}
+}
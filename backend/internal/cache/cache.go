@@ -0,0 +1,183 @@
+// Package cache keeps the results of expensive read queries in memory for a
+// short time, keyed by the user, library and parameters they were computed
+// for. Entries are dropped when they expire or when an event on the bus
+// reports a change that makes them stale.
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lore/backend/internal/events"
+)
+
+// Key identifies a cached result. LibraryID is empty for results spanning
+// every library.
+type Key struct {
+	UserID    string
+	LibraryID string
+	Name      string
+	Params    string
+}
+
+// Stats describes the cache's contents and effectiveness.
+type Stats struct {
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries"`
+	TTLSeconds int    `json:"ttl_seconds"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+}
+
+// Cache is a size-bounded map of results with a fixed lifetime. A nil Cache
+// caches nothing, so callers can use it unconditionally.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[Key]entry
+	// generation changes on every invalidation, so results loaded while
+	// one happened are not stored.
+	generation uint64
+	hits       uint64
+	misses     uint64
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// New creates a Cache keeping results for ttl, at most maxEntries at a time.
+// It returns nil, caching nothing, when ttl or maxEntries is not positive.
+func New(ttl time.Duration, maxEntries int) *Cache {
+	if ttl <= 0 || maxEntries <= 0 {
+		return nil
+	}
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[Key]entry),
+	}
+}
+
+// Load returns the value cached under key, calling load and caching its
+// result on a miss. Errors are returned without being cached. Values are
+// shared between callers and must not be modified.
+func (c *Cache) Load(key Key, load func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return load()
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && c.now().Before(e.expires) {
+		c.hits++
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	c.misses++
+	generation := c.generation
+	c.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.store(key, value)
+	}
+	return value, nil
+}
+
+// store adds an entry, first making room by dropping expired entries and,
+// if that is not enough, an arbitrary one. c.mu must be held.
+func (c *Cache) store(key Key, value interface{}) {
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry{value: value, expires: now.Add(c.ttl)}
+}
+
+// InvalidateLibrary drops the results for libraryID and those spanning every
+// library. An empty libraryID drops everything.
+func (c *Cache) InvalidateLibrary(libraryID string) {
+	if libraryID == "" {
+		c.Clear()
+		return
+	}
+	c.invalidate(func(k Key) bool { return k.LibraryID == libraryID || k.LibraryID == "" })
+}
+
+// InvalidateUser drops every result computed for userID.
+func (c *Cache) InvalidateUser(userID string) {
+	c.invalidate(func(k Key) bool { return k.UserID == userID })
+}
+
+// Clear drops every result.
+func (c *Cache) Clear() {
+	c.invalidate(func(Key) bool { return true })
+}
+
+func (c *Cache) invalidate(match func(Key) bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for k := range c.entries {
+		if match(k) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Stats reports the number of entries and the hits and misses so far.
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Entries:    len(c.entries),
+		MaxEntries: c.maxEntries,
+		TTLSeconds: int(c.ttl / time.Second),
+		Hits:       c.hits,
+		Misses:     c.misses,
+	}
+}
+
+// Subscribe drops the entries made stale by events published on bus.
+func (c *Cache) Subscribe(bus *events.Bus) {
+	if c == nil || bus == nil {
+		return
+	}
+	bus.Subscribe(func(event events.Event) {
+		switch event.Type {
+		case events.CatalogChanged:
+			c.InvalidateLibrary(event.LibraryID)
+		case events.UserDataChanged:
+			c.InvalidateUser(event.UserID)
+		default:
+			c.Clear()
+		}
+	})
+}
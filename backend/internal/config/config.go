@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config contains runtime configuration for the API server.
@@ -14,6 +17,117 @@ type Config struct {
 	AdminPassword     string
 	LibraryBrowseRoot string
 	ImportBrowseRoot  string
+	// CoversDir holds uploaded cover images and their thumbnails.
+	CoversDir string
+	// CoverCacheDir holds copies of remote covers served through the server.
+	CoverCacheDir string
+	// BackupDir holds backup archives. A backup is written every
+	// BackupInterval (zero disables scheduled backups) and the newest
+	// BackupKeep archives are kept (zero keeps them all).
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	// ImageWorkers bounds how many cover images are decoded or resized at once.
+	ImageWorkers int
+	// ScanWorkers bounds how many directories are walked, and media files
+	// analysed, at once during a library scan.
+	ScanWorkers int
+	// CacheTTL is how long library listings, filter counts and home shelves
+	// are cached; zero disables the cache. CacheMaxEntries bounds its size.
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+	// ProviderCacheTTL is how long metadata provider results are cached;
+	// zero disables the cache. Results are also kept in ProviderCacheDir so
+	// they survive restarts. ProviderWorkers bounds
+	// how many book details one provider search fetches at once.
+	ProviderCacheTTL time.Duration
+	ProviderCacheDir string
+	ProviderWorkers  int
+	// AllowRegistration lets anyone create an account; otherwise new
+	// accounts need an admin or an invite.
+	AllowRegistration bool
+	// StartupScan scans every library at low priority StartupScanDelay
+	// after the server starts, picking up files added while it was down.
+	StartupScan      bool
+	StartupScanDelay time.Duration
+	// ClientLogRetention is how long error reports submitted by clients are
+	// kept; zero keeps them forever.
+	ClientLogRetention time.Duration
+	// SessionIdleTimeout is how long a listening session may go without a
+	// progress update before it is closed and counted in listening stats.
+	SessionIdleTimeout time.Duration
+	// ProgressFlushInterval is how often buffered progress updates are
+	// written; zero writes each update straight away.
+	ProgressFlushInterval time.Duration
+	// Days closed listening sessions, daily listening stats and activity
+	// records (downloads, access token events) are kept until an admin
+	// saves retention settings; zero keeps them forever.
+	SessionRetentionDays  int
+	StatsRetentionDays    int
+	ActivityRetentionDays int
+	// StorageCheckInterval is how often free disk space is checked; zero
+	// disables storage warnings. Admins are warned when a file system holding
+	// the data directory or a library has less than StorageLowPercent free,
+	// and again below StorageCriticalPercent.
+	StorageCheckInterval   time.Duration
+	StorageLowPercent      int
+	StorageCriticalPercent int
+	// ScanFailureLimit is how many scans of a library in a row must fail
+	// before admins are warned.
+	ScanFailureLimit int
+
+	// SMTP server used for email notifications; email is disabled while
+	// SMTPHost or SMTPFrom is empty.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// MediaMimeSniffing inspects file contents at scan/import time instead
+	// of trusting the extension alone.
+	MediaMimeSniffing bool
+	// MediaStreamBufferSize is the copy buffer, in bytes, used when streaming
+	// transcoded media. Direct plays use sendfile where the platform allows.
+	MediaStreamBufferSize int
+	// CompressionLevel is the gzip/deflate level (1-9) for JSON, feed and
+	// other text responses; zero turns compression off.
+	CompressionLevel int
+	// HLSCacheDir holds the audio segments cut for HLS playback; segments
+	// nobody has fetched for HLSCacheTTL are removed.
+	HLSCacheDir string
+	HLSCacheTTL time.Duration
+
+	// SQLite tuning: the journal mode, how long a query waits for another
+	// connection's lock, and the connection pool's size.
+	DBJournalMode  string
+	DBBusyTimeout  time.Duration
+	DBMaxOpenConns int
+	DBMaxIdleConns int
+
+	// DLNAUser, when set, runs a DLNA media server that shares the
+	// audiobooks this user can see with smart speakers and TVs on the
+	// local network, which cannot sign in. DLNAName is the name they show,
+	// and DLNABaseURL overrides the address announced to them.
+	DLNAUser    string
+	DLNAName    string
+	DLNABaseURL string
+
+	// Optional OpenID Connect single sign-on. Local username/password
+	// logins keep working whether or not OIDC is configured.
+	OIDCIssuerURL         string
+	OIDCClientID          string
+	OIDCClientSecret      string
+	OIDCRedirectURL       string
+	OIDCScopes            []string
+	OIDCUsernameClaim     string
+	OIDCGroupsClaim       string
+	OIDCAdminGroups       []string
+	OIDCAllowedGroups     []string
+	OIDCAllowedDomains    []string
+	OIDCAutoProvision     bool
+	OIDCDisplayName       string
+	OIDCPostLoginRedirect string
 }
 
 // Load builds a Config from environment variables, applying sensible defaults.
@@ -25,12 +139,76 @@ func Load() Config {
 		AdminPassword:     getEnv("ADMIN_PASSWORD", "admin"),
 		LibraryBrowseRoot: getEnv("LIBRARY_ROOT", "."),
 		ImportBrowseRoot:  getEnv("IMPORT_ROOT", "."),
+		CoversDir:         getEnv("COVERS_DIR", filepath.Join("data", "covers")),
+		CoverCacheDir:     getEnv("COVER_CACHE_DIR", filepath.Join("data", "cover-cache")),
+		BackupDir:         getEnv("BACKUP_DIR", filepath.Join("data", "backups")),
+		ProviderCacheDir:  getEnv("PROVIDER_CACHE_DIR", filepath.Join("data", "provider-cache")),
+		HLSCacheDir:       getEnv("HLS_CACHE_DIR", filepath.Join("data", "hls-cache")),
+		MediaMimeSniffing: getEnvBool("MEDIA_MIME_SNIFFING", true),
+		AllowRegistration: getEnvBool("ALLOW_REGISTRATION", false),
+		StartupScan:       getEnvBool("STARTUP_SCAN", false),
+
+		MediaStreamBufferSize: getEnvInt("MEDIA_STREAM_BUFFER_KB", 64) << 10,
+		CompressionLevel:      getEnvNonNegativeInt("COMPRESSION_LEVEL", 5),
+		DBJournalMode:         getEnv("DB_JOURNAL_MODE", "WAL"),
+		DBBusyTimeout:         time.Duration(getEnvNonNegativeInt("DB_BUSY_TIMEOUT_MS", 5000)) * time.Millisecond,
+		DBMaxOpenConns:        getEnvNonNegativeInt("DB_MAX_OPEN_CONNS", 8),
+		DBMaxIdleConns:        getEnvNonNegativeInt("DB_MAX_IDLE_CONNS", 4),
+		ImageWorkers:          getEnvInt("IMAGE_WORKERS", 2),
+		ScanWorkers:           getEnvInt("SCAN_WORKERS", 4),
+		CacheTTL:              time.Duration(getEnvInt("CACHE_TTL_SECONDS", 30)) * time.Second,
+		CacheMaxEntries:       getEnvInt("CACHE_MAX_ENTRIES", 10000),
+		ProviderCacheTTL:      time.Duration(getEnvNonNegativeInt("PROVIDER_CACHE_TTL_HOURS", 24)) * time.Hour,
+		ProviderWorkers:       getEnvInt("PROVIDER_WORKERS", 4),
+		HLSCacheTTL:           time.Duration(getEnvInt("HLS_CACHE_TTL_HOURS", 24)) * time.Hour,
+		StartupScanDelay:      time.Duration(getEnvInt("STARTUP_SCAN_DELAY_SECONDS", 60)) * time.Second,
+		BackupInterval:        time.Duration(getEnvNonNegativeInt("BACKUP_INTERVAL_HOURS", 0)) * time.Hour,
+		BackupKeep:            getEnvNonNegativeInt("BACKUP_KEEP", 7),
+		ClientLogRetention:    time.Duration(getEnvNonNegativeInt("CLIENT_LOG_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		SessionIdleTimeout:    time.Duration(getEnvInt("SESSION_IDLE_TIMEOUT_MINUTES", 30)) * time.Minute,
+		ProgressFlushInterval: time.Duration(getEnvNonNegativeInt("PROGRESS_FLUSH_SECONDS", 10)) * time.Second,
+		SessionRetentionDays:  getEnvNonNegativeInt("SESSION_RETENTION_DAYS", 0),
+		StatsRetentionDays:    getEnvNonNegativeInt("LISTENING_STATS_RETENTION_DAYS", 0),
+		ActivityRetentionDays: getEnvNonNegativeInt("ACTIVITY_RETENTION_DAYS", 0),
+
+		StorageCheckInterval:   time.Duration(getEnvNonNegativeInt("STORAGE_CHECK_INTERVAL_MINUTES", 15)) * time.Minute,
+		StorageLowPercent:      getEnvInt("STORAGE_LOW_PERCENT", 10),
+		StorageCriticalPercent: getEnvInt("STORAGE_CRITICAL_PERCENT", 5),
+		ScanFailureLimit:       getEnvInt("SCAN_FAILURE_LIMIT", 3),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
+
+		DLNAUser:    getEnv("DLNA_USER", ""),
+		DLNAName:    getEnv("DLNA_NAME", "Lore"),
+		DLNABaseURL: strings.TrimSuffix(getEnv("DLNA_BASE_URL", ""), "/"),
+
+		OIDCIssuerURL:         getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:          getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:      getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:       getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:            splitList(getEnv("OIDC_SCOPES", "openid,profile,email,groups")),
+		OIDCUsernameClaim:     getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCGroupsClaim:       getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCAdminGroups:       splitList(getEnv("OIDC_ADMIN_GROUPS", "")),
+		OIDCAllowedGroups:     splitList(getEnv("OIDC_ALLOWED_GROUPS", "")),
+		OIDCAllowedDomains:    splitList(getEnv("OIDC_ALLOWED_DOMAINS", "")),
+		OIDCAutoProvision:     getEnvBool("OIDC_AUTO_PROVISION", false),
+		OIDCDisplayName:       getEnv("OIDC_DISPLAY_NAME", "SSO"),
+		OIDCPostLoginRedirect: getEnv("OIDC_POST_LOGIN_REDIRECT", ""),
 	}
 
 	// Ensure absolute paths
 	cfg.DatabasePath = ensureAbsolute(cfg.DatabasePath)
 	cfg.LibraryBrowseRoot = ensureAbsolute(cfg.LibraryBrowseRoot)
 	cfg.ImportBrowseRoot = ensureAbsolute(cfg.ImportBrowseRoot)
+	cfg.CoversDir = ensureAbsolute(cfg.CoversDir)
+	cfg.CoverCacheDir = ensureAbsolute(cfg.CoverCacheDir)
+	cfg.ProviderCacheDir = ensureAbsolute(cfg.ProviderCacheDir)
+	cfg.HLSCacheDir = ensureAbsolute(cfg.HLSCacheDir)
 
 	return cfg
 }
@@ -42,6 +220,55 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(val)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvInt(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(val)
+	if err != nil || parsed <= 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvNonNegativeInt is getEnvInt for settings where zero turns a
+// feature off.
+func getEnvNonNegativeInt(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(val)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// splitList parses a comma or space separated list, dropping empty entries.
+func splitList(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
 func ensureAbsolute(path string) string {
 	if filepath.IsAbs(path) {
 		return path
@@ -57,6 +284,7 @@ func ensureAbsolute(path string) string {
 func EnsureRuntimeDirs(cfg Config) error {
 	dirsToCreate := []string{
 		filepath.Dir(cfg.DatabasePath),
+		cfg.CoversDir,
 	}
 
 	for _, dir := range dirsToCreate {
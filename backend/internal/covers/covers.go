@@ -0,0 +1,324 @@
+// Package covers stores uploaded cover images and their thumbnails on disk.
+package covers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register GIF decoder
+	"image/jpeg"
+	_ "image/png" // register PNG decoder
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// MaxUploadSize is the largest cover image accepted, in bytes.
+	MaxUploadSize = 10 << 20
+	// MaxDimension bounds width and height to keep decoding cheap.
+	MaxDimension = 8000
+	// ThumbnailSize is the longest edge of generated thumbnails, in pixels.
+	ThumbnailSize = 300
+)
+
+var (
+	// ErrUnsupportedType is returned for uploads that are not JPEG, PNG or GIF images.
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or GIF image")
+	// ErrTooLarge is returned for uploads over MaxUploadSize or MaxDimension.
+	ErrTooLarge = errors.New("cover image is too large")
+	// ErrNotFound is returned when no cover is stored for an audiobook.
+	ErrNotFound = errors.New("cover not found")
+	// ErrInvalidSize is returned when a cover is requested at a size not in Sizes.
+	ErrInvalidSize = errors.New("unsupported cover size")
+)
+
+// Sizes are the longest-edge sizes, in pixels, covers can be requested at.
+// Resized copies are generated on first request and cached on disk.
+var Sizes = []int{150, ThumbnailSize, 600, 1200}
+
+// extensions maps accepted content types to the extension used on disk.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Store keeps one cover per audiobook in a directory.
+type Store struct {
+	dir  string
+	proc *Processor
+}
+
+// NewStore creates a Store rooted at dir that decodes and resizes images on
+// proc, or on a default Processor when proc is nil.
+func NewStore(dir string, proc *Processor) *Store {
+	if proc == nil {
+		proc = NewProcessor(DefaultWorkers)
+	}
+	return &Store{dir: dir, proc: proc}
+}
+
+// Save validates an uploaded image and stores it with a JPEG thumbnail,
+// replacing any previous cover of the audiobook, and returns its placeholder.
+// The image is copied to disk from src rather than held in memory; only
+// decoding for the thumbnail and placeholder needs the pixels, which happens
+// on the Store's Processor.
+func (s *Store) Save(ctx context.Context, audiobookID string, src io.ReadSeeker, size int64) (Placeholder, error) {
+	if size > MaxUploadSize {
+		return Placeholder{}, ErrTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Placeholder{}, fmt.Errorf("read cover: %w", err)
+	}
+	ext, ok := extensions[http.DetectContentType(head[:n])]
+	if !ok {
+		return Placeholder{}, ErrUnsupportedType
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return Placeholder{}, fmt.Errorf("read cover: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return Placeholder{}, ErrUnsupportedType
+	}
+	if cfg.Width > MaxDimension || cfg.Height > MaxDimension {
+		return Placeholder{}, ErrTooLarge
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return Placeholder{}, fmt.Errorf("create covers dir: %w", err)
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return Placeholder{}, fmt.Errorf("read cover: %w", err)
+	}
+	var thumb string
+	var placeholder Placeholder
+	err = s.proc.Run(ctx, func() error {
+		img, _, err := image.Decode(src)
+		if err != nil {
+			return ErrUnsupportedType
+		}
+		placeholder = ComputePlaceholder(img)
+		thumb, err = s.writeTemp(func(w io.Writer) error {
+			return jpeg.Encode(w, thumbnail(img, ThumbnailSize), &jpeg.Options{Quality: 85})
+		})
+		if err != nil {
+			return fmt.Errorf("write thumbnail: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Placeholder{}, err
+	}
+	defer os.Remove(thumb)
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return Placeholder{}, fmt.Errorf("read cover: %w", err)
+	}
+	original, err := s.writeTemp(func(w io.Writer) error {
+		_, err := io.Copy(w, io.LimitReader(src, MaxUploadSize))
+		return err
+	})
+	if err != nil {
+		return Placeholder{}, fmt.Errorf("write cover: %w", err)
+	}
+	defer os.Remove(original)
+
+	if err := s.Delete(audiobookID); err != nil {
+		return Placeholder{}, err
+	}
+	if err := os.Rename(original, s.originalPath(audiobookID, ext)); err != nil {
+		return Placeholder{}, fmt.Errorf("write cover: %w", err)
+	}
+	if err := os.Rename(thumb, s.thumbnailPath(audiobookID)); err != nil {
+		return Placeholder{}, fmt.Errorf("write thumbnail: %w", err)
+	}
+	return placeholder, nil
+}
+
+// writeTemp writes a temporary file in the covers directory and returns its
+// path, so the final files only appear once complete.
+func (s *Store) writeTemp(write func(io.Writer) error) (string, error) {
+	f, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Path returns the file holding an audiobook's cover, or a resized JPEG copy
+// when size is one of Sizes. Resized copies are generated on demand on the
+// Store's Processor; concurrent requests for the same copy share one run.
+func (s *Store) Path(ctx context.Context, audiobookID string, size int) (string, error) {
+	original, err := s.original(audiobookID)
+	if err != nil || size == 0 {
+		return original, err
+	}
+	if !validSize(size) {
+		return "", ErrInvalidSize
+	}
+
+	path := s.sizedPath(audiobookID, size)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	err = s.proc.Do(ctx, path, func() error {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		f, err := os.Open(original)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return fmt.Errorf("decode cover: %w", err)
+		}
+
+		tmp, err := s.writeTemp(func(w io.Writer) error {
+			return jpeg.Encode(w, thumbnail(img, size), &jpeg.Options{Quality: 85})
+		})
+		if err != nil {
+			return fmt.Errorf("write resized cover: %w", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("write resized cover: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// original returns the stored upload of an audiobook's cover.
+func (s *Store) original(audiobookID string) (string, error) {
+	for _, ext := range extensions {
+		path := s.originalPath(audiobookID, ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func validSize(size int) bool {
+	for _, candidate := range Sizes {
+		if size == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes an audiobook's cover and its resized copies, if any.
+func (s *Store) Delete(audiobookID string) error {
+	var paths []string
+	for _, size := range Sizes {
+		paths = append(paths, s.sizedPath(audiobookID, size))
+	}
+	for _, ext := range extensions {
+		paths = append(paths, s.originalPath(audiobookID, ext))
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove cover: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) originalPath(audiobookID, ext string) string {
+	return filepath.Join(s.dir, filepath.Base(audiobookID)+ext)
+}
+
+// sizedPath is where the copy of a cover resized to size is cached. The
+// default thumbnail keeps its original name.
+func (s *Store) sizedPath(audiobookID string, size int) string {
+	if size == ThumbnailSize {
+		return s.thumbnailPath(audiobookID)
+	}
+	return filepath.Join(s.dir, filepath.Base(audiobookID)+"_"+strconv.Itoa(size)+".jpg")
+}
+
+func (s *Store) thumbnailPath(audiobookID string) string {
+	return filepath.Join(s.dir, filepath.Base(audiobookID)+"_thumb.jpg")
+}
+
+// thumbnail scales img down so its longest edge is at most size, averaging
+// the source pixels covered by each destination pixel. Smaller images are
+// returned unchanged.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := bounds.Min.Y + y*h/th
+		y1 := bounds.Min.Y + (y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0 := bounds.Min.X + x*w/tw
+			x1 := bounds.Min.X + (x+1)*w/tw
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
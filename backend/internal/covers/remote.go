@@ -0,0 +1,118 @@
+package covers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// ErrFetchFailed is returned when a remote cover could not be downloaded.
+var ErrFetchFailed = errors.New("remote cover could not be fetched")
+
+// remoteFetchWorkers bounds the remote covers downloaded at once.
+const remoteFetchWorkers = 4
+
+// RemoteCache keeps copies of remote cover images, such as those on
+// provider CDNs, so clients load covers from the server rather than from
+// third parties. Each image is downloaded once, on first request, and
+// resized like an uploaded cover.
+type RemoteCache struct {
+	store   *Store
+	client  *http.Client
+	fetches *Processor
+}
+
+// NewRemoteCache creates a RemoteCache in dir that downloads with client and
+// resizes on proc.
+func NewRemoteCache(dir string, proc *Processor, client *http.Client) *RemoteCache {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &RemoteCache{
+		store:   NewStore(dir, proc),
+		client:  client,
+		fetches: NewProcessor(remoteFetchWorkers),
+	}
+}
+
+// Path returns the cached copy of the image at url, or a resized JPEG copy
+// when size is one of Sizes, downloading it first if needed. Concurrent
+// requests for the same image share one download.
+func (c *RemoteCache) Path(ctx context.Context, url string, size int) (string, error) {
+	if size != 0 && !validSize(size) {
+		return "", ErrInvalidSize
+	}
+	key := remoteKey(url)
+	if _, err := c.store.original(key); errors.Is(err, ErrNotFound) {
+		err := c.fetches.Do(ctx, key, func() error { return c.fetch(url, key) })
+		if err != nil {
+			return "", err
+		}
+	}
+	return c.store.Path(ctx, key, size)
+}
+
+// fetch downloads the image at url into the cache under key. It runs
+// detached from any request, bounded by the client's timeout.
+func (c *RemoteCache) fetch(url, key string) error {
+	if _, err := c.store.original(key); err == nil {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: status %d", ErrFetchFailed, resp.StatusCode)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	ext, ok := extensions[http.DetectContentType(head[:n])]
+	if !ok {
+		return ErrUnsupportedType
+	}
+
+	if err := os.MkdirAll(c.store.dir, 0o755); err != nil {
+		return fmt.Errorf("create cover cache dir: %w", err)
+	}
+	var written int64
+	tmp, err := c.store.writeTemp(func(w io.Writer) error {
+		if _, err := w.Write(head[:n]); err != nil {
+			return err
+		}
+		written, err = io.Copy(w, io.LimitReader(resp.Body, MaxUploadSize-int64(n)+1))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	if int64(n)+written > MaxUploadSize {
+		os.Remove(tmp)
+		return ErrTooLarge
+	}
+	if err := os.Rename(tmp, c.store.originalPath(key, ext)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write cover: %w", err)
+	}
+	return nil
+}
+
+// remoteKey names the cached copy of the image at url.
+func remoteKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,82 @@
+package covers
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultWorkers is the number of images processed at once when no limit is
+// configured.
+const DefaultWorkers = 2
+
+// Processor runs image work (decoding, resizing) on a bounded number of
+// workers so bursts of cover requests cannot saturate the CPU. Concurrent
+// requests for the same key share a single run.
+type Processor struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// NewProcessor creates a Processor running at most workers jobs at a time.
+func NewProcessor(workers int) *Processor {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Processor{
+		slots:    make(chan struct{}, workers),
+		inflight: make(map[string]*call),
+	}
+}
+
+// Run waits for a free worker slot, or for ctx to end, and runs fn in the
+// calling goroutine.
+func (p *Processor) Run(ctx context.Context, fn func() error) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+	return fn()
+}
+
+// Do runs fn on a worker and waits for it. Callers passing the same key while
+// a run is queued or in progress wait for that run instead of starting
+// another. The work itself is not tied to ctx, so one caller giving up does
+// not fail the others; ctx only bounds how long this caller waits. fn must
+// therefore not depend on state owned by the caller.
+func (p *Processor) Do(ctx context.Context, key string, fn func() error) error {
+	p.mu.Lock()
+	c, ok := p.inflight[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		p.inflight[key] = c
+		go p.run(key, c, fn)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Processor) run(key string, c *call, fn func() error) {
+	p.slots <- struct{}{}
+	c.err = fn()
+	<-p.slots
+
+	p.mu.Lock()
+	delete(p.inflight, key)
+	p.mu.Unlock()
+	close(c.done)
+}
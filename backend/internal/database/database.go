@@ -3,9 +3,17 @@ package database
 import (
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/models"
 )
 
 import _ "github.com/mattn/go-sqlite3"
@@ -13,17 +21,58 @@ import _ "github.com/mattn/go-sqlite3"
 //go:embed schema.sql
 var schemaFS embed.FS
 
+// Options tune the SQLite connection pool.
+type Options struct {
+	// JournalMode is the SQLite journal mode. WAL lets reads carry on
+	// while a write is in progress.
+	JournalMode string
+	// BusyTimeout is how long a statement waits for another connection's
+	// lock before failing with "database is locked".
+	BusyTimeout time.Duration
+	// MaxOpenConns bounds the open connections; zero leaves them
+	// unbounded. MaxIdleConns are kept open between queries.
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+// DefaultOptions returns the options used unless configured otherwise.
+func DefaultOptions() Options {
+	return Options{
+		JournalMode:  "WAL",
+		BusyTimeout:  5 * time.Second,
+		MaxOpenConns: 8,
+		MaxIdleConns: 4,
+	}
+}
+
+// journalModes are the journal modes SQLite accepts.
+var journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
 // Open creates (if needed) and migrates the SQLite database at the provided path.
-func Open(path string) (*sql.DB, error) {
+// Every connection enforces foreign keys, waits opts.BusyTimeout for locks
+// and starts transactions with BEGIN IMMEDIATE, so a transaction that reads
+// before it writes waits for the write lock up front instead of failing
+// when another connection wrote in between.
+func Open(path string, opts Options) (*sql.DB, error) {
+	journalMode := strings.ToUpper(strings.TrimSpace(opts.JournalMode))
+	if journalMode == "" {
+		journalMode = DefaultOptions().JournalMode
+	}
+	if !slices.Contains(journalModes, journalMode) {
+		return nil, fmt.Errorf("unknown SQLite journal mode %q", opts.JournalMode)
+	}
 	if err := ensureDir(path); err != nil {
 		return nil, err
 	}
 
-	dsn := fmt.Sprintf("file:%s?_foreign_keys=on", path)
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=%s&_busy_timeout=%d&_txlock=immediate",
+		path, journalMode, opts.BusyTimeout.Milliseconds())
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
 
 	// Verify foreign keys are enabled
 	var fkEnabled int
@@ -33,6 +82,17 @@ func Open(path string) (*sql.DB, error) {
 	}
 	fmt.Printf("Foreign keys enabled: %d\n", fkEnabled)
 
+	// File systems without shared memory, such as some network shares,
+	// cannot use WAL; SQLite then keeps the previous mode.
+	var actualMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&actualMode); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check journal mode: %w", err)
+	}
+	if !strings.EqualFold(actualMode, journalMode) {
+		log.Printf("database: journal mode %s requested but %s is in use", journalMode, actualMode)
+	}
+
 	if err := applySchema(db); err != nil {
 		db.Close()
 		return nil, err
@@ -63,6 +123,126 @@ func applySchema(db *sql.DB) error {
 	if err := ensureColumn(db, "audiobooks", "library_id", "library_id TEXT NULL"); err != nil {
 		return err
 	}
+	if err := ensureColumn(db, "audiobooks", "scan_fingerprint", "scan_fingerprint TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobooks", "work_id", "work_id TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobooks", "missing_since", "missing_since TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "oidc_issuer", "oidc_issuer TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "oidc_subject", "oidc_subject TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "media_files", "extension_mime_type", "extension_mime_type TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "media_files", "sort_index", "sort_index INTEGER NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "import_settings", "merge_replace_originals", "merge_replace_originals INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "library_paths", "book_count", "book_count INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "library_paths", "file_count", "file_count INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "library_paths", "total_size", "total_size INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "library_paths", "last_scan_duration_ms", "last_scan_duration_ms INTEGER NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "feed_token", "feed_token TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "disabled_at", "disabled_at TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "pending_approval_at", "pending_approval_at TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_custom", "sort_title", "sort_title TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_custom", "sort_title_locked", "sort_title_locked INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_custom", "sort_author", "sort_author TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_custom", "sort_author_locked", "sort_author_locked INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_resolved", "sort_title", "sort_title TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_resolved", "sort_author", "sort_author TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_resolved", "title_sort", "title_sort TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "audiobook_metadata_resolved", "author_sort", "author_sort TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "notification_settings", "storage_warnings", "storage_warnings INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "access_tokens", "library_id", "library_id TEXT NULL REFERENCES libraries(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "user_privacy", "share_activity", "share_activity INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "user_privacy", "share_listening", "share_listening INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "downloads", "last_at", "last_at TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "libraries", "restricted", "restricted INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "invites", "library_ids", "library_ids TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "registration_settings", "library_ids", "library_ids TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_metadata_resolved_title_sort ON audiobook_metadata_resolved(library_id, title_sort)`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc ON users(oidc_issuer, oidc_subject)`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_feed_token ON users(feed_token)`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_audiobooks_work ON audiobooks(work_id)`); err != nil {
+		return err
+	}
+	if err := normalizeCustomMetadataLocks(db); err != nil {
+		return err
+	}
+	if err := backfillMetadataIdentifiers(db); err != nil {
+		return err
+	}
+	if err := migrateLibrarySettings(db); err != nil {
+		return err
+	}
+	if err := backfillSortKeys(db); err != nil {
+		return err
+	}
+	if err := migrateFeedTokens(db); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -81,3 +261,174 @@ func ensureColumn(db *sql.DB, table, column, definition string) error {
 	_, err := db.Exec(alter)
 	return err
 }
+
+// customMetadataFields are the columns of audiobook_metadata_custom that carry
+// a matching *_locked flag.
+var customMetadataFields = []string{
+	"title", "subtitle", "author", "narrator", "description", "cover_url",
+	"series_name", "series_sequence", "release_date", "isbn", "asin",
+	"language", "publisher", "genres", "sort_title", "sort_author",
+}
+
+// normalizeCustomMetadataLocks migrates rows written before lock modes existed:
+// blank locks were stored as empty strings and unlocked fields could keep a
+// stale value. Both are stored as NULL now. The updates are idempotent.
+func normalizeCustomMetadataLocks(db *sql.DB) error {
+	for _, field := range customMetadataFields {
+		stmt := fmt.Sprintf(`
+			UPDATE audiobook_metadata_custom SET %[1]s = NULL
+			WHERE %[1]s IS NOT NULL AND (%[1]s_locked <> 1 OR %[1]s = '')
+		`, field)
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("normalize %s lock: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// backfillMetadataIdentifiers seeds agent_metadata_identifiers from the ASIN
+// and ISBN columns of records created before identifiers were tracked.
+// Existing rows are left alone, so this is safe to run on every start.
+func backfillMetadataIdentifiers(db *sql.DB) error {
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO agent_metadata_identifiers (metadata_id, type, value)
+		SELECT id, 'asin', UPPER(TRIM(asin)) FROM audiobook_metadata_agent
+		WHERE asin IS NOT NULL AND TRIM(asin) <> ''
+	`)
+	if err != nil {
+		return fmt.Errorf("backfill asin identifiers: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT OR IGNORE INTO agent_metadata_identifiers (metadata_id, type, value)
+		SELECT id, 'isbn', UPPER(REPLACE(REPLACE(TRIM(isbn), '-', ''), ' ', '')) FROM audiobook_metadata_agent
+		WHERE isbn IS NOT NULL AND TRIM(isbn) <> ''
+	`)
+	if err != nil {
+		return fmt.Errorf("backfill isbn identifiers: %w", err)
+	}
+	return nil
+}
+
+// migrateFeedTokens moves feed tokens kept on users, from before access
+// tokens existed, into access_tokens as each user's default feed token. The
+// token strings are kept, so feed URLs and signed media URLs in use keep
+// working. Migrated users are cleared, so this only does work once.
+func migrateFeedTokens(db *sql.DB) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.Exec(`
+		INSERT OR IGNORE INTO access_tokens (id, user_id, token, scope, name, is_default, created_at)
+		SELECT 'feed-' || id, id, feed_token, 'feed', 'Feed token', 1, ?
+		FROM users
+		WHERE feed_token IS NOT NULL AND feed_token <> ''
+	`, now); err != nil {
+		return fmt.Errorf("migrate feed tokens: %w", err)
+	}
+	if _, err := db.Exec(`UPDATE users SET feed_token = NULL WHERE feed_token IS NOT NULL`); err != nil {
+		return fmt.Errorf("migrate feed tokens: %w", err)
+	}
+	return nil
+}
+
+// migrateLibrarySettings rewrites each library's settings in the shape of
+// models.LibrarySettings. Settings were a free-form object before they were
+// typed: keys that are not settings, or hold a value of the wrong type, are
+// dropped and logged. Settings already in shape are left alone.
+func migrateLibrarySettings(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, settings FROM libraries WHERE settings IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("migrate library settings: %w", err)
+	}
+	type rewrite struct {
+		id       string
+		settings interface{}
+	}
+	var pending []rewrite
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return fmt.Errorf("migrate library settings: %w", err)
+		}
+		settings, dropped, err := models.DecodeLibrarySettings([]byte(raw))
+		if err != nil {
+			log.Printf("library %s: settings are not a JSON object, resetting them: %s", id, raw)
+		} else if len(dropped) > 0 {
+			log.Printf("library %s: dropping invalid settings %s", id, strings.Join(dropped, ", "))
+		}
+		encoded, err := json.Marshal(settings)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("migrate library settings: %w", err)
+		}
+		if string(encoded) == raw {
+			continue
+		}
+		var value interface{}
+		if string(encoded) != "{}" {
+			value = string(encoded)
+		}
+		pending = append(pending, rewrite{id, value})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("migrate library settings: %w", err)
+	}
+
+	for _, r := range pending {
+		if _, err := db.Exec(`UPDATE libraries SET settings = ? WHERE id = ?`, r.settings, r.id); err != nil {
+			return fmt.Errorf("migrate library settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfillSortKeys fills the sort title, sort author and their sort keys of
+// resolved metadata written before they existed, using each library's
+// collation. Rows that already have them are skipped, so this is cheap on
+// later starts. Custom sort overrides did not exist either, so the sort
+// names are generated from the title and author.
+func backfillSortKeys(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT r.audiobook_id, COALESCE(r.title, ''), COALESCE(r.author, ''), l.settings
+		FROM audiobook_metadata_resolved r
+		LEFT JOIN libraries l ON l.id = r.library_id
+		WHERE r.title_sort IS NULL
+		   OR (r.sort_title IS NULL AND r.title IS NOT NULL)
+		   OR (r.sort_author IS NULL AND r.author IS NOT NULL)
+	`)
+	if err != nil {
+		return fmt.Errorf("backfill sort keys: %w", err)
+	}
+	type sortNames struct{ id, title, author, titleKey, authorKey string }
+	var pending []sortNames
+	for rows.Next() {
+		var id, title, author string
+		var settingsJSON sql.NullString
+		if err := rows.Scan(&id, &title, &author, &settingsJSON); err != nil {
+			rows.Close()
+			return fmt.Errorf("backfill sort keys: %w", err)
+		}
+		var settings models.LibrarySettings
+		if settingsJSON.Valid {
+			settings, _, _ = models.DecodeLibrarySettings([]byte(settingsJSON.String))
+		}
+		collation := metadata.CollationFromSettings(settings)
+		sortTitle, sortAuthor := collation.SortTitle(title), metadata.ContributorFormatFromSettings(settings).SortAuthor(author)
+		pending = append(pending, sortNames{id, sortTitle, sortAuthor, collation.SortKey(sortTitle), collation.SortKey(sortAuthor)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("backfill sort keys: %w", err)
+	}
+
+	for _, names := range pending {
+		if _, err := db.Exec(`
+			UPDATE audiobook_metadata_resolved
+			SET sort_title = NULLIF(?, ''), sort_author = NULLIF(?, ''), title_sort = ?, author_sort = ?
+			WHERE audiobook_id = ?
+		`, names.title, names.author, names.titleKey, names.authorKey, names.id); err != nil {
+			return fmt.Errorf("backfill sort keys: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOpenAppliesOptions(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "lore.db"), DefaultOptions())
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+
+	var mode string
+	var timeout, foreignKeys int
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(mode, "wal") || timeout != 5000 || foreignKeys != 1 {
+		t.Errorf("journal_mode = %s, busy_timeout = %d, foreign_keys = %d; want wal, 5000, 1", mode, timeout, foreignKeys)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 8 {
+		t.Errorf("MaxOpenConnections = %d, want 8", got)
+	}
+}
+
+func TestOpenRejectsUnknownJournalMode(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "lore.db"), Options{JournalMode: "fast"}); err == nil {
+		t.Fatal("Open accepted journal mode \"fast\"")
+	}
+}
+
+// TestConcurrentWrites runs transactions that read before they write, like
+// recording a listening session, alongside plain writes and reads, the mix
+// that used to fail with "database is locked".
+func TestConcurrentWrites(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "lore.db"), DefaultOptions())
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE counters (id INTEGER PRIMARY KEY, value INTEGER NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO counters (id, value) VALUES (1, 0)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, worker INTEGER NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, rounds = 16, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*3)
+	for w := 0; w < workers; w++ {
+		wg.Add(3)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				tx, err := db.Begin()
+				if err != nil {
+					errs <- fmt.Errorf("begin: %w", err)
+					return
+				}
+				var value int
+				if err := tx.QueryRow(`SELECT value FROM counters WHERE id = 1`).Scan(&value); err != nil {
+					tx.Rollback()
+					errs <- fmt.Errorf("read counter: %w", err)
+					return
+				}
+				if _, err := tx.Exec(`UPDATE counters SET value = ? WHERE id = 1`, value+1); err != nil {
+					tx.Rollback()
+					errs <- fmt.Errorf("update counter: %w", err)
+					return
+				}
+				if err := tx.Commit(); err != nil {
+					errs <- fmt.Errorf("commit: %w", err)
+					return
+				}
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if _, err := db.Exec(`INSERT INTO events (worker) VALUES (?)`, w); err != nil {
+					errs <- fmt.Errorf("insert event: %w", err)
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				var n int
+				if err := db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&n); err != nil {
+					errs <- fmt.Errorf("count events: %w", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var value, events int
+	if err := db.QueryRow(`SELECT value FROM counters WHERE id = 1`).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if value != workers*rounds || events != workers*rounds {
+		t.Errorf("counter = %d, events = %d; want %d each", value, events, workers*rounds)
+	}
+}
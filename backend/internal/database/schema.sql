@@ -7,6 +7,7 @@ CREATE TABLE IF NOT EXISTS libraries (
     type TEXT NOT NULL DEFAULT 'audiobook',
     description TEXT NULL,
     settings TEXT NULL,
+    restricted INTEGER NOT NULL DEFAULT 0, -- only admins and library_members see its audiobooks
     created_at TEXT NOT NULL,
     updated_at TEXT NOT NULL
 );
@@ -20,7 +21,12 @@ CREATE TABLE IF NOT EXISTS library_paths (
     name TEXT NOT NULL,
     enabled INTEGER NOT NULL DEFAULT 1,
     created_at TEXT NOT NULL,
-    last_scanned_at TEXT NULL
+    last_scanned_at TEXT NULL,
+    -- Statistics recorded by the most recent scan.
+    book_count INTEGER NOT NULL DEFAULT 0,
+    file_count INTEGER NOT NULL DEFAULT 0,
+    total_size INTEGER NOT NULL DEFAULT 0,
+    last_scan_duration_ms INTEGER NULL
 );
 
 CREATE INDEX IF NOT EXISTS idx_library_paths_enabled ON library_paths(enabled);
@@ -66,12 +72,28 @@ CREATE TABLE IF NOT EXISTS audiobook_metadata_agent (
 CREATE INDEX IF NOT EXISTS idx_agent_metadata_source ON audiobook_metadata_agent(source, external_id);
 CREATE INDEX IF NOT EXISTS idx_agent_metadata_title_author ON audiobook_metadata_agent(title, author);
 
+-- Every ASIN/ISBN known for an agent metadata record. ASINs differ per Audible
+-- region and editions carry their own ISBNs; each identifier maps to one record.
+CREATE TABLE IF NOT EXISTS agent_metadata_identifiers (
+    metadata_id TEXT NOT NULL,
+    type TEXT NOT NULL, -- 'asin' or 'isbn'
+    value TEXT NOT NULL,
+    region TEXT NULL,
+    PRIMARY KEY (type, value),
+    FOREIGN KEY (metadata_id) REFERENCES audiobook_metadata_agent(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_metadata_identifiers_metadata ON agent_metadata_identifiers(metadata_id);
+
 CREATE TABLE IF NOT EXISTS audiobooks (
     id TEXT PRIMARY KEY,
     library_id TEXT NULL,
     library_path_id TEXT NOT NULL,
     metadata_id TEXT NULL,  -- Links to audiobook_metadata_agent (kept for backward compatibility)
     asset_path TEXT NOT NULL,
+    scan_fingerprint TEXT NULL, -- names, sizes and mtimes of the media files at the last scan
+    work_id TEXT NULL, -- shared by audiobooks linked as editions of the same work
+    missing_since TEXT NULL, -- set while the scan cannot find asset_path on disk
     created_at TEXT NOT NULL,
     updated_at TEXT NOT NULL,
     FOREIGN KEY (library_id) REFERENCES libraries(id) ON DELETE CASCADE,
@@ -88,11 +110,27 @@ CREATE TABLE IF NOT EXISTS media_files (
     filename TEXT NOT NULL,
     duration_sec REAL NOT NULL,
     mime_type TEXT NOT NULL,
+    extension_mime_type TEXT NULL, -- set when sniffed content disagrees with the extension
+    sort_index INTEGER NULL, -- track order set by an admin; NULL files follow in natural order
     FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_media_files_audiobook ON media_files(audiobook_id);
 
+-- Companion files found next to the audio: cover art, descriptions, cue
+-- sheets and PDF booklets
+CREATE TABLE IF NOT EXISTS supplement_files (
+    id TEXT PRIMARY KEY,
+    audiobook_id TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size_bytes INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplement_files_audiobook ON supplement_files(audiobook_id);
+
 -- Embedded metadata extracted from file tags (1:1 with audiobook)
 CREATE TABLE IF NOT EXISTS audiobook_metadata_embedded (
     audiobook_id TEXT PRIMARY KEY,
@@ -113,10 +151,33 @@ CREATE TABLE IF NOT EXISTS audiobook_metadata_embedded (
     FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
 );
 
+-- Metadata read from sidecar files in the audiobook folder, such as
+-- metadata.json or book.nfo (1:1 with audiobook); replaced by each scan
+CREATE TABLE IF NOT EXISTS audiobook_metadata_sidecar (
+    audiobook_id TEXT PRIMARY KEY,
+    sources TEXT NOT NULL, -- JSON array of file names
+    title TEXT NULL,
+    subtitle TEXT NULL,
+    author TEXT NULL,
+    narrator TEXT NULL,
+    description TEXT NULL,
+    series_name TEXT NULL,
+    series_sequence TEXT NULL,
+    release_date TEXT NULL,
+    isbn TEXT NULL,
+    asin TEXT NULL,
+    language TEXT NULL,
+    publisher TEXT NULL,
+    genres TEXT NULL, -- JSON array
+    read_at TEXT NOT NULL,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
 -- Custom metadata (1:1 with audiobook) - user manual edits
 -- Each field has a corresponding _locked flag:
 -- locked=1, value="foo" → locked to "foo"
 -- locked=1, value=NULL → locked to empty (overrides cascade)
+-- locked=2 → pinned to agent value (value is NULL)
 -- locked=0 → unlocked (uses cascade: agent → file → parsed)
 CREATE TABLE IF NOT EXISTS audiobook_metadata_custom (
     audiobook_id TEXT PRIMARY KEY,
@@ -148,6 +209,10 @@ CREATE TABLE IF NOT EXISTS audiobook_metadata_custom (
     publisher_locked INTEGER NOT NULL DEFAULT 0,
     genres TEXT NULL,
     genres_locked INTEGER NOT NULL DEFAULT 0,
+    sort_title TEXT NULL,
+    sort_title_locked INTEGER NOT NULL DEFAULT 0,
+    sort_author TEXT NULL,
+    sort_author_locked INTEGER NOT NULL DEFAULT 0,
     updated_at TEXT NOT NULL,
     updated_by TEXT NULL,
     FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE,
@@ -156,12 +221,85 @@ CREATE TABLE IF NOT EXISTS audiobook_metadata_custom (
 
 CREATE INDEX IF NOT EXISTS idx_metadata_custom_user ON audiobook_metadata_custom(updated_by);
 
+-- Resolved metadata snapshot (1:1 with audiobook) - denormalized output of the
+-- custom → agent → sidecar → embedded cascade (below custom, in the library's
+-- metadata order), rebuilt by the resolve-metadata job
+CREATE TABLE IF NOT EXISTS audiobook_metadata_resolved (
+    audiobook_id TEXT PRIMARY KEY,
+    library_id TEXT NULL,
+    title TEXT NULL,
+    subtitle TEXT NULL,
+    author TEXT NULL,
+    narrator TEXT NULL,
+    description TEXT NULL,
+    cover_url TEXT NULL,
+    series_name TEXT NULL,
+    series_sequence TEXT NULL,
+    release_date TEXT NULL,
+    isbn TEXT NULL,
+    asin TEXT NULL,
+    language TEXT NULL,
+    publisher TEXT NULL,
+    duration_sec REAL NULL,
+    genres TEXT NULL,
+    sort_title TEXT NULL,
+    sort_author TEXT NULL,
+    title_sort TEXT NULL,
+    author_sort TEXT NULL,
+    resolved_at TEXT NOT NULL,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_metadata_resolved_library ON audiobook_metadata_resolved(library_id);
+
+-- Search reads audiobook_metadata_resolved directly; drop the unused
+-- full-text index older databases still carry.
+DROP TABLE IF EXISTS audiobook_search;
+
+-- Normalized genre lookup, populated from resolved metadata
+CREATE TABLE IF NOT EXISTS genres (
+    slug TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audiobook_genres (
+    audiobook_id TEXT NOT NULL,
+    genre_slug TEXT NOT NULL,
+    PRIMARY KEY (audiobook_id, genre_slug),
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE,
+    FOREIGN KEY (genre_slug) REFERENCES genres(slug) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audiobook_genres_genre ON audiobook_genres(genre_slug);
+
+-- Individual narrator credits split from resolved metadata
+CREATE TABLE IF NOT EXISTS narrators (
+    slug TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audiobook_narrators (
+    audiobook_id TEXT NOT NULL,
+    narrator_slug TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (audiobook_id, narrator_slug),
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE,
+    FOREIGN KEY (narrator_slug) REFERENCES narrators(slug) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audiobook_narrators_narrator ON audiobook_narrators(narrator_slug);
+
 CREATE TABLE IF NOT EXISTS users (
     id TEXT PRIMARY KEY,
     username TEXT UNIQUE NOT NULL,
     password_hash TEXT NOT NULL,
     is_admin INTEGER NOT NULL DEFAULT 0,
     api_key TEXT UNIQUE NULL,
+    oidc_issuer TEXT NULL,
+    oidc_subject TEXT NULL,
+    feed_token TEXT NULL, -- legacy; moved to access_tokens on start
+    disabled_at TEXT NULL, -- set while the account is deactivated
+    pending_approval_at TEXT NULL, -- set while a self-registration awaits an admin
     created_at TEXT NOT NULL
 );
 
@@ -181,6 +319,330 @@ CREATE TABLE IF NOT EXISTS user_audiobook_data (
 CREATE INDEX IF NOT EXISTS idx_user_audiobook_data_user ON user_audiobook_data(user_id);
 CREATE INDEX IF NOT EXISTS idx_user_audiobook_data_audiobook ON user_audiobook_data(audiobook_id);
 
+-- Listening sessions, opened and extended by progress updates. A session
+-- idle for longer than the session timeout is closed at its last activity
+-- and its listened time added to user_listening_stats.
+CREATE TABLE IF NOT EXISTS listening_sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    audiobook_id TEXT NOT NULL,
+    started_at TEXT NOT NULL,
+    last_active_at TEXT NOT NULL,
+    start_position_sec REAL NOT NULL DEFAULT 0,
+    position_sec REAL NOT NULL DEFAULT 0,
+    listened_sec REAL NOT NULL DEFAULT 0,
+    closed_at TEXT NULL,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_listening_sessions_user ON listening_sessions(user_id, audiobook_id, closed_at);
+CREATE INDEX IF NOT EXISTS idx_listening_sessions_open ON listening_sessions(closed_at, last_active_at);
+
+-- Listening time per user and UTC day, from closed sessions
+CREATE TABLE IF NOT EXISTS user_listening_stats (
+    user_id TEXT NOT NULL,
+    day TEXT NOT NULL,
+    listened_sec REAL NOT NULL DEFAULT 0,
+    sessions INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
+
+-- Star ratings (0.5 to 5 in half steps) and optional text reviews. A rating
+-- of one edition is kept on every edition of its work.
+CREATE TABLE IF NOT EXISTS user_reviews (
+    user_id TEXT NOT NULL,
+    audiobook_id TEXT NOT NULL,
+    rating REAL NOT NULL,
+    review TEXT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (user_id, audiobook_id),
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_reviews_audiobook ON user_reviews(audiobook_id);
+
+-- Listening goals per user. A NULL target leaves that goal unset.
+CREATE TABLE IF NOT EXISTS user_goals (
+    user_id TEXT PRIMARY KEY,
+    weekly_hours REAL NULL,
+    yearly_books INTEGER NULL,
+    updated_at TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Bookmarks at a position in an audiobook, with a short note.
+CREATE TABLE IF NOT EXISTS user_bookmarks (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    audiobook_id TEXT NOT NULL,
+    position_sec REAL NOT NULL,
+    title TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_bookmarks_user ON user_bookmarks(user_id, audiobook_id);
+
+-- How long listening history and activity are kept, in days (0 keeps them).
+-- Until an admin saves it, the *_RETENTION_DAYS settings apply.
+CREATE TABLE IF NOT EXISTS retention_settings (
+    id TEXT PRIMARY KEY DEFAULT 'default',
+    session_days INTEGER NOT NULL DEFAULT 0,
+    stats_days INTEGER NOT NULL DEFAULT 0,
+    activity_days INTEGER NOT NULL DEFAULT 0,
+    updated_at TEXT NOT NULL
+);
+
+-- Per-user privacy choices. Users without a row keep their history and
+-- share neither their activity nor what they listen to.
+CREATE TABLE IF NOT EXISTS user_privacy (
+    user_id TEXT PRIMARY KEY,
+    keep_listening_history INTEGER NOT NULL DEFAULT 1,
+    share_activity INTEGER NOT NULL DEFAULT 0,
+    share_listening INTEGER NOT NULL DEFAULT 0,
+    updated_at TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Users' requests to have their account erased. Approved requests outlive
+-- the account as a record of the erasure; user_id then matches no user.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    reason TEXT NULL,
+    status TEXT NOT NULL, -- pending, approved or rejected
+    requested_at TEXT NOT NULL,
+    decided_at TEXT NULL,
+    decided_by TEXT NULL,
+    note TEXT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_erasure_requests_pending ON erasure_requests(user_id) WHERE status = 'pending';
+
+-- Self-registration policy. Until an admin saves it, ALLOW_REGISTRATION
+-- decides whether sign-ups without an invite are accepted.
+CREATE TABLE IF NOT EXISTS registration_settings (
+    id TEXT PRIMARY KEY DEFAULT 'default',
+    open INTEGER NOT NULL DEFAULT 0,
+    require_approval INTEGER NOT NULL DEFAULT 0,
+    default_role TEXT NOT NULL DEFAULT 'user',
+    library_ids TEXT NOT NULL DEFAULT '[]', -- JSON array of libraries every new account joins
+    updated_at TEXT NOT NULL
+);
+
+-- Scoped tokens for URLs that cannot carry the API key: feeds, share links
+-- and stream URLs. A user's default feed token (is_default) also keys the
+-- signed media URLs issued for them.
+CREATE TABLE IF NOT EXISTS access_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token TEXT UNIQUE NOT NULL,
+    scope TEXT NOT NULL, -- feed, share or stream
+    audiobook_id TEXT NULL, -- limits the token to one audiobook
+    library_id TEXT NULL, -- the library a catalog token opens
+    name TEXT NOT NULL DEFAULT '',
+    is_default INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NULL,
+    last_used_at TEXT NULL,
+    revoked_at TEXT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE,
+    FOREIGN KEY (library_id) REFERENCES libraries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens(user_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_tokens_default ON access_tokens(user_id) WHERE is_default = 1 AND revoked_at IS NULL;
+
+-- Audit trail of access tokens: issued, revoked, and uses refused because
+-- the token was revoked, expired or used outside its scope.
+CREATE TABLE IF NOT EXISTS access_token_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    actor_id TEXT NULL, -- who issued or revoked the token
+    event TEXT NOT NULL,
+    detail TEXT NULL,
+    ip TEXT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_token_events_token ON access_token_events(token_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_access_token_events_user ON access_token_events(user_id, created_at);
+
+-- Invitations redeemable once to create an account. library_ids is a JSON
+-- array of libraries the new user becomes a member of.
+CREATE TABLE IF NOT EXISTS invites (
+    id TEXT PRIMARY KEY,
+    token TEXT UNIQUE NOT NULL,
+    library_ids TEXT NOT NULL DEFAULT '[]',
+    created_by TEXT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    used_by TEXT NULL,
+    used_at TEXT NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (used_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Placeholders for uploaded covers, rendered by clients while the image loads.
+CREATE TABLE IF NOT EXISTS audiobook_covers (
+    audiobook_id TEXT PRIMARY KEY,
+    blurhash TEXT NOT NULL,
+    color TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+-- Per-user notification channels and event preferences. Users without a row
+-- get every event but have no channel to receive them on.
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id TEXT PRIMARY KEY,
+    email TEXT NULL,
+    webhook_url TEXT NULL,
+    import_completed INTEGER NOT NULL DEFAULT 1,
+    import_failed INTEGER NOT NULL DEFAULT 1,
+    scan_missing_files INTEGER NOT NULL DEFAULT 1,
+    storage_warnings INTEGER NOT NULL DEFAULT 1,
+    updated_at TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Admin-defined fields for audiobooks, e.g. "Purchase date" or "Physical
+-- shelf". type is text, number, date or boolean; values are stored as text
+-- in a normalized form (dates as YYYY-MM-DD, booleans as true/false).
+CREATE TABLE IF NOT EXISTS custom_fields (
+    key TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audiobook_custom_fields (
+    audiobook_id TEXT NOT NULL,
+    field_key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (audiobook_id, field_key),
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE,
+    FOREIGN KEY (field_key) REFERENCES custom_fields(key) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audiobook_custom_fields_value ON audiobook_custom_fields(field_key, value);
+
+-- Outgoing webhooks for library events. events is a JSON array of event
+-- types; last_error is cleared by the next successful delivery.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    last_delivery_at TEXT NULL,
+    last_error TEXT NULL
+);
+
+-- External metadata agents speaking the generic JSON contract, registered
+-- as providers under their name; api_key is empty when none is sent.
+CREATE TABLE IF NOT EXISTS metadata_agents (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    api_key TEXT NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+-- Per-audiobook access overrides. An audiobook with no rows is visible to
+-- everyone; otherwise only matching users/roles (and admins) can see it.
+CREATE TABLE IF NOT EXISTS audiobook_access (
+    audiobook_id TEXT NOT NULL,
+    principal_type TEXT NOT NULL, -- 'user' or 'role'
+    principal_id TEXT NOT NULL,   -- user ID or role name ('admin', 'user')
+    created_at TEXT NOT NULL,
+    PRIMARY KEY (audiobook_id, principal_type, principal_id),
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audiobook_access_principal ON audiobook_access(principal_type, principal_id);
+
+-- Users who may see the audiobooks of a restricted library
+CREATE TABLE IF NOT EXISTS library_members (
+    library_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    PRIMARY KEY (library_id, user_id),
+    FOREIGN KEY (library_id) REFERENCES libraries(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_library_members_user ON library_members(user_id);
+
+-- Download audit trail (one row per media/zip download response)
+CREATE TABLE IF NOT EXISTS downloads (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NULL,
+    username TEXT NOT NULL,
+    audiobook_id TEXT NULL,
+    media_file_id TEXT NULL,
+    kind TEXT NOT NULL,           -- 'media', 'zip', 'supplement' or 'stream'
+    bytes INTEGER NOT NULL DEFAULT 0,
+    status_code INTEGER NOT NULL,
+    remote_addr TEXT NULL,
+    user_agent TEXT NULL,
+    created_at TEXT NOT NULL,
+    last_at TEXT NULL,            -- last range request merged into the entry
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE SET NULL,
+    FOREIGN KEY (media_file_id) REFERENCES media_files(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_downloads_user ON downloads(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_downloads_created ON downloads(created_at);
+
+-- Per-library activity feed: books added, books finished and metadata
+-- updates. user_id is set for what a user did, such as finishing a book.
+CREATE TABLE IF NOT EXISTS activity (
+    id TEXT PRIMARY KEY,
+    library_id TEXT NOT NULL,
+    audiobook_id TEXT NOT NULL,
+    user_id TEXT NULL,
+    type TEXT NOT NULL,           -- 'book.added', 'book.finished' or 'metadata.updated'
+    created_at TEXT NOT NULL,
+    FOREIGN KEY (library_id) REFERENCES libraries(id) ON DELETE CASCADE,
+    FOREIGN KEY (audiobook_id) REFERENCES audiobooks(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_library ON activity(library_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_activity_audiobook ON activity(audiobook_id);
+CREATE INDEX IF NOT EXISTS idx_activity_user ON activity(user_id);
+CREATE INDEX IF NOT EXISTS idx_activity_created ON activity(created_at);
+
+CREATE TABLE IF NOT EXISTS client_logs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NULL,
+    username TEXT NOT NULL,
+    level TEXT NOT NULL,          -- 'error', 'warning' or 'info'
+    message TEXT NOT NULL,
+    client TEXT NOT NULL,
+    client_version TEXT NOT NULL,
+    device TEXT NULL,
+    os TEXT NULL,
+    audiobook_id TEXT NULL,       -- not a foreign key: reports outlive books
+    stack TEXT NULL,
+    context TEXT NULL,            -- JSON object
+    user_agent TEXT NULL,
+    created_at TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_logs_created ON client_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_client_logs_user ON client_logs(user_id, created_at);
+
 -- Removed user_library_access table - all users have access to all libraries
 
 CREATE TABLE IF NOT EXISTS import_folders (
@@ -197,9 +659,23 @@ CREATE TABLE IF NOT EXISTS import_settings (
     id TEXT PRIMARY KEY DEFAULT 'default',
     destination_path TEXT NOT NULL,
     template TEXT NOT NULL DEFAULT '{author}/{title}',
+    merge_replace_originals INTEGER NOT NULL DEFAULT 0,
     updated_at TEXT NOT NULL
 );
 
+-- Finished import jobs; source_paths, imported and errors are JSON arrays
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    source_paths TEXT NOT NULL DEFAULT '[]',
+    imported TEXT NOT NULL DEFAULT '[]',
+    errors TEXT NOT NULL DEFAULT '[]',
+    started_at TEXT NOT NULL,
+    completed_at TEXT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_started ON import_jobs(started_at);
+
 -- Insert default settings if none exist
 INSERT OR IGNORE INTO import_settings (id, destination_path, template, updated_at)
 VALUES ('default', 'data/library', '{author}/{title}', strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
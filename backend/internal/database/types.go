@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"strings"
 )
 
 // SQLDB interface for both *sql.DB and *sql.Tx
@@ -14,4 +15,8 @@ type SQLDB interface {
 
 // Ensure *sql.DB and *sql.Tx implement SQLDB
 var _ SQLDB = (*sql.DB)(nil)
-var _ SQLDB = (*sql.Tx)(nil)
\ No newline at end of file
+var _ SQLDB = (*sql.Tx)(nil)
+
+// LikeEscaper escapes the LIKE wildcards in a literal, for patterns matched
+// with ESCAPE '\'.
+var LikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
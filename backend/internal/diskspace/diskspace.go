@@ -0,0 +1,26 @@
+// Package diskspace reports how much room is left on the file system
+// holding a path.
+package diskspace
+
+import "errors"
+
+// ErrUnsupported is returned by Stat where free space cannot be read.
+var ErrUnsupported = errors.New("disk space is not available on this platform")
+
+// Usage describes the file system holding a path.
+type Usage struct {
+	// Device identifies the file system, so paths on the same one can be
+	// reported together.
+	Device     uint64
+	TotalBytes uint64
+	// FreeBytes is the space available to unprivileged users.
+	FreeBytes uint64
+}
+
+// FreePercent returns the free space as a percentage of the total.
+func (u Usage) FreePercent() float64 {
+	if u.TotalBytes == 0 {
+		return 0
+	}
+	return float64(u.FreeBytes) / float64(u.TotalBytes) * 100
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package diskspace
+
+// Supported reports whether Stat works on this platform.
+const Supported = false
+
+// Stat returns ErrUnsupported.
+func Stat(path string) (Usage, error) {
+	return Usage{}, ErrUnsupported
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin
+
+package diskspace
+
+import (
+	"os"
+	"syscall"
+)
+
+// Supported reports whether Stat works on this platform.
+const Supported = true
+
+// Stat returns the usage of the file system holding path.
+func Stat(path string) (Usage, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Usage{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage := Usage{
+		TotalBytes: uint64(fs.Blocks) * uint64(fs.Bsize),
+		FreeBytes:  uint64(fs.Bavail) * uint64(fs.Bsize),
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		usage.Device = uint64(st.Dev)
+	}
+	return usage, nil
+}
@@ -0,0 +1,145 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// UPnP classes of listed objects. Books are listed as albums and their
+// files as tracks, which renderers show and queue best.
+const (
+	ClassFolder = "object.container.storageFolder"
+	ClassAlbum  = "object.container.album.musicAlbum"
+	ClassTrack  = "object.item.audioItem.musicTrack"
+)
+
+// Object is a container or item in a DIDL-Lite listing.
+type Object struct {
+	ID       string
+	ParentID string
+	Title    string
+	Class    string
+	Creator  string
+	Album    string
+	// TrackNumber orders tracks within an album; zero leaves it out.
+	TrackNumber int
+	// AlbumArtURI links to a cover image.
+	AlbumArtURI string
+	// ChildCount is the number of children of a container.
+	ChildCount int
+	// Resource is how an item is played; containers have none.
+	Resource *Resource
+}
+
+// Resource is a stream URL of an item.
+type Resource struct {
+	URL         string
+	MimeType    string
+	Size        int64
+	DurationSec float64
+}
+
+// IsContainer reports whether the object is a container rather than an
+// item.
+func (o Object) IsContainer() bool {
+	return o.Resource == nil
+}
+
+type didlLite struct {
+	XMLName    xml.Name        `xml:"DIDL-Lite"`
+	Xmlns      string          `xml:"xmlns,attr"`
+	DC         string          `xml:"xmlns:dc,attr"`
+	UPnP       string          `xml:"xmlns:upnp,attr"`
+	DLNA       string          `xml:"xmlns:dlna,attr"`
+	Containers []didlContainer `xml:"container"`
+	Items      []didlItem      `xml:"item"`
+}
+
+type didlContainer struct {
+	ID          string    `xml:"id,attr"`
+	ParentID    string    `xml:"parentID,attr"`
+	Restricted  int       `xml:"restricted,attr"`
+	Searchable  int       `xml:"searchable,attr"`
+	ChildCount  int       `xml:"childCount,attr"`
+	Title       string    `xml:"dc:title"`
+	Creator     string    `xml:"dc:creator,omitempty"`
+	Artist      string    `xml:"upnp:artist,omitempty"`
+	AlbumArtURI *albumArt `xml:"upnp:albumArtURI,omitempty"`
+	Class       string    `xml:"upnp:class"`
+}
+
+type didlItem struct {
+	ID          string    `xml:"id,attr"`
+	ParentID    string    `xml:"parentID,attr"`
+	Restricted  int       `xml:"restricted,attr"`
+	Title       string    `xml:"dc:title"`
+	Creator     string    `xml:"dc:creator,omitempty"`
+	Artist      string    `xml:"upnp:artist,omitempty"`
+	Album       string    `xml:"upnp:album,omitempty"`
+	TrackNumber int       `xml:"upnp:originalTrackNumber,omitempty"`
+	AlbumArtURI *albumArt `xml:"upnp:albumArtURI,omitempty"`
+	Class       string    `xml:"upnp:class"`
+	Res         didlRes   `xml:"res"`
+}
+
+type albumArt struct {
+	ProfileID string `xml:"dlna:profileID,attr"`
+	URI       string `xml:",chardata"`
+}
+
+type didlRes struct {
+	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Size         int64  `xml:"size,attr,omitempty"`
+	Duration     string `xml:"duration,attr,omitempty"`
+	URL          string `xml:",chardata"`
+}
+
+// DIDL renders objects as a DIDL-Lite document, the Result of a Browse.
+func DIDL(objects []Object) (string, error) {
+	doc := didlLite{
+		Xmlns: "urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/",
+		DC:    "http://purl.org/dc/elements/1.1/",
+		UPnP:  "urn:schemas-upnp-org:metadata-1-0/upnp/",
+		DLNA:  "urn:schemas-dlna-org:metadata-1-0/",
+	}
+	for _, o := range objects {
+		var art *albumArt
+		if o.AlbumArtURI != "" {
+			art = &albumArt{ProfileID: "JPEG_TN", URI: o.AlbumArtURI}
+		}
+		if o.IsContainer() {
+			doc.Containers = append(doc.Containers, didlContainer{
+				ID: o.ID, ParentID: o.ParentID, Restricted: 1, ChildCount: o.ChildCount,
+				Title: o.Title, Creator: o.Creator, Artist: o.Creator, AlbumArtURI: art, Class: o.Class,
+			})
+			continue
+		}
+		item := didlItem{
+			ID: o.ID, ParentID: o.ParentID, Restricted: 1,
+			Title: o.Title, Creator: o.Creator, Artist: o.Creator, Album: o.Album,
+			TrackNumber: o.TrackNumber, AlbumArtURI: art, Class: o.Class,
+			Res: didlRes{
+				// OP=01 tells renderers they can seek with byte ranges.
+				ProtocolInfo: "http-get:*:" + o.Resource.MimeType + ":DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01700000000000000000000000000000",
+				Size:         o.Resource.Size,
+				URL:          o.Resource.URL,
+			},
+		}
+		if o.Resource.DurationSec > 0 {
+			item.Res.Duration = formatDuration(o.Resource.DurationSec)
+		}
+		doc.Items = append(doc.Items, item)
+	}
+
+	out, err := xml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// formatDuration renders seconds as H:MM:SS.mmm.
+func formatDuration(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,89 @@
+package dlna
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// UPnP error codes returned in SOAP faults.
+const (
+	ErrInvalidAction = 401
+	ErrInvalidArgs   = 402
+	ErrActionFailed  = 501
+	ErrNoSuchObject  = 701
+)
+
+// Action is a SOAP action call: its name and input arguments.
+type Action struct {
+	Name string
+	Args map[string]string
+}
+
+// Arg is an output argument of an action response, in order.
+type Arg struct {
+	Name  string
+	Value string
+}
+
+type soapEnvelope struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// ReadAction parses the SOAP action in a control request body.
+func ReadAction(r io.Reader) (*Action, error) {
+	var env soapEnvelope
+	if err := xml.NewDecoder(io.LimitReader(r, 1<<20)).Decode(&env); err != nil {
+		return nil, err
+	}
+	if env.Body.Action.XMLName.Local == "" {
+		return nil, fmt.Errorf("soap body has no action")
+	}
+	action := &Action{Name: env.Body.Action.XMLName.Local, Args: make(map[string]string)}
+	for _, arg := range env.Body.Action.Args {
+		action.Args[arg.XMLName.Local] = arg.Value
+	}
+	return action, nil
+}
+
+// WriteResponse writes the response to action of serviceType with args.
+func WriteResponse(w http.ResponseWriter, serviceType, action string, args []Arg) {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `<u:%sResponse xmlns:u="%s">`, action, serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg.Name)
+		xml.EscapeText(&body, []byte(arg.Value))
+		fmt.Fprintf(&body, "</%s>", arg.Name)
+	}
+	fmt.Fprintf(&body, `</u:%sResponse>`, action)
+	writeEnvelope(w, http.StatusOK, body.Bytes())
+}
+
+// WriteFault writes a UPnP error as a SOAP fault.
+func WriteFault(w http.ResponseWriter, code int, description string) {
+	var desc bytes.Buffer
+	xml.EscapeText(&desc, []byte(description))
+	body := fmt.Sprintf(`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+		`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError>`+
+		`</detail></s:Fault>`, code, desc.String())
+	writeEnvelope(w, http.StatusInternalServerError, []byte(body))
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("Ext", "")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header+`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	w.Write(body)
+	io.WriteString(w, `</s:Body></s:Envelope>`)
+}
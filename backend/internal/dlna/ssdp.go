@@ -0,0 +1,164 @@
+// Package dlna implements the UPnP pieces of a DLNA MediaServer: SSDP
+// discovery, the device and service descriptions, SOAP actions and
+// DIDL-Lite listings. What the server lists is up to the caller.
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Device and service types advertised by the media server.
+const (
+	DeviceType            = "urn:schemas-upnp-org:device:MediaServer:1"
+	ContentDirectoryType  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	ConnectionManagerType = "urn:schemas-upnp-org:service:ConnectionManager:1"
+)
+
+const (
+	ssdpAddr = "239.255.255.250:1900"
+	// maxAge is how long, in seconds, control points may cache an
+	// announcement. Announcements are repeated well within it.
+	maxAge         = 1800
+	notifyInterval = 10 * time.Minute
+	serverHeader   = "Lore/1.0 UPnP/1.0 DLNADOC/1.50"
+)
+
+// Announcer advertises a media server on the local network over SSDP and
+// answers control points searching for one.
+type Announcer struct {
+	uuid     string
+	location func(local net.IP) string
+}
+
+// NewAnnouncer returns an announcer for the device with the given UUID.
+// location returns the URL of the device description as reachable through
+// the local address a message is sent from.
+func NewAnnouncer(uuid string, location func(local net.IP) string) *Announcer {
+	return &Announcer{uuid: uuid, location: location}
+}
+
+// Run announces the device, answers searches until ctx ends and then says
+// goodbye. It returns an error if the SSDP port cannot be joined.
+func (a *Announcer) Run(ctx context.Context) error {
+	group, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("join ssdp group: %w", err)
+	}
+
+	go a.serveSearches(conn)
+
+	a.notify(group, "ssdp:alive")
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.notify(group, "ssdp:byebye")
+			return conn.Close()
+		case <-ticker.C:
+			a.notify(group, "ssdp:alive")
+		}
+	}
+}
+
+// targets returns the notification types the device answers to.
+func (a *Announcer) targets() []string {
+	return []string{"upnp:rootdevice", "uuid:" + a.uuid, DeviceType, ContentDirectoryType, ConnectionManagerType}
+}
+
+func (a *Announcer) usn(target string) string {
+	if target == "uuid:"+a.uuid {
+		return target
+	}
+	return "uuid:" + a.uuid + "::" + target
+}
+
+func (a *Announcer) notify(group *net.UDPAddr, nts string) {
+	conn, err := net.DialUDP("udp4", nil, group)
+	if err != nil {
+		log.Printf("dlna: ssdp notify: %v", err)
+		return
+	}
+	defer conn.Close()
+	location := a.location(conn.LocalAddr().(*net.UDPAddr).IP)
+
+	for _, target := range a.targets() {
+		msg := "NOTIFY * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddr + "\r\n" +
+			fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", maxAge) +
+			"LOCATION: " + location + "\r\n" +
+			"NT: " + target + "\r\n" +
+			"NTS: " + nts + "\r\n" +
+			"SERVER: " + serverHeader + "\r\n" +
+			"USN: " + a.usn(target) + "\r\n\r\n"
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			log.Printf("dlna: ssdp notify: %v", err)
+			return
+		}
+	}
+}
+
+func (a *Announcer) serveSearches(conn *net.UDPConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, sender, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("Man") != `"ssdp:discover"` {
+			continue
+		}
+		a.answer(conn, sender, req.Header.Get("St"))
+	}
+}
+
+// answer replies to a search for target from sender with one response per
+// matching notification type.
+func (a *Announcer) answer(conn *net.UDPConn, sender *net.UDPAddr, target string) {
+	var matches []string
+	for _, t := range a.targets() {
+		if target == "ssdp:all" || strings.EqualFold(target, t) {
+			matches = append(matches, t)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	// The address the sender reaches us on is the one routed towards it.
+	probe, err := net.DialUDP("udp4", nil, sender)
+	if err != nil {
+		return
+	}
+	local := probe.LocalAddr().(*net.UDPAddr).IP
+	probe.Close()
+	location := a.location(local)
+
+	for _, t := range matches {
+		msg := "HTTP/1.1 200 OK\r\n" +
+			fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", maxAge) +
+			"DATE: " + time.Now().UTC().Format(http.TimeFormat) + "\r\n" +
+			"EXT:\r\n" +
+			"LOCATION: " + location + "\r\n" +
+			"SERVER: " + serverHeader + "\r\n" +
+			"ST: " + t + "\r\n" +
+			"USN: " + a.usn(t) + "\r\n\r\n"
+		if _, err := conn.WriteToUDP([]byte(msg), sender); err != nil {
+			log.Printf("dlna: ssdp search response: %v", err)
+			return
+		}
+	}
+}
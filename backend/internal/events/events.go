@@ -0,0 +1,57 @@
+// Package events is an in-process bus that lets one part of the server react
+// to changes made by another, such as caches dropping stale entries.
+package events
+
+import "sync"
+
+// Event types.
+const (
+	// CatalogChanged means audiobooks in LibraryID were added, removed or
+	// edited. An empty LibraryID means any library may have changed.
+	CatalogChanged = "catalog.changed"
+	// UserDataChanged means UserID's progress, favourites or access grants
+	// changed.
+	UserDataChanged = "user_data.changed"
+	// AccessChanged means the rules deciding who sees which audiobooks
+	// changed.
+	AccessChanged = "access.changed"
+)
+
+// Event describes a change.
+type Event struct {
+	Type      string
+	LibraryID string
+	UserID    string
+}
+
+// Bus delivers events to subscribers. A nil Bus drops events, so callers can
+// publish unconditionally.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []func(Event)
+}
+
+// NewBus creates an empty Bus.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handler for every event published from now on.
+func (b *Bus) Subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish calls every handler synchronously, so subscribers have seen the
+// change by the time Publish returns. Handlers must not block.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// breaker tracks the health of one host. After threshold consecutive
+// failures it opens and rejects requests for cooldown; then a single trial
+// request is let through, which closes it again on success.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openUntil time.Time
+	trial     bool // a half-open trial request is in flight
+	now       func() time.Time
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Before(b.openUntil) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		b.state = BreakerClosed
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+func (b *breaker) snapshot() (string, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		return b.state, b.openUntil
+	}
+	return b.state, time.Time{}
+}
+
+// breakerSet holds the breakers of one client name, keyed by host.
+type breakerSet struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func (s *breakerSet) get(host string, threshold int, cooldown time.Duration) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[host]
+	if !ok {
+		b = &breaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed, now: time.Now}
+		s.breakers[host] = b
+	}
+	return b
+}
+
+var (
+	breakerSetsMu sync.Mutex
+	breakerSets   = make(map[string]*breakerSet)
+)
+
+func breakersFor(name string) *breakerSet {
+	breakerSetsMu.Lock()
+	defer breakerSetsMu.Unlock()
+	s, ok := breakerSets[name]
+	if !ok {
+		s = &breakerSet{breakers: make(map[string]*breaker)}
+		breakerSets[name] = s
+	}
+	return s
+}
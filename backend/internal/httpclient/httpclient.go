@@ -0,0 +1,250 @@
+// Package httpclient builds the HTTP clients used for outbound requests.
+//
+// Every client shares the same policy: idempotent requests are retried on
+// transport errors, 429 and 5xx responses with jittered exponential backoff
+// (honouring Retry-After), each remote host gets a circuit breaker that fails
+// fast while the host is down, and request outcomes are counted per client
+// and host for the admin metrics endpoint.
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for Options fields left zero.
+const (
+	DefaultTimeout          = 30 * time.Second
+	DefaultMaxAttempts      = 3
+	DefaultBaseDelay        = 500 * time.Millisecond
+	DefaultMaxDelay         = 10 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting a host whose breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// OpenError is the ErrCircuitOpen returned for a request to Host, whose
+// breaker lets a trial request through again at Until.
+type OpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Host, ErrCircuitOpen)
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Options configures a client.
+type Options struct {
+	// Name labels the client in metrics, e.g. "audible" or "oidc".
+	Name    string
+	Timeout time.Duration
+	// MaxAttempts bounds tries per request, including the first. 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay bounds a single wait. When a host asks for longer via
+	// Retry-After, the response is returned instead so callers never stall.
+	MaxDelay time.Duration
+	// BreakerThreshold is the number of consecutive failures that opens a
+	// host's breaker; BreakerCooldown is how long it stays open.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Name == "" {
+		o.Name = "default"
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = DefaultBaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultMaxDelay
+	}
+	if o.BreakerThreshold <= 0 {
+		o.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if o.BreakerCooldown <= 0 {
+		o.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return o
+}
+
+// New creates a client that applies the retry, breaker and metrics policy.
+// Breakers and metrics are shared by every client created with the same name.
+func New(opts Options) *http.Client {
+	opts = opts.withDefaults()
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &transport{
+			base:     http.DefaultTransport,
+			opts:     opts,
+			breakers: breakersFor(opts.Name),
+			sleep:    sleepContext,
+		},
+	}
+}
+
+type transport struct {
+	base     http.RoundTripper
+	opts     Options
+	breakers *breakerSet
+	sleep    func(req *http.Request, d time.Duration) error
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	counter := statsFor(t.opts.Name, host)
+	breaker := t.breakers.get(host, t.opts.BreakerThreshold, t.opts.BreakerCooldown)
+
+	attempts := 1
+	if retryable(req) {
+		attempts = t.opts.MaxAttempts
+	}
+
+	delay := t.opts.BaseDelay
+	for attempt := 1; ; attempt++ {
+		if !breaker.allow() {
+			counter.add(func(s *HostStats) { s.Rejected++ })
+			_, until := breaker.snapshot()
+			return nil, &OpenError{Host: host, Until: until}
+		}
+
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		start := time.Now()
+		resp, err := t.base.RoundTrip(req)
+		elapsed := time.Since(start)
+
+		failed := err != nil || serverError(resp.StatusCode)
+		breaker.record(!failed)
+		counter.add(func(s *HostStats) {
+			s.Requests++
+			s.TotalLatency += elapsed
+			finished := start.Add(elapsed).UTC()
+			if failed {
+				s.Failures++
+				s.LastFailure = &finished
+				if err != nil {
+					s.LastError = err.Error()
+				} else {
+					s.LastError = resp.Status
+				}
+			} else {
+				s.LastSuccess = &finished
+			}
+			if attempt > 1 {
+				s.Retries++
+			}
+		})
+
+		if attempt >= attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+		if err == nil && !serverError(resp.StatusCode) && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+
+		wait := jitter(delay)
+		if resp != nil {
+			if hint := ParseRetryAfter(resp.Header.Get("Retry-After")); hint > 0 {
+				wait = hint
+			}
+		}
+		if wait > t.opts.MaxDelay {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		if serr := t.sleep(req, wait); serr != nil {
+			if err == nil {
+				err = serr
+			}
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether req may safely be sent again: idempotent methods
+// whose body, if any, can be replayed.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// serverError reports statuses that count against a host's health.
+func serverError(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout
+}
+
+// jitter spreads d over [d/2, d) so clients retrying together do not
+// hit the host in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// ParseRetryAfter reads a Retry-After header value, which is either
+// delay-seconds or an HTTP date. It returns zero when absent or in the past.
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func sleepContext(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package httpclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HostStats counts the outbound requests one client made to one host.
+type HostStats struct {
+	Client string `json:"client"`
+	Host   string `json:"host"`
+	// Requests counts attempts sent, including retries.
+	Requests int64 `json:"requests"`
+	Retries  int64 `json:"retries"`
+	// Failures counts transport errors and 5xx responses.
+	Failures int64 `json:"failures"`
+	// Rejected counts requests refused by an open circuit breaker.
+	Rejected     int64         `json:"rejected"`
+	TotalLatency time.Duration `json:"-"`
+	AvgLatencyMs float64       `json:"avg_latency_ms"`
+	Breaker      string        `json:"breaker"`
+	OpenUntil    *time.Time    `json:"open_until,omitempty"`
+	// LastSuccess and LastFailure are when the latest attempts finished;
+	// LastError describes the latest failure.
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+type hostCounter struct {
+	mu    sync.Mutex
+	stats HostStats
+}
+
+func (c *hostCounter) add(fn func(*HostStats)) {
+	c.mu.Lock()
+	fn(&c.stats)
+	c.mu.Unlock()
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = make(map[[2]string]*hostCounter)
+)
+
+func statsFor(client, host string) *hostCounter {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	key := [2]string{client, host}
+	c, ok := stats[key]
+	if !ok {
+		c = &hostCounter{stats: HostStats{Client: client, Host: host}}
+		stats[key] = c
+	}
+	return c
+}
+
+// Stats returns the counters of every client and host seen so far, with
+// their current breaker state.
+func Stats() []HostStats {
+	return statsWhere(func(string) bool { return true })
+}
+
+// ClientStats returns the counters of the hosts client has contacted.
+func ClientStats(client string) []HostStats {
+	return statsWhere(func(name string) bool { return name == client })
+}
+
+func statsWhere(match func(client string) bool) []HostStats {
+	statsMu.Lock()
+	counters := make([]*hostCounter, 0, len(stats))
+	for key, c := range stats {
+		if match(key[0]) {
+			counters = append(counters, c)
+		}
+	}
+	statsMu.Unlock()
+
+	result := make([]HostStats, 0, len(counters))
+	for _, c := range counters {
+		c.mu.Lock()
+		s := c.stats
+		c.mu.Unlock()
+
+		if s.Requests > 0 {
+			s.AvgLatencyMs = float64(s.TotalLatency.Microseconds()) / float64(s.Requests) / 1000
+		}
+		s.Breaker = BreakerClosed
+		breakerSetsMu.Lock()
+		set := breakerSets[s.Client]
+		breakerSetsMu.Unlock()
+		if set != nil {
+			set.mu.Lock()
+			b := set.breakers[s.Host]
+			set.mu.Unlock()
+			if b != nil {
+				state, until := b.snapshot()
+				s.Breaker = state
+				if !until.IsZero() {
+					s.OpenUntil = &until
+				}
+			}
+		}
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Client != result[j].Client {
+			return result[i].Client < result[j].Client
+		}
+		return result[i].Host < result[j].Host
+	})
+	return result
+}
@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job status values.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// historyLimit bounds how many finished jobs are retained in memory.
+const historyLimit = 100
+
+// Job describes a unit of background work and its current state.
+type Job struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Target      string      `json:"target,omitempty"`
+	Status      string      `json:"status"`
+	Progress    int         `json:"progress"`
+	Total       int         `json:"total"`
+	Error       string      `json:"error,omitempty"`
+	Result      interface{} `json:"result,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	StartedAt   *time.Time  `json:"started_at,omitempty"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+
+	// done is closed once the job has finished.
+	done chan struct{}
+}
+
+// ErrNotFound is returned when waiting for a job the manager doesn't know.
+var ErrNotFound = errors.New("job not found")
+
+// jobKey identifies the work a job does, for deduplication.
+type jobKey struct {
+	jobType, target string
+}
+
+// ProgressFunc reports incremental progress for a running job.
+type ProgressFunc func(done, total int)
+
+// Func is the body of a background job.
+type Func func(ctx context.Context, report ProgressFunc) (interface{}, error)
+
+// Manager runs jobs in the background and keeps a bounded history of them.
+type Manager struct {
+	ctx context.Context
+
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	// active maps the type and target of each queued or running job to its ID.
+	active map[jobKey]string
+}
+
+// NewManager creates a job manager whose jobs are cancelled when ctx ends.
+func NewManager(ctx context.Context) *Manager {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Manager{
+		ctx:    ctx,
+		jobs:   make(map[string]*Job),
+		active: make(map[jobKey]string),
+	}
+}
+
+// Start schedules fn to run in the background and returns a snapshot of the
+// new job and true. While a job of the same type and target is queued or
+// running, no duplicate is started: Start returns that job and false.
+func (m *Manager) Start(jobType, target string, fn Func) (Job, bool) {
+	key := jobKey{jobType: jobType, target: target}
+
+	m.mu.Lock()
+	if id, ok := m.active[key]; ok {
+		snapshot := *m.jobs[id]
+		m.mu.Unlock()
+		return snapshot, false
+	}
+	job := &Job{
+		ID:        uuid.NewString(),
+		Type:      jobType,
+		Target:    target,
+		Status:    StatusQueued,
+		CreatedAt: time.Now().UTC(),
+		done:      make(chan struct{}),
+	}
+	m.jobs[job.ID] = job
+	m.active[key] = job.ID
+	m.pruneLocked()
+	snapshot := *job
+	m.mu.Unlock()
+
+	go m.run(job, fn)
+
+	return snapshot, true
+}
+
+func (m *Manager) run(job *Job, fn Func) {
+	m.update(job.ID, func(j *Job) {
+		now := time.Now().UTC()
+		j.Status = StatusRunning
+		j.StartedAt = &now
+	})
+
+	report := func(done, total int) {
+		m.update(job.ID, func(j *Job) {
+			j.Progress = done
+			j.Total = total
+		})
+	}
+
+	result, err := safeRun(m.ctx, fn, report)
+
+	m.update(job.ID, func(j *Job) {
+		now := time.Now().UTC()
+		j.CompletedAt = &now
+		j.Result = result
+		j.Status = StatusCompleted
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+		}
+		delete(m.active, jobKey{jobType: j.Type, target: j.Target})
+		close(j.done)
+	})
+
+	if err != nil {
+		log.Printf("job %s (%s) failed: %v", job.ID, job.Type, err)
+	}
+}
+
+func safeRun(ctx context.Context, fn Func, report ProgressFunc) (result interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("job panicked: %v", rec)
+		}
+	}()
+	return fn(ctx, report)
+}
+
+func (m *Manager) update(id string, mutate func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.jobs[id]; ok {
+		mutate(job)
+	}
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Wait blocks until the job with the given ID finishes, or ctx ends, and
+// returns its final snapshot.
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.RLock()
+	job, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return *job, nil
+}
+
+// List returns snapshots of all retained jobs, newest first.
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// pruneLocked drops the oldest finished jobs once the history limit is exceeded.
+func (m *Manager) pruneLocked() {
+	if len(m.jobs) <= historyLimit {
+		return
+	}
+
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusCompleted || job.Status == StatusFailed {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CreatedAt.Before(finished[j].CreatedAt)
+	})
+
+	for _, job := range finished {
+		if len(m.jobs) <= historyLimit {
+			return
+		}
+		delete(m.jobs, job.ID)
+	}
+}
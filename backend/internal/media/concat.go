@@ -0,0 +1,160 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// concatMimeTypes are the formats whose files still play as one stream
+// when joined byte for byte: MPEG audio and ADTS frames resynchronise at
+// each file, and Ogg allows chained streams.
+var concatMimeTypes = []string{"audio/mpeg", "audio/aac", "audio/ogg"}
+
+// Joinable reports whether files of the given MIME types, in order, can be
+// served as one stream by joining their bytes. A single file always can.
+func Joinable(mimeTypes []string) bool {
+	if len(mimeTypes) <= 1 {
+		return len(mimeTypes) == 1
+	}
+	first := baseMimeType(mimeTypes[0])
+	for _, mimeType := range mimeTypes[1:] {
+		if baseMimeType(mimeType) != first {
+			return false
+		}
+	}
+	return slices.Contains(concatMimeTypes, first)
+}
+
+// JoinedFile is one file of a JoinedReader.
+type JoinedFile struct {
+	Path string
+	Size int64
+}
+
+// JoinedReader reads files one after another as a single seekable stream,
+// so http.ServeContent can answer range requests across file boundaries.
+// Each file is opened when reading reaches it. Sizes must match the files.
+type JoinedReader struct {
+	files  []JoinedFile
+	size   int64
+	offset int64
+
+	open      *os.File
+	openIndex int
+}
+
+// NewJoinedReader returns a reader over files in order.
+func NewJoinedReader(files []JoinedFile) *JoinedReader {
+	r := &JoinedReader{files: files, openIndex: -1}
+	for _, f := range files {
+		r.size += f.Size
+	}
+	return r
+}
+
+// Size returns the length of the joined stream.
+func (r *JoinedReader) Size() int64 {
+	return r.size
+}
+
+// Read reads from the file at the current offset, moving on to the next
+// file at its end.
+func (r *JoinedReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	index, start := 0, int64(0)
+	for ; index < len(r.files); index++ {
+		if r.offset < start+r.files[index].Size {
+			break
+		}
+		start += r.files[index].Size
+	}
+	if index != r.openIndex {
+		r.closeOpen()
+		f, err := os.Open(r.files[index].Path)
+		if err != nil {
+			return 0, err
+		}
+		r.open, r.openIndex = f, index
+	}
+
+	remain := start + r.files[index].Size - r.offset
+	if int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := r.open.ReadAt(p, r.offset-start)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		if n < len(p) {
+			return n, fmt.Errorf("%s is shorter than recorded", r.files[index].Path)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read.
+func (r *JoinedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("joined reader: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("joined reader: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the file being read.
+func (r *JoinedReader) Close() error {
+	r.closeOpen()
+	return nil
+}
+
+func (r *JoinedReader) closeOpen() {
+	if r.open != nil {
+		r.open.Close()
+		r.open, r.openIndex = nil, -1
+	}
+}
+
+// TranscodeJoined streams the files at paths, in order, to w as one MP3
+// using ffmpeg's concat demuxer, like Transcode does for a single file.
+func TranscodeJoined(ctx context.Context, paths []string, w io.Writer, bufferSize int) error {
+	work, err := os.MkdirTemp("", "lore-stream-*")
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	inputs := make([]MergeInput, len(paths))
+	for i, path := range paths {
+		inputs[i] = MergeInput{Path: path}
+	}
+	listPath := filepath.Join(work, "files.txt")
+	if err := os.WriteFile(listPath, []byte(concatList(inputs)), 0o600); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	return streamFFmpeg(ctx, w, bufferSize,
+		"-v", "error",
+		"-f", "concat", "-safe", "0", "-i", listPath,
+		"-vn",
+		"-codec:a", "libmp3lame",
+		"-b:a", "128k",
+		"-f", "mp3",
+		"pipe:1")
+}
@@ -0,0 +1,80 @@
+package media
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// FileFilter decides which files a library scan treats as audio: the
+// built-in formats plus Extensions, except names matching an Ignore glob.
+// The zero value accepts exactly the built-in formats.
+type FileFilter struct {
+	// Extensions are lowercase and start with a dot.
+	Extensions []string
+	// Ignore holds lowercase filepath.Match patterns, matched against
+	// base names ignoring case.
+	Ignore []string
+}
+
+// FileFilterFromSettings reads a library's file filter from its settings.
+// Malformed entries, including invalid globs, are dropped.
+func FileFilterFromSettings(settings models.LibrarySettings) FileFilter {
+	var f FileFilter
+	for _, ext := range trimmedList(settings.AudioExtensions) {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) > 1 {
+			f.Extensions = append(f.Extensions, ext)
+		}
+	}
+	for _, pattern := range trimmedList(settings.IgnorePatterns) {
+		pattern = strings.ToLower(pattern)
+		if _, err := filepath.Match(pattern, ""); err == nil {
+			f.Ignore = append(f.Ignore, pattern)
+		}
+	}
+	return f
+}
+
+// IsAudioFile reports whether path is an audio file the filter accepts.
+func (f FileFilter) IsAudioFile(path string) bool {
+	if f.Ignored(path) {
+		return false
+	}
+	if IsAudioFile(path) {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, extra := range f.Extensions {
+		if ext == extra {
+			return true
+		}
+	}
+	return false
+}
+
+// Ignored reports whether the base name of path matches an ignore pattern.
+func (f FileFilter) Ignored(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, pattern := range f.Ignore {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// trimmedList returns the non-empty entries of list, trimmed.
+func trimmedList(list []string) []string {
+	var trimmed []string
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s != "" {
+			trimmed = append(trimmed, s)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,67 @@
+package media
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Format describes a supported audio container.
+type Format struct {
+	Extensions []string
+	MimeType   string
+	// DirectPlay reports whether typical clients (browsers, mobile players)
+	// can play the format as-is. Other formats are transcoded unless the
+	// client declares support for them.
+	DirectPlay bool
+}
+
+// Formats lists the audio containers recognised in libraries and imports.
+var Formats = []Format{
+	{Extensions: []string{".mp3"}, MimeType: "audio/mpeg", DirectPlay: true},
+	{Extensions: []string{".m4a", ".m4b"}, MimeType: "audio/mp4", DirectPlay: true},
+	{Extensions: []string{".aac"}, MimeType: "audio/aac", DirectPlay: true},
+	{Extensions: []string{".flac"}, MimeType: "audio/flac", DirectPlay: true},
+	{Extensions: []string{".wav"}, MimeType: "audio/wav", DirectPlay: true},
+	{Extensions: []string{".ogg"}, MimeType: "audio/ogg", DirectPlay: true},
+	{Extensions: []string{".opus"}, MimeType: "audio/opus", DirectPlay: true},
+	{Extensions: []string{".webm"}, MimeType: "audio/webm", DirectPlay: true},
+	{Extensions: []string{".aiff", ".aif", ".aifc"}, MimeType: "audio/aiff", DirectPlay: false},
+	{Extensions: []string{".wma"}, MimeType: "audio/x-ms-wma", DirectPlay: false},
+}
+
+// IsAudioFile reports whether path has a supported audio extension.
+func IsAudioFile(path string) bool {
+	_, ok := formatForExtension(path)
+	return ok
+}
+
+// FormatForMimeType returns the format registered for a MIME type.
+func FormatForMimeType(mimeType string) (Format, bool) {
+	mimeType = baseMimeType(mimeType)
+	for _, format := range Formats {
+		if format.MimeType == mimeType {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+func formatForExtension(path string) (Format, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, format := range Formats {
+		for _, candidate := range format.Extensions {
+			if ext == candidate {
+				return format, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// baseMimeType strips parameters such as "; codecs=opus" and lowercases.
+func baseMimeType(mimeType string) string {
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
@@ -0,0 +1,270 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HLSSegmentSeconds is the length of every HLS segment but the last.
+const HLSSegmentSeconds = 10
+
+// HLSMimeType is the content type of an HLS playlist; HLSSegmentMimeType
+// that of its MPEG-TS segments.
+const (
+	HLSMimeType        = "application/vnd.apple.mpegurl"
+	HLSSegmentMimeType = "video/mp2t"
+)
+
+// HLSSegmentCount returns how many segments a stream of durationSec is
+// split into.
+func HLSSegmentCount(durationSec float64) int {
+	if durationSec <= 0 {
+		return 0
+	}
+	return int(math.Ceil(durationSec / HLSSegmentSeconds))
+}
+
+// HLSPlaylist renders a complete (VOD) media playlist for a stream of
+// durationSec. uri returns the address of segment i.
+func HLSPlaylist(durationSec float64, uri func(i int) string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", HLSSegmentSeconds)
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for i := 0; i < HLSSegmentCount(durationSec); i++ {
+		length := math.Min(HLSSegmentSeconds, durationSec-float64(i*HLSSegmentSeconds))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", length, uri(i))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// HLSRemuxable reports whether files of the given MIME types usually hold
+// AAC audio that an HLS segment can carry without re-encoding. MP4 files
+// with other codecs, such as ALAC, fail to remux.
+func HLSRemuxable(mimeTypes []string) bool {
+	for _, mimeType := range mimeTypes {
+		switch baseMimeType(mimeType) {
+		case "audio/aac", "audio/mp4":
+		default:
+			return false
+		}
+	}
+	return len(mimeTypes) > 0
+}
+
+// HLSSegmentOptions describes one segment cut from a stream of files.
+type HLSSegmentOptions struct {
+	// Paths are the stream's files in playback order.
+	Paths []string
+	// Index is the segment to cut.
+	Index int
+	// Remux copies the audio as is instead of encoding it to AAC.
+	Remux bool
+}
+
+// WriteHLSSegment cuts segment opts.Index of the files at opts.Paths, as
+// one stream, into an MPEG-TS file at dest using ffmpeg. Timestamps carry
+// on from the previous segment so players join them without gaps.
+func WriteHLSSegment(ctx context.Context, dest string, opts HLSSegmentOptions) error {
+	work, err := os.MkdirTemp("", "lore-hls-*")
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	inputs := make([]MergeInput, len(opts.Paths))
+	for i, path := range opts.Paths {
+		inputs[i] = MergeInput{Path: path}
+	}
+	listPath := filepath.Join(work, "files.txt")
+	if err := os.WriteFile(listPath, []byte(concatList(inputs)), 0o600); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	start := strconv.Itoa(opts.Index * HLSSegmentSeconds)
+	codec := []string{"-codec:a", "aac", "-b:a", "128k"}
+	if opts.Remux {
+		codec = []string{"-codec:a", "copy"}
+	}
+	args := []string{
+		"-v", "error",
+		"-ss", start,
+		"-f", "concat", "-safe", "0", "-i", listPath,
+		"-t", strconv.Itoa(HLSSegmentSeconds),
+		"-vn",
+	}
+	args = append(args, codec...)
+	args = append(args,
+		"-output_ts_offset", start,
+		"-muxdelay", "0",
+		"-f", "mpegts",
+		"-y", dest)
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// HLSCache keeps cut HLS segments on disk so replaying or seeking back does
+// not run ffmpeg again. Segments nobody has fetched for the TTL are removed
+// by Sweep.
+type HLSCache struct {
+	dir string
+	ttl time.Duration
+
+	mu      sync.Mutex
+	cutting map[string]*hlsCut
+}
+
+// hlsCut is a segment being written; waiters share its result.
+type hlsCut struct {
+	done chan struct{}
+	err  error
+}
+
+// NewHLSCache creates a cache of segments in dir, kept for ttl after their
+// last use.
+func NewHLSCache(dir string, ttl time.Duration) *HLSCache {
+	return &HLSCache{dir: dir, ttl: ttl, cutting: make(map[string]*hlsCut)}
+}
+
+// Segment returns the path of a cached segment, cutting it first if
+// needed. version identifies the stream's files, so a book whose files
+// change gets fresh segments; concurrent requests for the same segment wait
+// for one cut.
+func (c *HLSCache) Segment(ctx context.Context, audiobookID, version string, opts HLSSegmentOptions) (string, error) {
+	if strings.ContainsAny(audiobookID+version, `/\.`) {
+		return "", fmt.Errorf("hls: invalid segment key %q/%q", audiobookID, version)
+	}
+	path := filepath.Join(c.dir, audiobookID, version, strconv.Itoa(opts.Index)+".ts")
+	for {
+		if _, err := os.Stat(path); err == nil {
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return path, nil
+		}
+
+		c.mu.Lock()
+		cut, busy := c.cutting[path]
+		if !busy {
+			cut = &hlsCut{done: make(chan struct{})}
+			c.cutting[path] = cut
+		}
+		c.mu.Unlock()
+
+		if busy {
+			select {
+			case <-cut.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			if cut.err != nil && !errors.Is(cut.err, context.Canceled) {
+				return "", cut.err
+			}
+			// Cut again if the request that started it went away.
+			continue
+		}
+
+		cut.err = c.cut(ctx, path, opts)
+		c.mu.Lock()
+		delete(c.cutting, path)
+		c.mu.Unlock()
+		close(cut.done)
+		if cut.err != nil {
+			return "", cut.err
+		}
+		return path, nil
+	}
+}
+
+// cut writes a segment next to path and renames it into place, so a
+// failed or interrupted cut never leaves a partial segment behind.
+func (c *HLSCache) cut(ctx context.Context, path string, opts HLSSegmentOptions) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("hls cache: %w", err)
+	}
+	tmp := path + ".part"
+	if err := WriteHLSSegment(ctx, tmp, opts); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("hls cache: %w", err)
+	}
+	return nil
+}
+
+// Sweep removes segments not fetched within the TTL, and the directories
+// left empty, returning how many segments were removed.
+func (c *HLSCache) Sweep() (int, error) {
+	cutoff := time.Now().Add(-c.ttl)
+	removed := 0
+	var dirs []string
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != c.dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) && os.Remove(path) == nil && strings.HasSuffix(path, ".ts") {
+			removed++
+		}
+		return nil
+	})
+	// Deepest first; removing a directory that still has segments fails.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return removed, err
+}
+
+// Watch sweeps the cache every interval until ctx ends.
+func (c *HLSCache) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed, err := c.Sweep(); err != nil {
+				log.Printf("hls cache: %v", err)
+			} else if removed > 0 {
+				log.Printf("hls cache: removed %d unused segments", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// MergeMimeType is the type of files produced by Merge.
+const MergeMimeType = "audio/mp4"
+
+// MergeInput is one source file of a merge, in playback order.
+type MergeInput struct {
+	Path        string
+	Title       string // chapter title
+	DurationSec float64
+}
+
+// Chapter is a chapter of a merged file, in seconds from the start.
+type Chapter struct {
+	Title    string  `json:"title"`
+	StartSec float64 `json:"start_sec"`
+	EndSec   float64 `json:"end_sec"`
+}
+
+// Chapters places one chapter at each input boundary.
+func Chapters(inputs []MergeInput) []Chapter {
+	chapters := make([]Chapter, 0, len(inputs))
+	var start float64
+	for _, in := range inputs {
+		end := start + in.DurationSec
+		chapters = append(chapters, Chapter{Title: in.Title, StartSec: start, EndSec: end})
+		start = end
+	}
+	return chapters
+}
+
+// ChapterTitle derives a chapter title from a filename by dropping the
+// directory, the extension and any leading track number, e.g.
+// "01 - The Beginning.mp3" becomes "The Beginning". Filenames that are only a
+// number keep it.
+func ChapterTitle(filename string) string {
+	base := filepath.Base(filepath.FromSlash(filename))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	title := strings.TrimLeftFunc(base, unicode.IsDigit)
+	if title != base {
+		title = strings.TrimLeftFunc(title, func(r rune) bool {
+			return unicode.IsSpace(r) || strings.ContainsRune("-_.)]", r)
+		})
+	}
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	if title == "" {
+		return strings.TrimSpace(base)
+	}
+	return title
+}
+
+// Merge concatenates inputs into a single chaptered M4B at output using
+// ffmpeg. When copyAudio is set the AAC streams are copied as-is, otherwise
+// they are encoded to AAC. The file is written under a temporary name and
+// only renamed into place once ffmpeg succeeds.
+func Merge(ctx context.Context, inputs []MergeInput, output string, copyAudio bool) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("merge: no input files")
+	}
+
+	work, err := os.MkdirTemp("", "lore-merge-*")
+	if err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	listPath := filepath.Join(work, "files.txt")
+	if err := os.WriteFile(listPath, []byte(concatList(inputs)), 0o600); err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+	metaPath := filepath.Join(work, "chapters.txt")
+	if err := os.WriteFile(metaPath, []byte(chapterMetadata(Chapters(inputs))), 0o600); err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+
+	codec := []string{"-codec:a", "aac", "-b:a", "128k"}
+	if copyAudio {
+		codec = []string{"-codec:a", "copy"}
+	}
+
+	// The temporary output sits next to the destination so the final rename
+	// stays on one filesystem.
+	tmp := filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+".partial")
+	args := []string{
+		"-v", "error",
+		"-y",
+		"-f", "concat", "-safe", "0", "-i", listPath,
+		"-i", metaPath,
+		"-map", "0:a",
+		"-map_metadata", "1",
+		"-map_chapters", "1",
+	}
+	args = append(args, codec...)
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", tmp)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := os.Rename(tmp, output); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("merge: %w", err)
+	}
+	return nil
+}
+
+// concatList builds an input list for ffmpeg's concat demuxer.
+func concatList(inputs []MergeInput) string {
+	var b strings.Builder
+	for _, in := range inputs {
+		path, err := filepath.Abs(in.Path)
+		if err != nil {
+			path = in.Path
+		}
+		b.WriteString("file '")
+		b.WriteString(strings.ReplaceAll(path, "'", `'\''`))
+		b.WriteString("'\n")
+	}
+	return b.String()
+}
+
+// chapterMetadata renders chapters in ffmpeg's FFMETADATA1 format.
+func chapterMetadata(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, ch := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(ch.StartSec*1000), int64(ch.EndSec*1000), escapeMetadata(ch.Title))
+	}
+	return b.String()
+}
+
+// escapeMetadata escapes the characters FFMETADATA1 treats specially.
+func escapeMetadata(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '=', ';', '#', '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '\n', '\r':
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package media
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// sniffLen is the number of leading bytes inspected when sniffing a file.
+const sniffLen = 64
+
+// ExtensionMimeType returns the MIME type implied by an audio file's extension.
+// Unknown extensions fall back to audio/mpeg.
+func ExtensionMimeType(path string) string {
+	if format, ok := formatForExtension(path); ok {
+		return format.MimeType
+	}
+	return "audio/mpeg"
+}
+
+// asfHeaderGUID starts every ASF (WMA) file.
+var asfHeaderGUID = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+
+// SniffMimeType identifies an audio container from its leading bytes. It
+// returns an empty string when the content is not recognised.
+func SniffMimeType(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return "audio/mpeg"
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return "audio/mp4"
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "audio/flac"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		// The first page of an Opus stream carries the OpusHead packet.
+		if bytes.Contains(header, []byte("OpusHead")) {
+			return "audio/opus"
+		}
+		return "audio/ogg"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("FORM")) &&
+		(bytes.Equal(header[8:12], []byte("AIFF")) || bytes.Equal(header[8:12], []byte("AIFC"))):
+		return "audio/aiff"
+	case bytes.HasPrefix(header, asfHeaderGUID):
+		return "audio/x-ms-wma"
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// EBML header; Matroska and WebM share it.
+		return "audio/webm"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		// ADTS frame sync with layer bits 00.
+		return "audio/aac"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0:
+		// MPEG audio frame sync with a non-reserved layer.
+		return "audio/mpeg"
+	default:
+		return ""
+	}
+}
+
+// SniffFile reads the start of the file at path and sniffs its MIME type.
+func SniffFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return SniffMimeType(header[:n]), nil
+}
+
+// Detection is the outcome of classifying a media file.
+type Detection struct {
+	// MimeType is the type that should be stored and served.
+	MimeType string
+	// ExtensionMimeType is the type implied by the file extension.
+	ExtensionMimeType string
+}
+
+// Mismatch reports whether the content disagrees with the file extension.
+func (d Detection) Mismatch() bool {
+	return d.MimeType != d.ExtensionMimeType
+}
+
+// Detector assigns MIME types to media files during scans and imports.
+type Detector struct {
+	// Sniff enables content sniffing. When false, or when the content is
+	// unrecognised or unreadable, the extension decides.
+	Sniff bool
+}
+
+// Detect classifies the file at path.
+func (d Detector) Detect(path string) Detection {
+	detection := Detection{ExtensionMimeType: ExtensionMimeType(path)}
+	detection.MimeType = detection.ExtensionMimeType
+	if !d.Sniff {
+		return detection
+	}
+	if sniffed, err := SniffFile(path); err == nil && sniffed != "" {
+		detection.MimeType = sniffed
+	}
+	return detection
+}
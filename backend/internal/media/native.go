@@ -0,0 +1,190 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrUnsupportedFormat is returned by Native for files it cannot parse.
+var ErrUnsupportedFormat = errors.New("unsupported media format")
+
+// Native reads durations and tags without external tools. It understands
+// MP3 (ID3v2 and ID3v1 tags, Xing/VBRI or constant bitrate), MP4/M4A/M4B,
+// FLAC, Ogg Vorbis and Opus, and WAV files.
+type Native struct{}
+
+// Name implements Prober.
+func (Native) Name() string { return "native" }
+
+// Probe implements Prober.
+func (Native) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	header = header[:n]
+
+	var result *ProbeResult
+	switch mime := SniffMimeType(header); {
+	case mime == "audio/mp4":
+		result, err = probeMP4(f, size)
+	case mime == "audio/flac":
+		result, err = probeFLAC(f)
+	case mime == "audio/ogg" || mime == "audio/opus":
+		result, err = probeOgg(f, size)
+	case mime == "audio/wav":
+		result, err = probeWAV(f, size)
+	case mime == "audio/mpeg":
+		result, err = probeMP3(f, size)
+	default:
+		return nil, fmt.Errorf("%s: %w", path, ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return result, nil
+}
+
+// readAt reads exactly n bytes at off.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// decodeText decodes tag text in an ID3 encoding: 0 ISO-8859-1, 1 UTF-16
+// with a byte order mark, 2 UTF-16BE or 3 UTF-8. Text ends at the first
+// terminator.
+func decodeText(encoding byte, data []byte) string {
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if encoding == 1 && len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if (data[0] == 0xFF && data[1] == 0xFE) || (data[0] == 0xFE && data[1] == 0xFF) {
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			u := order.Uint16(data[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return strings.TrimSpace(string(utf16.Decode(units)))
+	case 3:
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			data = data[:i]
+		}
+		return strings.TrimSpace(string(data))
+	default:
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			data = data[:i]
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.TrimSpace(string(runes))
+	}
+}
+
+// setTag fills *field unless it already has a value.
+func setTag(field *string, value string) {
+	if *field == "" {
+		*field = strings.TrimSpace(value)
+	}
+}
+
+// applyVorbisComment copies a KEY=value comment, as used by FLAC and Ogg,
+// into tags.
+func applyVorbisComment(tags *Tags, comment string) {
+	key, value, ok := strings.Cut(comment, "=")
+	if !ok {
+		return
+	}
+	switch strings.ToUpper(key) {
+	case "TITLE":
+		setTag(&tags.Title, value)
+	case "ARTIST":
+		setTag(&tags.Artist, value)
+	case "ALBUMARTIST", "ALBUM ARTIST":
+		setTag(&tags.AlbumArtist, value)
+	case "ALBUM":
+		setTag(&tags.Album, value)
+	case "COMPOSER":
+		setTag(&tags.Composer, value)
+	case "GENRE":
+		setTag(&tags.Genre, value)
+	case "DATE", "YEAR":
+		setTag(&tags.Year, value)
+	case "TRACKNUMBER":
+		setTag(&tags.Track, value)
+	case "COMMENT", "DESCRIPTION":
+		setTag(&tags.Comment, value)
+	}
+}
+
+// parseVorbisComments reads a Vorbis comment block: a little-endian vendor
+// string followed by a count of KEY=value comments.
+func parseVorbisComments(data []byte, tags *Tags) {
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return nil, false
+		}
+		value := data[:n]
+		data = data[n:]
+		return value, true
+	}
+
+	if _, ok := next(); !ok {
+		return
+	}
+	if len(data) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return
+		}
+		applyVorbisComment(tags, string(comment))
+	}
+}
@@ -0,0 +1,249 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// mpegBitrates holds bitrates in kbit/s by [version group][layer][index],
+// where version group 0 is MPEG-1 and 1 is MPEG-2/2.5, and layer 0 is
+// Layer I.
+var mpegBitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+// mpegSampleRates holds sample rates by [version bits][index].
+var mpegSampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG-2.5
+	{0, 0, 0},             // reserved
+	{22050, 24000, 16000}, // MPEG-2
+	{44100, 48000, 32000}, // MPEG-1
+}
+
+// mpegFrame is a decoded MPEG audio frame header.
+type mpegFrame struct {
+	mpeg1           bool
+	layer           int // 1, 2 or 3
+	bitrate         int // bit/s
+	sampleRate      int
+	mono            bool
+	samplesPerFrame int
+}
+
+func parseMPEGFrame(h []byte) (mpegFrame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mpegFrame{}, false
+	}
+	version := int(h[1]>>3) & 0x03
+	layerBits := int(h[1]>>1) & 0x03
+	bitrateIndex := int(h[2] >> 4)
+	rateIndex := int(h[2]>>2) & 0x03
+	if version == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mpegFrame{}, false
+	}
+
+	frame := mpegFrame{
+		mpeg1:      version == 3,
+		layer:      4 - layerBits,
+		sampleRate: mpegSampleRates[version][rateIndex],
+		mono:       h[3]>>6 == 3,
+	}
+	group := 1
+	if frame.mpeg1 {
+		group = 0
+	}
+	frame.bitrate = mpegBitrates[group][frame.layer-1][bitrateIndex] * 1000
+	switch {
+	case frame.layer == 1:
+		frame.samplesPerFrame = 384
+	case frame.layer == 3 && !frame.mpeg1:
+		frame.samplesPerFrame = 576
+	default:
+		frame.samplesPerFrame = 1152
+	}
+	return frame, true
+}
+
+// probeMP3 reads ID3 tags and works out the duration from a Xing or VBRI
+// header, falling back to the first frame's bitrate for constant bitrate
+// files.
+func probeMP3(r io.ReaderAt, size int64) (*ProbeResult, error) {
+	result := &ProbeResult{}
+
+	var audioStart int64
+	if header, err := readAt(r, 0, 10); err == nil && bytes.HasPrefix(header, []byte("ID3")) {
+		tagSize := int64(syncsafe(header[6:10])) + 10
+		if header[5]&0x10 != 0 {
+			tagSize += 10 // footer
+		}
+		if body, err := readAt(r, 10, int(tagSize-10)); err == nil {
+			parseID3v2(header[3], header[5], body, &result.Tags)
+		}
+		audioStart = tagSize
+	}
+
+	audioEnd := size
+	if size >= 128 {
+		if trailer, err := readAt(r, size-128, 128); err == nil && bytes.HasPrefix(trailer, []byte("TAG")) {
+			parseID3v1(trailer, &result.Tags)
+			audioEnd -= 128
+		}
+	}
+
+	// Skip padding between the tag and the first frame.
+	window, err := readAt(r, audioStart, int(min(64<<10, audioEnd-audioStart)))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var frame mpegFrame
+	offset := -1
+	for i := 0; i+4 <= len(window); i++ {
+		if f, ok := parseMPEGFrame(window[i:]); ok {
+			frame, offset = f, i
+			break
+		}
+	}
+	if offset < 0 {
+		return nil, errors.New("no MPEG audio frame found")
+	}
+	first := window[offset:]
+
+	// A Xing/Info header follows the side information of the first frame.
+	sideInfo := 32
+	switch {
+	case frame.mpeg1 && frame.mono, !frame.mpeg1 && !frame.mono:
+		sideInfo = 17
+	case !frame.mpeg1 && frame.mono:
+		sideInfo = 9
+	}
+	if xing := 4 + sideInfo; len(first) >= xing+12 {
+		tag := first[xing : xing+4]
+		if (bytes.Equal(tag, []byte("Xing")) || bytes.Equal(tag, []byte("Info"))) && first[xing+7]&0x01 != 0 {
+			frames := binary.BigEndian.Uint32(first[xing+8:])
+			result.DurationSec = float64(frames) * float64(frame.samplesPerFrame) / float64(frame.sampleRate)
+			return result, nil
+		}
+	}
+	if len(first) >= 36+18 && bytes.Equal(first[36:40], []byte("VBRI")) {
+		frames := binary.BigEndian.Uint32(first[36+14:])
+		result.DurationSec = float64(frames) * float64(frame.samplesPerFrame) / float64(frame.sampleRate)
+		return result, nil
+	}
+
+	audioBytes := audioEnd - audioStart - int64(offset)
+	result.DurationSec = float64(audioBytes) * 8 / float64(frame.bitrate)
+	return result, nil
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// id3Frames maps ID3v2.3/2.4 and ID3v2.2 text frame IDs to tag fields.
+var id3Frames = map[string]func(*Tags) *string{
+	"TIT2": func(t *Tags) *string { return &t.Title },
+	"TT2":  func(t *Tags) *string { return &t.Title },
+	"TPE1": func(t *Tags) *string { return &t.Artist },
+	"TP1":  func(t *Tags) *string { return &t.Artist },
+	"TPE2": func(t *Tags) *string { return &t.AlbumArtist },
+	"TP2":  func(t *Tags) *string { return &t.AlbumArtist },
+	"TALB": func(t *Tags) *string { return &t.Album },
+	"TAL":  func(t *Tags) *string { return &t.Album },
+	"TCOM": func(t *Tags) *string { return &t.Composer },
+	"TCM":  func(t *Tags) *string { return &t.Composer },
+	"TCON": func(t *Tags) *string { return &t.Genre },
+	"TCO":  func(t *Tags) *string { return &t.Genre },
+	"TDRC": func(t *Tags) *string { return &t.Year },
+	"TYER": func(t *Tags) *string { return &t.Year },
+	"TYE":  func(t *Tags) *string { return &t.Year },
+	"TRCK": func(t *Tags) *string { return &t.Track },
+	"TRK":  func(t *Tags) *string { return &t.Track },
+}
+
+// parseID3v2 reads the text and comment frames of an ID3v2 tag body.
+func parseID3v2(version, flags byte, body []byte, tags *Tags) {
+	if flags&0x80 != 0 {
+		// Whole-tag unsynchronisation: undo the inserted zero bytes.
+		body = bytes.ReplaceAll(body, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		// Skip the extended header.
+		n := int(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			n = int(syncsafe(body))
+		} else {
+			n += 4
+		}
+		if n > len(body) {
+			return
+		}
+		body = body[n:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var size int
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 4:
+			size = int(syncsafe(body[4:8]))
+		default:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+		}
+		if size <= 0 || headerLen+size > len(body) {
+			return
+		}
+		data := body[headerLen : headerLen+size]
+		body = body[headerLen+size:]
+
+		if field, ok := id3Frames[id]; ok && len(data) > 1 {
+			setTag(field(tags), decodeText(data[0], data[1:]))
+			continue
+		}
+		if (id == "COMM" || id == "COM") && len(data) > 4 {
+			// Encoding, language, then a description and the text, each
+			// ending in a terminator of the encoding's width.
+			encoding, rest := data[0], data[4:]
+			terminator := []byte{0}
+			if encoding == 1 || encoding == 2 {
+				terminator = []byte{0, 0}
+			}
+			for i := 0; i+len(terminator) <= len(rest); i += len(terminator) {
+				if bytes.Equal(rest[i:i+len(terminator)], terminator) {
+					setTag(&tags.Comment, decodeText(encoding, rest[i+len(terminator):]))
+					break
+				}
+			}
+		}
+	}
+}
+
+// parseID3v1 reads the fixed-width fields of a 128-byte ID3v1 tag, which
+// only fill in what the ID3v2 tag left empty.
+func parseID3v1(tag []byte, tags *Tags) {
+	field := func(from, to int) string {
+		return strings.TrimRight(decodeText(0, tag[from:to]), " ")
+	}
+	setTag(&tags.Title, field(3, 33))
+	setTag(&tags.Artist, field(33, 63))
+	setTag(&tags.Album, field(63, 93))
+	setTag(&tags.Year, field(93, 97))
+	setTag(&tags.Comment, field(97, 127))
+}
@@ -0,0 +1,133 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// mp4Box is an ISO base media box located within a file.
+type mp4Box struct {
+	kind string
+	body int64 // offset of the payload
+	size int64 // payload length
+}
+
+// mp4Boxes lists the boxes between start and end.
+func mp4Boxes(r io.ReaderAt, start, end int64) []mp4Box {
+	var boxes []mp4Box
+	for off := start; off+8 <= end; {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			ext, err := readAt(r, off+8, 8)
+			if err != nil {
+				return boxes
+			}
+			size = int64(binary.BigEndian.Uint64(ext))
+			headerLen = 16
+		}
+		if size < headerLen || off+size > end {
+			break
+		}
+		boxes = append(boxes, mp4Box{kind: string(header[4:8]), body: off + headerLen, size: size - headerLen})
+		off += size
+	}
+	return boxes
+}
+
+func findMP4Box(boxes []mp4Box, kind string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// mp4Tags maps iTunes-style ilst atoms to tag fields.
+var mp4Tags = map[string]func(*Tags) *string{
+	"\xa9nam": func(t *Tags) *string { return &t.Title },
+	"\xa9ART": func(t *Tags) *string { return &t.Artist },
+	"aART":    func(t *Tags) *string { return &t.AlbumArtist },
+	"\xa9alb": func(t *Tags) *string { return &t.Album },
+	"\xa9wrt": func(t *Tags) *string { return &t.Composer },
+	"\xa9gen": func(t *Tags) *string { return &t.Genre },
+	"\xa9day": func(t *Tags) *string { return &t.Year },
+	"\xa9cmt": func(t *Tags) *string { return &t.Comment },
+}
+
+// probeMP4 reads the movie header duration and iTunes metadata of MP4, M4A
+// and M4B files.
+func probeMP4(r io.ReaderAt, size int64) (*ProbeResult, error) {
+	moov, ok := findMP4Box(mp4Boxes(r, 0, size), "moov")
+	if !ok {
+		return nil, errors.New("missing moov box")
+	}
+	children := mp4Boxes(r, moov.body, moov.body+moov.size)
+
+	result := &ProbeResult{}
+	mvhd, ok := findMP4Box(children, "mvhd")
+	if !ok {
+		return nil, errors.New("missing mvhd box")
+	}
+	header, err := readAt(r, mvhd.body, int(min(mvhd.size, 32)))
+	if err != nil {
+		return nil, err
+	}
+	var timescale uint32
+	var duration uint64
+	if header[0] == 1 && len(header) >= 32 {
+		timescale = binary.BigEndian.Uint32(header[20:])
+		duration = binary.BigEndian.Uint64(header[24:])
+	} else if len(header) >= 20 {
+		timescale = binary.BigEndian.Uint32(header[12:])
+		duration = uint64(binary.BigEndian.Uint32(header[16:]))
+	}
+	if timescale > 0 {
+		result.DurationSec = float64(duration) / float64(timescale)
+	}
+
+	if udta, ok := findMP4Box(children, "udta"); ok {
+		if meta, ok := findMP4Box(mp4Boxes(r, udta.body, udta.body+udta.size), "meta"); ok && meta.size > 4 {
+			// meta is a full box: skip its version and flags.
+			if ilst, ok := findMP4Box(mp4Boxes(r, meta.body+4, meta.body+meta.size), "ilst"); ok {
+				readMP4Tags(r, ilst, &result.Tags)
+			}
+		}
+	}
+	return result, nil
+}
+
+func readMP4Tags(r io.ReaderAt, ilst mp4Box, tags *Tags) {
+	for _, item := range mp4Boxes(r, ilst.body, ilst.body+ilst.size) {
+		data, ok := findMP4Box(mp4Boxes(r, item.body, item.body+item.size), "data")
+		if !ok || data.size <= 8 || data.size > 1<<20 {
+			continue
+		}
+		// The payload follows a type indicator and a locale.
+		value, err := readAt(r, data.body+8, int(data.size-8))
+		if err != nil {
+			continue
+		}
+		if item.kind == "trkn" {
+			if len(value) >= 4 {
+				if track := binary.BigEndian.Uint16(value[2:]); track > 0 {
+					setTag(&tags.Track, strconv.Itoa(int(track)))
+				}
+			}
+			continue
+		}
+		if field, ok := mp4Tags[item.kind]; ok {
+			setTag(field(tags), string(value))
+		}
+	}
+}
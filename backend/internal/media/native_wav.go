@@ -0,0 +1,72 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// wavInfoTags maps RIFF INFO chunk IDs to tag fields.
+var wavInfoTags = map[string]func(*Tags) *string{
+	"INAM": func(t *Tags) *string { return &t.Title },
+	"IART": func(t *Tags) *string { return &t.Artist },
+	"IPRD": func(t *Tags) *string { return &t.Album },
+	"IGNR": func(t *Tags) *string { return &t.Genre },
+	"ICRD": func(t *Tags) *string { return &t.Year },
+	"ICMT": func(t *Tags) *string { return &t.Comment },
+}
+
+// probeWAV reads the format and data chunks of a RIFF WAVE file, plus any
+// LIST INFO tags.
+func probeWAV(r io.ReaderAt, size int64) (*ProbeResult, error) {
+	result := &ProbeResult{}
+	var byteRate uint32
+	var dataSize int64
+	for off := int64(12); off+8 <= size; {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			return nil, err
+		}
+		id := string(header[:4])
+		length := int64(binary.LittleEndian.Uint32(header[4:]))
+		body := off + 8
+
+		switch id {
+		case "fmt ":
+			if format, err := readAt(r, body, 16); err == nil {
+				byteRate = binary.LittleEndian.Uint32(format[8:])
+			}
+		case "data":
+			// Streaming writers leave the size unset; use what is on disk.
+			dataSize = min(length, size-body)
+		case "LIST":
+			if length > 4 && length <= 1<<20 {
+				if list, err := readAt(r, body, int(length)); err == nil && string(list[:4]) == "INFO" {
+					parseWAVInfo(list[4:], &result.Tags)
+				}
+			}
+		}
+
+		// Chunks are padded to an even length.
+		off = body + length + length%2
+	}
+	if byteRate == 0 {
+		return nil, errors.New("missing fmt chunk")
+	}
+	result.DurationSec = float64(dataSize) / float64(byteRate)
+	return result, nil
+}
+
+func parseWAVInfo(data []byte, tags *Tags) {
+	for len(data) >= 8 {
+		id := string(data[:4])
+		length := int(binary.LittleEndian.Uint32(data[4:]))
+		if 8+length > len(data) {
+			return
+		}
+		if field, ok := wavInfoTags[id]; ok {
+			setTag(field(tags), decodeText(0, data[8:8+length]))
+		}
+		data = data[min(8+length+length%2, len(data)):]
+	}
+}
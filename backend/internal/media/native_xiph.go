@@ -0,0 +1,137 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// probeFLAC reads the STREAMINFO and VORBIS_COMMENT metadata blocks of a
+// FLAC file.
+func probeFLAC(r io.ReaderAt) (*ProbeResult, error) {
+	result := &ProbeResult{}
+	off := int64(4) // "fLaC"
+	for {
+		header, err := readAt(r, off, 4)
+		if err != nil {
+			return nil, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		off += 4
+
+		switch blockType {
+		case 0: // STREAMINFO
+			info, err := readAt(r, off, length)
+			if err != nil || len(info) < 18 {
+				return nil, errors.New("invalid STREAMINFO block")
+			}
+			sampleRate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+			samples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:]))
+			if sampleRate > 0 {
+				result.DurationSec = float64(samples) / float64(sampleRate)
+			}
+		case 4: // VORBIS_COMMENT
+			if data, err := readAt(r, off, length); err == nil {
+				parseVorbisComments(data, &result.Tags)
+			}
+		}
+
+		off += int64(length)
+		if last {
+			return result, nil
+		}
+	}
+}
+
+// oggTail is how much of the end of an Ogg file is searched for the last page.
+const oggTail = 64 << 10
+
+// probeOgg reads the identification and comment headers of an Ogg Vorbis or
+// Opus stream and takes the duration from the granule position of the last
+// page.
+func probeOgg(r io.ReaderAt, size int64) (*ProbeResult, error) {
+	packets, err := oggHeaderPackets(r, size, 2)
+	if err != nil {
+		return nil, err
+	}
+	ident, comments := packets[0], packets[1]
+
+	result := &ProbeResult{}
+	var sampleRate, preSkip uint64
+	switch {
+	case bytes.HasPrefix(ident, []byte("\x01vorbis")) && len(ident) >= 16:
+		sampleRate = uint64(binary.LittleEndian.Uint32(ident[12:]))
+		if bytes.HasPrefix(comments, []byte("\x03vorbis")) {
+			parseVorbisComments(comments[7:], &result.Tags)
+		}
+	case bytes.HasPrefix(ident, []byte("OpusHead")) && len(ident) >= 12:
+		// Opus granule positions always count 48 kHz samples.
+		sampleRate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(ident[10:]))
+		if bytes.HasPrefix(comments, []byte("OpusTags")) {
+			parseVorbisComments(comments[8:], &result.Tags)
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	start := max(size-oggTail, 0)
+	tail, err := readAt(r, start, int(size-start))
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.LastIndex(tail, []byte("OggS")); i >= 0 && i+14 <= len(tail) && sampleRate > 0 {
+		granule := binary.LittleEndian.Uint64(tail[i+6:])
+		if granule > preSkip {
+			result.DurationSec = float64(granule-preSkip) / float64(sampleRate)
+		}
+	}
+	return result, nil
+}
+
+// oggHeaderPackets reassembles the first n packets of an Ogg stream from
+// its page segments.
+func oggHeaderPackets(r io.ReaderAt, size int64, n int) ([][]byte, error) {
+	var packets [][]byte
+	var current []byte
+	for off := int64(0); off+27 <= size && len(packets) < n; {
+		header, err := readAt(r, off, 27)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, errors.New("invalid ogg page")
+		}
+		segments, err := readAt(r, off+27, int(header[26]))
+		if err != nil {
+			return nil, err
+		}
+		off += 27 + int64(len(segments))
+		for _, length := range segments {
+			data, err := readAt(r, off, int(length))
+			if err != nil {
+				return nil, err
+			}
+			off += int64(length)
+			current = append(current, data...)
+			// A segment shorter than 255 bytes ends the packet.
+			if length < 255 {
+				packets = append(packets, current)
+				current = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+		if len(current) > 1<<20 {
+			return nil, errors.New("ogg header packet too large")
+		}
+	}
+	if len(packets) < n {
+		return nil, errors.New("missing ogg header packets")
+	}
+	return packets, nil
+}
@@ -0,0 +1,139 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Playback methods.
+const (
+	PlaybackDirect    = "direct"
+	PlaybackTranscode = "transcode"
+)
+
+// TranscodeMimeType is the output format used when a client cannot play a
+// file directly. MP3 is the most widely supported target.
+const TranscodeMimeType = "audio/mpeg"
+
+// PlaybackDecision is the outcome of matching a file against client capabilities.
+type PlaybackDecision struct {
+	Method   string `json:"method"`
+	MimeType string `json:"mime_type"`
+}
+
+// ParseClientFormats reads a client's declared playable MIME types from a
+// comma separated list such as "audio/mpeg, audio/ogg; codecs=opus".
+func ParseClientFormats(raw string) []string {
+	var formats []string
+	for _, part := range strings.Split(raw, ",") {
+		if mimeType := baseMimeType(part); mimeType != "" {
+			formats = append(formats, mimeType)
+		}
+	}
+	return formats
+}
+
+// NegotiatePlayback decides whether a file of mimeType can be sent as-is.
+// When the client declares its playable formats, that list is authoritative;
+// otherwise the per-format DirectPlay default applies. Unknown formats are
+// sent directly.
+func NegotiatePlayback(mimeType string, clientFormats []string) PlaybackDecision {
+	direct := PlaybackDecision{Method: PlaybackDirect, MimeType: mimeType}
+	transcode := PlaybackDecision{Method: PlaybackTranscode, MimeType: TranscodeMimeType}
+
+	base := baseMimeType(mimeType)
+	if len(clientFormats) > 0 {
+		for _, format := range clientFormats {
+			if format == base || format == "audio/*" || format == "*/*" {
+				return direct
+			}
+		}
+		return transcode
+	}
+
+	format, ok := FormatForMimeType(base)
+	if !ok || format.DirectPlay {
+		return direct
+	}
+	return transcode
+}
+
+// TranscoderAvailable reports whether ffmpeg is on the PATH.
+func TranscoderAvailable() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// DefaultStreamBufferSize is the copy buffer used when none is configured.
+const DefaultStreamBufferSize = 64 << 10
+
+// Transcode streams the file at path to w as MP3 using ffmpeg, copying
+// through a buffer of bufferSize bytes and flushing after each chunk so
+// playback starts promptly. The process is stopped when ctx is cancelled,
+// e.g. when the client disconnects.
+func Transcode(ctx context.Context, path string, w io.Writer, bufferSize int) error {
+	return streamFFmpeg(ctx, w, bufferSize,
+		"-v", "error",
+		"-i", path,
+		"-vn",
+		"-codec:a", "libmp3lame",
+		"-b:a", "128k",
+		"-f", "mp3",
+		"pipe:1")
+}
+
+// streamFFmpeg runs ffmpeg with args and copies its output to w as
+// Transcode describes.
+func streamFFmpeg(ctx context.Context, w io.Writer, bufferSize int, args ...string) error {
+	if bufferSize <= 0 {
+		bufferSize = DefaultStreamBufferSize
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	_, copyErr := io.CopyBuffer(flushWriter{w}, stdout, make([]byte, bufferSize))
+	if copyErr != nil {
+		// Nobody is reading any more; stop ffmpeg instead of letting it block.
+		cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// flushWriter flushes after every write when the destination supports it.
+// It deliberately hides ReadFrom so io.CopyBuffer uses the given buffer.
+type flushWriter struct {
+	w io.Writer
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+	return n, err
+}
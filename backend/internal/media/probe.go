@@ -0,0 +1,117 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Tags are the basic text tags of a media file. Fields missing from the file
+// are empty.
+type Tags struct {
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Composer    string `json:"composer,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        string `json:"year,omitempty"`
+	Track       string `json:"track,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// ProbeResult describes a media file.
+type ProbeResult struct {
+	DurationSec float64
+	Tags        Tags
+}
+
+// Prober reads durations and tags from media files.
+type Prober interface {
+	// Name identifies the implementation, e.g. "ffprobe".
+	Name() string
+	Probe(ctx context.Context, path string) (*ProbeResult, error)
+}
+
+// NewProber returns an ffprobe-backed Prober when ffprobe is installed and
+// the built-in parser otherwise.
+func NewProber() Prober {
+	if FFprobeAvailable() {
+		return FFprobe{}
+	}
+	return Native{}
+}
+
+// FFprobeAvailable reports whether ffprobe is on the PATH.
+func FFprobeAvailable() bool {
+	_, err := exec.LookPath("ffprobe")
+	return err == nil
+}
+
+// FFprobe probes files with the ffprobe command, which understands every
+// format ffmpeg does.
+type FFprobe struct{}
+
+// Name implements Prober.
+func (FFprobe) Name() string { return "ffprobe" }
+
+// Probe implements Prober.
+func (FFprobe) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		path)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe with ffprobe: %w", err)
+	}
+
+	var info struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	duration, err := strconv.ParseFloat(info.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse duration value: %w", err)
+	}
+
+	// Tag keys keep the container's casing, e.g. "TITLE" in FLAC files.
+	tags := make(map[string]string, len(info.Format.Tags))
+	for key, value := range info.Format.Tags {
+		tags[strings.ToLower(key)] = strings.TrimSpace(value)
+	}
+	return &ProbeResult{
+		DurationSec: duration,
+		Tags: Tags{
+			Title:       tags["title"],
+			Artist:      tags["artist"],
+			AlbumArtist: tags["album_artist"],
+			Album:       tags["album"],
+			Composer:    tags["composer"],
+			Genre:       tags["genre"],
+			Year:        firstNonEmpty(tags["date"], tags["year"]),
+			Track:       tags["track"],
+			Comment:     tags["comment"],
+		},
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
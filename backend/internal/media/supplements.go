@@ -0,0 +1,59 @@
+package media
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of supplement files stored alongside an audiobook's audio.
+const (
+	SupplementImage    = "image"
+	SupplementText     = "text"
+	SupplementCueSheet = "cue"
+	SupplementDocument = "document"
+	SupplementMetadata = "metadata"
+)
+
+// Supplement describes a kind of companion file found in audiobook folders.
+type Supplement struct {
+	Kind       string
+	Extensions []string
+	// Names lists whole file names matched instead of extensions,
+	// compared ignoring case.
+	Names    []string
+	MimeType string
+}
+
+// Supplements lists the companion files scans store with an audiobook:
+// cover art, descriptions, cue sheets, PDF booklets and metadata sidecars.
+var Supplements = []Supplement{
+	{Kind: SupplementMetadata, Names: []string{"metadata.json"}, MimeType: "application/json"},
+	{Kind: SupplementImage, Extensions: []string{".jpg", ".jpeg"}, MimeType: "image/jpeg"},
+	{Kind: SupplementImage, Extensions: []string{".png"}, MimeType: "image/png"},
+	{Kind: SupplementImage, Extensions: []string{".webp"}, MimeType: "image/webp"},
+	{Kind: SupplementImage, Extensions: []string{".gif"}, MimeType: "image/gif"},
+	{Kind: SupplementText, Extensions: []string{".txt", ".nfo"}, MimeType: "text/plain; charset=utf-8"},
+	{Kind: SupplementText, Extensions: []string{".md"}, MimeType: "text/markdown; charset=utf-8"},
+	{Kind: SupplementCueSheet, Extensions: []string{".cue"}, MimeType: "application/x-cue"},
+	{Kind: SupplementDocument, Extensions: []string{".pdf"}, MimeType: "application/pdf"},
+	{Kind: SupplementDocument, Extensions: []string{".epub"}, MimeType: "application/epub+zip"},
+}
+
+// SupplementFor returns the supplement kind of path by its extension.
+func SupplementFor(path string) (Supplement, bool) {
+	name := strings.ToLower(filepath.Base(path))
+	ext := filepath.Ext(name)
+	for _, supplement := range Supplements {
+		for _, candidate := range supplement.Names {
+			if name == candidate {
+				return supplement, true
+			}
+		}
+		for _, candidate := range supplement.Extensions {
+			if ext == candidate {
+				return supplement, true
+			}
+		}
+	}
+	return Supplement{}, false
+}
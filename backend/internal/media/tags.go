@@ -0,0 +1,146 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TagValues are the metadata written into a file by WriteTags. Empty fields
+// leave the file's existing tag alone.
+type TagValues struct {
+	Title       string // book title, also written as the album
+	Author      string
+	Narrator    string
+	Series      string
+	SeriesPart  string
+	Date        string
+	Genre       string
+	Publisher   string
+	Description string
+	// Track and TrackCount number a file within a multi-file book; zero
+	// leaves the track tag alone.
+	Track      int
+	TrackCount int
+}
+
+// tagFormat describes how ffmpeg writes tags for one container.
+type tagFormat struct {
+	muxer string
+	// cover is set when the container holds cover art as an attached
+	// picture stream.
+	cover bool
+	// seriesKey is the tag the series name is written to; the series part
+	// is only written where seriesPartKey is set.
+	seriesKey     string
+	seriesPartKey string
+	extraArgs     []string
+}
+
+// tagFormats lists the extensions WriteTags supports.
+var tagFormats = map[string]tagFormat{
+	".mp3":  {muxer: "mp3", cover: true, seriesKey: "series", seriesPartKey: "series-part", extraArgs: []string{"-id3v2_version", "3"}},
+	".m4a":  {muxer: "mp4", cover: true, seriesKey: "grouping"},
+	".m4b":  {muxer: "mp4", cover: true, seriesKey: "grouping"},
+	".mp4":  {muxer: "mp4", cover: true, seriesKey: "grouping"},
+	".flac": {muxer: "flac", cover: true, seriesKey: "series", seriesPartKey: "series-part"},
+	".ogg":  {muxer: "ogg", seriesKey: "series", seriesPartKey: "series-part"},
+	".opus": {muxer: "opus", seriesKey: "series", seriesPartKey: "series-part"},
+}
+
+// TagsWritable reports whether WriteTags supports the format of path.
+func TagsWritable(path string) bool {
+	_, ok := tagFormats[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// CoverEmbeddable reports whether WriteTags can embed a cover in path.
+func CoverEmbeddable(path string) bool {
+	return tagFormats[strings.ToLower(filepath.Ext(path))].cover
+}
+
+// WriteTags rewrites the tags of the audio file at path with ffmpeg, copying
+// the audio and chapters unchanged. When coverPath is set and the format
+// holds cover art, that image replaces the embedded cover; otherwise the
+// existing cover is kept. Like Merge, the file is written under a temporary
+// name and only renamed over the original once ffmpeg succeeds.
+func WriteTags(ctx context.Context, path string, tags TagValues, coverPath string) error {
+	format, ok := tagFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return fmt.Errorf("write tags: unsupported format %s", filepath.Ext(path))
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".partial")
+	args := []string{"-v", "error", "-y", "-i", path}
+	if format.cover && coverPath != "" {
+		args = append(args, "-i", coverPath,
+			"-map", "0:a", "-map", "1:v",
+			"-disposition:v:0", "attached_pic",
+			"-metadata:s:v", "title=Album cover",
+			"-metadata:s:v", "comment=Cover (front)")
+	} else if format.cover {
+		args = append(args, "-map", "0:a", "-map", "0:v?")
+	} else {
+		args = append(args, "-map", "0:a")
+	}
+	args = append(args, "-map_metadata", "0", "-map_chapters", "0", "-codec", "copy")
+	args = append(args, tagArgs(tags, format)...)
+	args = append(args, format.extraArgs...)
+	args = append(args, "-f", format.muxer, tmp)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Keep the original's permissions; ffmpeg creates files with the
+	// process umask.
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmp, info.Mode().Perm())
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write tags: %w", err)
+	}
+	return nil
+}
+
+// tagArgs turns tags into ffmpeg -metadata arguments for format.
+func tagArgs(tags TagValues, format tagFormat) []string {
+	var args []string
+	set := func(key, value string) {
+		if value = strings.TrimSpace(value); value != "" && key != "" {
+			args = append(args, "-metadata", key+"="+value)
+		}
+	}
+	set("title", tags.Title)
+	set("album", tags.Title)
+	set("artist", tags.Author)
+	set("album_artist", tags.Author)
+	set("composer", tags.Narrator)
+	set(format.seriesKey, tags.Series)
+	set(format.seriesPartKey, tags.SeriesPart)
+	set("date", tags.Date)
+	set("genre", tags.Genre)
+	set("publisher", tags.Publisher)
+	set("description", tags.Description)
+	set("comment", tags.Description)
+	if tags.Track > 0 {
+		track := strconv.Itoa(tags.Track)
+		if tags.TrackCount > 0 {
+			track += "/" + strconv.Itoa(tags.TrackCount)
+		}
+		set("track", track)
+	}
+	return args
+}
@@ -0,0 +1,267 @@
+package metadata
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// Collation describes how a library orders titles and author names.
+type Collation struct {
+	// Locale is a language tag such as "en", "de" or "sv-SE". Only the
+	// language decides how accented letters and articles are treated.
+	Locale string `json:"locale"`
+	// IgnoreArticles drops a leading article ("The", "Der", "Les", ...) so
+	// "The Hobbit" sorts under H.
+	IgnoreArticles bool `json:"ignore_articles"`
+}
+
+// DefaultCollation is used by libraries without collation settings.
+var DefaultCollation = Collation{Locale: "en", IgnoreArticles: true}
+
+// CollationFromSettings reads a library's collation from its settings,
+// falling back to DefaultCollation for unset values.
+func CollationFromSettings(settings models.LibrarySettings) Collation {
+	c := DefaultCollation
+	if locale := strings.TrimSpace(settings.SortLocale); locale != "" {
+		c.Locale = locale
+	}
+	if settings.SortIgnoreArticles != nil {
+		c.IgnoreArticles = *settings.SortIgnoreArticles
+	}
+	return c
+}
+
+// language returns the lowercased primary subtag of the locale.
+func (c Collation) language() string {
+	lang, _, _ := strings.Cut(strings.ToLower(c.Locale), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return lang
+}
+
+// Key returns a sort key for s: comparing keys bytewise orders the original
+// strings by this collation. Case, punctuation and (depending on the
+// language) accents are ignored, a leading article is dropped when
+// IgnoreArticles is set, and numbers compare by value.
+func (c Collation) Key(s string) string {
+	lang := c.language()
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c.IgnoreArticles {
+		s = stripArticle(s, lang)
+	}
+
+	// Collapse punctuation and whitespace runs to single spaces; apostrophes
+	// are dropped so "Salem's" stays one word.
+	var b strings.Builder
+	pendingSpace := false
+	for _, r := range s {
+		if r == '\'' || r == '’' {
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingSpace && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			pendingSpace = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingSpace = true
+	}
+	return NaturalKey(foldLetters(b.String(), lang))
+}
+
+// SortTitle returns the title a book files under: the title without its
+// leading article when IgnoreArticles is set, so "The Martian" becomes
+// "Martian". The original casing is kept.
+func (c Collation) SortTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if !c.IgnoreArticles {
+		return title
+	}
+	// Articles are ASCII, so offsets into the lowercased title match.
+	return strings.TrimSpace(title[articleLen(strings.ToLower(title), c.language()):])
+}
+
+// SortKey returns the sort key for a value that is already a sort title or
+// sort author. Unlike Key it keeps a leading article, so a custom sort title
+// of "The The" still files under T.
+func (c Collation) SortKey(sortName string) string {
+	c.IgnoreArticles = false
+	return c.Key(sortName)
+}
+
+// IndexLetter returns the A–Z index entry a book belongs to, given its sort
+// key and sort name: the uppercased first letter, or "#" for titles starting
+// with a digit. Letters folded after "z" take their letter from the name.
+func IndexLetter(key, sortName string) string {
+	first, _ := utf8.DecodeRuneInString(key)
+	switch {
+	case first == utf8.RuneError:
+		return "#"
+	case strings.ContainsRune(afterZ1+afterZ2+afterZ3, first):
+		for _, r := range sortName {
+			if unicode.IsLetter(r) {
+				return string(unicode.ToUpper(r))
+			}
+		}
+		return "#"
+	case unicode.IsLetter(first):
+		return string(unicode.ToUpper(first))
+	default:
+		return "#"
+	}
+}
+
+// naturalWidth is the width numbers are zero-padded to in natural sort keys.
+const naturalWidth = 20
+
+// NaturalKey returns a case-insensitive sort key for s in which runs of
+// digits compare by value, so "Chapter 2" sorts before "Chapter 10".
+func NaturalKey(s string) string {
+	s = strings.ToLower(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		if s[i] < '0' || s[i] > '9' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		digits := strings.TrimLeft(s[start:i], "0")
+		if digits == "" {
+			digits = "0"
+		}
+		for n := len(digits); n < naturalWidth; n++ {
+			b.WriteByte('0')
+		}
+		b.WriteString(digits)
+	}
+	return b.String()
+}
+
+// articles lists the leading words IgnoreArticles drops, by language.
+// Entries ending in an apostrophe are elided articles such as "l'".
+var articles = map[string][]string{
+	"en": {"the", "a", "an"},
+	"de": {"der", "die", "das", "ein", "eine"},
+	"fr": {"le", "la", "les", "un", "une", "l'"},
+	"es": {"el", "la", "los", "las", "un", "una"},
+	"it": {"il", "lo", "la", "i", "gli", "le", "un", "una", "l'"},
+	"pt": {"o", "a", "os", "as", "um", "uma"},
+	"nl": {"de", "het", "een"},
+}
+
+func stripArticle(s, lang string) string {
+	return strings.TrimSpace(s[articleLen(s, lang):])
+}
+
+// articleLen returns the length in bytes of the leading article of the
+// lowercased s, including the space or apostrophe after it, or 0 when s has
+// none. A title that is only an article keeps it.
+func articleLen(s, lang string) int {
+	list, ok := articles[lang]
+	if !ok {
+		list = articles["en"]
+	}
+	for _, article := range list {
+		if prefix, elided := strings.CutSuffix(article, "'"); elided {
+			for _, apostrophe := range []string{"'", "’"} {
+				if rest, ok := strings.CutPrefix(s, prefix+apostrophe); ok && strings.TrimSpace(rest) != "" {
+					return len(s) - len(rest)
+				}
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(s, article+" "); ok && strings.TrimSpace(rest) != "" {
+			return len(s) - len(rest)
+		}
+	}
+	return 0
+}
+
+// Letters sorted after "z" in Scandinavian alphabets, spelled with the ASCII
+// characters that follow "z" so they keep their alphabet order.
+const (
+	afterZ1 = "{"
+	afterZ2 = "|"
+	afterZ3 = "}"
+)
+
+// letterFolds overrides the default accent folding for languages whose
+// alphabets treat some accented letters differently.
+var letterFolds = map[string]map[rune]string{
+	// DIN 5007-2: umlauts sort as their two-letter spellings.
+	"de": {'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss"},
+	"sv": {'å': afterZ1, 'ä': afterZ2, 'æ': afterZ2, 'ö': afterZ3, 'ø': afterZ3},
+	"fi": {'å': afterZ1, 'ä': afterZ2, 'æ': afterZ2, 'ö': afterZ3, 'ø': afterZ3},
+	"da": {'æ': afterZ1, 'ä': afterZ1, 'ø': afterZ2, 'ö': afterZ2, 'å': afterZ3},
+	"nb": {'æ': afterZ1, 'ä': afterZ1, 'ø': afterZ2, 'ö': afterZ2, 'å': afterZ3},
+	"nn": {'æ': afterZ1, 'ä': afterZ1, 'ø': afterZ2, 'ö': afterZ2, 'å': afterZ3},
+	"no": {'æ': afterZ1, 'ä': afterZ1, 'ø': afterZ2, 'ö': afterZ2, 'å': afterZ3},
+}
+
+// baseLetters maps accented lowercase Latin letters to their base letters.
+var baseLetters = func() map[rune]string {
+	groups := map[string]string{
+		"a":  "àáâãäåāăą",
+		"ae": "æ",
+		"c":  "çćĉċč",
+		"d":  "ďđð",
+		"e":  "èéêëēĕėęě",
+		"g":  "ĝğġģ",
+		"h":  "ĥħ",
+		"i":  "ìíîïĩīĭįı",
+		"j":  "ĵ",
+		"k":  "ķ",
+		"l":  "ĺļľŀł",
+		"n":  "ñńņňŉ",
+		"o":  "òóôõöøōŏő",
+		"oe": "œ",
+		"r":  "ŕŗř",
+		"s":  "śŝşšș",
+		"ss": "ß",
+		"t":  "ţťŧț",
+		"th": "þ",
+		"u":  "ùúûüũūŭůűų",
+		"w":  "ŵ",
+		"y":  "ýÿŷ",
+		"z":  "źżž",
+	}
+	m := make(map[rune]string)
+	for base, letters := range groups {
+		for _, r := range letters {
+			m[r] = base
+		}
+	}
+	return m
+}()
+
+// foldLetters replaces accented letters in lowercased s according to lang.
+func foldLetters(s, lang string) string {
+	overrides := letterFolds[lang]
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		if folded, ok := overrides[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		if folded, ok := baseLetters[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
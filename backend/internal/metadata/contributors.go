@@ -0,0 +1,240 @@
+package metadata
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// Name orders and separators of contributor credits. NameCredited and
+// SeparatorCredited keep credits as the metadata gives them.
+const (
+	NameCredited  = "credited"
+	NameFirstLast = "first_last"
+	NameLastFirst = "last_first"
+
+	SeparatorCredited  = "credited"
+	SeparatorComma     = "comma"
+	SeparatorAmpersand = "ampersand"
+)
+
+// ContributorFormat describes how a library displays and sorts author and
+// narrator credits naming several people.
+type ContributorFormat struct {
+	// Order is how each name is displayed: as credited, "Andy Weir" or
+	// "Weir, Andy".
+	Order string `json:"name_order"`
+	// Separator joins the names: as credited, ", " or " & ". Names that
+	// contain a comma, such as "Weir, Andy", are joined with "; " instead
+	// of ", ".
+	Separator string `json:"separator"`
+	// SortOrder is how the first author's name is filed: "Weir, Andy" or
+	// "Andy Weir".
+	SortOrder string `json:"sort_order"`
+}
+
+// DefaultContributorFormat is used by libraries without contributor
+// settings: credits are shown as given and authors file by last name.
+var DefaultContributorFormat = ContributorFormat{
+	Order:     NameCredited,
+	Separator: SeparatorCredited,
+	SortOrder: NameLastFirst,
+}
+
+// ContributorFormatFromSettings reads a library's contributor format from
+// its settings, falling back to DefaultContributorFormat for missing or
+// unknown values.
+func ContributorFormatFromSettings(settings models.LibrarySettings) ContributorFormat {
+	f := DefaultContributorFormat
+	switch order := settings.ContributorNameOrder; order {
+	case NameCredited, NameFirstLast, NameLastFirst:
+		f.Order = order
+	}
+	switch separator := settings.ContributorSeparator; separator {
+	case SeparatorCredited, SeparatorComma, SeparatorAmpersand:
+		f.Separator = separator
+	}
+	switch order := settings.ContributorSortOrder; order {
+	case NameFirstLast, NameLastFirst:
+		f.SortOrder = order
+	}
+	return f
+}
+
+// Format rewrites a credit such as "Andy Weir, Stephen King" in the
+// library's name order and separator. Credits are returned unchanged when
+// both are set to "credited".
+func (f ContributorFormat) Format(credits string) string {
+	if f.Order == NameCredited && f.Separator == SeparatorCredited {
+		return credits
+	}
+	contributors := splitContributors(credits)
+	if len(contributors) == 0 {
+		return credits
+	}
+
+	names := make([]string, len(contributors))
+	for i, c := range contributors {
+		switch f.Order {
+		case NameFirstLast:
+			names[i] = c.firstLast()
+		case NameLastFirst:
+			names[i] = c.lastFirst()
+		default:
+			names[i] = c.credit
+		}
+	}
+
+	separator := ", "
+	if f.Separator == SeparatorAmpersand {
+		separator = " & "
+	} else {
+		for _, name := range names {
+			// "Weir, Andy, King, Stephen" would not split back into two
+			// names.
+			if strings.Contains(name, ",") {
+				separator = "; "
+				break
+			}
+		}
+	}
+	return strings.Join(names, separator)
+}
+
+// SortAuthor returns the name a book files under for an author credit: the
+// first credited author in the library's sort order.
+func (f ContributorFormat) SortAuthor(author string) string {
+	contributors := splitContributors(author)
+	if len(contributors) == 0 {
+		return ""
+	}
+	if f.SortOrder == NameFirstLast {
+		return contributors[0].firstLast()
+	}
+	return contributors[0].lastFirst()
+}
+
+// contributor is one person named in a credit. Given is empty for single
+// names and ensembles such as "Full Cast".
+type contributor struct {
+	credit string
+	given  string
+	family string
+	suffix string
+}
+
+func (c contributor) firstLast() string {
+	if c.given == "" {
+		return c.credit
+	}
+	name := c.given + " " + c.family
+	if c.suffix != "" {
+		name += " " + c.suffix
+	}
+	return name
+}
+
+func (c contributor) lastFirst() string {
+	if c.given == "" {
+		return c.credit
+	}
+	name := c.family + ", " + c.given
+	if c.suffix != "" {
+		name += ", " + c.suffix
+	}
+	return name
+}
+
+// contributorSeparator splits credits on the separators that never appear
+// inside one name. Commas are split afterwards, since "Weir, Andy" is one
+// name written last name first.
+var contributorSeparator = regexp.MustCompile(`\s*(?:[;/]|\s&\s|\s+and\s+)\s*`)
+
+// ensembleCredits are credits naming no single person, which are never
+// reordered.
+var ensembleCredits = map[string]bool{
+	"full cast": true, "various": true, "various artists": true,
+	"various authors": true, "various narrators": true, "anonymous": true,
+	"unknown": true, "uncredited": true,
+}
+
+// splitContributors parses a credit into the people it names. A comma
+// after a last name, as in "Weir, Andy" or "Le Guin, Ursula K.", joins the
+// two parts into one inverted name; otherwise commas separate names.
+// Narrator annotations such as "Narrated by" and "(Narrator)" are dropped.
+func splitContributors(credits string) []contributor {
+	credits = narratorPrefix.ReplaceAllString(strings.TrimSpace(credits), "")
+	var contributors []contributor
+	for _, group := range contributorSeparator.Split(credits, -1) {
+		var parts []string
+		for _, part := range strings.Split(group, ",") {
+			part = narratorRole.ReplaceAllString(strings.Join(strings.Fields(part), " "), "")
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		for i := 0; i < len(parts); i++ {
+			part := parts[i]
+			last := len(contributors) - 1
+			switch {
+			case nameSuffixes[strings.ToLower(part)] && last >= 0 && contributors[last].given != "":
+				contributors[last].suffix = part
+				contributors[last].credit += ", " + part
+			case isFamilyName(part) && i+1 < len(parts) && !nameSuffixes[strings.ToLower(parts[i+1])]:
+				contributors = append(contributors, contributor{
+					credit: part + ", " + parts[i+1],
+					given:  parts[i+1],
+					family: part,
+				})
+				i++
+			default:
+				contributors = append(contributors, parseName(part))
+			}
+		}
+	}
+	return contributors
+}
+
+// isFamilyName reports whether part looks like a last name on its own: a
+// single word, or words led only by particles such as "Le Guin".
+func isFamilyName(part string) bool {
+	if ensembleCredits[strings.ToLower(part)] {
+		return false
+	}
+	words := strings.Fields(part)
+	for _, word := range words[:len(words)-1] {
+		if !nameParticles[strings.ToLower(word)] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseName splits a name written first name first, such as "Ursula K. Le
+// Guin" or "Martin Luther King Jr.", into its given names, last name and
+// suffix.
+func parseName(name string) contributor {
+	words := strings.Fields(name)
+	if len(words) < 2 || ensembleCredits[strings.ToLower(name)] {
+		return contributor{credit: name, family: name}
+	}
+
+	var suffix string
+	if last := words[len(words)-1]; nameSuffixes[strings.ToLower(last)] && len(words) > 2 {
+		suffix = last
+		words = words[:len(words)-1]
+	}
+
+	start := len(words) - 1
+	for start > 1 && nameParticles[strings.ToLower(words[start-1])] {
+		start--
+	}
+	return contributor{
+		credit: name,
+		given:  strings.Join(words[:start], " "),
+		family: strings.Join(words[start:], " "),
+		suffix: suffix,
+	}
+}
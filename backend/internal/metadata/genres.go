@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// Genre is a normalized genre name together with its lookup slug.
+type Genre struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// genreAliases maps the slug of a common variant to its canonical name.
+var genreAliases = map[string]string{
+	"sci-fi":      "Science Fiction",
+	"scifi":       "Science Fiction",
+	"sf":          "Science Fiction",
+	"ya":          "Young Adult",
+	"non-fiction": "Nonfiction",
+}
+
+// genreNoise lists category segments that carry no meaning on their own,
+// such as Google Books' "Fiction / Fantasy / General".
+var genreNoise = map[string]bool{
+	"general": true,
+	"other":   true,
+}
+
+// lowerWords stay lowercase inside a title-cased genre name.
+var lowerWords = map[string]bool{
+	"a": true, "an": true, "and": true, "of": true, "the": true,
+	"in": true, "on": true, "for": true, "to": true, "or": true,
+}
+
+// NormalizeGenres parses a raw provider genres value and returns the distinct
+// normalized genres in their original order. The value is usually a JSON
+// array, but comma or semicolon separated strings are accepted. Hierarchical
+// categories separated by "/" or ">" are split into their parts.
+func NormalizeGenres(raw string) []Genre {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+
+	var entries []string
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		entries = strings.FieldsFunc(raw, func(r rune) bool {
+			return r == ',' || r == ';'
+		})
+	}
+
+	seen := make(map[string]bool)
+	var genres []Genre
+	for _, entry := range entries {
+		parts := strings.FieldsFunc(entry, func(r rune) bool {
+			return r == '/' || r == '>' || r == '|'
+		})
+		for _, part := range parts {
+			genre, ok := NormalizeGenre(part)
+			if !ok || seen[genre.Slug] {
+				continue
+			}
+			seen[genre.Slug] = true
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+// NormalizeGenre cleans up a single genre name. It reports false for empty
+// or meaningless values.
+func NormalizeGenre(name string) (Genre, bool) {
+	name = strings.Join(strings.Fields(name), " ")
+	slug := GenreSlug(name)
+	if slug == "" || genreNoise[slug] {
+		return Genre{}, false
+	}
+	if alias, ok := genreAliases[slug]; ok {
+		return Genre{Name: alias, Slug: GenreSlug(alias)}, true
+	}
+	return Genre{Name: titleCase(name), Slug: slug}, true
+}
+
+// GenreSlug returns the lookup key for a genre name: lowercase words joined
+// by hyphens, with "&" spelled out.
+func GenreSlug(name string) string {
+	return slugify(name)
+}
+
+func titleCase(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		lower := strings.ToLower(word)
+		if i > 0 && lowerWords[lower] {
+			words[i] = lower
+			continue
+		}
+		// Keep acronyms such as "LGBTQ+" or "UK" as written.
+		if len(word) > 1 && strings.ToUpper(word) == word {
+			continue
+		}
+		words[i] = capitalizeParts(lower)
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalizeParts upper-cases the first letter of each hyphenated part, so
+// "self-help" becomes "Self-Help".
+func capitalizeParts(word string) string {
+	parts := strings.Split(word, "-")
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		parts[i] = string(runes)
+	}
+	return strings.Join(parts, "-")
+}
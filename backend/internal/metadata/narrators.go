@@ -0,0 +1,62 @@
+package metadata
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Narrator is a single normalized narrator credit.
+type Narrator struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// narratorSeparator splits joined credits such as "A, B & C" or "A and B".
+var narratorSeparator = regexp.MustCompile(`\s*(?:[,;/]|\s&\s|\s+and\s+)\s*`)
+
+// narratorRole strips role annotations such as "(Narrator)" or "- narrator".
+var narratorRole = regexp.MustCompile(`(?i)\s*(?:\((?:narrator|reader|narration)\)|-\s*(?:narrator|reader))\s*$`)
+
+// narratorPrefix strips leading credit words such as "Narrated by".
+var narratorPrefix = regexp.MustCompile(`(?i)^(?:narrated|read|performed)\s+by\s+`)
+
+// SplitNarrators parses a provider narrator string, which joins credits with
+// commas (Audible) or "&"/"and", and returns the distinct normalized
+// narrators in order.
+func SplitNarrators(raw string) []Narrator {
+	raw = narratorPrefix.ReplaceAllString(strings.TrimSpace(raw), "")
+	if raw == "" {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var narrators []Narrator
+	for _, part := range narratorSeparator.Split(raw, -1) {
+		narrator, ok := NormalizeNarrator(part)
+		if !ok || seen[narrator.Slug] {
+			continue
+		}
+		seen[narrator.Slug] = true
+		narrators = append(narrators, narrator)
+	}
+	return narrators
+}
+
+// NormalizeNarrator cleans up a single narrator name, collapsing whitespace
+// and removing role annotations. Names keep their original casing.
+func NormalizeNarrator(name string) (Narrator, bool) {
+	name = narratorPrefix.ReplaceAllString(strings.TrimSpace(name), "")
+	name = narratorRole.ReplaceAllString(name, "")
+	name = strings.Join(strings.Fields(name), " ")
+	slug := NarratorSlug(name)
+	if slug == "" {
+		return Narrator{}, false
+	}
+	return Narrator{Name: name, Slug: slug}, true
+}
+
+// NarratorSlug returns the lookup key for a narrator name, so "J.K. Smith"
+// and "j. k. smith" match.
+func NarratorSlug(name string) string {
+	return slugify(name)
+}
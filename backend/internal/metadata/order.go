@@ -0,0 +1,26 @@
+package metadata
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// MetadataOrderFromSettings reads a library's metadata order from its
+// settings, or nil when it resolves in models.DefaultMetadataOrder. Tiers
+// left out follow in their default order, and unknown tiers are ignored.
+func MetadataOrderFromSettings(settings models.LibrarySettings) []string {
+	if len(settings.MetadataOrder) == 0 {
+		return nil
+	}
+	order := make([]string, len(settings.MetadataOrder))
+	for i, tier := range settings.MetadataOrder {
+		order[i] = strings.ToLower(strings.TrimSpace(tier))
+	}
+	order = models.NormalizeMetadataOrder(order)
+	if slices.Equal(order, models.DefaultMetadataOrder) {
+		return nil
+	}
+	return order
+}
@@ -0,0 +1,30 @@
+package metadata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lore/backend/internal/models"
+)
+
+func TestMetadataOrderFromSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{"missing", nil, nil},
+		{"default order", []string{"agent", "sidecar", "embedded"}, nil},
+		{"only unknown tiers", []string{"parsed"}, nil},
+		{"partial", []string{" Embedded ", "agent"}, []string{"embedded", "agent", "sidecar"}},
+		{"single tier", []string{"sidecar"}, []string{"sidecar", "agent", "embedded"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := models.LibrarySettings{MetadataOrder: tt.order}
+			if got := MetadataOrderFromSettings(settings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MetadataOrderFromSettings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package metadata
+
+import (
+	"strings"
+	"unicode"
+)
+
+// slugify lowercases a name and joins its letter/digit runs with hyphens,
+// spelling out "&" so "Science Fiction & Fantasy" and "science fiction and
+// fantasy" share a key.
+func slugify(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, "&", " and "))
+
+	var b strings.Builder
+	pendingDash := false
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingDash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingDash = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingDash = true
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package metadata
+
+// nameParticles are lowercase words that belong to a surname when they
+// precede it, as in "Ursula K. Le Guin" or "Daphne du Maurier".
+var nameParticles = map[string]bool{
+	"da": true, "de": true, "del": true, "della": true, "den": true, "der": true,
+	"di": true, "du": true, "la": true, "le": true, "st": true, "st.": true,
+	"ten": true, "ter": true, "van": true, "von": true,
+}
+
+// nameSuffixes are generational and academic suffixes kept after the given
+// names, as in "King, Martin Luther, Jr.".
+var nameSuffixes = map[string]bool{
+	"jr": true, "jr.": true, "sr": true, "sr.": true, "ii": true, "iii": true,
+	"iv": true, "phd": true, "ph.d.": true, "md": true, "m.d.": true,
+}
+
+// SortAuthor returns the name a book files under for an author credit with
+// the default contributor format: the first credited author as "Last,
+// First", so "Andy Weir" becomes "Weir, Andy". Credits that are already
+// inverted or are a single name keep their first name as given.
+func SortAuthor(author string) string {
+	return DefaultContributorFormat.SortAuthor(author)
+}
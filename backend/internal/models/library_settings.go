@@ -0,0 +1,160 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LibrarySettings are the options an admin sets per library. They are
+// stored as a JSON object with the keys of the JSON tags; unset options
+// take their defaults.
+type LibrarySettings struct {
+	// AutoScanIntervalMinutes rescans the library when this many minutes
+	// have passed since its last scan; 0 leaves scans to admins.
+	AutoScanIntervalMinutes int `json:"auto_scan_interval_minutes,omitempty"`
+	// AudioExtensions are scanned as audio on top of the built-in
+	// formats, e.g. ["mka", ".dts"].
+	AudioExtensions []string `json:"audio_extensions,omitempty"`
+	// IgnorePatterns are globs for file and directory names scans skip,
+	// e.g. ["*sample*", "cover*"].
+	IgnorePatterns []string `json:"ignore_patterns,omitempty"`
+	// ProgressImportUserID names the user whose progress is seeded from
+	// sidecar files found by scans.
+	ProgressImportUserID string `json:"progress_import_user_id,omitempty"`
+
+	// AutoMatch links books found by scans to the best provider match
+	// when it agrees with their title and author.
+	AutoMatch bool `json:"auto_match,omitempty"`
+	// PreferredProvider is the provider auto-matching searches; empty
+	// searches all of them.
+	PreferredProvider string `json:"preferred_provider,omitempty"`
+	// MetadataOrder ranks the metadata tiers below custom values.
+	MetadataOrder []string `json:"metadata_order,omitempty"`
+	// ExportMetadataSidecar writes resolved metadata to metadata.json in
+	// each book's folder.
+	ExportMetadataSidecar bool `json:"export_metadata_sidecar,omitempty"`
+	// WriteTags allows writing resolved metadata into the library's
+	// audio files. It is off by default, as it rewrites files the library
+	// may share with other applications.
+	WriteTags bool `json:"write_tags,omitempty"`
+
+	// SortLocale is the language tag titles and names are sorted by.
+	SortLocale string `json:"sort_locale,omitempty"`
+	// SortIgnoreArticles drops leading articles when sorting; unset
+	// means true.
+	SortIgnoreArticles *bool `json:"sort_ignore_articles,omitempty"`
+	// Contributor credits: how names are displayed and joined, and how
+	// the first author is filed.
+	ContributorNameOrder string `json:"contributor_name_order,omitempty"`
+	ContributorSeparator string `json:"contributor_separator,omitempty"`
+	ContributorSortOrder string `json:"contributor_sort_order,omitempty"`
+}
+
+// ParseLibrarySettings decodes settings sent by a client, rejecting unknown
+// keys and values of the wrong type with a *SettingError. Empty or null
+// settings are the zero value.
+func ParseLibrarySettings(data []byte) (LibrarySettings, error) {
+	settings, invalid, err := decodeLibrarySettings(data)
+	if err != nil {
+		return LibrarySettings{}, &SettingError{Message: "settings must be a JSON object"}
+	}
+	if len(invalid) > 0 {
+		return LibrarySettings{}, invalid[0]
+	}
+	return settings, nil
+}
+
+// DecodeLibrarySettings decodes stored settings, dropping unknown keys and
+// values of the wrong type instead of failing; it returns the keys dropped.
+// Only data that is not a JSON object is an error.
+func DecodeLibrarySettings(data []byte) (LibrarySettings, []string, error) {
+	settings, invalid, err := decodeLibrarySettings(data)
+	if err != nil {
+		return LibrarySettings{}, nil, err
+	}
+	dropped := make([]string, len(invalid))
+	for i, e := range invalid {
+		dropped[i] = e.Key
+	}
+	return settings, dropped, nil
+}
+
+// SettingError describes a library setting that cannot be used.
+type SettingError struct {
+	Key     string
+	Message string
+}
+
+func (e *SettingError) Error() string {
+	if e.Key == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("settings.%s: %s", e.Key, e.Message)
+}
+
+// decodeLibrarySettings decodes settings one key at a time, so a bad value
+// only costs its own key. The keys that could not be decoded are returned
+// in order.
+func decodeLibrarySettings(data []byte) (LibrarySettings, []*SettingError, error) {
+	var settings LibrarySettings
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return settings, nil, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return settings, nil, err
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var invalid []*SettingError
+	for _, key := range keys {
+		single, err := json.Marshal(map[string]json.RawMessage{key: raw[key]})
+		if err != nil {
+			return settings, nil, err
+		}
+		// A value that fails part way, such as a list with one number, is
+		// decoded into a scratch copy so none of it is kept.
+		decoder := json.NewDecoder(bytes.NewReader(single))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&LibrarySettings{}); err != nil {
+			invalid = append(invalid, &SettingError{Key: key, Message: settingDecodeMessage(err)})
+			continue
+		}
+		if err := json.Unmarshal(single, &settings); err != nil {
+			return settings, nil, err
+		}
+	}
+	return settings, invalid, nil
+}
+
+// settingDecodeMessage explains why a setting could not be decoded.
+func settingDecodeMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		kind := typeErr.Type.Kind().String()
+		switch {
+		case kind == "slice":
+			kind = "list of " + typeErr.Type.Elem().Kind().String() + "s"
+		case kind == "ptr":
+			kind = typeErr.Type.Elem().Kind().String()
+		case strings.HasPrefix(kind, "int"):
+			kind = "whole number"
+		}
+		kind = strings.Replace(kind, "bool", "boolean", 1)
+		return "must be a " + kind
+	}
+	if strings.Contains(err.Error(), "unknown field") {
+		return "unknown setting"
+	}
+	return err.Error()
+}
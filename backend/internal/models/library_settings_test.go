@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLibrarySettings(t *testing.T) {
+	settings, err := ParseLibrarySettings([]byte(`{"auto_scan_interval_minutes": 15, "metadata_order": ["embedded"], "auto_match": true}`))
+	if err != nil {
+		t.Fatalf("ParseLibrarySettings returned error: %v", err)
+	}
+	want := LibrarySettings{AutoScanIntervalMinutes: 15, MetadataOrder: []string{"embedded"}, AutoMatch: true}
+	if !reflect.DeepEqual(settings, want) {
+		t.Fatalf("settings = %+v, want %+v", settings, want)
+	}
+
+	for _, empty := range []string{"", "null", "{}"} {
+		if settings, err := ParseLibrarySettings([]byte(empty)); err != nil || !reflect.DeepEqual(settings, LibrarySettings{}) {
+			t.Errorf("ParseLibrarySettings(%q) = %+v, %v; want the zero value", empty, settings, err)
+		}
+	}
+}
+
+func TestParseLibrarySettingsErrors(t *testing.T) {
+	tests := []struct {
+		data    string
+		key     string
+		message string
+	}{
+		{`[]`, "", "settings must be a JSON object"},
+		{`{"colour": "red"}`, "colour", "unknown setting"},
+		{`{"auto_match": "yes"}`, "auto_match", "must be a boolean"},
+		{`{"auto_scan_interval_minutes": 1.5}`, "auto_scan_interval_minutes", "must be a whole number"},
+		{`{"metadata_order": ["agent", 2]}`, "metadata_order", "must be a string"},
+		{`{"sort_ignore_articles": "no"}`, "sort_ignore_articles", "must be a boolean"},
+	}
+	for _, tt := range tests {
+		_, err := ParseLibrarySettings([]byte(tt.data))
+		var settingErr *SettingError
+		if !errors.As(err, &settingErr) {
+			t.Errorf("ParseLibrarySettings(%s) error = %v, want a *SettingError", tt.data, err)
+			continue
+		}
+		if settingErr.Key != tt.key || settingErr.Message != tt.message {
+			t.Errorf("ParseLibrarySettings(%s) error = %q, want key %q and message %q", tt.data, err, tt.key, tt.message)
+		}
+	}
+}
+
+func TestDecodeLibrarySettingsDropsBadKeys(t *testing.T) {
+	settings, dropped, err := DecodeLibrarySettings([]byte(`{"write_tags": true, "ignore_patterns": ["*.tmp", 3], "legacy": 1}`))
+	if err != nil {
+		t.Fatalf("DecodeLibrarySettings returned error: %v", err)
+	}
+	if want := (LibrarySettings{WriteTags: true}); !reflect.DeepEqual(settings, want) {
+		t.Errorf("settings = %+v, want %+v", settings, want)
+	}
+	if want := []string{"ignore_patterns", "legacy"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("dropped = %v, want %v", dropped, want)
+	}
+}
@@ -1,6 +1,13 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Audiobook represents a managed audiobook in the library.
 type Audiobook struct {
@@ -12,16 +19,224 @@ type Audiobook struct {
 	CreatedAt           time.Time           `json:"created_at"`
 	UpdatedAt           time.Time           `json:"updated_at"`
 	MediaFiles          []MediaFile         `json:"media_files,omitempty"`
+	SupplementFiles     []SupplementFile    `json:"supplement_files,omitempty"`
 	AgentMetadata       *AgentMetadata      `json:"agent_metadata,omitempty"`
 	EmbeddedMetadata    *EmbeddedMetadata   `json:"embedded_metadata,omitempty"`
+	SidecarMetadata     *SidecarMetadata    `json:"sidecar_metadata,omitempty"`
 	CustomMetadata      *CustomMetadata     `json:"custom_metadata,omitempty"`
 	UserData            *UserAudiobookData  `json:"user_data,omitempty"`
 	FileCount           int                 `json:"file_count,omitempty"`
 	TotalDurationSec    float64             `json:"total_duration_sec,omitempty"`
 
+	// Editions of the same work, e.g. abridged and unabridged or another
+	// narrator. Set on book detail for books linked into a work.
+	WorkID              *string             `json:"work_id,omitempty"`
+	Editions            []Edition           `json:"editions,omitempty"`
+
+	// Values of admin-defined custom fields by key, typed by the field.
+	// Set on book detail.
+	CustomFields        map[string]interface{} `json:"custom_fields,omitempty"`
+
+	// Users' star ratings of the book. Set on book detail.
+	UserRatings         *RatingSummary      `json:"user_ratings,omitempty"`
+
+	// Other users listening to or having finished the book, for users who
+	// share their listening. Set on book detail.
+	AlsoListenedBy      []Listener          `json:"also_listened_by,omitempty"`
+
+	// When a scan found the book's folder gone from disk; nil while it is
+	// there. Missing books are left out of listings. Set on book detail.
+	MissingSince        *time.Time          `json:"missing_since,omitempty"`
+
+	// Placeholder for an uploaded cover, for clients to show while it loads.
+	CoverBlurhash       *string             `json:"cover_blurhash,omitempty"`
+	CoverColor          *string             `json:"cover_color,omitempty"`
+
+	// Resolved display metadata, emitted in place of Metadata for clients
+	// that opted out of the legacy response shape.
+	ResolvedMetadata    *AgentMetadata      `json:"resolved_metadata,omitempty"`
+
+	// Order of the metadata tiers below custom values, from the library's
+	// metadata_order setting; empty resolves in DefaultMetadataOrder.
+	MetadataOrder       []string            `json:"-"`
+
 	// Backward compatibility - populated from AgentMetadata
 	Metadata            *BookMetadata       `json:"metadata,omitempty"`
 	MetadataID          *string             `json:"metadata_id,omitempty"`
+
+	// lite encodes the audiobook as a LiteAudiobook; see SetLite.
+	lite bool
+}
+
+// DropLegacyFields moves the backward compatible fields onto their layered
+// equivalents so the payload carries each value only once.
+func (a *Audiobook) DropLegacyFields() {
+	if a == nil {
+		return
+	}
+	if a.AgentMetadataID == nil {
+		a.AgentMetadataID = a.MetadataID
+	}
+	if a.ResolvedMetadata == nil {
+		a.ResolvedMetadata = a.Metadata
+	}
+	a.Metadata = nil
+	a.MetadataID = nil
+}
+
+// Edition is another audiobook of the same work, with the user's progress
+// in it; progress is kept per edition.
+type Edition struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Subtitle    *string  `json:"subtitle,omitempty"`
+	Narrator    *string  `json:"narrator,omitempty"`
+	DurationSec float64  `json:"duration_sec,omitempty"`
+	ProgressSec float64  `json:"progress_sec,omitempty"`
+	ProgressPct *float64 `json:"progress_pct,omitempty"`
+}
+
+// Review is a user's star rating of an audiobook, with optional text.
+type Review struct {
+	UserID      string    `json:"user_id"`
+	AudiobookID string    `json:"audiobook_id"`
+	Rating      float64   `json:"rating"`
+	Review      *string   `json:"review,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Bookmark marks a position in an audiobook for a user.
+type Bookmark struct {
+	ID          string    `json:"id"`
+	AudiobookID string    `json:"audiobook_id"`
+	PositionSec float64   `json:"position_sec"`
+	Title       string    `json:"title"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Rating bounds. Ratings go in half-star steps.
+const (
+	MinRating = 0.5
+	MaxRating = 5.0
+)
+
+// RatingSummary is the average of users' ratings of an audiobook.
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// Listener states.
+const (
+	ListenerListening = "listening"
+	ListenerFinished  = "finished"
+)
+
+// Listener is another user who started a book, with whether they are
+// listening to it or finished it but not how far they got.
+type Listener struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+// LiteAudiobook is the compact form of an audiobook for e-ink readers,
+// scripts and slow connections: display fields and the user's progress,
+// without metadata layers, media files or timestamps.
+type LiteAudiobook struct {
+	ID             string   `json:"id"`
+	LibraryID      *string  `json:"library_id,omitempty"`
+	Title          string   `json:"title"`
+	Author         string   `json:"author,omitempty"`
+	Narrator       *string  `json:"narrator,omitempty"`
+	SeriesName     *string  `json:"series_name,omitempty"`
+	SeriesSequence *string  `json:"series_sequence,omitempty"`
+	CoverURL       *string  `json:"cover_url,omitempty"`
+	DurationSec    float64  `json:"duration_sec,omitempty"`
+	ProgressSec    float64  `json:"progress_sec,omitempty"`
+	ProgressPct    *float64 `json:"progress_pct,omitempty"`
+	IsFavorite     bool     `json:"is_favorite,omitempty"`
+}
+
+// Lite returns the compact form of the audiobook.
+func (a *Audiobook) Lite() LiteAudiobook {
+	metadata := a.ResolvedMetadata
+	if metadata == nil {
+		metadata = a.ResolveMetadata()
+	}
+	lite := LiteAudiobook{
+		ID:             a.ID,
+		LibraryID:      a.LibraryID,
+		Title:          metadata.Title,
+		Author:         metadata.Author,
+		Narrator:       metadata.Narrator,
+		SeriesName:     metadata.SeriesName,
+		SeriesSequence: metadata.SeriesSequence,
+		CoverURL:       ProxyCoverURL(a.ID, metadata.CoverURL),
+		DurationSec:    a.PlaybackDuration(),
+	}
+	if a.UserData != nil {
+		lite.ProgressSec = a.UserData.ProgressSec
+		lite.ProgressPct = a.UserData.ProgressPct
+		lite.IsFavorite = a.UserData.IsFavorite
+	}
+	return lite
+}
+
+// SetLite makes the audiobook encode as its LiteAudiobook form, so handlers
+// can keep passing Audiobook values around while answering in lite mode.
+func (a *Audiobook) SetLite() {
+	if a != nil {
+		a.lite = true
+	}
+}
+
+// MarshalJSON encodes the audiobook, in its compact form after SetLite. A
+// remote cover in the resolved metadata is linked through the server, see
+// ProxyCoverURL; the metadata layers keep their URLs as stored.
+func (a Audiobook) MarshalJSON() ([]byte, error) {
+	if a.lite {
+		return json.Marshal(a.Lite())
+	}
+	a.Metadata = a.Metadata.withProxiedCover(a.ID)
+	a.ResolvedMetadata = a.ResolvedMetadata.withProxiedCover(a.ID)
+	type audiobook Audiobook
+	return json.Marshal(audiobook(a))
+}
+
+// CoverURL is the API path serving an audiobook's cover: an uploaded image,
+// or a cached copy of a remote one.
+func CoverURL(audiobookID string) string {
+	return "/api/v1/library/" + audiobookID + "/cover"
+}
+
+// IsRemoteURL reports whether coverURL points at another host rather than
+// at this server.
+func IsRemoteURL(coverURL string) bool {
+	return strings.HasPrefix(coverURL, "http://") || strings.HasPrefix(coverURL, "https://")
+}
+
+// ProxyCoverURL returns the audiobook's CoverURL in place of a remote cover
+// URL, so clients load the image from the server instead of a provider CDN.
+// Other values are returned unchanged.
+func ProxyCoverURL(audiobookID string, coverURL *string) *string {
+	if coverURL == nil || !IsRemoteURL(*coverURL) {
+		return coverURL
+	}
+	proxied := CoverURL(audiobookID)
+	return &proxied
+}
+
+// withProxiedCover returns m, or a copy of it whose remote cover goes
+// through the server.
+func (m *AgentMetadata) withProxiedCover(audiobookID string) *AgentMetadata {
+	if m == nil || m.CoverURL == nil || !IsRemoteURL(*m.CoverURL) {
+		return m
+	}
+	proxied := *m
+	proxied.CoverURL = ProxyCoverURL(audiobookID, m.CoverURL)
+	return &proxied
 }
 
 // Library represents a named collection of audiobooks.
@@ -31,7 +246,8 @@ type Library struct {
 	DisplayName string                 `json:"display_name"`
 	Type        string                 `json:"type"`
 	Description *string                `json:"description,omitempty"`
-	Settings    map[string]interface{} `json:"settings,omitempty"`
+	Settings    LibrarySettings        `json:"settings"`
+	Restricted  bool                   `json:"restricted"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
 
@@ -70,6 +286,160 @@ type MediaFile struct {
 	Filename    string  `json:"filename"`
 	DurationSec float64 `json:"duration_sec"`
 	MimeType    string  `json:"mime_type"`
+
+	// ExtensionMimeType is set when content sniffing disagreed with the
+	// file extension; it holds the type the extension implied.
+	ExtensionMimeType *string `json:"extension_mime_type,omitempty"`
+
+	// SortIndex is the file's place in a track order set by an admin.
+	// Files without one follow in natural filename order.
+	SortIndex *int `json:"sort_index,omitempty"`
+}
+
+// SupplementFile is a companion file in an audiobook's folder, such as
+// cover art, a description, a cue sheet or a PDF booklet.
+type SupplementFile struct {
+	ID          string `json:"id"`
+	AudiobookID string `json:"audiobook_id"`
+	// Filename is relative to the audiobook's asset path.
+	Filename  string `json:"filename"`
+	Kind      string `json:"kind"`
+	MimeType  string `json:"mime_type"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// MimeMismatch reports a media file whose content type differs from the type
+// its extension implies.
+type MimeMismatch struct {
+	MediaFileID       string `json:"media_file_id"`
+	AudiobookID       string `json:"audiobook_id"`
+	Filename          string `json:"filename"`
+	MimeType          string `json:"mime_type"`
+	ExtensionMimeType string `json:"extension_mime_type"`
+}
+
+// AudiobookFilter narrows audiobook listings and searches.
+type AudiobookFilter struct {
+	// Genre matches a normalized genre slug or name.
+	Genre string
+	// CustomFields match values of custom fields.
+	CustomFields []CustomFieldFilter
+	// Narrator matches a single narrator credit by slug or name.
+	Narrator string
+	// Series matches the resolved series name, ignoring case.
+	Series string
+	// NoSeries keeps only books outside any series. It is set by the
+	// server, never from request parameters.
+	NoSeries bool
+	// Sort orders results; the default is most recently played first.
+	Sort string
+	// IDs restricts results to these audiobooks. It is set by the server to
+	// load books it picked, never from request parameters.
+	IDs []string
+	// After keeps only books past this position in SortRecentlyAdded
+	// order, for cursor pagination. Count queries ignore it.
+	After BookCursor
+}
+
+// BookCursor is a position in a list of audiobooks sorted by when they were
+// added, newest first: the last book of the previous page.
+type BookCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// IsZero reports whether the cursor is unset, meaning the first page.
+func (c BookCursor) IsZero() bool {
+	return c.ID == ""
+}
+
+// CustomFieldFilter matches books by the value of a custom field: equal to
+// Value, or at least or at most Value for number and date fields. Values
+// are normalized like stored ones.
+type CustomFieldFilter struct {
+	Key   string
+	Type  string
+	Op    string
+	Value string
+}
+
+// CustomFieldFilter operators.
+const (
+	FilterEqual   = "eq"
+	FilterAtLeast = "min"
+	FilterAtMost  = "max"
+)
+
+// AudiobookFilter sort orders. Title and author follow the library's
+// collation (see metadata.Collation); rating puts the user's highest rated
+// books first and unrated ones last; series groups books by series name in
+// sequence order, with books outside a series last.
+const (
+	SortRecentlyAdded = "added"
+	SortTitle         = "title"
+	SortAuthor        = "author"
+	SortRating        = "rating"
+	SortSeries        = "series"
+)
+
+// AudiobookSortOrders lists the accepted AudiobookFilter sort orders.
+var AudiobookSortOrders = []string{SortRecentlyAdded, SortTitle, SortAuthor, SortRating, SortSeries}
+
+// SeriesCount is a series with the number of visible audiobooks in it and
+// the first of them in sequence order, whose cover stands for the series.
+type SeriesCount struct {
+	Name             string  `json:"name"`
+	BookCount        int     `json:"book_count"`
+	CoverAudiobookID string  `json:"cover_audiobook_id"`
+	CoverURL         *string `json:"cover_url,omitempty"`
+}
+
+// BrowseNode is an entry in the browse tree for car head units: a folder
+// to open, a book to play or a chapter to start a book from.
+type BrowseNode struct {
+	ID          string   `json:"id"`
+	Kind        string   `json:"kind"`
+	Title       string   `json:"title"`
+	Subtitle    string   `json:"subtitle,omitempty"`
+	ImageURL    string   `json:"image_url,omitempty"`
+	Browsable   bool     `json:"browsable"`
+	Playable    bool     `json:"playable"`
+	ChildCount  int      `json:"child_count,omitempty"`
+	AudiobookID string   `json:"audiobook_id,omitempty"`
+	MediaFileID string   `json:"media_file_id,omitempty"`
+	StartSec    float64  `json:"start_sec,omitempty"`
+	DurationSec float64  `json:"duration_sec,omitempty"`
+	ProgressPct *float64 `json:"progress_pct,omitempty"`
+}
+
+// BrowseNode kinds.
+const (
+	BrowseFolder  = "folder"
+	BrowseBook    = "book"
+	BrowseChapter = "chapter"
+)
+
+// GenreCount is a browsable genre with the number of visible audiobooks.
+type GenreCount struct {
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	BookCount int    `json:"book_count"`
+}
+
+// NarratorCount is a browsable narrator with the number of visible audiobooks.
+type NarratorCount struct {
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	BookCount int    `json:"book_count"`
+}
+
+// LetterCount is an entry of a library's A–Z index: a letter ("#" for
+// digits) with the number of visible audiobooks filed under it and the
+// listing offset of the first of them.
+type LetterCount struct {
+	Letter    string `json:"letter"`
+	BookCount int    `json:"book_count"`
+	Offset    int    `json:"offset"`
 }
 
 // AgentMetadata represents metadata from external providers (can be shared across audiobooks)
@@ -96,6 +466,32 @@ type AgentMetadata struct {
 	ExternalID     *string   `json:"external_id,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Identifiers lists every ASIN/ISBN known for this book across regions
+	// and editions.
+	Identifiers []MetadataIdentifier `json:"identifiers,omitempty"`
+
+	// SortTitle and SortAuthor are what the book files under in title and
+	// author order, e.g. "Martian" and "Weir, Andy". They are only set on
+	// resolved metadata: from a custom override, or generated from the
+	// title and author.
+	SortTitle  string `json:"sort_title,omitempty"`
+	SortAuthor string `json:"sort_author,omitempty"`
+}
+
+// MetadataIdentifier is an ASIN or ISBN that refers to an agent metadata record
+type MetadataIdentifier struct {
+	Type   string  `json:"type"` // "asin" or "isbn"
+	Value  string  `json:"value"`
+	Region *string `json:"region,omitempty"`
+}
+
+// DuplicateGroup lists audiobooks that resolve to the same book
+type DuplicateGroup struct {
+	MetadataID   string               `json:"metadata_id"`
+	Title        string               `json:"title"`
+	AudiobookIDs []string             `json:"audiobook_ids"`
+	Identifiers  []MetadataIdentifier `json:"identifiers,omitempty"`
 }
 
 // EmbeddedMetadata represents metadata extracted from file tags (1:1 with audiobook)
@@ -117,12 +513,52 @@ type EmbeddedMetadata struct {
 	ExtractedAt    time.Time `json:"extracted_at"`
 }
 
+// SidecarMetadata represents metadata read from files other library managers
+// leave in an audiobook's folder, such as metadata.json or book.nfo (1:1 with
+// audiobook)
+type SidecarMetadata struct {
+	AudiobookID    string    `json:"audiobook_id"`
+	Sources        []string  `json:"sources"` // files read, in order of precedence
+	Title          *string   `json:"title,omitempty"`
+	Subtitle       *string   `json:"subtitle,omitempty"`
+	Author         *string   `json:"author,omitempty"`
+	Narrator       *string   `json:"narrator,omitempty"`
+	Description    *string   `json:"description,omitempty"`
+	SeriesName     *string   `json:"series_name,omitempty"`
+	SeriesSequence *string   `json:"series_sequence,omitempty"`
+	ReleaseDate    *string   `json:"release_date,omitempty"`
+	ISBN           *string   `json:"isbn,omitempty"`
+	ASIN           *string   `json:"asin,omitempty"`
+	Language       *string   `json:"language,omitempty"`
+	Publisher      *string   `json:"publisher,omitempty"`
+	Genres         *string   `json:"genres,omitempty"` // JSON array
+	ReadAt         time.Time `json:"read_at"`
+}
+
+// Lock modes for custom metadata fields.
+const (
+	LockModeUnlocked = "unlocked" // uses cascade: agent → file → parsed
+	LockModeValue    = "value"    // locked to the custom value
+	LockModeBlank    = "blank"    // locked to empty (overrides cascade)
+	LockModeAgent    = "agent"    // pinned to the agent value, no fallback
+)
+
+// CustomMetadataFields lists the fields that accept custom overrides.
+var CustomMetadataFields = []string{
+	"title", "subtitle", "author", "narrator", "description", "cover_url",
+	"series_name", "series_sequence", "release_date", "isbn", "asin",
+	"language", "publisher", "genres", "sort_title", "sort_author",
+}
+
 // CustomMetadata represents user manual edits (1:1 with audiobook)
 // Stored in audiobook_metadata_custom table with explicit columns
-// Each field has a corresponding locked flag:
-// - locked=true, value="foo" → locked to "foo"
-// - locked=true, value=nil → locked to empty (overrides cascade)
-// - locked=false → unlocked (uses cascade: agent → file → parsed)
+// Each field has a lock mode (see LockMode*):
+// - value, value="foo" → locked to "foo"
+// - blank → locked to empty (overrides cascade)
+// - agent → follows the agent value only
+// - unlocked → uses cascade: agent → file → parsed
+//
+// Locks is kept for older clients and is true for value and blank locks.
 type CustomMetadata struct {
 	AudiobookID    string             `json:"audiobook_id"`
 	Title          *string            `json:"title,omitempty"`
@@ -139,11 +575,107 @@ type CustomMetadata struct {
 	Language       *string            `json:"language,omitempty"`
 	Publisher      *string            `json:"publisher,omitempty"`
 	Genres         *string            `json:"genres,omitempty"`
+	SortTitle      *string            `json:"sort_title,omitempty"`
+	SortAuthor     *string            `json:"sort_author,omitempty"`
 	Locks          map[string]bool    `json:"locks,omitempty"` // Map of field name -> locked flag
+	LockModes      map[string]string  `json:"lock_modes,omitempty"` // Map of field name -> lock mode
 	UpdatedAt      time.Time          `json:"updated_at"`
 	UpdatedBy      *string            `json:"updated_by,omitempty"`
 }
 
+// LockMode returns the lock mode of a field. Records without explicit modes
+// fall back to the Locks map, treating a locked field without a value as
+// locked to blank.
+func (c *CustomMetadata) LockMode(field string) string {
+	if c == nil {
+		return LockModeUnlocked
+	}
+	if mode, ok := c.LockModes[field]; ok {
+		return mode
+	}
+	if !c.Locks[field] {
+		return LockModeUnlocked
+	}
+	if value := c.FieldValue(field); value != nil && *value != "" {
+		return LockModeValue
+	}
+	return LockModeBlank
+}
+
+// SetLockMode records the lock mode of a field and keeps Locks in sync.
+func (c *CustomMetadata) SetLockMode(field, mode string) {
+	if c.LockModes == nil {
+		c.LockModes = make(map[string]string)
+	}
+	if c.Locks == nil {
+		c.Locks = make(map[string]bool)
+	}
+
+	if mode == LockModeUnlocked {
+		delete(c.LockModes, field)
+	} else {
+		c.LockModes[field] = mode
+	}
+	if mode == LockModeValue || mode == LockModeBlank {
+		c.Locks[field] = true
+	} else {
+		delete(c.Locks, field)
+	}
+}
+
+// FieldValue returns a pointer to the custom value for a field name.
+func (c *CustomMetadata) FieldValue(field string) *string {
+	if ptr := c.fieldPtr(field); ptr != nil {
+		return *ptr
+	}
+	return nil
+}
+
+// SetFieldValue stores the custom value for a field name.
+func (c *CustomMetadata) SetFieldValue(field string, value *string) {
+	if ptr := c.fieldPtr(field); ptr != nil {
+		*ptr = value
+	}
+}
+
+func (c *CustomMetadata) fieldPtr(field string) **string {
+	switch field {
+	case "title":
+		return &c.Title
+	case "subtitle":
+		return &c.Subtitle
+	case "author":
+		return &c.Author
+	case "narrator":
+		return &c.Narrator
+	case "description":
+		return &c.Description
+	case "cover_url":
+		return &c.CoverURL
+	case "series_name":
+		return &c.SeriesName
+	case "series_sequence":
+		return &c.SeriesSequence
+	case "release_date":
+		return &c.ReleaseDate
+	case "isbn":
+		return &c.ISBN
+	case "asin":
+		return &c.ASIN
+	case "language":
+		return &c.Language
+	case "publisher":
+		return &c.Publisher
+	case "genres":
+		return &c.Genres
+	case "sort_title":
+		return &c.SortTitle
+	case "sort_author":
+		return &c.SortAuthor
+	}
+	return nil
+}
+
 // BookMetadata is an alias for AgentMetadata for backward compatibility
 type BookMetadata = AgentMetadata
 
@@ -155,6 +687,609 @@ type User struct {
 	IsAdmin      bool      `json:"is_admin"`
 	APIKey       *string   `json:"api_key,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+	// Disabled accounts cannot sign in but keep their listening history.
+	Disabled   bool       `json:"disabled"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// Self-registered accounts awaiting approval cannot sign in yet.
+	PendingApproval   bool       `json:"pending_approval"`
+	PendingApprovalAt *time.Time `json:"pending_approval_at,omitempty"`
+}
+
+// Sort orders a listing by one of its sortable fields.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// UserFilter narrows and orders the admin user listing.
+type UserFilter struct {
+	// Role is RoleAdmin or RoleUser; empty matches both.
+	Role string
+	// Disabled, when set, matches only disabled or only active accounts.
+	Disabled *bool
+	// Pending, when set, matches only accounts awaiting approval or only
+	// approved ones.
+	Pending        *bool
+	UsernamePrefix string
+	Sort           Sort
+}
+
+// UserSortFields lists the fields the user listing can be sorted by.
+var UserSortFields = []string{"created_at", "username", "role"}
+
+// UserDataTransfer reports what was moved from one account to another.
+type UserDataTransfer struct {
+	FromUserID   string `json:"from_user_id"`
+	ToUserID     string `json:"to_user_id"`
+	Audiobooks   int    `json:"audiobooks"`
+	AccessGrants int    `json:"access_grants"`
+}
+
+// Invite lets a new user create an account, as a member of the given
+// libraries.
+type Invite struct {
+	ID         string     `json:"id"`
+	Token      string     `json:"token"`
+	LibraryIDs []string   `json:"library_ids"`
+	CreatedBy  *string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedBy     *string    `json:"used_by,omitempty"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+}
+
+// Access token scopes: what a token may open in place of the API key.
+const (
+	// TokenScopeFeed opens the owner's feeds with their covers and episodes.
+	TokenScopeFeed = "feed"
+	// TokenScopeShare opens one audiobook's podcast feed, cover and episodes.
+	TokenScopeShare = "share"
+	// TokenScopeStream streams media files, of one audiobook when it is set.
+	TokenScopeStream = "stream"
+	// TokenScopeCatalog opens a read-only catalog of one library, without
+	// streaming. Only admins issue them.
+	TokenScopeCatalog = "catalog"
+)
+
+// AccessTokenScopes lists the valid access token scopes.
+var AccessTokenScopes = []string{TokenScopeFeed, TokenScopeShare, TokenScopeStream, TokenScopeCatalog}
+
+// AccessToken authenticates URLs that cannot carry the API key on behalf of
+// its owner, limited to its scope. Token is only returned when the token is
+// issued; the owner's default feed token is also readable through the feed
+// token endpoint.
+type AccessToken struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Token       string     `json:"token,omitempty"`
+	Scope       string     `json:"scope"`
+	AudiobookID *string    `json:"audiobook_id,omitempty"`
+	LibraryID   *string    `json:"library_id,omitempty"`
+	Name        string     `json:"name"`
+	IsDefault   bool       `json:"is_default"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// AccessTokenRequest asks for a new access token. A nil ExpiresAt never
+// lapses.
+type AccessTokenRequest struct {
+	Name        string     `json:"name"`
+	Scope       string     `json:"scope"`
+	AudiobookID *string    `json:"audiobook_id"`
+	LibraryID   *string    `json:"library_id"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// Catalog is the read-only view of a library opened by a catalog token:
+// what the library holds, with nothing to play or download.
+type Catalog struct {
+	LibraryID string        `json:"library_id"`
+	Name      string        `json:"name"`
+	Books     []CatalogBook `json:"books"`
+}
+
+// CatalogBook is an audiobook as listed in a Catalog.
+type CatalogBook struct {
+	ID             string  `json:"id"`
+	Title          string  `json:"title"`
+	Author         string  `json:"author,omitempty"`
+	Narrator       string  `json:"narrator,omitempty"`
+	SeriesName     string  `json:"series_name,omitempty"`
+	SeriesSequence string  `json:"series_sequence,omitempty"`
+	CoverURL       *string `json:"cover_url,omitempty"`
+}
+
+// Access token audit events.
+const (
+	TokenEventIssued  = "issued"
+	TokenEventRevoked = "revoked"
+	TokenEventRefused = "refused"
+)
+
+// AccessTokenEvent is an entry in the access token audit trail. ActorID is
+// who issued or revoked the token; refused uses record why in Detail.
+type AccessTokenEvent struct {
+	ID        int64     `json:"id"`
+	TokenID   string    `json:"token_id"`
+	UserID    string    `json:"user_id"`
+	ActorID   *string   `json:"actor_id,omitempty"`
+	Event     string    `json:"event"`
+	Detail    *string   `json:"detail,omitempty"`
+	IP        *string   `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RegistrationSettings controls who can create an account without an invite
+// and what new accounts start with.
+type RegistrationSettings struct {
+	// Open allows sign-ups without an invite.
+	Open bool `json:"open"`
+	// RequireApproval holds sign-ups without an invite until an admin
+	// approves them.
+	RequireApproval bool `json:"require_approval"`
+	// DefaultRole is RoleAdmin or RoleUser, for sign-ups waiting for
+	// approval. RoleAdmin requires RequireApproval.
+	DefaultRole string `json:"default_role"`
+	// LibraryIDs are libraries every new account joins, in addition to
+	// those of its invite.
+	LibraryIDs []string   `json:"library_ids"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// NotificationSettings holds where a user is notified and which events they
+// want. Only admins currently receive library events.
+type NotificationSettings struct {
+	UserID          string     `json:"user_id"`
+	Email           *string    `json:"email,omitempty"`
+	WebhookURL      *string    `json:"webhook_url,omitempty"`
+	ImportCompleted bool       `json:"import_completed"`
+	ImportFailed    bool       `json:"import_failed"`
+	ScanMissing     bool       `json:"scan_missing_files"`
+	// StorageWarnings covers disks running out of space and libraries whose
+	// scans keep failing.
+	StorageWarnings bool       `json:"storage_warnings"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// Custom field types.
+const (
+	CustomFieldText    = "text"
+	CustomFieldNumber  = "number"
+	CustomFieldDate    = "date"
+	CustomFieldBoolean = "boolean"
+)
+
+// CustomFieldTypes lists the accepted custom field types.
+var CustomFieldTypes = []string{CustomFieldText, CustomFieldNumber, CustomFieldDate, CustomFieldBoolean}
+
+// CustomField is an admin-defined audiobook field such as "Purchase date".
+// Key names the field in requests and responses and never changes.
+type CustomField struct {
+	Key       string    `json:"key"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Normalize converts a value given for the field, as a JSON value or a
+// query string, to its stored form.
+func (f CustomField) Normalize(value interface{}) (string, error) {
+	raw, isString := value.(string)
+	raw = strings.TrimSpace(raw)
+	switch f.Type {
+	case CustomFieldNumber:
+		if n, ok := value.(float64); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64), nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if !isString || err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return "", fmt.Errorf("%s must be a number", f.Key)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case CustomFieldDate:
+		date, err := time.Parse("2006-01-02", raw)
+		if !isString || err != nil {
+			return "", fmt.Errorf("%s must be a date (YYYY-MM-DD)", f.Key)
+		}
+		return date.Format("2006-01-02"), nil
+	case CustomFieldBoolean:
+		if b, ok := value.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if !isString || err != nil {
+			return "", fmt.Errorf("%s must be true or false", f.Key)
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		if !isString || raw == "" {
+			return "", fmt.Errorf("%s must be a non-empty string", f.Key)
+		}
+		return raw, nil
+	}
+}
+
+// Decode converts a stored value to the JSON value of the field's type.
+func (f CustomField) Decode(stored string) interface{} {
+	switch f.Type {
+	case CustomFieldNumber:
+		if n, err := strconv.ParseFloat(stored, 64); err == nil {
+			return n
+		}
+	case CustomFieldBoolean:
+		if b, err := strconv.ParseBool(stored); err == nil {
+			return b
+		}
+	}
+	return stored
+}
+
+// Webhook is an admin-registered URL that receives signed library events.
+type Webhook struct {
+	ID             string     `json:"id"`
+	URL            string     `json:"url"`
+	Secret         string     `json:"secret"`
+	Events         []string   `json:"events"`
+	Enabled        bool       `json:"enabled"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+}
+
+// MetadataAgent is an external metadata provider speaking the generic JSON
+// agent contract, searchable under Name like the built-in providers.
+type MetadataAgent struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	APIKey    string    `json:"-"`
+	HasAPIKey bool      `json:"has_api_key"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Audiobook access principal types.
+const (
+	AccessPrincipalUser = "user"
+	AccessPrincipalRole = "role"
+)
+
+// User roles that audiobook access rules can target.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// LibraryAccess lists who may see a library's audiobooks. Everyone may
+// unless the library is restricted; then only admins and its members may.
+type LibraryAccess struct {
+	LibraryID  string   `json:"library_id"`
+	Restricted bool     `json:"restricted"`
+	UserIDs    []string `json:"user_ids"`
+}
+
+// AudiobookAccessRule grants a user or role access to a restricted audiobook.
+// Audiobooks without rules are visible to everyone with library access.
+type AudiobookAccessRule struct {
+	AudiobookID   string    `json:"audiobook_id"`
+	PrincipalType string    `json:"principal_type"`
+	PrincipalID   string    `json:"principal_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Download kinds recorded in the audit trail.
+const (
+	DownloadKindMedia      = "media"
+	DownloadKindZip        = "zip"
+	DownloadKindSupplement = "supplement"
+	DownloadKindStream     = "stream"
+)
+
+// DownloadRecord is a single entry in the download audit trail.
+type DownloadRecord struct {
+	ID          string    `json:"id"`
+	UserID      *string   `json:"user_id,omitempty"`
+	Username    string    `json:"username"`
+	AudiobookID *string   `json:"audiobook_id,omitempty"`
+	MediaFileID *string   `json:"media_file_id,omitempty"`
+	Kind        string    `json:"kind"`
+	Bytes       int64     `json:"bytes"`
+	StatusCode  int       `json:"status_code"`
+	RemoteAddr  *string   `json:"remote_addr,omitempty"`
+	UserAgent   *string   `json:"user_agent,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// LastAt is when the last range request merged into the entry arrived.
+	LastAt *time.Time `json:"last_at,omitempty"`
+}
+
+// DownloadUserSummary aggregates download egress for a single user.
+type DownloadUserSummary struct {
+	UserID         *string    `json:"user_id,omitempty"`
+	Username       string     `json:"username"`
+	Downloads      int        `json:"downloads"`
+	Bytes          int64      `json:"bytes"`
+	LastDownloadAt *time.Time `json:"last_download_at,omitempty"`
+}
+
+// DownloadFilter narrows download audit queries.
+type DownloadFilter struct {
+	UserID *string
+	Since  *time.Time
+	Until  *time.Time
+	Sort   Sort
+}
+
+// DownloadSortFields lists the fields download audit entries can be sorted by.
+var DownloadSortFields = []string{"created_at", "bytes", "username"}
+
+// Activity types recorded in library activity feeds.
+const (
+	ActivityBookAdded       = "book.added"
+	ActivityBookFinished    = "book.finished"
+	ActivityMetadataUpdated = "metadata.updated"
+)
+
+// ActivityTypes lists the activity types a feed can be filtered by.
+var ActivityTypes = []string{ActivityBookAdded, ActivityBookFinished, ActivityMetadataUpdated}
+
+// Activity is an entry in a library's activity feed, with the audiobook's
+// current title, author and cover. UserID and Username name the user for
+// activity of a user, such as finishing a book.
+type Activity struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	LibraryID   string    `json:"library_id"`
+	AudiobookID string    `json:"audiobook_id"`
+	Title       string    `json:"title,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	CoverURL    *string   `json:"cover_url,omitempty"`
+	UserID      *string   `json:"user_id,omitempty"`
+	Username    *string   `json:"username,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Metadata gaps reported for library cleanup.
+const (
+	// GapUnresolved marks books without a resolved metadata snapshot; run
+	// the resolve-metadata job before checking their other fields.
+	GapUnresolved     = "unresolved"
+	GapAuthor         = "author"
+	GapCover          = "cover"
+	GapDuration       = "duration"
+	GapSeriesSequence = "series_sequence"
+	// GapUnmatched marks books not linked to provider metadata. Many
+	// libraries rely on embedded tags alone, so it is only listed when
+	// asked for and does not count towards BooksWithGaps.
+	GapUnmatched = "unmatched"
+)
+
+// MetadataGaps lists the gaps in report order.
+var MetadataGaps = []string{GapUnresolved, GapAuthor, GapCover, GapDuration, GapSeriesSequence, GapUnmatched}
+
+// MetadataGapBook is a book missing key fields after metadata resolution.
+type MetadataGapBook struct {
+	AudiobookID string   `json:"audiobook_id"`
+	LibraryID   *string  `json:"library_id,omitempty"`
+	Title       string   `json:"title"`
+	AssetPath   string   `json:"asset_path"`
+	Gaps        []string `json:"gaps"`
+	// Links point at the endpoints used to inspect and fix the book.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// MetadataGapSummary counts a library's books and those with each gap.
+type MetadataGapSummary struct {
+	LibraryID     *string        `json:"library_id,omitempty"`
+	LibraryName   string         `json:"library_name"`
+	TotalBooks    int            `json:"total_books"`
+	BooksWithGaps int            `json:"books_with_gaps"`
+	Gaps          map[string]int `json:"gaps"`
+}
+
+// MissingAudiobook is a book whose folder a scan could not find on disk.
+type MissingAudiobook struct {
+	AudiobookID  string    `json:"audiobook_id"`
+	LibraryID    *string   `json:"library_id,omitempty"`
+	Title        string    `json:"title"`
+	AssetPath    string    `json:"asset_path"`
+	MissingSince time.Time `json:"missing_since"`
+}
+
+// Client log levels.
+const (
+	ClientLogError   = "error"
+	ClientLogWarning = "warning"
+	ClientLogInfo    = "info"
+)
+
+// ClientLog is an error report submitted by a first-party client, e.g. a
+// playback failure in the iOS app.
+type ClientLog struct {
+	ID            string  `json:"id"`
+	UserID        *string `json:"user_id,omitempty"`
+	Username      string  `json:"username"`
+	Level         string  `json:"level"`
+	Message       string  `json:"message"`
+	Client        string  `json:"client"`
+	ClientVersion string  `json:"client_version"`
+	Device        *string `json:"device,omitempty"`
+	OS            *string `json:"os,omitempty"`
+	// AudiobookID names the book being played, if any.
+	AudiobookID *string                `json:"audiobook_id,omitempty"`
+	Stack       *string                `json:"stack,omitempty"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	UserAgent   *string                `json:"user_agent,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// ClientLogFilter narrows the client logs listed to admins.
+type ClientLogFilter struct {
+	UserID        *string
+	Level         string
+	Client        string
+	ClientVersion string
+	AudiobookID   *string
+	Since         *time.Time
+	Until         *time.Time
+}
+
+// ListeningSession is a stretch of listening to one audiobook, opened by a
+// progress update and closed once no update arrived for the session
+// timeout.
+type ListeningSession struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	Username         string     `json:"username,omitempty"`
+	AudiobookID      string     `json:"audiobook_id"`
+	Title            string     `json:"title,omitempty"`
+	StartedAt        time.Time  `json:"started_at"`
+	LastActiveAt     time.Time  `json:"last_active_at"`
+	StartPositionSec float64    `json:"start_position_sec"`
+	PositionSec      float64    `json:"position_sec"`
+	ListenedSec      float64    `json:"listened_sec"`
+	ClosedAt         *time.Time `json:"closed_at,omitempty"`
+}
+
+// ListeningDay is a user's listening time on one UTC day.
+type ListeningDay struct {
+	Day         string  `json:"day"`
+	ListenedSec float64 `json:"listened_sec"`
+	Sessions    int     `json:"sessions"`
+}
+
+// ListeningStats sums a user's closed listening sessions.
+type ListeningStats struct {
+	TotalListenedSec float64        `json:"total_listened_sec"`
+	TotalSessions    int            `json:"total_sessions"`
+	Days             []ListeningDay `json:"days"`
+	Goals            *GoalProgress  `json:"goals,omitempty"`
+}
+
+// UserListeningSummary totals one user's listening over a range of days,
+// for the admin listening report. Users who have been erased show up under
+// their anonymous ID without a username.
+type UserListeningSummary struct {
+	UserID      string  `json:"user_id"`
+	Username    string  `json:"username,omitempty"`
+	ListenedSec float64 `json:"listened_sec"`
+	Sessions    int     `json:"sessions"`
+	ActiveDays  int     `json:"active_days"`
+	FirstDay    string  `json:"first_day"`
+	LastDay     string  `json:"last_day"`
+}
+
+// ListeningGoals are a user's listening targets. A nil target is unset.
+type ListeningGoals struct {
+	WeeklyHours *float64 `json:"weekly_hours"`
+	YearlyBooks *int     `json:"yearly_books"`
+}
+
+// GoalProgress is how far a user is towards their goals in the current UTC
+// week, starting Monday, and year. The percentages are left out for unset
+// goals and may exceed 100.
+type GoalProgress struct {
+	ListeningGoals
+	WeekStart         string   `json:"week_start"`
+	WeekListenedHours float64  `json:"week_listened_hours"`
+	WeeklyPct         *float64 `json:"weekly_pct,omitempty"`
+	Year              int      `json:"year"`
+	YearBooksFinished int      `json:"year_books_finished"`
+	YearlyPct         *float64 `json:"yearly_pct,omitempty"`
+}
+
+// RetentionSettings bound how long listening history and activity records
+// are kept, in days. Zero keeps them forever.
+type RetentionSettings struct {
+	// SessionDays applies to closed listening sessions.
+	SessionDays int `json:"session_days"`
+	// StatsDays applies to the per-day listening stats.
+	StatsDays int `json:"stats_days"`
+	// ActivityDays applies to the download audit trail, access token
+	// events and library activity feeds.
+	ActivityDays int        `json:"activity_days"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// PrivacySettings are a user's choices about the data kept about them and
+// who sees it.
+type PrivacySettings struct {
+	// KeepListeningHistory keeps the user's closed listening sessions and
+	// daily stats for the server's retention period. When false they are
+	// removed at the next pruning, with the books they finished from
+	// library activity feeds.
+	KeepListeningHistory bool `json:"keep_listening_history"`
+	// ShareActivity shows the books the user finished to other users in
+	// library activity feeds. Off by default.
+	ShareActivity bool `json:"share_activity"`
+	// ShareListening shows which books the user is listening to or
+	// finished on book detail, to other users who share theirs, and theirs
+	// to the user. Positions are never shown. Off by default.
+	ShareListening bool `json:"share_listening"`
+}
+
+// PruneResult counts the records a retention pruning removed.
+type PruneResult struct {
+	Sessions    int64 `json:"sessions"`
+	StatsDays   int64 `json:"stats_days"`
+	Downloads   int64 `json:"downloads"`
+	TokenEvents int64 `json:"token_events"`
+	Activity    int64 `json:"activity"`
+}
+
+// UserDataExport is everything stored about a user, for a copy of their
+// personal data.
+type UserDataExport struct {
+	ExportedAt    time.Time            `json:"exported_at"`
+	Profile       User                 `json:"profile"`
+	Progress      []UserAudiobookData  `json:"progress"`
+	Sessions      []ListeningSession   `json:"sessions"`
+	ListeningDays []ListeningDay       `json:"listening_days"`
+	Reviews       []Review             `json:"reviews"`
+	Bookmarks     []Bookmark           `json:"bookmarks"`
+	Goals         ListeningGoals       `json:"goals"`
+	Privacy       PrivacySettings      `json:"privacy"`
+	Notifications NotificationSettings `json:"notifications"`
+	AccessTokens  []AccessToken        `json:"access_tokens"`
+	Downloads     []DownloadRecord     `json:"downloads"`
+	ClientLogs    []ClientLog          `json:"client_logs"`
+}
+
+// Erasure request states.
+const (
+	ErasurePending  = "pending"
+	ErasureApproved = "approved"
+	ErasureRejected = "rejected"
+)
+
+// ErasureRequest is a user's request to have their account erased, which
+// an admin approves or rejects. Username is empty once the account is gone.
+type ErasureRequest struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Username    string     `json:"username,omitempty"`
+	Reason      *string    `json:"reason,omitempty"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requested_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+	DecidedBy   *string    `json:"decided_by,omitempty"`
+	Note        *string    `json:"note,omitempty"`
+}
+
+// ErasureResult counts what an erasure anonymized and removed. Anonymized
+// records stay under a random ID so totals and averages do not change.
+type ErasureResult struct {
+	AnonymousID string `json:"anonymous_id"`
+	Sessions    int64  `json:"sessions"`
+	Progress    int64  `json:"progress"`
+	Ratings     int64  `json:"ratings"`
+	Bookmarks   int64  `json:"bookmarks"`
+	Downloads   int64  `json:"downloads"`
+	ClientLogs  int64  `json:"client_logs"`
 }
 
 // UserAudiobookData stores per-user listening information for books in their library.
@@ -164,6 +1299,53 @@ type UserAudiobookData struct {
 	ProgressSec  float64    `json:"progress_sec"`
 	IsFavorite   bool       `json:"is_favorite"`
 	LastPlayedAt *time.Time `json:"last_played_at,omitempty"`
+	// ProgressPct (0–100) and RemainingSec are left out while the book's
+	// duration is unknown.
+	ProgressPct  *float64 `json:"progress_pct,omitempty"`
+	RemainingSec *float64 `json:"remaining_sec,omitempty"`
+}
+
+// ApplyDuration computes ProgressPct and RemainingSec for a book lasting
+// durationSec seconds, or clears them when the duration is unknown.
+func (d *UserAudiobookData) ApplyDuration(durationSec float64) {
+	if d == nil {
+		return
+	}
+	if durationSec <= 0 {
+		d.ProgressPct, d.RemainingSec = nil, nil
+		return
+	}
+	progress := math.Min(math.Max(d.ProgressSec, 0), durationSec)
+	pct := math.Round(progress/durationSec*1000) / 10
+	remaining := durationSec - progress
+	d.ProgressPct, d.RemainingSec = &pct, &remaining
+}
+
+// PlaybackDuration returns the book's length in seconds: the total of its
+// media file durations, or the duration from its metadata while the files
+// have not been probed. It is 0 when neither is known.
+func (a *Audiobook) PlaybackDuration() float64 {
+	if a == nil {
+		return 0
+	}
+	total := a.TotalDurationSec
+	if total <= 0 {
+		for _, file := range a.MediaFiles {
+			total += file.DurationSec
+		}
+	}
+	if total <= 0 && a.Metadata != nil && a.Metadata.DurationSec != nil {
+		total = *a.Metadata.DurationSec
+	}
+	return total
+}
+
+// ApplyProgress fills in the user's progress percentage and time remaining
+// from the book's duration.
+func (a *Audiobook) ApplyProgress() {
+	if a != nil && a.UserData != nil {
+		a.UserData.ApplyDuration(a.PlaybackDuration())
+	}
 }
 
 // LibraryPath represents a configured library directory.
@@ -174,8 +1356,13 @@ type LibraryPath struct {
 	Enabled       bool             `json:"enabled"`
 	CreatedAt     time.Time        `json:"created_at"`
 	LastScannedAt *time.Time       `json:"last_scanned_at,omitempty"`
-	BookCount     int              `json:"book_count,omitempty"` // Computed field
 	Libraries     []LibrarySummary `json:"libraries,omitempty"`
+
+	// Statistics recorded by the most recent scan of the directory.
+	BookCount          int   `json:"book_count"`
+	FileCount          int   `json:"file_count"`
+	TotalSize          int64 `json:"total_size"` // bytes
+	LastScanDurationMs *int  `json:"last_scan_duration_ms,omitempty"`
 }
 
 // ImportFolder represents a configured import staging directory.
@@ -189,10 +1376,30 @@ type ImportFolder struct {
 
 // ImportSettings represents global import configuration.
 type ImportSettings struct {
-	ID              string    `json:"id"`
-	DestinationPath string    `json:"destination_path"`
-	Template        string    `json:"template"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              string `json:"id"`
+	DestinationPath string `json:"destination_path"`
+	Template        string `json:"template"`
+	// MergeReplaceOriginals makes M4B merges delete the source files instead
+	// of keeping them next to the merged file.
+	MergeReplaceOriginals bool      `json:"merge_replace_originals"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// ImportJobRecord is a finished import job kept in the import history.
+type ImportJobRecord struct {
+	ID          string         `json:"id"`
+	Status      string         `json:"status"`
+	SourcePaths []string       `json:"source_paths"`
+	Imported    []ImportedBook `json:"imported"`
+	Errors      []string       `json:"errors"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// ImportedBook is an audiobook created by an import job.
+type ImportedBook struct {
+	AudiobookID string `json:"audiobook_id"`
+	AssetPath   string `json:"asset_path"`
 }
 
 // SeriesInfo represents aggregated information about a book series.
@@ -216,6 +1423,61 @@ type AuthorInfo struct {
 	UserStats *AuthorUserStats `json:"user_stats,omitempty"`
 }
 
+// Home screen rows, in the order they are shown.
+const (
+	HomeContinueListening = "continue_listening"
+	HomeRecentlyAdded     = "recently_added"
+	HomeNextInSeries      = "next_in_series"
+	HomeFavorites         = "favorites"
+)
+
+// HomeRow is a titled shelf of books on the home screen.
+type HomeRow struct {
+	ID    string      `json:"id"`
+	Title string      `json:"title"`
+	Books []Audiobook `json:"books"`
+}
+
+// Kinds of reasons a book is recommended for.
+const (
+	RecommendAuthor   = "author"
+	RecommendSeries   = "series"
+	RecommendNarrator = "narrator"
+	RecommendGenre    = "genre"
+)
+
+// RecommendationReason is something a recommended book shares with a book
+// the user finished or favourited, e.g. {"kind": "author", "name": "Andy
+// Weir"}. Weight is what it adds to the book's score.
+type RecommendationReason struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// Recommendation is a suggested book with its score and the reasons that
+// make it up.
+type Recommendation struct {
+	Audiobook Audiobook              `json:"audiobook"`
+	Score     int                    `json:"score"`
+	Reasons   []RecommendationReason `json:"reasons"`
+}
+
+// SimilarBooks groups the other books related to an audiobook.
+type SimilarBooks struct {
+	SameSeries   []Audiobook `json:"same_series"`
+	SameAuthor   []Audiobook `json:"same_author"`
+	SameNarrator []Audiobook `json:"same_narrator"`
+}
+
+// SearchResults groups the matches of a search across all libraries.
+type SearchResults struct {
+	Books      []Audiobook  `json:"books"`
+	BooksTotal int          `json:"books_total"`
+	Authors    []AuthorInfo `json:"authors"`
+	Series     []SeriesInfo `json:"series"`
+}
+
 // AuthorUserStats tracks user statistics for an author's books.
 type AuthorUserStats struct {
 	BooksStarted   int `json:"books_started"`
@@ -242,84 +1504,36 @@ type FilterCounts struct {
 	Favorites  int `json:"favorites"`
 }
 
+// Metadata tiers resolved below custom values, named in a library's
+// metadata_order setting.
+const (
+	MetadataTierAgent    = "agent"
+	MetadataTierSidecar  = "sidecar"
+	MetadataTierEmbedded = "embedded"
+)
+
+// DefaultMetadataOrder is the order unlocked fields fall through the tiers
+// for libraries without a metadata order: provider matches first, then
+// sidecar files, then the files' tags.
+var DefaultMetadataOrder = []string{MetadataTierAgent, MetadataTierSidecar, MetadataTierEmbedded}
+
 // ResolveMetadata computes the final display metadata by merging all layers.
 //
 // Lock-to-Value Semantics:
 // - Locked fields use their custom/override value (frozen snapshot)
-// - Unlocked fields use priority cascade: Agent → Embedded → (future: Parsed)
+// - Unlocked fields take the first value found in the tiers of MetadataOrder,
+//   by default Agent → Sidecar → Embedded → (future: Parsed)
+// - Fields pinned to the agent take the agent value, whatever the order
 // - Locked fields MUST have a value (enforced by handler validation)
 //
-// Priority: Custom/Override (tier 1) > Agent (tier 2) > Embedded (tier 3)
+// Priority: Custom/Override (tier 1) > tiers in MetadataOrder
 func (a *Audiobook) ResolveMetadata() *AgentMetadata {
 	if a == nil {
 		return nil
 	}
 
 	resolved := &AgentMetadata{}
-
-	// Tier 3: Embedded metadata (lowest priority, currently stubbed)
-	// Future: Apply embedded metadata here when extraction is implemented
-	// if a.EmbeddedMetadata != nil {
-	//     if !a.isFieldLocked("title") && a.EmbeddedMetadata.Title != nil {
-	//         resolved.Title = *a.EmbeddedMetadata.Title
-	//     }
-	//     // ... etc for other fields
-	// }
-
-	// Tier 2: Agent metadata (middle priority, only if field not locked)
-	// Locked fields are skipped here and use their custom value from Tier 1
 	if a.Metadata != nil {
-		if !a.isFieldLocked("title") {
-			resolved.Title = a.Metadata.Title
-		}
-		if !a.isFieldLocked("subtitle") {
-			resolved.Subtitle = a.Metadata.Subtitle
-		}
-		if !a.isFieldLocked("author") {
-			resolved.Author = a.Metadata.Author
-		}
-		if !a.isFieldLocked("narrator") {
-			resolved.Narrator = a.Metadata.Narrator
-		}
-		if !a.isFieldLocked("description") {
-			resolved.Description = a.Metadata.Description
-		}
-		if !a.isFieldLocked("cover_url") {
-			resolved.CoverURL = a.Metadata.CoverURL
-		}
-		if !a.isFieldLocked("series_name") {
-			resolved.SeriesName = a.Metadata.SeriesName
-		}
-		if !a.isFieldLocked("series_sequence") {
-			resolved.SeriesSequence = a.Metadata.SeriesSequence
-		}
-		if !a.isFieldLocked("release_date") {
-			resolved.ReleaseDate = a.Metadata.ReleaseDate
-		}
-		if !a.isFieldLocked("isbn") {
-			resolved.ISBN = a.Metadata.ISBN
-		}
-		if !a.isFieldLocked("asin") {
-			resolved.ASIN = a.Metadata.ASIN
-		}
-		if !a.isFieldLocked("language") {
-			resolved.Language = a.Metadata.Language
-		}
-		if !a.isFieldLocked("publisher") {
-			resolved.Publisher = a.Metadata.Publisher
-		}
-		if !a.isFieldLocked("duration_sec") {
-			resolved.DurationSec = a.Metadata.DurationSec
-		}
-		if !a.isFieldLocked("rating") {
-			resolved.Rating = a.Metadata.Rating
-		}
-		if !a.isFieldLocked("rating_count") {
-			resolved.RatingCount = a.Metadata.RatingCount
-		}
-		if !a.isFieldLocked("genres") {
-			resolved.Genres = a.Metadata.Genres
-		}
 		// Copy metadata fields that don't get overridden
 		resolved.ID = a.Metadata.ID
 		resolved.Source = a.Metadata.Source
@@ -328,62 +1542,198 @@ func (a *Audiobook) ResolveMetadata() *AgentMetadata {
 		resolved.UpdatedAt = a.Metadata.UpdatedAt
 	}
 
+	// Pinned fields go first, so no tier ranked above the agent fills them.
+	a.fillFromTier(resolved, MetadataTierAgent, a.isFieldPinned)
+	for _, tier := range NormalizeMetadataOrder(a.MetadataOrder) {
+		a.fillFromTier(resolved, tier, nil)
+	}
+
 	// Tier 1: Custom values (highest priority)
-	// Presence of field (NOT NULL) = locked/frozen custom value
+	// Only fields locked to a value use the stored custom value; fields locked
+	// to blank were already skipped by the cascade above.
 	if a.CustomMetadata != nil {
-		if a.CustomMetadata.Title != nil {
+		if a.CustomMetadata.Title != nil && a.CustomMetadata.LockMode("title") == LockModeValue {
 			resolved.Title = *a.CustomMetadata.Title
 		}
-		if a.CustomMetadata.Subtitle != nil {
+		if a.CustomMetadata.Subtitle != nil && a.CustomMetadata.LockMode("subtitle") == LockModeValue {
 			resolved.Subtitle = a.CustomMetadata.Subtitle
 		}
-		if a.CustomMetadata.Author != nil {
+		if a.CustomMetadata.Author != nil && a.CustomMetadata.LockMode("author") == LockModeValue {
 			resolved.Author = *a.CustomMetadata.Author
 		}
-		if a.CustomMetadata.Narrator != nil {
+		if a.CustomMetadata.Narrator != nil && a.CustomMetadata.LockMode("narrator") == LockModeValue {
 			resolved.Narrator = a.CustomMetadata.Narrator
 		}
-		if a.CustomMetadata.Description != nil {
+		if a.CustomMetadata.Description != nil && a.CustomMetadata.LockMode("description") == LockModeValue {
 			resolved.Description = a.CustomMetadata.Description
 		}
-		if a.CustomMetadata.CoverURL != nil {
+		if a.CustomMetadata.CoverURL != nil && a.CustomMetadata.LockMode("cover_url") == LockModeValue {
 			resolved.CoverURL = a.CustomMetadata.CoverURL
 		}
-		if a.CustomMetadata.SeriesName != nil {
+		if a.CustomMetadata.SeriesName != nil && a.CustomMetadata.LockMode("series_name") == LockModeValue {
 			resolved.SeriesName = a.CustomMetadata.SeriesName
 		}
-		if a.CustomMetadata.SeriesSequence != nil {
+		if a.CustomMetadata.SeriesSequence != nil && a.CustomMetadata.LockMode("series_sequence") == LockModeValue {
 			resolved.SeriesSequence = a.CustomMetadata.SeriesSequence
 		}
-		if a.CustomMetadata.ReleaseDate != nil {
+		if a.CustomMetadata.ReleaseDate != nil && a.CustomMetadata.LockMode("release_date") == LockModeValue {
 			resolved.ReleaseDate = a.CustomMetadata.ReleaseDate
 		}
-		if a.CustomMetadata.ISBN != nil {
+		if a.CustomMetadata.ISBN != nil && a.CustomMetadata.LockMode("isbn") == LockModeValue {
 			resolved.ISBN = a.CustomMetadata.ISBN
 		}
-		if a.CustomMetadata.ASIN != nil {
+		if a.CustomMetadata.ASIN != nil && a.CustomMetadata.LockMode("asin") == LockModeValue {
 			resolved.ASIN = a.CustomMetadata.ASIN
 		}
-		if a.CustomMetadata.Language != nil {
+		if a.CustomMetadata.Language != nil && a.CustomMetadata.LockMode("language") == LockModeValue {
 			resolved.Language = a.CustomMetadata.Language
 		}
-		if a.CustomMetadata.Publisher != nil {
+		if a.CustomMetadata.Publisher != nil && a.CustomMetadata.LockMode("publisher") == LockModeValue {
 			resolved.Publisher = a.CustomMetadata.Publisher
 		}
-		if a.CustomMetadata.Genres != nil {
+		if a.CustomMetadata.Genres != nil && a.CustomMetadata.LockMode("genres") == LockModeValue {
 			resolved.Genres = a.CustomMetadata.Genres
 		}
+		// Sort names have no agent or file value; without an override the
+		// repository generates them with the library's collation.
+		if a.CustomMetadata.SortTitle != nil && a.CustomMetadata.LockMode("sort_title") == LockModeValue {
+			resolved.SortTitle = *a.CustomMetadata.SortTitle
+		}
+		if a.CustomMetadata.SortAuthor != nil && a.CustomMetadata.LockMode("sort_author") == LockModeValue {
+			resolved.SortAuthor = *a.CustomMetadata.SortAuthor
+		}
 	}
 
 	return resolved
 }
 
-// isFieldLocked checks if a specific metadata field is locked.
-// A field is locked if its Locks map entry is true.
+// NormalizeMetadataOrder returns a complete order of the metadata tiers:
+// the known tiers of order, without repeats, followed by the tiers it
+// leaves out in their default order.
+func NormalizeMetadataOrder(order []string) []string {
+	if len(order) == 0 {
+		return DefaultMetadataOrder
+	}
+	normalized := make([]string, 0, len(DefaultMetadataOrder))
+	seen := make(map[string]bool, len(DefaultMetadataOrder))
+	add := func(tier string) {
+		if seen[tier] {
+			return
+		}
+		for _, known := range DefaultMetadataOrder {
+			if tier == known {
+				seen[tier] = true
+				normalized = append(normalized, tier)
+				return
+			}
+		}
+	}
+	for _, tier := range order {
+		add(tier)
+	}
+	for _, tier := range DefaultMetadataOrder {
+		add(tier)
+	}
+	return normalized
+}
+
+// fillFromTier fills the fields of resolved still empty from one tier,
+// skipping fields locked away from the cascade. When only is set, just the
+// fields it accepts are filled.
+func (a *Audiobook) fillFromTier(resolved *AgentMetadata, tier string, only func(field string) bool) {
+	fillable := func(field string) bool {
+		return !a.isFieldLocked(field) && (only == nil || only(field))
+	}
+	fillString := func(field string, dst *string, src *string) {
+		if *dst == "" && src != nil && fillable(field) {
+			*dst = *src
+		}
+	}
+	fillOptional := func(field string, dst **string, src *string) {
+		if *dst == nil && src != nil && fillable(field) {
+			*dst = src
+		}
+	}
+
+	switch tier {
+	case MetadataTierAgent:
+		m := a.Metadata
+		if m == nil {
+			return
+		}
+		fillString("title", &resolved.Title, &m.Title)
+		fillOptional("subtitle", &resolved.Subtitle, m.Subtitle)
+		fillString("author", &resolved.Author, &m.Author)
+		fillOptional("narrator", &resolved.Narrator, m.Narrator)
+		fillOptional("description", &resolved.Description, m.Description)
+		fillOptional("cover_url", &resolved.CoverURL, m.CoverURL)
+		fillOptional("series_name", &resolved.SeriesName, m.SeriesName)
+		fillOptional("series_sequence", &resolved.SeriesSequence, m.SeriesSequence)
+		fillOptional("release_date", &resolved.ReleaseDate, m.ReleaseDate)
+		fillOptional("isbn", &resolved.ISBN, m.ISBN)
+		fillOptional("asin", &resolved.ASIN, m.ASIN)
+		fillOptional("language", &resolved.Language, m.Language)
+		fillOptional("publisher", &resolved.Publisher, m.Publisher)
+		fillOptional("genres", &resolved.Genres, m.Genres)
+		// Only providers know durations and ratings.
+		if resolved.DurationSec == nil && fillable("duration_sec") {
+			resolved.DurationSec = m.DurationSec
+		}
+		if resolved.Rating == nil && fillable("rating") {
+			resolved.Rating = m.Rating
+		}
+		if resolved.RatingCount == nil && fillable("rating_count") {
+			resolved.RatingCount = m.RatingCount
+		}
+
+	// Sidecar files keep what was entered in another library manager.
+	case MetadataTierSidecar:
+		sc := a.SidecarMetadata
+		if sc == nil {
+			return
+		}
+		fillString("title", &resolved.Title, sc.Title)
+		fillOptional("subtitle", &resolved.Subtitle, sc.Subtitle)
+		fillString("author", &resolved.Author, sc.Author)
+		fillOptional("narrator", &resolved.Narrator, sc.Narrator)
+		fillOptional("description", &resolved.Description, sc.Description)
+		fillOptional("series_name", &resolved.SeriesName, sc.SeriesName)
+		fillOptional("series_sequence", &resolved.SeriesSequence, sc.SeriesSequence)
+		fillOptional("release_date", &resolved.ReleaseDate, sc.ReleaseDate)
+		fillOptional("isbn", &resolved.ISBN, sc.ISBN)
+		fillOptional("asin", &resolved.ASIN, sc.ASIN)
+		fillOptional("language", &resolved.Language, sc.Language)
+		fillOptional("publisher", &resolved.Publisher, sc.Publisher)
+		fillOptional("genres", &resolved.Genres, sc.Genres)
+
+	// Embedded tags let books without a provider match show their tags.
+	case MetadataTierEmbedded:
+		e := a.EmbeddedMetadata
+		if e == nil {
+			return
+		}
+		fillString("title", &resolved.Title, e.Title)
+		fillOptional("subtitle", &resolved.Subtitle, e.Subtitle)
+		fillString("author", &resolved.Author, e.Author)
+		fillOptional("narrator", &resolved.Narrator, e.Narrator)
+		fillOptional("series_name", &resolved.SeriesName, e.SeriesName)
+		fillOptional("series_sequence", &resolved.SeriesSequence, e.SeriesSequence)
+	}
+}
+
+// isFieldPinned checks if a metadata field is pinned to the agent value.
+func (a *Audiobook) isFieldPinned(fieldName string) bool {
+	return a.CustomMetadata != nil && a.CustomMetadata.LockMode(fieldName) == LockModeAgent
+}
+
+// isFieldLocked checks if a specific metadata field is locked away from the
+// cascade, i.e. locked to a custom value or to blank. Fields pinned to the
+// agent still take the agent value.
 func (a *Audiobook) isFieldLocked(fieldName string) bool {
-	if a.CustomMetadata == nil || a.CustomMetadata.Locks == nil {
+	if a.CustomMetadata == nil {
 		return false
 	}
 
-	return a.CustomMetadata.Locks[fieldName]
+	mode := a.CustomMetadata.LockMode(fieldName)
+	return mode == LockModeValue || mode == LockModeBlank
 }
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func strPtr(s string) *string { return &s }
+
+// layeredAudiobook returns an audiobook with a different title and narrator
+// in every tier; only the agent has a description and only the files a
+// series.
+func layeredAudiobook() *Audiobook {
+	return &Audiobook{
+		Metadata: &AgentMetadata{
+			ID:          "agent-1",
+			Title:       "Agent Title",
+			Author:      "Agent Author",
+			Narrator:    strPtr("Agent Narrator"),
+			Description: strPtr("Agent Description"),
+		},
+		SidecarMetadata: &SidecarMetadata{
+			Title:    strPtr("Sidecar Title"),
+			Narrator: strPtr("Sidecar Narrator"),
+		},
+		EmbeddedMetadata: &EmbeddedMetadata{
+			Title:      strPtr("Embedded Title"),
+			Author:     strPtr("Embedded Author"),
+			Narrator:   strPtr("Embedded Narrator"),
+			SeriesName: strPtr("Embedded Series"),
+		},
+	}
+}
+
+func TestResolveMetadataOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    []string
+		title    string
+		author   string
+		narrator string
+	}{
+		{"default", nil, "Agent Title", "Agent Author", "Agent Narrator"},
+		{"embedded first", []string{"embedded", "agent", "sidecar"}, "Embedded Title", "Embedded Author", "Embedded Narrator"},
+		{"sidecar first", []string{"sidecar"}, "Sidecar Title", "Agent Author", "Sidecar Narrator"},
+		{"agent first", []string{"agent", "embedded"}, "Agent Title", "Agent Author", "Agent Narrator"},
+		{"unknown tiers ignored", []string{"parsed", "embedded"}, "Embedded Title", "Embedded Author", "Embedded Narrator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := layeredAudiobook()
+			book.MetadataOrder = tt.order
+			resolved := book.ResolveMetadata()
+
+			if resolved.Title != tt.title {
+				t.Errorf("title = %q, want %q", resolved.Title, tt.title)
+			}
+			if resolved.Author != tt.author {
+				t.Errorf("author = %q, want %q", resolved.Author, tt.author)
+			}
+			if resolved.Narrator == nil || *resolved.Narrator != tt.narrator {
+				t.Errorf("narrator = %v, want %q", resolved.Narrator, tt.narrator)
+			}
+			// Tiers lower in the order still fill fields the others lack.
+			if resolved.Description == nil || *resolved.Description != "Agent Description" {
+				t.Errorf("description = %v, want the agent's", resolved.Description)
+			}
+			if resolved.SeriesName == nil || *resolved.SeriesName != "Embedded Series" {
+				t.Errorf("series = %v, want the embedded one", resolved.SeriesName)
+			}
+			if resolved.ID != "agent-1" {
+				t.Errorf("id = %q, want the agent's", resolved.ID)
+			}
+		})
+	}
+}
+
+func TestResolveMetadataEmbeddedOrderWithoutTags(t *testing.T) {
+	book := layeredAudiobook()
+	book.EmbeddedMetadata = nil
+	book.MetadataOrder = []string{"embedded"}
+
+	if got := book.ResolveMetadata().Title; got != "Agent Title" {
+		t.Fatalf("title = %q, want the agent's", got)
+	}
+}
+
+func TestResolveMetadataLocksIgnoreOrder(t *testing.T) {
+	book := layeredAudiobook()
+	book.MetadataOrder = []string{"embedded"}
+	book.CustomMetadata = &CustomMetadata{Title: strPtr("Custom Title")}
+	book.CustomMetadata.SetLockMode("title", LockModeValue)
+	book.CustomMetadata.SetLockMode("author", LockModeAgent)
+	book.CustomMetadata.SetLockMode("series_name", LockModeBlank)
+
+	resolved := book.ResolveMetadata()
+	if resolved.Title != "Custom Title" {
+		t.Errorf("title = %q, want the custom value", resolved.Title)
+	}
+	if resolved.Author != "Agent Author" {
+		t.Errorf("author = %q, want the pinned agent value", resolved.Author)
+	}
+	if resolved.SeriesName != nil {
+		t.Errorf("series = %q, want blank", *resolved.SeriesName)
+	}
+	if resolved.Narrator == nil || *resolved.Narrator != "Embedded Narrator" {
+		t.Errorf("narrator = %v, want the embedded one", resolved.Narrator)
+	}
+}
+
+func TestNormalizeMetadataOrder(t *testing.T) {
+	tests := []struct {
+		order []string
+		want  []string
+	}{
+		{nil, DefaultMetadataOrder},
+		{[]string{"embedded"}, []string{"embedded", "agent", "sidecar"}},
+		{[]string{"sidecar", "sidecar", "bogus", "embedded"}, []string{"sidecar", "embedded", "agent"}},
+		{[]string{"embedded", "sidecar", "agent"}, []string{"embedded", "sidecar", "agent"}},
+	}
+	for _, tt := range tests {
+		if got := NormalizeMetadataOrder(tt.order); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NormalizeMetadataOrder(%v) = %v, want %v", tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalProxiesRemoteCover(t *testing.T) {
+	remote := "https://m.media-amazon.com/images/I/cover.jpg"
+	agent := &AgentMetadata{ID: "agent-1", Title: "Title", CoverURL: &remote}
+	book := Audiobook{ID: "book-1", Metadata: agent, ResolvedMetadata: agent, AgentMetadata: agent}
+
+	raw, err := json.Marshal(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Metadata         AgentMetadata `json:"metadata"`
+		ResolvedMetadata AgentMetadata `json:"resolved_metadata"`
+		AgentMetadata    AgentMetadata `json:"agent_metadata"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	proxied := CoverURL("book-1")
+	if *got.Metadata.CoverURL != proxied || *got.ResolvedMetadata.CoverURL != proxied {
+		t.Errorf("resolved cover_url = %s / %s, want %s", *got.Metadata.CoverURL, *got.ResolvedMetadata.CoverURL, proxied)
+	}
+	if *got.AgentMetadata.CoverURL != remote {
+		t.Errorf("agent cover_url = %s, want the remote URL kept", *got.AgentMetadata.CoverURL)
+	}
+	if *agent.CoverURL != remote {
+		t.Errorf("marshalling changed the metadata to %s", *agent.CoverURL)
+	}
+
+	book.SetLite()
+	if lite := book.Lite(); lite.CoverURL == nil || *lite.CoverURL != proxied {
+		t.Errorf("lite cover_url = %v, want %s", lite.CoverURL, proxied)
+	}
+}
@@ -0,0 +1,200 @@
+// Package notify tells admins about library events (finished imports, files
+// going missing, disks filling up) over the channels they have configured, such as email.
+//
+// Each channel is a Sender. New channels implement Sender and add an address
+// to models.NotificationSettings; the Notifier takes care of looking up
+// recipients and their preferences.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// Event types.
+const (
+	EventImportCompleted = "import.completed"
+	EventImportFailed    = "import.failed"
+	EventScanMissing     = "scan.missing_files"
+	EventScanFailing     = "scan.failing"
+	EventStorageWarning  = "storage.warning"
+	EventTest            = "test"
+)
+
+// Channel names.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// deliveryTimeout bounds a single event's delivery to every recipient.
+const deliveryTimeout = time.Minute
+
+// ErrNoChannels is returned when a test notification has nowhere to go.
+var ErrNoChannels = errors.New("no notification channels configured")
+
+// Event is a single notification.
+type Event struct {
+	Type    string                 `json:"type"`
+	Subject string                 `json:"subject"`
+	Body    string                 `json:"body"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Time    time.Time              `json:"time"`
+}
+
+// Sender delivers events over one channel.
+type Sender interface {
+	// Channel names the channel, e.g. "email".
+	Channel() string
+	// Send delivers ev to address, whose format depends on the channel.
+	Send(ctx context.Context, address string, ev Event) error
+}
+
+// Store reads and writes notification settings.
+type Store interface {
+	GetNotificationSettings(ctx context.Context, userID string) (*models.NotificationSettings, error)
+	UpdateNotificationSettings(ctx context.Context, settings *models.NotificationSettings) error
+	ListAdminNotificationSettings(ctx context.Context) ([]models.NotificationSettings, error)
+}
+
+// Notifier fans events out to the admins who want them. A nil Notifier
+// discards events, so services can call it unconditionally.
+type Notifier struct {
+	store   Store
+	senders map[string]Sender
+}
+
+// New creates a Notifier delivering through the given senders.
+func New(store Store, senders ...Sender) *Notifier {
+	n := &Notifier{store: store, senders: make(map[string]Sender, len(senders))}
+	for _, sender := range senders {
+		n.senders[sender.Channel()] = sender
+	}
+	return n
+}
+
+// Channels lists the channels that can deliver notifications.
+func (n *Notifier) Channels() []string {
+	channels := []string{}
+	for _, name := range []string{ChannelEmail, ChannelWebhook} {
+		if _, ok := n.senders[name]; ok {
+			channels = append(channels, name)
+		}
+	}
+	return channels
+}
+
+// Settings returns a user's notification settings.
+func (n *Notifier) Settings(ctx context.Context, userID string) (*models.NotificationSettings, error) {
+	return n.store.GetNotificationSettings(ctx, userID)
+}
+
+// UpdateSettings saves a user's notification settings.
+func (n *Notifier) UpdateSettings(ctx context.Context, settings *models.NotificationSettings) error {
+	return n.store.UpdateNotificationSettings(ctx, settings)
+}
+
+// Notify delivers ev to every admin subscribed to its type. Delivery happens
+// in the background; failures are logged.
+func (n *Notifier) Notify(ev Event) {
+	if n == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+		defer cancel()
+
+		recipients, err := n.store.ListAdminNotificationSettings(ctx)
+		if err != nil {
+			log.Printf("notify %s: list recipients: %v", ev.Type, err)
+			return
+		}
+		for _, settings := range recipients {
+			if !wants(settings, ev.Type) {
+				continue
+			}
+			for _, err := range n.deliver(ctx, settings, ev) {
+				log.Printf("notify %s: user %s: %v", ev.Type, settings.UserID, err)
+			}
+		}
+	}()
+}
+
+// SendTest sends a test notification to every channel a user has configured,
+// regardless of their event preferences.
+func (n *Notifier) SendTest(ctx context.Context, userID string) error {
+	settings, err := n.store.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	ev := Event{
+		Type:    EventTest,
+		Subject: "Lore test notification",
+		Body:    "Notifications are set up correctly.",
+		Time:    time.Now().UTC(),
+	}
+	sent, errs := 0, n.deliver(ctx, *settings, ev)
+	for _, channel := range n.Channels() {
+		if address(*settings, channel) != "" {
+			sent++
+		}
+	}
+	if sent == 0 {
+		return ErrNoChannels
+	}
+	return errors.Join(errs...)
+}
+
+// deliver sends ev over each channel the user has an address for.
+func (n *Notifier) deliver(ctx context.Context, settings models.NotificationSettings, ev Event) []error {
+	var errs []error
+	for _, channel := range n.Channels() {
+		addr := address(settings, channel)
+		if addr == "" {
+			continue
+		}
+		if err := n.senders[channel].Send(ctx, addr, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel, err))
+		}
+	}
+	return errs
+}
+
+func address(settings models.NotificationSettings, channel string) string {
+	var addr *string
+	switch channel {
+	case ChannelEmail:
+		addr = settings.Email
+	case ChannelWebhook:
+		addr = settings.WebhookURL
+	}
+	if addr == nil {
+		return ""
+	}
+	return strings.TrimSpace(*addr)
+}
+
+func wants(settings models.NotificationSettings, eventType string) bool {
+	switch eventType {
+	case EventImportCompleted:
+		return settings.ImportCompleted
+	case EventImportFailed:
+		return settings.ImportFailed
+	case EventScanMissing:
+		return settings.ScanMissing
+	case EventScanFailing, EventStorageWarning:
+		return settings.StorageWarnings
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lore/backend/internal/httpclient"
+)
+
+// WebhookSender POSTs events as JSON to a URL.
+type WebhookSender struct {
+	client *http.Client
+}
+
+// NewWebhookSender creates a webhook sender.
+func NewWebhookSender() *WebhookSender {
+	return &WebhookSender{
+		client: httpclient.New(httpclient.Options{Name: "notifications", Timeout: 15 * time.Second}),
+	}
+}
+
+func (s *WebhookSender) Channel() string { return ChannelWebhook }
+
+func (s *WebhookSender) Send(ctx context.Context, address string, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package pathutil decides whether a file lies inside a directory the way
+// the file system sees it, rather than by comparing strings.
+package pathutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Resolve returns path made absolute and cleaned, with symlinks resolved.
+// Paths that do not exist yet, such as an import destination, have their
+// longest existing parent resolved, so they still compare equal to paths
+// under the same real directory.
+func Resolve(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	} else {
+		path = filepath.Clean(path)
+	}
+
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// Contains reports whether path is root or lies below it. Both are resolved
+// first, so trailing slashes and symlinked mounts do not matter, "/books2"
+// is not inside "/books", and on a case-insensitive file system spellings
+// that differ only in case match.
+func Contains(root, path string) bool {
+	_, ok := Rel(root, path)
+	return ok
+}
+
+// Within reports whether path lies strictly below root.
+func Within(root, path string) bool {
+	rel, ok := Rel(root, path)
+	return ok && rel != "."
+}
+
+// Rel returns path relative to root, as filepath.Rel does for resolved
+// paths, and reports whether path is root or lies below it.
+func Rel(root, path string) (string, bool) {
+	root, path = Resolve(root), Resolve(path)
+	if rel, ok := relBelow(root, path); ok {
+		return rel, true
+	}
+	if caseInsensitive(root) {
+		return relBelowFold(root, path)
+	}
+	return "", false
+}
+
+// RemoveEmptyParents deletes dir and its ancestors while they are empty,
+// stopping at root, e.g. the author folder left behind when an audiobook
+// is moved out of it.
+func RemoveEmptyParents(dir, root string) {
+	if root == "" {
+		return
+	}
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(os.PathSeparator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return // not empty or not removable
+		}
+	}
+}
+
+func relBelow(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// relBelowFold is relBelow ignoring case. It compares root against the same
+// number of leading components of path, so the relative part keeps path's
+// casing.
+func relBelowFold(root, path string) (string, bool) {
+	rootParts := splitPath(root)
+	pathParts := splitPath(path)
+	if len(pathParts) < len(rootParts) {
+		return "", false
+	}
+	for i, part := range rootParts {
+		if !strings.EqualFold(part, pathParts[i]) {
+			return "", false
+		}
+	}
+	if len(pathParts) == len(rootParts) {
+		return ".", true
+	}
+	return filepath.Join(pathParts[len(rootParts):]...), true
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == filepath.Separator })
+}
+
+// caseCache remembers which existing directories live on case-insensitive
+// file systems.
+var caseCache sync.Map
+
+// caseInsensitive reports whether dir is on a file system that ignores case,
+// by checking whether its case-swapped spelling names the same directory.
+func caseInsensitive(dir string) bool {
+	if known, ok := caseCache.Load(dir); ok {
+		return known.(bool)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return false
+	}
+	insensitive := false
+	if swapped := swapCase(dir); swapped != dir {
+		if other, err := os.Stat(swapped); err == nil {
+			insensitive = os.SameFile(info, other)
+		}
+	}
+	caseCache.Store(dir, insensitive)
+	return insensitive
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
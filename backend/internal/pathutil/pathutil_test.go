@@ -0,0 +1,72 @@
+package pathutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContains(t *testing.T) {
+	root := t.TempDir()
+	books := filepath.Join(root, "books")
+	if err := os.MkdirAll(filepath.Join(books, "Andy Weir", "The Martian"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "books2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mount := filepath.Join(root, "mnt")
+	if err := os.Symlink(books, mount); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		root, path string
+		want       bool
+	}{
+		{"child", books, filepath.Join(books, "Andy Weir", "The Martian"), true},
+		{"same directory", books, books, true},
+		{"trailing slash", books + string(filepath.Separator), filepath.Join(books, "Andy Weir"), true},
+		{"sibling sharing a prefix", books, filepath.Join(root, "books2", "x.mp3"), false},
+		{"parent", books, root, false},
+		{"dot-dot escape", books, books + "/../books2", false},
+		{"asset under symlinked mount", books, filepath.Join(mount, "Andy Weir"), true},
+		{"symlinked root", mount, filepath.Join(books, "Andy Weir"), true},
+		{"missing path under symlinked mount", books, filepath.Join(mount, "New Author", "New Book"), true},
+	}
+	for _, tt := range tests {
+		if got := Contains(tt.root, tt.path); got != tt.want {
+			t.Errorf("%s: Contains(%q, %q) = %v, want %v", tt.name, tt.root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	root := t.TempDir()
+	if Within(root, root) {
+		t.Errorf("Within(%q, itself) = true, want false", root)
+	}
+	if !Within(root, filepath.Join(root, "a")) {
+		t.Errorf("Within(%q, child) = false, want true", root)
+	}
+}
+
+func TestRelBelowFold(t *testing.T) {
+	tests := []struct {
+		root, path string
+		want       string
+		ok         bool
+	}{
+		{"/Volumes/Books", "/volumes/books/Andy Weir/The Martian", "Andy Weir/The Martian", true},
+		{"/Volumes/Books", "/VOLUMES/BOOKS", ".", true},
+		{"/Volumes/Books", "/volumes/books2/x", "", false},
+		{"/Volumes/Books", "/Volumes", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := relBelowFold(filepath.FromSlash(tt.root), filepath.FromSlash(tt.path))
+		if ok != tt.ok || got != filepath.FromSlash(tt.want) {
+			t.Errorf("relBelowFold(%q, %q) = %q, %v, want %q, %v", tt.root, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
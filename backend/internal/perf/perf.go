@@ -0,0 +1,95 @@
+// Package perf keeps timing breakdowns of recent library scans and imports,
+// to tune worker counts for the hardware the library lives on.
+package perf
+
+import (
+	"sync"
+	"time"
+)
+
+// Kinds of work a profile is recorded for.
+const (
+	KindScan   = "scan"
+	KindImport = "import"
+)
+
+// MaxProfiles is how many profiles are kept; older ones are dropped.
+const MaxProfiles = 50
+
+// Profile breaks one scan or import down by phase. Phase times are wall
+// clock times, so comparing profiles taken with different worker counts
+// shows whether the disk or the CPU is the bottleneck.
+type Profile struct {
+	Kind string `json:"kind"`
+	// ID and Name identify the library scanned or the import job.
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Workers   int       `json:"workers,omitempty"`
+	// Books counts the audiobooks walked, FilesProbed the media files
+	// probed and BooksWritten the audiobooks created or updated.
+	Books        int `json:"books"`
+	FilesProbed  int `json:"files_probed"`
+	BooksWritten int `json:"books_written"`
+	// WalkMs is time spent listing directories, CopyMs time spent copying
+	// imported files, ProbeMs time spent reading media files and WriteMs
+	// time spent in the database.
+	WalkMs  int64   `json:"walk_ms"`
+	CopyMs  int64   `json:"copy_ms,omitempty"`
+	ProbeMs int64   `json:"probe_ms"`
+	WriteMs int64   `json:"write_ms"`
+	TotalMs int64   `json:"total_ms"`
+	PerBook PerBook `json:"per_book"`
+}
+
+// PerBook averages a profile's phases over the books or files each phase
+// handled.
+type PerBook struct {
+	WalkMs  float64 `json:"walk_ms"`
+	CopyMs  float64 `json:"copy_ms,omitempty"`
+	ProbeMs float64 `json:"probe_ms_per_file"`
+	WriteMs float64 `json:"write_ms"`
+}
+
+func average(ms int64, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return float64(ms) / float64(n)
+}
+
+var (
+	mu       sync.Mutex
+	profiles []Profile
+)
+
+// Record adds p to the recent profiles, filling in its per-book averages.
+func Record(p Profile) {
+	p.PerBook = PerBook{
+		WalkMs:  average(p.WalkMs, p.Books),
+		CopyMs:  average(p.CopyMs, p.Books),
+		ProbeMs: average(p.ProbeMs, p.FilesProbed),
+		WriteMs: average(p.WriteMs, p.BooksWritten),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	profiles = append(profiles, p)
+	if len(profiles) > MaxProfiles {
+		profiles = append(profiles[:0:0], profiles[len(profiles)-MaxProfiles:]...)
+	}
+}
+
+// Recent returns up to limit of the latest profiles of kind, or of every
+// kind when kind is empty, newest first.
+func Recent(kind string, limit int) []Profile {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make([]Profile, 0, min(limit, len(profiles)))
+	for i := len(profiles) - 1; i >= 0 && len(result) < limit; i-- {
+		if kind == "" || profiles[i].Kind == kind {
+			result = append(result, profiles[i])
+		}
+	}
+	return result
+}
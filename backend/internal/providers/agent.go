@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lore/backend/internal/httpclient"
+)
+
+// AgentProvider is a metadata agent run outside Lore, such as a community
+// scraper, reached over a small JSON contract relative to its base URL:
+//
+//	GET /search?title=...&author=...  ->  {"results": [result, ...]}
+//	GET /item/{id}                     ->  result
+//
+// Results use the SearchResult JSON fields; external_id and title are
+// required, and provider is set to the agent's name. When the agent has an
+// API key it is sent as a bearer token.
+type AgentProvider struct {
+	name    string
+	baseURL string
+	apiKey  string
+	config  *ProviderConfig
+	client  *http.Client
+}
+
+// NewAgentProvider creates a provider named name for the agent at baseURL
+func NewAgentProvider(name, baseURL, apiKey string, config *ProviderConfig) *AgentProvider {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &AgentProvider{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		config:  config,
+		client:  httpclient.New(httpclient.Options{Name: name, Timeout: config.Timeout}),
+	}
+}
+
+// Name returns the agent's name
+func (p *AgentProvider) Name() string {
+	return p.name
+}
+
+// agentSearchResponse is the response of an agent's search endpoint
+type agentSearchResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+// Search asks the agent for books by title and author
+func (p *AgentProvider) Search(ctx context.Context, title, author string) ([]SearchResult, error) {
+	if title == "" {
+		return nil, nil
+	}
+	return cached(ctx, p.config.Cache, cacheKey(p.cacheName(), "search", title, author), func() ([]SearchResult, error) {
+		return p.search(ctx, title, author)
+	})
+}
+
+func (p *AgentProvider) search(ctx context.Context, title, author string) ([]SearchResult, error) {
+	query := url.Values{}
+	query.Set("title", title)
+	if author != "" {
+		query.Set("author", author)
+	}
+
+	var apiResp agentSearchResponse
+	if err := p.get(ctx, p.baseURL+"/search?"+query.Encode(), &apiResp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for i := range apiResp.Results {
+		if result := p.clean(&apiResp.Results[i]); result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
+// GetByID asks the agent for one book by its ID
+func (p *AgentProvider) GetByID(ctx context.Context, id string) (*SearchResult, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("ID is required")
+	}
+	return cached(ctx, p.config.Cache, cacheKey(p.cacheName(), "id", id), func() (*SearchResult, error) {
+		return p.getByID(ctx, id)
+	})
+}
+
+func (p *AgentProvider) getByID(ctx context.Context, id string) (*SearchResult, error) {
+	var item SearchResult
+	if err := p.get(ctx, p.baseURL+"/item/"+url.PathEscape(id), &item); err != nil {
+		return nil, err
+	}
+	result := p.clean(&item)
+	if result == nil {
+		return nil, &Error{Provider: p.name, Message: "unexpected response: item has no external_id or title"}
+	}
+	return result, nil
+}
+
+// cacheName keys cached results by the agent's URL as well as its name, so
+// pointing an agent elsewhere does not serve the old agent's results.
+func (p *AgentProvider) cacheName() string {
+	return p.name + " " + p.baseURL
+}
+
+// get loads an agent URL into v.
+func (p *AgentProvider) get(ctx context.Context, agentURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", agentURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return requestError(p.name, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(p.name, resp); err != nil {
+		return err
+	}
+	return decodeJSON(p.name, resp, v)
+}
+
+// clean attributes an agent's result to the agent, dropping results without
+// an ID or title and the fields only Lore sets.
+func (p *AgentProvider) clean(result *SearchResult) *SearchResult {
+	result.ExternalID = strings.TrimSpace(result.ExternalID)
+	result.Title = strings.TrimSpace(result.Title)
+	if result.ExternalID == "" || result.Title == "" {
+		return nil
+	}
+	result.Provider = p.name
+	result.Sources = nil
+	if result.Confidence != nil && (*result.Confidence < 0 || *result.Confidence > 1) {
+		result.Confidence = nil
+	}
+	return result
+}
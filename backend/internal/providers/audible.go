@@ -2,15 +2,17 @@ package providers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
-	"io"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/lore/backend/internal/httpclient"
 )
 
 // AudibleProvider implements metadata search via Audible APIs
@@ -30,7 +32,7 @@ func NewAudibleProvider(region string, config *ProviderConfig) *AudibleProvider
 	}
 	return &AudibleProvider{
 		config: config,
-		client: &http.Client{Timeout: config.Timeout},
+		client: httpclient.New(httpclient.Options{Name: "audible", Timeout: config.Timeout}),
 		region: region,
 	}
 }
@@ -126,7 +128,12 @@ func (p *AudibleProvider) Search(ctx context.Context, title, author string) ([]S
 	if title == "" {
 		return nil, nil
 	}
+	return cached(ctx, p.config.Cache, cacheKey(p.Name(), "search", title, author), func() ([]SearchResult, error) {
+		return p.search(ctx, title, author)
+	})
+}
 
+func (p *AudibleProvider) search(ctx context.Context, title, author string) ([]SearchResult, error) {
 	var results []SearchResult
 
 	// Try ASIN search if title looks like an ASIN
@@ -156,82 +163,194 @@ func (p *AudibleProvider) Search(ctx context.Context, title, author string) ([]S
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("search request failed: %w", err)
+		return nil, requestError(p.Name(), err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search failed with status: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	if err := checkResponse(p.Name(), resp); err != nil {
+		return nil, err
 	}
 
 	var searchResp audibleSearchResponse
-	if err := json.Unmarshal(body, &searchResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	// Fetch full details for each ASIN
-	for _, product := range searchResp.Products {
-		result, err := p.GetByID(ctx, product.ASIN)
-		if err != nil {
-			continue // Skip failed lookups
+	if err := decodeJSON(p.Name(), resp, &searchResp); err != nil {
+		return nil, err
+	}
+
+	// Fetch full details for each ASIN, a few at a time. A rate limit or
+	// paused requests stop the lookups not yet started, as they would fail
+	// too.
+	found := make([]*SearchResult, len(searchResp.Products))
+	var mu sync.Mutex
+	var stopErr error
+	fetchEach(p.config.Workers, len(searchResp.Products), func(i int) {
+		mu.Lock()
+		stop := stopErr != nil
+		mu.Unlock()
+		if stop {
+			return
 		}
+		result, err := p.GetByID(ctx, searchResp.Products[i].ASIN)
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable) {
+			mu.Lock()
+			stopErr = err
+			mu.Unlock()
+			return
+		}
+		if err == nil {
+			found[i] = result
+		}
+	})
+
+	for _, result := range found {
 		if result != nil {
 			results = append(results, *result)
 		}
 	}
-
+	if len(results) == 0 && stopErr != nil {
+		return nil, stopErr
+	}
 	return results, nil
 }
 
-// GetByID fetches audiobook metadata by ASIN
-func (p *AudibleProvider) GetByID(ctx context.Context, asin string) (*SearchResult, error) {
-	if asin == "" {
+// audibleRegions lists the marketplaces tried when an ASIN is not available
+// in the provider's own region.
+var audibleRegions = []string{"us", "uk", "ca", "au", "de", "fr", "it", "es", "jp", "in"}
+
+// GetByID fetches audiobook metadata by ASIN or ISBN. ASINs are regional, so
+// an ASIN unknown in the provider's region is looked up in the other
+// marketplaces. An ISBN is resolved to an ASIN through the catalog search.
+func (p *AudibleProvider) GetByID(ctx context.Context, id string) (*SearchResult, error) {
+	if strings.TrimSpace(id) == "" {
 		return nil, fmt.Errorf("ASIN is required")
 	}
+	return cached(ctx, p.config.Cache, cacheKey(p.Name(), "id", id), func() (*SearchResult, error) {
+		return p.getByID(ctx, id)
+	})
+}
+
+func (p *AudibleProvider) getByID(ctx context.Context, id string) (*SearchResult, error) {
+
+	requested := ClassifyIdentifier(id)
+	asin := NormalizeASIN(id)
+
+	book, region, err := p.fetchBookAnyRegion(ctx, asin)
+	if err != nil && requested.Type == IdentifierISBN {
+		var found string
+		found, err = p.findASINByKeyword(ctx, requested.Value)
+		if err == nil {
+			asin = found
+			book, region, err = p.fetchBookAnyRegion(ctx, asin)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := p.convertToSearchResult(book)
+	result.Identifiers = append(result.Identifiers, Identifier{Type: IdentifierASIN, Value: NormalizeASIN(book.ASIN), Region: region})
+	if asin != NormalizeASIN(book.ASIN) {
+		result.Identifiers = append(result.Identifiers, Identifier{Type: IdentifierASIN, Value: asin})
+	}
+	if requested.Type == IdentifierISBN {
+		result.Identifiers = append(result.Identifiers, Identifier{Type: IdentifierISBN, Value: requested.Value})
+	}
+	return result, nil
+}
+
+// fetchBookAnyRegion tries the provider's region first, then the others while
+// the ASIN is not found.
+func (p *AudibleProvider) fetchBookAnyRegion(ctx context.Context, asin string) (*audnexusBook, string, error) {
+	regions := []string{p.region}
+	for _, region := range audibleRegions {
+		if region != p.region {
+			regions = append(regions, region)
+		}
+	}
 
-	asin = strings.ToUpper(url.PathEscape(asin))
+	var lastErr error
+	for _, region := range regions {
+		book, status, err := p.fetchBook(ctx, asin, region)
+		if err == nil {
+			return book, region, nil
+		}
+		lastErr = err
+		if status != http.StatusNotFound && status != http.StatusBadRequest {
+			break
+		}
+	}
+	return nil, "", lastErr
+}
+
+// fetchBook loads one ASIN from audnexus for a region. The HTTP status is
+// returned so callers can tell "not in this region" from other failures.
+func (p *AudibleProvider) fetchBook(ctx context.Context, asin, region string) (*audnexusBook, int, error) {
 	regionQuery := ""
-	if p.region != "us" {
-		regionQuery = "?region=" + p.region
+	if region != "us" {
+		regionQuery = "?region=" + region
 	}
 
-	audnexusURL := fmt.Sprintf("https://api.audnex.us/books/%s%s", asin, regionQuery)
+	audnexusURL := fmt.Sprintf("https://api.audnex.us/books/%s%s", url.PathEscape(asin), regionQuery)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", audnexusURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("ASIN lookup failed: %w", err)
+		return nil, 0, requestError(p.Name(), err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ASIN lookup failed with status: %d", resp.StatusCode)
+	if err := checkResponse(p.Name(), resp); err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	var book audnexusBook
+	if err := decodeJSON(p.Name(), resp, &book); err != nil {
+		return nil, resp.StatusCode, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	if book.ASIN == "" {
+		return nil, resp.StatusCode, fmt.Errorf("invalid response: missing ASIN")
+	}
+
+	return &book, resp.StatusCode, nil
+}
+
+// findASINByKeyword returns the first catalog product matching keywords,
+// e.g. an ISBN.
+func (p *AudibleProvider) findASINByKeyword(ctx context.Context, keywords string) (string, error) {
+	query := url.Values{}
+	query.Set("num_results", "1")
+	query.Set("keywords", keywords)
+
+	searchURL := fmt.Sprintf("https://api.audible%s/1.0/catalog/products?%s", p.getTLD(), query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	var book audnexusBook
-	if err := json.Unmarshal(body, &book); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", requestError(p.Name(), err)
 	}
+	defer resp.Body.Close()
 
-	if book.ASIN == "" {
-		return nil, fmt.Errorf("invalid response: missing ASIN")
+	if err := checkResponse(p.Name(), resp); err != nil {
+		return "", err
+	}
+
+	var searchResp audibleSearchResponse
+	if err := decodeJSON(p.Name(), resp, &searchResp); err != nil {
+		return "", err
+	}
+	if len(searchResp.Products) == 0 {
+		return "", &Error{Provider: p.Name(), Kind: ErrNotFound, Message: fmt.Sprintf("no audiobook found for %s", keywords)}
 	}
 
-	return p.convertToSearchResult(&book), nil
+	return NormalizeASIN(searchResp.Products[0].ASIN), nil
 }
 
 // convertToSearchResult converts audnexus API response to SearchResult
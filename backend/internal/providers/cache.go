@@ -0,0 +1,267 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheEntries bounds how many responses a ResponseCache keeps in
+// memory; older ones are still found on disk.
+const DefaultCacheEntries = 2000
+
+// CacheStats describes a ResponseCache's contents and effectiveness.
+type CacheStats struct {
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries"`
+	TTLSeconds int    `json:"ttl_seconds"`
+	Dir        string `json:"dir,omitempty"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+}
+
+// ResponseCache keeps provider results for a fixed time, keyed by provider
+// and query or ID, in memory and, when it has a directory, on disk so they
+// survive restarts. Failed lookups are not cached. A nil ResponseCache
+// caches nothing.
+type ResponseCache struct {
+	ttl        time.Duration
+	dir        string
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+	hits    uint64
+	misses  uint64
+}
+
+// cachedResponse is one result, stored as JSON so callers each get their
+// own copy. It is also the format of the files on disk.
+type cachedResponse struct {
+	Key     string          `json:"key"`
+	Expires time.Time       `json:"expires"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewResponseCache creates a cache keeping results for ttl, in dir as well as
+// in memory unless dir is empty. It returns nil, caching nothing, when ttl is
+// not positive. Expired files left in dir are removed.
+func NewResponseCache(ttl time.Duration, dir string) *ResponseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	c := &ResponseCache{
+		ttl:        ttl,
+		dir:        dir,
+		maxEntries: DefaultCacheEntries,
+		now:        time.Now,
+		entries:    make(map[string]cachedResponse),
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Printf("provider cache: %v; caching in memory only", err)
+			c.dir = ""
+		} else {
+			c.removeFiles(func(resp cachedResponse) bool { return !c.now().Before(resp.Expires) })
+		}
+	}
+	return c
+}
+
+type bypassKey struct{}
+
+// WithoutCache returns a context whose lookups skip cached results and go to
+// the provider. Fresh results still replace the cached ones.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// cacheKey joins a provider name, the kind of lookup and its parameters.
+// Parameters are compared case-insensitively.
+func cacheKey(provider, kind string, params ...string) string {
+	parts := []string{provider, kind}
+	for _, p := range params {
+		parts = append(parts, strings.ToLower(strings.TrimSpace(p)))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// cached returns the result cached under key, calling fetch and caching its
+// result on a miss or when ctx bypasses the cache.
+func cached[T any](ctx context.Context, c *ResponseCache, key string, fetch func() (T, error)) (T, error) {
+	if c == nil {
+		return fetch()
+	}
+	if !cacheBypassed(ctx) {
+		var value T
+		if c.get(key, &value) {
+			return value, nil
+		}
+	}
+	value, err := fetch()
+	if err != nil {
+		return value, err
+	}
+	c.set(key, value)
+	return value, nil
+}
+
+// get decodes the result cached under key into v, looking on disk when it
+// is not in memory.
+func (c *ResponseCache) get(key string, v interface{}) bool {
+	c.mu.Lock()
+	resp, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if !ok && c.dir != "" {
+		resp, ok = c.readFile(key)
+	}
+	if ok && c.now().Before(resp.Expires) && json.Unmarshal(resp.Data, v) == nil {
+		c.mu.Lock()
+		c.hits++
+		c.store(resp)
+		c.mu.Unlock()
+		return true
+	}
+
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+	return false
+}
+
+func (c *ResponseCache) set(key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	resp := cachedResponse{Key: key, Expires: c.now().Add(c.ttl), Data: data}
+
+	c.mu.Lock()
+	c.store(resp)
+	c.mu.Unlock()
+
+	if c.dir != "" {
+		if err := c.writeFile(resp); err != nil {
+			log.Printf("provider cache: %v", err)
+		}
+	}
+}
+
+// store adds an entry to memory, first making room by dropping expired
+// entries and, if that is not enough, an arbitrary one. c.mu must be held.
+func (c *ResponseCache) store(resp cachedResponse) {
+	now := c.now()
+	if _, ok := c.entries[resp.Key]; !ok && len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.Expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[resp.Key] = resp
+}
+
+// path names the file of key after its hash, as keys hold arbitrary text.
+func (c *ResponseCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *ResponseCache) readFile(key string) (cachedResponse, bool) {
+	var resp cachedResponse
+	data, err := os.ReadFile(c.path(key))
+	if err != nil || json.Unmarshal(data, &resp) != nil || resp.Key != key {
+		return cachedResponse{}, false
+	}
+	return resp, true
+}
+
+// writeFile replaces the file of resp.Key through a rename, so readers
+// never see it half written.
+func (c *ResponseCache) writeFile(resp cachedResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(resp.Key))
+}
+
+// removeFiles deletes the cache files for which match returns true, and any
+// that cannot be read.
+func (c *ResponseCache) removeFiles(match func(cachedResponse) bool) {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		var resp cachedResponse
+		data, err := os.ReadFile(path)
+		if err != nil || json.Unmarshal(data, &resp) != nil || match(resp) {
+			os.Remove(path)
+		}
+	}
+}
+
+// Clear drops every cached result, in memory and on disk.
+func (c *ResponseCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	clear(c.entries)
+	c.mu.Unlock()
+	if c.dir != "" {
+		c.removeFiles(func(cachedResponse) bool { return true })
+	}
+}
+
+// Stats reports the number of results in memory and the hits and misses so
+// far.
+func (c *ResponseCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:    len(c.entries),
+		MaxEntries: c.maxEntries,
+		TTLSeconds: int(c.ttl / time.Second),
+		Dir:        c.dir,
+		Hits:       c.hits,
+		Misses:     c.misses,
+	}
+}
@@ -0,0 +1,187 @@
+package providers
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AllProviders is the provider name that searches every registered provider.
+const AllProviders = "all"
+
+// SearchAll searches every provider at once and merges their results: books
+// found by several providers, because they share an ASIN or ISBN or have the
+// same title and author, become one result listing each source. Results are
+// scored against the query in Confidence and sorted best first. Providers
+// that fail are left out; an error is returned only when all of them fail.
+func (r *Registry) SearchAll(ctx context.Context, title, author string) ([]SearchResult, error) {
+	providers := r.list()
+	lists := make([][]SearchResult, len(providers))
+	errs := make([]error, len(providers))
+	fetchEach(len(providers), len(providers), func(i int) {
+		lists[i], errs[i] = providers[i].Search(ctx, title, author)
+	})
+
+	var all []SearchResult
+	failed := 0
+	for i, list := range lists {
+		if errs[i] != nil {
+			log.Printf("metadata search: %v", errs[i])
+			failed++
+			continue
+		}
+		all = append(all, list...)
+	}
+	if failed > 0 && failed == len(errs) {
+		return nil, errs[0]
+	}
+
+	for i := range all {
+		score := MatchScore(title, author, &all[i])
+		all[i].Confidence = &score
+	}
+	return mergeResults(all), nil
+}
+
+// mergeResults groups results describing the same book. Each group keeps
+// its best scoring result, earlier ones winning ties, with the sources and
+// identifiers of the whole group.
+func mergeResults(results []SearchResult) []SearchResult {
+	parent := make([]int, len(results))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	first := make(map[string]int)
+	join := func(key string, i int) {
+		if j, ok := first[key]; ok {
+			if a, b := find(i), find(j); a != b {
+				parent[max(a, b)] = min(a, b)
+			}
+			return
+		}
+		first[key] = i
+	}
+	for i := range results {
+		for _, id := range ResultIdentifiers(&results[i]) {
+			join(id.Type+":"+id.Value, i)
+		}
+		if key := bookKey(&results[i]); key != "" {
+			join("book:"+key, i)
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range results {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	merged := make([]SearchResult, 0, len(roots))
+	for _, root := range roots {
+		members := groups[root]
+		best := members[0]
+		for _, i := range members[1:] {
+			if *results[i].Confidence > *results[best].Confidence {
+				best = i
+			}
+		}
+
+		result := results[best]
+		result.Sources = []ResultSource{{Provider: result.Provider, ExternalID: result.ExternalID}}
+		result.Identifiers = nil
+		seenSource := map[ResultSource]bool{result.Sources[0]: true}
+		seenID := make(map[string]bool)
+		for _, i := range append([]int{best}, members...) {
+			source := ResultSource{Provider: results[i].Provider, ExternalID: results[i].ExternalID}
+			if !seenSource[source] {
+				seenSource[source] = true
+				result.Sources = append(result.Sources, source)
+			}
+			for _, id := range ResultIdentifiers(&results[i]) {
+				if key := id.Type + ":" + id.Value; !seenID[key] {
+					seenID[key] = true
+					result.Identifiers = append(result.Identifiers, id)
+				}
+			}
+		}
+		merged = append(merged, result)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		if *merged[i].Confidence != *merged[j].Confidence {
+			return *merged[i].Confidence > *merged[j].Confidence
+		}
+		return len(merged[i].Sources) > len(merged[j].Sources)
+	})
+	return merged
+}
+
+// bookKey identifies a book by its title and first author, or is empty when
+// either is missing.
+func bookKey(result *SearchResult) string {
+	author, _, _ := strings.Cut(result.Author, ",")
+	titleWords, authorWords := words(result.Title), words(author)
+	if len(titleWords) == 0 || len(authorWords) == 0 {
+		return ""
+	}
+	return strings.Join(titleWords, " ") + "|" + strings.Join(authorWords, " ")
+}
+
+// MatchScore rates how well result matches a title and author query, from
+// 0 to 1. The title counts for 70% when an author is given.
+func MatchScore(title, author string, result *SearchResult) float64 {
+	score := similarity(title, result.Title)
+	if result.Subtitle != nil {
+		score = max(score, similarity(title, result.Title+" "+*result.Subtitle))
+	}
+	if strings.TrimSpace(author) != "" {
+		score = 0.7*score + 0.3*similarity(author, result.Author)
+	}
+	return math.Round(score*100) / 100
+}
+
+// similarity is the Dice coefficient of the distinct words of a and b.
+func similarity(a, b string) float64 {
+	wa, wb := wordSet(a), wordSet(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wa)+len(wb))
+}
+
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range words(s) {
+		set[w] = true
+	}
+	return set
+}
+
+// words lowercases s and splits it into runs of letters and digits,
+// spelling out "&".
+func words(s string) []string {
+	s = strings.ToLower(strings.ReplaceAll(s, "&", " and "))
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/httpclient"
+)
+
+// Error kinds. Match them with errors.Is; the details live in *Error.
+var (
+	// ErrRateLimited means the provider asked us to slow down (HTTP 429).
+	ErrRateLimited = errors.New("provider rate limit exceeded")
+	// ErrNotFound means the provider has no record for the requested ID.
+	ErrNotFound = errors.New("not found at provider")
+	// ErrTemporary covers outages, timeouts and HTML error pages that are
+	// likely to go away on a retry.
+	ErrTemporary = errors.New("provider temporarily unavailable")
+	// ErrUnavailable means requests are paused because the provider kept
+	// failing (its circuit breaker is open); RetryAfter says for how long.
+	ErrUnavailable = errors.New("provider requests paused after repeated failures")
+)
+
+// Error describes a failed provider request.
+type Error struct {
+	Provider   string
+	Kind       error // one of the Err* kinds above, or nil
+	StatusCode int
+	// RetryAfter is the delay requested by the provider, if any.
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" && e.Kind != nil {
+		msg = e.Kind.Error()
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: %s (status %d)", e.Provider, msg, e.StatusCode)
+	}
+	return fmt.Sprintf("%s: %s", e.Provider, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// RetryAfter returns the delay a provider requested in err, or zero.
+func RetryAfter(err error) time.Duration {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.RetryAfter
+	}
+	return 0
+}
+
+// checkResponse turns a non-200 response into a typed error.
+func checkResponse(provider string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	perr := &Error{Provider: provider, StatusCode: resp.StatusCode}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		perr.Kind = ErrRateLimited
+		perr.RetryAfter = httpclient.ParseRetryAfter(resp.Header.Get("Retry-After"))
+	case resp.StatusCode == http.StatusNotFound:
+		perr.Kind = ErrNotFound
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		perr.Kind = ErrTemporary
+		perr.RetryAfter = httpclient.ParseRetryAfter(resp.Header.Get("Retry-After"))
+	default:
+		perr.Message = "request failed"
+	}
+	return perr
+}
+
+// requestError wraps a transport failure, which is usually transient.
+func requestError(provider string, err error) error {
+	var open *httpclient.OpenError
+	if errors.As(err, &open) {
+		return &Error{Provider: provider, Kind: ErrUnavailable, RetryAfter: time.Until(open.Until)}
+	}
+	return &Error{Provider: provider, Kind: ErrTemporary, Message: err.Error()}
+}
+
+// decodeJSON reads a JSON response body into v. HTML pages (typically a
+// captcha or error page served with status 200) are reported as temporary
+// failures rather than parse errors.
+func decodeJSON(provider string, resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return requestError(provider, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/html") || bytes.HasPrefix(trimmed, []byte("<")) {
+		return &Error{Provider: provider, Kind: ErrTemporary, StatusCode: resp.StatusCode, Message: "returned an HTML page instead of JSON"}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return &Error{Provider: provider, StatusCode: resp.StatusCode, Message: fmt.Sprintf("unexpected response: %v", err)}
+	}
+	return nil
+}
@@ -2,14 +2,14 @@ package providers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"html"
-	"io"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+
+	"github.com/lore/backend/internal/httpclient"
 )
 
 // GoogleBooksProvider implements metadata search via Google Books API
@@ -25,7 +25,7 @@ func NewGoogleBooksProvider(config *ProviderConfig) *GoogleBooksProvider {
 	}
 	return &GoogleBooksProvider{
 		config: config,
-		client: &http.Client{Timeout: config.Timeout},
+		client: httpclient.New(httpclient.Options{Name: "google", Timeout: config.Timeout}),
 	}
 }
 
@@ -66,7 +66,12 @@ func (p *GoogleBooksProvider) Search(ctx context.Context, title, author string)
 	if title == "" {
 		return nil, nil
 	}
+	return cached(ctx, p.config.Cache, cacheKey(p.Name(), "search", title, author), func() ([]SearchResult, error) {
+		return p.search(ctx, title, author)
+	})
+}
 
+func (p *GoogleBooksProvider) search(ctx context.Context, title, author string) ([]SearchResult, error) {
 	// Build query
 	query := fmt.Sprintf("intitle:%s", url.QueryEscape(title))
 	if author != "" {
@@ -82,22 +87,17 @@ func (p *GoogleBooksProvider) Search(ctx context.Context, title, author string)
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("search request failed: %w", err)
+		return nil, requestError(p.Name(), err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search failed with status: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	if err := checkResponse(p.Name(), resp); err != nil {
+		return nil, err
 	}
 
 	var apiResp googleBooksResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if err := decodeJSON(p.Name(), resp, &apiResp); err != nil {
+		return nil, err
 	}
 
 	var results []SearchResult
@@ -116,6 +116,12 @@ func (p *GoogleBooksProvider) GetByID(ctx context.Context, id string) (*SearchRe
 	if id == "" {
 		return nil, fmt.Errorf("volume ID is required")
 	}
+	return cached(ctx, p.config.Cache, cacheKey(p.Name(), "id", id), func() (*SearchResult, error) {
+		return p.getByID(ctx, id)
+	})
+}
+
+func (p *GoogleBooksProvider) getByID(ctx context.Context, id string) (*SearchResult, error) {
 
 	volumeURL := fmt.Sprintf("https://www.googleapis.com/books/v1/volumes/%s", url.PathEscape(id))
 
@@ -126,22 +132,17 @@ func (p *GoogleBooksProvider) GetByID(ctx context.Context, id string) (*SearchRe
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("volume lookup failed: %w", err)
+		return nil, requestError(p.Name(), err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("volume lookup failed with status: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	if err := checkResponse(p.Name(), resp); err != nil {
+		return nil, err
 	}
 
 	var item googleBooksItem
-	if err := json.Unmarshal(body, &item); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if err := decodeJSON(p.Name(), resp, &item); err != nil {
+		return nil, err
 	}
 
 	return p.convertToSearchResult(&item), nil
@@ -220,6 +221,12 @@ func (p *GoogleBooksProvider) convertToSearchResult(item *googleBooksItem) *Sear
 				}
 			}
 		}
+		// Keep both forms so either one matches on lookup
+		for _, id := range vol.IndustryIdentifiers {
+			if isbn := NormalizeISBN(id.Identifier); isbn != "" {
+				result.Identifiers = append(result.Identifiers, Identifier{Type: IdentifierISBN, Value: isbn})
+			}
+		}
 	}
 
 	// Genres/Categories
@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lore/backend/internal/httpclient"
+)
+
+// Provider health states.
+const (
+	// HealthUnknown means the provider has not been contacted since startup.
+	HealthUnknown = "unknown"
+	HealthOK      = "healthy"
+	// HealthDegraded means the latest request to one of the provider's
+	// hosts failed, or a trial request is deciding whether it recovered.
+	HealthDegraded = "degraded"
+	// HealthDown means requests to one of its hosts are paused.
+	HealthDown = "down"
+)
+
+// Health summarizes a provider's recent requests from the counters of its
+// HTTP client.
+type Health struct {
+	Provider string `json:"provider"`
+	Status   string `json:"status"`
+	// RetryAt is when a provider that is down is tried again.
+	RetryAt *time.Time             `json:"retry_at,omitempty"`
+	Hosts   []httpclient.HostStats `json:"hosts"`
+}
+
+// clientNamer is implemented by providers whose HTTP client is named other
+// than the provider, e.g. every Audible region shares the "audible" client
+// and every iTunes store the "itunes" one.
+type clientNamer interface {
+	clientName() string
+}
+
+func (p *AudibleProvider) clientName() string {
+	return "audible"
+}
+
+// Health reports the health of every registered provider, by name.
+func (r *Registry) Health() []Health {
+	list := r.list()
+	result := make([]Health, 0, len(list))
+	for _, p := range list {
+		name := p.Name()
+		client := name
+		if n, ok := p.(clientNamer); ok {
+			client = n.clientName()
+		}
+		result = append(result, providerHealth(name, httpclient.ClientStats(client)))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Provider < result[j].Provider })
+	return result
+}
+
+func providerHealth(name string, hosts []httpclient.HostStats) Health {
+	h := Health{Provider: name, Status: HealthUnknown, Hosts: hosts}
+	for _, host := range hosts {
+		status := HealthOK
+		switch {
+		case host.Breaker == httpclient.BreakerOpen:
+			status = HealthDown
+			if h.RetryAt == nil || host.OpenUntil.Before(*h.RetryAt) {
+				h.RetryAt = host.OpenUntil
+			}
+		case host.Breaker == httpclient.BreakerHalfOpen:
+			status = HealthDegraded
+		case host.LastFailure != nil && (host.LastSuccess == nil || host.LastFailure.After(*host.LastSuccess)):
+			status = HealthDegraded
+		}
+		if healthRank[status] > healthRank[h.Status] {
+			h.Status = status
+		}
+	}
+	return h
+}
+
+var healthRank = map[string]int{HealthUnknown: 0, HealthOK: 1, HealthDegraded: 2, HealthDown: 3}
@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"strings"
+)
+
+// Identifier types.
+const (
+	IdentifierASIN = "asin"
+	IdentifierISBN = "isbn"
+)
+
+// Identifier is one external identifier known for a book. The same audiobook
+// typically has a different ASIN per Audible marketplace.
+type Identifier struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Region string `json:"region,omitempty"`
+}
+
+// ClassifyIdentifier normalizes a user supplied identifier and reports
+// whether it is an ISBN (10 or 13 digits, hyphens allowed) or an ASIN.
+func ClassifyIdentifier(raw string) Identifier {
+	if isbn := NormalizeISBN(raw); isbn != "" {
+		return Identifier{Type: IdentifierISBN, Value: isbn}
+	}
+	return Identifier{Type: IdentifierASIN, Value: NormalizeASIN(raw)}
+}
+
+// NormalizeASIN uppercases and trims an ASIN.
+func NormalizeASIN(raw string) string {
+	return strings.ToUpper(strings.TrimSpace(raw))
+}
+
+// NormalizeISBN strips separators from an ISBN and returns it when it has a
+// valid ISBN-10 or ISBN-13 shape, or "" otherwise.
+func NormalizeISBN(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(raw) {
+		switch {
+		case r >= '0' && r <= '9', r == 'X':
+			b.WriteRune(r)
+		case r == '-' || r == ' ':
+		default:
+			return ""
+		}
+	}
+	isbn := b.String()
+
+	switch len(isbn) {
+	case 10:
+		if strings.ContainsRune(isbn[:9], 'X') {
+			return ""
+		}
+		return isbn
+	case 13:
+		if strings.ContainsRune(isbn, 'X') {
+			return ""
+		}
+		return isbn
+	default:
+		return ""
+	}
+}
+
+// ISBNVariants returns the ISBN together with its ISBN-13 form when the
+// input is an ISBN-10, so either spelling matches stored identifiers.
+func ISBNVariants(isbn string) []string {
+	variants := []string{isbn}
+	if len(isbn) == 10 {
+		variants = append(variants, isbn10To13(isbn))
+	}
+	return variants
+}
+
+// isbn10To13 converts an ISBN-10 to its 978-prefixed ISBN-13.
+func isbn10To13(isbn10 string) string {
+	digits := "978" + isbn10[:9]
+	sum := 0
+	for i, r := range digits {
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	check := (10 - sum%10) % 10
+	return digits + string(rune('0'+check))
+}
+
+// ResultIdentifiers collects the identifiers carried by a search result.
+func ResultIdentifiers(result *SearchResult) []Identifier {
+	var ids []Identifier
+	seen := make(map[string]bool)
+	add := func(id Identifier) {
+		if id.Value == "" {
+			return
+		}
+		key := id.Type + ":" + id.Value
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		ids = append(ids, id)
+	}
+
+	for _, id := range result.Identifiers {
+		add(id)
+	}
+	if result.ASIN != nil {
+		add(Identifier{Type: IdentifierASIN, Value: NormalizeASIN(*result.ASIN)})
+	}
+	if result.ISBN != nil {
+		if isbn := NormalizeISBN(*result.ISBN); isbn != "" {
+			for _, variant := range ISBNVariants(isbn) {
+				add(Identifier{Type: IdentifierISBN, Value: variant})
+			}
+		}
+	}
+	return ids
+}
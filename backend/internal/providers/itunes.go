@@ -0,0 +1,215 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lore/backend/internal/httpclient"
+)
+
+// ITunesProvider implements metadata search via the iTunes Search API, which
+// covers Apple Books audiobooks. It fills gaps in Audible's catalog for some
+// regions and publishers, but has no narrators, series or durations.
+type ITunesProvider struct {
+	config  *ProviderConfig
+	client  *http.Client
+	country string // ISO 3166 country code of the store, e.g. us, gb, de
+}
+
+// NewITunesProvider creates a new iTunes provider for a store country
+func NewITunesProvider(country string, config *ProviderConfig) *ITunesProvider {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if country == "" {
+		country = "us"
+	}
+	return &ITunesProvider{
+		config:  config,
+		client:  httpclient.New(httpclient.Options{Name: "itunes", Timeout: config.Timeout}),
+		country: strings.ToLower(country),
+	}
+}
+
+// Name returns the provider name
+func (p *ITunesProvider) Name() string {
+	if p.country == "us" {
+		return "itunes"
+	}
+	return fmt.Sprintf("itunes.%s", p.country)
+}
+
+func (p *ITunesProvider) clientName() string {
+	return "itunes"
+}
+
+// itunesResponse represents the response of the search and lookup APIs
+type itunesResponse struct {
+	ResultCount int            `json:"resultCount"`
+	Results     []itunesResult `json:"results"`
+}
+
+type itunesResult struct {
+	WrapperType      string `json:"wrapperType"` // "audiobook" for audiobooks
+	CollectionID     int64  `json:"collectionId"`
+	CollectionName   string `json:"collectionName"`
+	ArtistName       string `json:"artistName"`
+	ArtworkURL100    string `json:"artworkUrl100"`
+	ArtworkURL60     string `json:"artworkUrl60"`
+	ReleaseDate      string `json:"releaseDate"`
+	PrimaryGenreName string `json:"primaryGenreName"`
+	Description      string `json:"description"`
+	Copyright        string `json:"copyright"`
+}
+
+// Search searches the iTunes store for audiobooks by title and author
+func (p *ITunesProvider) Search(ctx context.Context, title, author string) ([]SearchResult, error) {
+	if title == "" {
+		return nil, nil
+	}
+	return cached(ctx, p.config.Cache, cacheKey(p.Name(), "search", title, author), func() ([]SearchResult, error) {
+		return p.search(ctx, title, author)
+	})
+}
+
+func (p *ITunesProvider) search(ctx context.Context, title, author string) ([]SearchResult, error) {
+	term := title
+	if author != "" {
+		term += " " + author
+	}
+
+	query := url.Values{}
+	query.Set("term", term)
+	query.Set("media", "audiobook")
+	query.Set("entity", "audiobook")
+	query.Set("country", p.country)
+	query.Set("limit", "10")
+
+	var apiResp itunesResponse
+	if err := p.get(ctx, "https://itunes.apple.com/search?"+query.Encode(), &apiResp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for i := range apiResp.Results {
+		if result := p.convertToSearchResult(&apiResp.Results[i]); result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
+// GetByID fetches audiobook metadata by iTunes collection ID
+func (p *ITunesProvider) GetByID(ctx context.Context, id string) (*SearchResult, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, fmt.Errorf("collection ID is required")
+	}
+	return cached(ctx, p.config.Cache, cacheKey(p.Name(), "id", id), func() (*SearchResult, error) {
+		return p.getByID(ctx, id)
+	})
+}
+
+func (p *ITunesProvider) getByID(ctx context.Context, id string) (*SearchResult, error) {
+	// Store IDs are numeric; anything else, e.g. an ASIN, is unknown here.
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, &Error{Provider: p.Name(), Kind: ErrNotFound, Message: fmt.Sprintf("%s is not an iTunes ID", id)}
+	}
+
+	query := url.Values{}
+	query.Set("id", id)
+	query.Set("entity", "audiobook")
+	query.Set("country", p.country)
+
+	var apiResp itunesResponse
+	if err := p.get(ctx, "https://itunes.apple.com/lookup?"+query.Encode(), &apiResp); err != nil {
+		return nil, err
+	}
+	for i := range apiResp.Results {
+		if result := p.convertToSearchResult(&apiResp.Results[i]); result != nil {
+			return result, nil
+		}
+	}
+	return nil, &Error{Provider: p.Name(), Kind: ErrNotFound, Message: fmt.Sprintf("no audiobook found for %s", id)}
+}
+
+// get loads an API URL into v.
+func (p *ITunesProvider) get(ctx context.Context, apiURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return requestError(p.Name(), err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(p.Name(), resp); err != nil {
+		return err
+	}
+	return decodeJSON(p.Name(), resp, v)
+}
+
+// convertToSearchResult converts an iTunes result to SearchResult, skipping
+// anything that is not an audiobook
+func (p *ITunesProvider) convertToSearchResult(item *itunesResult) *SearchResult {
+	if item.WrapperType != "audiobook" || item.CollectionID == 0 || item.CollectionName == "" {
+		return nil
+	}
+
+	result := &SearchResult{
+		Provider:   p.Name(),
+		ExternalID: strconv.FormatInt(item.CollectionID, 10),
+		Title:      item.CollectionName,
+		Author:     item.ArtistName,
+	}
+
+	// Published year
+	if len(item.ReleaseDate) >= 4 {
+		year := item.ReleaseDate[:4]
+		result.PublishedYear = &year
+	}
+
+	// Description
+	if item.Description != "" {
+		cleaned := stripHTML(item.Description)
+		result.Description = &cleaned
+	}
+
+	// Cover
+	if cover := itunesArtwork(item.ArtworkURL100, item.ArtworkURL60); cover != "" {
+		result.CoverURL = &cover
+	}
+
+	// Genre; the store files audiobooks under "Audiobooks" at the top
+	if item.PrimaryGenreName != "" && item.PrimaryGenreName != "Audiobooks" {
+		result.Genres = []string{item.PrimaryGenreName}
+	}
+
+	return result
+}
+
+// artworkSize matches the size suffix of an artwork URL, e.g.
+// ".../100x100bb.jpg".
+var artworkSize = regexp.MustCompile(`/\d+x\d+bb\.(jpg|png)$`)
+
+// itunesArtwork returns the first of urls rewritten to request the original
+// image: the artwork server scales to the size named in the URL, and the
+// oversized "100000x100000-999" variant is served at full resolution.
+func itunesArtwork(urls ...string) string {
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		u = strings.Replace(u, "http:", "https:", 1)
+		return artworkSize.ReplaceAllString(u, "/100000x100000-999.$1")
+	}
+	return ""
+}
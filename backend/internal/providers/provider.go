@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"sync"
 	"time"
 )
 
@@ -32,14 +33,16 @@ type SearchResult struct {
 	CoverURL    *string `json:"cover_url,omitempty"`
 
 	// Additional metadata
-	Publisher     *string  `json:"publisher,omitempty"`
-	PublishedYear *string  `json:"published_year,omitempty"`
-	Language      *string  `json:"language,omitempty"`
-	ISBN          *string  `json:"isbn,omitempty"`
-	ASIN          *string  `json:"asin,omitempty"`
-	DurationMin   *float64 `json:"duration_min,omitempty"` // Duration in minutes
-	Rating        *float64 `json:"rating,omitempty"`
-	RatingCount   *int     `json:"rating_count,omitempty"`
+	Publisher     *string `json:"publisher,omitempty"`
+	PublishedYear *string `json:"published_year,omitempty"`
+	Language      *string `json:"language,omitempty"`
+	ISBN          *string `json:"isbn,omitempty"`
+	ASIN          *string `json:"asin,omitempty"`
+	// Identifiers lists every known ASIN/ISBN, including other editions.
+	Identifiers []Identifier `json:"identifiers,omitempty"`
+	DurationMin *float64     `json:"duration_min,omitempty"` // Duration in minutes
+	Rating      *float64     `json:"rating,omitempty"`
+	RatingCount *int         `json:"rating_count,omitempty"`
 
 	// Series info
 	SeriesName     *string `json:"series_name,omitempty"`
@@ -51,16 +54,51 @@ type SearchResult struct {
 
 	// Match confidence (0.0 - 1.0)
 	Confidence *float64 `json:"confidence,omitempty"`
+	// Sources lists every provider that returned this book in a combined
+	// search, this result's own provider first.
+	Sources []ResultSource `json:"sources,omitempty"`
+}
+
+// ResultSource is a provider's ID for a book found in a combined search;
+// any of them can be linked.
+type ResultSource struct {
+	Provider   string `json:"provider"`
+	ExternalID string `json:"external_id"`
 }
 
 // ProviderConfig holds configuration for providers
 type ProviderConfig struct {
 	Timeout time.Duration
+	// Cache keeps search and lookup results; nil disables caching.
+	Cache *ResponseCache
+	// Workers bounds how many detail lookups one search makes at once.
+	Workers int
 }
 
 // DefaultConfig returns default provider configuration
 func DefaultConfig() *ProviderConfig {
 	return &ProviderConfig{
 		Timeout: 30 * time.Second,
+		Workers: 4,
+	}
+}
+
+// fetchEach calls fetch for the indexes 0..n-1 with at most workers calls
+// running at once, and waits for them to finish.
+func fetchEach(workers, n int, fetch func(i int)) {
+	if workers <= 0 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetch(i)
+		}(i)
 	}
+	wg.Wait()
 }
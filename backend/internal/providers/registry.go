@@ -0,0 +1,87 @@
+package providers
+
+import "sync"
+
+// Registry hands out metadata providers by name. Retries and backoff for
+// rate-limited and temporary failures happen in the providers' HTTP clients
+// (see the httpclient package). Providers can be added and removed while
+// the server runs, e.g. metadata agents configured by an admin.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+	// names lists the providers in the order given, which breaks ties in
+	// combined searches.
+	names []string
+}
+
+// NewRegistry creates a Registry for the given providers.
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// DefaultRegistry registers the built-in Audible (US), Google Books and
+// iTunes (US) providers with config, or the default configuration when it
+// is nil.
+func DefaultRegistry(config *ProviderConfig) *Registry {
+	return NewRegistry(NewAudibleProvider("us", config), NewGoogleBooksProvider(config), NewITunesProvider("us", config))
+}
+
+// Register adds p, replacing any provider of the same name.
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[p.Name()]; !ok {
+		r.names = append(r.names, p.Name())
+	}
+	r.providers[p.Name()] = p
+}
+
+// Unregister removes the named provider, if registered.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[name]; !ok {
+		return
+	}
+	delete(r.providers, name)
+	for i, n := range r.names {
+		if n == name {
+			r.names = append(r.names[:i:i], r.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Get returns the named provider, or nil if it is not registered.
+func (r *Registry) Get(name string) Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[name]
+	if !ok {
+		return nil
+	}
+	return p
+}
+
+// Names returns the names of the registered providers in registration
+// order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.names...)
+}
+
+// list returns the registered providers in registration order.
+func (r *Registry) list() []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Provider, len(r.names))
+	for i, name := range r.names {
+		list[i] = r.providers[name]
+	}
+	return list
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// audiobookAccessFilter restricts a query aliasing audiobooks as "a" to the
+// books the user may see. It expects the user ID to be bound twice.
+// Admins see everything. Others see the books of unrestricted libraries and
+// of restricted libraries they are members of, and of those only the books
+// without access rules or with a rule for them.
+const audiobookAccessFilter = `
+		AND (
+			EXISTS (SELECT 1 FROM users au WHERE au.id = ? AND au.is_admin = 1)
+			OR EXISTS (
+				SELECT 1 FROM (SELECT ? AS id) me
+				LEFT JOIN users au ON au.id = me.id
+				WHERE (NOT EXISTS (SELECT 1 FROM libraries l WHERE l.id = a.library_id AND l.restricted = 1)
+				    OR EXISTS (SELECT 1 FROM library_members lm WHERE lm.library_id = a.library_id AND lm.user_id = me.id))
+				  AND (NOT EXISTS (SELECT 1 FROM audiobook_access aa WHERE aa.audiobook_id = a.id)
+				    OR EXISTS (
+						SELECT 1 FROM audiobook_access aa
+						WHERE aa.audiobook_id = a.id AND au.id IS NOT NULL
+						  AND ((aa.principal_type = 'user' AND aa.principal_id = au.id)
+						    OR (aa.principal_type = 'role' AND aa.principal_id = CASE WHEN au.is_admin = 1 THEN 'admin' ELSE 'user' END))
+					))
+			)
+		)`
+
+// audiobookListFilter is audiobookAccessFilter for listings, which also
+// leave out audiobooks whose folder is missing on disk.
+const audiobookListFilter = audiobookAccessFilter + `
+		AND a.missing_since IS NULL`
+
+// CanUserAccessAudiobook reports whether the user passes the audiobook's access rules.
+func (r *Repository) CanUserAccessAudiobook(ctx context.Context, userID, audiobookID string) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM audiobooks a
+		WHERE a.id = ?`+audiobookAccessFilter, audiobookID, userID, userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CanUserAccessLibrary reports whether the user may see the library: it is
+// unrestricted, or they are an admin or one of its members.
+func (r *Repository) CanUserAccessLibrary(ctx context.Context, userID, libraryID string) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM libraries l
+		WHERE l.id = ?
+		  AND (l.restricted = 0
+		    OR EXISTS (SELECT 1 FROM users au WHERE au.id = ? AND au.is_admin = 1)
+		    OR EXISTS (SELECT 1 FROM library_members lm WHERE lm.library_id = l.id AND lm.user_id = ?))
+	`, libraryID, userID, userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetLibraryAccess returns whether a library is restricted and its members.
+func (r *Repository) GetLibraryAccess(ctx context.Context, libraryID string) (*models.LibraryAccess, error) {
+	access := &models.LibraryAccess{LibraryID: libraryID, UserIDs: []string{}}
+	err := r.db.QueryRowContext(ctx, `SELECT restricted FROM libraries WHERE id = ?`, libraryID).Scan(&access.Restricted)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id FROM library_members
+		WHERE library_id = ?
+		ORDER BY user_id
+	`, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		access.UserIDs = append(access.UserIDs, userID)
+	}
+	return access, rows.Err()
+}
+
+// SetLibraryAccess restricts a library or lifts its restriction and
+// replaces its members. It returns sql.ErrNoRows for an unknown library.
+func (r *Repository) SetLibraryAccess(ctx context.Context, libraryID string, restricted bool, userIDs []string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, `UPDATE libraries SET restricted = ?, updated_at = ? WHERE id = ?`, boolToInt(restricted), now, libraryID)
+	if err != nil {
+		return err
+	}
+	if n, rowsErr := res.RowsAffected(); rowsErr == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM library_members WHERE library_id = ?`, libraryID); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		_, err = tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO library_members (library_id, user_id, created_at)
+			VALUES (?, ?, ?)
+		`, libraryID, userID, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UserExists reports whether a user with the given ID exists.
+func (r *Repository) UserExists(ctx context.Context, userID string) (bool, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE id = ?`, userID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListAudiobookAccess returns the access rules configured for an audiobook.
+func (r *Repository) ListAudiobookAccess(ctx context.Context, audiobookID string) ([]models.AudiobookAccessRule, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT audiobook_id, principal_type, principal_id, created_at
+		FROM audiobook_access
+		WHERE audiobook_id = ?
+		ORDER BY principal_type, principal_id
+	`, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.AudiobookAccessRule{}
+	for rows.Next() {
+		var rule models.AudiobookAccessRule
+		var createdAt string
+		if err := rows.Scan(&rule.AudiobookID, &rule.PrincipalType, &rule.PrincipalID, &createdAt); err != nil {
+			return nil, err
+		}
+		rule.CreatedAt = parseTime(createdAt)
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// SetAudiobookAccess replaces the access rules for an audiobook. An empty set
+// removes the restriction.
+func (r *Repository) SetAudiobookAccess(ctx context.Context, audiobookID string, rules []models.AudiobookAccessRule) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM audiobook_access WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, rule := range rules {
+		_, err = tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO audiobook_access (audiobook_id, principal_type, principal_id, created_at)
+			VALUES (?, ?, ?, ?)
+		`, audiobookID, rule.PrincipalType, rule.PrincipalID, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
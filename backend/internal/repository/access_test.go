@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lore/backend/internal/models"
+)
+
+func TestRestrictedLibraryAccess(t *testing.T) {
+	ctx := context.Background()
+	repo := newHouseholdRepo(t)
+	const admin = "00000000-0000-0000-0000-000000000001"
+
+	canSee := func(userID string) bool {
+		t.Helper()
+		allowed, err := repo.CanUserAccessAudiobook(ctx, userID, "book-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+
+	if err := repo.SetLibraryAccess(ctx, "lib-1", true, []string{"bob"}); err != nil {
+		t.Fatal(err)
+	}
+	for userID, want := range map[string]bool{"alice": false, "bob": true, admin: true} {
+		if got := canSee(userID); got != want {
+			t.Errorf("%s sees book-1 in the restricted library: %v, want %v", userID, got, want)
+		}
+		if got, err := repo.CanUserAccessLibrary(ctx, userID, "lib-1"); err != nil || got != want {
+			t.Errorf("CanUserAccessLibrary(%s) = %v, %v; want %v", userID, got, err, want)
+		}
+	}
+
+	// Book rules still apply to members, and do not let non-members in.
+	if err := repo.SetAudiobookAccess(ctx, "book-1", []models.AudiobookAccessRule{{PrincipalType: models.AccessPrincipalUser, PrincipalID: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if canSee("alice") || canSee("bob") {
+		t.Errorf("alice sees book-1: %v, bob: %v; want neither", canSee("alice"), canSee("bob"))
+	}
+	if err := repo.SetAudiobookAccess(ctx, "book-1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.SetLibraryAccess(ctx, "lib-1", false, []string{"bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if !canSee("alice") {
+		t.Error("alice cannot see book-1 once the library is open again")
+	}
+	access, err := repo.GetLibraryAccess(ctx, "lib-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Restricted || len(access.UserIDs) != 1 || access.UserIDs[0] != "bob" {
+		t.Errorf("access = %+v, want an open library keeping member bob", access)
+	}
+
+	if err := repo.SetLibraryAccess(ctx, "missing", true, nil); err == nil {
+		t.Error("restricting an unknown library succeeded")
+	}
+}
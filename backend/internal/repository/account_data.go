@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ListUserProgress returns userID's progress and favourites across every
+// audiobook, most recently played first.
+func (r *Repository) ListUserProgress(ctx context.Context, userID string) ([]models.UserAudiobookData, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, audiobook_id, progress_sec, is_favorite, last_played_at
+		FROM user_audiobook_data
+		WHERE user_id = ?
+		ORDER BY last_played_at DESC, audiobook_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := []models.UserAudiobookData{}
+	for rows.Next() {
+		var data models.UserAudiobookData
+		var lastPlayed sql.NullString
+		if err := rows.Scan(&data.UserID, &data.AudiobookID, &data.ProgressSec, &data.IsFavorite, &lastPlayed); err != nil {
+			return nil, err
+		}
+		if lastPlayed.Valid {
+			t := parseTime(lastPlayed.String)
+			data.LastPlayedAt = &t
+		}
+		progress = append(progress, data)
+	}
+	return progress, rows.Err()
+}
+
+// ListUserSessions returns userID's listening sessions, open and closed,
+// oldest first.
+func (r *Repository) ListUserSessions(ctx context.Context, userID string) ([]models.ListeningSession, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, audiobook_id, started_at, last_active_at, start_position_sec, position_sec, listened_sec, closed_at
+		FROM listening_sessions
+		WHERE user_id = ?
+		ORDER BY started_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.ListeningSession{}
+	for rows.Next() {
+		var session models.ListeningSession
+		var startedAt, lastActiveAt string
+		var closedAt sql.NullString
+		if err := rows.Scan(&session.ID, &session.UserID, &session.AudiobookID, &startedAt, &lastActiveAt,
+			&session.StartPositionSec, &session.PositionSec, &session.ListenedSec, &closedAt); err != nil {
+			return nil, err
+		}
+		session.StartedAt = parseTime(startedAt)
+		session.LastActiveAt = parseTime(lastActiveAt)
+		if closedAt.Valid {
+			t := parseTime(closedAt.String)
+			session.ClosedAt = &t
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// ListUserReviews returns userID's ratings and reviews, newest first.
+func (r *Repository) ListUserReviews(ctx context.Context, userID string) ([]models.Review, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, audiobook_id, rating, review, created_at, updated_at
+		FROM user_reviews
+		WHERE user_id = ?
+		ORDER BY updated_at DESC, audiobook_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		var review models.Review
+		var text sql.NullString
+		var createdAt, updatedAt string
+		if err := rows.Scan(&review.UserID, &review.AudiobookID, &review.Rating, &text, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		review.Review = nullableString(text)
+		review.CreatedAt = parseTime(createdAt)
+		review.UpdatedAt = parseTime(updatedAt)
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// ListUserBookmarks returns userID's bookmarks in every audiobook.
+func (r *Repository) ListUserBookmarks(ctx context.Context, userID string) ([]models.Bookmark, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, audiobook_id, position_sec, title, created_at
+		FROM user_bookmarks
+		WHERE user_id = ?
+		ORDER BY audiobook_id, position_sec, created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []models.Bookmark{}
+	for rows.Next() {
+		var bookmark models.Bookmark
+		var createdAt string
+		if err := rows.Scan(&bookmark.ID, &bookmark.AudiobookID, &bookmark.PositionSec, &bookmark.Title, &createdAt); err != nil {
+			return nil, err
+		}
+		bookmark.CreatedAt = parseTime(createdAt)
+		bookmarks = append(bookmarks, bookmark)
+	}
+	return bookmarks, rows.Err()
+}
+
+const erasureRequestColumns = `
+	e.id, e.user_id, COALESCE(u.username, ''), e.reason, e.status, e.requested_at, e.decided_at, e.decided_by, e.note`
+
+func scanErasureRequest(row interface{ Scan(...interface{}) error }) (*models.ErasureRequest, error) {
+	var req models.ErasureRequest
+	var reason, decidedAt, decidedBy, note sql.NullString
+	var requestedAt string
+	if err := row.Scan(&req.ID, &req.UserID, &req.Username, &reason, &req.Status, &requestedAt,
+		&decidedAt, &decidedBy, &note); err != nil {
+		return nil, err
+	}
+	req.Reason = nullableString(reason)
+	req.RequestedAt = parseTime(requestedAt)
+	if decidedAt.Valid {
+		t := parseTime(decidedAt.String)
+		req.DecidedAt = &t
+	}
+	req.DecidedBy = nullableString(decidedBy)
+	req.Note = nullableString(note)
+	return &req, nil
+}
+
+// CreateErasureRequest records userID's request to have their account
+// erased.
+func (r *Repository) CreateErasureRequest(ctx context.Context, userID string, reason *string) (*models.ErasureRequest, error) {
+	id := uuid.NewString()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO erasure_requests (id, user_id, reason, status, requested_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, userID, sqlNullString(reason), models.ErasurePending, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	return r.GetErasureRequest(ctx, id)
+}
+
+// GetErasureRequest returns an erasure request, or sql.ErrNoRows if there
+// is none.
+func (r *Repository) GetErasureRequest(ctx context.Context, id string) (*models.ErasureRequest, error) {
+	return scanErasureRequest(r.db.QueryRowContext(ctx, `
+		SELECT `+erasureRequestColumns+`
+		FROM erasure_requests e LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.id = ?
+	`, id))
+}
+
+// GetLatestErasureRequest returns userID's most recent erasure request, or
+// sql.ErrNoRows if they never made one.
+func (r *Repository) GetLatestErasureRequest(ctx context.Context, userID string) (*models.ErasureRequest, error) {
+	return scanErasureRequest(r.db.QueryRowContext(ctx, `
+		SELECT `+erasureRequestColumns+`
+		FROM erasure_requests e LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.user_id = ?
+		ORDER BY e.requested_at DESC, e.id
+		LIMIT 1
+	`, userID))
+}
+
+// ListErasureRequests returns erasure requests with the given status, or
+// all of them when status is empty, oldest first.
+func (r *Repository) ListErasureRequests(ctx context.Context, status string) ([]models.ErasureRequest, error) {
+	query := `
+		SELECT ` + erasureRequestColumns + `
+		FROM erasure_requests e LEFT JOIN users u ON u.id = e.user_id`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE e.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY e.requested_at, e.id`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.ErasureRequest{}
+	for rows.Next() {
+		req, err := scanErasureRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// CancelErasureRequest removes userID's pending erasure request, or returns
+// sql.ErrNoRows if they have none.
+func (r *Repository) CancelErasureRequest(ctx context.Context, userID string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM erasure_requests WHERE user_id = ? AND status = ?
+	`, userID, models.ErasurePending)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RejectErasureRequest marks a pending erasure request rejected, or returns
+// sql.ErrNoRows if there is no pending request with that ID.
+func (r *Repository) RejectErasureRequest(ctx context.Context, id, adminID string, note *string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE erasure_requests
+		SET status = ?, decided_at = ?, decided_by = ?, note = ?
+		WHERE id = ? AND status = ?
+	`, models.ErasureRejected, time.Now().UTC().Format(time.RFC3339), adminID, sqlNullString(note),
+		id, models.ErasurePending)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EraseUser carries out a pending erasure request in one transaction and
+// marks it approved, or returns sql.ErrNoRows if there is no pending
+// request with that ID.
+//
+// Listening sessions, daily stats, progress and ratings move to a random ID
+// that no account has, so listening totals, popularity and average ratings
+// stay as they were; review texts are dropped. Download audit entries and
+// client logs keep their counts and sizes but lose the account, username,
+// address and device. Everything else stored for the user is deleted,
+// including the account itself.
+func (r *Repository) EraseUser(ctx context.Context, requestID, adminID string, note *string) (*models.ErasureResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM erasure_requests WHERE id = ? AND status = ?
+	`, requestID, models.ErasurePending).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+
+	anonID := "erased-" + uuid.NewString()
+	result := &models.ErasureResult{AnonymousID: anonID}
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+		count *int64
+	}{
+		{`UPDATE listening_sessions SET user_id = ? WHERE user_id = ?`, []interface{}{anonID, userID}, &result.Sessions},
+		{`UPDATE user_listening_stats SET user_id = ? WHERE user_id = ?`, []interface{}{anonID, userID}, nil},
+		{`UPDATE user_audiobook_data SET user_id = ? WHERE user_id = ?`, []interface{}{anonID, userID}, &result.Progress},
+		{`UPDATE user_reviews SET user_id = ?, review = NULL WHERE user_id = ?`, []interface{}{anonID, userID}, &result.Ratings},
+		{`DELETE FROM user_bookmarks WHERE user_id = ?`, []interface{}{userID}, &result.Bookmarks},
+		{`UPDATE downloads SET user_id = NULL, username = ?, remote_addr = NULL, user_agent = NULL WHERE user_id = ?`, []interface{}{anonID, userID}, &result.Downloads},
+		{`UPDATE client_logs SET user_id = NULL, username = ?, device = NULL, user_agent = NULL WHERE user_id = ?`, []interface{}{anonID, userID}, &result.ClientLogs},
+		{`DELETE FROM user_goals WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM user_privacy WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM activity WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM access_token_events WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM access_tokens WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM notification_settings WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM audiobook_access WHERE principal_type = ? AND principal_id = ?`, []interface{}{models.AccessPrincipalUser, userID}, nil},
+		{`DELETE FROM library_members WHERE user_id = ?`, []interface{}{userID}, nil},
+		{`DELETE FROM users WHERE id = ?`, []interface{}{userID}, nil},
+	} {
+		res, err := tx.ExecContext(ctx, stmt.query, stmt.args...)
+		if err != nil {
+			return nil, err
+		}
+		if stmt.count != nil {
+			*stmt.count, _ = res.RowsAffected()
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE erasure_requests
+		SET status = ?, decided_at = ?, decided_by = ?, note = ?, reason = NULL
+		WHERE id = ?
+	`, models.ErasureApproved, time.Now().UTC().Format(time.RFC3339), adminID, sqlNullString(note), requestID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// activityVisibleFilter restricts a query aliasing activity as "act" to the
+// entries the user may see: activity of no user, the user's own, and that
+// of users who share their activity. It expects the user ID to be bound
+// once.
+const activityVisibleFilter = `
+		AND (
+			act.user_id IS NULL
+			OR act.user_id = ?
+			OR EXISTS (SELECT 1 FROM user_privacy p WHERE p.user_id = act.user_id AND p.share_activity = 1)
+		)`
+
+// RecordActivity adds an entry to the activity feed of the audiobook's
+// library. userID is empty for activity of no user. Audiobooks outside any
+// library are left out.
+func (r *Repository) RecordActivity(ctx context.Context, activityType, audiobookID, userID string) error {
+	var user *string
+	if userID != "" {
+		user = &userID
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO activity (id, library_id, audiobook_id, user_id, type, created_at)
+		SELECT ?, library_id, id, ?, ?, ? FROM audiobooks
+		WHERE id = ? AND library_id IS NOT NULL
+	`, uuid.NewString(), sqlNullString(user), activityType, time.Now().UTC().Format(time.RFC3339), audiobookID)
+	return err
+}
+
+// ListLibraryActivity returns the activity of a library the user may see,
+// newest first, optionally only of one type. Activity of audiobooks hidden
+// from the user or missing on disk is left out.
+func (r *Repository) ListLibraryActivity(ctx context.Context, userID, libraryID, activityType string, offset, limit int) ([]models.Activity, int, error) {
+	filter := `
+		WHERE act.library_id = ?` + activityVisibleFilter + audiobookListFilter
+	args := []interface{}{libraryID, userID, userID, userID}
+	if activityType != "" {
+		filter += ` AND act.type = ?`
+		args = append(args, activityType)
+	}
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM activity act
+		JOIN audiobooks a ON a.id = act.audiobook_id`+filter, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT act.id, act.type, act.library_id, act.audiobook_id, act.user_id, u.username,
+		       rs.title, rs.author, rs.cover_url, act.created_at
+		FROM activity act
+		JOIN audiobooks a ON a.id = act.audiobook_id
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = act.audiobook_id
+		LEFT JOIN users u ON u.id = act.user_id`+filter+`
+		ORDER BY act.created_at DESC, act.id
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []models.Activity{}
+	for rows.Next() {
+		var activity models.Activity
+		var userID, username, title, author, coverURL sql.NullString
+		var createdAt string
+		if err := rows.Scan(&activity.ID, &activity.Type, &activity.LibraryID, &activity.AudiobookID,
+			&userID, &username, &title, &author, &coverURL, &createdAt); err != nil {
+			return nil, 0, err
+		}
+		activity.UserID = nullableString(userID)
+		activity.Username = nullableString(username)
+		activity.Title = title.String
+		activity.Author = author.String
+		activity.CoverURL = models.ProxyCoverURL(activity.AudiobookID, nullableString(coverURL))
+		activity.CreatedAt = parseTime(createdAt)
+		list = append(list, activity)
+	}
+	return list, total, rows.Err()
+}
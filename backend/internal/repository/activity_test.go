@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/models"
+)
+
+// newHouseholdRepo opens a fresh database with users alice and bob and
+// audiobook book-1 in library lib-1.
+func newHouseholdRepo(t *testing.T) *Repository {
+	t.Helper()
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "lore.db"), database.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := New(db)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, stmt := range []string{
+		`INSERT INTO library_paths (id, path, name, created_at) VALUES ('path-1', '/books', 'Books', '` + now + `')`,
+		`INSERT INTO libraries (id, name, display_name, created_at, updated_at) VALUES ('lib-1', 'books', 'Books', '` + now + `', '` + now + `')`,
+		`INSERT INTO users (id, username, password_hash, created_at) VALUES ('alice', 'alice', 'x', '` + now + `')`,
+		`INSERT INTO users (id, username, password_hash, created_at) VALUES ('bob', 'bob', 'x', '` + now + `')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libraryID := "lib-1"
+	book := &models.Audiobook{ID: "book-1", LibraryID: &libraryID, LibraryPathID: "path-1", AssetPath: "/books/one"}
+	if err := repo.CreateAudiobook(ctx, book, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestListLibraryActivityVisibility(t *testing.T) {
+	ctx := context.Background()
+	repo := newHouseholdRepo(t)
+	if err := repo.RecordActivity(ctx, models.ActivityBookFinished, "book-1", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	types := func(userID string) []string {
+		t.Helper()
+		list, total, err := repo.ListLibraryActivity(ctx, userID, "lib-1", "", 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != len(list) {
+			t.Errorf("total = %d, want %d", total, len(list))
+		}
+		var got []string
+		for _, activity := range list {
+			got = append(got, activity.Type)
+		}
+		return got
+	}
+
+	if got := types("alice"); len(got) != 1 || got[0] != models.ActivityBookAdded {
+		t.Errorf("alice sees %v before bob shares, want only %s", got, models.ActivityBookAdded)
+	}
+	if got := types("bob"); len(got) != 2 {
+		t.Errorf("bob sees %v, want his own finished book too", got)
+	}
+
+	if err := repo.SetPrivacySettings(ctx, "bob", models.PrivacySettings{KeepListeningHistory: true, ShareActivity: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := types("alice"); len(got) != 2 {
+		t.Errorf("alice sees %v after bob shares, want his finished book too", got)
+	}
+}
+
+func TestListAlsoListenedBy(t *testing.T) {
+	ctx := context.Background()
+	repo := newHouseholdRepo(t)
+	if _, err := repo.UpdateUserProgress(ctx, "bob", "book-1", 590, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	share := func(userID string) {
+		t.Helper()
+		if err := repo.SetPrivacySettings(ctx, userID, models.PrivacySettings{KeepListeningHistory: true, ShareListening: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listeners := func(finishedSec float64) []models.Listener {
+		t.Helper()
+		list, err := repo.ListAlsoListenedBy(ctx, "book-1", "alice", finishedSec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	share("bob")
+	if got := listeners(588); len(got) != 0 {
+		t.Errorf("alice sees %v without sharing her own listening", got)
+	}
+	share("alice")
+	if got := listeners(588); len(got) != 1 || got[0].UserID != "bob" || got[0].Status != models.ListenerFinished {
+		t.Errorf("alice sees %v, want bob finished", got)
+	}
+	if got := listeners(1000); len(got) != 1 || got[0].Status != models.ListenerListening {
+		t.Errorf("alice sees %v, want bob listening", got)
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lore/backend/internal/models"
+)
+
+// ListBookmarks returns userID's bookmarks in an audiobook by position.
+func (r *Repository) ListBookmarks(ctx context.Context, userID, audiobookID string) ([]models.Bookmark, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, audiobook_id, position_sec, title, created_at
+		FROM user_bookmarks
+		WHERE user_id = ? AND audiobook_id = ?
+		ORDER BY position_sec, created_at
+	`, userID, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []models.Bookmark{}
+	for rows.Next() {
+		var bookmark models.Bookmark
+		var createdAt string
+		if err := rows.Scan(&bookmark.ID, &bookmark.AudiobookID, &bookmark.PositionSec, &bookmark.Title, &createdAt); err != nil {
+			return nil, err
+		}
+		bookmark.CreatedAt = parseTime(createdAt)
+		bookmarks = append(bookmarks, bookmark)
+	}
+	return bookmarks, rows.Err()
+}
+
+// CreateBookmark stores a bookmark for userID. A zero CreatedAt is set to
+// now.
+func (r *Repository) CreateBookmark(ctx context.Context, userID string, bookmark *models.Bookmark) error {
+	if bookmark.ID == "" {
+		bookmark.ID = uuid.NewString()
+	}
+	if bookmark.CreatedAt.IsZero() {
+		bookmark.CreatedAt = time.Now().UTC()
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_bookmarks (id, user_id, audiobook_id, position_sec, title, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, bookmark.ID, userID, bookmark.AudiobookID, bookmark.PositionSec, bookmark.Title, bookmark.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// ImportBookmark stores a bookmark for userID unless they already have one
+// at the same position in the audiobook, reporting whether it was added.
+func (r *Repository) ImportBookmark(ctx context.Context, userID string, bookmark *models.Bookmark) (bool, error) {
+	var exists int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_bookmarks
+		WHERE user_id = ? AND audiobook_id = ? AND ABS(position_sec - ?) < 1
+	`, userID, bookmark.AudiobookID, bookmark.PositionSec).Scan(&exists)
+	if err != nil || exists > 0 {
+		return false, err
+	}
+	if err := r.CreateBookmark(ctx, userID, bookmark); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteBookmark removes one of userID's bookmarks in an audiobook, or
+// returns sql.ErrNoRows if there is no such bookmark.
+func (r *Repository) DeleteBookmark(ctx context.Context, userID, audiobookID, bookmarkID string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM user_bookmarks WHERE id = ? AND user_id = ? AND audiobook_id = ?
+	`, bookmarkID, userID, audiobookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/models"
+)
+
+// audiobookFilterClause builds the AND conditions for an AudiobookFilter on a
+// query aliasing audiobooks as "a".
+func audiobookFilterClause(filter models.AudiobookFilter) (string, []interface{}) {
+	var clause string
+	var args []interface{}
+
+	if filter.Genre != "" {
+		slug := metadata.GenreSlug(filter.Genre)
+		if genre, ok := metadata.NormalizeGenre(filter.Genre); ok {
+			slug = genre.Slug
+		}
+		clause += `
+		AND EXISTS (SELECT 1 FROM audiobook_genres ag WHERE ag.audiobook_id = a.id AND ag.genre_slug = ?)`
+		args = append(args, slug)
+	}
+
+	if filter.Narrator != "" {
+		slug := metadata.NarratorSlug(filter.Narrator)
+		if narrator, ok := metadata.NormalizeNarrator(filter.Narrator); ok {
+			slug = narrator.Slug
+		}
+		clause += `
+		AND EXISTS (SELECT 1 FROM audiobook_narrators an WHERE an.audiobook_id = a.id AND an.narrator_slug = ?)`
+		args = append(args, slug)
+	}
+
+	if filter.Series != "" {
+		clause += `
+		AND EXISTS (SELECT 1 FROM audiobook_metadata_resolved srs WHERE srs.audiobook_id = a.id AND srs.series_name = ? COLLATE NOCASE)`
+		args = append(args, filter.Series)
+	}
+	if filter.NoSeries {
+		clause += `
+		AND NOT EXISTS (SELECT 1 FROM audiobook_metadata_resolved srs WHERE srs.audiobook_id = a.id AND TRIM(COALESCE(srs.series_name, '')) != '')`
+	}
+
+	for _, field := range filter.CustomFields {
+		value := `v.value`
+		switch field.Type {
+		case models.CustomFieldNumber:
+			value = `CAST(v.value AS REAL)`
+		case models.CustomFieldText:
+			value = `v.value COLLATE NOCASE`
+		}
+		op := "="
+		switch field.Op {
+		case models.FilterAtLeast:
+			op = ">="
+		case models.FilterAtMost:
+			op = "<="
+		}
+		clause += `
+		AND EXISTS (SELECT 1 FROM audiobook_custom_fields v WHERE v.audiobook_id = a.id AND v.field_key = ? AND ` + value + ` ` + op + ` ?)`
+		if field.Type == models.CustomFieldNumber {
+			n, _ := strconv.ParseFloat(field.Value, 64)
+			args = append(args, field.Key, n)
+		} else {
+			args = append(args, field.Key, field.Value)
+		}
+	}
+
+	if filter.IDs != nil {
+		if len(filter.IDs) == 0 {
+			clause += `
+		AND 0`
+		} else {
+			clause += `
+		AND a.id IN (?` + strings.Repeat(", ?", len(filter.IDs)-1) + `)`
+		}
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	}
+
+	return clause, args
+}
+
+// resolvedSearchField returns the SQL for a field's resolved value on a query
+// joining audiobooks as "a", agent metadata as "m", custom metadata as "c",
+// sidecar metadata as "sc" and embedded metadata as "e", with its arguments.
+// It resolves like Audiobook.ResolveMetadata: a field locked to a custom
+// value (or to blank) takes the custom value, otherwise the first value in
+// the tiers of the book's library's metadata order. orders holds the orders
+// of libraries not resolving in the default order, by library ID.
+func resolvedSearchField(field string, orders map[string][]string) (string, []interface{}) {
+	// Libraries sharing an order share a branch; sorting keeps the SQL the
+	// same from one search to the next.
+	libraries := make(map[string][]string)
+	var keys []string
+	for libraryID, order := range orders {
+		key := strings.Join(order, ",")
+		if _, ok := libraries[key]; !ok {
+			keys = append(keys, key)
+		}
+		libraries[key] = append(libraries[key], libraryID)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	var args []interface{}
+	fmt.Fprintf(&b, "(CASE WHEN c.%s_locked = %d THEN c.%[1]s", field, lockFlagLocked)
+	for _, key := range keys {
+		ids := libraries[key]
+		sort.Strings(ids)
+		fmt.Fprintf(&b, " WHEN a.library_id IN (?%s) THEN %s", strings.Repeat(", ?", len(ids)-1),
+			tierCoalesce(field, strings.Split(key, ",")))
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	fmt.Fprintf(&b, " ELSE %s END)", tierCoalesce(field, models.DefaultMetadataOrder))
+	return b.String(), args
+}
+
+// metadataTierAliases are the query aliases of the metadata tiers' tables.
+var metadataTierAliases = map[string]string{
+	models.MetadataTierAgent:    "m",
+	models.MetadataTierSidecar:  "sc",
+	models.MetadataTierEmbedded: "e",
+}
+
+// tierCoalesce returns the SQL for the first non-empty value of a field in
+// the given order of tiers, or the last tier's value.
+func tierCoalesce(field string, order []string) string {
+	values := make([]string, len(order))
+	for i, tier := range order {
+		values[i] = metadataTierAliases[tier] + "." + field
+		if i < len(order)-1 {
+			values[i] = "NULLIF(" + values[i] + ", '')"
+		}
+	}
+	return "COALESCE(" + strings.Join(values, ", ") + ")"
+}
+
+// audiobookOrderClause returns the ORDER BY expressions for an
+// AudiobookFilter's sort on a query joining resolved metadata as "rs", or
+// fallback for the listing's default order, with their arguments. Books
+// without sort keys go last; rating order reads userID's ratings.
+func audiobookOrderClause(filter models.AudiobookFilter, userID, fallback string) (string, []interface{}) {
+	switch filter.Sort {
+	case models.SortRecentlyAdded:
+		return "a.created_at DESC, a.id DESC", nil
+	case models.SortTitle:
+		return "rs.title_sort IS NULL, rs.title_sort, a.id", nil
+	case models.SortAuthor:
+		return "rs.author_sort IS NULL, rs.author_sort, rs.title_sort, a.id", nil
+	case models.SortSeries:
+		return `TRIM(COALESCE(rs.series_name, '')) = '', rs.series_name COLLATE NOCASE,
+		        CAST(rs.series_sequence AS REAL) IS NULL, CAST(rs.series_sequence AS REAL),
+		        rs.title_sort IS NULL, rs.title_sort, a.id`, nil
+	case models.SortRating:
+		return `COALESCE((SELECT ur.rating FROM user_reviews ur WHERE ur.user_id = ? AND ur.audiobook_id = a.id), 0) DESC,
+		        rs.title_sort IS NULL, rs.title_sort, a.id`, []interface{}{userID}
+	default:
+		return fallback, nil
+	}
+}
+
+// audiobookCursorClause builds the keyset condition that starts a
+// SortRecentlyAdded listing after filter.After. It belongs on the page
+// query only, so totals still count every match.
+func audiobookCursorClause(filter models.AudiobookFilter) (string, []interface{}) {
+	if filter.After.IsZero() {
+		return "", nil
+	}
+	createdAt := filter.After.CreatedAt.UTC().Format(time.RFC3339)
+	return `
+		AND (a.created_at < ? OR (a.created_at = ? AND a.id < ?))`, []interface{}{createdAt, createdAt, filter.After.ID}
+}
+
+// ListLibrarySeries returns a page of the series in a library with the
+// number of audiobooks the user can see in each, alphabetically, and the
+// total number of series.
+func (r *Repository) ListLibrarySeries(ctx context.Context, userID, libraryID string, offset, limit int) ([]models.SeriesCount, int, error) {
+	visible := `
+		SELECT a.id, rs.series_name, rs.cover_url,
+		       ROW_NUMBER() OVER (PARTITION BY rs.series_name COLLATE NOCASE
+		                          ORDER BY CAST(rs.series_sequence AS REAL) IS NULL, CAST(rs.series_sequence AS REAL), rs.title_sort, a.id) AS position,
+		       COUNT(*) OVER (PARTITION BY rs.series_name COLLATE NOCASE) AS books
+		FROM audiobooks a
+		JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+		WHERE a.library_id = ? AND TRIM(COALESCE(rs.series_name, '')) != ''` + audiobookListFilter
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+visible+`) WHERE position = 1`,
+		libraryID, userID, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT series_name, books, id, cover_url FROM (`+visible+`)
+		WHERE position = 1
+		ORDER BY series_name COLLATE NOCASE
+		LIMIT ? OFFSET ?`, libraryID, userID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	series := []models.SeriesCount{}
+	for rows.Next() {
+		var s models.SeriesCount
+		var coverURL sql.NullString
+		if err := rows.Scan(&s.Name, &s.BookCount, &s.CoverAudiobookID, &coverURL); err != nil {
+			return nil, 0, err
+		}
+		s.CoverURL = models.ProxyCoverURL(s.CoverAudiobookID, nullableString(coverURL))
+		series = append(series, s)
+	}
+	return series, total, rows.Err()
+}
+
+// ListLibraryGenres returns the genres in a library with the number of
+// audiobooks the user can see in each, alphabetically.
+func (r *Repository) ListLibraryGenres(ctx context.Context, userID, libraryID string) ([]models.GenreCount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT g.slug, g.name, COUNT(*)
+		FROM genres g
+		JOIN audiobook_genres ag ON ag.genre_slug = g.slug
+		JOIN audiobooks a ON a.id = ag.audiobook_id
+		WHERE a.library_id = ?`+audiobookListFilter+`
+		GROUP BY g.slug, g.name
+		ORDER BY g.name COLLATE NOCASE`, libraryID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []models.GenreCount{}
+	for rows.Next() {
+		var genre models.GenreCount
+		if err := rows.Scan(&genre.Slug, &genre.Name, &genre.BookCount); err != nil {
+			return nil, err
+		}
+		genres = append(genres, genre)
+	}
+	return genres, rows.Err()
+}
+
+// ListLibraryNarrators returns the narrators in a library with the number of
+// audiobooks the user can see for each, alphabetically.
+func (r *Repository) ListLibraryNarrators(ctx context.Context, userID, libraryID string) ([]models.NarratorCount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT n.slug, n.name, COUNT(*)
+		FROM narrators n
+		JOIN audiobook_narrators an ON an.narrator_slug = n.slug
+		JOIN audiobooks a ON a.id = an.audiobook_id
+		WHERE a.library_id = ?`+audiobookListFilter+`
+		GROUP BY n.slug, n.name
+		ORDER BY n.name COLLATE NOCASE`, libraryID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	narrators := []models.NarratorCount{}
+	for rows.Next() {
+		var narrator models.NarratorCount
+		if err := rows.Scan(&narrator.Slug, &narrator.Name, &narrator.BookCount); err != nil {
+			return nil, err
+		}
+		narrators = append(narrators, narrator)
+	}
+	return narrators, rows.Err()
+}
+
+// ListLibraryLetters returns the A–Z index of a library listing in title or
+// author order: the letters the visible audiobooks file under, with counts
+// and the offset of each letter's first book in the listing with the same
+// filter. Books without resolved metadata sort last and are left out.
+func (r *Repository) ListLibraryLetters(ctx context.Context, userID, libraryID string, filter models.AudiobookFilter) ([]models.LetterCount, error) {
+	keyColumn, nameColumn := "rs.title_sort", "rs.sort_title"
+	if filter.Sort == models.SortAuthor {
+		keyColumn, nameColumn = "rs.author_sort", "rs.sort_author"
+	}
+	filterClause, filterArgs := audiobookFilterClause(filter)
+
+	orderClause, orderArgs := audiobookOrderClause(filter, userID, "rs.title_sort IS NULL, rs.title_sort, a.id")
+	query := `
+		SELECT ` + keyColumn + `, ` + nameColumn + `
+		FROM audiobooks a
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+		WHERE a.library_id = ?` + audiobookListFilter + filterClause + `
+		ORDER BY ` + orderClause
+	args := append([]interface{}{libraryID, userID, userID}, filterArgs...)
+	args = append(args, orderArgs...)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []models.LetterCount{}
+	for offset := 0; rows.Next(); offset++ {
+		var key, name sql.NullString
+		if err := rows.Scan(&key, &name); err != nil {
+			return nil, err
+		}
+		if !key.Valid {
+			continue
+		}
+		letter := metadata.IndexLetter(key.String, name.String)
+		if n := len(letters); n > 0 && letters[n-1].Letter == letter {
+			letters[n-1].BookCount++
+			continue
+		}
+		letters = append(letters, models.LetterCount{Letter: letter, BookCount: 1, Offset: offset})
+	}
+	return letters, rows.Err()
+}
+
+// syncAudiobookGenres replaces an audiobook's genre links. Display names are
+// first-come: an existing genre keeps its name.
+func syncAudiobookGenres(ctx context.Context, tx *sql.Tx, audiobookID string, genres []metadata.Genre) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM audiobook_genres WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+
+	for _, genre := range genres {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO genres (slug, name) VALUES (?, ?)
+			ON CONFLICT(slug) DO NOTHING
+		`, genre.Slug, genre.Name); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO audiobook_genres (audiobook_id, genre_slug) VALUES (?, ?)
+		`, audiobookID, genre.Slug); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncAudiobookNarrators replaces an audiobook's narrator credits, keeping
+// their billing order.
+func syncAudiobookNarrators(ctx context.Context, tx *sql.Tx, audiobookID string, narrators []metadata.Narrator) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM audiobook_narrators WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+
+	for i, narrator := range narrators {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO narrators (slug, name) VALUES (?, ?)
+			ON CONFLICT(slug) DO NOTHING
+		`, narrator.Slug, narrator.Name); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO audiobook_narrators (audiobook_id, narrator_slug, position) VALUES (?, ?, ?)
+		`, audiobookID, narrator.Slug, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneBrowseTables removes genres and narrators no audiobook refers to any more.
+func (r *Repository) pruneBrowseTables(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM genres
+		WHERE slug NOT IN (SELECT genre_slug FROM audiobook_genres)
+	`); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM narrators
+		WHERE slug NOT IN (SELECT narrator_slug FROM audiobook_narrators)
+	`)
+	return err
+}
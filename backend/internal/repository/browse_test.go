@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+func TestListAudiobooksCursorPagesThroughTies(t *testing.T) {
+	ctx := context.Background()
+	repo := newHouseholdRepo(t)
+	libraryID := "lib-1"
+	for i := 2; i <= 7; i++ {
+		id := fmt.Sprintf("book-%d", i)
+		book := &models.Audiobook{ID: id, LibraryID: &libraryID, LibraryPathID: "path-1", AssetPath: "/books/" + id}
+		if err := repo.CreateAudiobook(ctx, book, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A scan adds many books within the same second.
+	if _, err := repo.db.ExecContext(ctx, `UPDATE audiobooks SET created_at = ?`, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := models.AudiobookFilter{Sort: models.SortRecentlyAdded}
+	seen := make(map[string]bool)
+	var order []string
+	for page := 0; page < 10; page++ {
+		books, total, err := repo.ListAudiobooks(ctx, "alice", &libraryID, filter, 0, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 7 {
+			t.Errorf("total = %d on page %d, want 7", total, page)
+		}
+		if len(books) == 0 {
+			break
+		}
+		for _, book := range books {
+			if seen[book.ID] {
+				t.Errorf("%s listed twice", book.ID)
+			}
+			seen[book.ID] = true
+			order = append(order, book.ID)
+		}
+		last := books[len(books)-1]
+		filter.After = models.BookCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	if len(seen) != 7 {
+		t.Errorf("cursor pages listed %v, want all 7 books", order)
+	}
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// catalogFilter restricts a query aliasing audiobooks as "a" to the books a
+// library's public catalog lists: those without access rules, which every
+// user may see, and whose folder is on disk.
+const catalogFilter = `
+		AND NOT EXISTS (SELECT 1 FROM audiobook_access aa WHERE aa.audiobook_id = a.id)
+		AND a.missing_since IS NULL`
+
+// ListCatalogBooks returns a page of a library's public catalog by title.
+// Books without a resolved title are named after their folder; cover URLs
+// are returned as stored.
+func (r *Repository) ListCatalogBooks(ctx context.Context, libraryID string, offset, limit int) ([]models.CatalogBook, int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM audiobooks a
+		WHERE a.library_id = ?`+catalogFilter, libraryID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.asset_path, rs.title, rs.author, rs.narrator, rs.series_name, rs.series_sequence, rs.cover_url
+		FROM audiobooks a
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+		WHERE a.library_id = ?`+catalogFilter+`
+		ORDER BY rs.title_sort IS NULL, rs.title_sort, a.id
+		LIMIT ? OFFSET ?`, libraryID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	books := []models.CatalogBook{}
+	for rows.Next() {
+		var book models.CatalogBook
+		var assetPath string
+		var title, author, narrator, seriesName, seriesSequence, coverURL sql.NullString
+		if err := rows.Scan(&book.ID, &assetPath, &title, &author, &narrator, &seriesName, &seriesSequence, &coverURL); err != nil {
+			return nil, 0, err
+		}
+		book.Title = title.String
+		if book.Title == "" {
+			book.Title = filepath.Base(assetPath)
+		}
+		book.Author = author.String
+		book.Narrator = narrator.String
+		book.SeriesName = seriesName.String
+		book.SeriesSequence = seriesSequence.String
+		book.CoverURL = nullableString(coverURL)
+		books = append(books, book)
+	}
+	return books, total, rows.Err()
+}
+
+// InCatalog reports whether a library's public catalog lists the audiobook.
+func (r *Repository) InCatalog(ctx context.Context, libraryID, audiobookID string) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM audiobooks a
+		WHERE a.id = ? AND a.library_id = ?`+catalogFilter, audiobookID, libraryID).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestListCatalogBooksSkipsRestricted(t *testing.T) {
+	ctx := context.Background()
+	repo := newHouseholdRepo(t)
+
+	books, total, err := repo.ListCatalogBooks(ctx, "lib-1", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(books) != 1 || books[0].Title != "one" {
+		t.Fatalf("catalog = %v (total %d), want book one", books, total)
+	}
+
+	if _, err := repo.db.ExecContext(ctx, `INSERT INTO audiobook_access (audiobook_id, principal_type, principal_id, created_at) VALUES ('book-1', 'user', 'alice', ?)`, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	if books, total, err = repo.ListCatalogBooks(ctx, "lib-1", 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 || len(books) != 0 {
+		t.Errorf("catalog = %v (total %d), want restricted book left out", books, total)
+	}
+	if listed, err := repo.InCatalog(ctx, "lib-1", "book-1"); err != nil || listed {
+		t.Errorf("InCatalog = %v, %v; want false", listed, err)
+	}
+}
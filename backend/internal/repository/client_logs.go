@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+const clientLogColumns = `id, user_id, username, level, message, client, client_version, device, os,
+		audiobook_id, stack, context, user_agent, created_at`
+
+// RecordClientLog stores an error report submitted by a client.
+func (r *Repository) RecordClientLog(ctx context.Context, entry *models.ClientLog) error {
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+
+	var contextJSON interface{}
+	if len(entry.Context) > 0 {
+		encoded, err := json.Marshal(entry.Context)
+		if err != nil {
+			return err
+		}
+		contextJSON = string(encoded)
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO client_logs (`+clientLogColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, sqlNullString(entry.UserID), entry.Username, entry.Level, entry.Message,
+		entry.Client, entry.ClientVersion, sqlNullString(entry.Device), sqlNullString(entry.OS),
+		sqlNullString(entry.AudiobookID), sqlNullString(entry.Stack), contextJSON,
+		sqlNullString(entry.UserAgent), entry.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// ListClientLogs returns client logs matching the filter, newest first, and
+// the number of matches.
+func (r *Repository) ListClientLogs(ctx context.Context, filter models.ClientLogFilter, offset, limit int) ([]models.ClientLog, int, error) {
+	where, args := clientLogFilterClause(filter)
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM client_logs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+clientLogColumns+`
+		FROM client_logs`+where+`
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []models.ClientLog{}
+	for rows.Next() {
+		entry, err := scanClientLog(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// GetClientLog returns a client log, or sql.ErrNoRows if there is none.
+func (r *Repository) GetClientLog(ctx context.Context, id string) (*models.ClientLog, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+clientLogColumns+` FROM client_logs WHERE id = ?`, id)
+	return scanClientLog(row)
+}
+
+// DeleteClientLogsBefore removes client logs submitted before cutoff and
+// returns how many were removed.
+func (r *Repository) DeleteClientLogsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM client_logs WHERE created_at < ?`,
+		cutoff.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanClientLog(row rowScanner) (*models.ClientLog, error) {
+	var entry models.ClientLog
+	var userID, device, osName, audiobookID, stack, contextJSON, userAgent sql.NullString
+	var createdAt string
+	if err := row.Scan(&entry.ID, &userID, &entry.Username, &entry.Level, &entry.Message,
+		&entry.Client, &entry.ClientVersion, &device, &osName, &audiobookID, &stack,
+		&contextJSON, &userAgent, &createdAt); err != nil {
+		return nil, err
+	}
+	entry.UserID = nullableString(userID)
+	entry.Device = nullableString(device)
+	entry.OS = nullableString(osName)
+	entry.AudiobookID = nullableString(audiobookID)
+	entry.Stack = nullableString(stack)
+	entry.UserAgent = nullableString(userAgent)
+	if contextJSON.Valid {
+		if err := json.Unmarshal([]byte(contextJSON.String), &entry.Context); err != nil {
+			return nil, err
+		}
+	}
+	entry.CreatedAt = parseTime(createdAt)
+	return &entry, nil
+}
+
+func clientLogFilterClause(filter models.ClientLogFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != nil && *filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, *filter.UserID)
+	}
+	if filter.Level != "" {
+		conditions = append(conditions, "level = ?")
+		args = append(args, filter.Level)
+	}
+	if filter.Client != "" {
+		conditions = append(conditions, "client = ?")
+		args = append(args, filter.Client)
+	}
+	if filter.ClientVersion != "" {
+		conditions = append(conditions, "client_version = ?")
+		args = append(args, filter.ClientVersion)
+	}
+	if filter.AudiobookID != nil && *filter.AudiobookID != "" {
+		conditions = append(conditions, "audiobook_id = ?")
+		args = append(args, *filter.AudiobookID)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC().Format(time.RFC3339))
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC().Format(time.RFC3339))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "\n\t\tWHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// SetCoverPlaceholder records the blurhash and average colour of an
+// audiobook's uploaded cover.
+func (r *Repository) SetCoverPlaceholder(ctx context.Context, audiobookID, blurhash, color string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO audiobook_covers (audiobook_id, blurhash, color, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(audiobook_id) DO UPDATE SET
+			blurhash = excluded.blurhash,
+			color = excluded.color,
+			updated_at = excluded.updated_at
+	`, audiobookID, blurhash, color, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// attachCoverPlaceholders fills in the cover placeholders of audiobooks in
+// place with a single query.
+func (r *Repository) attachCoverPlaceholders(ctx context.Context, audiobooks []models.Audiobook) error {
+	if len(audiobooks) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(audiobooks))
+	args := make([]interface{}, 0, len(audiobooks))
+	for i, ab := range audiobooks {
+		index[ab.ID] = i
+		args = append(args, ab.ID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT audiobook_id, blurhash, color FROM audiobook_covers
+		WHERE audiobook_id IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, blurhash, color string
+		if err := rows.Scan(&id, &blurhash, &color); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			audiobooks[i].CoverBlurhash = &blurhash
+			audiobooks[i].CoverColor = &color
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ListCustomFields returns every custom field, oldest first.
+func (r *Repository) ListCustomFields(ctx context.Context) ([]models.CustomField, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT key, name, type, created_at FROM custom_fields ORDER BY created_at, key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []models.CustomField{}
+	for rows.Next() {
+		var f models.CustomField
+		var createdAt string
+		if err := rows.Scan(&f.Key, &f.Name, &f.Type, &createdAt); err != nil {
+			return nil, err
+		}
+		f.CreatedAt = parseTime(createdAt)
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// GetCustomField returns a custom field, or sql.ErrNoRows if there is none.
+func (r *Repository) GetCustomField(ctx context.Context, key string) (*models.CustomField, error) {
+	var f models.CustomField
+	var createdAt string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT key, name, type, created_at FROM custom_fields WHERE key = ?
+	`, key).Scan(&f.Key, &f.Name, &f.Type, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	f.CreatedAt = parseTime(createdAt)
+	return &f, nil
+}
+
+// CreateCustomField stores a new custom field.
+func (r *Repository) CreateCustomField(ctx context.Context, field *models.CustomField) error {
+	field.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO custom_fields (key, name, type, created_at) VALUES (?, ?, ?, ?)
+	`, field.Key, field.Name, field.Type, field.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+// RenameCustomField changes a custom field's display name.
+func (r *Repository) RenameCustomField(ctx context.Context, key, name string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE custom_fields SET name = ? WHERE key = ?`, name, key)
+	return err
+}
+
+// DeleteCustomField removes a custom field and its values.
+func (r *Repository) DeleteCustomField(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM custom_fields WHERE key = ?`, key)
+	return err
+}
+
+// SetCustomFieldValues stores an audiobook's custom field values by key,
+// given in their stored form. A nil value clears the field; fields not in
+// values are left alone.
+func (r *Repository) SetCustomFieldValues(ctx context.Context, audiobookID string, values map[string]*string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for key, value := range values {
+		if value == nil {
+			_, err = tx.ExecContext(ctx, `
+				DELETE FROM audiobook_custom_fields WHERE audiobook_id = ? AND field_key = ?
+			`, audiobookID, key)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO audiobook_custom_fields (audiobook_id, field_key, value)
+				VALUES (?, ?, ?)
+				ON CONFLICT(audiobook_id, field_key) DO UPDATE SET value = excluded.value
+			`, audiobookID, key, *value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// customFieldValues returns an audiobook's custom field values by key,
+// decoded to their field's type.
+func (r *Repository) customFieldValues(ctx context.Context, audiobookID string) (map[string]interface{}, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT f.key, f.type, v.value
+		FROM audiobook_custom_fields v
+		JOIN custom_fields f ON f.key = v.field_key
+		WHERE v.audiobook_id = ?
+	`, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values map[string]interface{}
+	for rows.Next() {
+		var field models.CustomField
+		var value string
+		if err := rows.Scan(&field.Key, &field.Type, &value); err != nil {
+			return nil, err
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		values[field.Key] = field.Decode(value)
+	}
+	return values, rows.Err()
+}
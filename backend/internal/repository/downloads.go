@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// downloadMergeWindow is how long after a range request of a file the next
+// one by the same user still counts towards the same download.
+const downloadMergeWindow = 30 * time.Minute
+
+// RecordDownload appends an entry to the download audit trail. When only the
+// media file is known, the owning audiobook is looked up.
+//
+// Players fetch a file in many range requests while listening and seeking,
+// so a partial (206) response is added to the user's latest partial entry of
+// the same kind and file (or audiobook) when that saw a request within
+// downloadMergeWindow. One listen then counts as one download with the bytes
+// of all its requests.
+func (r *Repository) RecordDownload(ctx context.Context, record *models.DownloadRecord) error {
+	if record.ID == "" {
+		record.ID = uuid.NewString()
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
+	}
+
+	if record.StatusCode == http.StatusPartialContent {
+		now := record.CreatedAt.Format(time.RFC3339)
+		res, err := r.db.ExecContext(ctx, `
+			UPDATE downloads SET bytes = bytes + ?, last_at = ?
+			WHERE id = (
+				SELECT id FROM downloads
+				WHERE user_id IS ? AND kind = ? AND status_code = ?
+				  AND media_file_id IS ? AND audiobook_id IS COALESCE(?, audiobook_id)
+				  AND COALESCE(last_at, created_at) >= ?
+				ORDER BY created_at DESC
+				LIMIT 1
+			)
+		`, record.Bytes, now, sqlNullString(record.UserID), record.Kind, record.StatusCode,
+			sqlNullString(record.MediaFileID), sqlNullString(record.AudiobookID),
+			record.CreatedAt.Add(-downloadMergeWindow).Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			return nil
+		}
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO downloads (id, user_id, username, audiobook_id, media_file_id, kind, bytes, status_code, remote_addr, user_agent, created_at)
+		VALUES (?, ?, ?, COALESCE(?, (SELECT audiobook_id FROM media_files WHERE id = ?)), ?, ?, ?, ?, ?, ?, ?)
+	`, record.ID, sqlNullString(record.UserID), record.Username,
+		sqlNullString(record.AudiobookID), sqlNullString(record.MediaFileID), sqlNullString(record.MediaFileID),
+		record.Kind, record.Bytes, record.StatusCode,
+		sqlNullString(record.RemoteAddr), sqlNullString(record.UserAgent),
+		record.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+// ListDownloads returns audit entries matching the filter, newest first.
+func (r *Repository) ListDownloads(ctx context.Context, filter models.DownloadFilter, offset, limit int) ([]models.DownloadRecord, int, error) {
+	where, args := downloadFilterClause(filter)
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM downloads`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, user_id, username, audiobook_id, media_file_id, kind, bytes, status_code, remote_addr, user_agent, created_at, last_at
+		FROM downloads` + where + `
+		ORDER BY ` + downloadOrderClause(filter.Sort) + `
+		LIMIT ? OFFSET ?`
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	records := []models.DownloadRecord{}
+	for rows.Next() {
+		var rec models.DownloadRecord
+		var userID, audiobookID, mediaFileID, remoteAddr, userAgent, lastAt sql.NullString
+		var createdAt string
+		if err := rows.Scan(&rec.ID, &userID, &rec.Username, &audiobookID, &mediaFileID, &rec.Kind,
+			&rec.Bytes, &rec.StatusCode, &remoteAddr, &userAgent, &createdAt, &lastAt); err != nil {
+			return nil, 0, err
+		}
+		rec.UserID = nullableString(userID)
+		rec.AudiobookID = nullableString(audiobookID)
+		rec.MediaFileID = nullableString(mediaFileID)
+		rec.RemoteAddr = nullableString(remoteAddr)
+		rec.UserAgent = nullableString(userAgent)
+		rec.CreatedAt = parseTime(createdAt)
+		if lastAt.Valid {
+			t := parseTime(lastAt.String)
+			rec.LastAt = &t
+		}
+		records = append(records, rec)
+	}
+
+	return records, total, rows.Err()
+}
+
+// DownloadReport aggregates downloads per user, largest egress first.
+func (r *Repository) DownloadReport(ctx context.Context, filter models.DownloadFilter) ([]models.DownloadUserSummary, error) {
+	where, args := downloadFilterClause(filter)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, username, COUNT(*), COALESCE(SUM(bytes), 0), MAX(created_at)
+		FROM downloads`+where+`
+		GROUP BY user_id, username
+		ORDER BY SUM(bytes) DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.DownloadUserSummary{}
+	for rows.Next() {
+		var summary models.DownloadUserSummary
+		var userID, lastAt sql.NullString
+		if err := rows.Scan(&userID, &summary.Username, &summary.Downloads, &summary.Bytes, &lastAt); err != nil {
+			return nil, err
+		}
+		summary.UserID = nullableString(userID)
+		if lastAt.Valid {
+			t := parseTime(lastAt.String)
+			summary.LastDownloadAt = &t
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, rows.Err()
+}
+
+var downloadSortColumns = map[string]string{
+	"created_at": "created_at",
+	"bytes":      "bytes",
+	"username":   "username COLLATE NOCASE",
+}
+
+// downloadOrderClause orders by the requested field, newest first by default,
+// with created_at and id breaking ties so pages are stable.
+func downloadOrderClause(sort models.Sort) string {
+	column, ok := downloadSortColumns[sort.Field]
+	if !ok {
+		return "created_at DESC, id"
+	}
+	dir := " ASC"
+	if sort.Desc {
+		dir = " DESC"
+	}
+	return column + dir + ", created_at DESC, id"
+}
+
+func downloadFilterClause(filter models.DownloadFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != nil && *filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, *filter.UserID)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC().Format(time.RFC3339))
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC().Format(time.RFC3339))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "\n\t\tWHERE " + strings.Join(conditions, " AND "), args
+}
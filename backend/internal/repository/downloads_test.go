@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+func TestRecordDownloadMergesRangeRequests(t *testing.T) {
+	ctx := context.Background()
+	repo := newHouseholdRepo(t)
+	userID, audiobookID := "alice", "book-1"
+	start := time.Now().UTC().Truncate(time.Second)
+
+	record := func(status int, bytes int64, at time.Time) {
+		t.Helper()
+		err := repo.RecordDownload(ctx, &models.DownloadRecord{
+			UserID: &userID, Username: "alice", AudiobookID: &audiobookID,
+			Kind: models.DownloadKindStream, Bytes: bytes, StatusCode: status, CreatedAt: at,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(http.StatusPartialContent, 100, start)
+	record(http.StatusPartialContent, 50, start.Add(20*time.Minute))
+	record(http.StatusPartialContent, 25, start.Add(45*time.Minute))
+	record(http.StatusPartialContent, 10, start.Add(2*time.Hour))
+	record(http.StatusOK, 1000, start.Add(2*time.Hour))
+
+	report, err := repo.DownloadReport(ctx, models.DownloadFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Downloads != 3 || report[0].Bytes != 1185 {
+		t.Fatalf("report = %+v, want 3 downloads of 1185 bytes", report)
+	}
+}
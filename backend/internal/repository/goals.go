@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// GetListeningGoals returns a user's listening goals, unset when they have
+// never saved any.
+func (r *Repository) GetListeningGoals(ctx context.Context, userID string) (*models.ListeningGoals, error) {
+	var weeklyHours sql.NullFloat64
+	var yearlyBooks sql.NullInt64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT weekly_hours, yearly_books FROM user_goals WHERE user_id = ?
+	`, userID).Scan(&weeklyHours, &yearlyBooks)
+	if err == sql.ErrNoRows {
+		return &models.ListeningGoals{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.ListeningGoals{
+		WeeklyHours: nullableFloat64(weeklyHours),
+		YearlyBooks: nullableInt64(yearlyBooks),
+	}, nil
+}
+
+// SetListeningGoals saves a user's listening goals, replacing both targets.
+func (r *Repository) SetListeningGoals(ctx context.Context, userID string, goals models.ListeningGoals) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_goals (user_id, weekly_hours, yearly_books, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			weekly_hours = excluded.weekly_hours,
+			yearly_books = excluded.yearly_books,
+			updated_at = excluded.updated_at
+	`, userID, nullableFloat(goals.WeeklyHours), nullableInt(goals.YearlyBooks), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// ListenedSince returns the seconds a user listened from the UTC day of
+// since onwards: their daily stats plus the sessions still open.
+func (r *Repository) ListenedSince(ctx context.Context, userID string, since time.Time) (float64, error) {
+	var listened float64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(listened_sec) FROM user_listening_stats WHERE user_id = ? AND day >= ?), 0) +
+			COALESCE((SELECT SUM(listened_sec) FROM listening_sessions WHERE user_id = ? AND closed_at IS NULL AND started_at >= ?), 0)
+	`, userID, since.UTC().Format("2006-01-02"), userID, since.UTC().Format(time.RFC3339)).Scan(&listened)
+	return listened, err
+}
+
+// CountBooksFinished returns how many books a user finished from since
+// onwards: books with a session active since then that crossed
+// completeRatio of the book's duration. Listening again past the line
+// does not count a book twice.
+func (r *Repository) CountBooksFinished(ctx context.Context, userID string, since time.Time, completeRatio float64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT s.audiobook_id)
+		FROM listening_sessions s
+		JOIN audiobooks a ON a.id = s.audiobook_id
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+		LEFT JOIN (
+			SELECT audiobook_id, SUM(duration_sec) AS total_duration
+			FROM media_files
+			GROUP BY audiobook_id
+		) mf ON mf.audiobook_id = a.id
+		WHERE s.user_id = ? AND s.last_active_at >= ?
+		  AND COALESCE(NULLIF(mf.total_duration, 0), rs.duration_sec, 0) > 0
+		  AND s.position_sec >= COALESCE(NULLIF(mf.total_duration, 0), rs.duration_sec) * ?
+		  AND s.start_position_sec < COALESCE(NULLIF(mf.total_duration, 0), rs.duration_sec) * ?
+	`, userID, since.UTC().Format(time.RFC3339), completeRatio, completeRatio).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ListNextInSeries returns, for each series in which the user finished a
+// book, the first later book they have not started, most recently finished
+// series first. A book counts as finished once its progress reaches
+// completeRatio of its duration. Series order follows the numeric value of
+// the resolved series sequence; books without one are skipped.
+func (r *Repository) ListNextInSeries(ctx context.Context, userID string, libraryID *string, completeRatio float64, limit int) ([]models.Audiobook, error) {
+	query := `
+		WITH series_books AS (
+			SELECT a.id, rs.series_name, CAST(rs.series_sequence AS REAL) AS seq,
+			       COALESCE(u.progress_sec, 0) AS progress,
+			       COALESCE(NULLIF(mf.total_duration, 0), rs.duration_sec, 0) AS duration,
+			       u.last_played_at
+			FROM audiobooks a
+			JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+			LEFT JOIN user_audiobook_data u ON u.audiobook_id = a.id AND u.user_id = ?
+			LEFT JOIN (
+				SELECT audiobook_id, SUM(duration_sec) AS total_duration
+				FROM media_files
+				GROUP BY audiobook_id
+			) mf ON mf.audiobook_id = a.id
+			WHERE TRIM(COALESCE(rs.series_name, '')) != '' AND TRIM(COALESCE(rs.series_sequence, '')) != ''`
+	args := []interface{}{userID}
+	if libraryID != nil && *libraryID != "" {
+		query += " AND a.library_id = ?"
+		args = append(args, *libraryID)
+	}
+	query += audiobookListFilter + `
+		),
+		finished AS (
+			SELECT series_name, MAX(seq) AS seq, MAX(last_played_at) AS last_played_at
+			FROM series_books
+			WHERE duration > 0 AND progress >= duration * ?
+			GROUP BY series_name
+		)
+		SELECT id FROM (
+			SELECT b.id, f.last_played_at,
+			       ROW_NUMBER() OVER (PARTITION BY b.series_name ORDER BY b.seq, b.id) AS position
+			FROM series_books b
+			JOIN finished f ON f.series_name = b.series_name
+			WHERE b.seq > f.seq AND b.progress = 0
+		)
+		WHERE position = 1
+		ORDER BY last_played_at DESC, id
+		LIMIT ?`
+	args = append(args, userID, userID, completeRatio, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.GetAudiobookListings(ctx, ids, userID)
+}
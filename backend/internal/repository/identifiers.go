@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// FindAgentMetadataByIdentifiers returns the ID of the agent metadata record
+// that owns any of the given identifiers, or "" when none is known.
+func (r *Repository) FindAgentMetadataByIdentifiers(ctx context.Context, identifiers []models.MetadataIdentifier) (string, error) {
+	if len(identifiers) == 0 {
+		return "", nil
+	}
+
+	clauses := make([]string, 0, len(identifiers))
+	args := make([]interface{}, 0, len(identifiers)*2)
+	for _, id := range identifiers {
+		clauses = append(clauses, "(type = ? AND value = ?)")
+		args = append(args, id.Type, id.Value)
+	}
+
+	var metadataID string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT metadata_id FROM agent_metadata_identifiers
+		WHERE `+strings.Join(clauses, " OR ")+`
+		LIMIT 1
+	`, args...).Scan(&metadataID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return metadataID, err
+}
+
+// AddAgentMetadataIdentifiers records identifiers for an agent metadata
+// record. Identifiers already owned by a record are kept where they are.
+func (r *Repository) AddAgentMetadataIdentifiers(ctx context.Context, metadataID string, identifiers []models.MetadataIdentifier) error {
+	for _, id := range identifiers {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO agent_metadata_identifiers (metadata_id, type, value, region)
+			VALUES (?, ?, ?, ?)
+		`, metadataID, id.Type, id.Value, sqlNullString(id.Region))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAgentMetadataIdentifiers returns the identifiers of an agent metadata record.
+func (r *Repository) ListAgentMetadataIdentifiers(ctx context.Context, metadataID string) ([]models.MetadataIdentifier, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT type, value, region FROM agent_metadata_identifiers
+		WHERE metadata_id = ?
+		ORDER BY type, value
+	`, metadataID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identifiers []models.MetadataIdentifier
+	for rows.Next() {
+		var id models.MetadataIdentifier
+		var region sql.NullString
+		if err := rows.Scan(&id.Type, &id.Value, &region); err != nil {
+			return nil, err
+		}
+		id.Region = nullableString(region)
+		identifiers = append(identifiers, id)
+	}
+	return identifiers, rows.Err()
+}
+
+// ListDuplicateAudiobooks groups audiobooks linked to the same agent metadata
+// record. Since records are shared by every ASIN/ISBN they own, regional
+// editions of one book end up in the same group.
+func (r *Repository) ListDuplicateAudiobooks(ctx context.Context) ([]models.DuplicateGroup, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.metadata_id, m.title, a.id
+		FROM audiobooks a
+		INNER JOIN audiobook_metadata_agent m ON m.id = a.metadata_id
+		WHERE a.metadata_id IN (
+			SELECT metadata_id FROM audiobooks
+			WHERE metadata_id IS NOT NULL
+			GROUP BY metadata_id HAVING COUNT(*) > 1
+		)
+		ORDER BY m.title COLLATE NOCASE, a.metadata_id, a.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.DuplicateGroup
+	for rows.Next() {
+		var metadataID, title, audiobookID string
+		if err := rows.Scan(&metadataID, &title, &audiobookID); err != nil {
+			return nil, err
+		}
+		if n := len(groups); n == 0 || groups[n-1].MetadataID != metadataID {
+			groups = append(groups, models.DuplicateGroup{MetadataID: metadataID, Title: title})
+		}
+		group := &groups[len(groups)-1]
+		group.AudiobookIDs = append(group.AudiobookIDs, audiobookID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		identifiers, err := r.ListAgentMetadataIdentifiers(ctx, groups[i].MetadataID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].Identifiers = identifiers
+	}
+	return groups, nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+const importJobColumns = `id, status, source_paths, imported, errors, started_at, completed_at`
+
+// SaveImportJob records a finished import job in the import history.
+func (r *Repository) SaveImportJob(ctx context.Context, job *models.ImportJobRecord) error {
+	sourcePaths, err := json.Marshal(nonNilStrings(job.SourcePaths))
+	if err != nil {
+		return err
+	}
+	imported := job.Imported
+	if imported == nil {
+		imported = []models.ImportedBook{}
+	}
+	importedJSON, err := json.Marshal(imported)
+	if err != nil {
+		return err
+	}
+	errorsJSON, err := json.Marshal(nonNilStrings(job.Errors))
+	if err != nil {
+		return err
+	}
+
+	var completedAt interface{}
+	if job.CompletedAt != nil {
+		completedAt = job.CompletedAt.UTC().Format(time.RFC3339)
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO import_jobs (`+importJobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Status, string(sourcePaths), string(importedJSON), string(errorsJSON),
+		job.StartedAt.UTC().Format(time.RFC3339), completedAt)
+	return err
+}
+
+// ListImportJobs returns a page of the import history, newest first, and
+// the total number of recorded jobs.
+func (r *Repository) ListImportJobs(ctx context.Context, offset, limit int) ([]models.ImportJobRecord, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM import_jobs`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+importJobColumns+` FROM import_jobs
+		ORDER BY started_at DESC, id
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	jobs := []models.ImportJobRecord{}
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, total, rows.Err()
+}
+
+// GetImportJob returns an import job, or sql.ErrNoRows if there is none.
+func (r *Repository) GetImportJob(ctx context.Context, id string) (*models.ImportJobRecord, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+importJobColumns+` FROM import_jobs WHERE id = ?`, id)
+	return scanImportJob(row)
+}
+
+func scanImportJob(row rowScanner) (*models.ImportJobRecord, error) {
+	var job models.ImportJobRecord
+	var sourcePaths, imported, errorsJSON, startedAt string
+	var completedAt sql.NullString
+	if err := row.Scan(&job.ID, &job.Status, &sourcePaths, &imported, &errorsJSON,
+		&startedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(sourcePaths), &job.SourcePaths); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(imported), &job.Imported); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(errorsJSON), &job.Errors); err != nil {
+		return nil, err
+	}
+	job.StartedAt = parseTime(startedAt)
+	if completedAt.Valid {
+		t := parseTime(completedAt.String)
+		job.CompletedAt = &t
+	}
+	return &job, nil
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ReplaceMediaFiles swaps every media file of an audiobook for the given
+// ones, e.g. after merging the files into one.
+func (r *Repository) ReplaceMediaFiles(ctx context.Context, audiobookID string, media []models.MediaFile) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media_files WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+
+	for _, mf := range media {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO media_files (id, audiobook_id, filename, duration_sec, mime_type, extension_mime_type)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, mf.ID, audiobookID, mf.Filename, mf.DurationSec, mf.MimeType, sqlNullString(mf.ExtensionMimeType))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE audiobooks SET updated_at = ? WHERE id = ?
+	`, time.Now().UTC().Format(time.RFC3339), audiobookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetTrackOrder stores the order of an audiobook's media files, given as
+// file IDs. An empty list clears the order so files play in natural order
+// again.
+func (r *Repository) SetTrackOrder(ctx context.Context, audiobookID string, fileIDs []string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `UPDATE media_files SET sort_index = NULL WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+	for i, id := range fileIDs {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE media_files SET sort_index = ? WHERE id = ? AND audiobook_id = ?
+		`, i, id, audiobookID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE audiobooks SET updated_at = ? WHERE id = ?
+	`, time.Now().UTC().Format(time.RFC3339), audiobookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
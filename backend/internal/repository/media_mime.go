@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// MediaFileLocation pairs a media file with the asset path of its audiobook so
+// the file can be found on disk.
+type MediaFileLocation struct {
+	MediaFile models.MediaFile
+	AssetPath string
+}
+
+// ListMediaFileLocations returns every media file with its audiobook's asset path.
+func (r *Repository) ListMediaFileLocations(ctx context.Context) ([]MediaFileLocation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT mf.id, mf.audiobook_id, mf.filename, mf.duration_sec, mf.mime_type, a.asset_path
+		FROM media_files mf
+		INNER JOIN audiobooks a ON a.id = mf.audiobook_id
+		ORDER BY mf.audiobook_id, mf.filename
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []MediaFileLocation
+	for rows.Next() {
+		var loc MediaFileLocation
+		mf := &loc.MediaFile
+		if err := rows.Scan(&mf.ID, &mf.AudiobookID, &mf.Filename, &mf.DurationSec, &mf.MimeType, &loc.AssetPath); err != nil {
+			return nil, err
+		}
+		locations = append(locations, loc)
+	}
+	return locations, rows.Err()
+}
+
+// UpdateMediaFileMimeType stores the detected MIME type for a media file.
+// extensionMimeType should be nil when the content agrees with the extension.
+func (r *Repository) UpdateMediaFileMimeType(ctx context.Context, id, mimeType string, extensionMimeType *string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE media_files SET mime_type = ?, extension_mime_type = ? WHERE id = ?
+	`, mimeType, sqlNullString(extensionMimeType), id)
+	return err
+}
+
+// ListMimeMismatches returns media files whose sniffed type differs from
+// their extension.
+func (r *Repository) ListMimeMismatches(ctx context.Context, offset, limit int) ([]models.MimeMismatch, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM media_files WHERE extension_mime_type IS NOT NULL
+	`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, audiobook_id, filename, mime_type, extension_mime_type
+		FROM media_files
+		WHERE extension_mime_type IS NOT NULL
+		ORDER BY audiobook_id, filename
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	mismatches := []models.MimeMismatch{}
+	for rows.Next() {
+		var m models.MimeMismatch
+		if err := rows.Scan(&m.MediaFileID, &m.AudiobookID, &m.Filename, &m.MimeType, &m.ExtensionMimeType); err != nil {
+			return nil, 0, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, total, rows.Err()
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+const metadataAgentColumns = `id, name, url, api_key, enabled, created_at, updated_at`
+
+// CreateMetadataAgent stores a new metadata agent.
+func (r *Repository) CreateMetadataAgent(ctx context.Context, agent *models.MetadataAgent) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	agent.CreatedAt = now
+	agent.UpdatedAt = now
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO metadata_agents (id, name, url, api_key, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, agent.ID, agent.Name, agent.URL, agent.APIKey, boolToInt(agent.Enabled),
+		now.Format(time.RFC3339), now.Format(time.RFC3339))
+	return err
+}
+
+// ListMetadataAgents returns every metadata agent, oldest first.
+func (r *Repository) ListMetadataAgents(ctx context.Context) ([]models.MetadataAgent, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+metadataAgentColumns+` FROM metadata_agents ORDER BY created_at ASC, name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agents := []models.MetadataAgent{}
+	for rows.Next() {
+		agent, err := scanMetadataAgent(rows)
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, *agent)
+	}
+	return agents, rows.Err()
+}
+
+// GetMetadataAgent returns a metadata agent, or sql.ErrNoRows if there is
+// none.
+func (r *Repository) GetMetadataAgent(ctx context.Context, id string) (*models.MetadataAgent, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+metadataAgentColumns+` FROM metadata_agents WHERE id = ?`, id)
+	return scanMetadataAgent(row)
+}
+
+// UpdateMetadataAgent saves an agent's name, URL, API key and enabled flag.
+func (r *Repository) UpdateMetadataAgent(ctx context.Context, agent *models.MetadataAgent) error {
+	agent.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE metadata_agents SET name = ?, url = ?, api_key = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, agent.Name, agent.URL, agent.APIKey, boolToInt(agent.Enabled), agent.UpdatedAt.Format(time.RFC3339), agent.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteMetadataAgent removes a metadata agent. It returns sql.ErrNoRows if
+// there is none.
+func (r *Repository) DeleteMetadataAgent(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM metadata_agents WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanMetadataAgent(row rowScanner) (*models.MetadataAgent, error) {
+	var agent models.MetadataAgent
+	var createdAt, updatedAt string
+	if err := row.Scan(&agent.ID, &agent.Name, &agent.URL, &agent.APIKey, &agent.Enabled, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	agent.HasAPIKey = agent.APIKey != ""
+	agent.CreatedAt = parseTime(createdAt)
+	agent.UpdatedAt = parseTime(updatedAt)
+	return &agent, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// metadataGapsQuery flags, for every audiobook, the key fields its resolved
+// metadata lacks. A cover counts as present when it was uploaded or is
+// embedded in the files, and a duration when the files have one.
+const metadataGapsQuery = `
+	WITH gaps AS (
+		SELECT a.id AS audiobook_id, a.library_id, COALESCE(rs.title, '') AS title, a.asset_path,
+		       rs.audiobook_id IS NULL AS unresolved,
+		       rs.audiobook_id IS NOT NULL AND TRIM(COALESCE(rs.author, '')) = '' AS author,
+		       rs.audiobook_id IS NOT NULL AND TRIM(COALESCE(rs.cover_url, '')) = ''
+		           AND NOT EXISTS (SELECT 1 FROM audiobook_covers ac WHERE ac.audiobook_id = a.id)
+		           AND NOT EXISTS (SELECT 1 FROM audiobook_metadata_embedded e
+		                           WHERE e.audiobook_id = a.id AND e.embedded_cover IS NOT NULL) AS cover,
+		       COALESCE(rs.duration_sec, 0) <= 0
+		           AND COALESCE((SELECT SUM(mf.duration_sec) FROM media_files mf WHERE mf.audiobook_id = a.id), 0) <= 0 AS duration,
+		       TRIM(COALESCE(rs.series_name, '')) != '' AND TRIM(COALESCE(rs.series_sequence, '')) = '' AS series_sequence,
+		       a.metadata_id IS NULL AS unmatched
+		FROM audiobooks a
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+	)`
+
+// metadataGapColumns maps each gap to its flag column in metadataGapsQuery.
+var metadataGapColumns = map[string]string{
+	models.GapUnresolved:     "unresolved",
+	models.GapAuthor:         "author",
+	models.GapCover:          "cover",
+	models.GapDuration:       "duration",
+	models.GapSeriesSequence: "series_sequence",
+	models.GapUnmatched:      "unmatched",
+}
+
+// anyMetadataGap leaves out unmatched, which is only listed when asked for.
+const anyMetadataGap = `(unresolved OR author OR cover OR duration OR series_sequence)`
+
+// ListMetadataGaps returns the books with at least one metadata gap, or with
+// gap when it is set, optionally in one library, ordered by library and
+// title, and the number of such books.
+func (r *Repository) ListMetadataGaps(ctx context.Context, libraryID *string, gap string, offset, limit int) ([]models.MetadataGapBook, int, error) {
+	where := "\n\tWHERE " + anyMetadataGap
+	var args []interface{}
+	if column, ok := metadataGapColumns[gap]; ok {
+		where = "\n\tWHERE " + column
+	}
+	if libraryID != nil && *libraryID != "" {
+		where += " AND library_id = ?"
+		args = append(args, *libraryID)
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, metadataGapsQuery+`
+	SELECT COUNT(*) FROM gaps`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, metadataGapsQuery+`
+	SELECT audiobook_id, library_id, title, asset_path, unresolved, author, cover, duration, series_sequence, unmatched
+	FROM gaps`+where+`
+	ORDER BY library_id, title COLLATE NOCASE, audiobook_id
+	LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	books := []models.MetadataGapBook{}
+	for rows.Next() {
+		var book models.MetadataGapBook
+		var libraryID sql.NullString
+		var flags [6]bool // in MetadataGaps order
+		if err := rows.Scan(&book.AudiobookID, &libraryID, &book.Title, &book.AssetPath,
+			&flags[0], &flags[1], &flags[2], &flags[3], &flags[4], &flags[5]); err != nil {
+			return nil, 0, err
+		}
+		book.LibraryID = nullableString(libraryID)
+		book.Gaps = []string{}
+		for i, set := range flags {
+			if set {
+				book.Gaps = append(book.Gaps, models.MetadataGaps[i])
+			}
+		}
+		books = append(books, book)
+	}
+	return books, total, rows.Err()
+}
+
+// MetadataGapSummaries counts, per library, the books and those with each
+// metadata gap. Books in no library are summarised under a nil library ID.
+func (r *Repository) MetadataGapSummaries(ctx context.Context) ([]models.MetadataGapSummary, error) {
+	rows, err := r.db.QueryContext(ctx, metadataGapsQuery+`
+	SELECT g.library_id, COALESCE(l.display_name, ''), COUNT(*), COALESCE(SUM(`+anyMetadataGap+`), 0),
+	       COALESCE(SUM(unresolved), 0), COALESCE(SUM(author), 0), COALESCE(SUM(cover), 0),
+	       COALESCE(SUM(duration), 0), COALESCE(SUM(series_sequence), 0), COALESCE(SUM(unmatched), 0)
+	FROM gaps g
+	LEFT JOIN libraries l ON l.id = g.library_id
+	GROUP BY g.library_id, l.display_name
+	ORDER BY l.display_name COLLATE NOCASE, g.library_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.MetadataGapSummary{}
+	for rows.Next() {
+		var summary models.MetadataGapSummary
+		var libraryID sql.NullString
+		var counts [6]int // in MetadataGaps order
+		if err := rows.Scan(&libraryID, &summary.LibraryName, &summary.TotalBooks, &summary.BooksWithGaps,
+			&counts[0], &counts[1], &counts[2], &counts[3], &counts[4], &counts[5]); err != nil {
+			return nil, err
+		}
+		summary.LibraryID = nullableString(libraryID)
+		summary.Gaps = make(map[string]int, len(counts))
+		for i, count := range counts {
+			summary.Gaps[models.MetadataGaps[i]] = count
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,39 @@
+package repository
+
+import "github.com/lore/backend/internal/models"
+
+// Values stored in the *_locked columns of audiobook_metadata_custom.
+const (
+	lockFlagUnlocked = 0
+	lockFlagLocked   = 1 // locked to the stored value, or to blank when NULL
+	lockFlagAgent    = 2 // pinned to the agent value
+)
+
+// applyLockFlag translates a *_locked column into the field's lock mode.
+// The field's custom value must already be populated.
+func applyLockFlag(custom *models.CustomMetadata, field string, flag int64) {
+	switch flag {
+	case lockFlagLocked:
+		if value := custom.FieldValue(field); value != nil && *value != "" {
+			custom.SetLockMode(field, models.LockModeValue)
+		} else {
+			custom.SetLockMode(field, models.LockModeBlank)
+		}
+	case lockFlagAgent:
+		custom.SetLockMode(field, models.LockModeAgent)
+	}
+}
+
+// lockColumns returns the *_locked flag and value to persist for a field.
+// Only value locks keep their value; every other mode stores NULL.
+func lockColumns(custom *models.CustomMetadata, field string) (int, interface{}) {
+	switch custom.LockMode(field) {
+	case models.LockModeValue:
+		return lockFlagLocked, nullable(custom.FieldValue(field))
+	case models.LockModeBlank:
+		return lockFlagLocked, nil
+	case models.LockModeAgent:
+		return lockFlagAgent, nil
+	}
+	return lockFlagUnlocked, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// AudiobookIdentity is what an audiobook is recognised by when records
+// from another server are matched to the library.
+type AudiobookIdentity struct {
+	ID        string
+	LibraryID string
+	AssetPath string
+	Title     string
+	Author    string
+	ASIN      string
+	ISBN      string
+}
+
+// ListAudiobookIdentities returns the folder and resolved title, author and
+// identifiers of every audiobook.
+func (r *Repository) ListAudiobookIdentities(ctx context.Context) ([]AudiobookIdentity, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, COALESCE(a.library_id, ''), a.asset_path, rs.title, rs.author, rs.asin, rs.isbn
+		FROM audiobooks a
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AudiobookIdentity
+	for rows.Next() {
+		var identity AudiobookIdentity
+		var title, author, asin, isbn sql.NullString
+		if err := rows.Scan(&identity.ID, &identity.LibraryID, &identity.AssetPath, &title, &author, &asin, &isbn); err != nil {
+			return nil, err
+		}
+		identity.Title = title.String
+		identity.Author = author.String
+		identity.ASIN = asin.String
+		identity.ISBN = isbn.String
+		list = append(list, identity)
+	}
+	return list, rows.Err()
+}
+
+// UserIDsByUsername maps the lowercased usernames of every user to their
+// IDs.
+func (r *Repository) UserIDsByUsername(ctx context.Context) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, username FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[string]string)
+	for rows.Next() {
+		var id, username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		users[strings.ToLower(username)] = id
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// RecordedAudiobook is an audiobook recorded under a library path, as the
+// scan's missing-file check sees it.
+type RecordedAudiobook struct {
+	ID        string
+	AssetPath string
+	// Missing reports whether the audiobook is marked missing on disk.
+	Missing bool
+}
+
+// ListLibraryPathAudiobooks returns every audiobook scanned from the given
+// library path.
+func (r *Repository) ListLibraryPathAudiobooks(ctx context.Context, libraryPathID string) ([]RecordedAudiobook, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, asset_path, missing_since IS NOT NULL FROM audiobooks
+		WHERE library_path_id = ?
+		ORDER BY asset_path
+	`, libraryPathID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []RecordedAudiobook
+	for rows.Next() {
+		var book RecordedAudiobook
+		if err := rows.Scan(&book.ID, &book.AssetPath, &book.Missing); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// SetAudiobookMissing marks an audiobook missing on disk as of now, or
+// restores it when missing is false. Marking a book already missing keeps
+// the time it was first found missing.
+func (r *Repository) SetAudiobookMissing(ctx context.Context, audiobookID string, missing bool) error {
+	var since interface{}
+	if missing {
+		since = time.Now().UTC().Format(time.RFC3339)
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE audiobooks SET missing_since = CASE WHEN ? IS NULL THEN NULL ELSE COALESCE(missing_since, ?) END
+		WHERE id = ?
+	`, since, since, audiobookID)
+	return err
+}
+
+// ListMissingAudiobooks returns the books marked missing on disk,
+// optionally in one library, longest missing first, and the number of such
+// books.
+func (r *Repository) ListMissingAudiobooks(ctx context.Context, libraryID *string, offset, limit int) ([]models.MissingAudiobook, int, error) {
+	where := "\n\t\tWHERE a.missing_since IS NOT NULL"
+	var args []interface{}
+	if libraryID != nil && *libraryID != "" {
+		where += " AND a.library_id = ?"
+		args = append(args, *libraryID)
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM audiobooks a`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.library_id, COALESCE(rs.title, ''), a.asset_path, a.missing_since
+		FROM audiobooks a
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id`+where+`
+		ORDER BY a.missing_since, a.asset_path
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	books := []models.MissingAudiobook{}
+	for rows.Next() {
+		var book models.MissingAudiobook
+		var libraryID sql.NullString
+		var missingSince string
+		if err := rows.Scan(&book.AudiobookID, &libraryID, &book.Title, &book.AssetPath, &missingSince); err != nil {
+			return nil, 0, err
+		}
+		book.LibraryID = nullableString(libraryID)
+		book.MissingSince = parseTime(missingSince)
+		books = append(books, book)
+	}
+	return books, total, rows.Err()
+}
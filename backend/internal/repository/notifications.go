@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// GetNotificationSettings returns a user's notification settings, or the
+// defaults (every event, no channels) when they have never saved any.
+func (r *Repository) GetNotificationSettings(ctx context.Context, userID string) (*models.NotificationSettings, error) {
+	settings := defaultNotificationSettings(userID)
+
+	var email, webhookURL sql.NullString
+	var updatedAt string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT email, webhook_url, import_completed, import_failed, scan_missing_files, storage_warnings, updated_at
+		FROM notification_settings
+		WHERE user_id = ?
+	`, userID).Scan(&email, &webhookURL, &settings.ImportCompleted, &settings.ImportFailed, &settings.ScanMissing,
+		&settings.StorageWarnings, &updatedAt)
+	if err == sql.ErrNoRows {
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Email = nullableString(email)
+	settings.WebhookURL = nullableString(webhookURL)
+	updated := parseTime(updatedAt)
+	settings.UpdatedAt = &updated
+	return &settings, nil
+}
+
+// UpdateNotificationSettings saves a user's notification settings.
+func (r *Repository) UpdateNotificationSettings(ctx context.Context, settings *models.NotificationSettings) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO notification_settings (user_id, email, webhook_url, import_completed, import_failed, scan_missing_files, storage_warnings, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			email = excluded.email,
+			webhook_url = excluded.webhook_url,
+			import_completed = excluded.import_completed,
+			import_failed = excluded.import_failed,
+			scan_missing_files = excluded.scan_missing_files,
+			storage_warnings = excluded.storage_warnings,
+			updated_at = excluded.updated_at
+	`, settings.UserID, sqlNullString(settings.Email), sqlNullString(settings.WebhookURL),
+		boolToInt(settings.ImportCompleted), boolToInt(settings.ImportFailed), boolToInt(settings.ScanMissing),
+		boolToInt(settings.StorageWarnings), now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	settings.UpdatedAt = &now
+	return nil
+}
+
+// ListAdminNotificationSettings returns the notification settings of every
+// admin, with defaults for admins who have not saved any.
+func (r *Repository) ListAdminNotificationSettings(ctx context.Context) ([]models.NotificationSettings, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, ns.email, ns.webhook_url,
+		       COALESCE(ns.import_completed, 1), COALESCE(ns.import_failed, 1), COALESCE(ns.scan_missing_files, 1),
+		       COALESCE(ns.storage_warnings, 1)
+		FROM users u
+		LEFT JOIN notification_settings ns ON ns.user_id = u.id
+		WHERE u.is_admin = 1
+		ORDER BY u.username
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.NotificationSettings
+	for rows.Next() {
+		var settings models.NotificationSettings
+		var email, webhookURL sql.NullString
+		if err := rows.Scan(&settings.UserID, &email, &webhookURL, &settings.ImportCompleted, &settings.ImportFailed, &settings.ScanMissing,
+			&settings.StorageWarnings); err != nil {
+			return nil, err
+		}
+		settings.Email = nullableString(email)
+		settings.WebhookURL = nullableString(webhookURL)
+		list = append(list, settings)
+	}
+	return list, rows.Err()
+}
+
+func defaultNotificationSettings(userID string) models.NotificationSettings {
+	return models.NotificationSettings{
+		UserID:          userID,
+		ImportCompleted: true,
+		ImportFailed:    true,
+		ScanMissing:     true,
+		StorageWarnings: true,
+	}
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// ListAudiobookIDs returns the IDs of every audiobook in the given libraries,
+// or of all audiobooks when libraryIDs is empty.
+func (r *Repository) ListAudiobookIDs(ctx context.Context, libraryIDs []string) ([]string, error) {
+	return r.audiobookIDsForLibraries(ctx, libraryIDs)
+}
+
+// RelocateAudiobook records a move of an audiobook on disk: the new asset path
+// and, keyed by media file ID, any media filenames that changed.
+func (r *Repository) RelocateAudiobook(ctx context.Context, audiobookID, assetPath string, filenames map[string]string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE audiobooks SET asset_path = ?, updated_at = ? WHERE id = ?
+	`, assetPath, time.Now().UTC().Format(time.RFC3339), audiobookID)
+	if err != nil {
+		return err
+	}
+
+	for mediaFileID, filename := range filenames {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE media_files SET filename = ? WHERE id = ? AND audiobook_id = ?
+		`, filename, mediaFileID, audiobookID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
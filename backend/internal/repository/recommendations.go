@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ListRecommendationMatches returns, for each audiobook the user can see and
+// has neither started nor favourited, what it shares with the books the user
+// finished or favourited: authors, series, narrators and genres. A book
+// counts as finished once its progress reaches completeRatio of its
+// duration. Books sharing nothing are left out; reason weights are unset.
+func (r *Repository) ListRecommendationMatches(ctx context.Context, userID string, libraryID *string, completeRatio float64) (map[string][]models.RecommendationReason, error) {
+	query := `
+		WITH seeds AS (
+			SELECT a.id
+			FROM audiobooks a
+			JOIN user_audiobook_data u ON u.audiobook_id = a.id AND u.user_id = ?
+			LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+			LEFT JOIN (
+				SELECT audiobook_id, SUM(duration_sec) AS total_duration
+				FROM media_files
+				GROUP BY audiobook_id
+			) mf ON mf.audiobook_id = a.id
+			WHERE u.is_favorite = 1
+			   OR (COALESCE(NULLIF(mf.total_duration, 0), rs.duration_sec, 0) > 0
+			       AND u.progress_sec >= COALESCE(NULLIF(mf.total_duration, 0), rs.duration_sec) * ?)
+		),
+		candidates AS (
+			SELECT a.id
+			FROM audiobooks a
+			LEFT JOIN user_audiobook_data u ON u.audiobook_id = a.id AND u.user_id = ?
+			WHERE COALESCE(u.progress_sec, 0) = 0 AND COALESCE(u.is_favorite, 0) = 0`
+	args := []interface{}{userID, completeRatio, userID}
+	if libraryID != nil && *libraryID != "" {
+		query += " AND a.library_id = ?"
+		args = append(args, *libraryID)
+	}
+	query += audiobookListFilter + `
+		)
+		SELECT c.id, 'author', rs.author
+		FROM candidates c
+		JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = c.id
+		WHERE TRIM(COALESCE(rs.author, '')) != ''
+		  AND EXISTS (
+			SELECT 1 FROM seeds s
+			JOIN audiobook_metadata_resolved srs ON srs.audiobook_id = s.id
+			WHERE srs.author = rs.author COLLATE NOCASE
+		  )
+		UNION
+		SELECT c.id, 'series', rs.series_name
+		FROM candidates c
+		JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = c.id
+		WHERE TRIM(COALESCE(rs.series_name, '')) != ''
+		  AND EXISTS (
+			SELECT 1 FROM seeds s
+			JOIN audiobook_metadata_resolved srs ON srs.audiobook_id = s.id
+			WHERE srs.series_name = rs.series_name COLLATE NOCASE
+		  )
+		UNION
+		SELECT c.id, 'narrator', n.name
+		FROM candidates c
+		JOIN audiobook_narrators an ON an.audiobook_id = c.id
+		JOIN narrators n ON n.slug = an.narrator_slug
+		WHERE an.narrator_slug IN (
+			SELECT sn.narrator_slug FROM seeds s
+			JOIN audiobook_narrators sn ON sn.audiobook_id = s.id
+		)
+		UNION
+		SELECT c.id, 'genre', g.name
+		FROM candidates c
+		JOIN audiobook_genres ag ON ag.audiobook_id = c.id
+		JOIN genres g ON g.slug = ag.genre_slug
+		WHERE ag.genre_slug IN (
+			SELECT sg.genre_slug FROM seeds s
+			JOIN audiobook_genres sg ON sg.audiobook_id = s.id
+		)
+		ORDER BY 1, 2, 3`
+	args = append(args, userID, userID)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make(map[string][]models.RecommendationReason)
+	for rows.Next() {
+		var id string
+		var reason models.RecommendationReason
+		if err := rows.Scan(&id, &reason.Kind, &reason.Name); err != nil {
+			return nil, err
+		}
+		matches[id] = append(matches[id], reason)
+	}
+	return matches, rows.Err()
+}
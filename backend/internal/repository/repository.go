@@ -6,12 +6,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"regexp"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/metadata"
 	"github.com/lore/backend/internal/models"
 )
 
@@ -25,6 +27,11 @@ func New(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// Ping checks that the database is reachable.
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
 // CreateAudiobook persists an audiobook, its media entries, and default user data.
 func (r *Repository) CreateAudiobook(ctx context.Context, audiobook *models.Audiobook, media []models.MediaFile, userID string) error {
 	now := time.Now().UTC()
@@ -52,9 +59,19 @@ func (r *Repository) CreateAudiobook(ctx context.Context, audiobook *models.Audi
 
 	for _, mf := range media {
 		_, err = tx.ExecContext(ctx, `
-            INSERT INTO media_files (id, audiobook_id, filename, duration_sec, mime_type)
-            VALUES (?, ?, ?, ?, ?)
-        `, mf.ID, mf.AudiobookID, mf.Filename, mf.DurationSec, mf.MimeType)
+            INSERT INTO media_files (id, audiobook_id, filename, duration_sec, mime_type, extension_mime_type)
+            VALUES (?, ?, ?, ?, ?, ?)
+        `, mf.ID, mf.AudiobookID, mf.Filename, mf.DurationSec, mf.MimeType, sqlNullString(mf.ExtensionMimeType))
+		if err != nil {
+			return err
+		}
+	}
+
+	if audiobook.LibraryID != nil {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO activity (id, library_id, audiobook_id, type, created_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, uuid.NewString(), *audiobook.LibraryID, audiobook.ID, models.ActivityBookAdded, audiobook.CreatedAt.Format(time.RFC3339))
 		if err != nil {
 			return err
 		}
@@ -82,7 +99,7 @@ func (r *Repository) CreateAudiobook(ctx context.Context, audiobook *models.Audi
 // GetAudiobook fetches a single audiobook with all metadata layers in a single query.
 func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*models.Audiobook, error) {
 	row := r.db.QueryRowContext(ctx, `
-        SELECT a.id, a.library_id, a.metadata_id, a.asset_path, a.library_path_id, a.created_at, a.updated_at,
+        SELECT a.id, a.library_id, a.metadata_id, a.asset_path, a.library_path_id, a.created_at, a.updated_at, a.missing_since,
                m.id, m.title, m.subtitle, m.author, m.narrator, m.description,
                m.cover_url, m.series_name, m.series_sequence, m.release_date, m.isbn, m.asin,
                m.language, m.publisher, m.duration_sec, m.rating, m.rating_count,
@@ -102,6 +119,8 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
                c.language, c.language_locked,
                c.publisher, c.publisher_locked,
                c.genres, c.genres_locked,
+               c.sort_title, c.sort_title_locked,
+               c.sort_author, c.sort_author_locked,
                c.updated_at, c.updated_by,
                u.user_id, u.progress_sec, u.is_favorite, u.last_played_at
         FROM audiobooks a
@@ -121,7 +140,7 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 	var ratingCount sql.NullInt64
 	var metaCreatedAt, metaUpdatedAt sql.NullString
 	var metadataID sql.NullString
-	var libraryID sql.NullString
+	var libraryID, missingSince sql.NullString
 	var userIDVal, lastPlayedAt sql.NullString
 	var progress sql.NullFloat64
 	var favorite sql.NullInt64
@@ -134,11 +153,13 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 	var customDescriptionLocked, customCoverURLLocked, customSeriesNameLocked, customSeriesSequenceLocked sql.NullInt64
 	var customReleaseDateLocked, customISBNLocked, customASINLocked, customLanguageLocked sql.NullInt64
 	var customPublisherLocked, customGenresLocked sql.NullInt64
+	var customSortTitle, customSortAuthor sql.NullString
+	var customSortTitleLocked, customSortAuthorLocked sql.NullInt64
 	var customUpdatedAt sql.NullString
 	var customUpdatedBy sql.NullString
 
 	err := row.Scan(
-		&ab.ID, &libraryID, &metadataID, &ab.AssetPath, &ab.LibraryPathID, &createdAt, &updatedAt,
+		&ab.ID, &libraryID, &metadataID, &ab.AssetPath, &ab.LibraryPathID, &createdAt, &updatedAt, &missingSince,
 		&metaID, &title, &subtitle, &author, &narrator, &description,
 		&coverURL, &seriesName, &seriesSequence, &releaseDate, &isbn, &asin,
 		&language, &publisher, &durationSec, &rating, &ratingCount,
@@ -158,6 +179,8 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 		&customLanguage, &customLanguageLocked,
 		&customPublisher, &customPublisherLocked,
 		&customGenres, &customGenresLocked,
+		&customSortTitle, &customSortTitleLocked,
+		&customSortAuthor, &customSortAuthorLocked,
 		&customUpdatedAt, &customUpdatedBy,
 		&userIDVal, &progress, &favorite, &lastPlayedAt,
 	)
@@ -172,6 +195,10 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 	ab.MetadataID = nullableString(metadataID)
 	ab.CreatedAt = parseTime(createdAt)
 	ab.UpdatedAt = parseTime(updatedAt)
+	if missingSince.Valid {
+		t := parseTime(missingSince.String)
+		ab.MissingSince = &t
+	}
 
 	if metaID.Valid && metaID.String != "" {
 		metadata.ID = metaID.String
@@ -211,6 +238,8 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 			UpdatedAt:   parseTime(metaUpdatedAt.String),
 		}
 		ab.AgentMetadata = &agentMeta
+		// Carry the full agent record so resolution sees every field (genres, identifiers, ...)
+		metadata = agentMeta
 		ab.Metadata = &metadata // Temporary, will be replaced by ResolveMetadata()
 	}
 
@@ -232,53 +261,29 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 			Language:       nullableString(customLanguage),
 			Publisher:      nullableString(customPublisher),
 			Genres:         nullableString(customGenres),
+			SortTitle:      nullableString(customSortTitle),
+			SortAuthor:     nullableString(customSortAuthor),
 			Locks:          make(map[string]bool),
 			UpdatedAt:      parseTime(customUpdatedAt.String),
 			UpdatedBy:      nullableString(customUpdatedBy),
 		}
 		// Build locks map
-		if customTitleLocked.Valid && customTitleLocked.Int64 == 1 {
-			custom.Locks["title"] = true
-		}
-		if customSubtitleLocked.Valid && customSubtitleLocked.Int64 == 1 {
-			custom.Locks["subtitle"] = true
-		}
-		if customAuthorLocked.Valid && customAuthorLocked.Int64 == 1 {
-			custom.Locks["author"] = true
-		}
-		if customNarratorLocked.Valid && customNarratorLocked.Int64 == 1 {
-			custom.Locks["narrator"] = true
-		}
-		if customDescriptionLocked.Valid && customDescriptionLocked.Int64 == 1 {
-			custom.Locks["description"] = true
-		}
-		if customCoverURLLocked.Valid && customCoverURLLocked.Int64 == 1 {
-			custom.Locks["cover_url"] = true
-		}
-		if customSeriesNameLocked.Valid && customSeriesNameLocked.Int64 == 1 {
-			custom.Locks["series_name"] = true
-		}
-		if customSeriesSequenceLocked.Valid && customSeriesSequenceLocked.Int64 == 1 {
-			custom.Locks["series_sequence"] = true
-		}
-		if customReleaseDateLocked.Valid && customReleaseDateLocked.Int64 == 1 {
-			custom.Locks["release_date"] = true
-		}
-		if customISBNLocked.Valid && customISBNLocked.Int64 == 1 {
-			custom.Locks["isbn"] = true
-		}
-		if customASINLocked.Valid && customASINLocked.Int64 == 1 {
-			custom.Locks["asin"] = true
-		}
-		if customLanguageLocked.Valid && customLanguageLocked.Int64 == 1 {
-			custom.Locks["language"] = true
-		}
-		if customPublisherLocked.Valid && customPublisherLocked.Int64 == 1 {
-			custom.Locks["publisher"] = true
-		}
-		if customGenresLocked.Valid && customGenresLocked.Int64 == 1 {
-			custom.Locks["genres"] = true
-		}
+		applyLockFlag(&custom, "title", customTitleLocked.Int64)
+		applyLockFlag(&custom, "subtitle", customSubtitleLocked.Int64)
+		applyLockFlag(&custom, "author", customAuthorLocked.Int64)
+		applyLockFlag(&custom, "narrator", customNarratorLocked.Int64)
+		applyLockFlag(&custom, "description", customDescriptionLocked.Int64)
+		applyLockFlag(&custom, "cover_url", customCoverURLLocked.Int64)
+		applyLockFlag(&custom, "series_name", customSeriesNameLocked.Int64)
+		applyLockFlag(&custom, "series_sequence", customSeriesSequenceLocked.Int64)
+		applyLockFlag(&custom, "release_date", customReleaseDateLocked.Int64)
+		applyLockFlag(&custom, "isbn", customISBNLocked.Int64)
+		applyLockFlag(&custom, "asin", customASINLocked.Int64)
+		applyLockFlag(&custom, "language", customLanguageLocked.Int64)
+		applyLockFlag(&custom, "publisher", customPublisherLocked.Int64)
+		applyLockFlag(&custom, "genres", customGenresLocked.Int64)
+		applyLockFlag(&custom, "sort_title", customSortTitleLocked.Int64)
+		applyLockFlag(&custom, "sort_author", customSortAuthorLocked.Int64)
 		ab.CustomMetadata = &custom
 	}
 
@@ -302,6 +307,36 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 	}
 	ab.MediaFiles = media
 
+	supplements, err := r.supplementFiles(ctx, ab.ID)
+	if err != nil {
+		return nil, err
+	}
+	ab.SupplementFiles = supplements
+
+	if err := r.attachEditions(ctx, &ab, userID); err != nil {
+		return nil, err
+	}
+
+	customFields, err := r.customFieldValues(ctx, ab.ID)
+	if err != nil {
+		return nil, err
+	}
+	ab.CustomFields = customFields
+
+	ratings, err := r.ratingSummary(ctx, ab.ID)
+	if err != nil {
+		return nil, err
+	}
+	ab.UserRatings = ratings
+
+	if ab.AgentMetadata != nil {
+		identifiers, err := r.ListAgentMetadataIdentifiers(ctx, ab.AgentMetadata.ID)
+		if err != nil {
+			return nil, err
+		}
+		ab.AgentMetadata.Identifiers = identifiers
+	}
+
 	// Fetch embedded metadata layer (raw file tags)
 	embedded, err := r.GetEmbeddedMetadata(ctx, ab.ID)
 	if err == nil {
@@ -309,11 +344,59 @@ func (r *Repository) GetAudiobook(ctx context.Context, id, userID string) (*mode
 	}
 	// Ignore error if no embedded metadata exists
 
+	sidecar, err := r.GetSidecarMetadata(ctx, ab.ID)
+	if err != nil {
+		return nil, err
+	}
+	ab.SidecarMetadata = sidecar
+
+	order, err := r.libraryMetadataOrder(ctx, ab.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+	ab.MetadataOrder = order
+
 	// Populate the Metadata field with resolved metadata from all layers
 	// This ensures backward compatibility and provides the final display values
 	ab.Metadata = ab.ResolveMetadata()
+	collation, err := r.libraryCollation(ctx, ab.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+	format, err := r.libraryContributorFormat(ctx, ab.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+	applyContributorFormat(ab.Metadata, format)
+	applySortNames(ab.Metadata, collation, format)
+	ab.ApplyProgress()
 
-	return &ab, nil
+	books := []models.Audiobook{ab}
+	if err := r.attachCoverPlaceholders(ctx, books); err != nil {
+		return nil, err
+	}
+
+	return &books[0], nil
+}
+
+// GetAudiobookListings fetches the listing entries of the given audiobooks
+// the user can see, in the order of ids, with one query.
+func (r *Repository) GetAudiobookListings(ctx context.Context, ids []string, userID string) ([]models.Audiobook, error) {
+	found, _, err := r.ListAudiobooks(ctx, userID, nil, models.AudiobookFilter{IDs: ids}, 0, len(ids))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Audiobook, len(found))
+	for _, book := range found {
+		byID[book.ID] = book
+	}
+	books := make([]models.Audiobook, 0, len(ids))
+	for _, id := range ids {
+		if book, ok := byID[id]; ok {
+			books = append(books, book)
+		}
+	}
+	return books, nil
 }
 
 // DeleteAudiobook removes the audiobook and cascades to related tables.
@@ -322,10 +405,25 @@ func (r *Repository) DeleteAudiobook(ctx context.Context, id string) error {
 	return err
 }
 
+// MoveAudiobook assigns an audiobook to a library and library path and
+// records its asset path, in one update.
+func (r *Repository) MoveAudiobook(ctx context.Context, audiobookID, libraryID, libraryPathID, assetPath string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE audiobooks SET library_id = ?, library_path_id = ?, asset_path = ?, updated_at = ? WHERE id = ?
+	`, libraryID, libraryPathID, assetPath, time.Now().UTC().Format(time.RFC3339), audiobookID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // GetMediaFileWithAudiobook fetches a media file alongside its parent audiobook.
 func (r *Repository) GetMediaFileWithAudiobook(ctx context.Context, fileID string) (*models.MediaFile, *models.Audiobook, error) {
 	row := r.db.QueryRowContext(ctx, `
-        SELECT mf.id, mf.audiobook_id, mf.filename, mf.duration_sec, mf.mime_type,
+        SELECT mf.id, mf.audiobook_id, mf.filename, mf.duration_sec, mf.mime_type, mf.extension_mime_type,
                a.id, a.asset_path
         FROM media_files mf
         INNER JOIN audiobooks a ON a.id = mf.audiobook_id
@@ -334,13 +432,15 @@ func (r *Repository) GetMediaFileWithAudiobook(ctx context.Context, fileID strin
 
 	var media models.MediaFile
 	var audiobook models.Audiobook
+	var extensionMime sql.NullString
 
 	if err := row.Scan(
-		&media.ID, &media.AudiobookID, &media.Filename, &media.DurationSec, &media.MimeType,
+		&media.ID, &media.AudiobookID, &media.Filename, &media.DurationSec, &media.MimeType, &extensionMime,
 		&audiobook.ID, &audiobook.AssetPath,
 	); err != nil {
 		return nil, nil, err
 	}
+	media.ExtensionMimeType = nullableString(extensionMime)
 
 	return &media, &audiobook, nil
 }
@@ -496,18 +596,46 @@ func (r *Repository) UpdateUserProgress(ctx context.Context, userID, audiobookID
 	return r.fetchUserData(ctx, userID, audiobookID)
 }
 
+// SeedUserProgress records progress imported from another player. It only
+// writes when the user has not started the audiobook in Lore, so imports
+// never overwrite real listening, and reports whether it wrote anything.
+// A favorite flag is only ever added.
+func (r *Repository) SeedUserProgress(ctx context.Context, userID, audiobookID string, progressSec float64, favorite bool, lastPlayedAt *time.Time) (bool, error) {
+	var lastPlayed string
+	if lastPlayedAt != nil {
+		lastPlayed = lastPlayedAt.UTC().Format(time.RFC3339)
+	}
+	result, err := r.db.ExecContext(ctx, `
+        INSERT INTO user_audiobook_data (user_id, audiobook_id, progress_sec, is_favorite, last_played_at)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT(user_id, audiobook_id) DO UPDATE SET
+            progress_sec = excluded.progress_sec,
+            is_favorite = MAX(user_audiobook_data.is_favorite, excluded.is_favorite),
+            last_played_at = excluded.last_played_at
+        WHERE user_audiobook_data.progress_sec = 0 AND user_audiobook_data.last_played_at IS NULL
+    `, userID, audiobookID, progressSec, boolToInt(favorite), nullable(&lastPlayed))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
 // SetUserFavorite toggles the favorite flag for a user/audiobook pair.
 func (r *Repository) SetUserFavorite(ctx context.Context, userID, audiobookID string, isFavorite bool) (*models.UserAudiobookData, error) {
 	fav := 0
 	if isFavorite {
 		fav = 1
 	}
+	// Favourites are kept per work: every edition of the book follows.
 	_, err := r.db.ExecContext(ctx, `
         INSERT INTO user_audiobook_data (user_id, audiobook_id, progress_sec, is_favorite, last_played_at)
-        VALUES (?, ?, 0, ?, NULL)
+        SELECT ?, a.id, 0, ?, NULL
+        FROM audiobooks a
+        WHERE a.id = ? OR a.work_id = (SELECT work_id FROM audiobooks WHERE id = ?)
         ON CONFLICT(user_id, audiobook_id) DO UPDATE SET
             is_favorite = excluded.is_favorite
-    `, userID, audiobookID, fav)
+    `, userID, fav, audiobookID, audiobookID)
 	if err != nil {
 		return nil, err
 	}
@@ -537,7 +665,7 @@ func (r *Repository) fetchUserData(ctx context.Context, userID, audiobookID stri
 
 func (r *Repository) mediaFiles(ctx context.Context, audiobookID string) ([]models.MediaFile, error) {
 	rows, err := r.db.QueryContext(ctx, `
-        SELECT id, audiobook_id, filename, duration_sec, mime_type
+        SELECT id, audiobook_id, filename, duration_sec, mime_type, extension_mime_type, sort_index
         FROM media_files
         WHERE audiobook_id = ?
         ORDER BY filename
@@ -550,9 +678,13 @@ func (r *Repository) mediaFiles(ctx context.Context, audiobookID string) ([]mode
 	var media []models.MediaFile
 	for rows.Next() {
 		var mf models.MediaFile
-		if err := rows.Scan(&mf.ID, &mf.AudiobookID, &mf.Filename, &mf.DurationSec, &mf.MimeType); err != nil {
+		var extensionMime sql.NullString
+		var sortIndex sql.NullInt64
+		if err := rows.Scan(&mf.ID, &mf.AudiobookID, &mf.Filename, &mf.DurationSec, &mf.MimeType, &extensionMime, &sortIndex); err != nil {
 			return nil, err
 		}
+		mf.ExtensionMimeType = nullableString(extensionMime)
+		mf.SortIndex = nullableInt64(sortIndex)
 		media = append(media, mf)
 	}
 	if err := rows.Err(); err != nil {
@@ -561,6 +693,7 @@ func (r *Repository) mediaFiles(ctx context.Context, audiobookID string) ([]mode
 
 	// Apply natural sort to handle numeric sequences properly
 	naturalSort(media)
+	applyTrackOrder(media)
 	return media, nil
 }
 
@@ -636,7 +769,7 @@ func (r *Repository) UserHasAudiobookInLibrary(ctx context.Context, userID, audi
 }
 
 // ListAudiobooks returns all audiobooks with user progress and favorites attached (NULL if user hasn't interacted).
-func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryID *string, offset, limit int) ([]models.Audiobook, int, error) {
+func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryID *string, filter models.AudiobookFilter, offset, limit int) ([]models.Audiobook, int, error) {
 	// First get total count
 	var total int
 	countQuery := `
@@ -648,6 +781,11 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		countQuery += " AND a.library_id = ?"
 		countArgs = append(countArgs, *libraryID)
 	}
+	countQuery += audiobookListFilter
+	countArgs = append(countArgs, userID, userID)
+	filterClause, filterArgs := audiobookFilterClause(filter)
+	countQuery += filterClause
+	countArgs = append(countArgs, filterArgs...)
 
 	err := r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
 	if err != nil {
@@ -658,7 +796,7 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 	query := `
 		SELECT a.id, a.library_id, a.metadata_id, a.asset_path, a.library_path_id, a.created_at, a.updated_at,
 		       m.id, m.title, m.subtitle, m.author, m.narrator, m.description,
-		       m.cover_url, m.series_name, m.series_sequence, m.release_date,
+		       m.cover_url, m.series_name, m.series_sequence, m.release_date, m.duration_sec,
 		       c.audiobook_id,
 		       c.title, c.title_locked,
 		       c.subtitle, c.subtitle_locked,
@@ -674,7 +812,10 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		       c.language, c.language_locked,
 		       c.publisher, c.publisher_locked,
 		       c.genres, c.genres_locked,
+		       c.sort_title, c.sort_title_locked,
+		       c.sort_author, c.sort_author_locked,
 		       c.updated_at, c.updated_by,
+		       rs.sort_title, rs.sort_author,
 		       u.user_id, u.progress_sec, u.is_favorite, u.last_played_at,
 		       COALESCE(mf_stats.file_count, 0) as file_count,
 		       COALESCE(mf_stats.total_duration, 0) as total_duration_sec
@@ -682,6 +823,7 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		LEFT JOIN audiobook_metadata_agent m ON m.id = a.metadata_id
 		LEFT JOIN audiobook_metadata_custom c ON c.audiobook_id = a.id
 		LEFT JOIN user_audiobook_data u ON u.audiobook_id = a.id AND u.user_id = ?
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
 		LEFT JOIN (
 			SELECT audiobook_id,
 			       COUNT(*) as file_count,
@@ -696,8 +838,17 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		query += " AND a.library_id = ?"
 		queryArgs = append(queryArgs, *libraryID)
 	}
-
-	query += "\nORDER BY u.last_played_at DESC\nLIMIT ? OFFSET ?"
+	query += audiobookListFilter
+	queryArgs = append(queryArgs, userID, userID)
+	query += filterClause
+	queryArgs = append(queryArgs, filterArgs...)
+	cursorClause, cursorArgs := audiobookCursorClause(filter)
+	query += cursorClause
+	queryArgs = append(queryArgs, cursorArgs...)
+
+	orderClause, orderArgs := audiobookOrderClause(filter, userID, "u.last_played_at DESC")
+	query += "\nORDER BY " + orderClause + "\nLIMIT ? OFFSET ?"
+	queryArgs = append(queryArgs, orderArgs...)
 	queryArgs = append(queryArgs, limit, offset)
 
 	rows, err := r.db.QueryContext(ctx, query, queryArgs...)
@@ -713,6 +864,7 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		var metaRow models.BookMetadata
 		var metaID, title, author sql.NullString
 		var subtitle, narrator, description, coverURL, seriesName, seriesSequence, releaseDate sql.NullString
+		var durationSec sql.NullFloat64
 		var metadataID sql.NullString
 		var libraryID sql.NullString
 		var customAudiobookID sql.NullString
@@ -723,8 +875,11 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		var customDescriptionLocked, customCoverURLLocked, customSeriesNameLocked, customSeriesSequenceLocked sql.NullInt64
 		var customReleaseDateLocked, customISBNLocked, customASINLocked, customLanguageLocked sql.NullInt64
 		var customPublisherLocked, customGenresLocked sql.NullInt64
+		var customSortTitle, customSortAuthor sql.NullString
+		var customSortTitleLocked, customSortAuthorLocked sql.NullInt64
 		var customUpdatedAt sql.NullString
 		var customUpdatedBy sql.NullString
+		var resolvedSortTitle, resolvedSortAuthor sql.NullString
 		var userIDVal, lastPlayedAt sql.NullString
 		var progress sql.NullFloat64
 		var favorite sql.NullInt64
@@ -734,7 +889,7 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		if err := rows.Scan(
 			&ab.ID, &libraryID, &metadataID, &ab.AssetPath, &ab.LibraryPathID, &createdAt, &updatedAt,
 			&metaID, &title, &subtitle, &author, &narrator, &description,
-			&coverURL, &seriesName, &seriesSequence, &releaseDate,
+			&coverURL, &seriesName, &seriesSequence, &releaseDate, &durationSec,
 			&customAudiobookID,
 			&customTitle, &customTitleLocked,
 			&customSubtitle, &customSubtitleLocked,
@@ -750,7 +905,10 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 			&customLanguage, &customLanguageLocked,
 			&customPublisher, &customPublisherLocked,
 			&customGenres, &customGenresLocked,
+			&customSortTitle, &customSortTitleLocked,
+			&customSortAuthor, &customSortAuthorLocked,
 			&customUpdatedAt, &customUpdatedBy,
+			&resolvedSortTitle, &resolvedSortAuthor,
 			&userIDVal, &progress, &favorite, &lastPlayedAt,
 			&fileCount, &totalDuration,
 		); err != nil {
@@ -775,6 +933,7 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 			metaRow.SeriesName = nullableString(seriesName)
 			metaRow.SeriesSequence = nullableString(seriesSequence)
 			metaRow.ReleaseDate = nullableString(releaseDate)
+			metaRow.DurationSec = nullableFloat64(durationSec)
 			if strings.TrimSpace(metaRow.Title) != "" {
 				ab.Metadata = &metaRow
 			}
@@ -798,53 +957,29 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 				Language:       nullableString(customLanguage),
 				Publisher:      nullableString(customPublisher),
 				Genres:         nullableString(customGenres),
+				SortTitle:      nullableString(customSortTitle),
+				SortAuthor:     nullableString(customSortAuthor),
 				Locks:          make(map[string]bool),
 				UpdatedAt:      parseTime(customUpdatedAt.String),
 				UpdatedBy:      nullableString(customUpdatedBy),
 			}
 			// Build locks map
-			if customTitleLocked.Valid && customTitleLocked.Int64 == 1 {
-				custom.Locks["title"] = true
-			}
-			if customSubtitleLocked.Valid && customSubtitleLocked.Int64 == 1 {
-				custom.Locks["subtitle"] = true
-			}
-			if customAuthorLocked.Valid && customAuthorLocked.Int64 == 1 {
-				custom.Locks["author"] = true
-			}
-			if customNarratorLocked.Valid && customNarratorLocked.Int64 == 1 {
-				custom.Locks["narrator"] = true
-			}
-			if customDescriptionLocked.Valid && customDescriptionLocked.Int64 == 1 {
-				custom.Locks["description"] = true
-			}
-			if customCoverURLLocked.Valid && customCoverURLLocked.Int64 == 1 {
-				custom.Locks["cover_url"] = true
-			}
-			if customSeriesNameLocked.Valid && customSeriesNameLocked.Int64 == 1 {
-				custom.Locks["series_name"] = true
-			}
-			if customSeriesSequenceLocked.Valid && customSeriesSequenceLocked.Int64 == 1 {
-				custom.Locks["series_sequence"] = true
-			}
-			if customReleaseDateLocked.Valid && customReleaseDateLocked.Int64 == 1 {
-				custom.Locks["release_date"] = true
-			}
-			if customISBNLocked.Valid && customISBNLocked.Int64 == 1 {
-				custom.Locks["isbn"] = true
-			}
-			if customASINLocked.Valid && customASINLocked.Int64 == 1 {
-				custom.Locks["asin"] = true
-			}
-			if customLanguageLocked.Valid && customLanguageLocked.Int64 == 1 {
-				custom.Locks["language"] = true
-			}
-			if customPublisherLocked.Valid && customPublisherLocked.Int64 == 1 {
-				custom.Locks["publisher"] = true
-			}
-			if customGenresLocked.Valid && customGenresLocked.Int64 == 1 {
-				custom.Locks["genres"] = true
-			}
+			applyLockFlag(&custom, "title", customTitleLocked.Int64)
+			applyLockFlag(&custom, "subtitle", customSubtitleLocked.Int64)
+			applyLockFlag(&custom, "author", customAuthorLocked.Int64)
+			applyLockFlag(&custom, "narrator", customNarratorLocked.Int64)
+			applyLockFlag(&custom, "description", customDescriptionLocked.Int64)
+			applyLockFlag(&custom, "cover_url", customCoverURLLocked.Int64)
+			applyLockFlag(&custom, "series_name", customSeriesNameLocked.Int64)
+			applyLockFlag(&custom, "series_sequence", customSeriesSequenceLocked.Int64)
+			applyLockFlag(&custom, "release_date", customReleaseDateLocked.Int64)
+			applyLockFlag(&custom, "isbn", customISBNLocked.Int64)
+			applyLockFlag(&custom, "asin", customASINLocked.Int64)
+			applyLockFlag(&custom, "language", customLanguageLocked.Int64)
+			applyLockFlag(&custom, "publisher", customPublisherLocked.Int64)
+			applyLockFlag(&custom, "genres", customGenresLocked.Int64)
+			applyLockFlag(&custom, "sort_title", customSortTitleLocked.Int64)
+			applyLockFlag(&custom, "sort_author", customSortAuthorLocked.Int64)
 			ab.CustomMetadata = &custom
 		}
 
@@ -865,6 +1000,8 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 
 		// Apply metadata resolution to get final display values
 		ab.Metadata = ab.ResolveMetadata()
+		fillSortNames(ab.Metadata, resolvedSortTitle, resolvedSortAuthor)
+		ab.ApplyProgress()
 
 		audiobooks = append(audiobooks, ab)
 	}
@@ -873,6 +1010,10 @@ func (r *Repository) ListAudiobooks(ctx context.Context, userID string, libraryI
 		return nil, 0, err
 	}
 
+	if err := r.attachCoverPlaceholders(ctx, audiobooks); err != nil {
+		return nil, 0, err
+	}
+
 	return audiobooks, total, nil
 }
 
@@ -924,26 +1065,46 @@ func (r *Repository) GetAudiobookByPath(ctx context.Context, assetPath string) (
 }
 
 // SearchAudiobooks searches audiobooks by title, author, or narrator with user data attached (NULL if user hasn't interacted).
-func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string, libraryID *string, offset, limit int) ([]models.Audiobook, int, error) {
+func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string, libraryID *string, filter models.AudiobookFilter, offset, limit int) ([]models.Audiobook, int, error) {
 	// Build search pattern for LIKE queries
 	searchPattern := "%" + query + "%"
+	orders, err := r.libraryMetadataOrders(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var searchArgs []interface{}
+	var searchFields []string
+	for _, field := range []string{"title", "author", "narrator"} {
+		clause, args := resolvedSearchField(field, orders)
+		searchFields = append(searchFields, clause+" LIKE ?")
+		searchArgs = append(append(searchArgs, args...), searchPattern)
+	}
+	searchCondition := "(" + strings.Join(searchFields, " OR ") + ")"
 
 	// First, get the total count
 	countQuery := `
 		SELECT COUNT(DISTINCT a.id)
 		FROM audiobooks a
 		LEFT JOIN audiobook_metadata_agent m ON m.id = a.metadata_id
-		WHERE (m.title LIKE ? OR m.author LIKE ? OR m.narrator LIKE ?)
+		LEFT JOIN audiobook_metadata_custom c ON c.audiobook_id = a.id
+		LEFT JOIN audiobook_metadata_sidecar sc ON sc.audiobook_id = a.id
+		LEFT JOIN audiobook_metadata_embedded e ON e.audiobook_id = a.id
+		WHERE ` + searchCondition + `
 	`
 
 	var total int
-	var countArgs = []interface{}{searchPattern, searchPattern, searchPattern}
+	var countArgs = append([]interface{}{}, searchArgs...)
 	if libraryID != nil && *libraryID != "" {
 		countQuery += " AND a.library_id = ?"
 		countArgs = append(countArgs, *libraryID)
 	}
+	countQuery += audiobookListFilter
+	countArgs = append(countArgs, userID, userID)
+	filterClause, filterArgs := audiobookFilterClause(filter)
+	countQuery += filterClause
+	countArgs = append(countArgs, filterArgs...)
 
-	err := r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
+	err = r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -968,12 +1129,20 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 		       c.language, c.language_locked,
 		       c.publisher, c.publisher_locked,
 		       c.genres, c.genres_locked,
+		       c.sort_title, c.sort_title_locked,
+		       c.sort_author, c.sort_author_locked,
 		       c.updated_at, c.updated_by,
+		       rs.sort_title, rs.sort_author,
+		       sc.audiobook_id, sc.title, sc.subtitle, sc.author, sc.narrator, sc.series_name, sc.series_sequence, sc.read_at,
+		       e.audiobook_id, e.title, e.subtitle, e.author, e.narrator, e.series_name, e.series_sequence, e.extracted_at,
 		       COALESCE(mf_stats.file_count, 0) as file_count,
 		       COALESCE(mf_stats.total_duration, 0) as total_duration_sec
 		FROM audiobooks a
 		LEFT JOIN audiobook_metadata_agent m ON m.id = a.metadata_id
 		LEFT JOIN audiobook_metadata_custom c ON c.audiobook_id = a.id
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+		LEFT JOIN audiobook_metadata_sidecar sc ON sc.audiobook_id = a.id
+		LEFT JOIN audiobook_metadata_embedded e ON e.audiobook_id = a.id
 		LEFT JOIN (
 			SELECT audiobook_id,
 			       COUNT(*) as file_count,
@@ -981,16 +1150,25 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 			FROM media_files
 			GROUP BY audiobook_id
 		) mf_stats ON mf_stats.audiobook_id = a.id
-		WHERE (m.title LIKE ? OR m.author LIKE ? OR m.narrator LIKE ?)
+		WHERE ` + searchCondition + `
 `
 
-	queryArgs := []interface{}{searchPattern, searchPattern, searchPattern}
+	queryArgs := append([]interface{}{}, searchArgs...)
 	if libraryID != nil && *libraryID != "" {
 		searchQuery += " AND a.library_id = ?"
 		queryArgs = append(queryArgs, *libraryID)
 	}
-
-	searchQuery += "\nORDER BY a.created_at DESC\nLIMIT ? OFFSET ?"
+	searchQuery += audiobookListFilter
+	queryArgs = append(queryArgs, userID, userID)
+	searchQuery += filterClause
+	queryArgs = append(queryArgs, filterArgs...)
+	cursorClause, cursorArgs := audiobookCursorClause(filter)
+	searchQuery += cursorClause
+	queryArgs = append(queryArgs, cursorArgs...)
+
+	orderClause, orderArgs := audiobookOrderClause(filter, userID, "a.created_at DESC")
+	searchQuery += "\nORDER BY " + orderClause + "\nLIMIT ? OFFSET ?"
+	queryArgs = append(queryArgs, orderArgs...)
 	queryArgs = append(queryArgs, limit, offset)
 
 	rows, err := r.db.QueryContext(ctx, searchQuery, queryArgs...)
@@ -1006,7 +1184,7 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 		var createdAt, updatedAt string
 		var metaRow models.BookMetadata
 		var subtitle, narrator, description, coverURL, seriesName, seriesSequence, releaseDate sql.NullString
-		var metaID sql.NullString
+		var metaID, title, author sql.NullString
 		var libraryID sql.NullString
 		var customAudiobookID sql.NullString
 		var customTitle, customSubtitle, customAuthor, customNarrator, customDescription sql.NullString
@@ -1016,14 +1194,21 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 		var customDescriptionLocked, customCoverURLLocked, customSeriesNameLocked, customSeriesSequenceLocked sql.NullInt64
 		var customReleaseDateLocked, customISBNLocked, customASINLocked, customLanguageLocked sql.NullInt64
 		var customPublisherLocked, customGenresLocked sql.NullInt64
+		var customSortTitle, customSortAuthor sql.NullString
+		var customSortTitleLocked, customSortAuthorLocked sql.NullInt64
 		var customUpdatedAt sql.NullString
 		var customUpdatedBy sql.NullString
+		var resolvedSortTitle, resolvedSortAuthor sql.NullString
+		var sidecarID, sidecarTitle, sidecarSubtitle, sidecarAuthor, sidecarNarrator sql.NullString
+		var sidecarSeriesName, sidecarSeriesSequence, sidecarReadAt sql.NullString
+		var embeddedID, embeddedTitle, embeddedSubtitle, embeddedAuthor, embeddedNarrator sql.NullString
+		var embeddedSeriesName, embeddedSeriesSequence, embeddedExtractedAt sql.NullString
 		var fileCount int
 		var totalDuration float64
 
 		err := rows.Scan(
 			&ab.ID, &libraryID, &metaID, &ab.AssetPath, &ab.LibraryPathID, &createdAt, &updatedAt,
-			&metaRow.ID, &metaRow.Title, &subtitle, &metaRow.Author, &narrator, &description,
+			&metaID, &title, &subtitle, &author, &narrator, &description,
 			&coverURL, &seriesName, &seriesSequence, &releaseDate,
 			&customAudiobookID,
 			&customTitle, &customTitleLocked,
@@ -1040,7 +1225,14 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 			&customLanguage, &customLanguageLocked,
 			&customPublisher, &customPublisherLocked,
 			&customGenres, &customGenresLocked,
+			&customSortTitle, &customSortTitleLocked,
+			&customSortAuthor, &customSortAuthorLocked,
 			&customUpdatedAt, &customUpdatedBy,
+			&resolvedSortTitle, &resolvedSortAuthor,
+			&sidecarID, &sidecarTitle, &sidecarSubtitle, &sidecarAuthor, &sidecarNarrator,
+			&sidecarSeriesName, &sidecarSeriesSequence, &sidecarReadAt,
+			&embeddedID, &embeddedTitle, &embeddedSubtitle, &embeddedAuthor, &embeddedNarrator,
+			&embeddedSeriesName, &embeddedSeriesSequence, &embeddedExtractedAt,
 			&fileCount, &totalDuration,
 		)
 		if err != nil {
@@ -1054,6 +1246,9 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 		ab.TotalDurationSec = totalDuration
 
 		if metaID.Valid && metaID.String != "" {
+			metaRow.ID = metaID.String
+			metaRow.Title = title.String
+			metaRow.Author = author.String
 			ab.MetadataID = &metaID.String
 			ab.Metadata = &metaRow
 
@@ -1098,58 +1293,65 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 				Language:       nullableString(customLanguage),
 				Publisher:      nullableString(customPublisher),
 				Genres:         nullableString(customGenres),
+				SortTitle:      nullableString(customSortTitle),
+				SortAuthor:     nullableString(customSortAuthor),
 				Locks:          make(map[string]bool),
 				UpdatedAt:      parseTime(customUpdatedAt.String),
 				UpdatedBy:      nullableString(customUpdatedBy),
 			}
 			// Build locks map
-			if customTitleLocked.Valid && customTitleLocked.Int64 == 1 {
-				custom.Locks["title"] = true
-			}
-			if customSubtitleLocked.Valid && customSubtitleLocked.Int64 == 1 {
-				custom.Locks["subtitle"] = true
-			}
-			if customAuthorLocked.Valid && customAuthorLocked.Int64 == 1 {
-				custom.Locks["author"] = true
-			}
-			if customNarratorLocked.Valid && customNarratorLocked.Int64 == 1 {
-				custom.Locks["narrator"] = true
-			}
-			if customDescriptionLocked.Valid && customDescriptionLocked.Int64 == 1 {
-				custom.Locks["description"] = true
-			}
-			if customCoverURLLocked.Valid && customCoverURLLocked.Int64 == 1 {
-				custom.Locks["cover_url"] = true
-			}
-			if customSeriesNameLocked.Valid && customSeriesNameLocked.Int64 == 1 {
-				custom.Locks["series_name"] = true
-			}
-			if customSeriesSequenceLocked.Valid && customSeriesSequenceLocked.Int64 == 1 {
-				custom.Locks["series_sequence"] = true
-			}
-			if customReleaseDateLocked.Valid && customReleaseDateLocked.Int64 == 1 {
-				custom.Locks["release_date"] = true
-			}
-			if customISBNLocked.Valid && customISBNLocked.Int64 == 1 {
-				custom.Locks["isbn"] = true
-			}
-			if customASINLocked.Valid && customASINLocked.Int64 == 1 {
-				custom.Locks["asin"] = true
-			}
-			if customLanguageLocked.Valid && customLanguageLocked.Int64 == 1 {
-				custom.Locks["language"] = true
-			}
-			if customPublisherLocked.Valid && customPublisherLocked.Int64 == 1 {
-				custom.Locks["publisher"] = true
+			applyLockFlag(&custom, "title", customTitleLocked.Int64)
+			applyLockFlag(&custom, "subtitle", customSubtitleLocked.Int64)
+			applyLockFlag(&custom, "author", customAuthorLocked.Int64)
+			applyLockFlag(&custom, "narrator", customNarratorLocked.Int64)
+			applyLockFlag(&custom, "description", customDescriptionLocked.Int64)
+			applyLockFlag(&custom, "cover_url", customCoverURLLocked.Int64)
+			applyLockFlag(&custom, "series_name", customSeriesNameLocked.Int64)
+			applyLockFlag(&custom, "series_sequence", customSeriesSequenceLocked.Int64)
+			applyLockFlag(&custom, "release_date", customReleaseDateLocked.Int64)
+			applyLockFlag(&custom, "isbn", customISBNLocked.Int64)
+			applyLockFlag(&custom, "asin", customASINLocked.Int64)
+			applyLockFlag(&custom, "language", customLanguageLocked.Int64)
+			applyLockFlag(&custom, "publisher", customPublisherLocked.Int64)
+			applyLockFlag(&custom, "genres", customGenresLocked.Int64)
+			applyLockFlag(&custom, "sort_title", customSortTitleLocked.Int64)
+			applyLockFlag(&custom, "sort_author", customSortAuthorLocked.Int64)
+			ab.CustomMetadata = &custom
+		}
+
+		if sidecarID.Valid {
+			ab.SidecarMetadata = &models.SidecarMetadata{
+				AudiobookID:    sidecarID.String,
+				Title:          nullableString(sidecarTitle),
+				Subtitle:       nullableString(sidecarSubtitle),
+				Author:         nullableString(sidecarAuthor),
+				Narrator:       nullableString(sidecarNarrator),
+				SeriesName:     nullableString(sidecarSeriesName),
+				SeriesSequence: nullableString(sidecarSeriesSequence),
+				ReadAt:         parseTime(sidecarReadAt.String),
 			}
-			if customGenresLocked.Valid && customGenresLocked.Int64 == 1 {
-				custom.Locks["genres"] = true
+		}
+
+		// Books may have matched on their file tags alone.
+		if embeddedID.Valid {
+			ab.EmbeddedMetadata = &models.EmbeddedMetadata{
+				AudiobookID:    embeddedID.String,
+				Title:          nullableString(embeddedTitle),
+				Subtitle:       nullableString(embeddedSubtitle),
+				Author:         nullableString(embeddedAuthor),
+				Narrator:       nullableString(embeddedNarrator),
+				SeriesName:     nullableString(embeddedSeriesName),
+				SeriesSequence: nullableString(embeddedSeriesSequence),
+				ExtractedAt:    parseTime(embeddedExtractedAt.String),
 			}
-			ab.CustomMetadata = &custom
 		}
 
 		// Apply metadata resolution to get final display values
+		if ab.LibraryID != nil {
+			ab.MetadataOrder = orders[*ab.LibraryID]
+		}
 		ab.Metadata = ab.ResolveMetadata()
+		fillSortNames(ab.Metadata, resolvedSortTitle, resolvedSortAuthor)
 
 		audiobooks = append(audiobooks, ab)
 	}
@@ -1158,67 +1360,62 @@ func (r *Repository) SearchAudiobooks(ctx context.Context, userID, query string,
 		return nil, 0, err
 	}
 
+	if err := r.attachCoverPlaceholders(ctx, audiobooks); err != nil {
+		return nil, 0, err
+	}
+
 	return audiobooks, total, nil
 }
 
 // naturalSort sorts media files using natural ordering for numeric sequences in filenames.
 // This ensures "Chapter 1.mp3", "Chapter 2.mp3", "Chapter 10.mp3" are ordered correctly
 // instead of lexicographically as "Chapter 1.mp3", "Chapter 10.mp3", "Chapter 2.mp3".
+// Files in a disc folder ("CD1/01.mp3") come after the book's own files.
+// Sort keys are built once per file rather than on every comparison.
 func naturalSort(media []models.MediaFile) {
-	sort.Slice(media, func(i, j int) bool {
-		return naturalLess(media[i].Filename, media[j].Filename)
-	})
-}
-
-// naturalLess compares two filenames using natural ordering.
-func naturalLess(a, b string) bool {
-	// Simple natural sort implementation
-	aLower := strings.ToLower(a)
-	bLower := strings.ToLower(b)
-
-	// Split into parts containing letters and numbers
-	aParts := naturalSplit(aLower)
-	bParts := naturalSplit(bLower)
-
-	// Compare part by part
-	for i := 0; i < len(aParts) && i < len(bParts); i++ {
-		aPart := aParts[i]
-		bPart := bParts[i]
-
-		// Check if both parts are numeric
-		aNum, aIsNum := parseNumber(aPart)
-		bNum, bIsNum := parseNumber(bPart)
-
-		if aIsNum && bIsNum {
-			// Both are numbers, compare numerically
-			if aNum != bNum {
-				return aNum < bNum
-			}
-		} else {
-			// At least one is not a number, compare lexicographically
-			if aPart != bPart {
-				return aPart < bPart
-			}
+	keys := make([]string, len(media))
+	for i := range media {
+		depth := "0"
+		if strings.ContainsRune(media[i].Filename, filepath.Separator) {
+			depth = "1"
 		}
+		keys[i] = depth + metadata.NaturalKey(media[i].Filename)
 	}
+	sort.Sort(naturalOrder{media: media, keys: keys})
+}
 
-	// If all compared parts are equal, shorter filename comes first
-	return len(aParts) < len(bParts)
+// applyTrackOrder moves files with an admin-set sort index to the front, in
+// that order. The rest keep their natural order after them, e.g. files added
+// after the track order was set.
+func applyTrackOrder(media []models.MediaFile) {
+	sort.SliceStable(media, func(i, j int) bool {
+		a, b := media[i].SortIndex, media[j].SortIndex
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
 }
 
-// naturalSplit splits a string into alternating text and numeric parts.
-func naturalSplit(s string) []string {
-	re := regexp.MustCompile(`(\d+|\D+)`)
-	return re.FindAllString(s, -1)
+// naturalOrder sorts media files by precomputed natural keys, falling back to
+// the filename for keys that tie (e.g. "01.mp3" and "1.mp3").
+type naturalOrder struct {
+	media []models.MediaFile
+	keys  []string
 }
 
-// parseNumber attempts to parse a string as an integer.
+func (o naturalOrder) Len() int { return len(o.media) }
 
-func parseNumber(s string) (int, bool) {
-	if num, err := strconv.Atoi(s); err == nil {
-		return num, true
+func (o naturalOrder) Less(i, j int) bool {
+	if o.keys[i] != o.keys[j] {
+		return o.keys[i] < o.keys[j]
 	}
-	return 0, false
+	return o.media[i].Filename < o.media[j].Filename
+}
+
+func (o naturalOrder) Swap(i, j int) {
+	o.media[i], o.media[j] = o.media[j], o.media[i]
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
 }
 
 func (r *Repository) loadPathLibraries(ctx context.Context) (map[string][]models.LibrarySummary, error) {
@@ -1283,34 +1480,29 @@ func (r *Repository) librariesForPath(ctx context.Context, pathID string) ([]mod
 	return libraries, nil
 }
 
-func marshalLibrarySettings(settings map[string]interface{}) (*string, error) {
-	if settings == nil || len(settings) == 0 {
-		return nil, nil
-	}
-
+// marshalLibrarySettings encodes settings for the settings column, or nil
+// when none are set.
+func marshalLibrarySettings(settings models.LibrarySettings) (*string, error) {
 	encoded, err := json.Marshal(settings)
 	if err != nil {
 		return nil, err
 	}
+	if string(encoded) == "{}" {
+		return nil, nil
+	}
 	result := string(encoded)
 	return &result, nil
 }
 
-func unmarshalLibrarySettings(raw sql.NullString) (map[string]interface{}, error) {
+// unmarshalLibrarySettings decodes the settings column. Keys that are not
+// settings, or hold values of the wrong type, are ignored; see
+// database.migrateLibrarySettings.
+func unmarshalLibrarySettings(raw sql.NullString) (models.LibrarySettings, error) {
 	if !raw.Valid {
-		return nil, nil
-	}
-
-	trimmed := strings.TrimSpace(raw.String)
-	if trimmed == "" {
-		return nil, nil
+		return models.LibrarySettings{}, nil
 	}
-
-	var settings map[string]interface{}
-	if err := json.Unmarshal([]byte(trimmed), &settings); err != nil {
-		return nil, err
-	}
-	return settings, nil
+	settings, _, err := models.DecodeLibrarySettings([]byte(raw.String))
+	return settings, err
 }
 
 func (r *Repository) loadLibraryBookCounts(ctx context.Context) (map[string]int, error) {
@@ -1391,7 +1583,7 @@ func (r *Repository) CreateLibrary(ctx context.Context, library *models.Library)
 // ListLibraries returns all libraries with directory assignments and book counts.
 func (r *Repository) ListLibraries(ctx context.Context) ([]models.Library, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, name, display_name, type, description, settings, created_at, updated_at
+		SELECT id, name, display_name, type, description, settings, restricted, created_at, updated_at
 		FROM libraries
 		ORDER BY created_at ASC
 	`)
@@ -1409,7 +1601,7 @@ func (r *Repository) ListLibraries(ctx context.Context) ([]models.Library, error
 		var settings sql.NullString
 		var createdAt, updatedAt string
 
-		if err := rows.Scan(&lib.ID, &lib.Name, &lib.DisplayName, &lib.Type, &description, &settings, &createdAt, &updatedAt); err != nil {
+		if err := rows.Scan(&lib.ID, &lib.Name, &lib.DisplayName, &lib.Type, &description, &settings, &lib.Restricted, &createdAt, &updatedAt); err != nil {
 			return nil, err
 		}
 
@@ -1443,11 +1635,9 @@ func (r *Repository) ListLibraries(ctx context.Context) ([]models.Library, error
 	dirRows, err := r.db.QueryContext(ctx, `
 		SELECT ld.library_id,
 		       lp.id, lp.path, lp.name, lp.enabled, lp.created_at, lp.last_scanned_at,
-		       COUNT(a.id) as book_count
+		       lp.book_count, lp.file_count, lp.total_size, lp.last_scan_duration_ms
 		FROM library_directories ld
 		JOIN library_paths lp ON lp.id = ld.directory_id
-		LEFT JOIN audiobooks a ON a.library_id = ld.library_id AND a.library_path_id = lp.id
-		GROUP BY ld.library_id, lp.id, lp.path, lp.name, lp.enabled, lp.created_at, lp.last_scanned_at
 		ORDER BY lp.name ASC
 	`)
 	if err != nil {
@@ -1460,8 +1650,10 @@ func (r *Repository) ListLibraries(ctx context.Context) ([]models.Library, error
 		var path models.LibraryPath
 		var createdAt string
 		var lastScanned sql.NullString
+		var scanDuration sql.NullInt64
 
-		if err := dirRows.Scan(&libraryID, &path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScanned, &path.BookCount); err != nil {
+		if err := dirRows.Scan(&libraryID, &path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScanned,
+			&path.BookCount, &path.FileCount, &path.TotalSize, &scanDuration); err != nil {
 			return nil, err
 		}
 
@@ -1470,6 +1662,7 @@ func (r *Repository) ListLibraries(ctx context.Context) ([]models.Library, error
 			scanned := parseTime(lastScanned.String)
 			path.LastScannedAt = &scanned
 		}
+		path.LastScanDurationMs = nullableInt64(scanDuration)
 
 		if lib := byID[libraryID]; lib != nil {
 			path.Libraries = []models.LibrarySummary{{
@@ -1492,7 +1685,7 @@ func (r *Repository) ListLibraries(ctx context.Context) ([]models.Library, error
 // GetLibraryByID fetches a single library with its directories and statistics.
 func (r *Repository) GetLibraryByID(ctx context.Context, id string) (*models.Library, error) {
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, name, display_name, type, description, settings, created_at, updated_at
+		SELECT id, name, display_name, type, description, settings, restricted, created_at, updated_at
 		FROM libraries
 		WHERE id = ?
 	`, id)
@@ -1502,7 +1695,7 @@ func (r *Repository) GetLibraryByID(ctx context.Context, id string) (*models.Lib
 	var settings sql.NullString
 	var createdAt, updatedAt string
 
-	if err := row.Scan(&lib.ID, &lib.Name, &lib.DisplayName, &lib.Type, &description, &settings, &createdAt, &updatedAt); err != nil {
+	if err := row.Scan(&lib.ID, &lib.Name, &lib.DisplayName, &lib.Type, &description, &settings, &lib.Restricted, &createdAt, &updatedAt); err != nil {
 		return nil, err
 	}
 
@@ -1581,21 +1774,20 @@ func (r *Repository) UpdateLibrary(ctx context.Context, id string, updates map[s
 	}
 
 	if v, ok := updates["settings"]; ok {
-		var settingsMap map[string]interface{}
+		var settings models.LibrarySettings
 		switch value := v.(type) {
-		case map[string]interface{}:
-			settingsMap = value
-		case *map[string]interface{}:
+		case models.LibrarySettings:
+			settings = value
+		case *models.LibrarySettings:
 			if value != nil {
-				settingsMap = *value
+				settings = *value
 			}
 		case nil:
-			settingsMap = nil
 		default:
 			return fmt.Errorf("unsupported settings update type %T", v)
 		}
 
-		settingsJSON, err := marshalLibrarySettings(settingsMap)
+		settingsJSON, err := marshalLibrarySettings(settings)
 		if err != nil {
 			return err
 		}
@@ -1680,12 +1872,10 @@ func (r *Repository) SetLibraryDirectories(ctx context.Context, libraryID string
 func (r *Repository) ListLibraryDirectories(ctx context.Context, libraryID string) ([]models.LibraryPath, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT lp.id, lp.path, lp.name, lp.enabled, lp.created_at, lp.last_scanned_at,
-		       COUNT(a.id) as book_count
+		       lp.book_count, lp.file_count, lp.total_size, lp.last_scan_duration_ms
 		FROM library_directories ld
 		JOIN library_paths lp ON lp.id = ld.directory_id
-		LEFT JOIN audiobooks a ON a.library_id = ld.library_id AND a.library_path_id = lp.id
 		WHERE ld.library_id = ?
-		GROUP BY lp.id, lp.path, lp.name, lp.enabled, lp.created_at, lp.last_scanned_at
 		ORDER BY lp.name ASC
 	`, libraryID)
 	if err != nil {
@@ -1698,8 +1888,10 @@ func (r *Repository) ListLibraryDirectories(ctx context.Context, libraryID strin
 		var path models.LibraryPath
 		var createdAt string
 		var lastScanned sql.NullString
+		var scanDuration sql.NullInt64
 
-		if err := rows.Scan(&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScanned, &path.BookCount); err != nil {
+		if err := rows.Scan(&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScanned,
+			&path.BookCount, &path.FileCount, &path.TotalSize, &scanDuration); err != nil {
 			return nil, err
 		}
 
@@ -1708,6 +1900,7 @@ func (r *Repository) ListLibraryDirectories(ctx context.Context, libraryID strin
 			scanned := parseTime(lastScanned.String)
 			path.LastScannedAt = &scanned
 		}
+		path.LastScanDurationMs = nullableInt64(scanDuration)
 
 		paths = append(paths, path)
 	}
@@ -1737,7 +1930,8 @@ func (r *Repository) CreateLibraryPath(ctx context.Context, libraryPath *models.
 // GetLibraryPaths retrieves all configured library paths.
 func (r *Repository) GetLibraryPaths(ctx context.Context) ([]models.LibraryPath, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, path, name, enabled, created_at, last_scanned_at
+		SELECT id, path, name, enabled, created_at, last_scanned_at,
+		       book_count, file_count, total_size, last_scan_duration_ms
 		FROM library_paths
 		ORDER BY created_at ASC
 	`)
@@ -1751,9 +1945,11 @@ func (r *Repository) GetLibraryPaths(ctx context.Context) ([]models.LibraryPath,
 		var path models.LibraryPath
 		var createdAt string
 		var lastScannedAt sql.NullString
+		var scanDuration sql.NullInt64
 
 		if err := rows.Scan(
 			&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScannedAt,
+			&path.BookCount, &path.FileCount, &path.TotalSize, &scanDuration,
 		); err != nil {
 			return nil, err
 		}
@@ -1763,6 +1959,7 @@ func (r *Repository) GetLibraryPaths(ctx context.Context) ([]models.LibraryPath,
 			scanned := parseTime(lastScannedAt.String)
 			path.LastScannedAt = &scanned
 		}
+		path.LastScanDurationMs = nullableInt64(scanDuration)
 
 		paths = append(paths, path)
 	}
@@ -1784,7 +1981,8 @@ func (r *Repository) GetLibraryPaths(ctx context.Context) ([]models.LibraryPath,
 // GetLibraryPathByID retrieves a single library path by its identifier.
 func (r *Repository) GetLibraryPathByID(ctx context.Context, id string) (*models.LibraryPath, error) {
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, path, name, enabled, created_at, last_scanned_at
+		SELECT id, path, name, enabled, created_at, last_scanned_at,
+		       book_count, file_count, total_size, last_scan_duration_ms
 		FROM library_paths
 		WHERE id = ?
 	`, id)
@@ -1792,8 +1990,10 @@ func (r *Repository) GetLibraryPathByID(ctx context.Context, id string) (*models
 	var path models.LibraryPath
 	var createdAt string
 	var lastScanned sql.NullString
+	var scanDuration sql.NullInt64
 
-	if err := row.Scan(&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScanned); err != nil {
+	if err := row.Scan(&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScanned,
+		&path.BookCount, &path.FileCount, &path.TotalSize, &scanDuration); err != nil {
 		return nil, err
 	}
 
@@ -1802,6 +2002,7 @@ func (r *Repository) GetLibraryPathByID(ctx context.Context, id string) (*models
 		t := parseTime(lastScanned.String)
 		path.LastScannedAt = &t
 	}
+	path.LastScanDurationMs = nullableInt64(scanDuration)
 
 	libraries, err := r.librariesForPath(ctx, id)
 	if err != nil {
@@ -1940,7 +2141,7 @@ func (r *Repository) DeleteImportFolder(ctx context.Context, id string) error {
 // GetImportSettings retrieves the global import settings.
 func (r *Repository) GetImportSettings(ctx context.Context) (*models.ImportSettings, error) {
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, destination_path, template, updated_at
+		SELECT id, destination_path, template, merge_replace_originals, updated_at
 		FROM import_settings
 		WHERE id = 'default'
 	`)
@@ -1948,7 +2149,7 @@ func (r *Repository) GetImportSettings(ctx context.Context) (*models.ImportSetti
 	var settings models.ImportSettings
 	var updatedAt string
 
-	if err := row.Scan(&settings.ID, &settings.DestinationPath, &settings.Template, &updatedAt); err != nil {
+	if err := row.Scan(&settings.ID, &settings.DestinationPath, &settings.Template, &settings.MergeReplaceOriginals, &updatedAt); err != nil {
 		return nil, err
 	}
 
@@ -1962,23 +2163,22 @@ func (r *Repository) UpdateImportSettings(ctx context.Context, settings *models.
 
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE import_settings
-		SET destination_path = ?, template = ?, updated_at = ?
+		SET destination_path = ?, template = ?, merge_replace_originals = ?, updated_at = ?
 		WHERE id = 'default'
-	`, settings.DestinationPath, settings.Template, settings.UpdatedAt.Format(time.RFC3339))
+	`, settings.DestinationPath, settings.Template, settings.MergeReplaceOriginals, settings.UpdatedAt.Format(time.RFC3339))
 
 	return err
 }
 
-// GetLibraryPathsWithBookCounts retrieves library paths with their book counts.
+// GetLibraryPathsWithBookCounts retrieves enabled library paths with their
+// scan statistics.
 func (r *Repository) GetLibraryPathsWithBookCounts(ctx context.Context) ([]models.LibraryPath, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT lp.id, lp.path, lp.name, lp.enabled, lp.created_at, lp.last_scanned_at,
-		       COUNT(a.id) as book_count
-		FROM library_paths lp
-		LEFT JOIN audiobooks a ON a.library_path_id = lp.id
-		WHERE lp.enabled = 1
-		GROUP BY lp.id
-		ORDER BY lp.created_at ASC
+		SELECT id, path, name, enabled, created_at, last_scanned_at,
+		       book_count, file_count, total_size, last_scan_duration_ms
+		FROM library_paths
+		WHERE enabled = 1
+		ORDER BY created_at ASC
 	`)
 	if err != nil {
 		return nil, err
@@ -1990,9 +2190,11 @@ func (r *Repository) GetLibraryPathsWithBookCounts(ctx context.Context) ([]model
 		var path models.LibraryPath
 		var createdAt string
 		var lastScannedAt sql.NullString
+		var scanDuration sql.NullInt64
 
 		if err := rows.Scan(
-			&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScannedAt, &path.BookCount,
+			&path.ID, &path.Path, &path.Name, &path.Enabled, &createdAt, &lastScannedAt,
+			&path.BookCount, &path.FileCount, &path.TotalSize, &scanDuration,
 		); err != nil {
 			return nil, err
 		}
@@ -2002,6 +2204,7 @@ func (r *Repository) GetLibraryPathsWithBookCounts(ctx context.Context) ([]model
 			scanned := parseTime(lastScannedAt.String)
 			path.LastScannedAt = &scanned
 		}
+		path.LastScanDurationMs = nullableInt64(scanDuration)
 
 		paths = append(paths, path)
 	}
@@ -2057,6 +2260,92 @@ func (r *Repository) DeleteLibraryPath(ctx context.Context, id string) error {
 	return err
 }
 
+// LibraryPathScan holds the statistics gathered by scanning a library path.
+type LibraryPathScan struct {
+	Books     int
+	Files     int
+	TotalSize int64
+	ScannedAt time.Time
+	Duration  time.Duration
+}
+
+// RecordLibraryPathScan stores the outcome of scanning a library path.
+func (r *Repository) RecordLibraryPathScan(ctx context.Context, id string, scan LibraryPathScan) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE library_paths
+		SET book_count = ?, file_count = ?, total_size = ?, last_scan_duration_ms = ?, last_scanned_at = ?
+		WHERE id = ?
+	`, scan.Books, scan.Files, scan.TotalSize, scan.Duration.Milliseconds(), scan.ScannedAt.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// ScannedAudiobook is what a re-scan needs to know about a recorded audiobook.
+type ScannedAudiobook struct {
+	ID string
+	// Fingerprint is empty for audiobooks not scanned since fingerprints
+	// were introduced.
+	Fingerprint string
+}
+
+// ListScannedAudiobooks returns the audiobooks recorded at or below path,
+// keyed by asset path.
+func (r *Repository) ListScannedAudiobooks(ctx context.Context, path string) (map[string]ScannedAudiobook, error) {
+	prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, asset_path, scan_fingerprint
+		FROM audiobooks
+		WHERE asset_path = ? OR substr(asset_path, 1, ?) = ?
+	`, path, len(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := make(map[string]ScannedAudiobook)
+	for rows.Next() {
+		var id, assetPath string
+		var fingerprint sql.NullString
+		if err := rows.Scan(&id, &assetPath, &fingerprint); err != nil {
+			return nil, err
+		}
+		books[assetPath] = ScannedAudiobook{ID: id, Fingerprint: fingerprint.String}
+	}
+	return books, rows.Err()
+}
+
+// SetScanFingerprint records the media file fingerprint an audiobook was
+// last scanned with.
+func (r *Repository) SetScanFingerprint(ctx context.Context, audiobookID, fingerprint string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE audiobooks SET scan_fingerprint = ? WHERE id = ?`, fingerprint, audiobookID)
+	return err
+}
+
+// UpdateScannedMediaFiles stores re-read durations and MIME types of an
+// audiobook's media files together with the fingerprint they were read at.
+func (r *Repository) UpdateScannedMediaFiles(ctx context.Context, audiobookID string, files []models.MediaFile, fingerprint string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, mf := range files {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE media_files SET duration_sec = ?, mime_type = ?, extension_mime_type = ?
+			WHERE id = ? AND audiobook_id = ?
+		`, mf.DurationSec, mf.MimeType, sqlNullString(mf.ExtensionMimeType), mf.ID, audiobookID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE audiobooks SET scan_fingerprint = ?, updated_at = ? WHERE id = ?
+	`, fingerprint, time.Now().UTC().Format(time.RFC3339), audiobookID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // GetEnabledLibraryPaths returns only enabled library paths.
 func (r *Repository) GetEnabledLibraryPaths(ctx context.Context) ([]string, error) {
 	rows, err := r.db.QueryContext(ctx, `
@@ -2084,7 +2373,7 @@ func (r *Repository) GetContinueListening(ctx context.Context, userID string, li
 	query := `
 		SELECT a.id, a.library_id, a.metadata_id, a.asset_path, a.library_path_id, a.created_at, a.updated_at,
 		       m.id, m.title, m.subtitle, m.author, m.narrator, m.description,
-		       m.cover_url, m.series_name, m.series_sequence, m.release_date,
+		       m.cover_url, m.series_name, m.series_sequence, m.release_date, m.duration_sec,
 		       u.progress_sec, u.is_favorite, u.last_played_at,
 		       COALESCE(mf_stats.file_count, 0) as file_count,
 		       COALESCE(mf_stats.total_duration, 0) as total_duration_sec
@@ -2106,6 +2395,8 @@ func (r *Repository) GetContinueListening(ctx context.Context, userID string, li
 		query += " AND a.library_id = ?"
 		queryArgs = append(queryArgs, *libraryID)
 	}
+	query += audiobookListFilter
+	queryArgs = append(queryArgs, userID, userID)
 
 	query += "\nORDER BY u.last_played_at DESC\nLIMIT ?"
 	queryArgs = append(queryArgs, limit)
@@ -2122,6 +2413,7 @@ func (r *Repository) GetContinueListening(ctx context.Context, userID string, li
 		var createdAt, updatedAt string
 		var metaRow models.BookMetadata
 		var subtitle, narrator, description, coverURL, seriesName, seriesSequence, releaseDate sql.NullString
+		var durationSec sql.NullFloat64
 		var metadataID sql.NullString
 		var libraryID sql.NullString
 		var progress sql.NullFloat64
@@ -2133,7 +2425,7 @@ func (r *Repository) GetContinueListening(ctx context.Context, userID string, li
 		if err := rows.Scan(
 			&ab.ID, &libraryID, &metadataID, &ab.AssetPath, &ab.LibraryPathID, &createdAt, &updatedAt,
 			&metaRow.ID, &metaRow.Title, &subtitle, &metaRow.Author, &narrator, &description,
-			&coverURL, &seriesName, &seriesSequence, &releaseDate,
+			&coverURL, &seriesName, &seriesSequence, &releaseDate, &durationSec,
 			&progress, &favorite, &lastPlayedAt,
 			&fileCount, &totalDuration,
 		); err != nil {
@@ -2156,6 +2448,7 @@ func (r *Repository) GetContinueListening(ctx context.Context, userID string, li
 			meta.SeriesName = nullableString(seriesName)
 			meta.SeriesSequence = nullableString(seriesSequence)
 			meta.ReleaseDate = nullableString(releaseDate)
+			meta.DurationSec = nullableFloat64(durationSec)
 			if strings.TrimSpace(meta.Title) != "" {
 				ab.Metadata = &meta
 			}
@@ -2173,11 +2466,19 @@ func (r *Repository) GetContinueListening(ctx context.Context, userID string, li
 			ud.LastPlayedAt = &t
 		}
 		ab.UserData = &ud
+		ab.ApplyProgress()
 
 		audiobooks = append(audiobooks, ab)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachCoverPlaceholders(ctx, audiobooks); err != nil {
+		return nil, err
+	}
 
-	return audiobooks, rows.Err()
+	return audiobooks, nil
 }
 
 // GetUserFavorites returns audiobooks the user has marked as favorite.
@@ -2193,6 +2494,8 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 		countQuery += " AND a.library_id = ?"
 		countArgs = append(countArgs, *libraryID)
 	}
+	countQuery += audiobookListFilter
+	countArgs = append(countArgs, userID, userID)
 
 	var total int
 	err := r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
@@ -2204,7 +2507,7 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 	query := `
 		SELECT a.id, a.library_id, a.metadata_id, a.asset_path, a.library_path_id, a.created_at, a.updated_at,
 		       m.id, m.title, m.subtitle, m.author, m.narrator, m.description,
-		       m.cover_url, m.series_name, m.series_sequence, m.release_date,
+		       m.cover_url, m.series_name, m.series_sequence, m.release_date, m.duration_sec,
 		       u.progress_sec, u.is_favorite, u.last_played_at,
 		       COALESCE(mf_stats.file_count, 0) as file_count,
 		       COALESCE(mf_stats.total_duration, 0) as total_duration_sec
@@ -2225,6 +2528,8 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 		query += " AND a.library_id = ?"
 		queryArgs = append(queryArgs, *libraryID)
 	}
+	query += audiobookListFilter
+	queryArgs = append(queryArgs, userID, userID)
 
 	query += `
 		ORDER BY a.created_at DESC
@@ -2244,6 +2549,7 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 		var createdAt, updatedAt string
 		var metaRow models.BookMetadata
 		var subtitle, narrator, description, coverURL, seriesName, seriesSequence, releaseDate sql.NullString
+		var durationSec sql.NullFloat64
 		var metadataID sql.NullString
 		var libraryID sql.NullString
 		var progress sql.NullFloat64
@@ -2255,7 +2561,7 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 		if err := rows.Scan(
 			&ab.ID, &libraryID, &metadataID, &ab.AssetPath, &ab.LibraryPathID, &createdAt, &updatedAt,
 			&metaRow.ID, &metaRow.Title, &subtitle, &metaRow.Author, &narrator, &description,
-			&coverURL, &seriesName, &seriesSequence, &releaseDate,
+			&coverURL, &seriesName, &seriesSequence, &releaseDate, &durationSec,
 			&progress, &favorite, &lastPlayedAt,
 			&fileCount, &totalDuration,
 		); err != nil {
@@ -2278,6 +2584,7 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 			meta.SeriesName = nullableString(seriesName)
 			meta.SeriesSequence = nullableString(seriesSequence)
 			meta.ReleaseDate = nullableString(releaseDate)
+			meta.DurationSec = nullableFloat64(durationSec)
 			if strings.TrimSpace(meta.Title) != "" {
 				ab.Metadata = &meta
 			}
@@ -2295,11 +2602,19 @@ func (r *Repository) GetUserFavorites(ctx context.Context, userID string, librar
 			ud.LastPlayedAt = &t
 		}
 		ab.UserData = &ud
+		ab.ApplyProgress()
 
 		audiobooks = append(audiobooks, ab)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.attachCoverPlaceholders(ctx, audiobooks); err != nil {
+		return nil, 0, err
+	}
 
-	return audiobooks, total, rows.Err()
+	return audiobooks, total, nil
 }
 
 // =============================================================================
@@ -2311,10 +2626,11 @@ func (r *Repository) GetMetadataOverrides(ctx context.Context, audiobookID strin
 	var custom models.CustomMetadata
 	var title, subtitle, author, narrator, description, coverURL sql.NullString
 	var seriesName, seriesSequence, releaseDate, isbn, asin sql.NullString
-	var language, publisher, genres sql.NullString
+	var language, publisher, genres, sortTitle, sortAuthor sql.NullString
 	var titleLocked, subtitleLocked, authorLocked, narratorLocked, descriptionLocked int
 	var coverURLLocked, seriesNameLocked, seriesSequenceLocked, releaseDateLocked int
 	var isbnLocked, asinLocked, languageLocked, publisherLocked, genresLocked int
+	var sortTitleLocked, sortAuthorLocked int
 	var updatedAt string
 	var updatedBy sql.NullString
 
@@ -2334,6 +2650,8 @@ func (r *Repository) GetMetadataOverrides(ctx context.Context, audiobookID strin
 		       language, language_locked,
 		       publisher, publisher_locked,
 		       genres, genres_locked,
+		       sort_title, sort_title_locked,
+		       sort_author, sort_author_locked,
 		       updated_at, updated_by
 		FROM audiobook_metadata_custom
 		WHERE audiobook_id = ?
@@ -2353,6 +2671,8 @@ func (r *Repository) GetMetadataOverrides(ctx context.Context, audiobookID strin
 		&language, &languageLocked,
 		&publisher, &publisherLocked,
 		&genres, &genresLocked,
+		&sortTitle, &sortTitleLocked,
+		&sortAuthor, &sortAuthorLocked,
 		&updatedAt, &updatedBy,
 	)
 
@@ -2378,53 +2698,29 @@ func (r *Repository) GetMetadataOverrides(ctx context.Context, audiobookID strin
 	custom.Language = nullableString(language)
 	custom.Publisher = nullableString(publisher)
 	custom.Genres = nullableString(genres)
+	custom.SortTitle = nullableString(sortTitle)
+	custom.SortAuthor = nullableString(sortAuthor)
 	custom.UpdatedAt = parseTime(updatedAt)
 	custom.UpdatedBy = nullableString(updatedBy)
 
 	// Build locks map
 	custom.Locks = make(map[string]bool)
-	if titleLocked == 1 {
-		custom.Locks["title"] = true
-	}
-	if subtitleLocked == 1 {
-		custom.Locks["subtitle"] = true
-	}
-	if authorLocked == 1 {
-		custom.Locks["author"] = true
-	}
-	if narratorLocked == 1 {
-		custom.Locks["narrator"] = true
-	}
-	if descriptionLocked == 1 {
-		custom.Locks["description"] = true
-	}
-	if coverURLLocked == 1 {
-		custom.Locks["cover_url"] = true
-	}
-	if seriesNameLocked == 1 {
-		custom.Locks["series_name"] = true
-	}
-	if seriesSequenceLocked == 1 {
-		custom.Locks["series_sequence"] = true
-	}
-	if releaseDateLocked == 1 {
-		custom.Locks["release_date"] = true
-	}
-	if isbnLocked == 1 {
-		custom.Locks["isbn"] = true
-	}
-	if asinLocked == 1 {
-		custom.Locks["asin"] = true
-	}
-	if languageLocked == 1 {
-		custom.Locks["language"] = true
-	}
-	if publisherLocked == 1 {
-		custom.Locks["publisher"] = true
-	}
-	if genresLocked == 1 {
-		custom.Locks["genres"] = true
-	}
+	applyLockFlag(&custom, "title", int64(titleLocked))
+	applyLockFlag(&custom, "subtitle", int64(subtitleLocked))
+	applyLockFlag(&custom, "author", int64(authorLocked))
+	applyLockFlag(&custom, "narrator", int64(narratorLocked))
+	applyLockFlag(&custom, "description", int64(descriptionLocked))
+	applyLockFlag(&custom, "cover_url", int64(coverURLLocked))
+	applyLockFlag(&custom, "series_name", int64(seriesNameLocked))
+	applyLockFlag(&custom, "series_sequence", int64(seriesSequenceLocked))
+	applyLockFlag(&custom, "release_date", int64(releaseDateLocked))
+	applyLockFlag(&custom, "isbn", int64(isbnLocked))
+	applyLockFlag(&custom, "asin", int64(asinLocked))
+	applyLockFlag(&custom, "language", int64(languageLocked))
+	applyLockFlag(&custom, "publisher", int64(publisherLocked))
+	applyLockFlag(&custom, "genres", int64(genresLocked))
+	applyLockFlag(&custom, "sort_title", int64(sortTitleLocked))
+	applyLockFlag(&custom, "sort_author", int64(sortAuthorLocked))
 
 	return &custom, nil
 }
@@ -2433,29 +2729,23 @@ func (r *Repository) GetMetadataOverrides(ctx context.Context, audiobookID strin
 func (r *Repository) SaveMetadataOverrides(ctx context.Context, custom *models.CustomMetadata) error {
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	// Helper function to convert bool to int for SQLite
-	boolToInt := func(b bool) int {
-		if b {
-			return 1
-		}
-		return 0
-	}
-
-	// Get locked flags from map, defaulting to false if not present
-	titleLocked := boolToInt(custom.Locks["title"])
-	subtitleLocked := boolToInt(custom.Locks["subtitle"])
-	authorLocked := boolToInt(custom.Locks["author"])
-	narratorLocked := boolToInt(custom.Locks["narrator"])
-	descriptionLocked := boolToInt(custom.Locks["description"])
-	coverURLLocked := boolToInt(custom.Locks["cover_url"])
-	seriesNameLocked := boolToInt(custom.Locks["series_name"])
-	seriesSequenceLocked := boolToInt(custom.Locks["series_sequence"])
-	releaseDateLocked := boolToInt(custom.Locks["release_date"])
-	isbnLocked := boolToInt(custom.Locks["isbn"])
-	asinLocked := boolToInt(custom.Locks["asin"])
-	languageLocked := boolToInt(custom.Locks["language"])
-	publisherLocked := boolToInt(custom.Locks["publisher"])
-	genresLocked := boolToInt(custom.Locks["genres"])
+	// Translate lock modes to column flags; only value locks keep their value
+	titleLocked, title := lockColumns(custom, "title")
+	subtitleLocked, subtitle := lockColumns(custom, "subtitle")
+	authorLocked, author := lockColumns(custom, "author")
+	narratorLocked, narrator := lockColumns(custom, "narrator")
+	descriptionLocked, description := lockColumns(custom, "description")
+	coverURLLocked, coverURL := lockColumns(custom, "cover_url")
+	seriesNameLocked, seriesName := lockColumns(custom, "series_name")
+	seriesSequenceLocked, seriesSequence := lockColumns(custom, "series_sequence")
+	releaseDateLocked, releaseDate := lockColumns(custom, "release_date")
+	isbnLocked, isbn := lockColumns(custom, "isbn")
+	asinLocked, asin := lockColumns(custom, "asin")
+	languageLocked, language := lockColumns(custom, "language")
+	publisherLocked, publisher := lockColumns(custom, "publisher")
+	genresLocked, genres := lockColumns(custom, "genres")
+	sortTitleLocked, sortTitle := lockColumns(custom, "sort_title")
+	sortAuthorLocked, sortAuthor := lockColumns(custom, "sort_author")
 
 	_, err := r.db.ExecContext(ctx, `
 		INSERT INTO audiobook_metadata_custom (
@@ -2474,9 +2764,11 @@ func (r *Repository) SaveMetadataOverrides(ctx context.Context, custom *models.C
 			language, language_locked,
 			publisher, publisher_locked,
 			genres, genres_locked,
+			sort_title, sort_title_locked,
+			sort_author, sort_author_locked,
 			updated_at, updated_by
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(audiobook_id) DO UPDATE SET
 			title = excluded.title,
 			title_locked = excluded.title_locked,
@@ -2506,23 +2798,29 @@ func (r *Repository) SaveMetadataOverrides(ctx context.Context, custom *models.C
 			publisher_locked = excluded.publisher_locked,
 			genres = excluded.genres,
 			genres_locked = excluded.genres_locked,
+			sort_title = excluded.sort_title,
+			sort_title_locked = excluded.sort_title_locked,
+			sort_author = excluded.sort_author,
+			sort_author_locked = excluded.sort_author_locked,
 			updated_at = excluded.updated_at,
 			updated_by = excluded.updated_by
 	`, custom.AudiobookID,
-		custom.Title, titleLocked,
-		custom.Subtitle, subtitleLocked,
-		custom.Author, authorLocked,
-		custom.Narrator, narratorLocked,
-		custom.Description, descriptionLocked,
-		custom.CoverURL, coverURLLocked,
-		custom.SeriesName, seriesNameLocked,
-		custom.SeriesSequence, seriesSequenceLocked,
-		custom.ReleaseDate, releaseDateLocked,
-		custom.ISBN, isbnLocked,
-		custom.ASIN, asinLocked,
-		custom.Language, languageLocked,
-		custom.Publisher, publisherLocked,
-		custom.Genres, genresLocked,
+		title, titleLocked,
+		subtitle, subtitleLocked,
+		author, authorLocked,
+		narrator, narratorLocked,
+		description, descriptionLocked,
+		coverURL, coverURLLocked,
+		seriesName, seriesNameLocked,
+		seriesSequence, seriesSequenceLocked,
+		releaseDate, releaseDateLocked,
+		isbn, isbnLocked,
+		asin, asinLocked,
+		language, languageLocked,
+		publisher, publisherLocked,
+		genres, genresLocked,
+		sortTitle, sortTitleLocked,
+		sortAuthor, sortAuthorLocked,
 		now, custom.UpdatedBy)
 
 	return err
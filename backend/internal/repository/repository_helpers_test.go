@@ -2,13 +2,17 @@ package repository
 
 import (
 	"database/sql"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/lore/backend/internal/models"
 )
 
-func TestMarshalLibrarySettingsNil(t *testing.T) {
-	value, err := marshalLibrarySettings(nil)
+func TestMarshalLibrarySettingsEmpty(t *testing.T) {
+	value, err := marshalLibrarySettings(models.LibrarySettings{})
 	if err != nil {
-		t.Fatalf("marshalLibrarySettings(nil) returned error: %v", err)
+		t.Fatalf("marshalLibrarySettings returned error: %v", err)
 	}
 	if value != nil {
 		t.Fatalf("expected nil, got %v", value)
@@ -16,9 +20,10 @@ func TestMarshalLibrarySettingsNil(t *testing.T) {
 }
 
 func TestMarshalLibrarySettingsRoundTrip(t *testing.T) {
-	settings := map[string]interface{}{
-		"foo":   "bar",
-		"count": 3,
+	settings := models.LibrarySettings{
+		AutoScanIntervalMinutes: 30,
+		MetadataOrder:           []string{"embedded", "agent"},
+		AutoMatch:               true,
 	}
 
 	encoded, err := marshalLibrarySettings(settings)
@@ -33,14 +38,19 @@ func TestMarshalLibrarySettingsRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unmarshalLibrarySettings returned error: %v", err)
 	}
-
-	if decoded["foo"] != "bar" {
-		t.Fatalf("expected foo=bar, got %v", decoded["foo"])
+	if !reflect.DeepEqual(decoded, settings) {
+		t.Fatalf("decoded %+v, want %+v", decoded, settings)
 	}
+}
 
-	count, ok := decoded["count"].(float64)
-	if !ok || count != 3 {
-		t.Fatalf("expected count=3, got %v", decoded["count"])
+func TestUnmarshalLibrarySettingsDropsBadKeys(t *testing.T) {
+	stored := `{"foo": "bar", "auto_scan_interval_minutes": "often", "write_tags": true}`
+	decoded, err := unmarshalLibrarySettings(sql.NullString{String: stored, Valid: true})
+	if err != nil {
+		t.Fatalf("unmarshalLibrarySettings returned error: %v", err)
+	}
+	if want := (models.LibrarySettings{WriteTags: true}); !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("decoded %+v, want %+v", decoded, want)
 	}
 }
 
@@ -49,3 +59,50 @@ func TestUnmarshalLibrarySettingsInvalid(t *testing.T) {
 		t.Fatalf("expected error for invalid JSON")
 	}
 }
+
+func TestResolvedSearchFieldDefaultOrder(t *testing.T) {
+	clause, args := resolvedSearchField("title", nil)
+
+	want := "(CASE WHEN c.title_locked = 1 THEN c.title ELSE COALESCE(NULLIF(m.title, ''), NULLIF(sc.title, ''), e.title) END)"
+	if clause != want {
+		t.Fatalf("clause = %s, want %s", clause, want)
+	}
+	if len(args) != 0 {
+		t.Fatalf("expected no arguments, got %v", args)
+	}
+}
+
+func TestResolvedSearchFieldLibraryOrders(t *testing.T) {
+	embeddedFirst := []string{"embedded", "agent", "sidecar"}
+	clause, args := resolvedSearchField("author", map[string][]string{
+		"lib-a": embeddedFirst,
+		"lib-b": embeddedFirst,
+		"lib-c": {"sidecar", "agent", "embedded"},
+	})
+
+	if !strings.Contains(clause, "WHEN a.library_id IN (?, ?) THEN COALESCE(NULLIF(e.author, ''), NULLIF(m.author, ''), sc.author)") {
+		t.Fatalf("missing embedded-first branch in %s", clause)
+	}
+	if !strings.Contains(clause, "WHEN a.library_id IN (?) THEN COALESCE(NULLIF(sc.author, ''), NULLIF(m.author, ''), e.author)") {
+		t.Fatalf("missing sidecar-first branch in %s", clause)
+	}
+	if !strings.HasSuffix(clause, "ELSE COALESCE(NULLIF(m.author, ''), NULLIF(sc.author, ''), e.author) END)") {
+		t.Fatalf("missing default branch in %s", clause)
+	}
+	if want := []interface{}{"lib-a", "lib-b", "lib-c"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("args = %v, want %v", args, want)
+	}
+}
+
+func TestNaturalSortPlaysOwnFilesBeforeDiscs(t *testing.T) {
+	media := []models.MediaFile{{Filename: "CD2/01.mp3"}, {Filename: "intro.mp3"}, {Filename: "CD1/10.mp3"}, {Filename: "CD1/2.mp3"}}
+	naturalSort(media)
+	var got []string
+	for _, file := range media {
+		got = append(got, file.Filename)
+	}
+	want := []string{"intro.mp3", "CD1/2.mp3", "CD1/10.mp3", "CD2/01.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/models"
+)
+
+// RebuildResolvedMetadata recomputes the resolved metadata snapshot for every
+// audiobook in the given libraries (all libraries when libraryIDs is empty).
+// progress, when non-nil, is called after each audiobook. It returns the
+// number of audiobooks that were refreshed.
+func (r *Repository) RebuildResolvedMetadata(ctx context.Context, libraryIDs []string, progress func(done, total int)) (int, error) {
+	ids, err := r.audiobookIDsForLibraries(ctx, libraryIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	total := len(ids)
+	if progress != nil {
+		progress(0, total)
+	}
+
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := r.RefreshResolvedMetadata(ctx, id); err != nil {
+			return i, err
+		}
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+
+	if err := r.pruneBrowseTables(ctx); err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// RefreshResolvedMetadata rewrites the resolved snapshot for a single
+// audiobook.
+func (r *Repository) RefreshResolvedMetadata(ctx context.Context, audiobookID string) (err error) {
+	ab, err := r.GetAudiobook(ctx, audiobookID, "")
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.deleteResolvedMetadata(ctx, audiobookID)
+	}
+	if err != nil {
+		return err
+	}
+
+	resolved := ab.ResolveMetadata()
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	collation, err := r.libraryCollation(ctx, ab.LibraryID)
+	if err != nil {
+		return err
+	}
+	format, err := r.libraryContributorFormat(ctx, ab.LibraryID)
+	if err != nil {
+		return err
+	}
+	// Narrators are split from the credit as given: a reformatted credit
+	// such as "Weir, Andy" no longer splits on commas.
+	var narrators []metadata.Narrator
+	if resolved.Narrator != nil {
+		narrators = metadata.SplitNarrators(*resolved.Narrator)
+	}
+	applyContributorFormat(resolved, format)
+	applySortNames(resolved, collation, format)
+
+	// Store genres in normalized form so the snapshot and genre lookup agree.
+	var genres []metadata.Genre
+	if resolved.Genres != nil {
+		genres = metadata.NormalizeGenres(*resolved.Genres)
+	}
+	var genresJSON interface{}
+	if len(genres) > 0 {
+		names := make([]string, len(genres))
+		for i, genre := range genres {
+			names[i] = genre.Name
+		}
+		data, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		genresJSON = string(data)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO audiobook_metadata_resolved (
+            audiobook_id, library_id, title, subtitle, author, narrator, description,
+            cover_url, series_name, series_sequence, release_date, isbn, asin,
+            language, publisher, duration_sec, genres, sort_title, sort_author,
+            title_sort, author_sort, resolved_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(audiobook_id) DO UPDATE SET
+            library_id = excluded.library_id,
+            title = excluded.title,
+            subtitle = excluded.subtitle,
+            author = excluded.author,
+            narrator = excluded.narrator,
+            description = excluded.description,
+            cover_url = excluded.cover_url,
+            series_name = excluded.series_name,
+            series_sequence = excluded.series_sequence,
+            release_date = excluded.release_date,
+            isbn = excluded.isbn,
+            asin = excluded.asin,
+            language = excluded.language,
+            publisher = excluded.publisher,
+            duration_sec = excluded.duration_sec,
+            genres = excluded.genres,
+            sort_title = excluded.sort_title,
+            sort_author = excluded.sort_author,
+            title_sort = excluded.title_sort,
+            author_sort = excluded.author_sort,
+            resolved_at = excluded.resolved_at
+    `, ab.ID, sqlNullString(ab.LibraryID), emptyToNull(resolved.Title), nullable(resolved.Subtitle),
+		emptyToNull(resolved.Author), nullable(resolved.Narrator), nullable(resolved.Description),
+		nullable(resolved.CoverURL), nullable(resolved.SeriesName), nullable(resolved.SeriesSequence),
+		nullable(resolved.ReleaseDate), nullable(resolved.ISBN), nullable(resolved.ASIN),
+		nullable(resolved.Language), nullable(resolved.Publisher), nullableFloat(resolved.DurationSec),
+		genresJSON, emptyToNull(resolved.SortTitle), emptyToNull(resolved.SortAuthor),
+		collation.SortKey(resolved.SortTitle), collation.SortKey(resolved.SortAuthor), now)
+	if err != nil {
+		return err
+	}
+
+	if err = syncAudiobookGenres(ctx, tx, ab.ID, genres); err != nil {
+		return err
+	}
+
+	if err = syncAudiobookNarrators(ctx, tx, ab.ID, narrators); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateLibrarySortKeys recomputes the sort titles, sort authors and their
+// sort keys of the resolved audiobooks in a library with its current
+// collation, after the library's sort settings change. Custom sort overrides
+// are kept; only their keys are recomputed.
+func (r *Repository) UpdateLibrarySortKeys(ctx context.Context, libraryID string) error {
+	collation, err := r.libraryCollation(ctx, &libraryID)
+	if err != nil {
+		return err
+	}
+	format, err := r.libraryContributorFormat(ctx, &libraryID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rs.audiobook_id, COALESCE(rs.title, ''), COALESCE(rs.author, ''),
+		       CASE WHEN c.sort_title_locked = ? THEN COALESCE(c.sort_title, '') ELSE '' END,
+		       CASE WHEN c.sort_author_locked = ? THEN COALESCE(c.sort_author, '') ELSE '' END
+		FROM audiobook_metadata_resolved rs
+		LEFT JOIN audiobook_metadata_custom c ON c.audiobook_id = rs.audiobook_id
+		WHERE rs.library_id = ?
+	`, lockFlagLocked, lockFlagLocked, libraryID)
+	if err != nil {
+		return err
+	}
+	var books []models.AgentMetadata
+	var ids []string
+	for rows.Next() {
+		var id string
+		var book models.AgentMetadata
+		if err := rows.Scan(&id, &book.Title, &book.Author, &book.SortTitle, &book.SortAuthor); err != nil {
+			rows.Close()
+			return err
+		}
+		applySortNames(&book, collation, format)
+		books = append(books, book)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, book := range books {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE audiobook_metadata_resolved
+			SET sort_title = ?, sort_author = ?, title_sort = ?, author_sort = ?
+			WHERE audiobook_id = ?
+		`, emptyToNull(book.SortTitle), emptyToNull(book.SortAuthor),
+			collation.SortKey(book.SortTitle), collation.SortKey(book.SortAuthor), ids[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// applySortNames generates the sort title and sort author of resolved
+// metadata that has no custom sort override.
+func applySortNames(resolved *models.AgentMetadata, collation metadata.Collation, format metadata.ContributorFormat) {
+	if resolved.SortTitle == "" {
+		resolved.SortTitle = collation.SortTitle(resolved.Title)
+	}
+	if resolved.SortAuthor == "" {
+		resolved.SortAuthor = format.SortAuthor(resolved.Author)
+	}
+}
+
+// applyContributorFormat rewrites the author and narrator credits of
+// resolved metadata in the library's contributor format.
+func applyContributorFormat(resolved *models.AgentMetadata, format metadata.ContributorFormat) {
+	resolved.Author = format.Format(resolved.Author)
+	if resolved.Narrator != nil {
+		narrator := format.Format(*resolved.Narrator)
+		resolved.Narrator = &narrator
+	}
+}
+
+// fillSortNames copies the sort names stored with the resolved snapshot onto
+// listed metadata that has no custom sort override, so listings need not
+// look up each library's collation.
+func fillSortNames(resolved *models.AgentMetadata, sortTitle, sortAuthor sql.NullString) {
+	if resolved.SortTitle == "" {
+		resolved.SortTitle = sortTitle.String
+	}
+	if resolved.SortAuthor == "" {
+		resolved.SortAuthor = sortAuthor.String
+	}
+}
+
+// ResolvedCoverURL returns the cover URL in an audiobook's resolved
+// metadata snapshot, or "" when it has none.
+func (r *Repository) ResolvedCoverURL(ctx context.Context, audiobookID string) (string, error) {
+	var coverURL sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+        SELECT cover_url FROM audiobook_metadata_resolved WHERE audiobook_id = ?
+    `, audiobookID).Scan(&coverURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return coverURL.String, err
+}
+
+// libraryCollation returns the collation configured for a library, or the
+// default when the audiobook has no library.
+func (r *Repository) libraryCollation(ctx context.Context, libraryID *string) (metadata.Collation, error) {
+	settings, err := r.librarySettings(ctx, libraryID)
+	if err != nil {
+		return metadata.Collation{}, err
+	}
+	return metadata.CollationFromSettings(settings), nil
+}
+
+// libraryContributorFormat returns the contributor format configured for a
+// library, or the default when the audiobook has no library.
+func (r *Repository) libraryContributorFormat(ctx context.Context, libraryID *string) (metadata.ContributorFormat, error) {
+	settings, err := r.librarySettings(ctx, libraryID)
+	if err != nil {
+		return metadata.ContributorFormat{}, err
+	}
+	return metadata.ContributorFormatFromSettings(settings), nil
+}
+
+// libraryMetadataOrder returns the metadata order configured for a library,
+// or nil when it resolves in the default order.
+func (r *Repository) libraryMetadataOrder(ctx context.Context, libraryID *string) ([]string, error) {
+	settings, err := r.librarySettings(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.MetadataOrderFromSettings(settings), nil
+}
+
+// libraryMetadataOrders returns the metadata orders of the libraries not
+// resolving in the default order, by library ID.
+func (r *Repository) libraryMetadataOrders(ctx context.Context) (map[string][]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, settings FROM libraries`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make(map[string][]string)
+	for rows.Next() {
+		var id string
+		var raw sql.NullString
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		settings, err := unmarshalLibrarySettings(raw)
+		if err != nil {
+			continue
+		}
+		if order := metadata.MetadataOrderFromSettings(settings); order != nil {
+			orders[id] = order
+		}
+	}
+	return orders, rows.Err()
+}
+
+// librarySettings returns a library's settings, or the defaults when there
+// is no such library or its settings cannot be parsed.
+func (r *Repository) librarySettings(ctx context.Context, libraryID *string) (models.LibrarySettings, error) {
+	if libraryID == nil || *libraryID == "" {
+		return models.LibrarySettings{}, nil
+	}
+	var settings sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT settings FROM libraries WHERE id = ?`, *libraryID).Scan(&settings)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.LibrarySettings{}, nil
+	}
+	if err != nil {
+		return models.LibrarySettings{}, err
+	}
+	parsed, err := unmarshalLibrarySettings(settings)
+	if err != nil {
+		return models.LibrarySettings{}, nil
+	}
+	return parsed, nil
+}
+
+func (r *Repository) deleteResolvedMetadata(ctx context.Context, audiobookID string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM audiobook_metadata_resolved WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM audiobook_genres WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM audiobook_narrators WHERE audiobook_id = ?`, audiobookID)
+	return err
+}
+
+func (r *Repository) audiobookIDsForLibraries(ctx context.Context, libraryIDs []string) ([]string, error) {
+	query := `SELECT id FROM audiobooks`
+	args := make([]interface{}, 0, len(libraryIDs))
+	if len(libraryIDs) > 0 {
+		placeholders := make([]string, len(libraryIDs))
+		for i, id := range libraryIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query += ` WHERE library_id IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+	query += ` ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func emptyToNull(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// GetRetentionSettings returns the saved retention settings, or
+// sql.ErrNoRows if an admin has never saved any.
+func (r *Repository) GetRetentionSettings(ctx context.Context) (*models.RetentionSettings, error) {
+	var settings models.RetentionSettings
+	var updatedAt string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT session_days, stats_days, activity_days, updated_at
+		FROM retention_settings WHERE id = 'default'
+	`).Scan(&settings.SessionDays, &settings.StatsDays, &settings.ActivityDays, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	updated := parseTime(updatedAt)
+	settings.UpdatedAt = &updated
+	return &settings, nil
+}
+
+// SaveRetentionSettings stores the retention settings.
+func (r *Repository) SaveRetentionSettings(ctx context.Context, settings *models.RetentionSettings) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO retention_settings (id, session_days, stats_days, activity_days, updated_at)
+		VALUES ('default', ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			session_days = excluded.session_days,
+			stats_days = excluded.stats_days,
+			activity_days = excluded.activity_days,
+			updated_at = excluded.updated_at
+	`, settings.SessionDays, settings.StatsDays, settings.ActivityDays, now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	settings.UpdatedAt = &now
+	return nil
+}
+
+// GetPrivacySettings returns a user's privacy settings, with history kept
+// and nothing shared when they never saved any.
+func (r *Repository) GetPrivacySettings(ctx context.Context, userID string) (*models.PrivacySettings, error) {
+	settings := models.PrivacySettings{KeepListeningHistory: true}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT keep_listening_history, share_activity, share_listening FROM user_privacy WHERE user_id = ?
+	`, userID).Scan(&settings.KeepListeningHistory, &settings.ShareActivity, &settings.ShareListening)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SetPrivacySettings saves a user's privacy settings.
+func (r *Repository) SetPrivacySettings(ctx context.Context, userID string, settings models.PrivacySettings) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_privacy (user_id, keep_listening_history, share_activity, share_listening, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			keep_listening_history = excluded.keep_listening_history,
+			share_activity = excluded.share_activity,
+			share_listening = excluded.share_listening,
+			updated_at = excluded.updated_at
+	`, userID, boolToInt(settings.KeepListeningHistory), boolToInt(settings.ShareActivity), boolToInt(settings.ShareListening),
+		time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// PruneHistory removes closed listening sessions, daily listening stats and
+// activity records older than the retention settings allow, measured from
+// now, together with the closed sessions, stats and library activity of
+// every user who opted out of keeping their listening history. Open
+// sessions are never removed.
+func (r *Repository) PruneHistory(ctx context.Context, settings models.RetentionSettings, now time.Time) (*models.PruneResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Nothing is older than the zero time, so periods of zero keep
+	// everything but opted-out users' history.
+	cutoff := func(days int) time.Time {
+		if days <= 0 {
+			return time.Time{}
+		}
+		return now.UTC().AddDate(0, 0, -days)
+	}
+	optedOut := `SELECT user_id FROM user_privacy WHERE keep_listening_history = 0`
+	result := &models.PruneResult{}
+
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM listening_sessions
+		WHERE closed_at IS NOT NULL AND (closed_at < ? OR user_id IN (`+optedOut+`))
+	`, cutoff(settings.SessionDays).Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	result.Sessions, _ = res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx, `
+		DELETE FROM user_listening_stats
+		WHERE day < ? OR user_id IN (`+optedOut+`)
+	`, cutoff(settings.StatsDays).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	result.StatsDays, _ = res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx, `DELETE FROM activity WHERE user_id IN (`+optedOut+`)`)
+	if err != nil {
+		return nil, err
+	}
+	result.Activity, _ = res.RowsAffected()
+
+	if settings.ActivityDays > 0 {
+		before := cutoff(settings.ActivityDays).Format(time.RFC3339)
+		res, err = tx.ExecContext(ctx, `DELETE FROM downloads WHERE created_at < ?`, before)
+		if err != nil {
+			return nil, err
+		}
+		result.Downloads, _ = res.RowsAffected()
+
+		res, err = tx.ExecContext(ctx, `DELETE FROM access_token_events WHERE created_at < ?`, before)
+		if err != nil {
+			return nil, err
+		}
+		result.TokenEvents, _ = res.RowsAffected()
+
+		res, err = tx.ExecContext(ctx, `DELETE FROM activity WHERE created_at < ?`, before)
+		if err != nil {
+			return nil, err
+		}
+		pruned, _ := res.RowsAffected()
+		result.Activity += pruned
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
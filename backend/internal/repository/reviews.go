@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// GetReview returns userID's rating of an audiobook, or sql.ErrNoRows if
+// they have not rated it.
+func (r *Repository) GetReview(ctx context.Context, userID, audiobookID string) (*models.Review, error) {
+	var review models.Review
+	var text sql.NullString
+	var createdAt, updatedAt string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, audiobook_id, rating, review, created_at, updated_at
+		FROM user_reviews
+		WHERE user_id = ? AND audiobook_id = ?
+	`, userID, audiobookID).Scan(&review.UserID, &review.AudiobookID, &review.Rating, &text, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	review.Review = nullableString(text)
+	review.CreatedAt = parseTime(createdAt)
+	review.UpdatedAt = parseTime(updatedAt)
+	return &review, nil
+}
+
+// SetReview stores userID's rating of an audiobook. Ratings are kept per
+// work: every edition of the book gets the same rating and review.
+func (r *Repository) SetReview(ctx context.Context, userID, audiobookID string, rating float64, review *string) (*models.Review, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_reviews (user_id, audiobook_id, rating, review, created_at, updated_at)
+		SELECT ?, a.id, ?, ?, ?, ?
+		FROM audiobooks a
+		WHERE a.id = ? OR a.work_id = (SELECT work_id FROM audiobooks WHERE id = ?)
+		ON CONFLICT(user_id, audiobook_id) DO UPDATE SET
+			rating = excluded.rating,
+			review = excluded.review,
+			updated_at = excluded.updated_at
+	`, userID, rating, sqlNullString(review), now, now, audiobookID, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetReview(ctx, userID, audiobookID)
+}
+
+// DeleteReview removes userID's rating of an audiobook and its other
+// editions.
+func (r *Repository) DeleteReview(ctx context.Context, userID, audiobookID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM user_reviews
+		WHERE user_id = ? AND audiobook_id IN (
+			SELECT a.id FROM audiobooks a
+			WHERE a.id = ? OR a.work_id = (SELECT work_id FROM audiobooks WHERE id = ?)
+		)
+	`, userID, audiobookID, audiobookID)
+	return err
+}
+
+// ratingSummary averages users' ratings of an audiobook, or returns nil if
+// nobody has rated it.
+func (r *Repository) ratingSummary(ctx context.Context, audiobookID string) (*models.RatingSummary, error) {
+	var summary models.RatingSummary
+	var average sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT AVG(rating), COUNT(*) FROM user_reviews WHERE audiobook_id = ?
+	`, audiobookID).Scan(&average, &summary.Count)
+	if err != nil {
+		return nil, err
+	}
+	if summary.Count == 0 {
+		return nil, nil
+	}
+	summary.Average = average.Float64
+	return &summary, nil
+}
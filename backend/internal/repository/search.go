@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/models"
+)
+
+// SearchAuthors returns the authors across all libraries whose resolved name
+// matches query, with the number of audiobooks the user can see by each.
+// Names starting with query come first, then the most prolific authors.
+func (r *Repository) SearchAuthors(ctx context.Context, userID, query string, limit int) ([]models.AuthorInfo, error) {
+	pattern := database.LikeEscaper.Replace(query)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rs.author, COUNT(*)
+		FROM audiobook_metadata_resolved rs
+		JOIN audiobooks a ON a.id = rs.audiobook_id
+		WHERE rs.author LIKE ? ESCAPE '\'`+audiobookListFilter+`
+		GROUP BY rs.author
+		ORDER BY rs.author LIKE ? ESCAPE '\' DESC, COUNT(*) DESC, rs.author COLLATE NOCASE
+		LIMIT ?`, "%"+pattern+"%", userID, userID, pattern+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []models.AuthorInfo{}
+	for rows.Next() {
+		var author models.AuthorInfo
+		if err := rows.Scan(&author.Name, &author.BookCount); err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	return authors, rows.Err()
+}
+
+// SearchSeries returns the series across all libraries whose resolved name
+// matches query, with the number and total duration of the audiobooks the
+// user can see in each, ordered like SearchAuthors.
+func (r *Repository) SearchSeries(ctx context.Context, userID, query string, limit int) ([]models.SeriesInfo, error) {
+	pattern := database.LikeEscaper.Replace(query)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rs.series_name, COUNT(*), COALESCE(SUM(rs.duration_sec), 0)
+		FROM audiobook_metadata_resolved rs
+		JOIN audiobooks a ON a.id = rs.audiobook_id
+		WHERE rs.series_name LIKE ? ESCAPE '\'`+audiobookListFilter+`
+		GROUP BY rs.series_name
+		ORDER BY rs.series_name LIKE ? ESCAPE '\' DESC, COUNT(*) DESC, rs.series_name COLLATE NOCASE
+		LIMIT ?`, "%"+pattern+"%", userID, userID, pattern+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []models.SeriesInfo{}
+	for rows.Next() {
+		var info models.SeriesInfo
+		if err := rows.Scan(&info.Name, &info.BookCount, &info.TotalDurationSec); err != nil {
+			return nil, err
+		}
+		series = append(series, info)
+	}
+	return series, rows.Err()
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// maxPlaybackSpeed bounds the listening time one progress update can add to
+// a session: at most this many seconds of audio per second of wall clock.
+// Seeks forward are not counted beyond it.
+const maxPlaybackSpeed = 3.0
+
+// RecordListening adds a progress update to the user's open session for the
+// audiobook. A session last active within idleTimeout is extended by the
+// position moved since; otherwise it is closed and a new one started at
+// position.
+func (r *Repository) RecordListening(ctx context.Context, userID, audiobookID string, position float64, now time.Time, idleTimeout time.Duration) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var id, lastActiveStr string
+	var lastPosition float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, last_active_at, position_sec
+		FROM listening_sessions
+		WHERE user_id = ? AND audiobook_id = ? AND closed_at IS NULL
+		ORDER BY last_active_at DESC
+		LIMIT 1
+	`, userID, audiobookID).Scan(&id, &lastActiveStr, &lastPosition)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		id = ""
+	case err != nil:
+		return err
+	}
+
+	nowStr := now.UTC().Format(time.RFC3339)
+	if id != "" {
+		lastActive := parseTime(lastActiveStr)
+		elapsed := now.Sub(lastActive)
+		if elapsed <= idleTimeout {
+			listened := math.Min(math.Max(position-lastPosition, 0), elapsed.Seconds()*maxPlaybackSpeed)
+			_, err = tx.ExecContext(ctx, `
+				UPDATE listening_sessions
+				SET last_active_at = ?, position_sec = ?, listened_sec = listened_sec + ?
+				WHERE id = ?
+			`, nowStr, position, listened, id)
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+		if err = closeSession(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO listening_sessions (id, user_id, audiobook_id, started_at, last_active_at, start_position_sec, position_sec)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, uuid.NewString(), userID, audiobookID, nowStr, nowStr, position, position)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// closeSession closes a session at its last activity and adds its listened
+// time to the stats for the day it started.
+func closeSession(ctx context.Context, tx *sql.Tx, id string) error {
+	var userID, startedAt string
+	var listened float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT user_id, started_at, listened_sec
+		FROM listening_sessions
+		WHERE id = ? AND closed_at IS NULL
+	`, id).Scan(&userID, &startedAt, &listened)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE listening_sessions SET closed_at = last_active_at WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_listening_stats (user_id, day, listened_sec, sessions)
+		VALUES (?, ?, ?, 1)
+		ON CONFLICT(user_id, day) DO UPDATE SET
+			listened_sec = user_listening_stats.listened_sec + excluded.listened_sec,
+			sessions = user_listening_stats.sessions + 1
+	`, userID, parseTime(startedAt).Format("2006-01-02"), listened)
+	return err
+}
+
+// CloseStaleSessions closes the sessions last active before cutoff and
+// returns how many were closed.
+func (r *Repository) CloseStaleSessions(ctx context.Context, cutoff time.Time) (closed int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM listening_sessions
+		WHERE closed_at IS NULL AND last_active_at < ?
+	`, cutoff.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err = closeSession(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// ListOpenSessions returns the sessions not yet closed, most recently active
+// first.
+func (r *Repository) ListOpenSessions(ctx context.Context) ([]models.ListeningSession, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT s.id, s.user_id, COALESCE(u.username, ''), s.audiobook_id, COALESCE(rm.title, ''),
+		       s.started_at, s.last_active_at, s.start_position_sec, s.position_sec, s.listened_sec
+		FROM listening_sessions s
+		LEFT JOIN users u ON u.id = s.user_id
+		LEFT JOIN audiobook_metadata_resolved rm ON rm.audiobook_id = s.audiobook_id
+		WHERE s.closed_at IS NULL
+		ORDER BY s.last_active_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.ListeningSession{}
+	for rows.Next() {
+		var s models.ListeningSession
+		var startedAt, lastActiveAt string
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Username, &s.AudiobookID, &s.Title,
+			&startedAt, &lastActiveAt, &s.StartPositionSec, &s.PositionSec, &s.ListenedSec); err != nil {
+			return nil, err
+		}
+		s.StartedAt = parseTime(startedAt)
+		s.LastActiveAt = parseTime(lastActiveAt)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// GetListeningStats sums a user's closed sessions by the day they started,
+// from since onwards.
+func (r *Repository) GetListeningStats(ctx context.Context, userID string, since time.Time) (*models.ListeningStats, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT day, listened_sec, sessions
+		FROM user_listening_stats
+		WHERE user_id = ? AND day >= ?
+		ORDER BY day
+	`, userID, since.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &models.ListeningStats{Days: []models.ListeningDay{}}
+	for rows.Next() {
+		var day models.ListeningDay
+		if err := rows.Scan(&day.Day, &day.ListenedSec, &day.Sessions); err != nil {
+			return nil, err
+		}
+		stats.TotalListenedSec += day.ListenedSec
+		stats.TotalSessions += day.Sessions
+		stats.Days = append(stats.Days, day)
+	}
+	return stats, rows.Err()
+}
+
+// ListeningReport totals every user's closed sessions by the day they
+// started, for days from since to until inclusive (YYYY-MM-DD; empty leaves
+// that end open), most listening first.
+func (r *Repository) ListeningReport(ctx context.Context, since, until string) ([]models.UserListeningSummary, error) {
+	where := ""
+	var args []interface{}
+	if since != "" {
+		where += " AND s.day >= ?"
+		args = append(args, since)
+	}
+	if until != "" {
+		where += " AND s.day <= ?"
+		args = append(args, until)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT s.user_id, COALESCE(u.username, ''), SUM(s.listened_sec), SUM(s.sessions), COUNT(*), MIN(s.day), MAX(s.day)
+		FROM user_listening_stats s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE 1=1`+where+`
+		GROUP BY s.user_id, u.username
+		ORDER BY SUM(s.listened_sec) DESC, s.user_id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.UserListeningSummary{}
+	for rows.Next() {
+		var summary models.UserListeningSummary
+		if err := rows.Scan(&summary.UserID, &summary.Username, &summary.ListenedSec, &summary.Sessions,
+			&summary.ActiveDays, &summary.FirstDay, &summary.LastDay); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// GetSidecarMetadata retrieves the sidecar metadata of an audiobook, or nil
+// when its folder has none.
+func (r *Repository) GetSidecarMetadata(ctx context.Context, audiobookID string) (*models.SidecarMetadata, error) {
+	var meta models.SidecarMetadata
+	var sources, readAt string
+	var title, subtitle, author, narrator, description, seriesName, seriesSequence sql.NullString
+	var releaseDate, isbn, asin, language, publisher, genres sql.NullString
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT audiobook_id, sources, title, subtitle, author, narrator, description,
+		       series_name, series_sequence, release_date, isbn, asin, language,
+		       publisher, genres, read_at
+		FROM audiobook_metadata_sidecar
+		WHERE audiobook_id = ?
+	`, audiobookID).Scan(
+		&meta.AudiobookID, &sources, &title, &subtitle, &author, &narrator, &description,
+		&seriesName, &seriesSequence, &releaseDate, &isbn, &asin, &language,
+		&publisher, &genres, &readAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal([]byte(sources), &meta.Sources)
+	meta.Title = nullableString(title)
+	meta.Subtitle = nullableString(subtitle)
+	meta.Author = nullableString(author)
+	meta.Narrator = nullableString(narrator)
+	meta.Description = nullableString(description)
+	meta.SeriesName = nullableString(seriesName)
+	meta.SeriesSequence = nullableString(seriesSequence)
+	meta.ReleaseDate = nullableString(releaseDate)
+	meta.ISBN = nullableString(isbn)
+	meta.ASIN = nullableString(asin)
+	meta.Language = nullableString(language)
+	meta.Publisher = nullableString(publisher)
+	meta.Genres = nullableString(genres)
+	meta.ReadAt = parseTime(readAt)
+	return &meta, nil
+}
+
+// SetSidecarMetadata stores the sidecar metadata of an audiobook, replacing
+// what an earlier scan read. A nil meta removes it.
+func (r *Repository) SetSidecarMetadata(ctx context.Context, audiobookID string, meta *models.SidecarMetadata) error {
+	if meta == nil {
+		_, err := r.db.ExecContext(ctx, `DELETE FROM audiobook_metadata_sidecar WHERE audiobook_id = ?`, audiobookID)
+		return err
+	}
+
+	sources, err := json.Marshal(meta.Sources)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO audiobook_metadata_sidecar (
+			audiobook_id, sources, title, subtitle, author, narrator, description,
+			series_name, series_sequence, release_date, isbn, asin, language,
+			publisher, genres, read_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(audiobook_id) DO UPDATE SET
+			sources = excluded.sources, title = excluded.title, subtitle = excluded.subtitle,
+			author = excluded.author, narrator = excluded.narrator, description = excluded.description,
+			series_name = excluded.series_name, series_sequence = excluded.series_sequence,
+			release_date = excluded.release_date, isbn = excluded.isbn, asin = excluded.asin,
+			language = excluded.language, publisher = excluded.publisher, genres = excluded.genres,
+			read_at = excluded.read_at
+	`, audiobookID, string(sources), meta.Title, meta.Subtitle, meta.Author, meta.Narrator, meta.Description,
+		meta.SeriesName, meta.SeriesSequence, meta.ReleaseDate, meta.ISBN, meta.ASIN, meta.Language,
+		meta.Publisher, meta.Genres, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
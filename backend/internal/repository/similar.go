@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ListSimilarAudiobooks returns up to limit other audiobooks the user can
+// see, in any library, for each way they relate to an audiobook: the same
+// series in series order, and the same author or a shared narrator by
+// title. The relations are found with one query and the books loaded with
+// another.
+func (r *Repository) ListSimilarAudiobooks(ctx context.Context, audiobookID, userID string, limit int) (*models.SimilarBooks, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH target AS (
+			SELECT author, series_name FROM audiobook_metadata_resolved WHERE audiobook_id = ?
+		),
+		visible AS (
+			SELECT a.id FROM audiobooks a
+			WHERE a.id != ?`+audiobookListFilter+`
+		),
+		related AS (
+			SELECT 'series' AS relation, v.id,
+			       ROW_NUMBER() OVER (
+			           ORDER BY CAST(rs.series_sequence AS REAL) IS NULL, CAST(rs.series_sequence AS REAL),
+			                    rs.title_sort, v.id) AS position
+			FROM visible v
+			JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = v.id
+			JOIN target t ON TRIM(COALESCE(t.series_name, '')) != ''
+			             AND rs.series_name = t.series_name COLLATE NOCASE
+			UNION ALL
+			SELECT 'author', v.id, ROW_NUMBER() OVER (ORDER BY rs.title_sort, v.id)
+			FROM visible v
+			JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = v.id
+			JOIN target t ON TRIM(COALESCE(t.author, '')) != ''
+			             AND rs.author = t.author COLLATE NOCASE
+			UNION ALL
+			SELECT 'narrator', v.id, ROW_NUMBER() OVER (ORDER BY rs.title_sort, v.id)
+			FROM visible v
+			LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = v.id
+			WHERE EXISTS (
+				SELECT 1 FROM audiobook_narrators an
+				JOIN audiobook_narrators tn ON tn.narrator_slug = an.narrator_slug AND tn.audiobook_id = ?
+				WHERE an.audiobook_id = v.id
+			)
+		)
+		SELECT relation, id FROM related
+		WHERE position <= ?
+		ORDER BY relation, position`,
+		audiobookID, audiobookID, userID, userID, audiobookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	relations := make(map[string][]string)
+	var ids []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var relation, id string
+		if err := rows.Scan(&relation, &id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		relations[relation] = append(relations[relation], id)
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	books, err := r.GetAudiobookListings(ctx, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Audiobook, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	pick := func(relation string) []models.Audiobook {
+		list := []models.Audiobook{}
+		for _, id := range relations[relation] {
+			if book, ok := byID[id]; ok {
+				list = append(list, book)
+			}
+		}
+		return list
+	}
+	return &models.SimilarBooks{
+		SameSeries:   pick("series"),
+		SameAuthor:   pick("author"),
+		SameNarrator: pick("narrator"),
+	}, nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// ReplaceSupplementFiles stores the supplement files a scan found for an
+// audiobook, dropping the ones no longer on disk. Files that were already
+// recorded keep their IDs, so download links stay valid across scans.
+func (r *Repository) ReplaceSupplementFiles(ctx context.Context, audiobookID string, files []models.SupplementFile) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, filename FROM supplement_files WHERE audiobook_id = ?`, audiobookID)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]string)
+	for rows.Next() {
+		var id, filename string
+		if err = rows.Scan(&id, &filename); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[filename] = id
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM supplement_files WHERE audiobook_id = ?`, audiobookID); err != nil {
+		return err
+	}
+	for _, f := range files {
+		id, ok := existing[f.Filename]
+		if !ok {
+			id = uuid.NewString()
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO supplement_files (id, audiobook_id, filename, kind, mime_type, size_bytes)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, id, audiobookID, f.Filename, f.Kind, f.MimeType, f.SizeBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// supplementFiles returns an audiobook's supplement files ordered by name.
+func (r *Repository) supplementFiles(ctx context.Context, audiobookID string) ([]models.SupplementFile, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, audiobook_id, filename, kind, mime_type, size_bytes
+		FROM supplement_files
+		WHERE audiobook_id = ?
+		ORDER BY filename
+	`, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.SupplementFile
+	for rows.Next() {
+		var f models.SupplementFile
+		if err := rows.Scan(&f.ID, &f.AudiobookID, &f.Filename, &f.Kind, &f.MimeType, &f.SizeBytes); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetSupplementFileWithAudiobook returns a supplement file and the ID and
+// asset path of its audiobook.
+func (r *Repository) GetSupplementFileWithAudiobook(ctx context.Context, fileID string) (*models.SupplementFile, *models.Audiobook, error) {
+	var f models.SupplementFile
+	var audiobook models.Audiobook
+	err := r.db.QueryRowContext(ctx, `
+		SELECT sf.id, sf.audiobook_id, sf.filename, sf.kind, sf.mime_type, sf.size_bytes,
+		       a.id, a.asset_path
+		FROM supplement_files sf
+		INNER JOIN audiobooks a ON a.id = sf.audiobook_id
+		WHERE sf.id = ?
+	`, fileID).Scan(&f.ID, &f.AudiobookID, &f.Filename, &f.Kind, &f.MimeType, &f.SizeBytes,
+		&audiobook.ID, &audiobook.AssetPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &f, &audiobook, nil
+}
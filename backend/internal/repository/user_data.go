@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// TransferUserData moves one user's listening progress, favourites,
+// listening history, ratings, goals, bookmarks and per-audiobook access
+// grants to another user in a single transaction.
+// Where both users have data for the same audiobook, the progress of the
+// most recently played copy wins, the favourite flag is kept if either
+// set it and the more recently updated rating wins. The source user is left with no listening data.
+func (r *Repository) TransferUserData(ctx context.Context, fromUserID, toUserID string) (*models.UserDataTransfer, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &models.UserDataTransfer{FromUserID: fromUserID, ToUserID: toUserID}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO user_audiobook_data (user_id, audiobook_id, progress_sec, is_favorite, last_played_at)
+		SELECT ?, audiobook_id, progress_sec, is_favorite, last_played_at
+		FROM user_audiobook_data
+		WHERE user_id = ?
+		ON CONFLICT(user_id, audiobook_id) DO UPDATE SET
+			progress_sec = CASE
+				WHEN COALESCE(excluded.last_played_at, '') > COALESCE(user_audiobook_data.last_played_at, '') THEN excluded.progress_sec
+				WHEN COALESCE(excluded.last_played_at, '') < COALESCE(user_audiobook_data.last_played_at, '') THEN user_audiobook_data.progress_sec
+				ELSE MAX(excluded.progress_sec, user_audiobook_data.progress_sec)
+			END,
+			is_favorite = MAX(excluded.is_favorite, user_audiobook_data.is_favorite),
+			last_played_at = CASE
+				WHEN COALESCE(excluded.last_played_at, '') > COALESCE(user_audiobook_data.last_played_at, '') THEN excluded.last_played_at
+				ELSE user_audiobook_data.last_played_at
+			END
+	`, toUserID, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		result.Audiobooks = int(n)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_audiobook_data WHERE user_id = ?`, fromUserID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE listening_sessions SET user_id = ? WHERE user_id = ?`, toUserID, fromUserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO user_listening_stats (user_id, day, listened_sec, sessions)
+		SELECT ?, day, listened_sec, sessions
+		FROM user_listening_stats
+		WHERE user_id = ?
+		ON CONFLICT(user_id, day) DO UPDATE SET
+			listened_sec = user_listening_stats.listened_sec + excluded.listened_sec,
+			sessions = user_listening_stats.sessions + excluded.sessions
+	`, toUserID, fromUserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_listening_stats WHERE user_id = ?`, fromUserID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO user_reviews (user_id, audiobook_id, rating, review, created_at, updated_at)
+		SELECT ?, audiobook_id, rating, review, created_at, updated_at
+		FROM user_reviews
+		WHERE user_id = ?
+		ON CONFLICT(user_id, audiobook_id) DO UPDATE SET
+			rating = excluded.rating,
+			review = excluded.review,
+			updated_at = excluded.updated_at
+		WHERE excluded.updated_at > user_reviews.updated_at
+	`, toUserID, fromUserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_reviews WHERE user_id = ?`, fromUserID); err != nil {
+		return nil, err
+	}
+
+	// The target keeps its own goals; the source's carry over if it has none.
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO user_goals (user_id, weekly_hours, yearly_books, updated_at)
+		SELECT ?, weekly_hours, yearly_books, updated_at FROM user_goals WHERE user_id = ?
+	`, toUserID, fromUserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_goals WHERE user_id = ?`, fromUserID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE user_bookmarks SET user_id = ? WHERE user_id = ?`, toUserID, fromUserID); err != nil {
+		return nil, err
+	}
+
+	res, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO audiobook_access (audiobook_id, principal_type, principal_id, created_at)
+		SELECT audiobook_id, principal_type, ?, created_at
+		FROM audiobook_access
+		WHERE principal_type = ? AND principal_id = ?
+	`, toUserID, models.AccessPrincipalUser, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		result.AccessGrants = int(n)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM audiobook_access WHERE principal_type = ? AND principal_id = ?
+	`, models.AccessPrincipalUser, fromUserID); err != nil {
+		return nil, err
+	}
+
+	res, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO library_members (library_id, user_id, created_at)
+		SELECT library_id, ?, created_at FROM library_members WHERE user_id = ?
+	`, toUserID, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		result.AccessGrants += int(n)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM library_members WHERE user_id = ?`, fromUserID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListAlsoListenedBy returns the other users who started an audiobook, most
+// recently played first, when the user shares their listening; only users
+// who share theirs are listed. Those at finishedSec or beyond count as
+// finished; a finishedSec of zero, for books of unknown length, counts
+// nobody as finished. Positions are never returned.
+func (r *Repository) ListAlsoListenedBy(ctx context.Context, audiobookID, userID string, finishedSec float64) ([]models.Listener, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.username, ? > 0 AND d.progress_sec >= ?
+		FROM user_audiobook_data d
+		JOIN users u ON u.id = d.user_id
+		JOIN user_privacy p ON p.user_id = d.user_id AND p.share_listening = 1
+		WHERE d.audiobook_id = ? AND d.user_id <> ? AND d.progress_sec > 0
+		  AND u.disabled_at IS NULL AND u.pending_approval_at IS NULL
+		  AND EXISTS (SELECT 1 FROM user_privacy me WHERE me.user_id = ? AND me.share_listening = 1)
+		ORDER BY d.last_played_at DESC, u.username
+	`, finishedSec, finishedSec, audiobookID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var listeners []models.Listener
+	for rows.Next() {
+		var listener models.Listener
+		var finished bool
+		if err := rows.Scan(&listener.UserID, &listener.Username, &finished); err != nil {
+			return nil, err
+		}
+		listener.Status = models.ListenerListening
+		if finished {
+			listener.Status = models.ListenerFinished
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, rows.Err()
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+const webhookColumns = `id, url, secret, events, enabled, created_at, updated_at, last_delivery_at, last_error`
+
+// CreateWebhook stores a new webhook.
+func (r *Repository) CreateWebhook(ctx context.Context, hook *models.Webhook) error {
+	events, err := json.Marshal(hook.Events)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	hook.CreatedAt = now
+	hook.UpdatedAt = now
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO webhooks (id, url, secret, events, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, hook.ID, hook.URL, hook.Secret, string(events), boolToInt(hook.Enabled),
+		now.Format(time.RFC3339), now.Format(time.RFC3339))
+	return err
+}
+
+// ListWebhooks returns every webhook, oldest first.
+func (r *Repository) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, rows.Err()
+}
+
+// GetWebhook returns a webhook, or sql.ErrNoRows if there is none.
+func (r *Repository) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+	return scanWebhook(row)
+}
+
+// UpdateWebhook saves a webhook's URL, secret, events and enabled flag.
+func (r *Repository) UpdateWebhook(ctx context.Context, hook *models.Webhook) error {
+	events, err := json.Marshal(hook.Events)
+	if err != nil {
+		return err
+	}
+
+	hook.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhooks SET url = ?, secret = ?, events = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, hook.URL, hook.Secret, string(events), boolToInt(hook.Enabled), hook.UpdatedAt.Format(time.RFC3339), hook.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook. It returns sql.ErrNoRows if there is none.
+func (r *Repository) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordWebhookDelivery stores the outcome of the latest delivery attempt;
+// deliveryErr is nil when it succeeded.
+func (r *Repository) RecordWebhookDelivery(ctx context.Context, id string, at time.Time, deliveryErr *string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE webhooks SET last_delivery_at = ?, last_error = ? WHERE id = ?
+	`, at.UTC().Format(time.RFC3339), sqlNullString(deliveryErr), id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var hook models.Webhook
+	var events, createdAt, updatedAt string
+	var lastDelivery, lastError sql.NullString
+	if err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, &events, &hook.Enabled,
+		&createdAt, &updatedAt, &lastDelivery, &lastError); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &hook.Events); err != nil {
+		return nil, err
+	}
+	hook.CreatedAt = parseTime(createdAt)
+	hook.UpdatedAt = parseTime(updatedAt)
+	if lastDelivery.Valid {
+		t := parseTime(lastDelivery.String)
+		hook.LastDeliveryAt = &t
+	}
+	hook.LastError = nullableString(lastError)
+	return &hook, nil
+}
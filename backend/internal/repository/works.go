@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// LinkEditions makes the given audiobooks editions of one work and returns
+// its ID. Works the books already belong to are merged into it. A book any
+// user marked as a favourite becomes a favourite in every edition, and a
+// user's latest rating of an edition becomes their rating of every edition.
+func (r *Repository) LinkEditions(ctx context.Context, ids []string) (workID string, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT work_id FROM audiobooks
+		WHERE id IN (`+placeholders+`) AND work_id IS NOT NULL
+		ORDER BY work_id
+	`, args...)
+	if err != nil {
+		return "", err
+	}
+	var works []interface{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return "", err
+		}
+		works = append(works, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	workID = uuid.NewString()
+	if len(works) > 0 {
+		workID = works[0].(string)
+	}
+
+	query := `UPDATE audiobooks SET work_id = ?, updated_at = ? WHERE id IN (` + placeholders + `)`
+	updateArgs := append([]interface{}{workID, time.Now().UTC().Format(time.RFC3339)}, args...)
+	if len(works) > 0 {
+		query += ` OR work_id IN (` + strings.TrimSuffix(strings.Repeat("?,", len(works)), ",") + `)`
+		updateArgs = append(updateArgs, works...)
+	}
+	if _, err = tx.ExecContext(ctx, query, updateArgs...); err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_audiobook_data (user_id, audiobook_id, progress_sec, is_favorite, last_played_at)
+		SELECT DISTINCT u.user_id, a.id, 0, 1, NULL
+		FROM user_audiobook_data u
+		JOIN audiobooks favorite ON favorite.id = u.audiobook_id
+		JOIN audiobooks a ON a.work_id = favorite.work_id
+		WHERE u.is_favorite = 1 AND favorite.work_id = ?
+		ON CONFLICT(user_id, audiobook_id) DO UPDATE SET is_favorite = 1
+	`, workID)
+	if err != nil {
+		return "", err
+	}
+
+	// Each user's latest rating of any edition becomes their rating of all.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_reviews (user_id, audiobook_id, rating, review, created_at, updated_at)
+		SELECT latest.user_id, a.id, latest.rating, latest.review, latest.created_at, latest.updated_at
+		FROM (
+			SELECT r.user_id, r.rating, r.review, r.created_at, r.updated_at,
+			       ROW_NUMBER() OVER (PARTITION BY r.user_id ORDER BY r.updated_at DESC, r.audiobook_id) AS n
+			FROM user_reviews r
+			JOIN audiobooks rated ON rated.id = r.audiobook_id
+			WHERE rated.work_id = ?
+		) latest
+		JOIN audiobooks a ON a.work_id = ?
+		WHERE latest.n = 1
+		ON CONFLICT(user_id, audiobook_id) DO UPDATE SET
+			rating = excluded.rating,
+			review = excluded.review,
+			updated_at = excluded.updated_at
+	`, workID, workID)
+	if err != nil {
+		return "", err
+	}
+
+	return workID, tx.Commit()
+}
+
+// UnlinkEdition takes an audiobook out of its work. A work left with a
+// single edition is dissolved. Favourites and ratings stay as they are.
+func (r *Repository) UnlinkEdition(ctx context.Context, audiobookID string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var workID sql.NullString
+	if err = tx.QueryRowContext(ctx, `SELECT work_id FROM audiobooks WHERE id = ?`, audiobookID).Scan(&workID); err != nil {
+		return err
+	}
+	if !workID.Valid {
+		return tx.Commit()
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err = tx.ExecContext(ctx, `UPDATE audiobooks SET work_id = NULL, updated_at = ? WHERE id = ?`, now, audiobookID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE audiobooks SET work_id = NULL, updated_at = ?
+		WHERE work_id = ? AND (SELECT COUNT(*) FROM audiobooks WHERE work_id = ?) < 2
+	`, now, workID.String, workID.String)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// attachEditions sets the audiobook's work and lists its other editions
+// with userID's progress in each. Editions restricted away from userID are
+// left out; an empty userID lists them all.
+func (r *Repository) attachEditions(ctx context.Context, ab *models.Audiobook, userID string) error {
+	var workID sql.NullString
+	if err := r.db.QueryRowContext(ctx, `SELECT work_id FROM audiobooks WHERE id = ?`, ab.ID).Scan(&workID); err != nil {
+		return err
+	}
+	if !workID.Valid {
+		return nil
+	}
+	ab.WorkID = &workID.String
+
+	query := `
+		SELECT a.id, COALESCE(rs.title, ''), rs.subtitle, rs.narrator,
+		       COALESCE((SELECT SUM(mf.duration_sec) FROM media_files mf WHERE mf.audiobook_id = a.id), 0),
+		       COALESCE(u.progress_sec, 0)
+		FROM audiobooks a
+		LEFT JOIN audiobook_metadata_resolved rs ON rs.audiobook_id = a.id
+		LEFT JOIN user_audiobook_data u ON u.audiobook_id = a.id AND u.user_id = ?
+		WHERE a.work_id = ? AND a.id <> ?`
+	args := []interface{}{userID, workID.String, ab.ID}
+	if userID != "" {
+		query += audiobookListFilter
+		args = append(args, userID, userID)
+	}
+	rows, err := r.db.QueryContext(ctx, query+`
+		ORDER BY rs.title, a.id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var edition models.Edition
+		var subtitle, narrator sql.NullString
+		if err := rows.Scan(&edition.ID, &edition.Title, &subtitle, &narrator, &edition.DurationSec, &edition.ProgressSec); err != nil {
+			return err
+		}
+		edition.Subtitle = nullableString(subtitle)
+		edition.Narrator = nullableString(narrator)
+		if edition.ProgressSec > 0 {
+			progress := models.UserAudiobookData{ProgressSec: edition.ProgressSec}
+			progress.ApplyDuration(edition.DurationSec)
+			edition.ProgressPct = progress.ProgressPct
+		}
+		ab.Editions = append(ab.Editions, edition)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// handleDataExport downloads a zip archive of everything stored about the
+// caller, one JSON file per kind of data.
+func (h *handler) handleDataExport(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	export, err := h.svc.ExportUserData(r.Context(), *user)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if export.AccessTokens, err = h.authSvc.ListTokens(r.Context(), user.ID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"progress.json", export.Progress},
+		{"sessions.json", export.Sessions},
+		{"listening_days.json", export.ListeningDays},
+		{"reviews.json", export.Reviews},
+		{"bookmarks.json", export.Bookmarks},
+		{"goals.json", export.Goals},
+		{"privacy.json", export.Privacy},
+		{"notifications.json", export.Notifications},
+		{"access_tokens.json", export.AccessTokens},
+		{"downloads.json", export.Downloads},
+		{"client_logs.json", export.ClientLogs},
+	} {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := "lore-data-export-" + export.ExportedAt.Format("20060102") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (h *handler) handleErasureRequestGet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	req, err := h.svc.LatestErasureRequest(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "no erasure request")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": req})
+}
+
+// handleErasureRequestCreate asks for the caller's account to be erased
+// from {"reason": "..."}; the reason is optional. An admin approves or
+// rejects the request.
+func (h *handler) handleErasureRequestCreate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var body struct {
+		Reason *string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	req, err := h.svc.RequestErasure(r.Context(), user.ID, body.Reason)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": req})
+}
+
+// handleErasureRequestCancel withdraws the caller's pending erasure request.
+func (h *handler) handleErasureRequestCancel(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	if err := h.svc.CancelErasure(r.Context(), user.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "no pending erasure request")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminErasureRequestList lists erasure requests, oldest first,
+// optionally filtered by ?status=pending|approved|rejected.
+func (h *handler) handleAdminErasureRequestList(w http.ResponseWriter, r *http.Request) {
+	requests, err := h.svc.ListErasureRequests(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": requests})
+}
+
+type erasureDecisionRequest struct {
+	Note *string `json:"note"`
+}
+
+// handleAdminErasureApprove erases the account of a pending request. The
+// account is deactivated first, which refuses erasing the last admin.
+func (h *handler) handleAdminErasureApprove(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromContext(r)
+	if admin == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+	var body erasureDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	id := chi.URLParam(r, "request_id")
+	req, err := h.svc.GetErasureRequest(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "erasure request not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	if req.Status == models.ErasurePending {
+		if _, err := h.authSvc.SetUserDisabled(r.Context(), req.UserID, true); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	req, result, err := h.svc.ApproveErasure(r.Context(), id, admin.ID, body.Note)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": req, "result": result})
+}
+
+// handleAdminErasureReject declines a pending request, with an optional
+// {"note": "..."} for the user.
+func (h *handler) handleAdminErasureReject(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromContext(r)
+	if admin == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+	var body erasureDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	req, err := h.svc.RejectErasure(r.Context(), chi.URLParam(r, "request_id"), admin.ID, body.Note)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "erasure request not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": req})
+}
@@ -4,10 +4,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/lore/backend/internal/auth"
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/services/audiobooks"
 )
 
 // Admin handlers
@@ -29,7 +35,7 @@ func (h *handler) handleAdminAudiobookCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": audiobook})
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
 }
 
 func (h *handler) handleAdminAudiobookDelete(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +49,38 @@ func (h *handler) handleAdminAudiobookDelete(w http.ResponseWriter, r *http.Requ
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"message": "audiobook deleted from catalog"})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]string{"message": "audiobook deleted from catalog"}})
+}
+
+// handleAdminAudiobookMove assigns an audiobook to another library and
+// library directory, optionally moving its folder there.
+func (h *handler) handleAdminAudiobookMove(w http.ResponseWriter, r *http.Request) {
+	var req audiobooks.MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.LibraryID) == "" {
+		respondError(w, http.StatusBadRequest, "library_id is required")
+		return
+	}
+
+	audiobook, err := h.svc.MoveAudiobook(r.Context(), chi.URLParam(r, "audiobook_id"), req)
+	if err != nil {
+		var validationErr *apperrors.ValidationError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			respondError(w, http.StatusNotFound, "audiobook not found")
+		case errors.Is(err, audiobooks.ErrMoveDestinationExists):
+			respondError(w, http.StatusConflict, err.Error())
+		case errors.As(err, &validationErr):
+			handleError(w, err)
+		default:
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
 }
 
 func (h *handler) handleAdminScan(w http.ResponseWriter, r *http.Request) {
@@ -85,9 +122,14 @@ func (h *handler) handleAdminUserCreate(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *handler) handleAdminUserList(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	offset, limit := getPagination(r)
-	
-	users, total, err := h.authSvc.ListUsers(r.Context(), offset, limit)
+	users, total, err := h.authSvc.ListUsers(r.Context(), filter, offset, limit)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -125,11 +167,17 @@ func (h *handler) handleAdminUserUpdate(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		Username *string `json:"username,omitempty"`
 		IsAdmin  *bool   `json:"is_admin,omitempty"`
+		Disabled *bool   `json:"disabled,omitempty"`
+		Password *string `json:"password,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if req.Password != nil && *req.Password == "" {
+		respondError(w, http.StatusBadRequest, "password cannot be empty")
+		return
+	}
 
 	username := ""
 	if req.Username != nil {
@@ -137,28 +185,87 @@ func (h *handler) handleAdminUserUpdate(w http.ResponseWriter, r *http.Request)
 	}
 
 	user, err := h.authSvc.UpdateUser(r.Context(), userID, username, req.IsAdmin)
+	if err == nil && req.Disabled != nil {
+		user, err = h.authSvc.SetUserDisabled(r.Context(), userID, *req.Disabled)
+	}
+	// Resetting a password leaves the API key, and so existing sessions,
+	// as they are.
+	if err == nil && req.Password != nil {
+		err = h.authSvc.UpdatePassword(r.Context(), userID, *req.Password)
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			respondError(w, http.StatusNotFound, "user not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, err.Error())
+		handleError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{"data": user})
 }
 
+// handleAdminUserApprove lets a self-registered account awaiting approval
+// sign in. Rejected sign-ups are removed with DELETE ?purge=true.
+func (h *handler) handleAdminUserApprove(w http.ResponseWriter, r *http.Request) {
+	user, err := h.authSvc.ApproveUser(r.Context(), chi.URLParam(r, "user_id"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": user})
+}
+
+// handleAdminUserDelete deactivates an account, keeping its listening
+// history. With ?purge=true the account and its data are removed for good.
+// ?transfer_to=<user_id> first moves the account's progress, favourites and
+// access grants to another user, merging the two accounts.
 func (h *handler) handleAdminUserDelete(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "user_id")
-	
-	err := h.authSvc.DeleteUser(r.Context(), userID)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	query := r.URL.Query()
+
+	transferTo := strings.TrimSpace(query.Get("transfer_to"))
+	if transferTo != "" {
+		if transferTo == userID {
+			respondError(w, http.StatusBadRequest, "transfer_to must be a different user")
+			return
+		}
+		if _, err := h.authSvc.GetUserByID(r.Context(), transferTo); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				respondError(w, http.StatusBadRequest, "transfer_to user not found")
+				return
+			}
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Disabling first refuses the last admin before any data moves.
+	if _, err := h.authSvc.SetUserDisabled(r.Context(), userID, true); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "user deleted successfully"})
+	var transfer *models.UserDataTransfer
+	if transferTo != "" {
+		var err error
+		if transfer, err = h.svc.TransferUserData(r.Context(), userID, transferTo); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	message := "user disabled successfully"
+	if query.Get("purge") == "true" {
+		if err := h.authSvc.DeleteUser(r.Context(), userID); err != nil {
+			handleError(w, err)
+			return
+		}
+		message = "user deleted successfully"
+	}
+
+	resp := map[string]interface{}{"message": message}
+	if transfer != nil {
+		resp["transfer"] = transfer
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": resp})
 }
 
 
@@ -173,11 +280,162 @@ func (h *handler) handleAdminAudiobookUnlink(w http.ResponseWriter, r *http.Requ
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]interface{}{"data": audiobook})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
 }
 
 
 // Request types
 type createAudiobookRequest struct {
 	SourcePath string `json:"source_path"`
-}
\ No newline at end of file
+}
+
+type audiobookAccessRequest struct {
+	UserIDs []string `json:"user_ids"`
+	Roles   []string `json:"roles"`
+}
+
+func (h *handler) handleAdminAudiobookAccessGet(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "audiobook_id")
+	rules, err := h.svc.GetAudiobookAccess(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": rules})
+}
+
+func (h *handler) handleAdminAudiobookAccessSet(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "audiobook_id")
+
+	var req audiobookAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	for _, userID := range req.UserIDs {
+		if _, err := h.authSvc.GetUserByID(r.Context(), userID); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				respondError(w, http.StatusBadRequest, "unknown user: "+userID)
+				return
+			}
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	rules, err := h.svc.SetAudiobookAccess(r.Context(), id, req.UserIDs, req.Roles)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": rules})
+}
+
+// handleAdminTrackOrder sets the order of an audiobook's media files from
+// {"file_ids": [...]}, or restores natural order for an empty list.
+func (h *handler) handleAdminTrackOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "audiobook_id")
+
+	var req struct {
+		FileIDs []string `json:"file_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	audiobook, err := h.svc.SetTrackOrder(r.Context(), id, req.FileIDs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
+}
+
+// handleAdminLinkEditions links an audiobook with {"audiobook_ids": [...]}
+// as editions of one work.
+func (h *handler) handleAdminLinkEditions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "audiobook_id")
+
+	var req struct {
+		AudiobookIDs []string `json:"audiobook_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	audiobook, err := h.svc.LinkEditions(r.Context(), id, req.AudiobookIDs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
+}
+
+// handleAdminUnlinkEdition takes an audiobook out of its work.
+func (h *handler) handleAdminUnlinkEdition(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.UnlinkEdition(r.Context(), chi.URLParam(r, "audiobook_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseUserFilter reads the role, status, username prefix and sort of a user
+// listing. Active accounts are those neither disabled nor awaiting approval.
+func parseUserFilter(r *http.Request) (models.UserFilter, error) {
+	var filter models.UserFilter
+	query := r.URL.Query()
+
+	switch role := strings.TrimSpace(query.Get("role")); role {
+	case "", models.RoleAdmin, models.RoleUser:
+		filter.Role = role
+	default:
+		return filter, fmt.Errorf("invalid role %q (expected %s or %s)", role, models.RoleAdmin, models.RoleUser)
+	}
+	switch status := strings.TrimSpace(query.Get("status")); status {
+	case "":
+	case "active", "disabled":
+		disabled := status == "disabled"
+		filter.Disabled = &disabled
+		if !disabled {
+			pending := false
+			filter.Pending = &pending
+		}
+	case "pending":
+		pending := true
+		filter.Pending = &pending
+	default:
+		return filter, fmt.Errorf("invalid status %q (expected active, disabled or pending)", status)
+	}
+	filter.UsernamePrefix = strings.TrimSpace(query.Get("username"))
+
+	sort, err := getSort(r, models.UserSortFields)
+	if err != nil {
+		return filter, err
+	}
+	filter.Sort = sort
+	return filter, nil
+}
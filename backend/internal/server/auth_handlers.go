@@ -1,10 +1,15 @@
 package server
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/lore/backend/internal/auth"
+	apperrors "github.com/lore/backend/internal/errors"
 )
 
 // Authentication handlers
@@ -25,8 +30,13 @@ func (h *handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	user, err := h.authSvc.Login(r.Context(), req.Username, req.Password)
+	if errors.Is(err, auth.ErrAccountDisabled) || errors.Is(err, auth.ErrAccountPending) {
+		respondAuthError(w, r, err)
+		return
+	}
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, "invalid credentials")
+		authFailures.record(r, authFailInvalidCredentials)
+		respondErrorCode(w, http.StatusUnauthorized, apperrors.CodeInvalidCredentials, "invalid credentials")
 		return
 	}
 	
@@ -69,8 +79,8 @@ func (h *handler) handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	respondJSON(w, http.StatusOK, map[string]string{
-		"message": "logged out successfully",
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]string{"message": "logged out successfully"},
 	})
 }
 
@@ -126,4 +136,119 @@ func (h *handler) handleUserUpdateProfile(w http.ResponseWriter, r *http.Request
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{"data": updatedUser})
-}
\ No newline at end of file
+}
+
+// handleAuthProviders lists the login methods available to clients.
+func (h *handler) handleAuthProviders(w http.ResponseWriter, r *http.Request) {
+	registration, err := h.authSvc.RegistrationSettings(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	oidc := map[string]interface{}{"enabled": false}
+	if provider := h.authSvc.OIDC(); provider != nil {
+		oidc = map[string]interface{}{
+			"enabled":      true,
+			"display_name": provider.DisplayName(),
+			"login_url":    "/api/v1/auth/oidc/login",
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"local":                 true,
+			"oidc":                  oidc,
+			"registration":          registration.Open,
+			"registration_approval": registration.Open && registration.RequireApproval,
+		},
+	})
+}
+
+// oidcStateCookie binds an SSO login to the browser that started it, so a
+// callback URL from someone else's login cannot sign the browser in as them.
+const oidcStateCookie = "lore_oidc_state"
+
+// handleOIDCLogin redirects the browser to the identity provider.
+func (h *handler) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider := h.authSvc.OIDC()
+	if provider == nil {
+		respondError(w, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	target, state, err := provider.AuthCodeURL(r.Context())
+	if err != nil {
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	// Lax lets the cookie through the provider's top-level redirect back.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   int(auth.OIDCStateTTL.Seconds()),
+		Secure:   strings.HasPrefix(requestBaseURL(r), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleOIDCCallback completes the login, provisioning the user on first sign-in.
+func (h *handler) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider := h.authSvc.OIDC()
+	if provider == nil {
+		respondError(w, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		respondError(w, http.StatusUnauthorized, "identity provider error: "+providerErr)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/auth/oidc", MaxAge: -1, HttpOnly: true})
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondError(w, http.StatusBadRequest, auth.ErrInvalidOIDCState.Error())
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), state)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOIDCState) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	user, err := h.authSvc.LoginOIDC(r.Context(), identity)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if redirect := provider.PostLoginURL(); redirect != "" {
+		fragment := url.Values{}
+		fragment.Set("api_key", *user.APIKey)
+		http.Redirect(w, r, redirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"user": map[string]interface{}{
+				"id":       user.ID,
+				"username": user.Username,
+				"is_admin": user.IsAdmin,
+			},
+			"api_key": *user.APIKey,
+		},
+	})
+}
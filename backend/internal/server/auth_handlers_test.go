@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/models"
+)
+
+// newOIDCHandler returns a handler on a fresh database whose SSO logins go
+// to a fake identity provider that answers userinfo with claims.
+func newOIDCHandler(t *testing.T, cfg auth.OIDCConfig, claims map[string]interface{}) *handler {
+	t.Helper()
+	idp := httptest.NewServer(nil)
+	t.Cleanup(idp.Close)
+	idp.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 idp.URL,
+				"authorization_endpoint": idp.URL + "/authorize",
+				"token_endpoint":         idp.URL + "/token",
+				"userinfo_endpoint":      idp.URL + "/userinfo",
+			})
+		case "/token":
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer"})
+		case "/userinfo":
+			json.NewEncoder(w).Encode(claims)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	db, err := database.Open(filepath.Join(t.TempDir(), "lore.db"), database.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg.IssuerURL = idp.URL
+	cfg.ClientID = "lore"
+	cfg.RedirectURL = "https://lore.example.com/api/v1/auth/oidc/callback"
+	authSvc := auth.NewService(db)
+	authSvc.SetRegistrationOpen(true)
+	authSvc.EnableOIDC(auth.NewOIDCProvider(cfg))
+	return &handler{authSvc: authSvc}
+}
+
+// startOIDCLogin starts an SSO login and returns its state and the cookie
+// binding it to the browser.
+func startOIDCLogin(t *testing.T, h *handler) (string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.handleOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login cookies = %v, want an HttpOnly %s", cookies, oidcStateCookie)
+	}
+	return location.Query().Get("state"), cookies[0]
+}
+
+// finishOIDCLogin calls back with state, presenting cookie when it is set.
+func finishOIDCLogin(h *handler, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=code&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	h.handleOIDCCallback(rec, req)
+	return rec
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	h := newOIDCHandler(t, auth.OIDCConfig{}, map[string]interface{}{"sub": "alice", "preferred_username": "alice"})
+	state, cookie := startOIDCLogin(t, h)
+
+	if rec := finishOIDCLogin(h, state, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback without cookie: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	other := &http.Cookie{Name: oidcStateCookie, Value: "someone-else"}
+	if rec := finishOIDCLogin(h, state, other); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback with another login's cookie: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := finishOIDCLogin(h, state, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("callback with cookie: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if _, err := h.authSvc.GetUserByUsername(context.Background(), "alice"); err != nil {
+		t.Errorf("alice was not signed in: %v", err)
+	}
+}
+
+func TestOIDCRefusesIdentitiesOutsideAllowedDomains(t *testing.T) {
+	claims := map[string]interface{}{"sub": "mallory", "preferred_username": "mallory", "email": "mallory@gmail.com", "email_verified": true}
+	h := newOIDCHandler(t, auth.OIDCConfig{AllowedDomains: []string{"example.com"}}, claims)
+
+	login := func() int {
+		t.Helper()
+		state, cookie := startOIDCLogin(t, h)
+		return finishOIDCLogin(h, state, cookie).Code
+	}
+
+	if code := login(); code != http.StatusForbidden {
+		t.Errorf("other domain: status = %d, want %d", code, http.StatusForbidden)
+	}
+	claims["email"], claims["email_verified"] = "mallory@example.com", false
+	if code := login(); code != http.StatusForbidden {
+		t.Errorf("unverified email: status = %d, want %d", code, http.StatusForbidden)
+	}
+	if _, err := h.authSvc.GetUserByUsername(context.Background(), "mallory"); err == nil {
+		t.Error("a refused identity was provisioned")
+	}
+	claims["email_verified"] = true
+	if code := login(); code != http.StatusOK {
+		t.Errorf("allowed domain: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestOIDCKeepsLastAdmin(t *testing.T) {
+	ctx := context.Background()
+	claims := map[string]interface{}{"sub": "alice", "preferred_username": "alice", "groups": []string{"lore-admins"}}
+	h := newOIDCHandler(t, auth.OIDCConfig{AdminGroups: []string{"lore-admins"}}, claims)
+	isAdmin := func() bool {
+		t.Helper()
+		state, cookie := startOIDCLogin(t, h)
+		if rec := finishOIDCLogin(h, state, cookie); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		user, err := h.authSvc.GetUserByUsername(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.IsAdmin
+	}
+
+	if !isAdmin() {
+		t.Fatal("alice is not admin after signing in from the admin group")
+	}
+	// Leave alice the only admin.
+	seeded, err := h.authSvc.GetUserByUsername(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.authSvc.DeleteUser(ctx, seeded.ID); err != nil {
+		t.Fatal(err)
+	}
+	claims["groups"] = []string{}
+	if !isAdmin() {
+		t.Error("the last admin was demoted on leaving the admin group")
+	}
+
+	if _, err := h.authSvc.CreateUser(ctx, "owner", "password123", true); err != nil {
+		t.Fatal(err)
+	}
+	if isAdmin() {
+		t.Error("alice stayed admin after leaving the admin group with another admin present")
+	}
+}
+
+func TestOIDCProvisioningFollowsRegistrationPolicy(t *testing.T) {
+	ctx := context.Background()
+	login := func(h *handler) int {
+		t.Helper()
+		state, cookie := startOIDCLogin(t, h)
+		return finishOIDCLogin(h, state, cookie).Code
+	}
+	setPolicy := func(h *handler, settings models.RegistrationSettings) {
+		t.Helper()
+		if err := h.authSvc.UpdateRegistrationSettings(ctx, &settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	claims := map[string]interface{}{"sub": "carol", "preferred_username": "carol"}
+
+	t.Run("closed", func(t *testing.T) {
+		h := newOIDCHandler(t, auth.OIDCConfig{}, claims)
+		setPolicy(h, models.RegistrationSettings{DefaultRole: models.RoleUser})
+		if code := login(h); code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", code, http.StatusForbidden)
+		}
+		if _, err := h.authSvc.GetUserByUsername(ctx, "carol"); err == nil {
+			t.Error("a new identity was provisioned while registration is closed")
+		}
+	})
+
+	t.Run("closed with auto-provisioning", func(t *testing.T) {
+		h := newOIDCHandler(t, auth.OIDCConfig{AutoProvision: true}, claims)
+		setPolicy(h, models.RegistrationSettings{DefaultRole: models.RoleUser})
+		if code := login(h); code != http.StatusOK {
+			t.Errorf("status = %d, want %d", code, http.StatusOK)
+		}
+	})
+
+	t.Run("approval required", func(t *testing.T) {
+		h := newOIDCHandler(t, auth.OIDCConfig{}, claims)
+		setPolicy(h, models.RegistrationSettings{Open: true, RequireApproval: true, DefaultRole: models.RoleAdmin})
+		if code := login(h); code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", code, http.StatusForbidden)
+		}
+		user, err := h.authSvc.GetUserByUsername(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.PendingApproval || !user.IsAdmin {
+			t.Errorf("carol: pending = %v, admin = %v; want a pending admin", user.PendingApproval, user.IsAdmin)
+		}
+	})
+}
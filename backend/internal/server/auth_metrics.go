@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/auth"
+)
+
+// Reasons authentication failures are counted under.
+const (
+	authFailMissingCredentials = "missing_credentials"
+	authFailInvalidFormat      = "invalid_format"
+	authFailInvalidAPIKey      = "invalid_api_key"
+	authFailInvalidCredentials = "invalid_credentials"
+	authFailInvalidFeedToken   = "invalid_feed_token"
+	authFailInvalidMediaToken  = "invalid_media_token"
+	authFailAccountDisabled    = "account_disabled"
+	authFailAccountPending     = "account_pending"
+	authFailForbiddenAdmin     = "forbidden_admin"
+	authFailUnauthorized       = "unauthorized"
+)
+
+// unmatchedRoute labels failures on paths no route serves, so scanners
+// probing random URLs add one entry rather than one per path.
+const unmatchedRoute = "(unmatched)"
+
+// AuthFailureStats counts the rejected requests for one route and reason.
+type AuthFailureStats struct {
+	Method string `json:"method"`
+	// Route is the route pattern, e.g. "/api/v1/admin/users/{user_id}".
+	Route  string    `json:"route"`
+	Reason string    `json:"reason"`
+	Count  int64     `json:"count"`
+	LastAt time.Time `json:"last_at"`
+}
+
+type authFailureKey struct {
+	method, route, reason string
+}
+
+// authFailureCounter counts authentication failures since the server
+// started, to spot credential stuffing or misconfigured clients.
+type authFailureCounter struct {
+	mu     sync.Mutex
+	since  time.Time
+	counts map[authFailureKey]*AuthFailureStats
+}
+
+var authFailures = &authFailureCounter{
+	since:  time.Now().UTC(),
+	counts: make(map[authFailureKey]*AuthFailureStats),
+}
+
+func (c *authFailureCounter) record(r *http.Request, reason string) {
+	key := authFailureKey{method: r.Method, route: routePattern(r), reason: reason}
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats, ok := c.counts[key]
+	if !ok {
+		stats = &AuthFailureStats{Method: key.method, Route: key.route, Reason: key.reason}
+		c.counts[key] = stats
+	}
+	stats.Count++
+	stats.LastAt = now
+}
+
+// stats returns the counters, most frequent first.
+func (c *authFailureCounter) stats() []AuthFailureStats {
+	c.mu.Lock()
+	list := make([]AuthFailureStats, 0, len(c.counts))
+	for _, stats := range c.counts {
+		list = append(list, *stats)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		if list[i].Route != list[j].Route {
+			return list[i].Route < list[j].Route
+		}
+		return list[i].Reason < list[j].Reason
+	})
+	return list
+}
+
+// routePattern returns the pattern of the route serving r. Middleware runs
+// before sub-routers have matched the rest of the path, so the pattern is
+// looked up from the root router.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return unmatchedRoute
+	}
+	match := chi.NewRouteContext()
+	if !rctx.Routes.Match(match, r.Method, r.URL.Path) {
+		return unmatchedRoute
+	}
+	return match.RoutePattern()
+}
+
+// authFailureReason names the reason an authentication error is counted
+// under, or "" for errors that are not authentication failures, such as a
+// database outage.
+func authFailureReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrMissingAuthorizationHeader):
+		return authFailMissingCredentials
+	case errors.Is(err, auth.ErrInvalidAuthorizationFormat):
+		return authFailInvalidFormat
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		return authFailInvalidAPIKey
+	case errors.Is(err, auth.ErrInvalidFeedToken):
+		return authFailInvalidFeedToken
+	case errors.Is(err, auth.ErrInvalidMediaToken):
+		return authFailInvalidMediaToken
+	case errors.Is(err, auth.ErrAccountDisabled):
+		return authFailAccountDisabled
+	case errors.Is(err, auth.ErrAccountPending):
+		return authFailAccountPending
+	case errors.Is(err, auth.ErrUnauthorized):
+		return authFailUnauthorized
+	}
+	return ""
+}
+
+// respondAuthError counts a failed authentication and responds with err.
+func respondAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if reason := authFailureReason(err); reason != "" {
+		authFailures.record(r, reason)
+	}
+	handleError(w, err)
+}
+
+// handleAdminAuthFailures reports authentication failures per route and
+// reason since the server started.
+func (s *handler) handleAdminAuthFailures(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  authFailures.stats(),
+		"since": authFailures.since,
+	})
+}
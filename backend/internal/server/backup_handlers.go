@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/backup"
+)
+
+// backupResponse links a backup to its download.
+type backupResponse struct {
+	backup.Backup
+	DownloadURL string `json:"download_url"`
+}
+
+func newBackupResponse(b backup.Backup) backupResponse {
+	return backupResponse{Backup: b, DownloadURL: "/api/v1/admin/backups/" + b.Name}
+}
+
+// handleAdminBackupCreate writes a backup archive of the database and
+// covers and returns where to download it.
+func (h *handler) handleAdminBackupCreate(w http.ResponseWriter, r *http.Request) {
+	created, err := h.backups.Create(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": newBackupResponse(*created)})
+}
+
+// handleAdminBackupList lists the backup archives, newest first.
+func (h *handler) handleAdminBackupList(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.backups.List()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	list := make([]backupResponse, len(backups))
+	for i, b := range backups {
+		list[i] = newBackupResponse(b)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+}
+
+func (h *handler) handleAdminBackupDownload(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	path, err := h.backups.Path(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			respondError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeFile(w, r, path)
+}
+
+func (h *handler) handleAdminBackupDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.backups.Delete(chi.URLParam(r, "name")); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			respondError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
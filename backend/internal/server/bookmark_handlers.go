@@ -0,0 +1,79 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleBookmarkList returns the caller's bookmarks in an audiobook.
+func (h *handler) handleBookmarkList(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	bookmarks, err := h.svc.ListBookmarks(r.Context(), user.ID, chi.URLParam(r, "audiobook_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found in library")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": bookmarks})
+}
+
+// handleBookmarkCreate bookmarks a position from
+// {"position_sec": 1234.5, "title": "..."}.
+func (h *handler) handleBookmarkCreate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		PositionSec float64 `json:"position_sec"`
+		Title       string  `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	bookmark, err := h.svc.AddBookmark(r.Context(), user.ID, chi.URLParam(r, "audiobook_id"), req.PositionSec, req.Title)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found in library")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": bookmark})
+}
+
+// handleBookmarkDelete removes one of the caller's bookmarks.
+func (h *handler) handleBookmarkDelete(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	if err := h.svc.DeleteBookmark(r.Context(), user.ID, chi.URLParam(r, "audiobook_id"), chi.URLParam(r, "bookmark_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "bookmark not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
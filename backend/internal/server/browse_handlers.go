@@ -0,0 +1,68 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	apperrors "github.com/lore/backend/internal/errors"
+)
+
+// Car head units show short lists, so browse pages are small.
+const (
+	browsePageSize    = 12
+	browseMaxPageSize = 24
+)
+
+// handleBrowse returns a node of the browse tree for CarPlay and Android
+// Auto with a page of its children. node is the ID of a node from an
+// earlier response; without it the root is returned.
+func (h *handler) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	query := r.URL.Query()
+	offset, limit := 0, browsePageSize
+	if raw := query.Get("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			handleError(w, apperrors.NewValidationError("offset", "invalid offset", raw))
+			return
+		}
+		offset = parsed
+	}
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > browseMaxPageSize {
+			handleError(w, apperrors.NewValidationError("limit", "invalid limit (must be 1-24)", raw))
+			return
+		}
+		limit = parsed
+	}
+
+	node, children, total, err := h.svc.Browse(r.Context(), user.ID, query.Get("node"), offset, limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "browse node not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"node":     node,
+			"children": children,
+		},
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
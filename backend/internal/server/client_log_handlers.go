@@ -0,0 +1,221 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// Limits on client log reports, so a misbehaving client cannot fill the
+// database.
+const (
+	maxClientLogBody    = 64 << 10
+	maxClientLogMessage = 2000
+	maxClientLogStack   = 32 << 10
+	maxClientLogContext = 16 << 10
+	maxClientLogField   = 200
+)
+
+var clientLogLevels = []string{models.ClientLogError, models.ClientLogWarning, models.ClientLogInfo}
+
+func validClientLogLevel(level string) bool {
+	for _, known := range clientLogLevels {
+		if level == known {
+			return true
+		}
+	}
+	return false
+}
+
+// optionalString returns nil for blank values and the trimmed value
+// otherwise.
+func optionalString(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// handleClientLogCreate stores an error report from a first-party client,
+// such as a playback failure with the player state in its context.
+func (h *handler) handleClientLogCreate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxClientLogBody)
+	var req struct {
+		Level         string                 `json:"level"`
+		Message       string                 `json:"message"`
+		Client        string                 `json:"client"`
+		ClientVersion string                 `json:"client_version"`
+		Device        string                 `json:"device"`
+		OS            string                 `json:"os"`
+		AudiobookID   string                 `json:"audiobook_id"`
+		Stack         string                 `json:"stack"`
+		Context       map[string]interface{} `json:"context"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("report exceeds %d bytes", maxClientLogBody))
+			return
+		}
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	entry := &models.ClientLog{
+		UserID:        &user.ID,
+		Username:      user.Username,
+		Level:         strings.ToLower(strings.TrimSpace(req.Level)),
+		Message:       strings.TrimSpace(req.Message),
+		Client:        strings.TrimSpace(req.Client),
+		ClientVersion: strings.TrimSpace(req.ClientVersion),
+		Device:        optionalString(req.Device),
+		OS:            optionalString(req.OS),
+		AudiobookID:   optionalString(req.AudiobookID),
+		Stack:         optionalString(req.Stack),
+		Context:       req.Context,
+	}
+	if entry.Level == "" {
+		entry.Level = models.ClientLogError
+	}
+	if err := validateClientLog(entry); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ua := r.UserAgent(); ua != "" {
+		entry.UserAgent = &ua
+	}
+
+	if err := h.svc.RecordClientLog(r.Context(), entry); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": map[string]interface{}{"id": entry.ID}})
+}
+
+func validateClientLog(entry *models.ClientLog) error {
+	if !validClientLogLevel(entry.Level) {
+		return fmt.Errorf("level must be one of %s", strings.Join(clientLogLevels, ", "))
+	}
+	if entry.Message == "" || entry.Client == "" || entry.ClientVersion == "" {
+		return errors.New("message, client and client_version are required")
+	}
+	if len(entry.Message) > maxClientLogMessage {
+		return fmt.Errorf("message exceeds %d bytes", maxClientLogMessage)
+	}
+	if entry.Stack != nil && len(*entry.Stack) > maxClientLogStack {
+		return fmt.Errorf("stack exceeds %d bytes", maxClientLogStack)
+	}
+	for name, value := range map[string]*string{
+		"client":         &entry.Client,
+		"client_version": &entry.ClientVersion,
+		"device":         entry.Device,
+		"os":             entry.OS,
+		"audiobook_id":   entry.AudiobookID,
+	} {
+		if value != nil && len(*value) > maxClientLogField {
+			return fmt.Errorf("%s exceeds %d bytes", name, maxClientLogField)
+		}
+	}
+	if len(entry.Context) > 0 {
+		encoded, err := json.Marshal(entry.Context)
+		if err != nil {
+			return errors.New("invalid context")
+		}
+		if len(encoded) > maxClientLogContext {
+			return fmt.Errorf("context exceeds %d bytes", maxClientLogContext)
+		}
+	}
+	return nil
+}
+
+// handleAdminClientLogList lists client error reports, newest first.
+func (h *handler) handleAdminClientLogList(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseClientLogFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, limit := getPagination(r)
+	entries, total, err := h.svc.ListClientLogs(r.Context(), filter, offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": entries,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
+
+// handleAdminClientLogGet returns a single client error report.
+func (h *handler) handleAdminClientLogGet(w http.ResponseWriter, r *http.Request) {
+	entry, err := h.svc.GetClientLog(r.Context(), chi.URLParam(r, "log_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "client log not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": entry})
+}
+
+// parseClientLogFilter reads the user_id, level, client, client_version,
+// audiobook_id, since and until (RFC3339) query parameters.
+func parseClientLogFilter(r *http.Request) (models.ClientLogFilter, error) {
+	query := r.URL.Query()
+	filter := models.ClientLogFilter{
+		UserID:        optionalString(query.Get("user_id")),
+		Level:         strings.ToLower(strings.TrimSpace(query.Get("level"))),
+		Client:        strings.TrimSpace(query.Get("client")),
+		ClientVersion: strings.TrimSpace(query.Get("client_version")),
+		AudiobookID:   optionalString(query.Get("audiobook_id")),
+	}
+	if filter.Level != "" && !validClientLogLevel(filter.Level) {
+		return filter, fmt.Errorf("level must be one of %s", strings.Join(clientLogLevels, ", "))
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		raw := strings.TrimSpace(query.Get(param.name))
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s (expected RFC3339 timestamp)", param.name)
+		}
+		*param.target = &t
+	}
+
+	return filter, nil
+}
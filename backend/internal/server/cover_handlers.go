@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/covers"
+)
+
+// coverFormMemory is how much of a cover upload is buffered in memory.
+const coverFormMemory = 1 << 20
+
+// handleAdminCoverUpload stores an uploaded cover image for an audiobook and
+// locks its cover_url override to it. The image is sent as the "cover" field
+// of a multipart form.
+func (h *handler) handleAdminCoverUpload(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+	id := chi.URLParam(r, "audiobook_id")
+
+	// Leave room for the multipart framing around the image itself. Parts
+	// beyond coverFormMemory are spooled to a temporary file.
+	r.Body = http.MaxBytesReader(w, r.Body, covers.MaxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(coverFormMemory); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondError(w, http.StatusRequestEntityTooLarge, covers.ErrTooLarge.Error())
+			return
+		}
+		respondError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("cover")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "cover file is required")
+		return
+	}
+	defer file.Close()
+
+	custom, err := h.svc.UploadCover(r.Context(), id, user.ID, file, header.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			respondError(w, http.StatusNotFound, "audiobook not found")
+		case errors.Is(err, covers.ErrTooLarge):
+			respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, covers.ErrUnsupportedType):
+			respondError(w, http.StatusUnsupportedMediaType, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": custom})
+}
+
+// handleCoverGet serves an audiobook's uploaded cover, or the server's copy
+// of its remote cover. ?size=thumb returns the thumbnail and ?size=<px> a
+// copy resized to one of covers.Sizes.
+func (h *handler) handleCoverGet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+	id := chi.URLParam(r, "audiobook_id")
+
+	size, err := coverSize(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	path, err := h.svc.CoverPath(r.Context(), id, user.ID, user.IsAdmin, size)
+	if err != nil {
+		respondCoverError(w, err)
+		return
+	}
+
+	serveCover(w, r, path)
+}
+
+// coverSize parses a cover's ?size=: "thumb", an edge in pixels, or
+// "original" and empty for zero.
+func coverSize(r *http.Request) (int, error) {
+	switch raw := r.URL.Query().Get("size"); raw {
+	case "", "original":
+		return 0, nil
+	case "thumb":
+		return covers.ThumbnailSize, nil
+	default:
+		size, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, covers.ErrInvalidSize
+		}
+		return size, nil
+	}
+}
+
+// serveCover serves a cover image with an ETag and Last-Modified date from
+// the file, so a client revalidating a cover that has not changed gets 304
+// Not Modified.
+func serveCover(w http.ResponseWriter, r *http.Request, path string) {
+	if info, err := os.Stat(path); err == nil {
+		w.Header().Set("ETag", fmt.Sprintf("\"%d-%d\"", info.ModTime().UnixNano(), info.Size()))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeFile(w, r, path)
+}
+
+// respondCoverError maps a CoverPath failure to a response.
+func respondCoverError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, covers.ErrNotFound):
+		respondError(w, http.StatusNotFound, "cover not found")
+	case errors.Is(err, covers.ErrInvalidSize):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, covers.ErrFetchFailed), errors.Is(err, covers.ErrUnsupportedType), errors.Is(err, covers.ErrTooLarge):
+		respondError(w, http.StatusBadGateway, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		respondError(w, http.StatusServiceUnavailable, "cover processing did not finish")
+	default:
+		respondError(w, http.StatusForbidden, err.Error())
+	}
+}
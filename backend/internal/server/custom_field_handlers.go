@@ -0,0 +1,75 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) handleAdminCustomFieldList(w http.ResponseWriter, r *http.Request) {
+	fields, err := h.svc.ListCustomFields(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": fields})
+}
+
+// handleAdminCustomFieldCreate defines a custom field from
+// {"key": "purchase_date", "name": "Purchase date", "type": "date"}.
+func (h *handler) handleAdminCustomFieldCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	field, err := h.svc.CreateCustomField(r.Context(), req.Key, req.Name, req.Type)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": field})
+}
+
+// handleAdminCustomFieldUpdate renames a custom field from {"name": "..."}.
+func (h *handler) handleAdminCustomFieldUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	field, err := h.svc.RenameCustomField(r.Context(), chi.URLParam(r, "key"), req.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "custom field not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": field})
+}
+
+// handleAdminCustomFieldDelete removes a custom field and its values.
+func (h *handler) handleAdminCustomFieldDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteCustomField(r.Context(), chi.URLParam(r, "key")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "custom field not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
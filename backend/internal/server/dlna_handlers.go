@@ -0,0 +1,387 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/dlna"
+	"github.com/lore/backend/internal/models"
+)
+
+// DLNAConfig turns on the DLNA media server. Renderers cannot sign in, so
+// they browse as the user named by Username.
+type DLNAConfig struct {
+	Username     string
+	FriendlyName string
+	UUID         string
+}
+
+// Enabled reports whether the media server should be served.
+func (c DLNAConfig) Enabled() bool {
+	return c.Username != ""
+}
+
+// Object IDs in the DLNA tree: the root lists libraries, libraries list
+// books and books list their media files as tracks.
+const (
+	dlnaRootID        = "0"
+	dlnaLibraryPrefix = "library:"
+	dlnaBookPrefix    = "book:"
+	dlnaTrackPrefix   = "track:"
+)
+
+const (
+	// dlnaMaxPage bounds the objects returned by one Browse.
+	dlnaMaxPage = 200
+	// dlnaLinkLifetime is how long stream URLs handed to renderers work.
+	dlnaLinkLifetime = 24 * time.Hour
+	// dlnaUpdateID is the ContentDirectory's update ID. Listings are not
+	// evented, so it never changes.
+	dlnaUpdateID = "1"
+)
+
+// dlnaProtocols lists the formats renderers are told the server offers.
+var dlnaProtocols = []string{"audio/mpeg", "audio/mp4", "audio/x-m4b", "audio/aac", "audio/ogg", "audio/flac", "audio/wav"}
+
+// dlnaLocalOnly refuses DLNA requests from outside the local network or
+// through a reverse proxy, since they are not authenticated.
+func dlnaLocalOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip := net.ParseIP(host)
+		local := err == nil && ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+		if !local || r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+			respondError(w, http.StatusForbidden, "DLNA is only available on the local network")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) handleDLNADevice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Write(dlna.DeviceDescription(h.dlna.FriendlyName, h.dlna.UUID))
+}
+
+func (h *handler) handleDLNAContentDirectorySCPD(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Write([]byte(dlna.ContentDirectorySCPD))
+}
+
+func (h *handler) handleDLNAConnectionManagerSCPD(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Write([]byte(dlna.ConnectionManagerSCPD))
+}
+
+// handleDLNASubscribe accepts event subscriptions, which some renderers
+// insist on, without ever sending events.
+func (h *handler) handleDLNASubscribe(w http.ResponseWriter, r *http.Request) {
+	sid := r.Header.Get("SID")
+	if sid == "" {
+		sid = "uuid:" + uuid.NewString()
+	}
+	w.Header().Set("SID", sid)
+	w.Header().Set("TIMEOUT", "Second-1800")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) handleDLNAUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) handleDLNAConnectionManager(w http.ResponseWriter, r *http.Request) {
+	action, err := dlna.ReadAction(r.Body)
+	if err != nil {
+		dlna.WriteFault(w, dlna.ErrInvalidAction, "Invalid Action")
+		return
+	}
+
+	switch action.Name {
+	case "GetProtocolInfo":
+		source := make([]string, len(dlnaProtocols))
+		for i, mimeType := range dlnaProtocols {
+			source[i] = "http-get:*:" + mimeType + ":*"
+		}
+		dlna.WriteResponse(w, dlna.ConnectionManagerType, action.Name, []dlna.Arg{
+			{Name: "Source", Value: strings.Join(source, ",")},
+			{Name: "Sink", Value: ""},
+		})
+	case "GetCurrentConnectionIDs":
+		dlna.WriteResponse(w, dlna.ConnectionManagerType, action.Name, []dlna.Arg{{Name: "ConnectionIDs", Value: "0"}})
+	default:
+		dlna.WriteFault(w, dlna.ErrInvalidAction, "Invalid Action")
+	}
+}
+
+func (h *handler) handleDLNAContentDirectory(w http.ResponseWriter, r *http.Request) {
+	action, err := dlna.ReadAction(r.Body)
+	if err != nil {
+		dlna.WriteFault(w, dlna.ErrInvalidAction, "Invalid Action")
+		return
+	}
+
+	switch action.Name {
+	case "Browse":
+		h.dlnaBrowse(w, r, action)
+	case "GetSearchCapabilities":
+		dlna.WriteResponse(w, dlna.ContentDirectoryType, action.Name, []dlna.Arg{{Name: "SearchCaps", Value: ""}})
+	case "GetSortCapabilities":
+		dlna.WriteResponse(w, dlna.ContentDirectoryType, action.Name, []dlna.Arg{{Name: "SortCaps", Value: ""}})
+	case "GetSystemUpdateID":
+		dlna.WriteResponse(w, dlna.ContentDirectoryType, action.Name, []dlna.Arg{{Name: "Id", Value: dlnaUpdateID}})
+	default:
+		dlna.WriteFault(w, dlna.ErrInvalidAction, "Invalid Action")
+	}
+}
+
+// dlnaLinks builds the URLs renderers fetch streams and covers from.
+type dlnaLinks struct {
+	base      string
+	feedToken string
+	signer    *auth.MediaSigner
+}
+
+func (h *handler) dlnaBrowse(w http.ResponseWriter, r *http.Request, action *dlna.Action) {
+	start, err := strconv.Atoi(action.Args["StartingIndex"])
+	if err != nil || start < 0 {
+		dlna.WriteFault(w, dlna.ErrInvalidArgs, "Invalid StartingIndex")
+		return
+	}
+	count, err := strconv.Atoi(action.Args["RequestedCount"])
+	if err != nil || count < 0 {
+		dlna.WriteFault(w, dlna.ErrInvalidArgs, "Invalid RequestedCount")
+		return
+	}
+	if count == 0 || count > dlnaMaxPage {
+		count = dlnaMaxPage
+	}
+
+	user, err := h.authSvc.GetUserByUsername(r.Context(), h.dlna.Username)
+	if err == nil && (user.Disabled || user.PendingApproval) {
+		err = errors.New("the DLNA user is disabled")
+	}
+	if err != nil {
+		dlna.WriteFault(w, dlna.ErrActionFailed, err.Error())
+		return
+	}
+	links := dlnaLinks{base: requestBaseURL(r)}
+	if links.feedToken, err = h.authSvc.FeedToken(r.Context(), user.ID); err == nil {
+		links.signer, err = h.authSvc.MediaSigner(r.Context(), user.ID)
+	}
+	if err != nil {
+		dlna.WriteFault(w, dlna.ErrActionFailed, err.Error())
+		return
+	}
+
+	id := action.Args["ObjectID"]
+	var objects []dlna.Object
+	var total int
+	switch action.Args["BrowseFlag"] {
+	case "BrowseMetadata":
+		var object *dlna.Object
+		object, err = h.dlnaObject(r, user, links, id)
+		if err == nil {
+			objects, total = []dlna.Object{*object}, 1
+		}
+	case "BrowseDirectChildren":
+		objects, total, err = h.dlnaChildren(r, user, links, id, start, count)
+	default:
+		dlna.WriteFault(w, dlna.ErrInvalidArgs, "Invalid BrowseFlag")
+		return
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			dlna.WriteFault(w, dlna.ErrNoSuchObject, "No such object")
+			return
+		}
+		dlna.WriteFault(w, dlna.ErrActionFailed, err.Error())
+		return
+	}
+
+	result, err := dlna.DIDL(objects)
+	if err != nil {
+		dlna.WriteFault(w, dlna.ErrActionFailed, err.Error())
+		return
+	}
+	dlna.WriteResponse(w, dlna.ContentDirectoryType, "Browse", []dlna.Arg{
+		{Name: "Result", Value: result},
+		{Name: "NumberReturned", Value: strconv.Itoa(len(objects))},
+		{Name: "TotalMatches", Value: strconv.Itoa(total)},
+		{Name: "UpdateID", Value: dlnaUpdateID},
+	})
+}
+
+// dlnaObject describes the object with the given ID.
+func (h *handler) dlnaObject(r *http.Request, user *models.User, links dlnaLinks, id string) (*dlna.Object, error) {
+	switch {
+	case id == dlnaRootID:
+		libraries, err := h.librarySvc.GetLibraries(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		return &dlna.Object{ID: dlnaRootID, ParentID: "-1", Title: h.dlna.FriendlyName, Class: dlna.ClassFolder, ChildCount: len(libraries)}, nil
+
+	case strings.HasPrefix(id, dlnaLibraryPrefix):
+		library, err := h.librarySvc.GetLibrary(r.Context(), strings.TrimPrefix(id, dlnaLibraryPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return h.dlnaLibrary(r, user, library)
+
+	case strings.HasPrefix(id, dlnaBookPrefix):
+		book, err := h.svc.GetLibraryItem(r.Context(), strings.TrimPrefix(id, dlnaBookPrefix), user.ID)
+		if err != nil {
+			return nil, err
+		}
+		object := dlnaBook(book, links)
+		return &object, nil
+
+	case strings.HasPrefix(id, dlnaTrackPrefix):
+		bookID, fileID, _ := strings.Cut(strings.TrimPrefix(id, dlnaTrackPrefix), ":")
+		book, err := h.svc.GetLibraryItem(r.Context(), bookID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range book.MediaFiles {
+			if book.MediaFiles[i].ID == fileID {
+				return h.dlnaTrack(r, user, links, book, i)
+			}
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// dlnaChildren lists a page of the children of the object with the given
+// ID, with their total number.
+func (h *handler) dlnaChildren(r *http.Request, user *models.User, links dlnaLinks, id string, start, count int) ([]dlna.Object, int, error) {
+	objects := []dlna.Object{}
+	switch {
+	case id == dlnaRootID:
+		libraries, err := h.librarySvc.GetLibraries(r.Context())
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := start; i < len(libraries) && i < start+count; i++ {
+			object, err := h.dlnaLibrary(r, user, &libraries[i])
+			if err != nil {
+				return nil, 0, err
+			}
+			objects = append(objects, *object)
+		}
+		return objects, len(libraries), nil
+
+	case strings.HasPrefix(id, dlnaLibraryPrefix):
+		library, err := h.librarySvc.GetLibrary(r.Context(), strings.TrimPrefix(id, dlnaLibraryPrefix))
+		if err != nil {
+			return nil, 0, err
+		}
+		books, total, err := h.svc.ListLibraryBooks(r.Context(), user.ID, library.ID, models.AudiobookFilter{Sort: models.SortTitle}, start, count)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := range books {
+			objects = append(objects, dlnaBook(&books[i], links))
+		}
+		return objects, total, nil
+
+	case strings.HasPrefix(id, dlnaBookPrefix):
+		book, err := h.svc.GetLibraryItem(r.Context(), strings.TrimPrefix(id, dlnaBookPrefix), user.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := start; i < len(book.MediaFiles) && i < start+count; i++ {
+			object, err := h.dlnaTrack(r, user, links, book, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			objects = append(objects, *object)
+		}
+		return objects, len(book.MediaFiles), nil
+
+	case strings.HasPrefix(id, dlnaTrackPrefix):
+		if _, err := h.dlnaObject(r, user, links, id); err != nil {
+			return nil, 0, err
+		}
+		return objects, 0, nil
+	}
+	return nil, 0, sql.ErrNoRows
+}
+
+func (h *handler) dlnaLibrary(r *http.Request, user *models.User, library *models.Library) (*dlna.Object, error) {
+	_, total, err := h.svc.ListLibraryBooks(r.Context(), user.ID, library.ID, models.AudiobookFilter{Sort: models.SortTitle}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	title := library.DisplayName
+	if title == "" {
+		title = library.Name
+	}
+	return &dlna.Object{
+		ID:         dlnaLibraryPrefix + library.ID,
+		ParentID:   dlnaRootID,
+		Title:      title,
+		Class:      dlna.ClassFolder,
+		ChildCount: total,
+	}, nil
+}
+
+func dlnaBook(book *models.Audiobook, links dlnaLinks) dlna.Object {
+	resolved := book.ResolveMetadata()
+	object := dlna.Object{
+		ID:          dlnaBookPrefix + book.ID,
+		ParentID:    dlnaRootID,
+		Title:       dlnaBookTitle(book),
+		Class:       dlna.ClassAlbum,
+		Creator:     resolved.Author,
+		AlbumArtURI: feedCoverURL(book.ID, resolved.CoverURL, links.base, links.feedToken),
+		ChildCount:  book.FileCount,
+	}
+	if book.LibraryID != nil {
+		object.ParentID = dlnaLibraryPrefix + *book.LibraryID
+	}
+	if len(book.MediaFiles) > 0 {
+		object.ChildCount = len(book.MediaFiles)
+	}
+	return object
+}
+
+func (h *handler) dlnaTrack(r *http.Request, user *models.User, links dlnaLinks, book *models.Audiobook, index int) (*dlna.Object, error) {
+	mf := book.MediaFiles[index]
+	size, err := h.mediaFileSize(r, user, mf.ID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := book.ResolveMetadata()
+	return &dlna.Object{
+		ID:          dlnaTrackPrefix + book.ID + ":" + mf.ID,
+		ParentID:    dlnaBookPrefix + book.ID,
+		Title:       strings.TrimSuffix(mf.Filename, filepath.Ext(mf.Filename)),
+		Class:       dlna.ClassTrack,
+		Creator:     resolved.Author,
+		Album:       dlnaBookTitle(book),
+		TrackNumber: index + 1,
+		AlbumArtURI: feedCoverURL(book.ID, resolved.CoverURL, links.base, links.feedToken),
+		Resource: &dlna.Resource{
+			URL:         signedMediaURL(links.base, links.signer, mf.ID, time.Now().Add(dlnaLinkLifetime)),
+			MimeType:    mf.MimeType,
+			Size:        size,
+			DurationSec: mf.DurationSec,
+		},
+	}, nil
+}
+
+func dlnaBookTitle(book *models.Audiobook) string {
+	if title := book.ResolveMetadata().Title; title != "" {
+		return title
+	}
+	return filepath.Base(book.AssetPath)
+}
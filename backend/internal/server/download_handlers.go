@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// recordDownload writes an audit entry for a completed download response.
+// HEAD requests and conditional 304 responses transfer no content and are skipped.
+func (h *handler) recordDownload(r *http.Request, user *models.User, kind string, audiobookID, mediaFileID *string, rw *responseWriter) {
+	if r.Method == http.MethodHead || rw.statusCode == http.StatusNotModified {
+		return
+	}
+
+	record := &models.DownloadRecord{
+		UserID:      &user.ID,
+		Username:    user.Username,
+		AudiobookID: audiobookID,
+		MediaFileID: mediaFileID,
+		Kind:        kind,
+		Bytes:       rw.bytesWritten,
+		StatusCode:  rw.statusCode,
+	}
+	if addr := clientAddr(r); addr != "" {
+		record.RemoteAddr = &addr
+	}
+	if ua := r.UserAgent(); ua != "" {
+		record.UserAgent = &ua
+	}
+
+	// The client may already have disconnected; the audit entry is still wanted.
+	ctx := context.WithoutCancel(r.Context())
+	if err := h.svc.RecordDownload(ctx, record); err != nil {
+		log.Printf("record download: %v", err)
+	}
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// handleAdminDownloadList returns raw download audit entries.
+func (h *handler) handleAdminDownloadList(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDownloadFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, limit := getPagination(r)
+	records, total, err := h.svc.ListDownloads(r.Context(), filter, offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": records,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
+
+// handleAdminDownloadReport returns download counts and egress per user.
+func (h *handler) handleAdminDownloadReport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDownloadFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summaries, err := h.svc.DownloadReport(r.Context(), filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": summaries})
+}
+
+// parseDownloadFilter reads user_id, since, and until (RFC3339) query parameters.
+func parseDownloadFilter(r *http.Request) (models.DownloadFilter, error) {
+	var filter models.DownloadFilter
+	query := r.URL.Query()
+
+	if userID := strings.TrimSpace(query.Get("user_id")); userID != "" {
+		filter.UserID = &userID
+	}
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		raw := strings.TrimSpace(query.Get(param.name))
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s (expected RFC3339 timestamp)", param.name)
+		}
+		*param.target = &t
+	}
+
+	sort, err := getSort(r, models.DownloadSortFields)
+	if err != nil {
+		return filter, err
+	}
+	filter.Sort = sort
+
+	return filter, nil
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/services/audiobooks"
+)
+
+// feedItemLimit is how many audiobooks a feed lists.
+const feedItemLimit = 50
+
+// feedCoverSize is the edge, in pixels, of covers linked from feeds.
+const feedCoverSize = 600
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Media   string     `xml:"xmlns:media,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Author        string    `xml:"itunes:author,omitempty"`
+	Type          string    `xml:"itunes:type,omitempty"`
+	Image         *rssImage `xml:"itunes:image,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Creator     string        `xml:"dc:creator,omitempty"`
+	Description string        `xml:"description"`
+	Duration    string        `xml:"itunes:duration,omitempty"`
+	Image       *rssImage     `xml:"itunes:image,omitempty"`
+	Thumbnail   *rssMediaURL  `xml:"media:thumbnail,omitempty"`
+	Episode     int           `xml:"itunes:episode,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssMediaURL struct {
+	URL string `xml:"url,attr"`
+}
+
+// handleFeedToken returns the caller's feed token, creating it if needed.
+func (h *handler) handleFeedToken(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	token, err := h.authSvc.FeedToken(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]string{"token": token}})
+}
+
+// handleFeedTokenRotate replaces the caller's feed token, breaking every feed
+// URL that used the old one.
+func (h *handler) handleFeedTokenRotate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	token, err := h.authSvc.RotateFeedToken(r.Context(), user.ID, clientAddr(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]string{"token": token}})
+}
+
+// handleRecentFeed serves an RSS feed of a library's most recently added
+// audiobooks that the token's owner can see. It takes feed tokens.
+func (h *handler) handleRecentFeed(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	user, _, err := h.authSvc.AuthenticateToken(r.Context(), token, "", clientAddr(r), models.TokenScopeFeed)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	library, err := h.librarySvc.GetLibrary(r.Context(), chi.URLParam(r, "library_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	books, _, err := h.svc.ListLibraryBooks(r.Context(), user.ID, library.ID, models.AudiobookFilter{Sort: models.SortRecentlyAdded}, 0, feedItemLimit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	base := requestBaseURL(r)
+	feed := rssFeed{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Media:   "http://search.yahoo.com/mrss/",
+		Channel: rssChannel{
+			Title:         library.DisplayName + " - Recently Added",
+			Link:          base,
+			Description:   "Audiobooks recently added to " + library.DisplayName,
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			Items:         make([]rssItem, 0, len(books)),
+		},
+	}
+	for i := range books {
+		feed.Channel.Items = append(feed.Channel.Items, feedItem(&books[i], base, token))
+	}
+
+	writeFeed(w, feed, library.ID)
+}
+
+// handlePodcastFeed serves a private podcast feed of one audiobook with each
+// media file as an episode, so any podcast app can play it. It takes feed
+// tokens and share tokens for the audiobook. Enclosure URLs carry tokens
+// signed with the feed's token that stay valid until it is revoked.
+func (h *handler) handlePodcastFeed(w http.ResponseWriter, r *http.Request) {
+	audiobookID := chi.URLParam(r, "audiobook_id")
+	token := r.URL.Query().Get("token")
+	user, accessToken, err := h.authSvc.AuthenticateToken(r.Context(), token, audiobookID, clientAddr(r), models.TokenScopeFeed, models.TokenScopeShare)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	book, err := h.svc.GetLibraryItem(r.Context(), audiobookID, user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	signer := auth.TokenSigner(accessToken)
+
+	base := requestBaseURL(r)
+	resolved := book.ResolveMetadata()
+	item := feedItem(book, base, token)
+	if item.Description == "" {
+		item.Description = html.EscapeString(item.Title)
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Media:   "http://search.yahoo.com/mrss/",
+		Channel: rssChannel{
+			Title:         item.Title,
+			Link:          base,
+			Description:   item.Description,
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			Author:        resolved.Author,
+			Type:          "serial",
+			Image:         item.Image,
+			Items:         make([]rssItem, 0, len(book.MediaFiles)),
+		},
+	}
+
+	for i, mf := range book.MediaFiles {
+		size, err := h.mediaFileSize(r, user, mf.ID)
+		if err != nil {
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		episode := rssItem{
+			Title: strings.TrimSuffix(mf.Filename, filepath.Ext(mf.Filename)),
+			GUID:  rssGUID{Value: mf.ID},
+			// Files share the book's date, so space them a second apart to
+			// keep apps that sort by date in track order.
+			PubDate:     book.CreatedAt.Add(time.Duration(i) * time.Second).UTC().Format(time.RFC1123Z),
+			Creator:     resolved.Author,
+			Description: item.Title,
+			Image:       item.Image,
+			Episode:     i + 1,
+			Enclosure: &rssEnclosure{
+				URL:    signedMediaURL(base, signer, mf.ID, time.Time{}),
+				Length: size,
+				Type:   mf.MimeType,
+			},
+		}
+		if mf.DurationSec > 0 {
+			episode.Duration = formatFeedDuration(mf.DurationSec)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, episode)
+	}
+
+	writeFeed(w, feed, book.ID)
+}
+
+// handleFeedMediaFile streams a media file linked from a podcast feed or a
+// download manifest, authenticated by the signed token in its URL or an
+// access token that may stream the file.
+func (h *handler) handleFeedMediaFile(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "file_id")
+	user, err := h.authSvc.VerifyMediaToken(r.Context(), fileID, r.URL.Query().Get("token"), clientAddr(r))
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	h.serveMediaFile(w, r, user, fileID)
+}
+
+// handleFeedCover serves a cover linked from a feed, authenticated by a feed
+// token or a share token for the audiobook since feed readers cannot send an
+// Authorization header.
+func (h *handler) handleFeedCover(w http.ResponseWriter, r *http.Request) {
+	audiobookID := chi.URLParam(r, "audiobook_id")
+	user, _, err := h.authSvc.AuthenticateToken(r.Context(), r.URL.Query().Get("token"), audiobookID, clientAddr(r), models.TokenScopeFeed, models.TokenScopeShare)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	path, err := h.svc.CoverPath(r.Context(), audiobookID, user.ID, user.IsAdmin, feedCoverSize)
+	if err != nil {
+		respondCoverError(w, err)
+		return
+	}
+
+	serveCover(w, r, path)
+}
+
+func feedItem(book *models.Audiobook, base, token string) rssItem {
+	resolved := book.ResolveMetadata()
+
+	title := resolved.Title
+	if title == "" {
+		title = filepath.Base(book.AssetPath)
+	}
+	item := rssItem{
+		Title:   title,
+		GUID:    rssGUID{Value: book.ID},
+		PubDate: book.CreatedAt.UTC().Format(time.RFC1123Z),
+		Creator: resolved.Author,
+	}
+	if book.TotalDurationSec > 0 {
+		item.Duration = formatFeedDuration(book.TotalDurationSec)
+	}
+
+	cover := feedCoverURL(book.ID, resolved.CoverURL, base, token)
+	if cover != "" {
+		item.Image = &rssImage{Href: cover}
+		item.Thumbnail = &rssMediaURL{URL: cover}
+	}
+
+	var desc strings.Builder
+	if cover != "" {
+		fmt.Fprintf(&desc, `<p><img src="%s" alt="" /></p>`, html.EscapeString(cover))
+	}
+	var credits []string
+	if resolved.Author != "" {
+		credits = append(credits, "by "+resolved.Author)
+	}
+	if resolved.Narrator != nil && *resolved.Narrator != "" {
+		credits = append(credits, "narrated by "+*resolved.Narrator)
+	}
+	if item.Duration != "" {
+		credits = append(credits, item.Duration)
+	}
+	if len(credits) > 0 {
+		fmt.Fprintf(&desc, "<p>%s</p>", html.EscapeString(strings.Join(credits, " · ")))
+	}
+	if resolved.Description != nil && *resolved.Description != "" {
+		fmt.Fprintf(&desc, "<p>%s</p>", html.EscapeString(*resolved.Description))
+	}
+	item.Description = desc.String()
+
+	return item
+}
+
+// feedCoverURL makes a cover URL usable from a feed reader: uploaded covers
+// and the server's copies of remote covers go through the token-authenticated
+// feed route.
+func feedCoverURL(audiobookID string, coverURL *string, base, token string) string {
+	if coverURL == nil || *coverURL == "" {
+		return ""
+	}
+	if *coverURL == audiobooks.CoverURL(audiobookID) || models.IsRemoteURL(*coverURL) {
+		return base + "/api/v1/feeds/audiobooks/" + url.PathEscape(audiobookID) + "/cover?token=" + url.QueryEscape(token)
+	}
+	return ""
+}
+
+// signedMediaURL links to a media file through the signed-token route, so
+// clients can fetch it without the API key.
+func signedMediaURL(base string, signer *auth.MediaSigner, fileID string, expires time.Time) string {
+	return base + "/api/v1/feeds/media_files/" + url.PathEscape(fileID) + "?token=" + url.QueryEscape(signer.Sign(fileID, expires))
+}
+
+// mediaFileSize returns the on-disk size of a media file user may stream, or
+// zero when the file is missing.
+func (h *handler) mediaFileSize(r *http.Request, user *models.User, fileID string) (int64, error) {
+	path, _, err := h.svc.MediaFileStream(r.Context(), fileID, user.ID, user.IsAdmin)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, nil
+	}
+	return info.Size(), nil
+}
+
+func writeFeed(w http.ResponseWriter, feed rssFeed, id string) {
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("rss feed %s: %v", id, err)
+	}
+}
+
+// formatFeedDuration renders seconds as H:MM:SS.
+func formatFeedDuration(seconds float64) string {
+	total := int(seconds + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+}
+
+// requestBaseURL reconstructs the scheme and host the client used, honouring
+// the forwarding headers set by reverse proxies.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
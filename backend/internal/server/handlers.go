@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,7 +14,10 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/lore/backend/internal/auth"
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/jobs"
 	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/services/library"
 )
 
 // Helper functions
@@ -37,6 +42,38 @@ func getPagination(r *http.Request) (offset, limit int) {
 	return offset, limit
 }
 
+// getSort reads the sort and order query parameters. sort must be one of
+// fields; order is asc or desc and defaults to asc. Without sort, the listing
+// keeps its own default order.
+func getSort(r *http.Request, fields []string) (models.Sort, error) {
+	var sort models.Sort
+	query := r.URL.Query()
+
+	field := strings.TrimSpace(query.Get("sort"))
+	if field != "" {
+		valid := false
+		for _, f := range fields {
+			if f == field {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return sort, fmt.Errorf("invalid sort %q (expected one of %s)", field, strings.Join(fields, ", "))
+		}
+		sort.Field = field
+	}
+
+	switch order := strings.ToLower(strings.TrimSpace(query.Get("order"))); order {
+	case "", "asc":
+	case "desc":
+		sort.Desc = true
+	default:
+		return sort, fmt.Errorf("invalid order %q (expected asc or desc)", order)
+	}
+	return sort, nil
+}
+
 type filesystemEntry struct {
 	Name     string `json:"name"`
 	Path     string `json:"path"`
@@ -45,13 +82,19 @@ type filesystemEntry struct {
 }
 
 func (s *handler) handleAvailableLibraries(w http.ResponseWriter, r *http.Request) {
-	libraries, err := s.librarySvc.GetLibraries(r.Context())
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	libraries, err := s.librarySvc.GetLibrariesForUser(r.Context(), user.ID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{"data": libraries})
+	respondJSONConditional(w, r, map[string]interface{}{"data": libraries})
 }
 
 func (s *handler) handlePublicLibraryDetails(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +104,22 @@ func (s *handler) handlePublicLibraryDetails(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+	// Restricted libraries are hidden from non-members as if they did not exist.
+	allowed, err := s.librarySvc.CanUserAccessLibrary(r.Context(), user.ID, libraryID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !allowed {
+		respondError(w, http.StatusNotFound, "library not found")
+		return
+	}
+
 	library, err := s.librarySvc.GetLibrary(r.Context(), libraryID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -104,7 +163,7 @@ func (s *handler) handleAdminLibraryPathCreate(w http.ResponseWriter, r *http.Re
 
 	libraryPath, err := s.librarySvc.CreateLibraryPath(r.Context(), req.Path, req.Name)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondLibraryPathError(w, err)
 		return
 	}
 
@@ -124,14 +183,58 @@ func (s *handler) handleAdminLibraryPathUpdate(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if path, ok := updates["path"]; ok {
+		if _, ok := path.(string); !ok {
+			respondError(w, http.StatusBadRequest, "path must be a string")
+			return
+		}
+	}
+
 	if err := s.librarySvc.UpdateLibraryPath(r.Context(), pathID, updates); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondLibraryPathError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleAdminLibraryPathValidate re-validates every library path, reporting
+// paths that went missing or overlap paths added before validation existed.
+func (s *handler) handleAdminLibraryPathValidate(w http.ResponseWriter, r *http.Request) {
+	validations, err := s.librarySvc.ValidateLibraryPaths(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	invalid := 0
+	for _, validation := range validations {
+		if !validation.Valid {
+			invalid++
+		}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data":    validations,
+		"invalid": invalid,
+	})
+}
+
+// respondLibraryPathError reports a path that failed validation as a 400
+// listing its problems.
+func respondLibraryPathError(w http.ResponseWriter, err error) {
+	var invalid *library.PathValidationError
+	if errors.As(err, &invalid) {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":      err.Error(),
+			"code":       apperrors.CodeValidation,
+			"status":     http.StatusBadRequest,
+			"validation": invalid.Validation,
+		})
+		return
+	}
+	respondError(w, http.StatusInternalServerError, err.Error())
+}
+
 func (s *handler) handleAdminLibraryPathDelete(w http.ResponseWriter, r *http.Request) {
 	pathID := chi.URLParam(r, "id")
 	if pathID == "" {
@@ -242,8 +345,9 @@ func (s *handler) handleAdminImportSettingsGet(w http.ResponseWriter, r *http.Re
 
 func (s *handler) handleAdminImportSettingsUpdate(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		DestinationPath string `json:"destination_path"`
-		Template        string `json:"template"`
+		DestinationPath       string `json:"destination_path"`
+		Template              string `json:"template"`
+		MergeReplaceOriginals bool   `json:"merge_replace_originals"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -257,9 +361,10 @@ func (s *handler) handleAdminImportSettingsUpdate(w http.ResponseWriter, r *http
 	}
 
 	settings := &models.ImportSettings{
-		ID:              "default",
-		DestinationPath: req.DestinationPath,
-		Template:        req.Template,
+		ID:                    "default",
+		DestinationPath:       req.DestinationPath,
+		Template:              req.Template,
+		MergeReplaceOriginals: req.MergeReplaceOriginals,
 	}
 
 	if err := s.importSvc.UpdateImportSettings(r.Context(), settings); err != nil {
@@ -294,17 +399,23 @@ func (s *handler) handleAdminLibraryCreate(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	settings, err := models.ParseLibrarySettings(req.Settings)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	library := &models.Library{
 		Name:        strings.TrimSpace(req.Name),
 		DisplayName: strings.TrimSpace(req.DisplayName),
 		Type:        strings.TrimSpace(req.Type),
 		Description: req.Description,
-		Settings:    req.Settings,
+		Settings:    settings,
 	}
 
 	created, err := s.librarySvc.CreateLibrary(r.Context(), library)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondLibraryError(w, err)
 		return
 	}
 
@@ -322,6 +433,23 @@ func (s *handler) handleAdminLibraryCreate(w http.ResponseWriter, r *http.Reques
 	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": created})
 }
 
+// handleAdminLibrarySettingsSchema describes library settings as a JSON
+// Schema for the admin UI's settings form.
+func (s *handler) handleAdminLibrarySettingsSchema(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": s.librarySvc.SettingsSchema()})
+}
+
+// respondLibraryError answers invalid library settings with a 400 and
+// other failures to create or update a library with a 500.
+func respondLibraryError(w http.ResponseWriter, err error) {
+	var validationErr *apperrors.ValidationError
+	if errors.As(err, &validationErr) {
+		handleError(w, err)
+		return
+	}
+	respondError(w, http.StatusInternalServerError, err.Error())
+}
+
 func (s *handler) handleAdminLibraryGet(w http.ResponseWriter, r *http.Request) {
 	libraryID := chi.URLParam(r, "id")
 	if libraryID == "" {
@@ -342,6 +470,54 @@ func (s *handler) handleAdminLibraryGet(w http.ResponseWriter, r *http.Request)
 	respondJSON(w, http.StatusOK, map[string]interface{}{"data": library})
 }
 
+type libraryAccessRequest struct {
+	Restricted bool     `json:"restricted"`
+	UserIDs    []string `json:"user_ids"`
+}
+
+func (s *handler) handleAdminLibraryAccessGet(w http.ResponseWriter, r *http.Request) {
+	access, err := s.librarySvc.GetLibraryAccess(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": access})
+}
+
+func (s *handler) handleAdminLibraryAccessSet(w http.ResponseWriter, r *http.Request) {
+	var req libraryAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	for _, userID := range req.UserIDs {
+		if _, err := s.authSvc.GetUserByID(r.Context(), userID); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				respondError(w, http.StatusBadRequest, "unknown user: "+userID)
+				return
+			}
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	access, err := s.librarySvc.SetLibraryAccess(r.Context(), chi.URLParam(r, "id"), req.Restricted, req.UserIDs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": access})
+}
+
 func (s *handler) handleAdminLibraryUpdate(w http.ResponseWriter, r *http.Request) {
 	libraryID := chi.URLParam(r, "id")
 	if libraryID == "" {
@@ -366,7 +542,12 @@ func (s *handler) handleAdminLibraryUpdate(w http.ResponseWriter, r *http.Reques
 		updates["type"] = strings.TrimSpace(*req.Type)
 	}
 	if req.Settings != nil {
-		updates["settings"] = *req.Settings
+		settings, err := models.ParseLibrarySettings(req.Settings)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		updates["settings"] = settings
 	}
 
 	var (
@@ -377,7 +558,7 @@ func (s *handler) handleAdminLibraryUpdate(w http.ResponseWriter, r *http.Reques
 	if len(updates) > 0 {
 		library, err = s.librarySvc.UpdateLibrary(r.Context(), libraryID, updates)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondLibraryError(w, err)
 			return
 		}
 	} else {
@@ -448,14 +629,19 @@ func (s *handler) handleAdminLibrarySetDirectories(w http.ResponseWriter, r *htt
 	respondJSON(w, http.StatusOK, map[string]interface{}{"data": library})
 }
 
+// handleAdminLibraryScanAll scans every library and responds with the
+// results. A scan of every library already running, e.g. the startup scan,
+// is joined rather than started again.
 func (s *handler) handleAdminLibraryScanAll(w http.ResponseWriter, r *http.Request) {
-	results, err := s.librarySvc.ScanAllLibraries(r.Context())
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	job, _ := s.jobs.Start(library.JobTypeScan, "all", func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.librarySvc.ScanAllLibraries(ctx)
+	})
+	job, ok := s.waitForJob(w, r, job)
+	if !ok {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": job.Result, "job_id": job.ID})
 }
 
 func (s *handler) handleAdminLibraryScanOne(w http.ResponseWriter, r *http.Request) {
@@ -465,7 +651,100 @@ func (s *handler) handleAdminLibraryScanOne(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	result, err := s.librarySvc.ScanLibrary(r.Context(), libID)
+	job, _ := s.jobs.Start(library.JobTypeScan, libID, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.librarySvc.ScanLibrary(ctx, libID)
+	})
+	job, ok := s.waitForJob(w, r, job)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": job.Result, "job_id": job.ID})
+}
+
+// waitForJob waits for a job a request started or joined. The job keeps
+// running if the client goes away. A failed job is answered with a 500.
+func (s *handler) waitForJob(w http.ResponseWriter, r *http.Request, job jobs.Job) (jobs.Job, bool) {
+	job, err := s.jobs.Wait(r.Context(), job.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return job, false
+	}
+	if job.Status == jobs.StatusFailed {
+		respondError(w, http.StatusInternalServerError, job.Error)
+		return job, false
+	}
+	return job, true
+}
+
+// handleAdminLibraryImportProgress seeds a user's progress from the progress
+// sidecars other players left in the library's audiobook folders. The user
+// defaults to the library's progress_import_user_id setting.
+func (s *handler) handleAdminLibraryImportProgress(w http.ResponseWriter, r *http.Request) {
+	libID := chi.URLParam(r, "id")
+	if libID == "" {
+		respondError(w, http.StatusBadRequest, "library ID is required")
+		return
+	}
+
+	var req progressImportRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	lib, err := s.librarySvc.GetLibrary(r.Context(), libID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	userID := strings.TrimSpace(req.UserID)
+	if userID == "" {
+		userID = strings.TrimSpace(lib.Settings.ProgressImportUserID)
+	}
+	if userID == "" {
+		respondError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+	if _, err := s.authSvc.GetUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			respondError(w, http.StatusBadRequest, "user not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := s.librarySvc.ImportProgress(r.Context(), libID, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": result})
+}
+
+// handleAdminLibraryReadSidecars re-reads the metadata sidecars in the
+// library's audiobook folders.
+func (s *handler) handleAdminLibraryReadSidecars(w http.ResponseWriter, r *http.Request) {
+	libID := chi.URLParam(r, "id")
+	if _, err := s.librarySvc.GetLibrary(r.Context(), libID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := s.librarySvc.ReadSidecarMetadata(r.Context(), libID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -597,8 +876,21 @@ func (s *handler) handleAdminImportExecute(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *handler) handleAdminImportHistory(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement persistent history
-	respondJSON(w, http.StatusOK, map[string]interface{}{"data": []interface{}{}})
+	offset, limit := getPagination(r)
+	jobs, total, err := s.importSvc.ListImportJobs(r.Context(), offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": jobs,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
 }
 
 func (s *handler) handleAdminImportJob(w http.ResponseWriter, r *http.Request) {
@@ -608,5 +900,15 @@ func (s *handler) handleAdminImportJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondError(w, http.StatusNotFound, "job not found")
+	job, err := s.importSvc.GetImportJob(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": job})
 }
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/lore/backend/internal/httpclient"
+	"github.com/lore/backend/internal/media"
+)
+
+// Overall and per-check readiness states.
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+)
+
+// readinessTimeout bounds the database queries of a readiness check.
+const readinessTimeout = 2 * time.Second
+
+type readinessResponse struct {
+	// Status is ok, degraded (the server works but a library path or
+	// provider is unreachable) or unavailable (the database is down).
+	Status       string             `json:"status"`
+	Database     string             `json:"database"`
+	Media        mediaHealth        `json:"media"`
+	LibraryPaths libraryPathsHealth `json:"library_paths"`
+	Providers    providersHealth    `json:"providers"`
+	CheckedAt    time.Time          `json:"checked_at"`
+}
+
+type mediaHealth struct {
+	// Prober names the implementation reading durations and tags:
+	// "ffprobe" or "native".
+	Prober string `json:"prober"`
+	// FFprobe reports whether ffprobe is installed; without it the
+	// built-in parser is used.
+	FFprobe bool `json:"ffprobe"`
+	// Transcoding reports whether ffmpeg is installed to transcode streams
+	// and merge M4Bs.
+	Transcoding bool `json:"transcoding"`
+}
+
+type libraryPathsHealth struct {
+	Status string `json:"status"`
+	// Enabled counts the enabled library paths; Inaccessible those that
+	// are missing, unreadable or not directories.
+	Enabled      int `json:"enabled"`
+	Inaccessible int `json:"inaccessible"`
+}
+
+type providersHealth struct {
+	Status string `json:"status"`
+	// Unreachable lists provider hosts whose circuit breaker is open after
+	// repeated failures.
+	Unreachable []string `json:"unreachable"`
+}
+
+// handleHealthz is the liveness probe: it answers as long as the process can
+// serve requests, without touching the database.
+func (s *handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": healthOK})
+}
+
+// handleReadyz is the readiness probe. It reports database connectivity,
+// media tools, library path accessibility and metadata provider
+// reachability, and fails with 503 only when the database is unreachable.
+// Neither probe needs authentication, so load balancers and container
+// runtimes can poll them.
+func (s *handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := readinessResponse{
+		Status:   healthOK,
+		Database: healthOK,
+		Media: mediaHealth{
+			FFprobe:     media.FFprobeAvailable(),
+			Transcoding: media.TranscoderAvailable(),
+		},
+		LibraryPaths: s.libraryPathsHealth(ctx),
+		Providers:    providersReachability(),
+		CheckedAt:    time.Now().UTC(),
+	}
+	if s.prober != nil {
+		resp.Media.Prober = s.prober.Name()
+	}
+	if resp.LibraryPaths.Status != healthOK || resp.Providers.Status != healthOK {
+		resp.Status = healthDegraded
+	}
+
+	status := http.StatusOK
+	if err := s.svc.Ping(ctx); err != nil {
+		resp.Status = healthUnavailable
+		resp.Database = healthUnavailable
+		status = http.StatusServiceUnavailable
+	}
+	respondJSON(w, status, resp)
+}
+
+// libraryPathsHealth checks that every enabled library path is a readable
+// directory. Paths are counted rather than listed since the probe is public.
+func (s *handler) libraryPathsHealth(ctx context.Context) libraryPathsHealth {
+	health := libraryPathsHealth{Status: healthOK}
+	paths, err := s.librarySvc.ListLibraryPaths(ctx)
+	if err != nil {
+		health.Status = healthUnavailable
+		return health
+	}
+
+	for _, p := range paths {
+		if !p.Enabled {
+			continue
+		}
+		health.Enabled++
+		if ctx.Err() != nil || !readableDir(p.Path) {
+			health.Inaccessible++
+		}
+	}
+	if health.Inaccessible > 0 {
+		health.Status = healthDegraded
+	}
+	return health
+}
+
+func readableDir(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.IsDir()
+}
+
+// providersReachability reports provider hosts with an open circuit breaker.
+// It relies on the outbound client's recent results instead of calling the
+// providers, so frequent probes add no load on them.
+func providersReachability() providersHealth {
+	health := providersHealth{Status: healthOK, Unreachable: []string{}}
+	seen := make(map[string]bool)
+	for _, host := range httpclient.Stats() {
+		if host.Breaker == httpclient.BreakerOpen && !seen[host.Host] {
+			seen[host.Host] = true
+			health.Unreachable = append(health.Unreachable, host.Host)
+		}
+	}
+	if len(health.Unreachable) > 0 {
+		health.Status = healthDegraded
+	}
+	return health
+}
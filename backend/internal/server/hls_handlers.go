@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/services/audiobooks"
+)
+
+// hlsTokenTTL is how long the signed token of an HLS playlist lasts; a
+// player refetches segments with it for as long as the book plays.
+const hlsTokenTTL = 24 * time.Hour
+
+// handleHLSPlaylist serves an audiobook as an HLS media playlist of
+// fixed-length segments, which Safari and iOS play natively and which
+// players retry segment by segment on flaky networks. Segment URIs carry a
+// token, so they load without the Authorization header.
+func (h *handler) handleHLSPlaylist(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	manifest, ok := h.playbackManifest(w, r, user)
+	if !ok {
+		return
+	}
+	if !h.svc.HLSAvailable(manifest) {
+		respondError(w, http.StatusConflict, audiobooks.ErrHLSUnavailable.Error())
+		return
+	}
+
+	// A playlist loaded with a token hands the same token to its segments,
+	// so a token limited to one book or expiring soon stays that way.
+	token := r.URL.Query().Get("token")
+	if token == "" || r.Header.Get("Authorization") != "" {
+		var err error
+		if token, err = h.hlsToken(r, user, manifest.AudiobookID); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+	playlist := media.HLSPlaylist(manifest.DurationSec, func(i int) string {
+		return strconv.Itoa(i) + ".ts?token=" + url.QueryEscape(token)
+	})
+
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	w.Header().Set("Content-Type", media.HLSMimeType)
+	w.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.WriteString(rw, playlist)
+	}
+	h.recordDownload(r, user, models.DownloadKindStream, &manifest.AudiobookID, nil, rw)
+}
+
+// handleHLSSegment serves one segment of an audiobook's HLS playlist,
+// cutting it with ffmpeg on first request.
+func (h *handler) handleHLSSegment(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	manifest, ok := h.playbackManifest(w, r, user)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil || index < 0 || index >= media.HLSSegmentCount(manifest.DurationSec) {
+		respondError(w, http.StatusNotFound, "segment not found")
+		return
+	}
+
+	path, err := h.svc.HLSSegment(r.Context(), manifest, index)
+	switch {
+	case err == nil:
+	case errors.Is(err, audiobooks.ErrHLSUnavailable):
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, context.Canceled):
+		return
+	default:
+		log.Printf("hls segment %d of %s: %v", index, manifest.AudiobookID, err)
+		respondError(w, http.StatusInternalServerError, "failed to prepare segment")
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to open segment")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to open segment")
+		return
+	}
+
+	w.Header().Set("Content-Type", media.HLSSegmentMimeType)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// hlsToken signs a token for user to stream the audiobook as HLS.
+func (h *handler) hlsToken(r *http.Request, user *models.User, audiobookID string) (string, error) {
+	signer, err := h.authSvc.MediaSigner(r.Context(), user.ID)
+	if err != nil {
+		return "", err
+	}
+	return signer.SignAudiobook(audiobookID, time.Now().Add(hlsTokenTTL)), nil
+}
+
+// hlsURL returns the signed address of the audiobook's HLS playlist.
+func (h *handler) hlsURL(r *http.Request, user *models.User, audiobookID string) (string, error) {
+	token, err := h.hlsToken(r, user, audiobookID)
+	if err != nil {
+		return "", err
+	}
+	return requestBaseURL(r) + "/api/v1/hls/" + url.PathEscape(audiobookID) + "/playlist.m3u8?token=" + url.QueryEscape(token), nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// handleRegister creates an account from an invite token or, when
+// self-registration is enabled, without one. It answers like a login, except
+// for accounts that must wait for an admin's approval: those get 202 Accepted
+// and no API key.
+func (h *handler) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		InviteToken string `json:"invite_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" {
+		respondError(w, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	user, err := h.authSvc.Register(r.Context(), req.Username, req.Password, req.InviteToken)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if user.PendingApproval {
+		respondJSON(w, http.StatusAccepted, map[string]interface{}{
+			"data": map[string]interface{}{
+				"user": map[string]interface{}{
+					"id":               user.ID,
+					"username":         user.Username,
+					"is_admin":         user.IsAdmin,
+					"pending_approval": true,
+				},
+			},
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": map[string]interface{}{
+			"user": map[string]interface{}{
+				"id":       user.ID,
+				"username": user.Username,
+				"is_admin": user.IsAdmin,
+			},
+			"api_key": *user.APIKey,
+		},
+	})
+}
+
+// handleAdminInviteCreate issues an invite token, optionally making its user
+// a member of some libraries.
+func (h *handler) handleAdminInviteCreate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		LibraryIDs     []string `json:"library_ids"`
+		ExpiresInHours int      `json:"expires_in_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.ExpiresInHours < 0 {
+		respondError(w, http.StatusBadRequest, "expires_in_hours must be positive")
+		return
+	}
+
+	for _, libraryID := range req.LibraryIDs {
+		if _, err := h.librarySvc.GetLibrary(r.Context(), libraryID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, http.StatusNotFound, "library not found: "+libraryID)
+				return
+			}
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	ttl := time.Duration(req.ExpiresInHours) * time.Hour
+	invite, err := h.authSvc.CreateInvite(r.Context(), user.ID, req.LibraryIDs, ttl)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": invite})
+}
+
+func (h *handler) handleAdminInviteList(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.authSvc.ListInvites(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": invites})
+}
+
+func (h *handler) handleAdminInviteDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.authSvc.DeleteInvite(r.Context(), chi.URLParam(r, "invite_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "invite not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleAdminRegistrationGet(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.authSvc.RegistrationSettings(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": settings})
+}
+
+// handleAdminRegistrationUpdate changes the fields present in the request
+// and saves the self-registration policy.
+func (h *handler) handleAdminRegistrationUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Open            *bool     `json:"open"`
+		RequireApproval *bool     `json:"require_approval"`
+		DefaultRole     *string   `json:"default_role"`
+		LibraryIDs      *[]string `json:"library_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	settings, err := h.authSvc.RegistrationSettings(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Open != nil {
+		settings.Open = *req.Open
+	}
+	if req.RequireApproval != nil {
+		settings.RequireApproval = *req.RequireApproval
+	}
+	if req.DefaultRole != nil {
+		switch role := strings.TrimSpace(*req.DefaultRole); role {
+		case models.RoleAdmin, models.RoleUser:
+			settings.DefaultRole = role
+		default:
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid default_role %q (expected %s or %s)", role, models.RoleAdmin, models.RoleUser))
+			return
+		}
+	}
+	if req.LibraryIDs != nil {
+		for _, libraryID := range *req.LibraryIDs {
+			if _, err := h.librarySvc.GetLibrary(r.Context(), libraryID); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					respondError(w, http.StatusNotFound, "library not found: "+libraryID)
+					return
+				}
+				respondError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		settings.LibraryIDs = *req.LibraryIDs
+	}
+	// Otherwise anyone could sign up as an admin.
+	if settings.DefaultRole == models.RoleAdmin && !settings.RequireApproval {
+		respondError(w, http.StatusBadRequest, "default_role admin requires require_approval")
+		return
+	}
+
+	if err := h.authSvc.UpdateRegistrationSettings(r.Context(), settings); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": settings})
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRegistrationRefusesUnapprovedAdminRole(t *testing.T) {
+	srv, apiKey := newTestServer(t)
+
+	put := func(body string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/api/v1/admin/registration", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := put(`{"open": true, "require_approval": false, "default_role": "admin"}`); code != http.StatusBadRequest {
+		t.Errorf("open admin sign-ups: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := put(`{"open": true, "require_approval": true, "default_role": "admin"}`); code != http.StatusOK {
+		t.Fatalf("approved admin sign-ups: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := put(`{"require_approval": false}`); code != http.StatusBadRequest {
+		t.Errorf("dropping approval with an admin default role: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestInviteJoinsRestrictedLibraries(t *testing.T) {
+	srv, adminKey := newTestServer(t)
+
+	call := func(method, path, apiKey, body string, out interface{}) int {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+"/api/v1"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+	register := func(username, invitedTo string) string {
+		t.Helper()
+		var invite struct {
+			Data struct {
+				Token string `json:"token"`
+			} `json:"data"`
+		}
+		if code := call(http.MethodPost, "/admin/invites", adminKey, `{"library_ids": [`+invitedTo+`]}`, &invite); code != http.StatusCreated {
+			t.Fatalf("create invite: status = %d", code)
+		}
+		var registered struct {
+			Data struct {
+				APIKey string `json:"api_key"`
+			} `json:"data"`
+		}
+		body := `{"username": "` + username + `", "password": "password123", "invite_token": "` + invite.Data.Token + `"}`
+		if code := call(http.MethodPost, "/auth/register", "", body, &registered); code != http.StatusCreated {
+			t.Fatalf("register %s: status = %d", username, code)
+		}
+		return registered.Data.APIKey
+	}
+	libraryIDs := func(apiKey string) []string {
+		t.Helper()
+		var libraries struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if code := call(http.MethodGet, "/libraries", apiKey, "", &libraries); code != http.StatusOK {
+			t.Fatalf("list libraries: status = %d", code)
+		}
+		var ids []string
+		for _, library := range libraries.Data {
+			ids = append(ids, library.ID)
+		}
+		return ids
+	}
+
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if code := call(http.MethodPost, "/admin/libraries", adminKey, `{"name": "kids", "display_name": "Kids"}`, &created); code != http.StatusCreated {
+		t.Fatalf("create library: status = %d", code)
+	}
+	libraryID := created.Data.ID
+	if code := call(http.MethodPut, "/admin/libraries/"+libraryID+"/access", adminKey, `{"restricted": true}`, nil); code != http.StatusOK {
+		t.Fatalf("restrict library: status = %d", code)
+	}
+	if code := call(http.MethodPost, "/admin/invites", adminKey, `{"library_ids": ["missing"]}`, nil); code != http.StatusNotFound {
+		t.Errorf("invite to an unknown library: status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	memberKey := register("alice", `"`+libraryID+`"`)
+	otherKey := register("bob", "")
+
+	if got := libraryIDs(memberKey); len(got) != 1 || got[0] != libraryID {
+		t.Errorf("invited member sees libraries %v, want [%s]", got, libraryID)
+	}
+	if got := libraryIDs(otherKey); len(got) != 0 {
+		t.Errorf("other user sees libraries %v, want none", got)
+	}
+	if code := call(http.MethodGet, "/libraries/"+libraryID, otherKey, "", nil); code != http.StatusNotFound {
+		t.Errorf("other user opening the library: status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	var access struct {
+		Data struct {
+			Restricted bool     `json:"restricted"`
+			UserIDs    []string `json:"user_ids"`
+		} `json:"data"`
+	}
+	if code := call(http.MethodGet, "/admin/libraries/"+libraryID+"/access", adminKey, "", &access); code != http.StatusOK {
+		t.Fatalf("get library access: status = %d", code)
+	}
+	if !access.Data.Restricted || len(access.Data.UserIDs) != 1 {
+		t.Errorf("library access = %+v, want restricted with one member", access.Data)
+	}
+
+	// New accounts also join the registration settings' libraries.
+	if code := call(http.MethodPut, "/admin/registration", adminKey, `{"library_ids": ["missing"]}`, nil); code != http.StatusNotFound {
+		t.Errorf("registration default of an unknown library: status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := call(http.MethodPut, "/admin/registration", adminKey, `{"library_ids": ["`+libraryID+`"]}`, nil); code != http.StatusOK {
+		t.Fatalf("set registration libraries: status = %d", code)
+	}
+	if got := libraryIDs(register("carol", "")); len(got) != 1 || got[0] != libraryID {
+		t.Errorf("new account sees libraries %v, want the registration default [%s]", got, libraryID)
+	}
+}
@@ -1,12 +1,19 @@
 package server
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
 )
 
 func (h *handler) handleLibraryBooksList(w http.ResponseWriter, r *http.Request) {
@@ -28,19 +35,27 @@ func (h *handler) handleLibraryBooksList(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	audiobooks, total, err := h.svc.ListLibraryBooks(r.Context(), user.ID, libraryID, offset, limit)
+	filter, err := h.parseAudiobookFilter(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	cursorMode, err := parseBookCursor(r, &filter)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	audiobooks, total, err := h.svc.ListLibraryBooks(r.Context(), user.ID, libraryID, filter, offset, bookPageFetch(cursorMode, limit))
 	if err != nil {
 		handleError(w, apperrors.Wrap(err, "failed to list library books"))
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"data": audiobooks,
-		"pagination": map[string]interface{}{
-			"offset": offset,
-			"limit":  limit,
-			"total":  total,
-		},
+	audiobooks, pagination := bookPage(audiobooks, filter, cursorMode, offset, limit, total)
+	respondJSONConditional(w, r, map[string]interface{}{
+		"data":       shapeAudiobooks(r, audiobooks),
+		"pagination": pagination,
 	})
 }
 
@@ -69,7 +84,51 @@ func (h *handler) handleLibraryBookGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{"data": audiobook})
+	respondJSONConditional(w, r, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
+}
+
+// handleLibraryBookSimilar lists other books in the same series, by the same
+// author and read by the same narrator as a library book.
+func (h *handler) handleLibraryBookSimilar(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		handleError(w, apperrors.ErrUnauthorized)
+		return
+	}
+
+	libraryID := chi.URLParam(r, "library_id")
+	if libraryID == "" {
+		handleError(w, apperrors.NewValidationError("library_id", "library id is required", ""))
+		return
+	}
+
+	audiobookID := chi.URLParam(r, "book_id")
+	if err := h.validator.ValidateAudiobookID(audiobookID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// Default to 10 books per relation
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 || parsedLimit > 50 {
+			handleError(w, apperrors.NewValidationError("limit", "invalid limit value (must be 1-50)", limitStr))
+			return
+		}
+		limit = parsedLimit
+	}
+
+	similar, err := h.svc.GetSimilarBooks(r.Context(), libraryID, audiobookID, user.ID, limit)
+	if err != nil {
+		handleError(w, apperrors.Wrap(err, "failed to fetch similar books"))
+		return
+	}
+	similar.SameSeries = shapeAudiobooks(r, similar.SameSeries)
+	similar.SameAuthor = shapeAudiobooks(r, similar.SameAuthor)
+	similar.SameNarrator = shapeAudiobooks(r, similar.SameNarrator)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": similar})
 }
 
 func (h *handler) handleLibraryBooksSearch(w http.ResponseWriter, r *http.Request) {
@@ -97,14 +156,71 @@ func (h *handler) handleLibraryBooksSearch(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	audiobooks, total, err := h.svc.SearchLibraryBooks(r.Context(), user.ID, libraryID, query, offset, limit)
+	filter, err := h.parseAudiobookFilter(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	cursorMode, err := parseBookCursor(r, &filter)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	audiobooks, total, err := h.svc.SearchLibraryBooks(r.Context(), user.ID, libraryID, query, filter, offset, bookPageFetch(cursorMode, limit))
 	if err != nil {
 		handleError(w, apperrors.Wrap(err, "failed to search library books"))
 		return
 	}
 
+	audiobooks, pagination := bookPage(audiobooks, filter, cursorMode, offset, limit, total)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       shapeAudiobooks(r, audiobooks),
+		"pagination": pagination,
+	})
+}
+
+// handleLibraryGenres lists the genres in a library with the number of books
+// visible to the caller in each.
+func (h *handler) handleLibraryGenres(w http.ResponseWriter, r *http.Request) {
+	user, libraryID, ok := h.browseLibrary(w, r)
+	if !ok {
+		return
+	}
+
+	genres, err := h.svc.ListLibraryGenres(r.Context(), user.ID, libraryID)
+	if err != nil {
+		handleError(w, apperrors.Wrap(err, "failed to list library genres"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": genres})
+}
+
+// handleLibraryActivity lists a library's activity feed, newest first:
+// books added, metadata updates and the books finished by the caller and by
+// users who share their activity. ?type= narrows it to one kind, e.g.
+// book.finished for the books recently finished.
+func (h *handler) handleLibraryActivity(w http.ResponseWriter, r *http.Request) {
+	user, libraryID, ok := h.browseLibrary(w, r)
+	if !ok {
+		return
+	}
+
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	activity, total, err := h.svc.ListLibraryActivity(r.Context(), user.ID, libraryID, r.URL.Query().Get("type"), offset, limit)
+	if err != nil {
+		handleError(w, apperrors.Wrap(err, "failed to list library activity"))
+		return
+	}
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"data": audiobooks,
+		"data": activity,
 		"pagination": map[string]interface{}{
 			"offset": offset,
 			"limit":  limit,
@@ -113,6 +229,168 @@ func (h *handler) handleLibraryBooksSearch(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// handleLibraryNarrators lists the narrators in a library with the number of
+// books visible to the caller for each.
+func (h *handler) handleLibraryNarrators(w http.ResponseWriter, r *http.Request) {
+	user, libraryID, ok := h.browseLibrary(w, r)
+	if !ok {
+		return
+	}
+
+	narrators, err := h.svc.ListLibraryNarrators(r.Context(), user.ID, libraryID)
+	if err != nil {
+		handleError(w, apperrors.Wrap(err, "failed to list library narrators"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": narrators})
+}
+
+// handleSearch searches every library the user can see for a universal
+// search bar, grouping matches into books, authors and series.
+func (h *handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		handleError(w, apperrors.ErrUnauthorized)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if err := h.validator.ValidateSearchQuery(query); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > 50 {
+			handleError(w, apperrors.NewValidationError("limit", "invalid limit value (must be 1-50)", limitStr))
+			return
+		}
+		limit = parsed
+	}
+
+	results, err := h.svc.Search(r.Context(), user.ID, query, limit)
+	if err != nil {
+		handleError(w, apperrors.Wrap(err, "failed to search libraries"))
+		return
+	}
+	results.Books = shapeAudiobooks(r, results.Books)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": results})
+}
+
+// handleLibraryLetters returns the A–Z index of a library for jumping
+// through the listing: each letter with its book count and the offset of its
+// first book. It takes the listing's genre and narrator filters and a title
+// (default) or author sort.
+func (h *handler) handleLibraryLetters(w http.ResponseWriter, r *http.Request) {
+	user, libraryID, ok := h.browseLibrary(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := h.parseAudiobookFilter(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	switch filter.Sort {
+	case "":
+		filter.Sort = models.SortTitle
+	case models.SortTitle, models.SortAuthor:
+	default:
+		handleError(w, apperrors.NewValidationError("sort", "the index is only available for title and author order", filter.Sort))
+		return
+	}
+
+	letters, err := h.svc.ListLibraryLetters(r.Context(), user.ID, libraryID, filter)
+	if err != nil {
+		handleError(w, apperrors.Wrap(err, "failed to list library letters"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": letters})
+}
+
+// browseLibrary resolves the caller and the library for the browse endpoints,
+// writing an error response and returning false when either is missing.
+func (h *handler) browseLibrary(w http.ResponseWriter, r *http.Request) (*models.User, string, bool) {
+	user := getUserFromContext(r)
+	if user == nil {
+		handleError(w, apperrors.ErrUnauthorized)
+		return nil, "", false
+	}
+
+	libraryID := chi.URLParam(r, "library_id")
+	if libraryID == "" {
+		handleError(w, apperrors.NewValidationError("library_id", "library id is required", ""))
+		return nil, "", false
+	}
+
+	if _, err := h.librarySvc.GetLibrary(r.Context(), libraryID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return nil, "", false
+		}
+		handleError(w, apperrors.Wrap(err, "failed to load library"))
+		return nil, "", false
+	}
+
+	return user, libraryID, true
+}
+
+// parseAudiobookFilter reads the optional listing filters (genre, narrator,
+// series, custom fields) and sort order from the query string. Custom fields are
+// filtered with field.<key>=value, or field.<key>.min and field.<key>.max
+// for number and date ranges.
+func (h *handler) parseAudiobookFilter(r *http.Request) (models.AudiobookFilter, error) {
+	query := r.URL.Query()
+	filter := models.AudiobookFilter{
+		Genre:    strings.TrimSpace(query.Get("genre")),
+		Narrator: strings.TrimSpace(query.Get("narrator")),
+		Series:   strings.TrimSpace(query.Get("series")),
+		Sort:     strings.TrimSpace(query.Get("sort")),
+	}
+	if filter.Sort != "" {
+		valid := false
+		for _, order := range models.AudiobookSortOrders {
+			if order == filter.Sort {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return filter, apperrors.NewValidationError("sort", "invalid sort (expected one of "+strings.Join(models.AudiobookSortOrders, ", ")+")", filter.Sort)
+		}
+	}
+
+	for param, values := range query {
+		key, ok := strings.CutPrefix(param, "field.")
+		if !ok {
+			continue
+		}
+		op := models.FilterEqual
+		if base, bound, found := strings.Cut(key, "."); found {
+			if bound != models.FilterAtLeast && bound != models.FilterAtMost {
+				return filter, apperrors.NewValidationError(param, "invalid custom field filter (expected field.<key>, field.<key>.min or field.<key>.max)", values[0])
+			}
+			key, op = base, bound
+		}
+		filter.CustomFields = append(filter.CustomFields, models.CustomFieldFilter{Key: key, Op: op, Value: values[0]})
+	}
+	// Query parameters come in random order; a stable order keeps cache
+	// keys equal for equal filters.
+	sort.Slice(filter.CustomFields, func(i, j int) bool {
+		a, b := filter.CustomFields[i], filter.CustomFields[j]
+		return a.Key < b.Key || (a.Key == b.Key && a.Op < b.Op)
+	})
+	var err error
+	filter.CustomFields, err = h.svc.CustomFieldFilters(r.Context(), filter.CustomFields)
+	return filter, err
+}
+
 func parsePagination(r *http.Request) (int, int, error) {
 	offsetStr := r.URL.Query().Get("offset")
 	limitStr := r.URL.Query().Get("limit")
@@ -136,3 +414,90 @@ func parsePagination(r *http.Request) (int, int, error) {
 
 	return offset, limit, nil
 }
+
+// parseBookCursor reads the cursor parameter into filter. Its presence,
+// even empty for the first page, switches a listing from offset to cursor
+// pagination, which pages through books newest first and so stays stable
+// while a scan adds books.
+func parseBookCursor(r *http.Request, filter *models.AudiobookFilter) (bool, error) {
+	query := r.URL.Query()
+	if !query.Has("cursor") {
+		return false, nil
+	}
+	if query.Get("offset") != "" {
+		return false, apperrors.NewValidationError("offset", "offset cannot be combined with cursor", query.Get("offset"))
+	}
+	switch filter.Sort {
+	case "":
+		filter.Sort = models.SortRecentlyAdded
+	case models.SortRecentlyAdded:
+	default:
+		return false, apperrors.NewValidationError("sort", "cursor pagination requires sort "+models.SortRecentlyAdded, filter.Sort)
+	}
+
+	raw := query.Get("cursor")
+	if raw == "" {
+		return true, nil
+	}
+	cursor, err := decodeBookCursor(raw)
+	if err != nil {
+		return false, apperrors.NewValidationError("cursor", "invalid cursor", raw)
+	}
+	filter.After = cursor
+	return true, nil
+}
+
+// bookPageFetch returns how many books to fetch for a page of limit. Cursor
+// pages fetch one extra to learn whether another page follows.
+func bookPageFetch(cursorMode bool, limit int) int {
+	if cursorMode {
+		return limit + 1
+	}
+	return limit
+}
+
+// bookPage trims books to the page and builds its pagination envelope.
+// next_cursor continues a listing sorted by date added, in either mode, and
+// is null on the last page or for other sort orders.
+func bookPage(books []models.Audiobook, filter models.AudiobookFilter, cursorMode bool, offset, limit, total int) ([]models.Audiobook, map[string]interface{}) {
+	more := offset+len(books) < total
+	if cursorMode {
+		more = len(books) > limit
+		books = books[:min(len(books), limit)]
+	}
+
+	var next interface{}
+	if more && len(books) > 0 && filter.Sort == models.SortRecentlyAdded {
+		next = encodeBookCursor(books[len(books)-1])
+	}
+	pagination := map[string]interface{}{
+		"limit":       limit,
+		"total":       total,
+		"next_cursor": next,
+	}
+	if !cursorMode {
+		pagination["offset"] = offset
+	}
+	return books, pagination
+}
+
+// encodeBookCursor returns the opaque cursor for the page after book.
+func encodeBookCursor(book models.Audiobook) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(book.CreatedAt.UTC().Format(time.RFC3339) + "|" + book.ID))
+}
+
+func decodeBookCursor(s string) (models.BookCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return models.BookCursor{}, err
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return models.BookCursor{}, errors.New("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return models.BookCursor{}, err
+	}
+	return models.BookCursor{CreatedAt: t, ID: id}, nil
+}
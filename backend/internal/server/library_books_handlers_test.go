@@ -0,0 +1,48 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+func TestParseBookCursor(t *testing.T) {
+	cursor := encodeBookCursor(models.Audiobook{ID: "book-2", CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)})
+	tests := []struct {
+		query  string
+		cursor bool
+		field  string
+	}{
+		{query: "", cursor: false},
+		{query: "?cursor=", cursor: true},
+		{query: "?cursor=" + cursor, cursor: true},
+		{query: "?cursor=" + cursor + "&offset=20", field: "offset"},
+		{query: "?cursor=&offset=0", field: "offset"},
+		{query: "?cursor=&sort=title", field: "sort"},
+		{query: "?cursor=not-a-cursor", field: "cursor"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/libraries/lib-1/books"+tt.query, nil)
+		filter := models.AudiobookFilter{Sort: req.URL.Query().Get("sort")}
+		cursorMode, err := parseBookCursor(req, &filter)
+		if tt.field != "" {
+			var validationErr *apperrors.ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+				t.Errorf("%s: error = %v, want a validation error on %s", tt.query, err, tt.field)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if cursorMode != tt.cursor {
+			t.Errorf("%s: cursor mode = %v, want %v", tt.query, cursorMode, tt.cursor)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/services/audiobooks"
 )
 
 // Library handlers (personal collection)
@@ -21,14 +23,19 @@ func (h *handler) handleLibraryList(w http.ResponseWriter, r *http.Request) {
 
 	offset, limit := getPagination(r)
 	libraryID := strings.TrimSpace(r.URL.Query().Get("library_id"))
-	audiobooks, total, err := h.svc.ListUserLibrary(r.Context(), user.ID, libraryID, offset, limit)
+	filter, err := h.parseAudiobookFilter(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	audiobooks, total, err := h.svc.ListUserLibrary(r.Context(), user.ID, libraryID, filter, offset, limit)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"data": audiobooks,
+	respondJSONConditional(w, r, map[string]interface{}{
+		"data": shapeAudiobooks(r, audiobooks),
 		"pagination": map[string]interface{}{
 			"offset": offset,
 			"limit":  limit,
@@ -54,7 +61,7 @@ func (h *handler) handleLibraryGet(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]interface{}{"data": audiobook})
+	respondJSONConditional(w, r, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
 }
 
 
@@ -83,10 +90,51 @@ func (h *handler) handleLibraryProgress(w http.ResponseWriter, r *http.Request)
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message":   "Progress updated successfully.",
-		"user_data": data,
-	})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+// maxBeaconBytes bounds the body of a progress beacon.
+const maxBeaconBytes = 4 << 10
+
+// handleLibraryProgressBeacon accepts a progress checkpoint sent the way
+// navigator.sendBeacon does, as a page or app is closed: the body is JSON
+// whatever its Content-Type, and since a beacon cannot set headers the API
+// key may come as "token" in the body instead of an Authorization header.
+// An Idempotency-Key header overrides the body's idempotency_key. The
+// checkpoint is recorded like any progress update, buffered only when
+// PROGRESS_FLUSH_SECONDS is set, and the response is an empty 202.
+func (h *handler) handleLibraryProgressBeacon(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		audiobooks.Checkpoint
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBeaconBytes)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		req.IdempotencyKey = key
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" && req.Token != "" {
+		authHeader = "Bearer " + req.Token
+	}
+	user, err := h.authSvc.Authenticate(r.Context(), authHeader)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+
+	if err := h.svc.Checkpoint(r.Context(), user.ID, chi.URLParam(r, "audiobook_id"), req.Checkpoint); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found in library")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
 }
 
 func (h *handler) handleLibraryFavorite(w http.ResponseWriter, r *http.Request) {
@@ -114,7 +162,7 @@ func (h *handler) handleLibraryFavorite(w http.ResponseWriter, r *http.Request)
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]interface{}{"user_data": data})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": data})
 }
 
 func (h *handler) handleLibraryFavorites(w http.ResponseWriter, r *http.Request) {
@@ -139,7 +187,7 @@ func (h *handler) handleLibraryFavorites(w http.ResponseWriter, r *http.Request)
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"data": audiobooks,
+		"data": shapeAudiobooks(r, audiobooks),
 		"pagination": map[string]interface{}{
 			"offset": offset,
 			"limit":  limit,
@@ -176,6 +224,73 @@ func (h *handler) handleLibraryContinue(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, audiobooks)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": shapeAudiobooks(r, audiobooks)})
+}
+
+// handleRecommendations suggests unstarted books based on the user's
+// finished and favourite books, with the reasons behind each suggestion.
+func (h *handler) handleRecommendations(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var libraryRef *string
+	if libraryID := strings.TrimSpace(r.URL.Query().Get("library_id")); libraryID != "" {
+		libraryRef = &libraryID
+	}
+
+	// Default to 20 recommendations
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 50 {
+			limit = parsedLimit
+		}
+	}
+
+	recommendations, err := h.svc.GetRecommendations(r.Context(), user.ID, libraryRef, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range recommendations {
+		shapeAudiobook(r, &recommendations[i].Audiobook)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": recommendations})
 }
 
+// handleHome returns the home screen rows in one response: continue
+// listening, recently added, next in series and favorites.
+func (h *handler) handleHome(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var libraryRef *string
+	if libraryID := strings.TrimSpace(r.URL.Query().Get("library_id")); libraryID != "" {
+		libraryRef = &libraryID
+	}
+
+	// Default to 10 books per row
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 50 {
+			limit = parsedLimit
+		}
+	}
+
+	rows, err := h.svc.Home(r.Context(), user.ID, libraryRef, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range rows {
+		rows[i].Books = shapeAudiobooks(r, rows[i].Books)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"rows": rows}})
+}
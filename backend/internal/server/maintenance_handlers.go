@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/httpclient"
+	"github.com/lore/backend/internal/jobs"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/perf"
+	"github.com/lore/backend/internal/services/audiobooks"
+	importservice "github.com/lore/backend/internal/services/import"
+)
+
+const (
+	jobTypeResolveMetadata = "resolve_metadata"
+	jobTypeDetectMime      = "detect_mime"
+	jobTypeOrganize        = "organize"
+	jobTypeMergeM4B        = "merge_m4b"
+	jobTypeWriteTags       = "write_tags"
+	jobTypeBulkAudiobooks  = "bulk_audiobooks"
+)
+
+type resolveMetadataRequest struct {
+	LibraryIDs []string `json:"library_ids"`
+}
+
+type resolveMetadataResult struct {
+	Processed int `json:"processed"`
+}
+
+// handleAdminResolveMetadata queues a background rebuild of the resolved
+// metadata snapshots for all or selected libraries.
+func (s *handler) handleAdminResolveMetadata(w http.ResponseWriter, r *http.Request) {
+	var req resolveMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	for _, libraryID := range req.LibraryIDs {
+		if _, err := s.librarySvc.GetLibrary(r.Context(), libraryID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, http.StatusNotFound, "library not found: "+libraryID)
+				return
+			}
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	target := "all"
+	if len(req.LibraryIDs) > 0 {
+		target = strings.Join(req.LibraryIDs, ",")
+	}
+
+	libraryIDs := req.LibraryIDs
+	job, started := s.jobs.Start(jobTypeResolveMetadata, target, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		processed, err := s.librarySvc.RebuildResolvedMetadata(ctx, libraryIDs, report)
+		return resolveMetadataResult{Processed: processed}, err
+	})
+
+	respondJob(w, job, started)
+}
+
+// handleAdminDetectMime queues a background pass that sniffs every stored
+// media file and corrects its recorded MIME type.
+func (s *handler) handleAdminDetectMime(w http.ResponseWriter, r *http.Request) {
+	job, started := s.jobs.Start(jobTypeDetectMime, "all", func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.librarySvc.RedetectMimeTypes(ctx, report)
+	})
+
+	respondJob(w, job, started)
+}
+
+// handleAdminMimeMismatches lists media files whose content disagrees with
+// their file extension.
+func (s *handler) handleAdminMimeMismatches(w http.ResponseWriter, r *http.Request) {
+	offset, limit := getPagination(r)
+	mismatches, total, err := s.librarySvc.ListMimeMismatches(r.Context(), offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": mismatches,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
+
+// handleAdminOrganize renames already-imported audiobooks according to the
+// import template. Dry runs return the planned renames immediately; real runs
+// are queued as a background job.
+func (s *handler) handleAdminOrganize(w http.ResponseWriter, r *http.Request) {
+	var req importservice.OrganizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.DryRun {
+		result, err := s.importSvc.Organize(r.Context(), req, nil)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{"data": result})
+		return
+	}
+
+	target := "all"
+	switch {
+	case len(req.AudiobookIDs) > 0:
+		target = strings.Join(req.AudiobookIDs, ",")
+	case len(req.LibraryIDs) > 0:
+		target = strings.Join(req.LibraryIDs, ",")
+	}
+
+	job, started := s.jobs.Start(jobTypeOrganize, target, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.importSvc.Organize(ctx, req, report)
+	})
+
+	respondJob(w, job, started)
+}
+
+// handleAdminAudiobookBulk queues a job applying one operation, such as
+// delete or refresh-metadata, to a list of audiobooks. The job's result
+// reports each audiobook.
+func (s *handler) handleAdminAudiobookBulk(w http.ResponseWriter, r *http.Request) {
+	var req audiobooks.BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.svc.ValidateBulk(r.Context(), &req); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	target := req.Operation + ":" + strings.Join(req.AudiobookIDs, ",")
+	job, started := s.jobs.Start(jobTypeBulkAudiobooks, target, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.svc.RunBulk(ctx, req, report)
+	})
+
+	respondJob(w, job, started)
+}
+
+// handleAdminMergeM4B queues a job merging a multi-file audiobook into a
+// single chaptered M4B.
+func (s *handler) handleAdminMergeM4B(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "audiobook_id")
+
+	if err := s.svc.CheckMergeable(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			respondError(w, http.StatusNotFound, "audiobook not found")
+		case errors.Is(err, audiobooks.ErrNothingToMerge):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if !media.TranscoderAvailable() {
+		respondError(w, http.StatusServiceUnavailable, "ffmpeg is not available")
+		return
+	}
+
+	job, started := s.jobs.Start(jobTypeMergeM4B, id, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.svc.MergeToM4B(ctx, id, report)
+	})
+
+	respondJob(w, job, started)
+}
+
+// handleAdminWriteTags queues a job writing an audiobook's resolved
+// metadata into the tags of its files.
+func (s *handler) handleAdminWriteTags(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "audiobook_id")
+
+	if !s.checkTagsWritable(w, s.svc.CheckTagsWritable(r.Context(), id), "audiobook not found") {
+		return
+	}
+
+	job, started := s.jobs.Start(jobTypeWriteTags, id, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.svc.WriteTags(ctx, id, report)
+	})
+
+	respondJob(w, job, started)
+}
+
+// handleAdminLibraryWriteTags queues a job writing the tags of every
+// audiobook in a library.
+func (s *handler) handleAdminLibraryWriteTags(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if !s.checkTagsWritable(w, s.svc.CheckLibraryTagsWritable(r.Context(), id), "library not found") {
+		return
+	}
+
+	job, started := s.jobs.Start(jobTypeWriteTags, "library:"+id, func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.svc.WriteLibraryTags(ctx, id, report)
+	})
+
+	respondJob(w, job, started)
+}
+
+// checkTagsWritable answers a tag writing request that cannot go ahead,
+// given the result of checking the audiobook or library.
+func (s *handler) checkTagsWritable(w http.ResponseWriter, err error, notFound string) bool {
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		respondError(w, http.StatusNotFound, notFound)
+		return false
+	case errors.Is(err, audiobooks.ErrTagWritingDisabled):
+		respondError(w, http.StatusConflict, err.Error())
+		return false
+	case errors.Is(err, audiobooks.ErrNoMediaFiles):
+		respondError(w, http.StatusBadRequest, err.Error())
+		return false
+	default:
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !media.TranscoderAvailable() {
+		respondError(w, http.StatusServiceUnavailable, "ffmpeg is not available")
+		return false
+	}
+	return true
+}
+
+// handleAdminOutboundStats reports request counts, retries, failures and
+// circuit breaker state for outbound HTTP clients, per remote host.
+func (s *handler) handleAdminOutboundStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": httpclient.Stats()})
+}
+
+// handleAdminScanProfiles reports the phase timings of the latest scans and
+// imports, newest first. kind narrows them to "scan" or "import".
+func (s *handler) handleAdminScanProfiles(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != perf.KindScan && kind != perf.KindImport {
+		handleError(w, apperrors.NewValidationError("kind", "invalid kind (must be scan or import)", kind))
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > perf.MaxProfiles {
+			handleError(w, apperrors.NewValidationError("limit", "invalid limit value (must be 1-50)", limitStr))
+			return
+		}
+		limit = parsed
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": perf.Recent(kind, limit)})
+}
+
+// handleAdminCacheStats reports the read cache's size, hits and misses.
+func (s *handler) handleAdminCacheStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": s.svc.CacheStats()})
+}
+
+// handleAdminCacheClear drops every cached read, e.g. after editing the
+// database by hand.
+func (s *handler) handleAdminCacheClear(w http.ResponseWriter, r *http.Request) {
+	s.svc.ClearCache()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminProviderHealth reports each metadata provider as healthy,
+// degraded, down (requests paused by its circuit breaker) or unknown, with
+// the request counters of its hosts.
+func (s *handler) handleAdminProviderHealth(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": s.svc.ProviderHealth()})
+}
+
+// handleAdminProviderCacheStats reports the metadata provider cache's size,
+// hits and misses.
+func (s *handler) handleAdminProviderCacheStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": s.svc.ProviderCacheStats()})
+}
+
+// handleAdminProviderCacheClear drops every cached provider result, so the
+// next searches and lookups go to the providers.
+func (s *handler) handleAdminProviderCacheClear(w http.ResponseWriter, r *http.Request) {
+	s.svc.ClearProviderCache()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondJob answers with a job: 202 for a job just queued, or 200 for the
+// same work already queued or running, which was joined instead.
+func respondJob(w http.ResponseWriter, job jobs.Job, started bool) {
+	status := http.StatusOK
+	if started {
+		status = http.StatusAccepted
+	}
+	respondJSON(w, status, map[string]interface{}{"data": job})
+}
+
+func (s *handler) handleAdminJobList(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": s.jobs.List()})
+}
+
+func (s *handler) handleAdminJobGet(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "job_id")
+	job, ok := s.jobs.Get(jobID)
+	if !ok {
+		respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": job})
+}
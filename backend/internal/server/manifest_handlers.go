@@ -0,0 +1,110 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Lifetime of the URLs in a download manifest.
+const (
+	defaultManifestTTL = 6 * time.Hour
+	maxManifestTTL     = 24 * time.Hour
+)
+
+type downloadManifest struct {
+	AudiobookID string                 `json:"audiobook_id"`
+	Title       string                 `json:"title"`
+	ExpiresAt   time.Time              `json:"expires_at"`
+	TotalSize   int64                  `json:"total_size"`
+	Files       []downloadManifestFile `json:"files"`
+}
+
+type downloadManifestFile struct {
+	ID          string  `json:"id"`
+	Filename    string  `json:"filename"`
+	MimeType    string  `json:"mime_type"`
+	DurationSec float64 `json:"duration_sec"`
+	Size        int64   `json:"size"`
+	URL         string  `json:"url"`
+}
+
+// handleLibraryDownloadManifest lists an audiobook's media files with
+// short-lived signed URLs, so download queues on mobile clients do not need
+// the permanent API key. The URLs always serve the original files.
+func (h *handler) handleLibraryDownloadManifest(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		ExpiresInMinutes int `json:"expires_in_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ttl := defaultManifestTTL
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+	if ttl <= 0 || ttl > maxManifestTTL {
+		respondError(w, http.StatusBadRequest, "expires_in_minutes must be between 1 and 1440")
+		return
+	}
+
+	book, err := h.svc.GetLibraryItem(r.Context(), chi.URLParam(r, "audiobook_id"), user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found in library")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	signer, err := h.authSvc.MediaSigner(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	title := book.ResolveMetadata().Title
+	if title == "" {
+		title = filepath.Base(book.AssetPath)
+	}
+
+	base := requestBaseURL(r)
+	manifest := downloadManifest{
+		AudiobookID: book.ID,
+		Title:       title,
+		ExpiresAt:   time.Now().Add(ttl).UTC().Truncate(time.Second),
+		Files:       make([]downloadManifestFile, 0, len(book.MediaFiles)),
+	}
+	for _, mf := range book.MediaFiles {
+		size, err := h.mediaFileSize(r, user, mf.ID)
+		if err != nil {
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		manifest.TotalSize += size
+		manifest.Files = append(manifest.Files, downloadManifestFile{
+			ID:          mf.ID,
+			Filename:    mf.Filename,
+			MimeType:    mf.MimeType,
+			DurationSec: mf.DurationSec,
+			Size:        size,
+			URL:         signedMediaURL(base, signer, mf.ID, manifest.ExpiresAt) + "&direct=true",
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": manifest})
+}
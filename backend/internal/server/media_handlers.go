@@ -2,14 +2,26 @@ package server
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/archive"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/services/audiobooks"
 )
 
 // Media streaming
@@ -20,7 +32,12 @@ func (h *handler) handleMediaFileStream(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	fileID := chi.URLParam(r, "file_id")
+	h.serveMediaFile(w, r, user, chi.URLParam(r, "file_id"))
+}
+
+// serveMediaFile streams a media file to user, directly or transcoded, and
+// records the download.
+func (h *handler) serveMediaFile(w http.ResponseWriter, r *http.Request, user *models.User, fileID string) {
 	path, mimeType, err := h.svc.MediaFileStream(r.Context(), fileID, user.ID, user.IsAdmin)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -46,14 +63,424 @@ func (h *handler) handleMediaFileStream(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	decision := h.negotiatePlayback(r, mimeType)
+	w.Header().Set("X-Playback-Method", decision.Method)
+	if decision.Method == media.PlaybackTranscode {
+		h.streamTranscoded(w, r, user, fileID, path, decision)
+		return
+	}
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
 	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Accept-Ranges", "bytes")
-	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
-	
+
 	// Support caching for better performance
 	w.Header().Set("Cache-Control", "public, max-age=3600")
 	w.Header().Set("ETag", fmt.Sprintf("\"%d-%d\"", info.ModTime().Unix(), info.Size()))
-	
-	// http.ServeFile already handles range requests properly
-	http.ServeFile(w, r, filepath.Clean(path))
-}
\ No newline at end of file
+
+	// ServeContent handles ranges and conditional requests, and copies via
+	// ReadFrom so the kernel can sendfile the file without buffering it here.
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	http.ServeContent(rw, r, info.Name(), info.ModTime(), f)
+
+	h.recordDownload(r, user, models.DownloadKindMedia, nil, &fileID, rw)
+}
+
+// handleSupplementFileDownload serves a supplement file of an audiobook,
+// such as its PDF booklet or cue sheet, as an attachment.
+func (h *handler) handleSupplementFileDownload(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	path, file, err := h.svc.SupplementFile(r.Context(), chi.URLParam(r, "file_id"), user.ID, user.IsAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "supplement file not found")
+			return
+		}
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			respondError(w, http.StatusNotFound, "supplement file missing on disk")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if info.IsDir() {
+		respondError(w, http.StatusBadRequest, "supplement file path resolves to directory")
+		return
+	}
+
+	w.Header().Set("Content-Type", file.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(file.Filename)}))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	http.ServeContent(rw, r, info.Name(), info.ModTime(), f)
+
+	h.recordDownload(r, user, models.DownloadKindSupplement, &file.AudiobookID, nil, rw)
+}
+
+// handleMediaFilePlayback reports how a media file would be delivered to the
+// caller, so clients can choose between direct play and transcoding up front.
+func (h *handler) handleMediaFilePlayback(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	fileID := chi.URLParam(r, "file_id")
+	_, mimeType, err := h.svc.MediaFileStream(r.Context(), fileID, user.ID, user.IsAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "media file not found")
+			return
+		}
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	decision := h.negotiatePlayback(r, mimeType)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"source_mime_type": mimeType,
+			"method":           decision.Method,
+			"mime_type":        decision.MimeType,
+		},
+	})
+}
+
+// Lifetime of stream tokens.
+const (
+	defaultStreamTokenTTL = time.Hour
+	maxStreamTokenTTL     = 24 * time.Hour
+)
+
+// handleMediaFileToken issues a short-lived token that streams one media
+// file through GET /media_files/{file_id}?token=..., so the URL can be
+// handed to an external player without exposing the API key. Tokens are
+// signed with the caller's feed token and revoked by rotating it.
+func (h *handler) handleMediaFileToken(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		ExpiresInMinutes int `json:"expires_in_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ttl := defaultStreamTokenTTL
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+	if ttl <= 0 || ttl > maxStreamTokenTTL {
+		respondError(w, http.StatusBadRequest, "expires_in_minutes must be between 1 and 1440")
+		return
+	}
+
+	fileID := chi.URLParam(r, "file_id")
+	if _, _, err := h.svc.MediaFileStream(r.Context(), fileID, user.ID, user.IsAdmin); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "media file not found")
+			return
+		}
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	signer, err := h.authSvc.MediaSigner(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	token := signer.Sign(fileID, expiresAt)
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": map[string]interface{}{
+			"token":      token,
+			"expires_at": expiresAt,
+			"url":        requestBaseURL(r) + "/api/v1/media_files/" + url.PathEscape(fileID) + "?token=" + url.QueryEscape(token),
+		},
+	})
+}
+
+// negotiatePlayback matches the file against the formats the client declared
+// in the "formats" query parameter or X-Playback-Formats header. "direct=true"
+// forces the original file. Transcoding falls back to direct play when ffmpeg
+// is unavailable.
+func (h *handler) negotiatePlayback(r *http.Request, mimeType string) media.PlaybackDecision {
+	direct := media.PlaybackDecision{Method: media.PlaybackDirect, MimeType: mimeType}
+	if r.URL.Query().Get("direct") == "true" {
+		return direct
+	}
+
+	raw := r.URL.Query().Get("formats")
+	if raw == "" {
+		raw = r.Header.Get("X-Playback-Formats")
+	}
+	decision := media.NegotiatePlayback(mimeType, media.ParseClientFormats(raw))
+	if decision.Method == media.PlaybackTranscode && !media.TranscoderAvailable() {
+		log.Printf("ffmpeg not found; serving %s directly", mimeType)
+		return direct
+	}
+	return decision
+}
+
+// streamTranscoded converts the file on the fly. The output length is unknown
+// up front, so range requests are not supported.
+func (h *handler) streamTranscoded(w http.ResponseWriter, r *http.Request, user *models.User, fileID, path string, decision media.PlaybackDecision) {
+	w.Header().Set("Content-Type", decision.MimeType)
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Cache-Control", "no-store")
+
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	if r.Method == http.MethodHead {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	if err := media.Transcode(r.Context(), path, rw, h.streamBuffer); err != nil && r.Context().Err() == nil {
+		log.Printf("transcode %s: %v", fileID, err)
+	}
+
+	h.recordDownload(r, user, models.DownloadKindMedia, nil, &fileID, rw)
+}
+
+// handleLibraryDownload streams all media files of an audiobook as a zip
+// archive. The archive is generated on the fly but is byte-for-byte stable,
+// so single byte ranges (with If-Range) can resume an interrupted download.
+func (h *handler) handleLibraryDownload(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	audiobookID := chi.URLParam(r, "audiobook_id")
+	filename, entries, err := h.svc.AudiobookArchive(r.Context(), audiobookID, user.ID, user.IsAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found")
+			return
+		}
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	size, err := archive.Size(entries)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	etag := archive.ETag(entries)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	offset, length, status := int64(0), size, http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		if ifRange := r.Header.Get("If-Range"); ifRange == "" || ifRange == etag {
+			start, end, ok := parseByteRange(rangeHeader, size)
+			if !ok {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				respondError(w, http.StatusRequestedRangeNotSatisfiable, "invalid range")
+				return
+			}
+			if start >= 0 {
+				offset, length, status = start, end-start+1, http.StatusPartialContent
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			}
+		}
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	rw.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if err := archive.WriteRange(r.Context(), rw, entries, offset, length); err != nil && r.Context().Err() == nil {
+		log.Printf("zip download %s: %v", audiobookID, err)
+	}
+
+	h.recordDownload(r, user, models.DownloadKindZip, &audiobookID, nil, rw)
+}
+
+// handleLibraryPlaybackManifest maps an audiobook's continuous stream to
+// its files: where each file starts and ends on the book's timeline and,
+// for joined streams, in bytes. It links the HLS playlist when ffmpeg can
+// cut one.
+func (h *handler) handleLibraryPlaybackManifest(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	manifest, ok := h.playbackManifest(w, r, user)
+	if !ok {
+		return
+	}
+	manifest.StreamURL = requestBaseURL(r) + "/api/v1/library/" + url.PathEscape(manifest.AudiobookID) + "/stream"
+	if h.svc.HLSAvailable(manifest) {
+		hlsURL, err := h.hlsURL(r, user, manifest.AudiobookID)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		manifest.HLSURL = hlsURL
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": manifest})
+}
+
+// handleLibraryStream streams a whole audiobook as one response, so clients
+// can play a multi-file book as a single track. Files of one joinable format
+// are served back to back with range support; others are transcoded into
+// one MP3.
+func (h *handler) handleLibraryStream(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	manifest, ok := h.playbackManifest(w, r, user)
+	if !ok {
+		return
+	}
+	w.Header().Set("X-Playback-Method", manifest.Method)
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+	if manifest.Method == audiobooks.StreamTranscode {
+		w.Header().Set("Content-Type", manifest.MimeType)
+		w.Header().Set("Accept-Ranges", "none")
+		w.Header().Set("Cache-Control", "no-store")
+		rw.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		paths := make([]string, len(manifest.Files))
+		for i, f := range manifest.Files {
+			paths[i] = f.Path
+		}
+		if err := media.TranscodeJoined(r.Context(), paths, rw, h.streamBuffer); err != nil && r.Context().Err() == nil {
+			log.Printf("transcode audiobook %s: %v", manifest.AudiobookID, err)
+		}
+		h.recordDownload(r, user, models.DownloadKindStream, &manifest.AudiobookID, nil, rw)
+		return
+	}
+
+	files := make([]media.JoinedFile, len(manifest.Files))
+	for i, f := range manifest.Files {
+		files[i] = media.JoinedFile{Path: f.Path, Size: f.SizeBytes}
+	}
+	content := media.NewJoinedReader(files)
+	defer content.Close()
+
+	w.Header().Set("Content-Type", manifest.MimeType)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", manifest.ETag)
+	http.ServeContent(rw, r, "", manifest.Modified, content)
+
+	h.recordDownload(r, user, models.DownloadKindStream, &manifest.AudiobookID, nil, rw)
+}
+
+// playbackManifest loads the playback manifest of the requested audiobook,
+// writing the error response when it cannot be streamed.
+func (h *handler) playbackManifest(w http.ResponseWriter, r *http.Request, user *models.User) (*audiobooks.PlaybackManifest, bool) {
+	manifest, err := h.svc.AudiobookPlaybackManifest(r.Context(), chi.URLParam(r, "audiobook_id"), user.ID, user.IsAdmin)
+	switch {
+	case err == nil:
+		return manifest, true
+	case errors.Is(err, sql.ErrNoRows):
+		respondError(w, http.StatusNotFound, "audiobook not found")
+	case errors.Is(err, audiobooks.ErrNoMediaFiles), errors.Is(err, audiobooks.ErrNotStreamable):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusForbidden, err.Error())
+	}
+	return nil, false
+}
+
+// parseByteRange parses a single "bytes=" range against a resource of size
+// bytes and returns the inclusive bounds. Multiple ranges are not supported;
+// they yield start -1 so the whole resource is served. ok is false when the
+// range cannot be satisfied.
+func parseByteRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return -1, -1, true
+	}
+	if strings.Contains(spec, ",") {
+		return -1, -1, true
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// Suffix range: the final N bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, size > 0
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
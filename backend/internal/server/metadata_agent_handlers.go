@@ -0,0 +1,171 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// agentNamePattern keeps agent names usable as ?provider= values.
+var agentNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,39}$`)
+
+type metadataAgentRequest struct {
+	Name    *string `json:"name"`
+	URL     *string `json:"url"`
+	APIKey  *string `json:"api_key"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// apply copies the fields present in the request onto agent and validates
+// the result. An empty api_key removes the key.
+func (req metadataAgentRequest) apply(agent *models.MetadataAgent) error {
+	if req.Name != nil {
+		agent.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		agent.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.APIKey != nil {
+		agent.APIKey = strings.TrimSpace(*req.APIKey)
+	}
+	if req.Enabled != nil {
+		agent.Enabled = *req.Enabled
+	}
+
+	if !agentNamePattern.MatchString(agent.Name) {
+		return errors.New("name must be 1-40 lowercase letters, digits, dots, dashes or underscores")
+	}
+	if !validHTTPURL(agent.URL) {
+		return errors.New("url must be an http or https URL")
+	}
+	return nil
+}
+
+func (h *handler) handleAdminMetadataAgentList(w http.ResponseWriter, r *http.Request) {
+	agents, err := h.svc.ListMetadataAgents(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": agents})
+}
+
+// handleAdminMetadataAgentCreate registers an external metadata agent,
+// searchable under its name as soon as it is saved.
+func (h *handler) handleAdminMetadataAgentCreate(w http.ResponseWriter, r *http.Request) {
+	var req metadataAgentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	agent := &models.MetadataAgent{Enabled: true}
+	if err := req.apply(agent); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.svc.CreateMetadataAgent(r.Context(), agent); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": agent})
+}
+
+func (h *handler) handleAdminMetadataAgentGet(w http.ResponseWriter, r *http.Request) {
+	agent, ok := h.loadMetadataAgent(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": agent})
+}
+
+func (h *handler) handleAdminMetadataAgentUpdate(w http.ResponseWriter, r *http.Request) {
+	agent, ok := h.loadMetadataAgent(w, r)
+	if !ok {
+		return
+	}
+
+	var req metadataAgentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	oldName := agent.Name
+	if err := req.apply(agent); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.svc.UpdateMetadataAgent(r.Context(), agent, oldName); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": agent})
+}
+
+func (h *handler) handleAdminMetadataAgentDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteMetadataAgent(r.Context(), chi.URLParam(r, "agent_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "metadata agent not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminMetadataAgentTest searches the agent for ?title= (and
+// ?author=), enabled or not, and returns what it answered, so admins can
+// check an agent follows the contract before enabling it.
+func (h *handler) handleAdminMetadataAgentTest(w http.ResponseWriter, r *http.Request) {
+	agent, ok := h.loadMetadataAgent(w, r)
+	if !ok {
+		return
+	}
+
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		respondError(w, http.StatusBadRequest, "title parameter is required")
+		return
+	}
+
+	results, err := h.svc.TestMetadataAgent(r.Context(), agent, title, r.URL.Query().Get("author"))
+	if err != nil {
+		if respondProviderError(w, err) {
+			return
+		}
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": results})
+}
+
+// loadMetadataAgent fetches the agent named in the URL, writing an error
+// response and returning false when it cannot.
+func (h *handler) loadMetadataAgent(w http.ResponseWriter, r *http.Request) (*models.MetadataAgent, bool) {
+	agent, err := h.svc.GetMetadataAgent(r.Context(), chi.URLParam(r, "agent_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "metadata agent not found")
+			return nil, false
+		}
+		handleError(w, err)
+		return nil, false
+	}
+	return agent, true
+}
@@ -1,15 +1,24 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/lore/backend/internal/auth"
+	apperrors "github.com/lore/backend/internal/errors"
 	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/providers"
+	"github.com/lore/backend/internal/services/audiobooks"
 )
 
 // =============================================================================
@@ -21,102 +30,113 @@ type UpdateAudiobookMetadataRequest struct {
 	Overrides map[string]struct {
 		Value  string `json:"value"`
 		Locked bool   `json:"locked"`
+		Mode   string `json:"mode,omitempty"`
 	} `json:"overrides"`
+	// CustomFields sets custom field values by key; null clears a value.
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
 }
 
 // handleUpdateAudiobookMetadata saves manual metadata overrides for an audiobook
 // PATCH /api/v1/admin/audiobooks/:id/metadata
 //
-// Simplified lock semantics:
-// - Presence in overrides map = locked (frozen custom value)
-// - Absence from map = unlocked (uses cascade: agent → file)
-// - Empty string value = delete the override
+// Each override selects a lock mode:
+// - mode "value" = locked to the given value
+// - mode "blank" = locked to empty (overrides cascade)
+// - mode "agent" = pinned to the agent value, no fallback
+// - mode "unlocked" = uses cascade: agent → file
+// Without a mode, locked=true means "value" (or "blank" for an empty value)
+// and locked=false means "unlocked". Fields absent from the map are unlocked.
+//
+// custom_fields sets values of admin-defined custom fields; custom fields
+// absent from the map keep their values.
 func (h *handler) handleUpdateAudiobookMetadata(w http.ResponseWriter, r *http.Request) {
 	audiobookID := chi.URLParam(r, "id")
 	if audiobookID == "" {
-		http.Error(w, "audiobook ID is required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "audiobook ID is required")
 		return
 	}
 
 	var req UpdateAudiobookMetadataRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	// Get user from context (set by auth middleware)
 	user := auth.GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		handleError(w, apperrors.ErrUnauthorized)
 		return
 	}
 	userID := user.ID
 
-	// Build CustomMetadata struct from overrides map
-	// Locked fields are tracked in the Locks map
-	// locked=true, value="foo" → locked to "foo"
-	// locked=true, value="" → locked to empty (overrides cascade)
-	// locked=false → unlocked (uses cascade)
-	custom := &models.CustomMetadata{
-		AudiobookID: audiobookID,
-		Locks:       make(map[string]bool),
-		UpdatedAt:   time.Now().UTC(),
-		UpdatedBy:   &userID,
-	}
-
-	hasAnyLocked := false
-	for field, override := range req.Overrides {
-		if !override.Locked {
-			continue // Not locked, skip
+	// A request carrying only custom field values leaves the overrides alone.
+	if req.Overrides != nil || req.CustomFields == nil {
+		custom := &models.CustomMetadata{
+			AudiobookID: audiobookID,
+			Locks:       make(map[string]bool),
+			LockModes:   make(map[string]string),
+			UpdatedAt:   time.Now().UTC(),
+			UpdatedBy:   &userID,
 		}
 
-		hasAnyLocked = true
-		custom.Locks[field] = true
-
-		// Set value even if empty (locked to empty is valid)
-		value := override.Value
-		switch field {
-		case "title":
-			custom.Title = &value
-		case "subtitle":
-			custom.Subtitle = &value
-		case "author":
-			custom.Author = &value
-		case "narrator":
-			custom.Narrator = &value
-		case "description":
-			custom.Description = &value
-		case "cover_url":
-			custom.CoverURL = &value
-		case "series_name":
-			custom.SeriesName = &value
-		case "series_sequence":
-			custom.SeriesSequence = &value
-		case "release_date":
-			custom.ReleaseDate = &value
-		case "isbn":
-			custom.ISBN = &value
-		case "asin":
-			custom.ASIN = &value
-		case "language":
-			custom.Language = &value
-		case "publisher":
-			custom.Publisher = &value
-		case "genres":
-			custom.Genres = &value
+		hasAnyLocked := false
+		for field, override := range req.Overrides {
+			if !isCustomMetadataField(field) {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown metadata field %q", field))
+				return
+			}
+
+			mode := override.Mode
+			if mode == "" {
+				switch {
+				case !override.Locked:
+					mode = models.LockModeUnlocked
+				case override.Value == "":
+					mode = models.LockModeBlank
+				default:
+					mode = models.LockModeValue
+				}
+			}
+
+			switch mode {
+			case models.LockModeUnlocked:
+				continue
+			case models.LockModeValue:
+				if override.Value == "" {
+					respondError(w, http.StatusBadRequest, fmt.Sprintf("field %q is locked to a value but no value was given", field))
+					return
+				}
+				value := override.Value
+				custom.SetFieldValue(field, &value)
+			case models.LockModeBlank, models.LockModeAgent:
+			default:
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid lock mode %q for field %q", mode, field))
+				return
+			}
+
+			hasAnyLocked = true
+			custom.SetLockMode(field, mode)
 		}
-	}
 
-	// If no fields are locked, delete the entire custom metadata record
-	if !hasAnyLocked {
-		if err := h.svc.DeleteMetadataOverrides(r.Context(), audiobookID); err != nil {
-			http.Error(w, "failed to delete custom metadata", http.StatusInternalServerError)
-			return
+		// If no fields are locked, delete the entire custom metadata record
+		if !hasAnyLocked {
+			if err := h.svc.DeleteMetadataOverrides(r.Context(), audiobookID); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to delete custom metadata")
+				return
+			}
+		} else {
+			// Save custom metadata
+			if err := h.svc.SaveMetadataOverrides(r.Context(), custom); err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to save custom metadata")
+				return
+			}
 		}
-	} else {
-		// Save custom metadata
-		if err := h.svc.SaveMetadataOverrides(r.Context(), custom); err != nil {
-			http.Error(w, "failed to save custom metadata", http.StatusInternalServerError)
+	}
+
+	if req.CustomFields != nil {
+		if err := h.svc.SetCustomFieldValues(r.Context(), audiobookID, req.CustomFields); err != nil {
+			handleError(w, err)
 			return
 		}
 	}
@@ -125,12 +145,11 @@ func (h *handler) handleUpdateAudiobookMetadata(w http.ResponseWriter, r *http.R
 	// GetLibraryItem already loads CustomMetadata via GetAudiobook
 	audiobook, err := h.svc.GetLibraryItem(r.Context(), audiobookID, userID)
 	if err != nil {
-		http.Error(w, "failed to get audiobook", http.StatusInternalServerError)
+		respondError(w, http.StatusInternalServerError, "failed to get audiobook")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(audiobook)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": shapeAudiobook(r, audiobook)})
 }
 
 // handleClearMetadataOverrides removes all manual overrides for an audiobook
@@ -138,40 +157,47 @@ func (h *handler) handleUpdateAudiobookMetadata(w http.ResponseWriter, r *http.R
 func (h *handler) handleClearMetadataOverrides(w http.ResponseWriter, r *http.Request) {
 	audiobookID := chi.URLParam(r, "id")
 	if audiobookID == "" {
-		http.Error(w, "audiobook ID is required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "audiobook ID is required")
 		return
 	}
 
 	if err := h.svc.DeleteMetadataOverrides(r.Context(), audiobookID); err != nil {
-		http.Error(w, "failed to clear overrides", http.StatusInternalServerError)
+		respondError(w, http.StatusInternalServerError, "failed to clear overrides")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleExtractEmbeddedMetadata extracts metadata from file tags (stub for now)
+// handleExtractEmbeddedMetadata reads file tags into the embedded metadata layer
 // POST /api/v1/admin/audiobooks/:id/metadata/extract
 func (h *handler) handleExtractEmbeddedMetadata(w http.ResponseWriter, r *http.Request) {
 	audiobookID := chi.URLParam(r, "id")
 	if audiobookID == "" {
-		http.Error(w, "audiobook ID is required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "audiobook ID is required")
 		return
 	}
 
-	// TODO: Implement actual ID3/M4B tag extraction using ffprobe
-	// For now, this is a stub that does nothing
+	embedded, err := h.svc.ExtractEmbeddedMetadata(r.Context(), audiobookID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondError(w, http.StatusNotFound, "audiobook not found")
+		return
+	case errors.Is(err, audiobooks.ErrNoMediaFiles):
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "failed to extract embedded metadata")
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "not_implemented",
-		"message": "Embedded metadata extraction is not yet implemented",
-	})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": embedded})
 }
 
 // MetadataLayersResponse represents all metadata layers for debugging
 type MetadataLayersResponse struct {
 	AgentMetadata    *models.AgentMetadata    `json:"agent_metadata,omitempty"`
+	SidecarMetadata  *models.SidecarMetadata  `json:"sidecar_metadata,omitempty"`
 	EmbeddedMetadata *models.EmbeddedMetadata `json:"embedded_metadata,omitempty"`
 	CustomMetadata   *models.CustomMetadata   `json:"custom_metadata,omitempty"`
 }
@@ -181,13 +207,13 @@ type MetadataLayersResponse struct {
 func (h *handler) handleGetMetadataLayers(w http.ResponseWriter, r *http.Request) {
 	audiobookID := chi.URLParam(r, "id")
 	if audiobookID == "" {
-		http.Error(w, "audiobook ID is required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "audiobook ID is required")
 		return
 	}
 
 	user := auth.GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		handleError(w, apperrors.ErrUnauthorized)
 		return
 	}
 	userID := user.ID
@@ -195,7 +221,7 @@ func (h *handler) handleGetMetadataLayers(w http.ResponseWriter, r *http.Request
 	// Get audiobook with agent metadata
 	audiobook, err := h.svc.GetLibraryItem(r.Context(), audiobookID, userID)
 	if err != nil {
-		http.Error(w, "audiobook not found", http.StatusNotFound)
+		respondError(w, http.StatusNotFound, "audiobook not found")
 		return
 	}
 
@@ -207,12 +233,12 @@ func (h *handler) handleGetMetadataLayers(w http.ResponseWriter, r *http.Request
 
 	response := MetadataLayersResponse{
 		AgentMetadata:    audiobook.AgentMetadata, // Use raw agent metadata, not resolved
+		SidecarMetadata:  audiobook.SidecarMetadata,
 		EmbeddedMetadata: embedded,
 		CustomMetadata:   custom,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": response})
 }
 
 // =============================================================================
@@ -220,7 +246,7 @@ func (h *handler) handleGetMetadataLayers(w http.ResponseWriter, r *http.Request
 // =============================================================================
 
 // handleSearchMetadata searches for metadata via external providers
-// GET /api/v1/metadata/search?provider={provider}&title={title}&author={author}
+// GET /api/v1/metadata/search?provider={provider|all}&title={title}&author={author}&refresh=true
 func (h *handler) handleSearchMetadata(w http.ResponseWriter, r *http.Request) {
 	provider := r.URL.Query().Get("provider")
 	title := r.URL.Query().Get("title")
@@ -230,24 +256,33 @@ func (h *handler) handleSearchMetadata(w http.ResponseWriter, r *http.Request) {
 		provider = "audible" // Default provider
 	}
 	if title == "" {
-		http.Error(w, "title parameter is required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "title parameter is required")
 		return
 	}
 
-	results, err := h.svc.SearchMetadata(r.Context(), provider, title, author)
+	ctx := r.Context()
+	if r.URL.Query().Get("refresh") == "true" {
+		ctx = providers.WithoutCache(ctx)
+	}
+
+	results, err := h.svc.SearchMetadata(ctx, provider, title, author)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("metadata search failed: %v", err), http.StatusInternalServerError)
+		if respondProviderError(w, err) {
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("metadata search failed: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": results})
 }
 
 // LinkMetadataRequest represents the request to link audiobook to agent metadata
 type LinkMetadataRequest struct {
 	Provider   string `json:"provider"`
 	ExternalID string `json:"external_id"`
+	// Refresh fetches from the provider even when the result is cached.
+	Refresh bool `json:"refresh,omitempty"`
 	// Optional: full metadata to save if not fetching again
 	Metadata *struct {
 		Title          string  `json:"title"`
@@ -272,29 +307,188 @@ type LinkMetadataRequest struct {
 func (h *handler) handleLinkMetadata(w http.ResponseWriter, r *http.Request) {
 	audiobookID := chi.URLParam(r, "id")
 	if audiobookID == "" {
-		http.Error(w, "audiobook ID is required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "audiobook ID is required")
 		return
 	}
 
 	var req LinkMetadataRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if req.Provider == "" || req.ExternalID == "" {
-		http.Error(w, "provider and external_id are required", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, "provider and external_id are required")
 		return
 	}
 
+	ctx := r.Context()
+	if req.Refresh {
+		ctx = providers.WithoutCache(ctx)
+	}
+
 	// Link the metadata (fetches from provider and saves it)
-	if err := h.svc.LinkMetadata(r.Context(), audiobookID, req.Provider, req.ExternalID); err != nil {
-		http.Error(w, fmt.Sprintf("failed to link metadata: %v", err), http.StatusInternalServerError)
+	if err := h.svc.LinkMetadata(ctx, audiobookID, req.Provider, req.ExternalID); err != nil {
+		if respondProviderError(w, err) {
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("failed to link metadata: %v", err))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleAdminDuplicates lists audiobooks linked to the same book, matched by
+// any of its ASINs or ISBNs.
+// GET /api/v1/admin/audiobooks/duplicates
+func (h *handler) handleAdminDuplicates(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.svc.ListDuplicates(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if groups == nil {
+		groups = []models.DuplicateGroup{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": groups})
+}
+
+// handleAdminMetadataGaps lists books missing an author, cover, duration or
+// series sequence after metadata resolution, for library cleanup. The
+// summary counts the gaps per library; library_id and gap narrow the list.
+func (h *handler) handleAdminMetadataGaps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	gap := strings.TrimSpace(query.Get("gap"))
+	if gap != "" {
+		valid := false
+		for _, known := range models.MetadataGaps {
+			if gap == known {
+				valid = true
+			}
+		}
+		if !valid {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("gap must be one of %s", strings.Join(models.MetadataGaps, ", ")))
+			return
+		}
+	}
+	var libraryID *string
+	if id := strings.TrimSpace(query.Get("library_id")); id != "" {
+		libraryID = &id
+	}
+
+	offset, limit := getPagination(r)
+	books, total, err := h.svc.ListMetadataGaps(r.Context(), libraryID, gap, offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	summaries, err := h.svc.MetadataGapSummaries(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range books {
+		id := url.PathEscape(books[i].AudiobookID)
+		books[i].Links = map[string]string{
+			"book":     "/api/v1/library/" + id,
+			"layers":   "/api/v1/admin/audiobooks/" + id + "/metadata/layers",
+			"metadata": "/api/v1/admin/audiobooks/" + id + "/metadata",
+			"cover":    "/api/v1/admin/audiobooks/" + id + "/cover",
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data":    books,
+		"summary": summaries,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
+
+// handleAdminMissingAudiobooks lists books whose folder a scan could not
+// find on disk, which are left out of listings until a scan finds them
+// again. library_id narrows the list.
+// GET /api/v1/admin/audiobooks/missing
+func (h *handler) handleAdminMissingAudiobooks(w http.ResponseWriter, r *http.Request) {
+	var libraryID *string
+	if id := strings.TrimSpace(r.URL.Query().Get("library_id")); id != "" {
+		libraryID = &id
+	}
+
+	offset, limit := getPagination(r)
+	books, total, err := h.svc.ListMissingAudiobooks(r.Context(), libraryID, offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": books,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
+
+// Error codes of failed provider lookups, told apart from the server's own
+// rate limit and outages.
+const (
+	codeProviderRateLimited = "provider_rate_limited"
+	codeProviderUnavailable = "provider_unavailable"
+)
+
+// respondProviderError writes a readable response for rate-limited, missing
+// and temporarily failing provider lookups. It reports false for other errors.
+func respondProviderError(w http.ResponseWriter, err error) bool {
+	name := "the metadata provider"
+	var perr *providers.Error
+	if errors.As(err, &perr) {
+		name = perr.Provider
+	}
+
+	switch {
+	case errors.Is(err, providers.ErrRateLimited):
+		msg := fmt.Sprintf("%s is rate limiting requests; try again later", name)
+		if wait := providers.RetryAfter(err); wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			msg = fmt.Sprintf("%s is rate limiting requests; try again in %d seconds", name, seconds)
+		}
+		respondErrorCode(w, http.StatusTooManyRequests, codeProviderRateLimited, msg)
+	case errors.Is(err, providers.ErrNotFound):
+		respondError(w, http.StatusNotFound, fmt.Sprintf("%s has no match for this ID", name))
+	case errors.Is(err, providers.ErrUnavailable):
+		msg := fmt.Sprintf("%s keeps failing; requests are paused", name)
+		if wait := providers.RetryAfter(err); wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			msg = fmt.Sprintf("%s keeps failing; requests are paused for %d seconds", name, seconds)
+		}
+		respondErrorCode(w, http.StatusServiceUnavailable, codeProviderUnavailable, msg)
+	case errors.Is(err, providers.ErrTemporary):
+		respondErrorCode(w, http.StatusBadGateway, codeProviderUnavailable, fmt.Sprintf("%s is temporarily unavailable; try again shortly", name))
+	default:
+		return false
+	}
+	return true
+}
+
 // Note: Unmatch endpoint already exists at DELETE /api/v1/admin/audiobooks/{audiobook_id}/link
 // See handleAdminAudiobookUnlink in admin_handlers.go
+
+func isCustomMetadataField(field string) bool {
+	for _, candidate := range models.CustomMetadataFields {
+		if candidate == field {
+			return true
+		}
+	}
+	return false
+}
@@ -3,12 +3,23 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/lore/backend/internal/auth"
 	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/services/audiobooks"
 )
 
 // ErrorMiddleware handles errors consistently across all endpoints
@@ -29,13 +40,84 @@ func ErrorMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// RequestLogger logs each request like middleware.Logger, but with the
+// ?token= secrets of feed, stream and podcast URLs and the token of
+// catalog links redacted.
+var RequestLogger = middleware.RequestLogger(redactingLogFormatter{
+	LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags)},
+})
+
+// redactingLogFormatter hands its formatter a copy of the request with
+// secrets removed from the logged URL.
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	u := *r.URL
+	changed := false
+	if query := u.Query(); query.Has("token") {
+		query.Set("token", "REDACTED")
+		u.RawQuery = query.Encode()
+		changed = true
+	}
+	if rest, ok := strings.CutPrefix(u.Path, "/api/v1/share/"); ok {
+		_, tail, _ := strings.Cut(rest, "/")
+		u.Path = "/api/v1/share/REDACTED"
+		if tail != "" {
+			u.Path += "/" + tail
+		}
+		u.RawPath = ""
+		changed = true
+	}
+	if !changed {
+		return f.LogFormatter.NewLogEntry(r)
+	}
+	redacted := r.WithContext(r.Context())
+	redacted.URL = &u
+	redacted.RequestURI = u.RequestURI()
+	return f.LogFormatter.NewLogEntry(redacted)
+}
+
 // AuthMiddleware authenticates requests and attaches the user to the context.
 func AuthMiddleware(authSvc *auth.Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, err := authSvc.Authenticate(r.Context(), r.Header.Get("Authorization"))
 			if err != nil {
-				handleError(w, err)
+				respondAuthError(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), auth.UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// StreamAuthMiddleware authenticates media streams like AuthMiddleware or,
+// for requests without an Authorization header, with a ?token= signed for
+// the streamed file or, on routes without one, the streamed audiobook, since
+// external players such as VLC cannot send one.
+func StreamAuthMiddleware(authSvc *auth.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withAPIKey := AuthMiddleware(authSvc)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("token")
+			if token == "" || r.Header.Get("Authorization") != "" {
+				withAPIKey.ServeHTTP(w, r)
+				return
+			}
+
+			var user *models.User
+			var err error
+			if fileID := chi.URLParam(r, "file_id"); fileID != "" {
+				user, err = authSvc.VerifyMediaToken(r.Context(), fileID, token, clientAddr(r))
+			} else {
+				user, err = authSvc.VerifyAudiobookToken(r.Context(), chi.URLParam(r, "audiobook_id"), token, clientAddr(r))
+			}
+			if err != nil {
+				respondAuthError(w, r, err)
 				return
 			}
 
@@ -45,22 +127,42 @@ func AuthMiddleware(authSvc *auth.Service) func(http.Handler) http.Handler {
 	}
 }
 
+// FlushProgressMiddleware writes the caller's buffered progress updates
+// before their reads, so listings and book details show the latest
+// position. Place it after AuthMiddleware.
+func FlushProgressMiddleware(svc *audiobooks.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := getUserFromContext(r); user != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				svc.FlushUserProgress(r.Context(), user.ID)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // RequireAdmin ensures the request originates from an admin user.
 func RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := auth.GetUserFromContext(r.Context())
 		if err := auth.EnsureAdmin(user); err != nil {
-			handleError(w, err)
+			if errors.Is(err, auth.ErrForbidden) {
+				authFailures.record(r, authFailForbiddenAdmin)
+				handleError(w, err)
+				return
+			}
+			respondAuthError(w, r, err)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// responseWriter wraps http.ResponseWriter to capture status codes
+// responseWriter wraps http.ResponseWriter to capture status codes and body size
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -68,17 +170,58 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	return n, err
+}
+
+// ReadFrom lets io.Copy reach the underlying writer's ReadFrom, so files served
+// through the wrapper can still use sendfile.
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(src)
+		rw.bytesWritten += n
+		return n, err
+	}
+	return io.Copy(writerOnly{rw}, src)
+}
+
+// writerOnly hides ReadFrom so io.Copy does not recurse into it.
+type writerOnly struct{ io.Writer }
+
+// Flush forwards to the underlying writer when it supports flushing.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// errorResponse is the body of every API error: a readable message, a
+// machine-readable code clients can branch on (see apperrors.CodeForStatus)
+// and the HTTP status. Validation errors name the offending field.
+type errorResponse struct {
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Field  string `json:"field,omitempty"`
+}
+
 // Enhanced error response function
 func respondError(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	respondErrorCode(w, statusCode, apperrors.CodeForStatus(statusCode), message)
+}
 
-	response := map[string]interface{}{
-		"error":  message,
-		"status": statusCode,
-	}
+// respondErrorCode responds with an error whose code is more specific than
+// its status.
+func respondErrorCode(w http.ResponseWriter, statusCode int, code, message string) {
+	writeError(w, errorResponse{Error: message, Code: code, Status: statusCode})
+}
 
-	json.NewEncoder(w).Encode(response)
+func writeError(w http.ResponseWriter, resp errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Status)
+	json.NewEncoder(w).Encode(resp)
 }
 
 // Handle domain errors properly
@@ -87,10 +230,16 @@ func handleError(w http.ResponseWriter, err error) {
 		return
 	}
 
-	statusCode := apperrors.ToHTTPStatus(err)
-	message := apperrors.ToClientMessage(err)
-
-	respondError(w, statusCode, message)
+	resp := errorResponse{
+		Error:  apperrors.ToClientMessage(err),
+		Code:   apperrors.ToErrorCode(err),
+		Status: apperrors.ToHTTPStatus(err),
+	}
+	var validationErr *apperrors.ValidationError
+	if errors.As(err, &validationErr) {
+		resp.Field = validationErr.Field
+	}
+	writeError(w, resp)
 }
 
 // Enhanced JSON response function
@@ -113,3 +262,43 @@ func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
 		log.Printf("respondJSON: write error: %v", err)
 	}
 }
+
+// respondJSONConditional writes a 200 response like respondJSON, tagged with
+// an ETag of its body, and answers 304 Not Modified instead when the
+// request's If-None-Match already holds that tag. The tag covers everything
+// in the body, the caller's progress included, so clients polling an
+// unchanged listing download nothing.
+func respondJSONConditional(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		log.Printf("respondJSON: encode error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("respondJSON: write error: %v", err)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 asks.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
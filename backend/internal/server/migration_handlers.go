@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/lore/backend/internal/abs"
+	"github.com/lore/backend/internal/jobs"
+	"github.com/lore/backend/internal/services/library"
+)
+
+// audiobookshelfMigrationRequest names an Audiobookshelf database on the
+// server, or carries an export saved from its API.
+type audiobookshelfMigrationRequest struct {
+	DatabasePath string      `json:"database_path"`
+	Export       *abs.Export `json:"export"`
+	library.AudiobookshelfOptions
+}
+
+// handleAdminMigrateAudiobookshelf imports an Audiobookshelf server. A dry
+// run reports what would be migrated, including the items no audiobook
+// matched; otherwise the migration runs as a background job.
+func (s *handler) handleAdminMigrateAudiobookshelf(w http.ResponseWriter, r *http.Request) {
+	var req audiobookshelfMigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.DatabasePath = strings.TrimSpace(req.DatabasePath)
+	if (req.DatabasePath == "") == (req.Export == nil) {
+		respondError(w, http.StatusBadRequest, "one of database_path or export is required")
+		return
+	}
+
+	export := req.Export
+	if export == nil {
+		var err error
+		export, err = abs.ReadDatabase(r.Context(), req.DatabasePath)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.DryRun {
+		report, err := s.librarySvc.MigrateAudiobookshelf(r.Context(), export, req.AudiobookshelfOptions, nil)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{"data": report})
+		return
+	}
+
+	job, started := s.jobs.Start(library.JobTypeMigrateAudiobookshelf, "all", func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return s.librarySvc.MigrateAudiobookshelf(ctx, export, req.AudiobookshelfOptions, report)
+	})
+
+	respondJob(w, job, started)
+}
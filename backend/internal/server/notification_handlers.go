@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/notify"
+)
+
+// notificationSettingsResponse adds the channels the server can deliver on,
+// so clients only offer the ones that work.
+type notificationSettingsResponse struct {
+	*models.NotificationSettings
+	Channels []string `json:"channels"`
+}
+
+func (h *handler) handleNotificationSettingsGet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	settings, err := h.notifier.Settings(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": notificationSettingsResponse{settings, h.notifier.Channels()},
+	})
+}
+
+// handleNotificationSettingsUpdate changes the fields present in the request;
+// an empty email or webhook_url removes that channel.
+func (h *handler) handleNotificationSettingsUpdate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		Email           *string `json:"email"`
+		WebhookURL      *string `json:"webhook_url"`
+		ImportCompleted *bool   `json:"import_completed"`
+		ImportFailed    *bool   `json:"import_failed"`
+		ScanMissing     *bool   `json:"scan_missing_files"`
+		StorageWarnings *bool   `json:"storage_warnings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	settings, err := h.notifier.Settings(r.Context(), user.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if email == "" {
+			settings.Email = nil
+		} else {
+			addr, err := mail.ParseAddress(email)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "invalid email address")
+				return
+			}
+			settings.Email = &addr.Address
+		}
+	}
+	if req.WebhookURL != nil {
+		raw := strings.TrimSpace(*req.WebhookURL)
+		switch {
+		case raw == "":
+			settings.WebhookURL = nil
+		case !validHTTPURL(raw):
+			respondError(w, http.StatusBadRequest, "webhook_url must be an http or https URL")
+			return
+		default:
+			settings.WebhookURL = &raw
+		}
+	}
+	if req.ImportCompleted != nil {
+		settings.ImportCompleted = *req.ImportCompleted
+	}
+	if req.ImportFailed != nil {
+		settings.ImportFailed = *req.ImportFailed
+	}
+	if req.ScanMissing != nil {
+		settings.ScanMissing = *req.ScanMissing
+	}
+	if req.StorageWarnings != nil {
+		settings.StorageWarnings = *req.StorageWarnings
+	}
+
+	if err := h.notifier.UpdateSettings(r.Context(), settings); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": notificationSettingsResponse{settings, h.notifier.Channels()},
+	})
+}
+
+// handleNotificationTest sends a test notification to the caller's channels.
+func (h *handler) handleNotificationTest(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	if err := h.notifier.SendTest(r.Context(), user.ID); err != nil {
+		if errors.Is(err, notify.ErrNoChannels) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateScope is a request budget shared by a group of endpoints.
+type RateScope struct {
+	Name   string
+	Prefix string // URL path prefix the scope applies to
+	Limit  int    // requests allowed per window
+	Window time.Duration
+}
+
+// rateScopes are matched in order; the first prefix that matches wins.
+// Budgets are per user for authenticated requests and per client IP
+// otherwise.
+var rateScopes = []RateScope{
+	{Name: "auth", Prefix: "/api/v1/auth/", Limit: 20, Window: time.Minute},
+	// Issuing and rotating access tokens share one budget.
+	{Name: "tokens", Prefix: "/api/v1/users/me/tokens", Limit: 30, Window: time.Minute},
+	{Name: "tokens", Prefix: "/api/v1/users/me/feed-token", Limit: 30, Window: time.Minute},
+	{Name: "media", Prefix: "/api/v1/media_files/", Limit: 1200, Window: time.Minute},
+	{Name: "media", Prefix: "/api/v1/hls/", Limit: 1200, Window: time.Minute},
+	{Name: "api", Prefix: "/api/v1/", Limit: 600, Window: time.Minute},
+}
+
+// scopeFor returns the rate scope covering a request path.
+func scopeFor(path string) (RateScope, bool) {
+	for _, scope := range rateScopes {
+		if strings.HasPrefix(path, scope.Prefix) {
+			return scope, true
+		}
+	}
+	return RateScope{}, false
+}
+
+// rateWindow counts requests in one fixed window.
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+// RateLimiter enforces fixed-window request budgets per scope and client.
+type RateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates an empty RateLimiter.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		windows: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// allow counts a request from key against scope. It reports the remaining
+// budget, when the window resets, and whether the request is allowed.
+func (l *RateLimiter) allow(scope RateScope, key string) (int, time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.After(l.nextSweep) {
+		for k, w := range l.windows {
+			if !now.Before(w.reset) {
+				delete(l.windows, k)
+			}
+		}
+		l.nextSweep = now.Add(time.Minute)
+	}
+
+	id := scope.Name + "|" + key
+	w, ok := l.windows[id]
+	if !ok || !now.Before(w.reset) {
+		w = &rateWindow{reset: now.Add(scope.Window)}
+		l.windows[id] = w
+	}
+
+	if w.count >= scope.Limit {
+		return 0, w.reset, false
+	}
+	w.count++
+	return scope.Limit - w.count, w.reset, true
+}
+
+// RateLimitMiddleware applies the rate scope matching each request and
+// reports the budget in X-RateLimit-* headers. Requests over budget get 429
+// with Retry-After. Place it after AuthMiddleware so budgets are per user.
+func RateLimitMiddleware(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, ok := scopeFor(r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			remaining, reset, allowed := limiter.allow(scope, rateLimitKey(r))
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(scope.Limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			h.Set("X-RateLimit-Scope", scope.Name)
+
+			if !allowed {
+				retryAfter := int(time.Until(reset).Seconds() + 0.999)
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				h.Set("Retry-After", strconv.Itoa(retryAfter))
+				respondError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the client: the user when authenticated, the
+// remote IP otherwise.
+func rateLimitKey(r *http.Request) string {
+	if user := getUserFromContext(r); user != nil {
+		return "user:" + user.ID
+	}
+	return "ip:" + clientAddr(r)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// API versions understood by the response shaping layer.
+//
+// Version 1 is the original response shape and remains the default so that
+// existing clients keep working. Version 2 drops the legacy `metadata` and
+// `metadata_id` fields in favour of `resolved_metadata` and
+// `agent_metadata_id`.
+const (
+	apiVersionLegacy  = 1
+	apiVersionLayered = 2
+
+	apiVersionHeader = "X-API-Version"
+	apiVersionQuery  = "api_version"
+
+	// liteQuery selects the compact audiobook form, models.LiteAudiobook,
+	// whatever the API version.
+	liteQuery = "lite"
+)
+
+type apiVersionContextKey struct{}
+
+// APIVersionMiddleware reads the requested API version from the X-API-Version
+// header or the api_version query parameter and stores it on the context.
+func APIVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := parseAPIVersion(r)
+		w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+
+		ctx := context.WithValue(r.Context(), apiVersionContextKey{}, version)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func parseAPIVersion(r *http.Request) int {
+	raw := strings.TrimSpace(r.Header.Get(apiVersionHeader))
+	if raw == "" {
+		raw = strings.TrimSpace(r.URL.Query().Get(apiVersionQuery))
+	}
+	raw = strings.TrimPrefix(strings.ToLower(raw), "v")
+
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < apiVersionLegacy || version > apiVersionLayered {
+		return apiVersionLegacy
+	}
+	return version
+}
+
+// apiVersion returns the API version negotiated for the request.
+func apiVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionContextKey{}).(int); ok {
+		return version
+	}
+	return apiVersionLegacy
+}
+
+// legacyFieldsEnabled reports whether the client expects the legacy fields.
+func legacyFieldsEnabled(r *http.Request) bool {
+	return apiVersion(r) < apiVersionLayered
+}
+
+// liteEnabled reports whether the client asked for compact audiobooks with
+// ?lite=1.
+func liteEnabled(r *http.Request) bool {
+	lite, err := strconv.ParseBool(r.URL.Query().Get(liteQuery))
+	return err == nil && lite
+}
+
+// shapeAudiobook adapts a single audiobook to the negotiated response shape.
+func shapeAudiobook(r *http.Request, audiobook *models.Audiobook) *models.Audiobook {
+	if audiobook == nil {
+		return audiobook
+	}
+	if liteEnabled(r) {
+		audiobook.SetLite()
+		return audiobook
+	}
+	if !legacyFieldsEnabled(r) {
+		audiobook.DropLegacyFields()
+	}
+	return audiobook
+}
+
+// shapeAudiobooks adapts a list of audiobooks to the negotiated response shape.
+func shapeAudiobooks(r *http.Request, audiobooks []models.Audiobook) []models.Audiobook {
+	for i := range audiobooks {
+		shapeAudiobook(r, &audiobooks[i])
+	}
+	return audiobooks
+}
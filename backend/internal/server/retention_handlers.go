@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/lore/backend/internal/jobs"
+)
+
+const jobTypePruneHistory = "prune_history"
+
+func (h *handler) handleAdminRetentionGet(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.svc.RetentionSettings(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": settings})
+}
+
+// handleAdminRetentionUpdate changes the retention periods present in the
+// request and saves the settings.
+func (h *handler) handleAdminRetentionUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SessionDays  *int `json:"session_days"`
+		StatsDays    *int `json:"stats_days"`
+		ActivityDays *int `json:"activity_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	settings, err := h.svc.RetentionSettings(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if req.SessionDays != nil {
+		settings.SessionDays = *req.SessionDays
+	}
+	if req.StatsDays != nil {
+		settings.StatsDays = *req.StatsDays
+	}
+	if req.ActivityDays != nil {
+		settings.ActivityDays = *req.ActivityDays
+	}
+
+	if err := h.svc.UpdateRetentionSettings(r.Context(), settings); err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": settings})
+}
+
+// handleAdminPruneHistory queues a pruning of history past the retention
+// periods, which otherwise runs hourly.
+func (h *handler) handleAdminPruneHistory(w http.ResponseWriter, r *http.Request) {
+	job, started := h.jobs.Start(jobTypePruneHistory, "all", func(ctx context.Context, report jobs.ProgressFunc) (interface{}, error) {
+		return h.svc.PruneHistory(ctx)
+	})
+	respondJob(w, job, started)
+}
+
+func (h *handler) handlePrivacyGet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	settings, err := h.svc.PrivacySettings(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": settings})
+}
+
+// handlePrivacyUpdate saves the caller's privacy settings from
+// {"keep_listening_history": false, "share_activity": true,
+// "share_listening": true}; absent fields keep their value.
+func (h *handler) handlePrivacyUpdate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		KeepListeningHistory *bool `json:"keep_listening_history"`
+		ShareActivity        *bool `json:"share_activity"`
+		ShareListening       *bool `json:"share_listening"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	settings, err := h.svc.PrivacySettings(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if req.KeepListeningHistory != nil {
+		settings.KeepListeningHistory = *req.KeepListeningHistory
+	}
+	if req.ShareActivity != nil {
+		settings.ShareActivity = *req.ShareActivity
+	}
+	if req.ShareListening != nil {
+		settings.ShareListening = *req.ShareListening
+	}
+
+	saved, err := h.svc.SetPrivacySettings(r.Context(), user.ID, *settings)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": saved})
+}
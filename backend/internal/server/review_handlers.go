@@ -0,0 +1,79 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleReviewGet returns the caller's rating of an audiobook.
+func (h *handler) handleReviewGet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	review, err := h.svc.GetReview(r.Context(), user.ID, chi.URLParam(r, "audiobook_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "rating not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": review})
+}
+
+// handleReviewSet rates an audiobook from {"rating": 4.5, "review": "..."};
+// review is optional.
+func (h *handler) handleReviewSet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req struct {
+		Rating float64 `json:"rating"`
+		Review *string `json:"review"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	review, err := h.svc.SetReview(r.Context(), user.ID, chi.URLParam(r, "audiobook_id"), req.Rating, req.Review)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "audiobook not found in library")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": review})
+}
+
+// handleReviewDelete removes the caller's rating of an audiobook.
+func (h *handler) handleReviewDelete(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	if err := h.svc.DeleteReview(r.Context(), user.ID, chi.URLParam(r, "audiobook_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "rating not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -8,49 +9,142 @@ import (
 	"github.com/go-chi/cors"
 
 	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/backup"
+	"github.com/lore/backend/internal/dlna"
+	"github.com/lore/backend/internal/jobs"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/notify"
 	"github.com/lore/backend/internal/services/audiobooks"
 	importservice "github.com/lore/backend/internal/services/import"
 	"github.com/lore/backend/internal/services/library"
 	"github.com/lore/backend/internal/validation"
+	"github.com/lore/backend/internal/webhooks"
 )
 
 // New constructs the HTTP handler exposing the audiobook API.
-func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Service, importSvc *importservice.Service) http.Handler {
+func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Service, importSvc *importservice.Service, jobManager *jobs.Manager, notifier *notify.Notifier, hooks *webhooks.Service, backups *backup.Service, prober media.Prober, streamBufferSize int, dlnaCfg DLNAConfig) http.Handler {
 	validator := validation.NewValidator()
 	s := &handler{
-		svc:        svc,
-		authSvc:    authSvc,
-		librarySvc: librarySvc,
-		importSvc:  importSvc,
-		validator:  validator,
+		svc:          svc,
+		authSvc:      authSvc,
+		librarySvc:   librarySvc,
+		importSvc:    importSvc,
+		jobs:         jobManager,
+		notifier:     notifier,
+		webhooks:     hooks,
+		backups:      backups,
+		prober:       prober,
+		validator:    validator,
+		streamBuffer: streamBufferSize,
+		dlna:         dlnaCfg,
 	}
 
+	limiter := NewRateLimiter()
+
 	r := chi.NewRouter()
 
 	// Add middleware
-	r.Use(middleware.Logger)
+	r.Use(RequestLogger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "If-None-Match", "X-API-Version"},
+		ExposedHeaders:   []string{"ETag", "Link", "X-API-Version", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-RateLimit-Scope", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 	r.Use(ErrorMiddleware)
+	r.Use(APIVersionMiddleware)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		respondError(w, http.StatusNotFound, "route not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+
+	// Probes for container runtimes and reverse proxies.
+	r.Get("/healthz", s.handleHealthz)
+	r.Get("/readyz", s.handleReadyz)
+
+	// DLNA media server for smart speakers and TVs on the local network.
+	if dlnaCfg.Enabled() {
+		chi.RegisterMethod("SUBSCRIBE")
+		chi.RegisterMethod("UNSUBSCRIBE")
+		r.Group(func(r chi.Router) {
+			r.Use(dlnaLocalOnly)
+			r.Get(dlna.DevicePath, s.handleDLNADevice)
+			r.Get(dlna.ContentDirectorySCPDPath, s.handleDLNAContentDirectorySCPD)
+			r.Post(dlna.ContentDirectoryControlPath, s.handleDLNAContentDirectory)
+			r.Get(dlna.ConnectionManagerSCPDPath, s.handleDLNAConnectionManagerSCPD)
+			r.Post(dlna.ConnectionManagerControlPath, s.handleDLNAConnectionManager)
+			for _, path := range []string{dlna.ContentDirectoryEventPath, dlna.ConnectionManagerEventPath} {
+				r.MethodFunc("SUBSCRIBE", path, s.handleDLNASubscribe)
+				r.MethodFunc("UNSUBSCRIBE", path, s.handleDLNAUnsubscribe)
+			}
+		})
+	}
 
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/health", s.handleReadyz)
+
 		// Public authentication endpoints
-		r.Post("/auth/login", s.handleLogin)
+		r.Group(func(r chi.Router) {
+			r.Use(RateLimitMiddleware(limiter))
+
+			r.Post("/auth/login", s.handleLogin)
+			r.Post("/auth/register", s.handleRegister)
+			r.Get("/auth/providers", s.handleAuthProviders)
+			r.Get("/auth/oidc/login", s.handleOIDCLogin)
+			r.Get("/auth/oidc/callback", s.handleOIDCCallback)
+
+			// Feeds authenticate with ?token=<access token> since feed
+			// readers cannot send an Authorization header.
+			r.Get("/feeds/libraries/{library_id}/recent.rss", s.handleRecentFeed)
+			r.Get("/feeds/audiobooks/{audiobook_id}/cover", s.handleFeedCover)
+			r.Get("/feeds/audiobooks/{audiobook_id}/podcast.rss", s.handlePodcastFeed)
+			// Podcast enclosures authenticate with a signed ?token= instead.
+			r.Get("/feeds/media_files/{file_id}", s.handleFeedMediaFile)
+
+			// Catalog links show a library read-only without an account.
+			r.Get("/share/{token}", s.handleShareCatalog)
+			r.Get("/share/{token}/covers/{audiobook_id}", s.handleShareCover)
+		})
+
+		// Streams also accept a signed ?token= from
+		// POST /media_files/{file_id}/token for external players; HLS
+		// playlists and segments accept the token in a manifest's hls_url.
+		r.Group(func(r chi.Router) {
+			r.Use(StreamAuthMiddleware(authSvc))
+			r.Use(RateLimitMiddleware(limiter))
+
+			r.Get("/media_files/{file_id}", s.handleMediaFileStream)
+			r.Get("/hls/{audiobook_id}/playlist.m3u8", s.handleHLSPlaylist)
+			r.Get("/hls/{audiobook_id}/{index:[0-9]+}.ts", s.handleHLSSegment)
+		})
+
+		// Progress beacons cannot send an Authorization header and carry
+		// the API key in the body instead; the handler authenticates them.
+		r.Group(func(r chi.Router) {
+			r.Use(RateLimitMiddleware(limiter))
+
+			r.Post("/library/{audiobook_id}/progress/beacon", s.handleLibraryProgressBeacon)
+		})
 
 		// Protected routes - require authentication
 		r.Group(func(r chi.Router) {
 			r.Use(AuthMiddleware(authSvc))
+			r.Use(RateLimitMiddleware(limiter))
+			r.Use(FlushProgressMiddleware(svc))
 
 			// Logout endpoint (requires authentication)
 			r.Post("/auth/logout", s.handleLogout)
 
+			r.Get("/home", s.handleHome)
+			r.Get("/search", s.handleSearch)
+			r.Get("/browse", s.handleBrowse)
+			r.Post("/client-logs", s.handleClientLogCreate)
+
 			r.Route("/libraries", func(r chi.Router) {
 				r.Get("/", s.handleAvailableLibraries)
 
@@ -58,7 +152,12 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 					r.Get("/", s.handlePublicLibraryDetails)
 					r.Get("/books", s.handleLibraryBooksList)
 					r.Get("/books/search", s.handleLibraryBooksSearch)
+					r.Get("/books/letters", s.handleLibraryLetters)
 					r.Get("/books/{book_id}", s.handleLibraryBookGet)
+					r.Get("/books/{book_id}/similar", s.handleLibraryBookSimilar)
+					r.Get("/genres", s.handleLibraryGenres)
+					r.Get("/narrators", s.handleLibraryNarrators)
+					r.Get("/activity", s.handleLibraryActivity)
 				})
 			})
 
@@ -67,11 +166,23 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 				r.Get("/", s.handleLibraryList)
 				r.Get("/continue", s.handleLibraryContinue)
 				r.Get("/favorites", s.handleLibraryFavorites)
+				r.Get("/recommendations", s.handleRecommendations)
 
 				r.Route("/{audiobook_id}", func(r chi.Router) {
 					r.Get("/", s.handleLibraryGet)
 					r.Post("/progress", s.handleLibraryProgress)
 					r.Post("/favorite", s.handleLibraryFavorite)
+					r.Get("/rating", s.handleReviewGet)
+					r.Put("/rating", s.handleReviewSet)
+					r.Delete("/rating", s.handleReviewDelete)
+					r.Get("/bookmarks", s.handleBookmarkList)
+					r.Post("/bookmarks", s.handleBookmarkCreate)
+					r.Delete("/bookmarks/{bookmark_id}", s.handleBookmarkDelete)
+					r.Get("/cover", s.handleCoverGet)
+					r.Get("/download", s.handleLibraryDownload)
+					r.Post("/download-manifest", s.handleLibraryDownloadManifest)
+					r.Get("/stream", s.handleLibraryStream)
+					r.Get("/playback-manifest", s.handleLibraryPlaybackManifest)
 				})
 			})
 
@@ -79,6 +190,23 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/me", s.handleUserProfile)
 				r.Patch("/me", s.handleUserUpdateProfile)
+				r.Get("/me/notifications", s.handleNotificationSettingsGet)
+				r.Put("/me/notifications", s.handleNotificationSettingsUpdate)
+				r.Post("/me/notifications/test", s.handleNotificationTest)
+				r.Get("/me/feed-token", s.handleFeedToken)
+				r.Post("/me/feed-token", s.handleFeedTokenRotate)
+				r.Get("/me/listening-stats", s.handleListeningStats)
+				r.Get("/me/goals", s.handleGoalsGet)
+				r.Put("/me/goals", s.handleGoalsUpdate)
+				r.Get("/me/privacy", s.handlePrivacyGet)
+				r.Put("/me/privacy", s.handlePrivacyUpdate)
+				r.Get("/me/data-export", s.handleDataExport)
+				r.Get("/me/erasure-request", s.handleErasureRequestGet)
+				r.Post("/me/erasure-request", s.handleErasureRequestCreate)
+				r.Delete("/me/erasure-request", s.handleErasureRequestCancel)
+				r.Get("/me/tokens", s.handleTokenList)
+				r.Post("/me/tokens", s.handleTokenCreate)
+				r.Delete("/me/tokens/{token_id}", s.handleTokenRevoke)
 			})
 
 			// Admin-only endpoints
@@ -89,6 +217,7 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 				r.Route("/library-paths", func(r chi.Router) {
 					r.Get("/", s.handleAdminLibraryPathList)
 					r.Post("/", s.handleAdminLibraryPathCreate)
+					r.Get("/validate", s.handleAdminLibraryPathValidate)
 					r.Patch("/{id}", s.handleAdminLibraryPathUpdate)
 					r.Delete("/{id}", s.handleAdminLibraryPathDelete)
 				})
@@ -132,11 +261,17 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 					r.Get("/", s.handleAdminLibraryList)
 					r.Post("/", s.handleAdminLibraryCreate)
 					r.Post("/scan", s.handleAdminLibraryScanAll)
+					r.Get("/settings-schema", s.handleAdminLibrarySettingsSchema)
 					r.Get("/{id}", s.handleAdminLibraryGet)
 					r.Patch("/{id}", s.handleAdminLibraryUpdate)
 					r.Delete("/{id}", s.handleAdminLibraryDelete)
+					r.Get("/{id}/access", s.handleAdminLibraryAccessGet)
+					r.Put("/{id}/access", s.handleAdminLibraryAccessSet)
 					r.Post("/{id}/directories", s.handleAdminLibrarySetDirectories)
 					r.Post("/{id}/scan", s.handleAdminLibraryScanOne)
+					r.Post("/{id}/write-tags", s.handleAdminLibraryWriteTags)
+					r.Post("/{id}/import-progress", s.handleAdminLibraryImportProgress)
+					r.Post("/{id}/read-sidecars", s.handleAdminLibraryReadSidecars)
 				})
 
 				// Import operations
@@ -151,9 +286,23 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 				// Audiobook management
 				r.Route("/audiobooks", func(r chi.Router) {
 					r.Post("/", s.handleAdminAudiobookCreate)
+					r.Post("/organize", s.handleAdminOrganize)
+					r.Post("/bulk", s.handleAdminAudiobookBulk)
+					r.Get("/duplicates", s.handleAdminDuplicates)
+					r.Get("/metadata-gaps", s.handleAdminMetadataGaps)
+					r.Get("/missing", s.handleAdminMissingAudiobooks)
 					r.Delete("/{audiobook_id}", s.handleAdminAudiobookDelete)
 					r.Put("/{audiobook_id}/link", s.handleLinkMetadata)
 					r.Delete("/{audiobook_id}/link", s.handleAdminAudiobookUnlink)
+					r.Get("/{audiobook_id}/access", s.handleAdminAudiobookAccessGet)
+					r.Put("/{audiobook_id}/access", s.handleAdminAudiobookAccessSet)
+					r.Post("/{audiobook_id}/cover", s.handleAdminCoverUpload)
+					r.Post("/{audiobook_id}/merge", s.handleAdminMergeM4B)
+					r.Post("/{audiobook_id}/move", s.handleAdminAudiobookMove)
+					r.Post("/{audiobook_id}/write-tags", s.handleAdminWriteTags)
+					r.Put("/{audiobook_id}/track-order", s.handleAdminTrackOrder)
+					r.Put("/{audiobook_id}/editions", s.handleAdminLinkEditions)
+					r.Delete("/{audiobook_id}/editions", s.handleAdminUnlinkEdition)
 
 					// Metadata management
 					r.Route("/{id}/metadata", func(r chi.Router) {
@@ -165,12 +314,98 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 					})
 				})
 
+				r.Route("/invites", func(r chi.Router) {
+					r.Get("/", s.handleAdminInviteList)
+					r.Post("/", s.handleAdminInviteCreate)
+					r.Delete("/{invite_id}", s.handleAdminInviteDelete)
+				})
+
+				r.Post("/migrations/audiobookshelf", s.handleAdminMigrateAudiobookshelf)
+
+				r.Route("/tokens", func(r chi.Router) {
+					r.Get("/", s.handleAdminTokenList)
+					r.Get("/events", s.handleAdminTokenEvents)
+					r.Delete("/{token_id}", s.handleAdminTokenRevoke)
+				})
+
+				r.Route("/custom-fields", func(r chi.Router) {
+					r.Get("/", s.handleAdminCustomFieldList)
+					r.Post("/", s.handleAdminCustomFieldCreate)
+					r.Patch("/{key}", s.handleAdminCustomFieldUpdate)
+					r.Delete("/{key}", s.handleAdminCustomFieldDelete)
+				})
+
+				r.Route("/metadata-agents", func(r chi.Router) {
+					r.Get("/", s.handleAdminMetadataAgentList)
+					r.Post("/", s.handleAdminMetadataAgentCreate)
+					r.Get("/{agent_id}", s.handleAdminMetadataAgentGet)
+					r.Patch("/{agent_id}", s.handleAdminMetadataAgentUpdate)
+					r.Delete("/{agent_id}", s.handleAdminMetadataAgentDelete)
+					r.Post("/{agent_id}/test", s.handleAdminMetadataAgentTest)
+				})
+
+				r.Route("/webhooks", func(r chi.Router) {
+					r.Get("/", s.handleAdminWebhookList)
+					r.Post("/", s.handleAdminWebhookCreate)
+					r.Get("/{webhook_id}", s.handleAdminWebhookGet)
+					r.Patch("/{webhook_id}", s.handleAdminWebhookUpdate)
+					r.Delete("/{webhook_id}", s.handleAdminWebhookDelete)
+					r.Post("/{webhook_id}/test", s.handleAdminWebhookTest)
+				})
+
 				r.Route("/users", func(r chi.Router) {
 					r.Get("/", s.handleAdminUserList)
 					r.Post("/", s.handleAdminUserCreate)
 					r.Get("/{user_id}", s.handleAdminUserGet)
 					r.Patch("/{user_id}", s.handleAdminUserUpdate)
 					r.Delete("/{user_id}", s.handleAdminUserDelete)
+					r.Post("/{user_id}/approve", s.handleAdminUserApprove)
+				})
+
+				r.Route("/erasure-requests", func(r chi.Router) {
+					r.Get("/", s.handleAdminErasureRequestList)
+					r.Post("/{request_id}/approve", s.handleAdminErasureApprove)
+					r.Post("/{request_id}/reject", s.handleAdminErasureReject)
+				})
+
+				r.Get("/registration", s.handleAdminRegistrationGet)
+				r.Put("/registration", s.handleAdminRegistrationUpdate)
+
+				r.Get("/retention", s.handleAdminRetentionGet)
+				r.Put("/retention", s.handleAdminRetentionUpdate)
+
+				// Listening sessions with a recent progress update
+				r.Get("/sessions", s.handleAdminSessionList)
+				r.Get("/listening-stats", s.handleAdminListeningReport)
+
+				// Download audit trail
+				r.Get("/downloads", s.handleAdminDownloadList)
+				r.Get("/downloads/report", s.handleAdminDownloadReport)
+
+				// Error reports submitted by clients
+				r.Get("/client-logs", s.handleAdminClientLogList)
+				r.Get("/client-logs/{log_id}", s.handleAdminClientLogGet)
+
+				// Maintenance operations (run as background jobs)
+				r.Post("/maintenance/resolve-metadata", s.handleAdminResolveMetadata)
+				r.Post("/maintenance/detect-mime", s.handleAdminDetectMime)
+				r.Post("/maintenance/prune-history", s.handleAdminPruneHistory)
+				r.Post("/backup", s.handleAdminBackupCreate)
+				r.Get("/backups", s.handleAdminBackupList)
+				r.Get("/backups/{name}", s.handleAdminBackupDownload)
+				r.Delete("/backups/{name}", s.handleAdminBackupDelete)
+				r.Get("/media/mime-mismatches", s.handleAdminMimeMismatches)
+				r.Get("/metrics/http", s.handleAdminOutboundStats)
+				r.Get("/metrics/auth", s.handleAdminAuthFailures)
+				r.Get("/metrics/scans", s.handleAdminScanProfiles)
+				r.Get("/cache", s.handleAdminCacheStats)
+				r.Delete("/cache", s.handleAdminCacheClear)
+				r.Get("/providers/health", s.handleAdminProviderHealth)
+				r.Get("/providers/cache", s.handleAdminProviderCacheStats)
+				r.Delete("/providers/cache", s.handleAdminProviderCacheClear)
+				r.Route("/jobs", func(r chi.Router) {
+					r.Get("/", s.handleAdminJobList)
+					r.Get("/{job_id}", s.handleAdminJobGet)
 				})
 
 				r.Get("/filesystem/{root}/browse", s.handleAdminBrowseRoot)
@@ -182,7 +417,9 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 			r.Get("/metadata/search", s.handleSearchMetadata)
 
 			// Media streaming (authorization checked within handler)
-			r.Get("/media_files/{file_id}", s.handleMediaFileStream)
+			r.Post("/media_files/{file_id}/token", s.handleMediaFileToken)
+			r.Get("/media_files/{file_id}/playback", s.handleMediaFilePlayback)
+			r.Get("/supplement_files/{file_id}", s.handleSupplementFileDownload)
 		})
 	})
 
@@ -190,11 +427,18 @@ func New(svc *audiobooks.Service, authSvc *auth.Service, librarySvc *library.Ser
 }
 
 type handler struct {
-	svc        *audiobooks.Service
-	authSvc    *auth.Service
-	librarySvc *library.Service
-	importSvc  *importservice.Service
-	validator  *validation.Validator
+	svc          *audiobooks.Service
+	authSvc      *auth.Service
+	librarySvc   *library.Service
+	importSvc    *importservice.Service
+	jobs         *jobs.Manager
+	notifier     *notify.Notifier
+	webhooks     *webhooks.Service
+	backups      *backup.Service
+	prober       media.Prober
+	validator    *validation.Validator
+	streamBuffer int // copy buffer size for transcoded streams
+	dlna         DLNAConfig
 }
 
 // Request/Response types
@@ -235,7 +479,7 @@ type createLibraryRequest struct {
 	DisplayName  string                 `json:"display_name"`
 	Type         string                 `json:"type"`
 	Description  *string                `json:"description"`
-	Settings     map[string]interface{} `json:"settings"`
+	Settings     json.RawMessage        `json:"settings"`
 	DirectoryIDs []string               `json:"directory_ids"`
 }
 
@@ -243,7 +487,7 @@ type updateLibraryRequest struct {
 	DisplayName  *string                 `json:"display_name"`
 	Description  *string                 `json:"description"`
 	Type         *string                 `json:"type"`
-	Settings     *map[string]interface{} `json:"settings"`
+	Settings     json.RawMessage         `json:"settings"`
 	DirectoryIDs *[]string               `json:"directory_ids"`
 }
 
@@ -251,6 +495,10 @@ type libraryDirectoriesRequest struct {
 	DirectoryIDs []string `json:"directory_ids"`
 }
 
+type progressImportRequest struct {
+	UserID string `json:"user_id"`
+}
+
 type paginatedResponse struct {
 	Data       interface{} `json:"data"`
 	Pagination *struct {
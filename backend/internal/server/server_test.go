@@ -0,0 +1,328 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/backup"
+	"github.com/lore/backend/internal/covers"
+	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/jobs"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/notify"
+	"github.com/lore/backend/internal/repository"
+	"github.com/lore/backend/internal/services/audiobooks"
+	importservice "github.com/lore/backend/internal/services/import"
+	"github.com/lore/backend/internal/services/library"
+	"github.com/lore/backend/internal/testdata"
+	"github.com/lore/backend/internal/webhooks"
+)
+
+// newTestServer serves the API on a fresh database and returns it with the
+// API key of an admin.
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	handler, _, apiKey := newTestHandler(t)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv, apiKey
+}
+
+// newTestHandler builds the API on a fresh database and returns it with the
+// database and the API key of an admin.
+func newTestHandler(tb testing.TB) (http.Handler, *sql.DB, string) {
+	tb.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	tb.Cleanup(cancel)
+
+	dir := tb.TempDir()
+	db, err := database.Open(filepath.Join(dir, "lore.db"), database.DefaultOptions())
+	if err != nil {
+		tb.Fatalf("open database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	repo := repository.New(db)
+	authSvc := auth.NewService(db)
+	admin, err := authSvc.CreateUser(ctx, "owner", "password123", true)
+	if err != nil {
+		tb.Fatalf("create admin: %v", err)
+	}
+	detector := media.Detector{}
+	svc := audiobooks.New(repo, metadata.NoopProvider{}, detector, covers.NewStore(filepath.Join(dir, "covers"), covers.NewProcessor(1)))
+	handler := New(svc, authSvc,
+		library.NewService(repo, dir, detector),
+		importservice.NewService(repo, dir, detector),
+		jobs.NewManager(ctx),
+		notify.New(repo),
+		webhooks.NewService(ctx, repo),
+		backup.NewService(db, filepath.Join(dir, "backups"), filepath.Join(dir, "covers")),
+		nil, 0, DLNAConfig{})
+	return handler, db, *admin.APIKey
+}
+
+// TestResponseEnvelope checks the API contract: successful responses carry
+// their payload under "data", errors an "error" message, a machine-readable
+// "code" and the "status", all as JSON.
+func TestResponseEnvelope(t *testing.T) {
+	srv, apiKey := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		auth   bool
+		status int
+		code   string
+		field  string
+	}{
+		{name: "list", method: http.MethodGet, path: "/api/v1/libraries", auth: true, status: http.StatusOK},
+		{name: "continue listening", method: http.MethodGet, path: "/api/v1/library/continue", auth: true, status: http.StatusOK},
+		{name: "missing credentials", method: http.MethodGet, path: "/api/v1/libraries", status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "wrong password", method: http.MethodPost, path: "/api/v1/auth/login", body: `{"username":"owner","password":"nope"}`, status: http.StatusUnauthorized, code: "invalid_credentials"},
+		{name: "invalid parameter", method: http.MethodGet, path: "/api/v1/libraries/lib/books?limit=500", auth: true, status: http.StatusBadRequest, code: "validation_failed", field: "limit"},
+		{name: "malformed body", method: http.MethodPatch, path: "/api/v1/admin/audiobooks/book/metadata", body: `{`, auth: true, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "missing metadata title", method: http.MethodGet, path: "/api/v1/metadata/search", auth: true, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "unknown route", method: http.MethodGet, path: "/api/v1/nothing-here", auth: true, status: http.StatusNotFound, code: "not_found"},
+		{name: "wrong method", method: http.MethodDelete, path: "/api/v1/auth/login", status: http.StatusMethodNotAllowed, code: "method_not_allowed"},
+		// Logging out rotates the API key, so it goes last.
+		{name: "logout", method: http.MethodPost, path: "/api/v1/auth/logout", auth: true, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Fatalf("Content-Type = %q, want application/json", ct)
+			}
+			var body map[string]json.RawMessage
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+
+			if tt.code == "" {
+				if _, ok := body["data"]; !ok {
+					t.Errorf("success body has no data: %v", keys(body))
+				}
+				if _, ok := body["error"]; ok {
+					t.Errorf("success body has an error: %s", body["error"])
+				}
+				return
+			}
+
+			for _, name := range []string{"error", "code", "status"} {
+				if _, ok := body[name]; !ok {
+					t.Fatalf("error body has no %s: %v", name, keys(body))
+				}
+			}
+			var e errorResponse
+			raw, _ := json.Marshal(body)
+			if err := json.Unmarshal(raw, &e); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if e.Code != tt.code || e.Status != tt.status || e.Error == "" || e.Field != tt.field {
+				t.Errorf("error = %+v, want code %q, status %d, field %q and a message", e, tt.code, tt.status, tt.field)
+			}
+		})
+	}
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestConditionalListing(t *testing.T) {
+	srv, apiKey := newTestServer(t)
+
+	get := func(etag string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/libraries", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	first := get("")
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d, ETag = %q; want 200 with an ETag", first.StatusCode, etag)
+	}
+	if resp := get(etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("status with If-None-Match %s = %d, want 304", etag, resp.StatusCode)
+	}
+	if resp := get(`"stale"`); resp.StatusCode != http.StatusOK {
+		t.Errorf("status with a stale ETag = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	body := strings.Repeat(`{"title":"The Name of the Wind","description":"A long description."}`, 100)
+	handler := CompressMiddleware(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/audio" {
+			w.Header().Set("Content-Type", "audio/mpeg")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.Copy(w, strings.NewReader(body))
+	}))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+		etag           string
+	}{
+		{path: "/json", acceptEncoding: "gzip, deflate", encoding: "gzip", etag: `W/"v1"`},
+		{path: "/json", acceptEncoding: "deflate, gzip;q=0", encoding: "deflate", etag: `W/"v1"`},
+		{path: "/json", acceptEncoding: "", encoding: "", etag: `"v1"`},
+		{path: "/audio", acceptEncoding: "gzip", encoding: "", etag: `"v1"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s with Accept-Encoding %q: Content-Encoding = %q, want %q", tt.path, tt.acceptEncoding, got, tt.encoding)
+		}
+		if got := rec.Header().Get("ETag"); got != tt.etag {
+			t.Errorf("%s with Accept-Encoding %q: ETag = %q, want %q", tt.path, tt.acceptEncoding, got, tt.etag)
+		}
+		if tt.encoding != "gzip" {
+			continue
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != body {
+			t.Errorf("decompressed body differs from the original")
+		}
+	}
+}
+
+func TestRequestLoggerRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	logger := middleware.RequestLogger(redactingLogFormatter{
+		LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(&buf, "", 0), NoColor: true},
+	})
+	handler := logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.String(), "s3cret") {
+			t.Errorf("handler saw %s, want the original URL", r.URL)
+		}
+	}))
+
+	tests := []struct {
+		target string
+		logged string
+	}{
+		{target: "/api/v1/feeds/media_files/file-1?token=s3cret&start=10", logged: "/api/v1/feeds/media_files/file-1?start=10&token=REDACTED"},
+		{target: "/api/v1/share/s3cret?limit=5", logged: "/api/v1/share/REDACTED?limit=5"},
+		{target: "/api/v1/share/s3cret/covers/book-1", logged: "/api/v1/share/REDACTED/covers/book-1"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+		logged := buf.String()
+		if strings.Contains(logged, "s3cret") {
+			t.Errorf("log line contains the token: %s", logged)
+		}
+		if !strings.Contains(logged, tt.logged) {
+			t.Errorf("log line = %q, want %s", logged, tt.logged)
+		}
+	}
+}
+
+// BenchmarkLibraryBooksList serves a page of seeded books with descriptions
+// through the compression middleware, reporting the bytes sent per response.
+// The listing is fetched once and replayed, as the rate limiter would turn
+// away most of b.N requests.
+func BenchmarkLibraryBooksList(b *testing.B) {
+	handler, db, apiKey := newTestHandler(b)
+	if err := testdata.SeedTestBooks(context.Background(), db); err != nil {
+		b.Fatalf("seed books: %v", err)
+	}
+	var libraryID string
+	if err := db.QueryRow(`SELECT id FROM libraries WHERE name = 'fiction-library'`).Scan(&libraryID); err != nil {
+		b.Fatalf("find library: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/libraries/"+libraryID+"/books?limit=100", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		b.Fatalf("status = %d: %s", rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	listing := rec.Body.Bytes()
+
+	list := CompressMiddleware(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondJSONConditional(w, r, json.RawMessage(listing))
+	}))
+	for _, encoding := range []string{"identity", "gzip", "deflate"} {
+		b.Run(encoding, func(b *testing.B) {
+			b.SetBytes(int64(len(listing)))
+			var size int
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/api/v1/libraries/"+libraryID+"/books?limit=100", nil)
+				req.Header.Set("Accept-Encoding", encoding)
+				rec := httptest.NewRecorder()
+				list.ServeHTTP(rec, req)
+				size = rec.Body.Len()
+			}
+			b.ReportMetric(float64(size), "bytes/resp")
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+// maxStatsDays bounds the days of listening stats returned at once.
+const maxStatsDays = 366
+
+// handleListeningStats returns the caller's listening time per day. days
+// sets how many days back to go, 30 by default.
+func (h *handler) handleListeningStats(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		parsed, err := strconv.Atoi(daysStr)
+		if err != nil || parsed < 1 || parsed > maxStatsDays {
+			handleError(w, apperrors.NewValidationError("days", "invalid days value (must be 1-366)", daysStr))
+			return
+		}
+		days = parsed
+	}
+
+	stats, err := h.svc.ListeningStats(r.Context(), user.ID, days)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": stats})
+}
+
+// handleGoalsGet returns the caller's listening goals and their progress.
+func (h *handler) handleGoalsGet(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	progress, err := h.svc.GetGoalProgress(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": progress})
+}
+
+// handleGoalsUpdate replaces the caller's listening goals. Omitted or null
+// targets are cleared.
+func (h *handler) handleGoalsUpdate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var goals models.ListeningGoals
+	if err := json.NewDecoder(r.Body).Decode(&goals); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	progress, err := h.svc.SetListeningGoals(r.Context(), user.ID, goals)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": progress})
+}
+
+// handleAdminSessionList lists who is listening to what right now.
+func (h *handler) handleAdminSessionList(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.svc.ListActiveSessions(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": sessions})
+}
+
+// handleAdminListeningReport totals each user's listening, optionally
+// between ?since= and ?until= days (YYYY-MM-DD, inclusive).
+func (h *handler) handleAdminListeningReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	report, err := h.svc.ListeningReport(r.Context(), query.Get("since"), query.Get("until"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": report})
+}
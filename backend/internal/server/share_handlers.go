@@ -0,0 +1,102 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/auth"
+	"github.com/lore/backend/internal/models"
+)
+
+// authenticateCatalog checks a catalog link's token and returns the library
+// it shows. Links stop working once their issuer is no longer an admin.
+func (h *handler) authenticateCatalog(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, token, err := h.authSvc.AuthenticateToken(r.Context(), chi.URLParam(r, "token"), "", clientAddr(r), models.TokenScopeCatalog)
+	if err == nil && (!user.IsAdmin || token.LibraryID == nil) {
+		err = auth.ErrInvalidFeedToken
+	}
+	if err != nil {
+		respondAuthError(w, r, err)
+		return "", false
+	}
+	return *token.LibraryID, true
+}
+
+// handleShareCatalog lists the books of the library a catalog link shows,
+// by title. Books with access rules are left out, and nothing links to
+// their media.
+func (h *handler) handleShareCatalog(w http.ResponseWriter, r *http.Request) {
+	libraryID, ok := h.authenticateCatalog(w, r)
+	if !ok {
+		return
+	}
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	library, err := h.librarySvc.GetLibrary(r.Context(), libraryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "library not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	books, total, err := h.svc.CatalogBooks(r.Context(), library.ID, offset, limit)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	token := chi.URLParam(r, "token")
+	for i := range books {
+		books[i].CoverURL = catalogCoverURL(books[i].ID, books[i].CoverURL, token)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": models.Catalog{LibraryID: library.ID, Name: library.DisplayName, Books: books},
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
+
+// handleShareCover serves the cover of a book listed by a catalog link. It
+// takes ?size= like GET /library/{audiobook_id}/cover.
+func (h *handler) handleShareCover(w http.ResponseWriter, r *http.Request) {
+	libraryID, ok := h.authenticateCatalog(w, r)
+	if !ok {
+		return
+	}
+	size, err := coverSize(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	path, err := h.svc.CatalogCoverPath(r.Context(), libraryID, chi.URLParam(r, "audiobook_id"), size)
+	if err != nil {
+		respondCoverError(w, err)
+		return
+	}
+
+	serveCover(w, r, path)
+}
+
+// catalogCoverURL points uploaded covers and the server's copies of remote
+// covers at the catalog link's cover route.
+func catalogCoverURL(audiobookID string, coverURL *string, token string) *string {
+	if coverURL == nil || (*coverURL != models.CoverURL(audiobookID) && !models.IsRemoteURL(*coverURL)) {
+		return nil
+	}
+	shared := "/api/v1/share/" + url.PathEscape(token) + "/covers/" + url.PathEscape(audiobookID)
+	return &shared
+}
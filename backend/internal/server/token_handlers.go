@@ -0,0 +1,146 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// handleTokenList lists the caller's access tokens without their secrets.
+func (h *handler) handleTokenList(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	tokens, err := h.authSvc.ListTokens(r.Context(), user.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": tokens})
+}
+
+// handleTokenCreate issues an access token for the caller. The secret is
+// only returned here. Only admins issue catalog tokens.
+func (h *handler) handleTokenCreate(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	var req models.AccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.AudiobookID != nil && *req.AudiobookID != "" {
+		if _, err := h.svc.GetLibraryItem(r.Context(), *req.AudiobookID, user.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, http.StatusNotFound, "audiobook not found")
+				return
+			}
+			handleError(w, err)
+			return
+		}
+	}
+	if req.Scope == models.TokenScopeCatalog {
+		// A catalog link shows a library to people without an account.
+		if !user.IsAdmin {
+			respondError(w, http.StatusForbidden, "only admins can issue catalog tokens")
+			return
+		}
+		if req.LibraryID != nil && *req.LibraryID != "" {
+			if _, err := h.librarySvc.GetLibrary(r.Context(), *req.LibraryID); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					respondError(w, http.StatusNotFound, "library not found")
+					return
+				}
+				handleError(w, err)
+				return
+			}
+		}
+	}
+
+	token, err := h.authSvc.IssueToken(r.Context(), user.ID, user.ID, req, clientAddr(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": token})
+}
+
+// handleTokenRevoke revokes one of the caller's access tokens.
+func (h *handler) handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	if err := h.authSvc.RevokeToken(r.Context(), chi.URLParam(r, "token_id"), user.ID, user.ID, clientAddr(r)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "token not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminTokenList lists every user's access tokens, or one user's with
+// ?user_id=.
+func (h *handler) handleAdminTokenList(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.authSvc.ListTokens(r.Context(), r.URL.Query().Get("user_id"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": tokens})
+}
+
+// handleAdminTokenRevoke revokes any user's access token.
+func (h *handler) handleAdminTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromContext(r)
+	if admin == nil {
+		respondError(w, http.StatusUnauthorized, "user not found in context")
+		return
+	}
+
+	if err := h.authSvc.RevokeToken(r.Context(), chi.URLParam(r, "token_id"), "", admin.ID, clientAddr(r)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "token not found")
+			return
+		}
+		handleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminTokenEvents returns the access token audit trail, optionally
+// for one ?token_id= or ?user_id=.
+func (h *handler) handleAdminTokenEvents(w http.ResponseWriter, r *http.Request) {
+	offset, limit := getPagination(r)
+	query := r.URL.Query()
+	events, err := h.authSvc.ListTokenEvents(r.Context(), query.Get("token_id"), query.Get("user_id"), offset, limit)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": events,
+		"pagination": map[string]interface{}{
+			"offset": offset,
+			"limit":  limit,
+		},
+	})
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/webhooks"
+)
+
+type webhookRequest struct {
+	URL     *string   `json:"url"`
+	Events  *[]string `json:"events"`
+	Secret  *string   `json:"secret"`
+	Enabled *bool     `json:"enabled"`
+}
+
+// apply copies the fields present in the request onto hook and validates
+// the result.
+func (req webhookRequest) apply(hook *models.Webhook) error {
+	if req.URL != nil {
+		hook.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Events != nil {
+		hook.Events = *req.Events
+	}
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+
+	if !validHTTPURL(hook.URL) {
+		return errors.New("url must be an http or https URL")
+	}
+	if len(hook.Events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, event := range hook.Events {
+		if !webhooks.ValidEvent(event) {
+			return fmt.Errorf("unknown event %q (expected one of %s)", event, strings.Join(webhooks.Events, ", "))
+		}
+	}
+	return nil
+}
+
+// validHTTPURL reports whether raw is an absolute http or https URL.
+func validHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (h *handler) handleAdminWebhookList(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.webhooks.List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": hooks})
+}
+
+// handleAdminWebhookCreate registers a webhook. A signing secret is generated
+// when the request does not supply one.
+func (h *handler) handleAdminWebhookCreate(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	hook := &models.Webhook{Enabled: true}
+	if err := req.apply(hook); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.webhooks.Create(r.Context(), hook); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"data": hook})
+}
+
+func (h *handler) handleAdminWebhookGet(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": hook})
+}
+
+func (h *handler) handleAdminWebhookUpdate(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Secret != nil && *req.Secret == "" {
+		respondError(w, http.StatusBadRequest, "secret cannot be empty")
+		return
+	}
+	if err := req.apply(hook); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.webhooks.Update(r.Context(), hook); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{"data": hook})
+}
+
+func (h *handler) handleAdminWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhooks.Delete(r.Context(), chi.URLParam(r, "webhook_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminWebhookTest sends a single ping to the webhook and reports
+// whether the receiver accepted it.
+func (h *handler) handleAdminWebhookTest(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhooks.Test(r.Context(), hook); err != nil {
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadWebhook fetches the webhook named in the URL, writing an error
+// response and returning false when it cannot.
+func (h *handler) loadWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	hook, err := h.webhooks.Get(r.Context(), chi.URLParam(r, "webhook_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "webhook not found")
+			return nil, false
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return hook, true
+}
@@ -0,0 +1,186 @@
+package audiobooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+)
+
+// maxErasureTextLength bounds the reason and admin note of an erasure
+// request, in characters.
+const maxErasureTextLength = 2000
+
+var (
+	ErrErasurePending = apperrors.NewHTTPError(http.StatusConflict, "An erasure request is already pending", nil)
+	ErrErasureDecided = apperrors.NewHTTPError(http.StatusConflict, "The erasure request was already decided", nil)
+)
+
+// ExportUserData collects everything stored about user apart from their
+// access tokens, which the auth service holds.
+func (s *Service) ExportUserData(ctx context.Context, user models.User) (*models.UserDataExport, error) {
+	// The API key is a credential rather than personal data.
+	user.APIKey = nil
+	export := &models.UserDataExport{
+		ExportedAt:   time.Now().UTC().Truncate(time.Second),
+		Profile:      user,
+		AccessTokens: []models.AccessToken{},
+	}
+
+	var err error
+	if export.Progress, err = s.repo.ListUserProgress(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if export.Sessions, err = s.repo.ListUserSessions(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetListeningStats(ctx, user.ID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	export.ListeningDays = stats.Days
+	if export.Reviews, err = s.repo.ListUserReviews(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if export.Bookmarks, err = s.repo.ListUserBookmarks(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	goals, err := s.repo.GetListeningGoals(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Goals = *goals
+	privacy, err := s.repo.GetPrivacySettings(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Privacy = *privacy
+	notifications, err := s.repo.GetNotificationSettings(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Notifications = *notifications
+
+	// A limit of -1 lifts SQLite's limit.
+	if export.Downloads, _, err = s.repo.ListDownloads(ctx, models.DownloadFilter{UserID: &user.ID}, 0, -1); err != nil {
+		return nil, err
+	}
+	if export.ClientLogs, _, err = s.repo.ListClientLogs(ctx, models.ClientLogFilter{UserID: &user.ID}, 0, -1); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// RequestErasure asks for userID's account to be erased once an admin
+// approves it.
+func (s *Service) RequestErasure(ctx context.Context, userID string, reason *string) (*models.ErasureRequest, error) {
+	reason, err := erasureText("reason", reason)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := s.repo.GetLatestErasureRequest(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if latest != nil && latest.Status == models.ErasurePending {
+		return nil, ErrErasurePending
+	}
+	return s.repo.CreateErasureRequest(ctx, userID, reason)
+}
+
+// GetErasureRequest returns an erasure request, or sql.ErrNoRows if there
+// is none.
+func (s *Service) GetErasureRequest(ctx context.Context, id string) (*models.ErasureRequest, error) {
+	return s.repo.GetErasureRequest(ctx, id)
+}
+
+// LatestErasureRequest returns userID's most recent erasure request, or
+// sql.ErrNoRows if they never made one.
+func (s *Service) LatestErasureRequest(ctx context.Context, userID string) (*models.ErasureRequest, error) {
+	return s.repo.GetLatestErasureRequest(ctx, userID)
+}
+
+// CancelErasure withdraws userID's pending erasure request.
+func (s *Service) CancelErasure(ctx context.Context, userID string) error {
+	return s.repo.CancelErasureRequest(ctx, userID)
+}
+
+// ListErasureRequests returns erasure requests with the given status, or
+// all of them when status is empty.
+func (s *Service) ListErasureRequests(ctx context.Context, status string) ([]models.ErasureRequest, error) {
+	switch status {
+	case "", models.ErasurePending, models.ErasureApproved, models.ErasureRejected:
+	default:
+		return nil, apperrors.NewValidationError("status", "status must be pending, approved or rejected", status)
+	}
+	return s.repo.ListErasureRequests(ctx, status)
+}
+
+// ApproveErasure erases the account of a pending erasure request; see
+// repository.EraseUser for what is kept in anonymized form.
+func (s *Service) ApproveErasure(ctx context.Context, requestID, adminID string, note *string) (*models.ErasureRequest, *models.ErasureResult, error) {
+	note, err := erasureText("note", note)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := s.repo.GetErasureRequest(ctx, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Status != models.ErasurePending {
+		return nil, nil, ErrErasureDecided
+	}
+	result, err := s.repo.EraseUser(ctx, requestID, adminID, note)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: req.UserID})
+
+	req, err = s.repo.GetErasureRequest(ctx, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, result, nil
+}
+
+// RejectErasure declines a pending erasure request, leaving the account as
+// it is.
+func (s *Service) RejectErasure(ctx context.Context, requestID, adminID string, note *string) (*models.ErasureRequest, error) {
+	note, err := erasureText("note", note)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s.repo.GetErasureRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != models.ErasurePending {
+		return nil, ErrErasureDecided
+	}
+	if err := s.repo.RejectErasureRequest(ctx, requestID, adminID, note); err != nil {
+		return nil, err
+	}
+	return s.repo.GetErasureRequest(ctx, requestID)
+}
+
+// erasureText trims an optional reason or note, dropping it when blank.
+func erasureText(field string, text *string) (*string, error) {
+	if text == nil {
+		return nil, nil
+	}
+	trimmed := strings.TrimSpace(*text)
+	if trimmed == "" {
+		return nil, nil
+	}
+	if len([]rune(trimmed)) > maxErasureTextLength {
+		return nil, apperrors.NewValidationError(field, "must be at most 2000 characters", len([]rune(trimmed)))
+	}
+	return &trimmed, nil
+}
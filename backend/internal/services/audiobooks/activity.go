@@ -0,0 +1,30 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+// ListLibraryActivity returns a library's activity feed as the user may see
+// it, newest first. activityType narrows it to one of models.ActivityTypes,
+// such as the books recently finished.
+func (s *Service) ListLibraryActivity(ctx context.Context, userID, libraryID, activityType string, offset, limit int) ([]models.Activity, int, error) {
+	if activityType != "" && !slices.Contains(models.ActivityTypes, activityType) {
+		return nil, 0, apperrors.NewValidationError("type", "must be one of "+strings.Join(models.ActivityTypes, ", "), activityType)
+	}
+	return s.repo.ListLibraryActivity(ctx, userID, strings.TrimSpace(libraryID), activityType, offset, limit)
+}
+
+// recordActivity adds an entry to the activity feed of an audiobook's
+// library. The feed is informational, so failures are logged rather than
+// returned.
+func (s *Service) recordActivity(ctx context.Context, activityType, audiobookID, userID string) {
+	if err := s.repo.RecordActivity(ctx, activityType, audiobookID, userID); err != nil {
+		fmt.Printf("Warning: Failed to record %s activity for %s: %v\n", activityType, audiobookID, err)
+	}
+}
@@ -0,0 +1,73 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lore/backend/internal/archive"
+)
+
+// AudiobookArchive lists the media files of an audiobook as zip entries under
+// a folder named after the title, applying the same access checks as
+// streaming. It also returns the suggested archive filename.
+func (s *Service) AudiobookArchive(ctx context.Context, audiobookID, userID string, isAdmin bool) (string, []archive.Entry, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.checkAudiobookAccess(ctx, audiobook.ID, userID, isAdmin); err != nil {
+		return "", nil, err
+	}
+	if len(audiobook.MediaFiles) == 0 {
+		return "", nil, fmt.Errorf("audiobook has no media files")
+	}
+
+	title := audiobook.ID
+	if audiobook.Metadata != nil && strings.TrimSpace(audiobook.Metadata.Title) != "" {
+		title = audiobook.Metadata.Title
+	}
+	folder := archiveName(title)
+
+	entries := make([]archive.Entry, 0, len(audiobook.MediaFiles))
+	for _, mf := range audiobook.MediaFiles {
+		fullPath, err := resolveMediaPath(audiobook.AssetPath, mf.Filename)
+		if err != nil {
+			return "", nil, err
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("file access error: %w", err)
+		}
+		entries = append(entries, archive.Entry{
+			Name:     path.Join(folder, filepath.ToSlash(filepath.Clean(mf.Filename))),
+			Path:     fullPath,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+
+	return folder + ".zip", entries, nil
+}
+
+// archiveName makes a title safe to use as a file or folder name.
+func archiveName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "audiobook"
+	}
+	return name
+}
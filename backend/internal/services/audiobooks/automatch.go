@@ -0,0 +1,69 @@
+package audiobooks
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/providers"
+)
+
+// AutoMatchConfidence is the lowest match score, from 0 to 1, at which
+// AutoMatch links a book without an admin confirming the match.
+const AutoMatchConfidence = 0.85
+
+// AutoMatch links an audiobook without provider metadata to the best
+// result providerName finds for its title and author; an empty name
+// searches every provider. Titles fall back to the book's folder name. It
+// reports whether a result scored at least AutoMatchConfidence and was
+// linked; books already linked are left alone.
+func (s *Service) AutoMatch(ctx context.Context, audiobookID, providerName string) (bool, error) {
+	book, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return false, err
+	}
+	if book.MetadataID != nil {
+		return false, nil
+	}
+	return s.matchBook(ctx, book, providerName)
+}
+
+// matchBook links book to the best result providerName finds for it when
+// that scores at least AutoMatchConfidence, replacing any earlier link.
+func (s *Service) matchBook(ctx context.Context, book *models.Audiobook, providerName string) (bool, error) {
+	resolved := book.ResolveMetadata()
+	title := strings.TrimSpace(resolved.Title)
+	if title == "" {
+		title = filepath.Base(book.AssetPath)
+	}
+	author := strings.TrimSpace(resolved.Author)
+	if providerName == "" {
+		providerName = providers.AllProviders
+	}
+	results, err := s.SearchMetadata(ctx, providerName, title, author)
+	if err != nil {
+		return false, err
+	}
+
+	var best *providers.SearchResult
+	bestScore := 0.0
+	for i := range results {
+		if score := providers.MatchScore(title, author, &results[i]); score > bestScore {
+			best, bestScore = &results[i], score
+		}
+	}
+	if best == nil || bestScore < AutoMatchConfidence {
+		return false, nil
+	}
+	if err := s.LinkMetadata(ctx, book.ID, best.Provider, best.ExternalID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ProviderNames returns the names of the registered metadata providers,
+// including metadata agents.
+func (s *Service) ProviderNames() []string {
+	return s.providers.Names()
+}
@@ -0,0 +1,61 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+)
+
+// maxBookmarkTitleLength bounds a bookmark's title, in characters.
+const maxBookmarkTitleLength = 500
+
+// ListBookmarks returns userID's bookmarks in an audiobook by position.
+func (s *Service) ListBookmarks(ctx context.Context, userID, audiobookID string) ([]models.Bookmark, error) {
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListBookmarks(ctx, userID, audiobookID)
+}
+
+// AddBookmark bookmarks a position in an audiobook for userID.
+func (s *Service) AddBookmark(ctx context.Context, userID, audiobookID string, positionSec float64, title string) (*models.Bookmark, error) {
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
+	if positionSec < 0 {
+		return nil, apperrors.NewValidationError("position_sec", "position_sec must not be negative", positionSec)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, apperrors.NewValidationError("title", "title is required", title)
+	}
+	if len([]rune(title)) > maxBookmarkTitleLength {
+		return nil, apperrors.NewValidationError("title", fmt.Sprintf("title must be at most %d characters", maxBookmarkTitleLength), len([]rune(title)))
+	}
+
+	bookmark := &models.Bookmark{AudiobookID: audiobookID, PositionSec: positionSec, Title: title}
+	if err := s.repo.CreateBookmark(ctx, userID, bookmark); err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return bookmark, nil
+}
+
+// DeleteBookmark removes one of userID's bookmarks in an audiobook.
+func (s *Service) DeleteBookmark(ctx context.Context, userID, audiobookID, bookmarkID string) error {
+	if err := s.repo.DeleteBookmark(ctx, userID, audiobookID, bookmarkID); err != nil {
+		return err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return nil
+}
@@ -0,0 +1,227 @@
+package audiobooks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lore/backend/internal/cache"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/models"
+)
+
+// Node IDs of the browse tree. The root, with the empty ID, lists Continue
+// Listening and the libraries; libraries list their series and then the
+// books outside a series; series list their books in order and books list
+// their chapters.
+const (
+	browseContinueID    = "continue"
+	browseLibraryPrefix = "library:"
+	browseSeriesPrefix  = "series:"
+	browseBookPrefix    = "book:"
+	browseChapterPrefix = "chapter:"
+)
+
+const (
+	// browseContinueLimit bounds the books under Continue Listening.
+	browseContinueLimit = 24
+	// browseCoverSize is the edge, in pixels, of browse tree images.
+	browseCoverSize = 150
+)
+
+// Browse returns a node of the browse tree for car head units and a page of
+// its children, with their total number. The empty ID is the root; unknown
+// nodes return sql.ErrNoRows.
+func (s *Service) Browse(ctx context.Context, userID, nodeID string, offset, limit int) (*models.BrowseNode, []models.BrowseNode, int, error) {
+	switch {
+	case nodeID == "":
+		return s.browseRoot(ctx, userID, offset, limit)
+
+	case nodeID == browseContinueID:
+		books, err := s.GetContinueListening(ctx, userID, nil, browseContinueLimit)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		node := &models.BrowseNode{ID: browseContinueID, Kind: models.BrowseFolder, Title: "Continue Listening", Browsable: true, ChildCount: len(books)}
+		children := []models.BrowseNode{}
+		for i := offset; i < len(books) && i < offset+limit; i++ {
+			children = append(children, browseBook(&books[i]))
+		}
+		return node, children, len(books), nil
+
+	case strings.HasPrefix(nodeID, browseLibraryPrefix):
+		return s.browseLibrary(ctx, userID, strings.TrimPrefix(nodeID, browseLibraryPrefix), offset, limit)
+
+	case strings.HasPrefix(nodeID, browseSeriesPrefix):
+		libraryID, name, _ := strings.Cut(strings.TrimPrefix(nodeID, browseSeriesPrefix), ":")
+		filter := models.AudiobookFilter{Series: name, Sort: models.SortSeries}
+		books, total, err := s.ListLibraryBooks(ctx, userID, libraryID, filter, offset, limit)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if total == 0 {
+			return nil, nil, 0, sql.ErrNoRows
+		}
+		node := &models.BrowseNode{ID: nodeID, Kind: models.BrowseFolder, Title: name, Browsable: true, ChildCount: total}
+		children := make([]models.BrowseNode, len(books))
+		for i := range books {
+			children[i] = browseBook(&books[i])
+		}
+		return node, children, total, nil
+
+	case strings.HasPrefix(nodeID, browseBookPrefix):
+		book, err := s.GetLibraryItem(ctx, strings.TrimPrefix(nodeID, browseBookPrefix), userID)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		node := browseBook(book)
+		children := []models.BrowseNode{}
+		var start float64
+		for i, mf := range book.MediaFiles {
+			if i >= offset && i < offset+limit {
+				children = append(children, models.BrowseNode{
+					ID:          browseChapterPrefix + mf.ID,
+					Kind:        models.BrowseChapter,
+					Title:       media.ChapterTitle(mf.Filename),
+					Playable:    true,
+					AudiobookID: book.ID,
+					MediaFileID: mf.ID,
+					StartSec:    start,
+					DurationSec: mf.DurationSec,
+				})
+			}
+			start += mf.DurationSec
+		}
+		return &node, children, len(book.MediaFiles), nil
+	}
+	return nil, nil, 0, sql.ErrNoRows
+}
+
+func (s *Service) browseRoot(ctx context.Context, userID string, offset, limit int) (*models.BrowseNode, []models.BrowseNode, int, error) {
+	continueListening, err := s.GetContinueListening(ctx, userID, nil, browseContinueLimit)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	libraries, err := s.repo.ListLibraries(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	all := []models.BrowseNode{{ID: browseContinueID, Kind: models.BrowseFolder, Title: "Continue Listening", Browsable: true, ChildCount: len(continueListening)}}
+	for _, library := range libraries {
+		title := library.DisplayName
+		if title == "" {
+			title = library.Name
+		}
+		all = append(all, models.BrowseNode{ID: browseLibraryPrefix + library.ID, Kind: models.BrowseFolder, Title: title, Browsable: true})
+	}
+
+	node := &models.BrowseNode{ID: "", Kind: models.BrowseFolder, Title: "Library", Browsable: true, ChildCount: len(all)}
+	children := []models.BrowseNode{}
+	for i := offset; i < len(all) && i < offset+limit; i++ {
+		children = append(children, all[i])
+	}
+	return node, children, len(all), nil
+}
+
+// seriesPage is a cached page of a library's series.
+type seriesPage struct {
+	series []models.SeriesCount
+	total  int
+}
+
+// browseLibrary lists a library's series, then the books outside a series,
+// as one paged list.
+func (s *Service) browseLibrary(ctx context.Context, userID, libraryID string, offset, limit int) (*models.BrowseNode, []models.BrowseNode, int, error) {
+	library, err := s.repo.GetLibraryByID(ctx, libraryID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	key := cache.Key{UserID: userID, LibraryID: libraryID, Name: "series", Params: fmt.Sprintf("%d|%d", offset, limit)}
+	series, err := cached(s.cache, key, func() (seriesPage, error) {
+		series, total, err := s.repo.ListLibrarySeries(ctx, userID, libraryID, offset, limit)
+		return seriesPage{series, total}, err
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	seriesTotal := series.total
+
+	children := make([]models.BrowseNode, 0, limit)
+	for _, entry := range series.series {
+		children = append(children, models.BrowseNode{
+			ID:         browseSeriesPrefix + libraryID + ":" + entry.Name,
+			Kind:       models.BrowseFolder,
+			Title:      entry.Name,
+			ImageURL:   browseImage(entry.CoverAudiobookID, entry.CoverURL),
+			Browsable:  true,
+			ChildCount: entry.BookCount,
+		})
+	}
+
+	// Books follow the series: the page picks up where the series end.
+	bookOffset := offset - seriesTotal
+	if bookOffset < 0 {
+		bookOffset = 0
+	}
+	bookLimit := limit - len(children)
+	books, bookTotal, err := s.ListLibraryBooks(ctx, userID, libraryID, models.AudiobookFilter{NoSeries: true, Sort: models.SortTitle}, bookOffset, max(bookLimit, 1))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for i := 0; i < len(books) && i < bookLimit; i++ {
+		children = append(children, browseBook(&books[i]))
+	}
+
+	title := library.DisplayName
+	if title == "" {
+		title = library.Name
+	}
+	total := seriesTotal + bookTotal
+	node := &models.BrowseNode{ID: browseLibraryPrefix + library.ID, Kind: models.BrowseFolder, Title: title, Browsable: true, ChildCount: total}
+	return node, children, total, nil
+}
+
+// browseBook describes a book as a playable node whose children are its
+// chapters.
+func browseBook(book *models.Audiobook) models.BrowseNode {
+	resolved := book.ResolveMetadata()
+	title := resolved.Title
+	if title == "" {
+		title = filepath.Base(book.AssetPath)
+	}
+	node := models.BrowseNode{
+		ID:          browseBookPrefix + book.ID,
+		Kind:        models.BrowseBook,
+		Title:       title,
+		Subtitle:    resolved.Author,
+		ImageURL:    browseImage(book.ID, resolved.CoverURL),
+		Browsable:   true,
+		Playable:    true,
+		ChildCount:  book.FileCount,
+		AudiobookID: book.ID,
+		DurationSec: book.PlaybackDuration(),
+	}
+	if len(book.MediaFiles) > 0 {
+		node.ChildCount = len(book.MediaFiles)
+	}
+	book.ApplyProgress()
+	if book.UserData != nil {
+		node.ProgressPct = book.UserData.ProgressPct
+	}
+	return node
+}
+
+// browseImage links to a thumbnail of an uploaded cover, or of the server's
+// copy of a remote cover.
+func browseImage(audiobookID string, coverURL *string) string {
+	switch {
+	case coverURL == nil:
+		return ""
+	case *coverURL == CoverURL(audiobookID), models.IsRemoteURL(*coverURL):
+		return fmt.Sprintf("%s?size=%d", CoverURL(audiobookID), browseCoverSize)
+	}
+	return ""
+}
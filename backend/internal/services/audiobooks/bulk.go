@@ -0,0 +1,187 @@
+package audiobooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/providers"
+)
+
+// Bulk operations, applied to each audiobook of a BulkRequest.
+const (
+	BulkDelete            = "delete"
+	BulkMoveToLibrary     = "move-to-library"
+	BulkRelinkProvider    = "relink-provider"
+	BulkRefreshMetadata   = "refresh-metadata"
+	BulkReextractEmbedded = "re-extract-embedded"
+)
+
+// BulkOperations lists the operations a BulkRequest may name.
+var BulkOperations = []string{BulkDelete, BulkMoveToLibrary, BulkRelinkProvider, BulkRefreshMetadata, BulkReextractEmbedded}
+
+// MaxBulkAudiobooks is the most audiobooks one bulk request may name.
+const MaxBulkAudiobooks = 1000
+
+// Outcomes of one audiobook in a bulk operation.
+const (
+	BulkStatusDone    = "done"
+	BulkStatusSkipped = "skipped"
+	BulkStatusFailed  = "failed"
+)
+
+// BulkRequest applies one operation to many audiobooks.
+type BulkRequest struct {
+	AudiobookIDs []string `json:"audiobook_ids"`
+	Operation    string   `json:"operation"`
+	// LibraryID is the library move-to-library assigns the books to.
+	LibraryID string `json:"library_id,omitempty"`
+	// Provider is searched by relink-provider; empty searches every
+	// provider.
+	Provider string `json:"provider,omitempty"`
+}
+
+// BulkItemResult is the outcome of a bulk operation for one audiobook.
+type BulkItemResult struct {
+	AudiobookID string `json:"audiobook_id"`
+	Status      string `json:"status"`
+	// Message explains why the book was skipped or failed.
+	Message string `json:"message,omitempty"`
+}
+
+// BulkResult reports a bulk operation, book by book.
+type BulkResult struct {
+	Operation string           `json:"operation"`
+	Done      int              `json:"done"`
+	Skipped   int              `json:"skipped"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+}
+
+// errBulkSkipped marks a book a bulk operation does not apply to.
+type errBulkSkipped string
+
+func (e errBulkSkipped) Error() string { return string(e) }
+
+// ValidateBulk checks a bulk request before it is queued, dropping blank
+// and repeated audiobook IDs. Invalid requests return a
+// *apperrors.ValidationError.
+func (s *Service) ValidateBulk(ctx context.Context, req *BulkRequest) error {
+	seen := make(map[string]bool, len(req.AudiobookIDs))
+	ids := req.AudiobookIDs[:0]
+	for _, id := range req.AudiobookIDs {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	req.AudiobookIDs = ids
+	if len(ids) == 0 {
+		return apperrors.NewValidationError("audiobook_ids", "at least one audiobook ID is required", nil)
+	}
+	if len(ids) > MaxBulkAudiobooks {
+		return apperrors.NewValidationError("audiobook_ids", fmt.Sprintf("at most %d audiobooks can be changed at once", MaxBulkAudiobooks), len(ids))
+	}
+
+	switch req.Operation {
+	case BulkMoveToLibrary:
+		req.LibraryID = strings.TrimSpace(req.LibraryID)
+		if req.LibraryID == "" {
+			return apperrors.NewValidationError("library_id", "library_id is required to move audiobooks", nil)
+		}
+		if _, err := s.repo.GetLibraryByID(ctx, req.LibraryID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return apperrors.NewValidationError("library_id", "library not found", req.LibraryID)
+			}
+			return err
+		}
+	case BulkRelinkProvider:
+		req.Provider = strings.TrimSpace(req.Provider)
+		if req.Provider != "" && req.Provider != providers.AllProviders && s.getProvider(req.Provider) == nil {
+			return apperrors.NewValidationError("provider", "unknown provider", req.Provider)
+		}
+	case BulkDelete, BulkRefreshMetadata, BulkReextractEmbedded:
+	default:
+		return apperrors.NewValidationError("operation", "must be one of "+strings.Join(BulkOperations, ", "), req.Operation)
+	}
+	return nil
+}
+
+// RunBulk applies a validated bulk request to each of its audiobooks in
+// turn. A book that fails is recorded and the rest still run; only a
+// cancelled context ends the run early, leaving the remaining books out of
+// the result.
+func (s *Service) RunBulk(ctx context.Context, req BulkRequest, progress func(done, total int)) (*BulkResult, error) {
+	result := &BulkResult{Operation: req.Operation, Items: make([]BulkItemResult, 0, len(req.AudiobookIDs))}
+	for i, id := range req.AudiobookIDs {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		item := BulkItemResult{AudiobookID: id, Status: BulkStatusDone}
+		var skipped errBulkSkipped
+		switch err := s.bulkApply(ctx, req, id); {
+		case err == nil:
+			result.Done++
+		case errors.As(err, &skipped):
+			item.Status, item.Message = BulkStatusSkipped, err.Error()
+			result.Skipped++
+		case errors.Is(err, sql.ErrNoRows):
+			item.Status, item.Message = BulkStatusFailed, "audiobook not found"
+			result.Failed++
+		default:
+			item.Status, item.Message = BulkStatusFailed, err.Error()
+			result.Failed++
+		}
+		result.Items = append(result.Items, item)
+		if progress != nil {
+			progress(i+1, len(req.AudiobookIDs))
+		}
+	}
+	return result, nil
+}
+
+// bulkApply applies req's operation to one audiobook.
+func (s *Service) bulkApply(ctx context.Context, req BulkRequest, id string) error {
+	switch req.Operation {
+	case BulkDelete:
+		return s.Delete(ctx, id)
+	case BulkReextractEmbedded:
+		_, err := s.ExtractEmbeddedMetadata(ctx, id)
+		if errors.Is(err, ErrNoMediaFiles) {
+			return errBulkSkipped(err.Error())
+		}
+		return err
+	}
+
+	book, err := s.repo.GetAudiobook(ctx, id, "")
+	if err != nil {
+		return err
+	}
+	switch req.Operation {
+	case BulkMoveToLibrary:
+		if book.LibraryID != nil && *book.LibraryID == req.LibraryID {
+			return errBulkSkipped("already in the library")
+		}
+		_, err := s.MoveAudiobook(ctx, id, MoveRequest{LibraryID: req.LibraryID})
+		return err
+	case BulkRelinkProvider:
+		linked, err := s.matchBook(ctx, book, req.Provider)
+		if err != nil {
+			return err
+		}
+		if !linked {
+			return errBulkSkipped("no close enough match")
+		}
+		return nil
+	case BulkRefreshMetadata:
+		if book.Metadata == nil || book.Metadata.ExternalID == nil || *book.Metadata.ExternalID == "" {
+			return errBulkSkipped("not linked to provider metadata")
+		}
+		return s.LinkMetadata(providers.WithoutCache(ctx), id, book.Metadata.Source, *book.Metadata.ExternalID)
+	}
+	return fmt.Errorf("unknown bulk operation %q", req.Operation)
+}
@@ -0,0 +1,82 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+)
+
+// checkpointKeyTTL is how long an idempotency key is remembered.
+const checkpointKeyTTL = 10 * time.Minute
+
+// maxIdempotencyKeyLength bounds a checkpoint's idempotency key.
+const maxIdempotencyKeyLength = 128
+
+// Checkpoint is a fire-and-forget progress update, such as one sent with
+// navigator.sendBeacon as a sleep timer stops playback and the player is
+// closed.
+type Checkpoint struct {
+	ProgressSec float64 `json:"progress_sec"`
+	// IdempotencyKey identifies the checkpoint, so one that is delivered
+	// again is applied once.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// checkpointKeys remembers recent idempotency keys per user.
+type checkpointKeys struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newCheckpointKeys() *checkpointKeys {
+	return &checkpointKeys{seen: make(map[string]time.Time)}
+}
+
+// Checkpoint records a progress checkpoint like UpdateProgress, so rapid
+// checkpoints are coalesced by the progress buffer. A checkpoint whose
+// idempotency key was seen in the last ten minutes is ignored.
+func (s *Service) Checkpoint(ctx context.Context, userID, audiobookID string, cp Checkpoint) error {
+	if cp.ProgressSec < 0 {
+		return apperrors.NewValidationError("progress_sec", "progress_sec must not be negative", cp.ProgressSec)
+	}
+	cp.IdempotencyKey = strings.TrimSpace(cp.IdempotencyKey)
+	if len(cp.IdempotencyKey) > maxIdempotencyKeyLength {
+		return apperrors.NewValidationError("idempotency_key", fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLength), len(cp.IdempotencyKey))
+	}
+	if cp.IdempotencyKey != "" && !s.checkpoints.claim(userID+"\x00"+cp.IdempotencyKey) {
+		return nil
+	}
+	_, err := s.UpdateProgress(ctx, userID, audiobookID, cp.ProgressSec)
+	if err != nil && cp.IdempotencyKey != "" {
+		// Let the client try again with the same key.
+		s.checkpoints.release(userID + "\x00" + cp.IdempotencyKey)
+	}
+	return err
+}
+
+// claim records key, reporting false when it was already seen.
+func (k *checkpointKeys) claim(key string) bool {
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for seen, at := range k.seen {
+		if now.Sub(at) > checkpointKeyTTL {
+			delete(k.seen, seen)
+		}
+	}
+	if _, dup := k.seen[key]; dup {
+		return false
+	}
+	k.seen[key] = now
+	return true
+}
+
+func (k *checkpointKeys) release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.seen, key)
+}
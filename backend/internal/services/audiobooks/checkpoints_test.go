@@ -0,0 +1,59 @@
+package audiobooks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lore/backend/internal/models"
+)
+
+func TestCheckpointIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	svc, writes := newTestService(t)
+
+	if err := svc.Checkpoint(ctx, "alice", "book-1", Checkpoint{ProgressSec: 100, IdempotencyKey: "beacon-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Checkpoint(ctx, "alice", "book-1", Checkpoint{ProgressSec: 200, IdempotencyKey: "beacon-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if writes["alice"] != 1 {
+		t.Errorf("%d writes for a repeated key, want 1", writes["alice"])
+	}
+	if got := storedProgress(t, svc, "alice"); got != 100 {
+		t.Errorf("stored progress = %v, want the first checkpoint, 100", got)
+	}
+
+	// Keys are per user.
+	if err := svc.Checkpoint(ctx, "bob", "book-1", Checkpoint{ProgressSec: 300, IdempotencyKey: "beacon-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedProgress(t, svc, "bob"); got != 300 {
+		t.Errorf("bob's stored progress = %v, want 300", got)
+	}
+}
+
+func TestCheckpointReleasesKeyOnFailure(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+
+	if err := svc.Checkpoint(ctx, "alice", "book-2", Checkpoint{ProgressSec: 50, IdempotencyKey: "beacon-2"}); err == nil {
+		t.Fatal("checkpoint for a missing book succeeded")
+	}
+
+	libraryID := "lib-1"
+	book := &models.Audiobook{ID: "book-2", LibraryID: &libraryID, LibraryPathID: "path-1", AssetPath: "/books/two"}
+	if err := svc.repo.CreateAudiobook(ctx, book, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Checkpoint(ctx, "alice", "book-2", Checkpoint{ProgressSec: 50, IdempotencyKey: "beacon-2"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := svc.repo.GetAudiobook(ctx, "book-2", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.UserData == nil || data.UserData.ProgressSec != 50 {
+		t.Errorf("retried checkpoint stored %+v, want progress 50", data.UserData)
+	}
+}
@@ -0,0 +1,101 @@
+package audiobooks
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/lore/backend/internal/covers"
+	"github.com/lore/backend/internal/models"
+)
+
+// CoverURL is the API path serving an audiobook's uploaded cover.
+func CoverURL(audiobookID string) string {
+	return models.CoverURL(audiobookID)
+}
+
+// UploadCover stores a custom cover image with its placeholder and locks the
+// audiobook's cover_url override to it, keeping any other overrides in place.
+func (s *Service) UploadCover(ctx context.Context, audiobookID, userID string, src io.ReadSeeker, size int64) (*models.CustomMetadata, error) {
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, ""); err != nil {
+		return nil, err
+	}
+
+	placeholder, err := s.covers.Save(ctx, audiobookID, src, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCoverPlaceholder(ctx, audiobookID, placeholder.Blurhash, placeholder.Color); err != nil {
+		return nil, err
+	}
+
+	custom, err := s.repo.GetMetadataOverrides(ctx, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	if custom == nil {
+		custom = &models.CustomMetadata{AudiobookID: audiobookID}
+	}
+
+	coverURL := CoverURL(audiobookID)
+	custom.SetFieldValue("cover_url", &coverURL)
+	custom.SetLockMode("cover_url", models.LockModeValue)
+	custom.UpdatedAt = time.Now().UTC()
+	custom.UpdatedBy = &userID
+
+	if err := s.SaveMetadataOverrides(ctx, custom); err != nil {
+		return nil, err
+	}
+	return custom, nil
+}
+
+// SetRemoteCovers serves remote covers, such as provider CDN images, from
+// cache; without it only uploaded covers are served.
+func (s *Service) SetRemoteCovers(c *covers.RemoteCache) {
+	s.remoteCovers = c
+}
+
+// CoverPath returns the cover of an audiobook the user may access, resized
+// to size pixels unless size is zero: the uploaded image, or a cached copy
+// of the remote image its resolved metadata links to.
+func (s *Service) CoverPath(ctx context.Context, audiobookID, userID string, isAdmin bool, size int) (string, error) {
+	if err := s.checkAudiobookAccess(ctx, audiobookID, userID, isAdmin); err != nil {
+		return "", err
+	}
+	return s.coverPath(ctx, audiobookID, size)
+}
+
+// CatalogCoverPath returns the cover of an audiobook listed in a library's
+// catalog, like CoverPath.
+func (s *Service) CatalogCoverPath(ctx context.Context, libraryID, audiobookID string, size int) (string, error) {
+	listed, err := s.repo.InCatalog(ctx, libraryID, audiobookID)
+	if err != nil {
+		return "", err
+	}
+	if !listed {
+		return "", covers.ErrNotFound
+	}
+	return s.coverPath(ctx, audiobookID, size)
+}
+
+// coverPath returns an audiobook's uploaded cover or the cached copy of its
+// remote cover, resized to size pixels unless size is zero.
+func (s *Service) coverPath(ctx context.Context, audiobookID string, size int) (string, error) {
+	source, err := s.repo.ResolvedCoverURL(ctx, audiobookID)
+	if err != nil {
+		return "", err
+	}
+	if models.IsRemoteURL(source) {
+		if s.remoteCovers == nil {
+			return "", covers.ErrNotFound
+		}
+		return s.remoteCovers.Path(ctx, source, size)
+	}
+	return s.covers.Path(ctx, audiobookID, size)
+}
+
+// CatalogBooks returns a page of the books a library's catalog lists: those
+// every user may see, by title.
+func (s *Service) CatalogBooks(ctx context.Context, libraryID string, offset, limit int) ([]models.CatalogBook, int, error) {
+	return s.repo.ListCatalogBooks(ctx, libraryID, offset, limit)
+}
@@ -0,0 +1,166 @@
+package audiobooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+// customFieldKey is the form of custom field keys, which appear in JSON
+// bodies and query parameters.
+var customFieldKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// ListCustomFields returns every custom field.
+func (s *Service) ListCustomFields(ctx context.Context) ([]models.CustomField, error) {
+	return s.repo.ListCustomFields(ctx)
+}
+
+// CreateCustomField defines a custom field for every audiobook.
+func (s *Service) CreateCustomField(ctx context.Context, key, name, fieldType string) (*models.CustomField, error) {
+	key = strings.TrimSpace(key)
+	name = strings.TrimSpace(name)
+	if !customFieldKey.MatchString(key) {
+		return nil, apperrors.NewValidationError("key", "key must be lowercase letters, digits and underscores, starting with a letter", key)
+	}
+	if name == "" {
+		return nil, apperrors.NewValidationError("name", "name is required", name)
+	}
+	valid := false
+	for _, t := range models.CustomFieldTypes {
+		valid = valid || t == fieldType
+	}
+	if !valid {
+		return nil, apperrors.NewValidationError("type", "invalid type (expected one of "+strings.Join(models.CustomFieldTypes, ", ")+")", fieldType)
+	}
+
+	if _, err := s.repo.GetCustomField(ctx, key); err == nil {
+		return nil, apperrors.NewValidationError("key", "a custom field with this key already exists", key)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	field := &models.CustomField{Key: key, Name: name, Type: fieldType}
+	if err := s.repo.CreateCustomField(ctx, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// RenameCustomField changes a custom field's display name. Its key and type
+// cannot change, since stored values and client filters depend on them.
+func (s *Service) RenameCustomField(ctx context.Context, key, name string) (*models.CustomField, error) {
+	field, err := s.repo.GetCustomField(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, apperrors.NewValidationError("name", "name is required", name)
+	}
+	if err := s.repo.RenameCustomField(ctx, key, name); err != nil {
+		return nil, err
+	}
+	field.Name = name
+	return field, nil
+}
+
+// DeleteCustomField removes a custom field and its value on every
+// audiobook.
+func (s *Service) DeleteCustomField(ctx context.Context, key string) error {
+	if _, err := s.repo.GetCustomField(ctx, key); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteCustomField(ctx, key); err != nil {
+		return err
+	}
+	s.catalogChanged(nil)
+	return nil
+}
+
+// SetCustomFieldValues sets an audiobook's custom field values by key. A
+// null value clears the field; fields not given are left alone.
+func (s *Service) SetCustomFieldValues(ctx context.Context, audiobookID string, values map[string]interface{}) error {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return err
+	}
+	fields, err := s.customFieldsByKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]*string, len(values))
+	for key, value := range values {
+		field, ok := fields[key]
+		if !ok {
+			return apperrors.NewValidationError("custom_fields", "unknown custom field", key)
+		}
+		if value == nil {
+			stored[key] = nil
+			continue
+		}
+		normalized, err := field.Normalize(value)
+		if err != nil {
+			return apperrors.NewValidationError("custom_fields", err.Error(), value)
+		}
+		stored[key] = &normalized
+	}
+
+	if err := s.repo.SetCustomFieldValues(ctx, audiobookID, stored); err != nil {
+		return err
+	}
+	s.catalogChanged(audiobook.LibraryID)
+	return nil
+}
+
+// CustomFieldFilters checks that filters name known custom fields, using
+// range operators only on number and date fields, and normalizes their
+// values.
+func (s *Service) CustomFieldFilters(ctx context.Context, filters []models.CustomFieldFilter) ([]models.CustomFieldFilter, error) {
+	if len(filters) == 0 {
+		return filters, nil
+	}
+	fields, err := s.customFieldsByKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, filter := range filters {
+		param := "field." + filter.Key
+		field, ok := fields[filter.Key]
+		if !ok {
+			return nil, apperrors.NewValidationError(param, "unknown custom field", filter.Key)
+		}
+		if filter.Op != models.FilterEqual {
+			param += "." + filter.Op
+			if field.Type != models.CustomFieldNumber && field.Type != models.CustomFieldDate {
+				return nil, apperrors.NewValidationError(param, fmt.Sprintf("%s filters only apply to number and date fields", filter.Op), filter.Value)
+			}
+		}
+		value, err := field.Normalize(filter.Value)
+		if err != nil {
+			return nil, apperrors.NewValidationError(param, err.Error(), filter.Value)
+		}
+		filters[i].Type = field.Type
+		filters[i].Value = value
+	}
+	return filters, nil
+}
+
+func (s *Service) customFieldsByKey(ctx context.Context) (map[string]models.CustomField, error) {
+	fields, err := s.repo.ListCustomFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.CustomField, len(fields))
+	for _, field := range fields {
+		byKey[field.Key] = field
+	}
+	return byKey, nil
+}
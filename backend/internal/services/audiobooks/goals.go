@@ -0,0 +1,75 @@
+package audiobooks
+
+import (
+	"context"
+	"math"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+)
+
+const (
+	// maxWeeklyHours is the hours in a week.
+	maxWeeklyHours = 168
+	// maxYearlyBooks bounds the books-per-year goal.
+	maxYearlyBooks = 1000
+)
+
+// GetGoalProgress returns a user's listening goals with their progress this
+// week and year.
+func (s *Service) GetGoalProgress(ctx context.Context, userID string) (*models.GoalProgress, error) {
+	goals, err := s.repo.GetListeningGoals(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// Weeks start on Monday.
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	yearStart := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+
+	listened, err := s.repo.ListenedSince(ctx, userID, weekStart)
+	if err != nil {
+		return nil, err
+	}
+	finished, err := s.repo.CountBooksFinished(ctx, userID, yearStart, progressCompleteRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &models.GoalProgress{
+		ListeningGoals:    *goals,
+		WeekStart:         weekStart.Format("2006-01-02"),
+		WeekListenedHours: math.Round(listened/36) / 100,
+		Year:              now.Year(),
+		YearBooksFinished: finished,
+	}
+	if goals.WeeklyHours != nil {
+		pct := math.Round(listened/3600 / *goals.WeeklyHours * 1000) / 10
+		progress.WeeklyPct = &pct
+	}
+	if goals.YearlyBooks != nil {
+		pct := math.Round(float64(finished)/float64(*goals.YearlyBooks)*1000) / 10
+		progress.YearlyPct = &pct
+	}
+	return progress, nil
+}
+
+// SetListeningGoals replaces a user's listening goals and returns their
+// progress. A nil target clears that goal.
+func (s *Service) SetListeningGoals(ctx context.Context, userID string, goals models.ListeningGoals) (*models.GoalProgress, error) {
+	if goals.WeeklyHours != nil && (*goals.WeeklyHours <= 0 || *goals.WeeklyHours > maxWeeklyHours) {
+		return nil, apperrors.NewValidationError("weekly_hours", "weekly_hours must be more than 0 and at most 168", *goals.WeeklyHours)
+	}
+	if goals.YearlyBooks != nil && (*goals.YearlyBooks < 1 || *goals.YearlyBooks > maxYearlyBooks) {
+		return nil, apperrors.NewValidationError("yearly_books", "yearly_books must be 1-1000", *goals.YearlyBooks)
+	}
+	if err := s.repo.SetListeningGoals(ctx, userID, goals); err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return s.GetGoalProgress(ctx, userID)
+}
@@ -0,0 +1,165 @@
+package audiobooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/models"
+)
+
+// ErrNothingToMerge is returned when an audiobook has fewer than two media files.
+var ErrNothingToMerge = errors.New("audiobook has fewer than two media files")
+
+// ErrNoMediaFiles is returned when an audiobook has no media files to read.
+var ErrNoMediaFiles = errors.New("audiobook has no media files")
+
+// MergeResult describes a completed M4B merge.
+type MergeResult struct {
+	AudiobookID string          `json:"audiobook_id"`
+	Filename    string          `json:"filename"`
+	DurationSec float64         `json:"duration_sec"`
+	Chapters    []media.Chapter `json:"chapters"`
+	// Originals lists the source files. They are deleted when
+	// OriginalsRemoved is set and otherwise left next to the merged file.
+	Originals        []string `json:"originals"`
+	OriginalsRemoved bool     `json:"originals_removed"`
+	// RemoveErrors lists originals that could not be deleted.
+	RemoveErrors []string `json:"remove_errors,omitempty"`
+}
+
+// CheckMergeable reports whether an audiobook can be merged into a single
+// file, so callers can reject a merge before queueing it.
+func (s *Service) CheckMergeable(ctx context.Context, audiobookID string) error {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return err
+	}
+	if len(audiobook.MediaFiles) < 2 {
+		return ErrNothingToMerge
+	}
+	return nil
+}
+
+// MergeToM4B merges the media files of an audiobook into one M4B in the
+// audiobook's folder, with a chapter per source file titled after its
+// filename. The audiobook then plays from the merged file alone. The import
+// setting merge_replace_originals decides whether the source files are
+// deleted or kept alongside it.
+func (s *Service) MergeToM4B(ctx context.Context, audiobookID string, progress func(done, total int)) (*MergeResult, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(audiobook.MediaFiles) < 2 {
+		return nil, ErrNothingToMerge
+	}
+
+	info, err := os.Stat(audiobook.AssetPath)
+	if err != nil {
+		return nil, fmt.Errorf("asset not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("asset path is not a directory")
+	}
+
+	settings, err := s.repo.GetImportSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import settings: %w", err)
+	}
+
+	// Probing durations is one step per file; encoding is the last step.
+	total := len(audiobook.MediaFiles) + 1
+	report := func(done int) {
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+
+	inputs := make([]media.MergeInput, 0, len(audiobook.MediaFiles))
+	originals := make([]string, 0, len(audiobook.MediaFiles))
+	copyAudio := true
+	for i, mf := range audiobook.MediaFiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report(i)
+
+		fullPath, err := resolveMediaPath(audiobook.AssetPath, mf.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mf.Filename, err)
+		}
+		duration := mf.DurationSec
+		if duration <= 0 {
+			probe, err := s.prober.Probe(ctx, fullPath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", mf.Filename, err)
+			}
+			duration = probe.DurationSec
+		}
+		if !strings.EqualFold(mf.MimeType, media.MergeMimeType) {
+			copyAudio = false
+		}
+
+		inputs = append(inputs, media.MergeInput{
+			Path:        fullPath,
+			Title:       media.ChapterTitle(mf.Filename),
+			DurationSec: duration,
+		})
+		originals = append(originals, fullPath)
+	}
+	report(len(audiobook.MediaFiles))
+
+	title := audiobook.ResolveMetadata().Title
+	if strings.TrimSpace(title) == "" {
+		title = filepath.Base(audiobook.AssetPath)
+	}
+	filename := archiveName(title) + ".m4b"
+	output := filepath.Join(audiobook.AssetPath, filename)
+	if _, err := os.Stat(output); err == nil {
+		return nil, fmt.Errorf("%s already exists", filename)
+	}
+
+	if err := media.Merge(ctx, inputs, output, copyAudio); err != nil {
+		return nil, err
+	}
+
+	chapters := media.Chapters(inputs)
+	merged := models.MediaFile{
+		ID:          uuid.NewString(),
+		AudiobookID: audiobook.ID,
+		Filename:    filename,
+		DurationSec: chapters[len(chapters)-1].EndSec,
+		MimeType:    media.MergeMimeType,
+	}
+	if err := s.repo.ReplaceMediaFiles(ctx, audiobook.ID, []models.MediaFile{merged}); err != nil {
+		os.Remove(output)
+		return nil, fmt.Errorf("failed to record merged file: %w", err)
+	}
+	s.catalogChanged(audiobook.LibraryID)
+
+	result := &MergeResult{
+		AudiobookID: audiobook.ID,
+		Filename:    filename,
+		DurationSec: merged.DurationSec,
+		Chapters:    chapters,
+		Originals:   originals,
+	}
+	if settings.MergeReplaceOriginals {
+		for _, path := range originals {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				result.RemoveErrors = append(result.RemoveErrors, err.Error())
+			}
+		}
+		result.OriginalsRemoved = true
+	}
+	report(total)
+
+	return result, nil
+}
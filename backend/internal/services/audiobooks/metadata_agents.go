@@ -0,0 +1,120 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/providers"
+)
+
+// LoadMetadataAgents registers the enabled metadata agents as providers.
+func (s *Service) LoadMetadataAgents(ctx context.Context) error {
+	agents, err := s.repo.ListMetadataAgents(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range agents {
+		if agents[i].Enabled {
+			s.providers.Register(s.agentProvider(&agents[i]))
+		}
+	}
+	return nil
+}
+
+// ListMetadataAgents returns every configured metadata agent.
+func (s *Service) ListMetadataAgents(ctx context.Context) ([]models.MetadataAgent, error) {
+	return s.repo.ListMetadataAgents(ctx)
+}
+
+// GetMetadataAgent returns a metadata agent, or sql.ErrNoRows if there is
+// none.
+func (s *Service) GetMetadataAgent(ctx context.Context, id string) (*models.MetadataAgent, error) {
+	return s.repo.GetMetadataAgent(ctx, id)
+}
+
+// CreateMetadataAgent stores agent and, when enabled, registers it as a
+// provider straight away.
+func (s *Service) CreateMetadataAgent(ctx context.Context, agent *models.MetadataAgent) error {
+	if err := s.checkAgentName(ctx, agent); err != nil {
+		return err
+	}
+	agent.ID = uuid.NewString()
+	if err := s.repo.CreateMetadataAgent(ctx, agent); err != nil {
+		return err
+	}
+	agent.HasAPIKey = agent.APIKey != ""
+	if agent.Enabled {
+		s.providers.Register(s.agentProvider(agent))
+	}
+	return nil
+}
+
+// UpdateMetadataAgent saves changes to an agent, previously registered as
+// oldName, and registers it again with them.
+func (s *Service) UpdateMetadataAgent(ctx context.Context, agent *models.MetadataAgent, oldName string) error {
+	if err := s.checkAgentName(ctx, agent); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateMetadataAgent(ctx, agent); err != nil {
+		return err
+	}
+	agent.HasAPIKey = agent.APIKey != ""
+	s.providers.Unregister(oldName)
+	if agent.Enabled {
+		s.providers.Register(s.agentProvider(agent))
+	}
+	return nil
+}
+
+// DeleteMetadataAgent removes an agent and its provider.
+func (s *Service) DeleteMetadataAgent(ctx context.Context, id string) error {
+	agent, err := s.repo.GetMetadataAgent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteMetadataAgent(ctx, id); err != nil {
+		return err
+	}
+	s.providers.Unregister(agent.Name)
+	return nil
+}
+
+// TestMetadataAgent runs a search against agent, enabled or not, bypassing
+// the provider cache.
+func (s *Service) TestMetadataAgent(ctx context.Context, agent *models.MetadataAgent, title, author string) ([]providers.SearchResult, error) {
+	return s.agentProvider(agent).Search(providers.WithoutCache(ctx), title, author)
+}
+
+func (s *Service) agentProvider(agent *models.MetadataAgent) providers.Provider {
+	return providers.NewAgentProvider(agent.Name, agent.URL, agent.APIKey, s.providerConfig)
+}
+
+// checkAgentName refuses names taken by a built-in provider or another
+// agent.
+func (s *Service) checkAgentName(ctx context.Context, agent *models.MetadataAgent) error {
+	taken := apperrors.NewHTTPError(http.StatusConflict, fmt.Sprintf("A metadata provider named %q already exists", agent.Name), nil)
+	if agent.Name == providers.AllProviders {
+		return taken
+	}
+	if p := s.providers.Get(agent.Name); p != nil {
+		if _, ok := p.(*providers.AgentProvider); !ok {
+			return taken
+		}
+	}
+
+	agents, err := s.repo.ListMetadataAgents(ctx)
+	if err != nil {
+		return err
+	}
+	for _, other := range agents {
+		if other.Name == agent.Name && other.ID != agent.ID {
+			return taken
+		}
+	}
+	return nil
+}
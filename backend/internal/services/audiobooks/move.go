@@ -0,0 +1,140 @@
+package audiobooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/pathutil"
+)
+
+// ErrMoveDestinationExists is returned when moving an audiobook's folder
+// would overwrite an existing file or folder.
+var ErrMoveDestinationExists = errors.New("move destination already exists")
+
+// MoveRequest reassigns an audiobook to another library.
+type MoveRequest struct {
+	LibraryID string `json:"library_id"`
+	// LibraryPathID is the library directory the audiobook belongs to
+	// afterwards. It defaults to the audiobook's current directory or, when
+	// moving files, to the library's only enabled directory. Without
+	// MoveFiles the audiobook's folder must already lie inside it.
+	LibraryPathID string `json:"library_path_id,omitempty"`
+	// MoveFiles moves the audiobook's folder into the library directory.
+	MoveFiles bool `json:"move_files,omitempty"`
+	// Destination is where the folder is moved to, relative to the library
+	// directory; it defaults to the folder's current name.
+	Destination string `json:"destination,omitempty"`
+}
+
+// MoveAudiobook assigns an audiobook to another library and library
+// directory, optionally moving its folder there first. The folder is moved
+// back if the catalog cannot be updated. Invalid requests return a
+// *apperrors.ValidationError.
+func (s *Service) MoveAudiobook(ctx context.Context, audiobookID string, req MoveRequest) (*models.Audiobook, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return nil, err
+	}
+	library, err := s.repo.GetLibraryByID(ctx, strings.TrimSpace(req.LibraryID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NewValidationError("library_id", "library not found", req.LibraryID)
+		}
+		return nil, err
+	}
+
+	libraryPath, err := moveLibraryPath(library, req)
+	if err != nil {
+		return nil, err
+	}
+	libraryPathID := audiobook.LibraryPathID
+	if libraryPath != nil {
+		libraryPathID = libraryPath.ID
+	}
+
+	assetPath := audiobook.AssetPath
+	moved := false
+	switch {
+	case req.MoveFiles:
+		destination := strings.TrimSpace(req.Destination)
+		if destination == "" {
+			destination = filepath.Base(audiobook.AssetPath)
+		}
+		target := filepath.Join(libraryPath.Path, destination)
+		if filepath.IsAbs(destination) || !pathutil.Within(libraryPath.Path, target) {
+			return nil, apperrors.NewValidationError("destination", "must be a relative path inside the library directory", req.Destination)
+		}
+		if pathutil.Resolve(target) == pathutil.Resolve(audiobook.AssetPath) {
+			break
+		}
+		if pathutil.Contains(audiobook.AssetPath, target) {
+			return nil, apperrors.NewValidationError("destination", "cannot move a folder into itself", req.Destination)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			return nil, ErrMoveDestinationExists
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create destination directory: %w", err)
+		}
+		if err := os.Rename(audiobook.AssetPath, target); err != nil {
+			return nil, fmt.Errorf("failed to move folder: %w", err)
+		}
+		assetPath, moved = target, true
+	case libraryPathID != audiobook.LibraryPathID:
+		if !pathutil.Within(libraryPath.Path, audiobook.AssetPath) {
+			return nil, apperrors.NewValidationError("library_path_id", "the audiobook's folder is not inside this directory; set move_files to move it there", req.LibraryPathID)
+		}
+	}
+
+	if err := s.repo.MoveAudiobook(ctx, audiobookID, library.ID, libraryPathID, assetPath); err != nil {
+		if moved {
+			if undo := os.Rename(assetPath, audiobook.AssetPath); undo != nil {
+				fmt.Printf("Warning: Failed to move %s back to %s: %v\n", assetPath, audiobook.AssetPath, undo)
+			}
+		}
+		return nil, err
+	}
+	if moved {
+		if previous, err := s.repo.GetLibraryPathByID(ctx, audiobook.LibraryPathID); err == nil {
+			pathutil.RemoveEmptyParents(filepath.Dir(audiobook.AssetPath), previous.Path)
+		}
+	}
+
+	// The new library's metadata order and collation apply.
+	s.refreshResolved(ctx, audiobookID)
+	return s.repo.GetAudiobook(ctx, audiobookID, "")
+}
+
+// moveLibraryPath returns the directory of library an audiobook is moved
+// to, or nil when it keeps its current directory and files.
+func moveLibraryPath(library *models.Library, req MoveRequest) (*models.LibraryPath, error) {
+	id := strings.TrimSpace(req.LibraryPathID)
+	if id == "" && !req.MoveFiles {
+		return nil, nil
+	}
+
+	var enabled []*models.LibraryPath
+	for i := range library.Directories {
+		dir := &library.Directories[i]
+		if dir.ID == id {
+			return dir, nil
+		}
+		if dir.Enabled {
+			enabled = append(enabled, dir)
+		}
+	}
+	if id != "" {
+		return nil, apperrors.NewValidationError("library_path_id", "not a directory of the library", req.LibraryPathID)
+	}
+	if len(enabled) != 1 {
+		return nil, apperrors.NewValidationError("library_path_id", "library_path_id is required unless the library has exactly one enabled directory", nil)
+	}
+	return enabled[0], nil
+}
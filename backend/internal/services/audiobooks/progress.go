@@ -0,0 +1,129 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// progressBuffer holds the latest position per user and book until it is
+// written, so players posting progress every few seconds cost one write per
+// flush instead of one per request.
+type progressBuffer struct {
+	mu      sync.Mutex
+	pending map[string]pendingProgress
+	// flushing serialises flushes, so an older position taken by one
+	// cannot be written after a newer one taken by the next.
+	flushing sync.Mutex
+}
+
+// pendingProgress is a position not written yet.
+type pendingProgress struct {
+	userID      string
+	audiobookID string
+	progressSec float64
+	at          time.Time
+}
+
+// SetProgressFlushInterval buffers progress updates in memory and writes
+// the latest position per user and book every d, when the user reads
+// their data (see FlushUserProgress) and on shutdown (see FlushProgress).
+// Zero writes every update straight away. Call it before serving requests.
+func (s *Service) SetProgressFlushInterval(d time.Duration) {
+	if d <= 0 {
+		s.progress = nil
+		return
+	}
+	s.progress = &progressBuffer{pending: make(map[string]pendingProgress)}
+	s.progressFlush = d
+}
+
+// WatchProgress writes buffered progress every flush interval until ctx
+// ends. The last updates are left to FlushProgress, which the caller runs
+// once requests have stopped.
+func (s *Service) WatchProgress(ctx context.Context) {
+	if s.progress == nil {
+		return
+	}
+	ticker := time.NewTicker(s.progressFlush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.FlushProgress(ctx)
+		}
+	}
+}
+
+// FlushProgress writes every buffered position.
+func (s *Service) FlushProgress(ctx context.Context) {
+	if s.progress == nil {
+		return
+	}
+	s.flushProgress(ctx, func(pendingProgress) bool { return true })
+}
+
+// FlushUserProgress writes userID's buffered positions, so what they read
+// next includes them.
+func (s *Service) FlushUserProgress(ctx context.Context, userID string) {
+	if s.progress == nil {
+		return
+	}
+	s.flushProgress(ctx, func(p pendingProgress) bool { return p.userID == userID })
+}
+
+func (s *Service) flushProgress(ctx context.Context, match func(pendingProgress) bool) {
+	// Most reads find nothing to write; they need not wait for a flush.
+	if !s.progress.has(match) {
+		return
+	}
+	s.progress.flushing.Lock()
+	defer s.progress.flushing.Unlock()
+	for _, p := range s.progress.take(match) {
+		if _, err := s.writeProgress(ctx, p.userID, p.audiobookID, p.progressSec, p.at); err != nil {
+			fmt.Printf("Failed to save progress for %s: %v\n", p.audiobookID, err)
+		}
+	}
+}
+
+// put buffers a position, returning the one it replaces, if any.
+func (b *progressBuffer) put(userID, audiobookID string, progressSec float64, at time.Time) (float64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := userID + "\x00" + audiobookID
+	previous, ok := b.pending[key]
+	b.pending[key] = pendingProgress{userID: userID, audiobookID: audiobookID, progressSec: progressSec, at: at}
+	return previous.progressSec, ok
+}
+
+// has reports whether any buffered position matches.
+func (b *progressBuffer) has(match func(pendingProgress) bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, p := range b.pending {
+		if match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// take removes and returns the buffered positions match selects, oldest
+// first so listening sessions are extended in order.
+func (b *progressBuffer) take(match func(pendingProgress) bool) []pendingProgress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var taken []pendingProgress
+	for key, p := range b.pending {
+		if match(p) {
+			taken = append(taken, p)
+			delete(b.pending, key)
+		}
+	}
+	sort.Slice(taken, func(i, j int) bool { return taken[i].at.Before(taken[j].at) })
+	return taken
+}
@@ -0,0 +1,154 @@
+package audiobooks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lore/backend/internal/database"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/repository"
+)
+
+// newTestService opens a fresh database with users alice and bob and a
+// ten-minute book-1, and returns a service on it with a count of the
+// progress writes per user.
+func newTestService(t *testing.T) (*Service, map[string]int) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "lore.db"), database.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := repository.New(db)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, stmt := range []string{
+		`INSERT INTO library_paths (id, path, name, created_at) VALUES ('path-1', '/books', 'Books', '` + now + `')`,
+		`INSERT INTO libraries (id, name, display_name, created_at, updated_at) VALUES ('lib-1', 'books', 'Books', '` + now + `', '` + now + `')`,
+		`INSERT INTO users (id, username, password_hash, created_at) VALUES ('alice', 'alice', 'x', '` + now + `')`,
+		`INSERT INTO users (id, username, password_hash, created_at) VALUES ('bob', 'bob', 'x', '` + now + `')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libraryID := "lib-1"
+	book := &models.Audiobook{ID: "book-1", LibraryID: &libraryID, LibraryPathID: "path-1", AssetPath: "/books/one"}
+	files := []models.MediaFile{{ID: "file-1", AudiobookID: "book-1", Filename: "one.mp3", DurationSec: 600, MimeType: "audio/mpeg"}}
+	if err := repo.CreateAudiobook(ctx, book, files, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := New(repo, nil, media.Detector{}, nil)
+	writes := make(map[string]int)
+	bus := events.NewBus()
+	bus.Subscribe(func(event events.Event) {
+		if event.Type == events.UserDataChanged {
+			writes[event.UserID]++
+		}
+	})
+	svc.SetEvents(bus)
+	return svc, writes
+}
+
+// storedProgress reads userID's saved position in book-1.
+func storedProgress(t *testing.T, svc *Service, userID string) float64 {
+	t.Helper()
+	book, err := svc.repo.GetAudiobook(context.Background(), "book-1", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.UserData == nil {
+		return 0
+	}
+	return book.UserData.ProgressSec
+}
+
+func TestProgressUpdatesCoalesce(t *testing.T) {
+	ctx := context.Background()
+	svc, writes := newTestService(t)
+	svc.SetProgressFlushInterval(time.Hour)
+
+	for _, position := range []float64{10, 20, 30} {
+		if _, err := svc.UpdateProgress(ctx, "alice", "book-1", position); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if writes["alice"] != 0 {
+		t.Errorf("%d writes before the flush, want none", writes["alice"])
+	}
+
+	svc.FlushProgress(ctx)
+	if writes["alice"] != 1 {
+		t.Errorf("%d writes for three updates, want 1", writes["alice"])
+	}
+	if got := storedProgress(t, svc, "alice"); got != 30 {
+		t.Errorf("stored progress = %v, want the last update, 30", got)
+	}
+}
+
+func TestProgressReadSeesBufferedUpdate(t *testing.T) {
+	ctx := context.Background()
+	svc, writes := newTestService(t)
+	svc.SetProgressFlushInterval(time.Hour)
+
+	data, err := svc.UpdateProgress(ctx, "alice", "book-1", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.ProgressSec != 42 {
+		t.Errorf("returned progress = %v, want 42", data.ProgressSec)
+	}
+
+	// Reads flush the reader's own updates first, as FlushProgressMiddleware does.
+	svc.FlushUserProgress(ctx, "bob")
+	if writes["alice"] != 0 {
+		t.Errorf("bob's read wrote alice's progress")
+	}
+	svc.FlushUserProgress(ctx, "alice")
+	book, err := svc.GetLibraryItem(ctx, "book-1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.UserData == nil || book.UserData.ProgressSec != 42 {
+		t.Errorf("read after the update = %+v, want progress 42", book.UserData)
+	}
+}
+
+func TestFlushProgressOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	svc, writes := newTestService(t)
+	svc.SetProgressFlushInterval(time.Hour)
+	done := make(chan struct{})
+	go func() {
+		svc.WatchProgress(ctx)
+		close(done)
+	}()
+
+	if _, err := svc.UpdateProgress(ctx, "alice", "book-1", 120); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateProgress(ctx, "bob", "book-1", 240); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shut down as the app does: stop the watcher, then flush what is left.
+	cancel()
+	<-done
+	svc.FlushProgress(context.Background())
+
+	if writes["alice"] != 1 || writes["bob"] != 1 {
+		t.Errorf("writes = %v, want one per user", writes)
+	}
+	if got := storedProgress(t, svc, "alice"); got != 120 {
+		t.Errorf("alice's stored progress = %v, want 120", got)
+	}
+	if got := storedProgress(t, svc, "bob"); got != 240 {
+		t.Errorf("bob's stored progress = %v, want 240", got)
+	}
+}
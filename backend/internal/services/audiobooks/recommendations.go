@@ -0,0 +1,89 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lore/backend/internal/cache"
+	"github.com/lore/backend/internal/models"
+)
+
+// recommendationWeights is what each shared author, series, narrator or
+// genre adds to a recommended book's score. A series is the strongest hint,
+// a genre the weakest.
+var recommendationWeights = map[string]int{
+	models.RecommendSeries:   4,
+	models.RecommendAuthor:   3,
+	models.RecommendNarrator: 2,
+	models.RecommendGenre:    1,
+}
+
+// GetRecommendations suggests up to limit books the user has not started,
+// scored by the authors, series, narrators and genres they share with the
+// books the user finished or favourited. Each recommendation lists the
+// reasons that add up to its score, strongest first.
+func (s *Service) GetRecommendations(ctx context.Context, userID string, libraryID *string, limit int) ([]models.Recommendation, error) {
+	key := cache.Key{UserID: userID, Name: "recommendations", Params: fmt.Sprintf("%d", limit)}
+	if libraryID != nil {
+		key.LibraryID = *libraryID
+	}
+	recommendations, err := cached(s.cache, key, func() ([]models.Recommendation, error) {
+		return s.loadRecommendations(ctx, userID, libraryID, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Copy so callers shaping the books don't touch the cached ones.
+	return append(make([]models.Recommendation, 0, len(recommendations)), recommendations...), nil
+}
+
+func (s *Service) loadRecommendations(ctx context.Context, userID string, libraryID *string, limit int) ([]models.Recommendation, error) {
+	matches, err := s.repo.ListRecommendationMatches(ctx, userID, libraryID, progressCompleteRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	scored := make([]models.Recommendation, 0, len(matches))
+	for id, reasons := range matches {
+		rec := models.Recommendation{Audiobook: models.Audiobook{ID: id}, Reasons: reasons}
+		for i := range rec.Reasons {
+			rec.Reasons[i].Weight = recommendationWeights[rec.Reasons[i].Kind]
+			rec.Score += rec.Reasons[i].Weight
+		}
+		sort.SliceStable(rec.Reasons, func(i, j int) bool {
+			return rec.Reasons[i].Weight > rec.Reasons[j].Weight
+		})
+		scored = append(scored, rec)
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].Audiobook.ID < scored[j].Audiobook.ID
+	})
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	ids := make([]string, len(scored))
+	for i, rec := range scored {
+		ids[i] = rec.Audiobook.ID
+	}
+	books, err := s.repo.GetAudiobookListings(ctx, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Audiobook, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	recommendations := make([]models.Recommendation, 0, len(scored))
+	for _, rec := range scored {
+		if book, ok := byID[rec.Audiobook.ID]; ok {
+			rec.Audiobook = book
+			recommendations = append(recommendations, rec)
+		}
+	}
+	return recommendations, nil
+}
@@ -0,0 +1,93 @@
+package audiobooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+)
+
+// maxRetentionDays bounds retention periods at about a century.
+const maxRetentionDays = 36500
+
+// SetRetentionDefaults sets the retention periods used until an admin saves
+// retention settings.
+func (s *Service) SetRetentionDefaults(settings models.RetentionSettings) {
+	s.retention = settings
+}
+
+// RetentionSettings returns the saved retention settings, or the defaults
+// when an admin has never saved any.
+func (s *Service) RetentionSettings(ctx context.Context) (*models.RetentionSettings, error) {
+	settings, err := s.repo.GetRetentionSettings(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		defaults := s.retention
+		return &defaults, nil
+	}
+	return settings, err
+}
+
+// UpdateRetentionSettings saves the retention settings.
+func (s *Service) UpdateRetentionSettings(ctx context.Context, settings *models.RetentionSettings) error {
+	for field, days := range map[string]int{
+		"session_days":  settings.SessionDays,
+		"stats_days":    settings.StatsDays,
+		"activity_days": settings.ActivityDays,
+	} {
+		if days < 0 || days > maxRetentionDays {
+			return apperrors.NewValidationError(field, "retention must be 0 (keep forever) to 36500 days", days)
+		}
+	}
+	return s.repo.SaveRetentionSettings(ctx, settings)
+}
+
+// PruneHistory removes listening history and activity past the retention
+// periods, and the listening history of users who opted out of keeping it.
+func (s *Service) PruneHistory(ctx context.Context) (*models.PruneResult, error) {
+	settings, err := s.RetentionSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.PruneHistory(ctx, *settings, time.Now())
+}
+
+// WatchRetention prunes history each interval until ctx ends.
+func (s *Service) WatchRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.PruneHistory(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("prune listening history: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PrivacySettings returns a user's privacy settings.
+func (s *Service) PrivacySettings(ctx context.Context, userID string) (*models.PrivacySettings, error) {
+	return s.repo.GetPrivacySettings(ctx, userID)
+}
+
+// SetPrivacySettings saves a user's privacy settings. Opting out of keeping
+// listening history removes the history kept so far right away.
+func (s *Service) SetPrivacySettings(ctx context.Context, userID string, settings models.PrivacySettings) (*models.PrivacySettings, error) {
+	if err := s.repo.SetPrivacySettings(ctx, userID, settings); err != nil {
+		return nil, err
+	}
+	if !settings.KeepListeningHistory {
+		if _, err := s.PruneHistory(ctx); err != nil {
+			return nil, err
+		}
+		s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	}
+	return &settings, nil
+}
@@ -0,0 +1,67 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+)
+
+// maxReviewLength bounds the text of a review, in characters.
+const maxReviewLength = 10000
+
+// GetReview returns userID's rating of an audiobook, or sql.ErrNoRows if
+// they have not rated it.
+func (s *Service) GetReview(ctx context.Context, userID, audiobookID string) (*models.Review, error) {
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetReview(ctx, userID, audiobookID)
+}
+
+// SetReview rates an audiobook for userID from 0.5 to 5 stars in half
+// steps, with an optional review. An empty review removes the text.
+func (s *Service) SetReview(ctx context.Context, userID, audiobookID string, rating float64, review *string) (*models.Review, error) {
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
+	if rating < models.MinRating || rating > models.MaxRating || rating*2 != math.Trunc(rating*2) {
+		return nil, apperrors.NewValidationError("rating", fmt.Sprintf("rating must be %.1f to %.1f in half steps", models.MinRating, models.MaxRating), rating)
+	}
+	if review != nil {
+		trimmed := strings.TrimSpace(*review)
+		if len([]rune(trimmed)) > maxReviewLength {
+			return nil, apperrors.NewValidationError("review", fmt.Sprintf("review must be at most %d characters", maxReviewLength), len([]rune(trimmed)))
+		}
+		review = &trimmed
+		if trimmed == "" {
+			review = nil
+		}
+	}
+
+	saved, err := s.repo.SetReview(ctx, userID, audiobookID, rating, review)
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return saved, nil
+}
+
+// DeleteReview removes userID's rating of an audiobook.
+func (s *Service) DeleteReview(ctx context.Context, userID, audiobookID string) error {
+	if _, err := s.GetReview(ctx, userID, audiobookID); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteReview(ctx, userID, audiobookID); err != nil {
+		return err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return nil
+}
@@ -2,43 +2,198 @@ package audiobooks
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"mime"
+	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/lore/backend/internal/cache"
+	"github.com/lore/backend/internal/covers"
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/events"
 	"github.com/lore/backend/internal/library"
+	"github.com/lore/backend/internal/media"
 	"github.com/lore/backend/internal/metadata"
 	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/pathutil"
 	"github.com/lore/backend/internal/providers"
 	"github.com/lore/backend/internal/repository"
+	"github.com/lore/backend/internal/webhooks"
 )
 
 // Service coordinates media storage, metadata, and persistence for audiobooks.
 type Service struct {
 	repo         *repository.Repository
 	metadataProv metadata.Provider
+	mime         media.Detector
+	covers       *covers.Store
+	providers    *providers.Registry
+	webhooks     *webhooks.Service
+	cache        *cache.Cache
+	events       *events.Bus
+	prober       media.Prober
+	// clientLogRetention is how long client logs are kept; zero keeps them.
+	clientLogRetention time.Duration
+	// sessionIdle is how long a listening session lasts without progress
+	// updates.
+	sessionIdle time.Duration
+	// retention applies until an admin saves retention settings.
+	retention models.RetentionSettings
+	// providerConfig and providerCache are those of the providers, see
+	// SetProviderConfig; metadata agents are created with them too.
+	providerConfig *providers.ProviderConfig
+	providerCache  *providers.ResponseCache
+	// hls caches the segments of HLS streams; nil disables HLS.
+	hls *media.HLSCache
+	// remoteCovers caches remote cover images; nil serves uploads only.
+	remoteCovers *covers.RemoteCache
+	// progress buffers progress updates until they are flushed; nil
+	// writes them straight away.
+	progress      *progressBuffer
+	progressFlush time.Duration
+	// checkpoints remembers the idempotency keys of progress checkpoints.
+	checkpoints *checkpointKeys
 }
 
 // New creates a new Service.
-func New(repo *repository.Repository, provider metadata.Provider) *Service {
+func New(repo *repository.Repository, provider metadata.Provider, detector media.Detector, coverStore *covers.Store) *Service {
 	if provider == nil {
 		provider = metadata.NoopProvider{}
 	}
 	return &Service{
 		repo:         repo,
 		metadataProv: provider,
+		mime:         detector,
+		covers:       coverStore,
+		providers:    providers.DefaultRegistry(nil),
+		prober:       media.NewProber(),
+		sessionIdle:  DefaultSessionIdleTimeout,
+		checkpoints:  newCheckpointKeys(),
 	}
 }
 
+// SetCache caches library listings, filter counts and home shelves in c.
+// The cache must be subscribed to the bus passed to SetEvents.
+func (s *Service) SetCache(c *cache.Cache) {
+	s.cache = c
+}
+
+// SetProviderConfig rebuilds the metadata providers with config, caching
+// their results in config.Cache. Call it before LoadMetadataAgents, as the
+// agents registered so far are dropped.
+func (s *Service) SetProviderConfig(config *providers.ProviderConfig) {
+	s.providers = providers.DefaultRegistry(config)
+	s.providerConfig = config
+	s.providerCache = config.Cache
+}
+
+// SetEvents publishes catalog, user data and access changes to bus.
+func (s *Service) SetEvents(bus *events.Bus) {
+	s.events = bus
+}
+
+// SetClientLogRetention removes client logs once they are older than d.
+// Zero keeps them forever.
+func (s *Service) SetClientLogRetention(d time.Duration) {
+	s.clientLogRetention = d
+}
+
+// SetHLSCache serves audiobooks as HLS, keeping cut segments in c.
+func (s *Service) SetHLSCache(c *media.HLSCache) {
+	s.hls = c
+}
+
+// SetProber reads media durations and embedded tags with p instead of the
+// default prober.
+func (s *Service) SetProber(p media.Prober) {
+	if p != nil {
+		s.prober = p
+	}
+}
+
+// Ping checks that the database is reachable.
+func (s *Service) Ping(ctx context.Context) error {
+	return s.repo.Ping(ctx)
+}
+
+// CacheStats reports the read cache's size, hits and misses.
+func (s *Service) CacheStats() cache.Stats {
+	return s.cache.Stats()
+}
+
+// ClearCache drops every cached read.
+func (s *Service) ClearCache() {
+	s.cache.Clear()
+}
+
+// ProviderCacheStats reports the metadata provider cache's size, hits and
+// misses.
+func (s *Service) ProviderCacheStats() providers.CacheStats {
+	return s.providerCache.Stats()
+}
+
+// ProviderHealth reports whether each metadata provider's recent requests
+// succeeded.
+func (s *Service) ProviderHealth() []providers.Health {
+	return s.providers.Health()
+}
+
+// ClearProviderCache drops every cached provider result.
+func (s *Service) ClearProviderCache() {
+	s.providerCache.Clear()
+}
+
+// catalogChanged tells subscribers an audiobook in libraryID was added,
+// edited or removed. A nil libraryID stands for every library.
+func (s *Service) catalogChanged(libraryID *string) {
+	event := events.Event{Type: events.CatalogChanged}
+	if libraryID != nil {
+		event.LibraryID = *libraryID
+	}
+	s.events.Publish(event)
+}
+
+// bookPage is a cached page of a book listing.
+type bookPage struct {
+	books []models.Audiobook
+	total int
+}
+
+// cached returns the result of load for key from the service's cache. Lists
+// come back as copies, since handlers reshape them in place.
+func cached[T any](c *cache.Cache, key cache.Key, load func() (T, error)) (T, error) {
+	value, err := c.Load(key, func() (interface{}, error) { return load() })
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T), nil
+}
+
+// listBooks caches a page of books for a user.
+func (s *Service) listBooks(key cache.Key, load func() ([]models.Audiobook, int, error)) ([]models.Audiobook, int, error) {
+	page, err := cached(s.cache, key, func() (bookPage, error) {
+		books, total, err := load()
+		return bookPage{books, total}, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	books := page.books
+	if books != nil {
+		books = append(make([]models.Audiobook, 0, len(books)), books...)
+	}
+	return books, page.total, nil
+}
+
 // LibraryScan lists the entries in the source library directory.
 // DEPRECATED: Use library service instead
 func (s *Service) LibraryScan() ([]library.Entry, error) {
@@ -93,7 +248,7 @@ func (s *Service) CreateFromSource(ctx context.Context, sourcePath string) (*mod
 	}
 
 	audiobookID := uuid.NewString()
-	assetPath, assetFiles, err := discoverMediaFiles(resolvedSource)
+	assetPath, assetFiles, err := discoverMediaFiles(resolvedSource, s.mime)
 	if err != nil {
 		return nil, err
 	}
@@ -103,24 +258,28 @@ func (s *Service) CreateFromSource(ctx context.Context, sourcePath string) (*mod
 		return nil, err
 	}
 
-	media := make([]models.MediaFile, 0, len(assetFiles))
+	mediaFiles := make([]models.MediaFile, 0, len(assetFiles))
 	for _, file := range assetFiles {
 		// Extract duration from the audio file
 		fullPath := filepath.Join(assetPath, file.Path)
-		duration, err := s.extractAudioDuration(fullPath)
-		if err != nil {
+		var duration float64
+		if probe, err := s.prober.Probe(ctx, fullPath); err == nil {
+			duration = probe.DurationSec
+		} else {
 			// Log the error but continue with 0 duration rather than failing the entire import
 			fmt.Printf("Warning: Failed to extract duration for %s: %v\n", fullPath, err)
-			duration = 0
 		}
 
-		media = append(media, models.MediaFile{
+		mediaFiles = append(mediaFiles, models.MediaFile{
 			ID:          uuid.NewString(),
 			AudiobookID: audiobookID,
 			Filename:    file.Path,
 			DurationSec: duration,
-			MimeType:    file.MimeType,
+			MimeType:    file.Detection.MimeType,
 		})
+		if file.Detection.Mismatch() {
+			mediaFiles[len(mediaFiles)-1].ExtensionMimeType = &file.Detection.ExtensionMimeType
+		}
 	}
 
 	audiobook := &models.Audiobook{
@@ -131,25 +290,73 @@ func (s *Service) CreateFromSource(ctx context.Context, sourcePath string) (*mod
 	}
 
 	// For creation, we don't create user data - users add to library manually
-	if err := s.repo.CreateAudiobook(ctx, audiobook, media, ""); err != nil {
+	if err := s.repo.CreateAudiobook(ctx, audiobook, mediaFiles, ""); err != nil {
 		return nil, err
 	}
+	if err := s.repo.RefreshResolvedMetadata(ctx, audiobookID); err != nil {
+		fmt.Printf("Warning: Failed to refresh resolved metadata for %s: %v\n", audiobookID, err)
+	}
+	s.catalogChanged(audiobook.LibraryID)
 
 	// Return without user-specific data for admin creation
 	return s.repo.GetAudiobook(ctx, audiobookID, "")
 }
 
+// SetTrackOrder overrides the natural filename order of an audiobook's media
+// files, e.g. for "Part One" and "Part Two". fileIDs must list every media
+// file of the book once; an empty list restores the natural order.
+func (s *Service) SetTrackOrder(ctx context.Context, audiobookID string, fileIDs []string) (*models.Audiobook, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fileIDs) > 0 {
+		remaining := make(map[string]bool, len(audiobook.MediaFiles))
+		for _, mf := range audiobook.MediaFiles {
+			remaining[mf.ID] = true
+		}
+		for _, id := range fileIDs {
+			if !remaining[id] {
+				return nil, apperrors.NewValidationError("file_ids", "unknown or repeated media file", id)
+			}
+			delete(remaining, id)
+		}
+		if len(remaining) > 0 {
+			return nil, apperrors.NewValidationError("file_ids", "every media file of the audiobook must be listed", len(remaining))
+		}
+	}
+
+	if err := s.repo.SetTrackOrder(ctx, audiobookID, fileIDs); err != nil {
+		return nil, err
+	}
+	s.catalogChanged(audiobook.LibraryID)
+	return s.repo.GetAudiobook(ctx, audiobookID, "")
+}
+
 // Delete removes the audiobook records while leaving source files untouched (admin only).
 func (s *Service) Delete(ctx context.Context, id string) error {
-	if _, err := s.repo.GetAudiobook(ctx, id, ""); err != nil {
+	audiobook, err := s.repo.GetAudiobook(ctx, id, "")
+	if err != nil {
 		return err
 	}
 
-	return s.repo.DeleteAudiobook(ctx, id)
+	if err := s.repo.DeleteAudiobook(ctx, id); err != nil {
+		return err
+	}
+	s.catalogChanged(audiobook.LibraryID)
+	if err := s.covers.Delete(id); err != nil {
+		fmt.Printf("Warning: Failed to remove cover for %s: %v\n", id, err)
+	}
+	return nil
 }
 
-// SearchMetadata searches for audiobook metadata using external providers
+// SearchMetadata searches for audiobook metadata using external providers.
+// The provider name "all" searches every provider and merges the results.
 func (s *Service) SearchMetadata(ctx context.Context, providerName, title, author string) ([]providers.SearchResult, error) {
+	if providerName == providers.AllProviders {
+		return s.providers.SearchAll(ctx, title, author)
+	}
 	provider := s.getProvider(providerName)
 	if provider == nil {
 		return nil, fmt.Errorf("unknown provider: %s", providerName)
@@ -168,35 +375,143 @@ func (s *Service) LinkMetadata(ctx context.Context, audiobookID, providerName, e
 	// Fetch metadata from provider
 	result, err := provider.GetByID(ctx, externalID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch metadata: %w", err)
+		// The ID may belong to an edition the provider cannot serve; retry
+		// with the other identifiers already known for the same book.
+		if errors.Is(err, providers.ErrNotFound) {
+			result = s.fetchByKnownIdentifiers(ctx, provider, externalID)
+		}
+		if result == nil {
+			return fmt.Errorf("failed to fetch metadata: %w", err)
+		}
 	}
 
 	// Convert SearchResult to AgentMetadata
 	agentMetadata := s.convertSearchResultToAgentMetadata(result)
+	identifiers := searchResultIdentifiers(result, externalID)
+
+	// Reuse the existing record when any identifier is already known, so
+	// regional ASINs and edition ISBNs of one book share a single record.
+	existingID, err := s.repo.FindAgentMetadataByIdentifiers(ctx, identifiers)
+	if err != nil {
+		return fmt.Errorf("failed to look up identifiers: %w", err)
+	}
+	if existingID != "" {
+		agentMetadata.ID = existingID
+	}
 
 	// Save or update the agent metadata
 	if err := s.repo.UpsertAgentMetadata(ctx, agentMetadata); err != nil {
 		return fmt.Errorf("failed to save agent metadata: %w", err)
 	}
+	if err := s.repo.AddAgentMetadataIdentifiers(ctx, agentMetadata.ID, identifiers); err != nil {
+		return fmt.Errorf("failed to save identifiers: %w", err)
+	}
 
 	// Link the audiobook to this metadata
 	if err := s.repo.LinkAudiobookMetadata(ctx, audiobookID, agentMetadata.ID); err != nil {
 		return fmt.Errorf("failed to link metadata: %w", err)
 	}
 
+	s.refreshResolved(ctx, audiobookID)
+	s.recordActivity(ctx, models.ActivityMetadataUpdated, audiobookID, "")
 	return nil
 }
 
-// getProvider returns the appropriate metadata provider based on name
-func (s *Service) getProvider(name string) providers.Provider {
-	switch name {
-	case "audible":
-		return providers.NewAudibleProvider("us", nil)
-	case "google":
-		return providers.NewGoogleBooksProvider(nil)
-	default:
+// ListDuplicates returns groups of audiobooks that resolve to the same book.
+func (s *Service) ListDuplicates(ctx context.Context) ([]models.DuplicateGroup, error) {
+	return s.repo.ListDuplicateAudiobooks(ctx)
+}
+
+// ListMetadataGaps returns books missing key metadata, optionally only those
+// in one library or with one gap.
+func (s *Service) ListMetadataGaps(ctx context.Context, libraryID *string, gap string, offset, limit int) ([]models.MetadataGapBook, int, error) {
+	return s.repo.ListMetadataGaps(ctx, libraryID, gap, offset, limit)
+}
+
+// MetadataGapSummaries counts the books missing key metadata per library.
+func (s *Service) MetadataGapSummaries(ctx context.Context) ([]models.MetadataGapSummary, error) {
+	return s.repo.MetadataGapSummaries(ctx)
+}
+
+// ListMissingAudiobooks lists the books a scan could not find on disk.
+func (s *Service) ListMissingAudiobooks(ctx context.Context, libraryID *string, offset, limit int) ([]models.MissingAudiobook, int, error) {
+	return s.repo.ListMissingAudiobooks(ctx, libraryID, offset, limit)
+}
+
+// fetchByKnownIdentifiers looks up the metadata record owning id and tries
+// the provider with each of its other identifiers. It returns nil when none
+// of them can be fetched.
+func (s *Service) fetchByKnownIdentifiers(ctx context.Context, provider providers.Provider, id string) *providers.SearchResult {
+	requested := toMetadataIdentifiers([]providers.Identifier{providers.ClassifyIdentifier(id)})
+	metadataID, err := s.repo.FindAgentMetadataByIdentifiers(ctx, requested)
+	if err != nil || metadataID == "" {
+		return nil
+	}
+
+	known, err := s.repo.ListAgentMetadataIdentifiers(ctx, metadataID)
+	if err != nil {
 		return nil
 	}
+	for _, identifier := range known {
+		if identifier.Value == requested[0].Value {
+			continue
+		}
+		if result, err := provider.GetByID(ctx, identifier.Value); err == nil {
+			return result
+		}
+	}
+	return nil
+}
+
+// searchResultIdentifiers collects the identifiers of a provider result
+// together with the ID it was requested by, when that is an ASIN or ISBN
+// rather than a provider-specific ID such as a Google Books volume ID.
+func searchResultIdentifiers(result *providers.SearchResult, requestedID string) []models.MetadataIdentifier {
+	ids := providers.ResultIdentifiers(result)
+	requested := providers.ClassifyIdentifier(requestedID)
+	if requested.Type != providers.IdentifierISBN && result.Provider != "audible" {
+		return toMetadataIdentifiers(ids)
+	}
+	for _, id := range ids {
+		if id.Type == requested.Type && id.Value == requested.Value {
+			return toMetadataIdentifiers(ids)
+		}
+	}
+	return toMetadataIdentifiers(append(ids, requested))
+}
+
+func toMetadataIdentifiers(ids []providers.Identifier) []models.MetadataIdentifier {
+	identifiers := make([]models.MetadataIdentifier, 0, len(ids))
+	for _, id := range ids {
+		if id.Value == "" {
+			continue
+		}
+		identifier := models.MetadataIdentifier{Type: id.Type, Value: id.Value}
+		if id.Region != "" {
+			region := id.Region
+			identifier.Region = &region
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers
+}
+
+// refreshResolved updates the resolved snapshot and genre links after an
+// audiobook's metadata changed. Failures are logged rather than returned;
+// the resolve-metadata job can repair them later.
+func (s *Service) refreshResolved(ctx context.Context, audiobookID string) {
+	if err := s.repo.RefreshResolvedMetadata(ctx, audiobookID); err != nil {
+		fmt.Printf("Warning: Failed to refresh resolved metadata for %s: %v\n", audiobookID, err)
+	}
+	if err := s.exportSidecar(ctx, audiobookID); err != nil {
+		fmt.Printf("Warning: Failed to export metadata sidecar for %s: %v\n", audiobookID, err)
+	}
+	s.catalogChanged(nil)
+}
+
+// getProvider returns the appropriate metadata provider based on name
+func (s *Service) getProvider(name string) providers.Provider {
+	return s.providers.Get(name)
 }
 
 // convertSearchResultToAgentMetadata converts a provider SearchResult to AgentMetadata
@@ -245,9 +560,34 @@ func (s *Service) UnlinkMetadata(ctx context.Context, audiobookID string) (*mode
 	if err := s.repo.UnlinkAudiobookMetadata(ctx, audiobookID); err != nil {
 		return nil, err
 	}
+	s.refreshResolved(ctx, audiobookID)
+	s.recordActivity(ctx, models.ActivityMetadataUpdated, audiobookID, "")
 	return s.repo.GetAudiobook(ctx, audiobookID, "")
 }
 
+// checkAudiobookAccess verifies that a user may read an audiobook: it must be
+// in one of their libraries and not restricted away from them. Admins always
+// have access.
+func (s *Service) checkAudiobookAccess(ctx context.Context, audiobookID, userID string, isAdmin bool) error {
+	if isAdmin {
+		return nil
+	}
+	hasAccess, err := s.repo.UserHasAudiobookInLibrary(ctx, userID, audiobookID)
+	if err != nil {
+		return fmt.Errorf("authorization check failed: %w", err)
+	}
+	if hasAccess {
+		hasAccess, err = s.repo.CanUserAccessAudiobook(ctx, userID, audiobookID)
+		if err != nil {
+			return fmt.Errorf("authorization check failed: %w", err)
+		}
+	}
+	if !hasAccess {
+		return fmt.Errorf("user does not have access to this audiobook")
+	}
+	return nil
+}
+
 // MediaFileStream resolves the on-disk path and mime type for a media file ID.
 // It validates the path to prevent directory traversal attacks.
 func (s *Service) MediaFileStream(ctx context.Context, fileID string, userID string, isAdmin bool) (string, string, error) {
@@ -257,26 +597,48 @@ func (s *Service) MediaFileStream(ctx context.Context, fileID string, userID str
 	}
 
 	// Authorization check: user must have this audiobook in their library (or be admin)
-	if !isAdmin {
-		hasAccess, err := s.repo.UserHasAudiobookInLibrary(ctx, userID, audiobook.ID)
-		if err != nil {
-			return "", "", fmt.Errorf("authorization check failed: %w", err)
-		}
-		if !hasAccess {
-			return "", "", fmt.Errorf("user does not have access to this audiobook")
-		}
+	if err := s.checkAudiobookAccess(ctx, audiobook.ID, userID, isAdmin); err != nil {
+		return "", "", err
+	}
+
+	path, err := resolveMediaPath(audiobook.AssetPath, media.Filename)
+	if err != nil {
+		return "", "", err
 	}
+	return path, media.MimeType, nil
+}
 
-	base := audiobook.AssetPath
+// SupplementFile returns the path of a supplement file on disk and its
+// record, once the user is allowed to see its audiobook.
+func (s *Service) SupplementFile(ctx context.Context, fileID, userID string, isAdmin bool) (string, *models.SupplementFile, error) {
+	file, audiobook, err := s.repo.GetSupplementFileWithAudiobook(ctx, fileID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.checkAudiobookAccess(ctx, audiobook.ID, userID, isAdmin); err != nil {
+		return "", nil, err
+	}
+
+	path, err := resolveMediaPath(audiobook.AssetPath, file.Filename)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, file, nil
+}
+
+// resolveMediaPath joins a media filename onto its audiobook's asset path and
+// validates the result to prevent directory traversal attacks.
+func resolveMediaPath(assetPath, filename string) (string, error) {
+	base := assetPath
 	if base == "" {
-		return "", "", fmt.Errorf("audiobook %s has no asset path", audiobook.ID)
+		return "", fmt.Errorf("audiobook has no asset path")
 	}
 
 	// Resolve the base path to guard against symlinks escaping the asset root.
 	if !filepath.IsAbs(base) {
 		absBase, err := filepath.Abs(base)
 		if err != nil {
-			return "", "", fmt.Errorf("could not resolve absolute path for %s: %w", base, err)
+			return "", fmt.Errorf("could not resolve absolute path for %s: %w", base, err)
 		}
 		base = absBase
 	}
@@ -284,15 +646,15 @@ func (s *Service) MediaFileStream(ctx context.Context, fileID string, userID str
 		base = evalBase
 	}
 
-	cleanFilename := filepath.Clean(filepath.FromSlash(media.Filename))
+	cleanFilename := filepath.Clean(filepath.FromSlash(filename))
 	if cleanFilename == "" || cleanFilename == "." {
-		return "", "", fmt.Errorf("invalid filename: empty path")
+		return "", fmt.Errorf("invalid filename: empty path")
 	}
 	if filepath.IsAbs(cleanFilename) {
-		return "", "", fmt.Errorf("invalid filename: absolute paths not allowed")
+		return "", fmt.Errorf("invalid filename: absolute paths not allowed")
 	}
 	if cleanFilename == ".." || strings.HasPrefix(cleanFilename, ".."+string(os.PathSeparator)) {
-		return "", "", fmt.Errorf("invalid filename: directory traversal not allowed")
+		return "", fmt.Errorf("invalid filename: directory traversal not allowed")
 	}
 
 	fullPath := filepath.Join(base, cleanFilename)
@@ -300,100 +662,114 @@ func (s *Service) MediaFileStream(ctx context.Context, fileID string, userID str
 	if evalFull, err := filepath.EvalSymlinks(fullPath); err == nil {
 		resolvedFull = evalFull
 	} else if !os.IsNotExist(err) {
-		return "", "", fmt.Errorf("failed to resolve media path: %w", err)
+		return "", fmt.Errorf("failed to resolve media path: %w", err)
 	}
 
 	rel, err := filepath.Rel(base, resolvedFull)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to resolve media path: %w", err)
+		return "", fmt.Errorf("failed to resolve media path: %w", err)
 	}
 	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-		return "", "", fmt.Errorf("path traversal detected: file outside asset directory")
+		return "", fmt.Errorf("path traversal detected: file outside asset directory")
 	}
 
 	// Additional security: check if file exists and is a regular file
 	info, err := os.Stat(resolvedFull)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", "", fmt.Errorf("media file not found on disk")
+			return "", fmt.Errorf("media file not found on disk")
 		}
-		return "", "", fmt.Errorf("file access error: %w", err)
+		return "", fmt.Errorf("file access error: %w", err)
 	}
 
 	if info.IsDir() {
-		return "", "", fmt.Errorf("path resolves to directory, not file")
+		return "", fmt.Errorf("path resolves to directory, not file")
 	}
 
-	return resolvedFull, media.MimeType, nil
+	return resolvedFull, nil
 }
 
 // ListLibraryBooks returns all audiobooks in the specified library with pagination and user data attached.
-func (s *Service) ListLibraryBooks(ctx context.Context, userID, libraryID string, offset, limit int) ([]models.Audiobook, int, error) {
+func (s *Service) ListLibraryBooks(ctx context.Context, userID, libraryID string, filter models.AudiobookFilter, offset, limit int) ([]models.Audiobook, int, error) {
 	trimmed := strings.TrimSpace(libraryID)
 	if trimmed == "" {
 		return nil, 0, fmt.Errorf("library_id is required")
 	}
-	return s.repo.ListAudiobooks(ctx, userID, &trimmed, offset, limit)
+	key := cache.Key{UserID: userID, LibraryID: trimmed, Name: "books", Params: fmt.Sprintf("%+v|%d|%d", filter, offset, limit)}
+	return s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		return s.repo.ListAudiobooks(ctx, userID, &trimmed, filter, offset, limit)
+	})
 }
 
 // SearchLibraryBooks searches a single library for audiobooks by title, author, or narrator.
-func (s *Service) SearchLibraryBooks(ctx context.Context, userID, libraryID, query string, offset, limit int) ([]models.Audiobook, int, error) {
+func (s *Service) SearchLibraryBooks(ctx context.Context, userID, libraryID, query string, filter models.AudiobookFilter, offset, limit int) ([]models.Audiobook, int, error) {
 	trimmed := strings.TrimSpace(libraryID)
 	if trimmed == "" {
 		return nil, 0, fmt.Errorf("library_id is required")
 	}
-	return s.repo.SearchAudiobooks(ctx, userID, query, &trimmed, offset, limit)
+	key := cache.Key{UserID: userID, LibraryID: trimmed, Name: "search", Params: fmt.Sprintf("%q|%+v|%d|%d", query, filter, offset, limit)}
+	return s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		return s.repo.SearchAudiobooks(ctx, userID, query, &trimmed, filter, offset, limit)
+	})
 }
 
-// extractAudioDuration uses ffprobe to get the duration of an audio file in seconds.
-func (s *Service) extractAudioDuration(filePath string) (float64, error) {
-	// Try ffprobe first (preferred)
-	cmd := exec.Command("ffprobe",
-		"-v", "quiet",
-		"-show_entries", "format=duration",
-		"-of", "csv=p=0",
-		filePath)
-
-	output, err := cmd.Output()
-	if err == nil {
-		durationStr := strings.TrimSpace(string(output))
-		if duration, parseErr := strconv.ParseFloat(durationStr, 64); parseErr == nil {
-			return duration, nil
+// Search searches every library the user can see, returning up to limit
+// matching books, authors and series each.
+func (s *Service) Search(ctx context.Context, userID, query string, limit int) (*models.SearchResults, error) {
+	key := cache.Key{UserID: userID, Name: "search", Params: fmt.Sprintf("%q|%d", query, limit)}
+	results, err := cached(s.cache, key, func() (models.SearchResults, error) {
+		books, total, err := s.repo.SearchAudiobooks(ctx, userID, query, nil, models.AudiobookFilter{}, 0, limit)
+		if err != nil {
+			return models.SearchResults{}, err
 		}
-	}
-
-	// Fallback: Try ffprobe with JSON output
-	cmd = exec.Command("ffprobe",
-		"-v", "quiet",
-		"-print_format", "json",
-		"-show_format",
-		filePath)
-
-	output, err = cmd.Output()
+		authors, err := s.repo.SearchAuthors(ctx, userID, query, limit)
+		if err != nil {
+			return models.SearchResults{}, err
+		}
+		series, err := s.repo.SearchSeries(ctx, userID, query, limit)
+		if err != nil {
+			return models.SearchResults{}, err
+		}
+		return models.SearchResults{Books: books, BooksTotal: total, Authors: authors, Series: series}, nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to extract duration with ffprobe: %w", err)
-	}
-
-	var info struct {
-		Format struct {
-			Duration string `json:"duration"`
-		} `json:"format"`
+		return nil, err
 	}
+	// Books are shaped per request, so callers get their own copy.
+	results.Books = append(make([]models.Audiobook, 0, len(results.Books)), results.Books...)
+	return &results, nil
+}
 
-	if err := json.Unmarshal(output, &info); err != nil {
-		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
-	}
+// ListLibraryGenres returns the genres in a library with book counts.
+func (s *Service) ListLibraryGenres(ctx context.Context, userID, libraryID string) ([]models.GenreCount, error) {
+	libraryID = strings.TrimSpace(libraryID)
+	return cached(s.cache, cache.Key{UserID: userID, LibraryID: libraryID, Name: "genres"}, func() ([]models.GenreCount, error) {
+		return s.repo.ListLibraryGenres(ctx, userID, libraryID)
+	})
+}
 
-	duration, err := strconv.ParseFloat(info.Format.Duration, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse duration value: %w", err)
-	}
+// ListLibraryNarrators returns the narrators in a library with book counts.
+func (s *Service) ListLibraryNarrators(ctx context.Context, userID, libraryID string) ([]models.NarratorCount, error) {
+	libraryID = strings.TrimSpace(libraryID)
+	return cached(s.cache, cache.Key{UserID: userID, LibraryID: libraryID, Name: "narrators"}, func() ([]models.NarratorCount, error) {
+		return s.repo.ListLibraryNarrators(ctx, userID, libraryID)
+	})
+}
 
-	return duration, nil
+// ListLibraryLetters returns the A–Z index of a library in the filter's
+// title or author order.
+func (s *Service) ListLibraryLetters(ctx context.Context, userID, libraryID string, filter models.AudiobookFilter) ([]models.LetterCount, error) {
+	libraryID = strings.TrimSpace(libraryID)
+	return cached(s.cache, cache.Key{UserID: userID, LibraryID: libraryID, Name: "letters", Params: fmt.Sprintf("%+v", filter)}, func() ([]models.LetterCount, error) {
+		return s.repo.ListLibraryLetters(ctx, userID, libraryID, filter)
+	})
 }
 
 // GetLibraryBook returns a single audiobook from the library catalog and verifies membership when possible.
 func (s *Service) GetLibraryBook(ctx context.Context, libraryID, audiobookID, userID string) (*models.Audiobook, error) {
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
 	book, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
 	if err != nil {
 		return nil, err
@@ -401,45 +777,191 @@ func (s *Service) GetLibraryBook(ctx context.Context, libraryID, audiobookID, us
 	if book.LibraryID != nil && strings.TrimSpace(libraryID) != "" && *book.LibraryID != strings.TrimSpace(libraryID) {
 		return nil, fmt.Errorf("audiobook not found in library %s", libraryID)
 	}
+	if err := s.attachListeners(ctx, book, userID); err != nil {
+		return nil, err
+	}
 	return book, nil
 }
 
+// GetSimilarBooks returns up to limit books per relation that share a
+// series, author or narrator with a library book, from every library the
+// user can see.
+func (s *Service) GetSimilarBooks(ctx context.Context, libraryID, audiobookID, userID string, limit int) (*models.SimilarBooks, error) {
+	if _, err := s.GetLibraryBook(ctx, libraryID, audiobookID, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSimilarAudiobooks(ctx, audiobookID, userID, limit)
+}
+
 // ListUserLibrary returns audiobooks in a user's personal library with pagination.
-func (s *Service) ListUserLibrary(ctx context.Context, userID, libraryID string, offset, limit int) ([]models.Audiobook, int, error) {
+func (s *Service) ListUserLibrary(ctx context.Context, userID, libraryID string, filter models.AudiobookFilter, offset, limit int) ([]models.Audiobook, int, error) {
 	var libraryRef *string
-	if trimmed := strings.TrimSpace(libraryID); trimmed != "" {
+	trimmed := strings.TrimSpace(libraryID)
+	if trimmed != "" {
 		libraryRef = &trimmed
 	}
-	return s.repo.ListAudiobooks(ctx, userID, libraryRef, offset, limit)
+	key := cache.Key{UserID: userID, LibraryID: trimmed, Name: "books", Params: fmt.Sprintf("%+v|%d|%d", filter, offset, limit)}
+	return s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		return s.repo.ListAudiobooks(ctx, userID, libraryRef, filter, offset, limit)
+	})
 }
 
 // GetLibraryItem returns a single audiobook from the user's library.
 func (s *Service) GetLibraryItem(ctx context.Context, audiobookID, userID string) (*models.Audiobook, error) {
-	// All users have access to all audiobooks - just fetch and return with user data (if any)
-	return s.repo.GetAudiobook(ctx, audiobookID, userID)
+	// Restricted libraries and per-audiobook overrides both apply
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
+	book, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachListeners(ctx, book, userID); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// attachListeners sets the other users listening to or having finished a
+// book, as far as the user and they share their listening.
+func (s *Service) attachListeners(ctx context.Context, book *models.Audiobook, userID string) error {
+	listeners, err := s.repo.ListAlsoListenedBy(ctx, book.ID, userID, book.PlaybackDuration()*progressCompleteRatio)
+	if err != nil {
+		return err
+	}
+	book.AlsoListenedBy = listeners
+	return nil
 }
 
-// UpdateProgress records listening progress for a user.
+// progressCompleteRatio is how far through an audiobook counts as finishing
+// it, leaving room for end credits.
+const progressCompleteRatio = 0.98
+
+// SetWebhooks publishes finished audiobooks to w.
+func (s *Service) SetWebhooks(w *webhooks.Service) {
+	s.webhooks = w
+}
+
+// UpdateProgress records listening progress for a user. With a progress
+// flush interval set the position is buffered in memory and written later,
+// see SetProgressFlushInterval; the returned data reflects it either way.
 func (s *Service) UpdateProgress(ctx context.Context, userID, audiobookID string, progressSec float64) (*models.UserAudiobookData, error) {
 	// Verify audiobook exists (user_audiobook_data will be created if it doesn't exist)
-	_, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
 
+	var previous float64
+	if audiobook.UserData != nil {
+		previous = audiobook.UserData.ProgressSec
+	}
 	now := time.Now().UTC()
-	return s.repo.UpdateUserProgress(ctx, userID, audiobookID, progressSec, &now)
+	var data *models.UserAudiobookData
+	if s.progress == nil {
+		if data, err = s.writeProgress(ctx, userID, audiobookID, progressSec, now); err != nil {
+			return nil, err
+		}
+	} else {
+		if buffered, ok := s.progress.put(userID, audiobookID, progressSec, now); ok {
+			previous = buffered
+		}
+		data = &models.UserAudiobookData{UserID: userID, AudiobookID: audiobookID}
+		if audiobook.UserData != nil {
+			data.IsFavorite = audiobook.UserData.IsFavorite
+		}
+		played := now.Truncate(time.Second)
+		data.ProgressSec, data.LastPlayedAt = progressSec, &played
+	}
+
+	total := audiobook.PlaybackDuration()
+	data.ApplyDuration(total)
+
+	// Only the update that crosses the line counts as finishing the book.
+	if total > 0 {
+		threshold := total * progressCompleteRatio
+		if progressSec >= threshold && previous < threshold {
+			s.recordActivity(ctx, models.ActivityBookFinished, audiobookID, userID)
+			s.webhooks.Publish(webhooks.EventProgressCompleted, map[string]interface{}{
+				"user_id":      userID,
+				"audiobook_id": audiobookID,
+				"title":        audiobook.ResolveMetadata().Title,
+				"progress_sec": progressSec,
+				"duration_sec": total,
+			})
+		}
+	}
+	return data, nil
+}
+
+// writeProgress saves a position reached at and extends the user's
+// listening session with it.
+func (s *Service) writeProgress(ctx context.Context, userID, audiobookID string, progressSec float64, at time.Time) (*models.UserAudiobookData, error) {
+	data, err := s.repo.UpdateUserProgress(ctx, userID, audiobookID, progressSec, &at)
+	if err != nil {
+		return nil, err
+	}
+	// Listening stats are best effort; the progress is what clients need.
+	if err := s.repo.RecordListening(ctx, userID, audiobookID, progressSec, at, s.sessionIdle); err != nil {
+		fmt.Printf("Failed to record listening session for %s: %v\n", audiobookID, err)
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return data, nil
 }
 
 // SetFavorite sets or clears the favorite flag for a user.
 func (s *Service) SetFavorite(ctx context.Context, userID, audiobookID string, isFavorite bool) (*models.UserAudiobookData, error) {
 	// Verify audiobook exists (user_audiobook_data will be created if it doesn't exist)
-	_, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.ensureAccess(ctx, userID, audiobookID); err != nil {
+		return nil, err
+	}
+	// The returned data includes the progress.
+	s.FlushUserProgress(ctx, userID)
 
-	return s.repo.SetUserFavorite(ctx, userID, audiobookID, isFavorite)
+	data, err := s.repo.SetUserFavorite(ctx, userID, audiobookID, isFavorite)
+	if err != nil {
+		return nil, err
+	}
+	data.ApplyDuration(audiobook.PlaybackDuration())
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	return data, nil
+}
+
+// TransferUserData moves a user's progress, favourites and access grants to
+// another user, e.g. when consolidating a duplicate account.
+func (s *Service) TransferUserData(ctx context.Context, fromUserID, toUserID string) (*models.UserDataTransfer, error) {
+	if fromUserID == toUserID {
+		return nil, fmt.Errorf("%w: cannot transfer data to the same user", apperrors.ErrInvalidInput)
+	}
+	s.FlushUserProgress(ctx, fromUserID)
+	s.FlushUserProgress(ctx, toUserID)
+	transfer, err := s.repo.TransferUserData(ctx, fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: fromUserID})
+	s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: toUserID})
+	return transfer, nil
+}
+
+// ensureAccess hides audiobooks restricted away from the user by reporting
+// them as missing.
+func (s *Service) ensureAccess(ctx context.Context, userID, audiobookID string) error {
+	allowed, err := s.repo.CanUserAccessAudiobook(ctx, userID, audiobookID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %w", apperrors.ErrAudiobookNotFound, sql.ErrNoRows)
+	}
+	return nil
 }
 
 func (s *Service) resolveLibraryForAsset(ctx context.Context, assetPath string) (string, string, error) {
@@ -448,26 +970,34 @@ func (s *Service) resolveLibraryForAsset(ctx context.Context, assetPath string)
 		return "", "", err
 	}
 
-	normalizedAsset := filepath.ToSlash(filepath.Clean(assetPath))
-	for _, lp := range libraryPaths {
-		normalizedPath := filepath.ToSlash(filepath.Clean(lp.Path))
-		if strings.HasPrefix(normalizedAsset, normalizedPath) {
-			if len(lp.Libraries) == 0 {
-				return "", "", fmt.Errorf("library path %s is not assigned to a library", lp.Name)
-			}
-			return lp.ID, lp.Libraries[0].ID, nil
+	// Nested library paths are rejected when added, but older ones may
+	// remain; the deepest containing path wins.
+	var match *models.LibraryPath
+	matchDepth := -1
+	for i, lp := range libraryPaths {
+		if !pathutil.Contains(lp.Path, assetPath) {
+			continue
+		}
+		if depth := len(pathutil.Resolve(lp.Path)); depth > matchDepth {
+			match, matchDepth = &libraryPaths[i], depth
 		}
 	}
+	if match != nil {
+		if len(match.Libraries) == 0 {
+			return "", "", fmt.Errorf("library path %s is not assigned to a library", match.Name)
+		}
+		return match.ID, match.Libraries[0].ID, nil
+	}
 
 	return "", "", fmt.Errorf("no library path registered for asset %s", assetPath)
 }
 
 type discoveredFile struct {
-	Path     string
-	MimeType string
+	Path      string
+	Detection media.Detection
 }
 
-func discoverMediaFiles(sourcePath string) (string, []discoveredFile, error) {
+func discoverMediaFiles(sourcePath string, detector media.Detector) (string, []discoveredFile, error) {
 	info, err := os.Stat(sourcePath)
 	if err != nil {
 		return "", nil, fmt.Errorf("stat source: %w", err)
@@ -485,7 +1015,7 @@ func discoverMediaFiles(sourcePath string) (string, []discoveredFile, error) {
 			if d.IsDir() {
 				return nil
 			}
-			if !isAudioFile(path) {
+			if !media.IsAudioFile(path) {
 				return nil
 			}
 			rel, err := filepath.Rel(base, path)
@@ -493,8 +1023,8 @@ func discoverMediaFiles(sourcePath string) (string, []discoveredFile, error) {
 				return err
 			}
 			files = append(files, discoveredFile{
-				Path:     filepath.ToSlash(rel),
-				MimeType: mimeTypeFor(path),
+				Path:      filepath.ToSlash(rel),
+				Detection: detector.Detect(path),
 			})
 			return nil
 		})
@@ -503,10 +1033,10 @@ func discoverMediaFiles(sourcePath string) (string, []discoveredFile, error) {
 		}
 	} else {
 		base = filepath.Dir(sourcePath)
-		if isAudioFile(sourcePath) {
+		if media.IsAudioFile(sourcePath) {
 			files = append(files, discoveredFile{
-				Path:     filepath.ToSlash(info.Name()),
-				MimeType: mimeTypeFor(sourcePath),
+				Path:      filepath.ToSlash(info.Name()),
+				Detection: detector.Detect(sourcePath),
 			})
 		}
 	}
@@ -527,36 +1057,90 @@ func discoverMediaFiles(sourcePath string) (string, []discoveredFile, error) {
 	return base, files, nil
 }
 
-func isAudioFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".mp3", ".m4b", ".m4a", ".flac", ".ogg", ".wav", ".aac":
-		return true
-	default:
-		return false
+// GetUserFavorites returns audiobooks the user has marked as favorite.
+func (s *Service) GetUserFavorites(ctx context.Context, userID string, libraryID *string, offset, limit int) ([]models.Audiobook, int, error) {
+	key := cache.Key{UserID: userID, Name: "favorites", Params: fmt.Sprintf("%d|%d", offset, limit)}
+	if libraryID != nil {
+		key.LibraryID = *libraryID
 	}
+	return s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		return s.repo.GetUserFavorites(ctx, userID, libraryID, offset, limit)
+	})
 }
 
-func mimeTypeFor(path string) string {
-	ext := filepath.Ext(path)
-	if ext == "" {
-		return "application/octet-stream"
+// ListRecentlyAdded returns the newest audiobooks the user can see.
+func (s *Service) ListRecentlyAdded(ctx context.Context, userID string, libraryID *string, limit int) ([]models.Audiobook, error) {
+	key := cache.Key{UserID: userID, Name: "recent", Params: fmt.Sprintf("%d", limit)}
+	if libraryID != nil {
+		key.LibraryID = *libraryID
 	}
-	t := mime.TypeByExtension(strings.ToLower(ext))
-	if t == "" {
-		return "application/octet-stream"
+	books, _, err := s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		filter := models.AudiobookFilter{Sort: models.SortRecentlyAdded}
+		books, _, err := s.repo.ListAudiobooks(ctx, userID, libraryID, filter, 0, limit)
+		return books, len(books), err
+	})
+	return books, err
+}
+
+// ListNextInSeries returns the next unstarted book of each series the user
+// finished a book in.
+func (s *Service) ListNextInSeries(ctx context.Context, userID string, libraryID *string, limit int) ([]models.Audiobook, error) {
+	key := cache.Key{UserID: userID, Name: "next_in_series", Params: fmt.Sprintf("%d", limit)}
+	if libraryID != nil {
+		key.LibraryID = *libraryID
 	}
-	return t
+	books, _, err := s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		books, err := s.repo.ListNextInSeries(ctx, userID, libraryID, progressCompleteRatio, limit)
+		return books, len(books), err
+	})
+	return books, err
 }
 
-// GetUserFavorites returns audiobooks the user has marked as favorite.
-func (s *Service) GetUserFavorites(ctx context.Context, userID string, libraryID *string, offset, limit int) ([]models.Audiobook, int, error) {
-	return s.repo.GetUserFavorites(ctx, userID, libraryID, offset, limit)
+// Home composes the home screen rows, each holding up to limit books.
+func (s *Service) Home(ctx context.Context, userID string, libraryID *string, limit int) ([]models.HomeRow, error) {
+	continueListening, err := s.GetContinueListening(ctx, userID, libraryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("continue listening: %w", err)
+	}
+	recent, err := s.ListRecentlyAdded(ctx, userID, libraryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("recently added: %w", err)
+	}
+	next, err := s.ListNextInSeries(ctx, userID, libraryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("next in series: %w", err)
+	}
+	favorites, _, err := s.GetUserFavorites(ctx, userID, libraryID, 0, limit)
+	if err != nil {
+		return nil, fmt.Errorf("favorites: %w", err)
+	}
+
+	return []models.HomeRow{
+		{ID: models.HomeContinueListening, Title: "Continue Listening", Books: nonNilBooks(continueListening)},
+		{ID: models.HomeRecentlyAdded, Title: "Recently Added", Books: nonNilBooks(recent)},
+		{ID: models.HomeNextInSeries, Title: "Next in Series", Books: nonNilBooks(next)},
+		{ID: models.HomeFavorites, Title: "Favorites", Books: nonNilBooks(favorites)},
+	}, nil
+}
+
+func nonNilBooks(books []models.Audiobook) []models.Audiobook {
+	if books == nil {
+		return []models.Audiobook{}
+	}
+	return books
 }
 
 // GetContinueListening returns audiobooks the user is currently listening to.
 func (s *Service) GetContinueListening(ctx context.Context, userID string, libraryID *string, limit int) ([]models.Audiobook, error) {
-	return s.repo.GetContinueListening(ctx, userID, libraryID, limit)
+	key := cache.Key{UserID: userID, Name: "continue", Params: fmt.Sprintf("%d", limit)}
+	if libraryID != nil {
+		key.LibraryID = *libraryID
+	}
+	books, _, err := s.listBooks(key, func() ([]models.Audiobook, int, error) {
+		books, err := s.repo.GetContinueListening(ctx, userID, libraryID, limit)
+		return books, len(books), err
+	})
+	return books, err
 }
 
 
@@ -566,7 +1150,12 @@ func (s *Service) GetContinueListening(ctx context.Context, userID string, libra
 
 // SaveMetadataOverrides saves manual metadata overrides for an audiobook
 func (s *Service) SaveMetadataOverrides(ctx context.Context, custom *models.CustomMetadata) error {
-	return s.repo.SaveMetadataOverrides(ctx, custom)
+	if err := s.repo.SaveMetadataOverrides(ctx, custom); err != nil {
+		return err
+	}
+	s.refreshResolved(ctx, custom.AudiobookID)
+	s.recordActivity(ctx, models.ActivityMetadataUpdated, custom.AudiobookID, "")
+	return nil
 }
 
 // GetMetadataOverrides retrieves metadata overrides for an audiobook
@@ -576,10 +1165,165 @@ func (s *Service) GetMetadataOverrides(ctx context.Context, audiobookID string)
 
 // DeleteMetadataOverrides removes all manual overrides for an audiobook
 func (s *Service) DeleteMetadataOverrides(ctx context.Context, audiobookID string) error {
-	return s.repo.DeleteMetadataOverrides(ctx, audiobookID)
+	if err := s.repo.DeleteMetadataOverrides(ctx, audiobookID); err != nil {
+		return err
+	}
+	s.refreshResolved(ctx, audiobookID)
+	s.recordActivity(ctx, models.ActivityMetadataUpdated, audiobookID, "")
+	return nil
 }
 
 // GetEmbeddedMetadata retrieves embedded metadata for an audiobook
 func (s *Service) GetEmbeddedMetadata(ctx context.Context, audiobookID string) (*models.EmbeddedMetadata, error) {
 	return s.repo.GetEmbeddedMetadata(ctx, audiobookID)
 }
+
+// ExtractEmbeddedMetadata reads the tags of an audiobook's first media file
+// into its embedded metadata layer, replacing any earlier extraction.
+func (s *Service) ExtractEmbeddedMetadata(ctx context.Context, audiobookID string) (*models.EmbeddedMetadata, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(audiobook.MediaFiles) == 0 {
+		return nil, ErrNoMediaFiles
+	}
+
+	fullPath, err := resolveMediaPath(audiobook.AssetPath, audiobook.MediaFiles[0].Filename)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := s.prober.Probe(ctx, fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Audiobooks are tagged like albums: the album names the book, the album
+	// artist its author and the composer usually its narrator.
+	tags := probe.Tags
+	optional := func(values ...string) *string {
+		for _, v := range values {
+			if v != "" {
+				return &v
+			}
+		}
+		return nil
+	}
+	meta := &models.EmbeddedMetadata{
+		AudiobookID: audiobookID,
+		Title:       optional(tags.Album, tags.Title),
+		Author:      optional(tags.AlbumArtist, tags.Artist),
+		Narrator:    optional(tags.Composer),
+		Album:       optional(tags.Album),
+		Genre:       optional(tags.Genre),
+		Year:        optional(tags.Year),
+		TrackNumber: optional(tags.Track),
+		Comment:     optional(tags.Comment),
+	}
+
+	existing, err := s.repo.GetEmbeddedMetadata(ctx, audiobookID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		err = s.repo.CreateEmbeddedMetadata(ctx, meta)
+	} else {
+		err = s.repo.UpdateEmbeddedMetadata(ctx, meta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.refreshResolved(ctx, audiobookID)
+	s.recordActivity(ctx, models.ActivityMetadataUpdated, audiobookID, "")
+	return s.repo.GetEmbeddedMetadata(ctx, audiobookID)
+}
+
+// =============================================================================
+// Per-Audiobook Access Overrides
+// =============================================================================
+
+// GetAudiobookAccess lists the access rules restricting an audiobook.
+func (s *Service) GetAudiobookAccess(ctx context.Context, audiobookID string) ([]models.AudiobookAccessRule, error) {
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, ""); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAudiobookAccess(ctx, audiobookID)
+}
+
+// SetAudiobookAccess restricts an audiobook to the given users and roles.
+// Passing no users and no roles makes the audiobook visible to everyone again.
+func (s *Service) SetAudiobookAccess(ctx context.Context, audiobookID string, userIDs, roles []string) ([]models.AudiobookAccessRule, error) {
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, ""); err != nil {
+		return nil, err
+	}
+
+	rules := make([]models.AudiobookAccessRule, 0, len(userIDs)+len(roles))
+	for _, userID := range userIDs {
+		userID = strings.TrimSpace(userID)
+		if userID == "" {
+			return nil, fmt.Errorf("user IDs cannot be empty")
+		}
+		rules = append(rules, models.AudiobookAccessRule{PrincipalType: models.AccessPrincipalUser, PrincipalID: userID})
+	}
+	for _, role := range roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role != models.RoleAdmin && role != models.RoleUser {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		rules = append(rules, models.AudiobookAccessRule{PrincipalType: models.AccessPrincipalRole, PrincipalID: role})
+	}
+
+	if err := s.repo.SetAudiobookAccess(ctx, audiobookID, rules); err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.Event{Type: events.AccessChanged})
+	return s.repo.ListAudiobookAccess(ctx, audiobookID)
+}
+
+// =============================================================================
+// Download Audit Trail
+// =============================================================================
+
+// RecordDownload stores a download in the audit trail.
+func (s *Service) RecordDownload(ctx context.Context, record *models.DownloadRecord) error {
+	return s.repo.RecordDownload(ctx, record)
+}
+
+// ListDownloads returns audit trail entries matching the filter.
+func (s *Service) ListDownloads(ctx context.Context, filter models.DownloadFilter, offset, limit int) ([]models.DownloadRecord, int, error) {
+	return s.repo.ListDownloads(ctx, filter, offset, limit)
+}
+
+// DownloadReport summarises download egress per user.
+func (s *Service) DownloadReport(ctx context.Context, filter models.DownloadFilter) ([]models.DownloadUserSummary, error) {
+	return s.repo.DownloadReport(ctx, filter)
+}
+
+// =============================================================================
+// Client Logs
+// =============================================================================
+
+// RecordClientLog stores an error report from a client and drops reports
+// older than the retention period.
+func (s *Service) RecordClientLog(ctx context.Context, entry *models.ClientLog) error {
+	if err := s.repo.RecordClientLog(ctx, entry); err != nil {
+		return err
+	}
+	if s.clientLogRetention > 0 {
+		// The report is stored; failing to prune only delays the cleanup.
+		if _, err := s.repo.DeleteClientLogsBefore(ctx, time.Now().Add(-s.clientLogRetention)); err != nil {
+			log.Printf("prune client logs: %v", err)
+		}
+	}
+	return nil
+}
+
+// ListClientLogs returns client logs matching the filter, newest first.
+func (s *Service) ListClientLogs(ctx context.Context, filter models.ClientLogFilter, offset, limit int) ([]models.ClientLog, int, error) {
+	return s.repo.ListClientLogs(ctx, filter, offset, limit)
+}
+
+// GetClientLog returns a single client log.
+func (s *Service) GetClientLog(ctx context.Context, id string) (*models.ClientLog, error) {
+	return s.repo.GetClientLog(ctx, id)
+}
@@ -0,0 +1,87 @@
+package audiobooks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+// DefaultSessionIdleTimeout is how long a listening session lasts without
+// progress updates unless SetSessionIdleTimeout says otherwise.
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// SetSessionIdleTimeout closes listening sessions that got no progress
+// update for d.
+func (s *Service) SetSessionIdleTimeout(d time.Duration) {
+	if d > 0 {
+		s.sessionIdle = d
+	}
+}
+
+// WatchSessions closes idle listening sessions each interval until ctx ends,
+// so players that stopped without a final update do not stay active and the
+// time they played is counted in listening stats.
+func (s *Service) WatchSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.repo.CloseStaleSessions(ctx, time.Now().Add(-s.sessionIdle)); err != nil && ctx.Err() == nil {
+			fmt.Printf("Failed to close idle listening sessions: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListActiveSessions returns the listening sessions that got a progress
+// update within the idle timeout, most recently active first.
+func (s *Service) ListActiveSessions(ctx context.Context) ([]models.ListeningSession, error) {
+	sessions, err := s.repo.ListOpenSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions gone idle since the last sweep are left to it.
+	cutoff := time.Now().Add(-s.sessionIdle)
+	active := sessions[:0]
+	for _, session := range sessions {
+		if !session.LastActiveAt.Before(cutoff) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// ListeningStats returns a user's listening time per day over the last days
+// days, counting closed sessions only, and their progress towards their
+// goals.
+func (s *Service) ListeningStats(ctx context.Context, userID string, days int) (*models.ListeningStats, error) {
+	since := time.Now().UTC().AddDate(0, 0, -(days - 1))
+	stats, err := s.repo.GetListeningStats(ctx, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Goals, err = s.GetGoalProgress(ctx, userID); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ListeningReport totals every user's listening on the days from since to
+// until inclusive, as YYYY-MM-DD; either may be empty to leave that end open.
+func (s *Service) ListeningReport(ctx context.Context, since, until string) ([]models.UserListeningSummary, error) {
+	for field, day := range map[string]string{"since": since, "until": until} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return nil, apperrors.NewValidationError(field, "expected a date as YYYY-MM-DD", day)
+		}
+	}
+	return s.repo.ListeningReport(ctx, since, until)
+}
@@ -0,0 +1,68 @@
+package audiobooks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/sidecar"
+)
+
+// exportSidecar writes an audiobook's resolved metadata to the metadata.json
+// in its folder, when its library's export_metadata_sidecar setting asks for
+// it. Single-file audiobooks have no folder of their own and are skipped.
+func (s *Service) exportSidecar(ctx context.Context, audiobookID string) error {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil || audiobook.LibraryID == nil {
+		return err
+	}
+	library, err := s.repo.GetLibraryByID(ctx, *audiobook.LibraryID)
+	if err != nil {
+		return err
+	}
+	if !library.Settings.ExportMetadataSidecar {
+		return nil
+	}
+	if info, err := os.Stat(audiobook.AssetPath); err != nil || !info.IsDir() {
+		return err
+	}
+
+	_, err = sidecar.ExportMetadata(audiobook.AssetPath, sidecarMetadata(audiobook.ResolveMetadata()))
+	return err
+}
+
+// sidecarMetadata converts resolved metadata for export. Narrators are
+// listed one by one; the author credit is kept whole, as "Last, First"
+// names cannot be told apart from lists.
+func sidecarMetadata(resolved *models.AgentMetadata) *sidecar.Metadata {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	meta := &sidecar.Metadata{
+		Title:          resolved.Title,
+		Subtitle:       value(resolved.Subtitle),
+		SeriesName:     value(resolved.SeriesName),
+		SeriesSequence: value(resolved.SeriesSequence),
+		Description:    value(resolved.Description),
+		ReleaseDate:    value(resolved.ReleaseDate),
+		Publisher:      value(resolved.Publisher),
+		ISBN:           value(resolved.ISBN),
+		ASIN:           value(resolved.ASIN),
+		Language:       value(resolved.Language),
+	}
+	if resolved.Author != "" {
+		meta.Authors = []string{resolved.Author}
+	}
+	for _, narrator := range metadata.SplitNarrators(value(resolved.Narrator)) {
+		meta.Narrators = append(meta.Narrators, narrator.Name)
+	}
+	if resolved.Genres != nil {
+		json.Unmarshal([]byte(*resolved.Genres), &meta.Genres)
+	}
+	return meta
+}
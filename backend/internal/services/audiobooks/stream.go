@@ -0,0 +1,168 @@
+package audiobooks
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/media"
+)
+
+// Ways an audiobook is delivered as one continuous stream.
+const (
+	// StreamJoined serves the files' bytes one after another, with range
+	// requests across the whole book.
+	StreamJoined = "joined"
+	// StreamTranscode re-encodes the files to one MP3 with ffmpeg; the
+	// length is unknown up front, so it cannot be seeked.
+	StreamTranscode = "transcode"
+)
+
+// ErrNotStreamable is returned when an audiobook's files cannot be joined
+// into one stream and ffmpeg is not available to transcode them.
+var ErrNotStreamable = errors.New("the audiobook's files cannot be joined into one stream without ffmpeg")
+
+// ErrHLSUnavailable is returned when an audiobook cannot be served as HLS:
+// segments are cut with ffmpeg at known positions, so it needs ffmpeg and
+// the duration of every file.
+var ErrHLSUnavailable = errors.New("HLS needs ffmpeg and the duration of every file")
+
+// PlaybackManifest places an audiobook's media files on the timeline of its
+// continuous stream, so a position in the book maps to a file and an offset
+// into it.
+type PlaybackManifest struct {
+	AudiobookID string  `json:"audiobook_id"`
+	Method      string  `json:"method"`
+	MimeType    string  `json:"mime_type"`
+	DurationSec float64 `json:"duration_sec"`
+	// SizeBytes is the length of a joined stream.
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+	StreamURL string `json:"stream_url,omitempty"`
+	// HLSURL is the audiobook's HLS playlist, signed so players that
+	// cannot send headers may load it.
+	HLSURL string                 `json:"hls_url,omitempty"`
+	Files  []PlaybackManifestFile `json:"files"`
+	// ETag identifies the files' contents.
+	ETag     string    `json:"-"`
+	Modified time.Time `json:"-"`
+}
+
+// PlaybackManifestFile is one media file on a stream's timeline.
+type PlaybackManifestFile struct {
+	ID          string  `json:"id"`
+	Filename    string  `json:"filename"`
+	MimeType    string  `json:"mime_type"`
+	StartSec    float64 `json:"start_sec"`
+	EndSec      float64 `json:"end_sec"`
+	DurationSec float64 `json:"duration_sec"`
+	SizeBytes   int64   `json:"size_bytes"`
+	// ByteOffset is where the file starts in a joined stream.
+	ByteOffset *int64 `json:"byte_offset,omitempty"`
+	Path       string `json:"-"`
+}
+
+// AudiobookPlaybackManifest lays out an audiobook's media files in playback
+// order on one timeline, with the same access checks as streaming. Files of
+// one joinable format are served joined, anything else is transcoded.
+func (s *Service) AudiobookPlaybackManifest(ctx context.Context, audiobookID, userID string, isAdmin bool) (*PlaybackManifest, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAudiobookAccess(ctx, audiobook.ID, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	if len(audiobook.MediaFiles) == 0 {
+		return nil, ErrNoMediaFiles
+	}
+
+	manifest := &PlaybackManifest{
+		AudiobookID: audiobook.ID,
+		Files:       make([]PlaybackManifestFile, 0, len(audiobook.MediaFiles)),
+	}
+	mimeTypes := make([]string, 0, len(audiobook.MediaFiles))
+	etag := sha1.New()
+	for _, mf := range audiobook.MediaFiles {
+		fullPath, err := resolveMediaPath(audiobook.AssetPath, mf.Filename)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("file access error: %w", err)
+		}
+		if info.ModTime().After(manifest.Modified) {
+			manifest.Modified = info.ModTime()
+		}
+		io.WriteString(etag, mf.ID+"\x00"+strconv.FormatInt(info.Size(), 10)+"\x00"+strconv.FormatInt(info.ModTime().Unix(), 10)+"\x00")
+
+		manifest.Files = append(manifest.Files, PlaybackManifestFile{
+			ID:          mf.ID,
+			Filename:    mf.Filename,
+			MimeType:    mf.MimeType,
+			StartSec:    manifest.DurationSec,
+			EndSec:      manifest.DurationSec + mf.DurationSec,
+			DurationSec: mf.DurationSec,
+			SizeBytes:   info.Size(),
+			Path:        fullPath,
+		})
+		manifest.DurationSec += mf.DurationSec
+		mimeTypes = append(mimeTypes, mf.MimeType)
+	}
+
+	manifest.ETag = `"` + hex.EncodeToString(etag.Sum(nil)) + `"`
+	switch {
+	case media.Joinable(mimeTypes):
+		manifest.Method, manifest.MimeType = StreamJoined, mimeTypes[0]
+		for i := range manifest.Files {
+			offset := manifest.SizeBytes
+			manifest.Files[i].ByteOffset = &offset
+			manifest.SizeBytes += manifest.Files[i].SizeBytes
+		}
+	case media.TranscoderAvailable():
+		manifest.Method, manifest.MimeType = StreamTranscode, media.TranscodeMimeType
+	default:
+		return nil, ErrNotStreamable
+	}
+	return manifest, nil
+}
+
+// HLSAvailable reports whether the manifest's audiobook can be served as
+// HLS.
+func (s *Service) HLSAvailable(manifest *PlaybackManifest) bool {
+	if s.hls == nil || !media.TranscoderAvailable() {
+		return false
+	}
+	for _, f := range manifest.Files {
+		if f.DurationSec <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// HLSSegment returns the path of HLS segment index of the manifest's
+// audiobook, cutting it from the files when it is not cached yet. AAC audio
+// is copied into the segments; anything else is encoded to AAC.
+func (s *Service) HLSSegment(ctx context.Context, manifest *PlaybackManifest, index int) (string, error) {
+	if !s.HLSAvailable(manifest) {
+		return "", ErrHLSUnavailable
+	}
+	opts := media.HLSSegmentOptions{
+		Paths: make([]string, len(manifest.Files)),
+		Index: index,
+	}
+	mimeTypes := make([]string, len(manifest.Files))
+	for i, f := range manifest.Files {
+		opts.Paths[i], mimeTypes[i] = f.Path, f.MimeType
+	}
+	opts.Remux = media.HLSRemuxable(mimeTypes)
+	return s.hls.Segment(ctx, manifest.AudiobookID, strings.Trim(manifest.ETag, `"`), opts)
+}
@@ -0,0 +1,304 @@
+package audiobooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/covers"
+	"github.com/lore/backend/internal/httpclient"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/models"
+)
+
+// ErrTagWritingDisabled is returned when tags are written for a library
+// without the write_tags setting.
+var ErrTagWritingDisabled = errors.New("tag writing is not enabled for this library")
+
+// coverClient downloads remote covers to embed in files.
+var coverClient = httpclient.New(httpclient.Options{Name: "covers", Timeout: 30 * time.Second})
+
+// TagWriteResult describes the files an audiobook's tags were written to.
+type TagWriteResult struct {
+	AudiobookID string `json:"audiobook_id"`
+	// Written lists the files rewritten, Skipped those in formats tags
+	// cannot be written to, e.g. WAV or WMA.
+	Written []string `json:"written"`
+	Skipped []string `json:"skipped,omitempty"`
+	// Errors lists files that could not be rewritten; they are left as
+	// they were.
+	Errors        []string `json:"errors,omitempty"`
+	CoverEmbedded bool     `json:"cover_embedded"`
+}
+
+// LibraryTagWriteResult sums up writing the tags of a library's audiobooks.
+type LibraryTagWriteResult struct {
+	LibraryID  string `json:"library_id"`
+	Audiobooks int    `json:"audiobooks"`
+	Written    int    `json:"written"`
+	Skipped    int    `json:"skipped"`
+	// Failed lists the audiobooks with files that could not be rewritten.
+	Failed []TagWriteResult `json:"failed,omitempty"`
+}
+
+// CheckTagsWritable reports whether the tags of an audiobook may be written,
+// so callers can reject a request before queueing it.
+func (s *Service) CheckTagsWritable(ctx context.Context, audiobookID string) error {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return err
+	}
+	if len(audiobook.MediaFiles) == 0 {
+		return ErrNoMediaFiles
+	}
+	return s.checkAudiobookLibrary(ctx, audiobook)
+}
+
+// checkAudiobookLibrary checks the library of an audiobook allows writing
+// tags. Audiobooks outside a library have no setting to allow it.
+func (s *Service) checkAudiobookLibrary(ctx context.Context, audiobook *models.Audiobook) error {
+	if audiobook.LibraryID == nil {
+		return ErrTagWritingDisabled
+	}
+	return s.CheckLibraryTagsWritable(ctx, *audiobook.LibraryID)
+}
+
+// CheckLibraryTagsWritable reports whether a library allows writing tags
+// into its files.
+func (s *Service) CheckLibraryTagsWritable(ctx context.Context, libraryID string) error {
+	library, err := s.repo.GetLibraryByID(ctx, libraryID)
+	if err != nil {
+		return err
+	}
+	if !library.Settings.WriteTags {
+		return ErrTagWritingDisabled
+	}
+	return nil
+}
+
+// WriteTags writes an audiobook's resolved metadata into the tags of its
+// media files, so they keep their title, author, narrator, series and cover
+// when used outside Lore. The cover is the uploaded one, or else the
+// resolved cover URL; without either the files keep their embedded cover.
+func (s *Service) WriteTags(ctx context.Context, audiobookID string, progress func(done, total int)) (*TagWriteResult, error) {
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(audiobook.MediaFiles) == 0 {
+		return nil, ErrNoMediaFiles
+	}
+	if err := s.checkAudiobookLibrary(ctx, audiobook); err != nil {
+		return nil, err
+	}
+	return s.writeTags(ctx, audiobook, func(done, total int) {
+		if progress != nil {
+			progress(done, total)
+		}
+	})
+}
+
+// WriteLibraryTags writes the tags of every audiobook in a library, one
+// after the other. Failures of single files are reported in the result.
+func (s *Service) WriteLibraryTags(ctx context.Context, libraryID string, progress func(done, total int)) (*LibraryTagWriteResult, error) {
+	if err := s.CheckLibraryTagsWritable(ctx, libraryID); err != nil {
+		return nil, err
+	}
+	ids, err := s.repo.ListAudiobookIDs(ctx, []string{libraryID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audiobooks: %w", err)
+	}
+
+	result := &LibraryTagWriteResult{LibraryID: libraryID}
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(i, len(ids))
+		}
+
+		audiobook, err := s.repo.GetAudiobook(ctx, id, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(audiobook.MediaFiles) == 0 {
+			continue
+		}
+		written, err := s.writeTags(ctx, audiobook, func(int, int) {})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			written = &TagWriteResult{AudiobookID: id, Errors: []string{err.Error()}}
+		}
+		result.Audiobooks++
+		result.Written += len(written.Written)
+		result.Skipped += len(written.Skipped)
+		if len(written.Errors) > 0 {
+			result.Failed = append(result.Failed, *written)
+		}
+	}
+	if progress != nil {
+		progress(len(ids), len(ids))
+	}
+	return result, nil
+}
+
+// writeTags rewrites the tags of each of an audiobook's files, reporting
+// progress per file.
+func (s *Service) writeTags(ctx context.Context, audiobook *models.Audiobook, progress func(done, total int)) (*TagWriteResult, error) {
+	resolved := audiobook.ResolveMetadata()
+	tags := resolvedTags(resolved)
+
+	coverPath, cleanup, err := s.tagCover(ctx, audiobook.ID, resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	result := &TagWriteResult{AudiobookID: audiobook.ID, Written: []string{}}
+	total := len(audiobook.MediaFiles)
+	for i, mf := range audiobook.MediaFiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress(i, total)
+
+		if !media.TagsWritable(mf.Filename) {
+			result.Skipped = append(result.Skipped, mf.Filename)
+			continue
+		}
+		fullPath, err := resolveMediaPath(audiobook.AssetPath, mf.Filename)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", mf.Filename, err))
+			continue
+		}
+
+		fileTags := tags
+		if total > 1 {
+			fileTags.Track, fileTags.TrackCount = i+1, total
+		}
+		if err := media.WriteTags(ctx, fullPath, fileTags, coverPath); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", mf.Filename, err))
+			continue
+		}
+		result.Written = append(result.Written, mf.Filename)
+		if coverPath != "" && media.CoverEmbeddable(mf.Filename) {
+			result.CoverEmbedded = true
+		}
+	}
+	progress(total, total)
+
+	return result, nil
+}
+
+// resolvedTags maps resolved metadata to file tags.
+func resolvedTags(resolved *models.AgentMetadata) media.TagValues {
+	tags := media.TagValues{
+		Title:  resolved.Title,
+		Author: resolved.Author,
+	}
+	if resolved.Subtitle != nil && *resolved.Subtitle != "" {
+		tags.Title += ": " + *resolved.Subtitle
+	}
+	if resolved.Narrator != nil {
+		tags.Narrator = *resolved.Narrator
+	}
+	if resolved.SeriesName != nil {
+		tags.Series = *resolved.SeriesName
+		if resolved.SeriesSequence != nil {
+			tags.SeriesPart = *resolved.SeriesSequence
+		}
+	}
+	if resolved.ReleaseDate != nil {
+		tags.Date = *resolved.ReleaseDate
+	}
+	if resolved.Publisher != nil {
+		tags.Publisher = *resolved.Publisher
+	}
+	if resolved.Description != nil {
+		tags.Description = *resolved.Description
+	}
+	if resolved.Genres != nil {
+		var genres []string
+		if json.Unmarshal([]byte(*resolved.Genres), &genres) == nil {
+			tags.Genre = strings.Join(genres, ", ")
+		}
+	}
+	return tags
+}
+
+// tagCover returns the path of the cover to embed, or "" to keep the files'
+// covers, and a function removing any file downloaded for it.
+func (s *Service) tagCover(ctx context.Context, audiobookID string, resolved *models.AgentMetadata) (string, func(), error) {
+	noop := func() {}
+	if s.covers != nil {
+		path, err := s.covers.Path(ctx, audiobookID, 0)
+		if err == nil {
+			return path, noop, nil
+		}
+		if !errors.Is(err, covers.ErrNotFound) {
+			return "", noop, fmt.Errorf("failed to read cover: %w", err)
+		}
+	}
+	if resolved.CoverURL == nil {
+		return "", noop, nil
+	}
+	coverURL := *resolved.CoverURL
+	if !models.IsRemoteURL(coverURL) {
+		return "", noop, nil
+	}
+	if s.remoteCovers != nil {
+		path, err := s.remoteCovers.Path(ctx, coverURL, 0)
+		if err != nil {
+			return "", noop, fmt.Errorf("failed to download cover: %w", err)
+		}
+		return path, noop, nil
+	}
+
+	path, err := downloadCover(ctx, coverURL)
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to download cover: %w", err)
+	}
+	return path, func() { os.Remove(path) }, nil
+}
+
+// downloadCover saves the image at coverURL to a temporary file.
+func downloadCover(ctx context.Context, coverURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", coverURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := coverClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: status %d", coverURL, resp.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp("", "lore-cover-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, io.LimitReader(resp.Body, covers.MaxUploadSize))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,48 @@
+package audiobooks
+
+import (
+	"context"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/models"
+)
+
+// LinkEditions links audiobookID with the books in editionIDs as editions of
+// one work, merging any works they already belong to. Users' progress stays
+// per edition; favourites are shared by the work.
+func (s *Service) LinkEditions(ctx context.Context, audiobookID string, editionIDs []string) (*models.Audiobook, error) {
+	if len(editionIDs) == 0 {
+		return nil, apperrors.NewValidationError("audiobook_ids", "at least one other audiobook is required", nil)
+	}
+	ids := []string{audiobookID}
+	seen := map[string]bool{audiobookID: true}
+	for _, id := range editionIDs {
+		if seen[id] {
+			continue
+		}
+		if _, err := s.repo.GetAudiobook(ctx, id, ""); err != nil {
+			return nil, apperrors.NewValidationError("audiobook_ids", "unknown audiobook", id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if _, err := s.repo.GetAudiobook(ctx, audiobookID, ""); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.LinkEditions(ctx, ids); err != nil {
+		return nil, err
+	}
+	// Favourites of every user may have spread to the new editions.
+	s.catalogChanged(nil)
+	return s.repo.GetAudiobook(ctx, audiobookID, "")
+}
+
+// UnlinkEdition takes an audiobook out of its work.
+func (s *Service) UnlinkEdition(ctx context.Context, audiobookID string) error {
+	if err := s.repo.UnlinkEdition(ctx, audiobookID); err != nil {
+		return err
+	}
+	s.catalogChanged(nil)
+	return nil
+}
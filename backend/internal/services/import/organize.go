@@ -0,0 +1,265 @@
+package importservice
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/pathutil"
+)
+
+// Organize plan statuses.
+const (
+	OrganizePlanned   = "planned"
+	OrganizeMoved     = "moved"
+	OrganizeUnchanged = "unchanged"
+	OrganizeSkipped   = "skipped"
+	OrganizeFailed    = "failed"
+)
+
+// OrganizeRequest selects audiobooks to reorganize on disk.
+type OrganizeRequest struct {
+	AudiobookIDs []string `json:"audiobook_ids"`
+	LibraryIDs   []string `json:"library_ids"`
+	// Template overrides the configured import template.
+	Template string `json:"template"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+// FileRename is a single planned or applied rename.
+type FileRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// OrganizePlan describes how one audiobook is (or would be) moved.
+type OrganizePlan struct {
+	AudiobookID string       `json:"audiobook_id"`
+	Title       string       `json:"title"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Files       []FileRename `json:"files,omitempty"`
+	Status      string       `json:"status"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// OrganizeResult is the outcome of an organize run.
+type OrganizeResult struct {
+	DryRun bool           `json:"dry_run"`
+	Plans  []OrganizePlan `json:"plans"`
+}
+
+// Organize applies the import template to already-imported audiobooks,
+// moving each into place under its library path. With DryRun set, nothing is
+// touched and the planned renames are returned. Each move is applied on disk
+// first and rolled back if the database update fails.
+func (s *Service) Organize(ctx context.Context, req OrganizeRequest, progress func(done, total int)) (*OrganizeResult, error) {
+	template := req.Template
+	if template == "" {
+		settings, err := s.repo.GetImportSettings(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get import settings: %w", err)
+		}
+		template = settings.Template
+	}
+	if template == "" || template == "flat" {
+		return nil, fmt.Errorf("organize requires a folder template such as {author}/{series}/{title}")
+	}
+
+	ids := req.AudiobookIDs
+	if len(ids) == 0 {
+		var err error
+		ids, err = s.repo.ListAudiobookIDs(ctx, req.LibraryIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &OrganizeResult{DryRun: req.DryRun, Plans: make([]OrganizePlan, 0, len(ids))}
+	moved := false
+	defer func() {
+		if moved {
+			s.events.Publish(events.Event{Type: events.CatalogChanged})
+		}
+	}()
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if progress != nil {
+			progress(i, len(ids))
+		}
+
+		plan := s.planOrganize(ctx, id, template)
+		if plan.Status == OrganizePlanned && !req.DryRun {
+			s.applyOrganize(ctx, &plan)
+			moved = moved || plan.Status == OrganizeMoved
+		}
+		result.Plans = append(result.Plans, plan)
+	}
+	if progress != nil {
+		progress(len(ids), len(ids))
+	}
+
+	return result, nil
+}
+
+// planOrganize works out the destination for one audiobook.
+func (s *Service) planOrganize(ctx context.Context, audiobookID, template string) OrganizePlan {
+	plan := OrganizePlan{AudiobookID: audiobookID}
+
+	audiobook, err := s.repo.GetAudiobook(ctx, audiobookID, "")
+	if err != nil {
+		plan.Status = OrganizeFailed
+		plan.Error = err.Error()
+		return plan
+	}
+	plan.From = audiobook.AssetPath
+
+	libraryPath, err := s.repo.GetLibraryPathByID(ctx, audiobook.LibraryPathID)
+	if err != nil {
+		plan.Status = OrganizeFailed
+		plan.Error = fmt.Sprintf("failed to load library path: %v", err)
+		return plan
+	}
+
+	resolved := audiobook.ResolveMetadata()
+	plan.Title = resolved.Title
+	metadata := metadataFromResolved(resolved)
+	if strings.TrimSpace(metadata.Title) == "" {
+		plan.Status = OrganizeSkipped
+		plan.Error = "audiobook has no title"
+		return plan
+	}
+
+	dest, err := s.buildDestination(metadata, template, libraryPath.Path)
+	if err != nil {
+		plan.Status = OrganizeFailed
+		plan.Error = err.Error()
+		return plan
+	}
+	plan.To = dest
+
+	info, err := os.Stat(audiobook.AssetPath)
+	if err != nil {
+		plan.Status = OrganizeFailed
+		plan.Error = fmt.Sprintf("asset not accessible: %v", err)
+		return plan
+	}
+
+	// Single-file audiobooks are moved into their own folder and the file is
+	// named after the title.
+	if !info.IsDir() && len(audiobook.MediaFiles) == 1 {
+		mf := audiobook.MediaFiles[0]
+		newName := sanitizePath(metadata.Title) + strings.ToLower(filepath.Ext(audiobook.AssetPath))
+		plan.Files = []FileRename{{From: mf.Filename, To: newName}}
+	}
+
+	if filepath.Clean(plan.From) == filepath.Clean(plan.To) {
+		plan.Status = OrganizeUnchanged
+		return plan
+	}
+	if _, err := os.Stat(plan.To); err == nil {
+		plan.Status = OrganizeSkipped
+		plan.Error = "destination already exists"
+		return plan
+	}
+
+	plan.Status = OrganizePlanned
+	return plan
+}
+
+// applyOrganize moves the audiobook on disk and records the new location.
+func (s *Service) applyOrganize(ctx context.Context, plan *OrganizePlan) {
+	fail := func(err error) {
+		plan.Status = OrganizeFailed
+		plan.Error = err.Error()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(plan.To), 0755); err != nil {
+		fail(fmt.Errorf("failed to create destination directory: %w", err))
+		return
+	}
+
+	audiobook, err := s.repo.GetAudiobook(ctx, plan.AudiobookID, "")
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// Moves to undo, in reverse order, if a later step fails.
+	type move struct{ from, to string }
+	var done []move
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			os.Rename(done[i].to, done[i].from)
+		}
+		os.Remove(plan.To)
+	}
+
+	filenames := make(map[string]string)
+	if len(plan.Files) > 0 {
+		if err := os.Mkdir(plan.To, 0755); err != nil {
+			fail(fmt.Errorf("failed to create audiobook directory: %w", err))
+			return
+		}
+		target := filepath.Join(plan.To, plan.Files[0].To)
+		if err := os.Rename(plan.From, target); err != nil {
+			os.Remove(plan.To)
+			fail(fmt.Errorf("failed to move file: %w", err))
+			return
+		}
+		done = append(done, move{from: plan.From, to: target})
+		filenames[audiobook.MediaFiles[0].ID] = plan.Files[0].To
+	} else {
+		if err := os.Rename(plan.From, plan.To); err != nil {
+			fail(fmt.Errorf("failed to move directory: %w", err))
+			return
+		}
+		done = append(done, move{from: plan.From, to: plan.To})
+	}
+
+	if err := s.repo.RelocateAudiobook(ctx, plan.AudiobookID, plan.To, filenames); err != nil {
+		rollback()
+		fail(fmt.Errorf("failed to update database: %w", err))
+		return
+	}
+
+	pathutil.RemoveEmptyParents(filepath.Dir(plan.From), s.libraryRootFor(ctx, audiobook))
+	plan.Status = OrganizeMoved
+}
+
+// libraryRootFor returns the library path an audiobook lives under.
+func (s *Service) libraryRootFor(ctx context.Context, audiobook *models.Audiobook) string {
+	libraryPath, err := s.repo.GetLibraryPathByID(ctx, audiobook.LibraryPathID)
+	if err != nil {
+		return ""
+	}
+	return libraryPath.Path
+}
+
+// metadataFromResolved maps resolved metadata to template values.
+func metadataFromResolved(resolved *models.AgentMetadata) Metadata {
+	metadata := Metadata{
+		Title:  resolved.Title,
+		Author: resolved.Author,
+	}
+	if resolved.SeriesName != nil {
+		metadata.Series = *resolved.SeriesName
+	}
+	if resolved.SeriesSequence != nil {
+		metadata.SeriesNumber = *resolved.SeriesSequence
+	}
+	if resolved.Narrator != nil {
+		metadata.Narrator = *resolved.Narrator
+	}
+	if resolved.ReleaseDate != nil && len(*resolved.ReleaseDate) >= 4 {
+		metadata.Year = (*resolved.ReleaseDate)[:4]
+	}
+	metadata.OriginalName = metadata.Title
+	return metadata
+}
@@ -2,6 +2,7 @@ package importservice
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,14 +12,25 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/media"
 	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/notify"
+	"github.com/lore/backend/internal/pathutil"
+	"github.com/lore/backend/internal/perf"
 	"github.com/lore/backend/internal/repository"
+	"github.com/lore/backend/internal/webhooks"
 )
 
 // Service handles import operations from staging folders.
 type Service struct {
 	repo       *repository.Repository
 	browseRoot string
+	mime       media.Detector
+	notifier   *notify.Notifier
+	webhooks   *webhooks.Service
+	events     *events.Bus
+	prober     media.Prober
 }
 
 // FileEntry represents a file or directory in an import folder.
@@ -53,7 +65,7 @@ type Metadata struct {
 }
 
 // NewService creates a new import service.
-func NewService(repo *repository.Repository, browseRoot string) *Service {
+func NewService(repo *repository.Repository, browseRoot string, detector media.Detector) *Service {
 	absRoot := browseRoot
 	if abs, err := filepath.Abs(browseRoot); err == nil {
 		absRoot = abs
@@ -62,6 +74,30 @@ func NewService(repo *repository.Repository, browseRoot string) *Service {
 	return &Service{
 		repo:       repo,
 		browseRoot: absRoot,
+		mime:       detector,
+		prober:     media.NewProber(),
+	}
+}
+
+// SetNotifier sends import results to admins through n.
+func (s *Service) SetNotifier(n *notify.Notifier) {
+	s.notifier = n
+}
+
+// SetWebhooks publishes imported audiobooks and failed imports to w.
+func (s *Service) SetWebhooks(w *webhooks.Service) {
+	s.webhooks = w
+}
+
+// SetEvents publishes imported and reorganized audiobooks to bus.
+func (s *Service) SetEvents(bus *events.Bus) {
+	s.events = bus
+}
+
+// SetProber reads media durations with p instead of the default prober.
+func (s *Service) SetProber(p media.Prober) {
+	if p != nil {
+		s.prober = p
 	}
 }
 
@@ -92,7 +128,7 @@ func (s *Service) BrowseFolder(ctx context.Context, folderID, subPath string) ([
 	fullPath := filepath.Join(folderPath, subPath)
 
 	// Ensure the path is still within the import folder (security check)
-	if !strings.HasPrefix(fullPath, folderPath) {
+	if !pathutil.Contains(folderPath, fullPath) {
 		return nil, fmt.Errorf("invalid path: outside of import folder")
 	}
 
@@ -149,27 +185,40 @@ func (s *Service) ImportSelection(ctx context.Context, folderID string, selectio
 
 	folderPath, err := s.getFolderPath(ctx, folderID)
 	if err != nil {
+		now := time.Now()
+		job.CompletedAt = &now
 		job.Status = "failed"
 		job.Errors = []string{err.Error()}
+		s.recordJob(ctx, job)
+		s.notifyImport(job)
 		return job, err
 	}
 
+	profile := perf.Profile{Kind: perf.KindImport, ID: job.ID, StartedAt: job.StartedAt.UTC()}
 	for _, selection := range selections {
 		sourcePath := filepath.Join(folderPath, selection)
 
 		// Security check
-		if !strings.HasPrefix(sourcePath, folderPath) {
+		if !pathutil.Contains(folderPath, sourcePath) {
 			job.Errors = append(job.Errors, fmt.Sprintf("invalid path: %s", selection))
 			continue
 		}
 
-		audiobook, err := s.processImport(ctx, sourcePath, template, settings.DestinationPath)
+		profile.Books++
+		audiobook, err := s.processImport(ctx, job.ID, sourcePath, template, settings.DestinationPath, &profile)
 		if err != nil {
 			job.Errors = append(job.Errors, fmt.Sprintf("failed to import %s: %v", selection, err))
 			continue
 		}
 
 		job.ImportedBooks = append(job.ImportedBooks, *audiobook)
+		profile.BooksWritten++
+		s.webhooks.Publish(webhooks.EventBookAdded, audiobook)
+		event := events.Event{Type: events.CatalogChanged}
+		if audiobook.LibraryID != nil {
+			event.LibraryID = *audiobook.LibraryID
+		}
+		s.events.Publish(event)
 	}
 
 	// Update job status
@@ -183,11 +232,98 @@ func (s *Service) ImportSelection(ctx context.Context, folderID string, selectio
 		job.Status = "failed"
 	}
 
+	profile.TotalMs = now.Sub(job.StartedAt).Milliseconds()
+	perf.Record(profile)
+
+	s.recordJob(ctx, job)
+	s.notifyImport(job)
 	return job, nil
 }
 
-// processImport handles the import of a single file or directory.
-func (s *Service) processImport(ctx context.Context, sourcePath, template, destinationPath string) (*models.Audiobook, error) {
+// recordJob saves a finished job to the import history. A job that cannot
+// be recorded is logged; the import itself has already finished.
+func (s *Service) recordJob(ctx context.Context, job *ImportJob) {
+	record := &models.ImportJobRecord{
+		ID:          job.ID,
+		Status:      job.Status,
+		SourcePaths: job.SourcePaths,
+		Errors:      job.Errors,
+		StartedAt:   job.StartedAt,
+		CompletedAt: job.CompletedAt,
+	}
+	for _, book := range job.ImportedBooks {
+		record.Imported = append(record.Imported, models.ImportedBook{AudiobookID: book.ID, AssetPath: book.AssetPath})
+	}
+	if err := s.repo.SaveImportJob(context.WithoutCancel(ctx), record); err != nil {
+		fmt.Printf("Failed to record import job %s: %v\n", job.ID, err)
+	}
+}
+
+// ListImportJobs returns a page of the import history, newest first, and the
+// total number of recorded jobs.
+func (s *Service) ListImportJobs(ctx context.Context, offset, limit int) ([]models.ImportJobRecord, int, error) {
+	return s.repo.ListImportJobs(ctx, offset, limit)
+}
+
+// GetImportJob returns a recorded import job, or sql.ErrNoRows if there is
+// none.
+func (s *Service) GetImportJob(ctx context.Context, id string) (*models.ImportJobRecord, error) {
+	return s.repo.GetImportJob(ctx, id)
+}
+
+// notifyImport tells admins how an import job ended and publishes failures
+// to webhooks. Partial imports count as completed and list their errors.
+func (s *Service) notifyImport(job *ImportJob) {
+	eventType := notify.EventImportCompleted
+	subject := fmt.Sprintf("Import completed: %d audiobook(s) added", len(job.ImportedBooks))
+	if job.Status == "failed" {
+		eventType = notify.EventImportFailed
+		subject = "Import failed"
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Import %s finished with status %q.\n", job.ID, job.Status)
+	if len(job.ImportedBooks) > 0 {
+		body.WriteString("\nImported:\n")
+		for _, book := range job.ImportedBooks {
+			fmt.Fprintf(&body, "  - %s\n", book.AssetPath)
+		}
+	}
+	if len(job.Errors) > 0 {
+		body.WriteString("\nErrors:\n")
+		for _, msg := range job.Errors {
+			fmt.Fprintf(&body, "  - %s\n", msg)
+		}
+	}
+
+	if job.Status == "failed" {
+		s.webhooks.Publish(webhooks.EventImportFailed, job)
+	}
+
+	s.notifier.Notify(notify.Event{
+		Type:    eventType,
+		Subject: subject,
+		Body:    body.String(),
+		Data: map[string]interface{}{
+			"job_id":   job.ID,
+			"status":   job.Status,
+			"imported": len(job.ImportedBooks),
+			"errors":   job.Errors,
+		},
+	})
+}
+
+// stagingDirName is the directory under the import destination that files
+// are copied into before they are moved into the library. Library scans
+// skip it like any other hidden directory.
+const stagingDirName = ".lore-staging"
+
+// processImport imports a single file or directory. The files are copied
+// into a staging directory and checked against the source before they are
+// moved into place and recorded, so a failed import leaves neither files nor
+// an audiobook behind. The time spent copying, probing and writing to the
+// database is added to profile.
+func (s *Service) processImport(ctx context.Context, jobID, sourcePath, template, destinationPath string, profile *perf.Profile) (*models.Audiobook, error) {
 	// Extract metadata
 	metadata := s.extractMetadata(sourcePath)
 
@@ -196,26 +332,135 @@ func (s *Service) processImport(ctx context.Context, sourcePath, template, desti
 	if err != nil {
 		return nil, fmt.Errorf("failed to build destination: %w", err)
 	}
+	if _, err := os.Lstat(destPath); err == nil {
+		return nil, fmt.Errorf("destination already exists: %s", destPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to check destination: %w", err)
+	}
 
-	// Create destination directory
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	// Resolve the library before copying anything
+	libraryPathID, libraryID, err := s.libraryForAsset(ctx, destPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy into a staging directory next to the destination, so the final
+	// move is a rename within one filesystem
+	stagingRoot := filepath.Join(destinationPath, stagingDirName)
+	if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.Remove(stagingRoot) // only once no other import is using it
+	stagingDir, err := os.MkdirTemp(stagingRoot, jobID+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
 	}
+	defer os.RemoveAll(stagingDir)
 
-	// Copy files
-	if err := s.copyRecursive(sourcePath, destPath); err != nil {
+	staged := filepath.Join(stagingDir, filepath.Base(destPath))
+	copyStart := time.Now()
+	if err := s.copyRecursive(sourcePath, staged); err != nil {
 		return nil, fmt.Errorf("failed to copy files: %w", err)
 	}
+	if err := verifyCopy(sourcePath, staged); err != nil {
+		return nil, fmt.Errorf("copy verification failed: %w", err)
+	}
+	probeStart := time.Now()
+	profile.CopyMs += probeStart.Sub(copyStart).Milliseconds()
+
+	mediaFiles, err := s.discoverMediaFiles(ctx, staged)
+	profile.ProbeMs += time.Since(probeStart).Milliseconds()
+	profile.FilesProbed += len(mediaFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media files: %w", err)
+	}
+	if len(mediaFiles) == 0 {
+		return nil, fmt.Errorf("no audio files found in %s", sourcePath)
+	}
+
+	// Move into place
+	created, err := makeParents(filepath.Dir(destPath))
+	if err != nil {
+		removeDirs(created)
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	if err := os.Rename(staged, destPath); err != nil {
+		removeDirs(created)
+		return nil, fmt.Errorf("failed to move files into place: %w", err)
+	}
 
 	// Create audiobook entry
-	audiobook, err := s.createAudiobookEntry(ctx, destPath)
+	writeStart := time.Now()
+	audiobook, err := s.createAudiobookEntry(ctx, destPath, libraryPathID, libraryID, mediaFiles)
+	profile.WriteMs += time.Since(writeStart).Milliseconds()
 	if err != nil {
+		if removeErr := os.RemoveAll(destPath); removeErr != nil {
+			fmt.Printf("Failed to remove %s after a failed import: %v\n", destPath, removeErr)
+		}
+		removeDirs(created)
 		return nil, fmt.Errorf("failed to create audiobook entry: %w", err)
 	}
 
 	return audiobook, nil
 }
 
+// verifyCopy checks that dst holds every file of src with the same size.
+func verifyCopy(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		// Stat follows symlinks, as copyFile does
+		original, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		copied, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			return fmt.Errorf("%s missing from copy", rel)
+		}
+		if copied.Size() != original.Size() {
+			return fmt.Errorf("%s: copied %d of %d bytes", rel, copied.Size(), original.Size())
+		}
+		return nil
+	})
+}
+
+// makeParents creates dir and any missing parents. It returns the
+// directories it created, deepest first, so they can be removed again.
+func makeParents(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return missing, err
+	}
+	return missing, nil
+}
+
+// removeDirs removes directories created for a failed import, deepest
+// first. Directories another import has since written to are not empty
+// and are kept.
+func removeDirs(dirs []string) {
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+}
+
 // extractMetadata attempts to extract metadata from file/folder names.
 func (s *Service) extractMetadata(path string) Metadata {
 	base := filepath.Base(path)
@@ -346,41 +591,31 @@ func (s *Service) copyFile(src, dst string) error {
 	return os.Chmod(dst, srcInfo.Mode())
 }
 
-// createAudiobookEntry creates a database entry for the imported audiobook.
-func (s *Service) createAudiobookEntry(ctx context.Context, assetPath string) (*models.Audiobook, error) {
-	// Discover media files
-	mediaFiles, err := s.discoverMediaFiles(assetPath)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(mediaFiles) == 0 {
-		return nil, fmt.Errorf("no audio files found in %s", assetPath)
-	}
-
-	// Find which library path contains this asset
+// libraryForAsset returns the library path containing assetPath and the
+// library it is assigned to.
+func (s *Service) libraryForAsset(ctx context.Context, assetPath string) (string, string, error) {
 	libraryPathID, err := s.findLibraryPathForAsset(ctx, assetPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find library path for asset: %w", err)
+		return "", "", fmt.Errorf("failed to find library path for asset: %w", err)
 	}
 
 	pathConfig, err := s.repo.GetLibraryPathByID(ctx, libraryPathID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load library path configuration: %w", err)
+		return "", "", fmt.Errorf("failed to load library path configuration: %w", err)
 	}
-	var libraryIDPtr *string
-	if len(pathConfig.Libraries) > 0 {
-		libID := pathConfig.Libraries[0].ID
-		libraryIDPtr = &libID
-	}
-	if libraryIDPtr == nil {
-		return nil, fmt.Errorf("library path %s is not assigned to a library", pathConfig.Name)
+	if len(pathConfig.Libraries) == 0 {
+		return "", "", fmt.Errorf("library path %s is not assigned to a library", pathConfig.Name)
 	}
+	return libraryPathID, pathConfig.Libraries[0].ID, nil
+}
 
+// createAudiobookEntry creates a database entry for the imported audiobook.
+// The entry is removed again if it cannot be read back.
+func (s *Service) createAudiobookEntry(ctx context.Context, assetPath, libraryPathID, libraryID string, mediaFiles []models.MediaFile) (*models.Audiobook, error) {
 	// Create audiobook
 	audiobook := &models.Audiobook{
 		ID:            uuid.NewString(),
-		LibraryID:     libraryIDPtr,
+		LibraryID:     &libraryID,
 		LibraryPathID: libraryPathID,
 		AssetPath:     assetPath,
 	}
@@ -394,13 +629,23 @@ func (s *Service) createAudiobookEntry(ctx context.Context, assetPath string) (*
 	if err := s.repo.CreateAudiobook(ctx, audiobook, mediaFiles, ""); err != nil {
 		return nil, err
 	}
+	if err := s.repo.RefreshResolvedMetadata(ctx, audiobook.ID); err != nil {
+		fmt.Printf("Warning: Failed to refresh resolved metadata for %s: %v\n", audiobook.ID, err)
+	}
 
 	// Fetch the created audiobook with stats
-	return s.repo.GetAudiobook(ctx, audiobook.ID, "")
+	created, err := s.repo.GetAudiobook(ctx, audiobook.ID, "")
+	if err != nil {
+		if deleteErr := s.repo.DeleteAudiobook(context.WithoutCancel(ctx), audiobook.ID); deleteErr != nil {
+			fmt.Printf("Failed to remove audiobook %s after a failed import: %v\n", audiobook.ID, deleteErr)
+		}
+		return nil, err
+	}
+	return created, nil
 }
 
 // discoverMediaFiles finds audio files in the given directory.
-func (s *Service) discoverMediaFiles(assetPath string) ([]models.MediaFile, error) {
+func (s *Service) discoverMediaFiles(ctx context.Context, assetPath string) ([]models.MediaFile, error) {
 	var mediaFiles []models.MediaFile
 
 	err := filepath.WalkDir(assetPath, func(path string, d os.DirEntry, err error) error {
@@ -412,7 +657,7 @@ func (s *Service) discoverMediaFiles(assetPath string) ([]models.MediaFile, erro
 			return nil
 		}
 
-		if !isAudioFile(path) {
+		if !media.IsAudioFile(path) {
 			return nil
 		}
 
@@ -422,10 +667,16 @@ func (s *Service) discoverMediaFiles(assetPath string) ([]models.MediaFile, erro
 		}
 
 		mediaFile := models.MediaFile{
-			ID:          uuid.NewString(),
-			Filename:    rel,
-			DurationSec: 0, // TODO: Extract duration using ffprobe
-			MimeType:    getMimeType(path),
+			ID:       uuid.NewString(),
+			Filename: rel,
+		}
+		if probe, err := s.prober.Probe(ctx, path); err == nil {
+			mediaFile.DurationSec = probe.DurationSec
+		}
+		detection := s.mime.Detect(path)
+		mediaFile.MimeType = detection.MimeType
+		if detection.Mismatch() {
+			mediaFile.ExtensionMimeType = &detection.ExtensionMimeType
 		}
 
 		mediaFiles = append(mediaFiles, mediaFile)
@@ -459,12 +710,20 @@ func (s *Service) findLibraryPathForAsset(ctx context.Context, assetPath string)
 		return "", err
 	}
 
-	// Find the library path that contains this asset
+	// Find the library path that contains this asset, preferring the
+	// deepest when paths are nested
+	matchID, matchDepth := "", -1
 	for _, lp := range libraryPaths {
-		if strings.HasPrefix(assetPath, lp.Path) {
-			return lp.ID, nil
+		if !pathutil.Contains(lp.Path, assetPath) {
+			continue
+		}
+		if depth := len(pathutil.Resolve(lp.Path)); depth > matchDepth {
+			matchID, matchDepth = lp.ID, depth
 		}
 	}
+	if matchID != "" {
+		return matchID, nil
+	}
 
 	return "", fmt.Errorf("no library path found that contains asset path: %s", assetPath)
 }
@@ -589,45 +848,11 @@ func (s *Service) isAudiobookCandidate(entry os.DirEntry) bool {
 		return true // Directories might contain audiobooks
 	}
 
-	return isAudioFile(entry.Name())
+	return media.IsAudioFile(entry.Name())
 }
 
 // Helper functions
 
-// isAudioFile checks if a file is an audio file based on extension.
-func isAudioFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	audioExts := []string{".mp3", ".m4a", ".m4b", ".flac", ".wav", ".ogg", ".aac"}
-
-	for _, audioExt := range audioExts {
-		if ext == audioExt {
-			return true
-		}
-	}
-	return false
-}
-
-// getMimeType returns the MIME type for an audio file.
-func getMimeType(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".mp3":
-		return "audio/mpeg"
-	case ".m4a", ".m4b":
-		return "audio/mp4"
-	case ".flac":
-		return "audio/flac"
-	case ".wav":
-		return "audio/wav"
-	case ".ogg":
-		return "audio/ogg"
-	case ".aac":
-		return "audio/aac"
-	default:
-		return "audio/mpeg"
-	}
-}
-
 // sanitizePath sanitizes a string for use in file paths.
 func sanitizePath(s string) string {
 	// Remove or replace problematic characters
@@ -0,0 +1,592 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lore/backend/internal/abs"
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/providers"
+	"github.com/lore/backend/internal/repository"
+)
+
+// JobTypeMigrateAudiobookshelf is the background job type of Audiobookshelf
+// migrations.
+const JobTypeMigrateAudiobookshelf = "migrate_audiobookshelf"
+
+// How migrated items were matched to audiobooks, in the order tried.
+const (
+	MatchedByPath        = "path"
+	MatchedByASIN        = "asin"
+	MatchedByISBN        = "isbn"
+	MatchedByTitleAuthor = "title_author"
+)
+
+// AudiobookshelfOptions controls a migration from Audiobookshelf.
+type AudiobookshelfOptions struct {
+	// DryRun reports what would be migrated without changing anything.
+	DryRun bool `json:"dry_run"`
+	// PathMap rewrites path prefixes as Audiobookshelf saw them to where
+	// the same files are mounted here, e.g. {"/audiobooks": "/srv/books"}.
+	PathMap map[string]string `json:"path_map,omitempty"`
+}
+
+// AudiobookshelfReport summarizes a migration from Audiobookshelf.
+type AudiobookshelfReport struct {
+	DryRun    bool                    `json:"dry_run"`
+	Libraries []AudiobookshelfLibrary `json:"libraries"`
+	Items     int                     `json:"items"`
+	Matched   int                     `json:"matched"`
+	MatchedBy map[string]int          `json:"matched_by"`
+	// PendingScan counts items in folders a dry run would add, which can
+	// only be matched once the folders are scanned.
+	PendingScan     int                  `json:"pending_scan,omitempty"`
+	Unmatched       []AudiobookshelfItem `json:"unmatched"`
+	MetadataUpdated int                  `json:"metadata_updated"`
+	Users           []AudiobookshelfUser `json:"users"`
+	UnmatchedUsers  []string             `json:"unmatched_users,omitempty"`
+	Warnings        []string             `json:"warnings,omitempty"`
+}
+
+// AudiobookshelfLibrary reports how an Audiobookshelf library was mapped.
+type AudiobookshelfLibrary struct {
+	SourceID  string `json:"source_id"`
+	Name      string `json:"name"`
+	LibraryID string `json:"library_id,omitempty"`
+	Created   bool   `json:"created"`
+	// FoldersAdded lists the mapped folders added to the library.
+	FoldersAdded []string `json:"folders_added,omitempty"`
+	Skipped      string   `json:"skipped,omitempty"`
+}
+
+// AudiobookshelfItem is an Audiobookshelf item no audiobook matched.
+type AudiobookshelfItem struct {
+	SourceID string `json:"source_id"`
+	Library  string `json:"library"`
+	Title    string `json:"title"`
+	Author   string `json:"author,omitempty"`
+	Path     string `json:"path"`
+}
+
+// AudiobookshelfUser reports the listening data migrated for a user. In a
+// dry run the imported counts are what would be offered for import;
+// progress the user already has is still kept then.
+type AudiobookshelfUser struct {
+	Username          string `json:"username"`
+	UserID            string `json:"user_id"`
+	ProgressImported  int    `json:"progress_imported"`
+	ProgressSkipped   int    `json:"progress_skipped"`
+	BookmarksImported int    `json:"bookmarks_imported"`
+	BookmarksSkipped  int    `json:"bookmarks_skipped"`
+}
+
+// MigrateAudiobookshelf imports an Audiobookshelf server: its libraries and
+// folders, the metadata of its items, and the progress and bookmarks of its
+// users, matched to Lore users by username. Libraries are matched by name
+// and created when missing; folders are added to them and scanned. Items
+// are matched to audiobooks by folder, then ASIN, ISBN and title and
+// author. Their metadata is saved as locked custom values, except for
+// fields an admin already locked. Progress is only seeded for books a user
+// has not started, so running the migration again is safe.
+func (s *Service) MigrateAudiobookshelf(ctx context.Context, export *abs.Export, opts AudiobookshelfOptions, progress func(done, total int)) (*AudiobookshelfReport, error) {
+	report := &AudiobookshelfReport{
+		DryRun:    opts.DryRun,
+		MatchedBy: map[string]int{},
+		Unmatched: []AudiobookshelfItem{},
+		Users:     []AudiobookshelfUser{},
+	}
+	paths := newPathMapper(opts.PathMap)
+
+	libraryNames, pendingFolders, err := s.migrateABSLibraries(ctx, export, paths, report)
+	if err != nil {
+		return report, err
+	}
+
+	identities, err := s.repo.ListAudiobookIdentities(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list audiobooks: %w", err)
+	}
+	matcher := newABSMatcher(identities)
+
+	total := len(export.Items) + len(export.Users)
+	done := 0
+	matched := make(map[string]string)
+	changedLibraries := make(map[string]bool)
+	for _, item := range export.Items {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		done++
+		if progress != nil {
+			progress(done, total)
+		}
+		libraryName, ok := libraryNames[item.LibraryID]
+		if !ok {
+			continue
+		}
+		report.Items++
+
+		mapped := paths.mapPath(item.Path)
+		identity, by := matcher.match(mapped, item.Media.Metadata)
+		if identity == nil {
+			if opts.DryRun && pendingFolders.holds(mapped) {
+				report.PendingScan++
+				continue
+			}
+			report.Unmatched = append(report.Unmatched, AudiobookshelfItem{
+				SourceID: item.ID,
+				Library:  libraryName,
+				Title:    item.Media.Metadata.Title,
+				Author:   item.Media.Metadata.AuthorNames(),
+				Path:     mapped,
+			})
+			continue
+		}
+		report.Matched++
+		report.MatchedBy[by]++
+		matched[item.ID] = identity.ID
+
+		updated, err := s.applyABSMetadata(ctx, identity.ID, item.Media.Metadata, opts.DryRun)
+		if err != nil {
+			return report, err
+		}
+		if updated {
+			report.MetadataUpdated++
+			changedLibraries[identity.LibraryID] = true
+		}
+	}
+	for libraryID := range changedLibraries {
+		s.catalogChanged(libraryID)
+	}
+
+	usernames, err := s.repo.UserIDsByUsername(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list users: %w", err)
+	}
+	durations := make(map[string]float64, len(export.Items))
+	for _, item := range export.Items {
+		durations[item.ID] = item.Media.Duration
+	}
+	for _, user := range export.Users {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		done++
+		if progress != nil {
+			progress(done, total)
+		}
+		userID, ok := usernames[strings.ToLower(user.Username)]
+		if !ok {
+			report.UnmatchedUsers = append(report.UnmatchedUsers, user.Username)
+			continue
+		}
+		result, err := s.migrateABSUser(ctx, userID, user, matched, durations, opts.DryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Users = append(report.Users, *result)
+	}
+	return report, nil
+}
+
+// migrateABSLibraries matches or creates a library for each Audiobookshelf
+// book library and adds its mapped folders, scanning the libraries that
+// gained folders. It returns the names of the migrated libraries by source
+// ID and, for a dry run, the folders it would have added.
+func (s *Service) migrateABSLibraries(ctx context.Context, export *abs.Export, paths pathMapper, report *AudiobookshelfReport) (map[string]string, folderSet, error) {
+	libraries, err := s.repo.ListLibraries(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	libraryPaths, err := s.repo.GetLibraryPaths(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list library paths: %w", err)
+	}
+
+	names := make(map[string]string)
+	var pending folderSet
+	var toScan []string
+	for _, source := range export.Libraries {
+		entry := AudiobookshelfLibrary{SourceID: source.ID, Name: source.Name}
+		if source.MediaType == "podcast" {
+			entry.Skipped = "podcast libraries are not migrated"
+			report.Libraries = append(report.Libraries, entry)
+			continue
+		}
+		names[source.ID] = source.Name
+
+		library := findLibraryByName(libraries, source.Name)
+		switch {
+		case library != nil:
+			entry.LibraryID = library.ID
+		case report.DryRun:
+			entry.Created = true
+		default:
+			library, err = s.CreateLibrary(ctx, &models.Library{DisplayName: source.Name})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create library %s: %w", source.Name, err)
+			}
+			libraries = append(libraries, *library)
+			entry.LibraryID = library.ID
+			entry.Created = true
+		}
+
+		var directoryIDs []string
+		assigned := make(map[string]bool)
+		if library != nil {
+			for _, directory := range library.Directories {
+				directoryIDs = append(directoryIDs, directory.ID)
+				assigned[directory.ID] = true
+			}
+		}
+		added := false
+		for _, folder := range source.Folders {
+			path := absolutePath(paths.mapPath(folder.FullPath))
+			existing := findLibraryPath(libraryPaths, path)
+			if existing != nil && assigned[existing.ID] {
+				continue
+			}
+			if existing == nil {
+				if report.DryRun {
+					validation, err := s.ValidateLibraryPath(ctx, path, "")
+					if err != nil {
+						return nil, nil, err
+					}
+					if !validation.Valid {
+						report.Warnings = append(report.Warnings, (&PathValidationError{Validation: *validation}).Error())
+						continue
+					}
+					pending = append(pending, path)
+					entry.FoldersAdded = append(entry.FoldersAdded, path)
+					continue
+				}
+				created, err := s.CreateLibraryPath(ctx, path, filepath.Base(path))
+				var invalid *PathValidationError
+				if errors.As(err, &invalid) {
+					report.Warnings = append(report.Warnings, invalid.Error())
+					continue
+				}
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to add library path %s: %w", path, err)
+				}
+				libraryPaths = append(libraryPaths, *created)
+				existing = created
+			} else if report.DryRun {
+				pending = append(pending, path)
+				entry.FoldersAdded = append(entry.FoldersAdded, path)
+				continue
+			}
+			directoryIDs = append(directoryIDs, existing.ID)
+			assigned[existing.ID] = true
+			entry.FoldersAdded = append(entry.FoldersAdded, path)
+			added = true
+		}
+		if added {
+			updated, err := s.SetLibraryDirectories(ctx, library.ID, directoryIDs)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to assign folders to library %s: %w", source.Name, err)
+			}
+			for i := range libraries {
+				if libraries[i].ID == updated.ID {
+					libraries[i] = *updated
+				}
+			}
+			toScan = append(toScan, library.ID)
+		}
+		report.Libraries = append(report.Libraries, entry)
+	}
+
+	for _, libraryID := range toScan {
+		if _, err := s.ScanLibrary(ctx, libraryID); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan library: %w", err)
+		}
+	}
+	return names, pending, nil
+}
+
+// applyABSMetadata saves an item's Audiobookshelf metadata as custom values
+// for the fields an admin has not locked, reporting whether any changed.
+func (s *Service) applyABSMetadata(ctx context.Context, audiobookID string, metadata abs.Metadata, dryRun bool) (bool, error) {
+	custom, err := s.repo.GetMetadataOverrides(ctx, audiobookID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load metadata overrides: %w", err)
+	}
+	if custom == nil {
+		custom = &models.CustomMetadata{AudiobookID: audiobookID}
+	}
+
+	changed := false
+	for field, value := range absMetadataFields(metadata) {
+		if value == "" || custom.LockMode(field) != models.LockModeUnlocked {
+			continue
+		}
+		value := value
+		custom.SetFieldValue(field, &value)
+		custom.SetLockMode(field, models.LockModeValue)
+		changed = true
+	}
+	if !changed || dryRun {
+		return changed, nil
+	}
+
+	if err := s.repo.SaveMetadataOverrides(ctx, custom); err != nil {
+		return false, fmt.Errorf("failed to save metadata of %s: %w", audiobookID, err)
+	}
+	if err := s.repo.RefreshResolvedMetadata(ctx, audiobookID); err != nil {
+		return false, fmt.Errorf("failed to resolve metadata of %s: %w", audiobookID, err)
+	}
+	return true, nil
+}
+
+// absMetadataFields maps Audiobookshelf metadata to custom metadata fields.
+func absMetadataFields(metadata abs.Metadata) map[string]string {
+	fields := map[string]string{
+		"title":        strings.TrimSpace(metadata.Title),
+		"subtitle":     strings.TrimSpace(metadata.Subtitle),
+		"author":       metadata.AuthorNames(),
+		"narrator":     strings.Join(metadata.Narrators, ", "),
+		"description":  strings.TrimSpace(metadata.Description),
+		"release_date": metadata.ReleaseDate(),
+		"isbn":         strings.TrimSpace(metadata.ISBN),
+		"asin":         strings.TrimSpace(metadata.ASIN),
+		"language":     strings.TrimSpace(metadata.Language),
+		"publisher":    strings.TrimSpace(metadata.Publisher),
+	}
+	if len(metadata.Series) > 0 {
+		fields["series_name"] = strings.TrimSpace(metadata.Series[0].Name)
+		fields["series_sequence"] = strings.TrimSpace(metadata.Series[0].Sequence)
+	}
+	if len(metadata.Genres) > 0 {
+		if genres, err := json.Marshal(metadata.Genres); err == nil {
+			fields["genres"] = string(genres)
+		}
+	}
+	return fields
+}
+
+// migrateABSUser seeds a user's progress and bookmarks in the matched
+// items. Finished books are placed at their end.
+func (s *Service) migrateABSUser(ctx context.Context, userID string, user abs.User, matched map[string]string, durations map[string]float64, dryRun bool) (*AudiobookshelfUser, error) {
+	result := &AudiobookshelfUser{Username: user.Username, UserID: userID}
+
+	for _, entry := range user.Progress {
+		audiobookID, ok := matched[entry.LibraryItemID]
+		if !ok {
+			result.ProgressSkipped++
+			continue
+		}
+		position := entry.CurrentTime
+		if entry.IsFinished {
+			position = max(entry.Duration, durations[entry.LibraryItemID], position)
+		}
+		if dryRun {
+			result.ProgressImported++
+			continue
+		}
+		seeded, err := s.repo.SeedUserProgress(ctx, userID, audiobookID, position, false, abs.Time(entry.LastUpdate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed progress of %s: %w", user.Username, err)
+		}
+		if seeded {
+			result.ProgressImported++
+		} else {
+			result.ProgressSkipped++
+		}
+	}
+
+	for _, bookmark := range user.Bookmarks {
+		audiobookID, ok := matched[bookmark.LibraryItemID]
+		title := strings.TrimSpace(bookmark.Title)
+		if !ok || bookmark.Time < 0 {
+			result.BookmarksSkipped++
+			continue
+		}
+		if title == "" {
+			title = "Bookmark"
+		}
+		if dryRun {
+			result.BookmarksImported++
+			continue
+		}
+		imported := &models.Bookmark{AudiobookID: audiobookID, PositionSec: bookmark.Time, Title: title}
+		if createdAt := abs.Time(bookmark.CreatedAt); createdAt != nil {
+			imported.CreatedAt = *createdAt
+		}
+		added, err := s.repo.ImportBookmark(ctx, userID, imported)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import bookmarks of %s: %w", user.Username, err)
+		}
+		if added {
+			result.BookmarksImported++
+		} else {
+			result.BookmarksSkipped++
+		}
+	}
+
+	if !dryRun && (result.ProgressImported > 0 || result.BookmarksImported > 0) {
+		s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	}
+	return result, nil
+}
+
+func findLibraryByName(libraries []models.Library, name string) *models.Library {
+	name = strings.TrimSpace(name)
+	for i := range libraries {
+		if strings.EqualFold(libraries[i].Name, name) || strings.EqualFold(libraries[i].DisplayName, name) {
+			return &libraries[i]
+		}
+	}
+	return nil
+}
+
+func findLibraryPath(paths []models.LibraryPath, path string) *models.LibraryPath {
+	for i := range paths {
+		if filepath.Clean(paths[i].Path) == path {
+			return &paths[i]
+		}
+	}
+	return nil
+}
+
+// pathMapper rewrites path prefixes, trying the longest prefix first.
+type pathMapper struct {
+	prefixes []string
+	targets  map[string]string
+}
+
+func newPathMapper(pathMap map[string]string) pathMapper {
+	mapper := pathMapper{targets: make(map[string]string, len(pathMap))}
+	for from, to := range pathMap {
+		from = strings.TrimRight(filepath.ToSlash(from), "/")
+		if from == "" {
+			from = "/"
+		}
+		mapper.prefixes = append(mapper.prefixes, from)
+		mapper.targets[from] = to
+	}
+	sort.Slice(mapper.prefixes, func(i, j int) bool { return len(mapper.prefixes[i]) > len(mapper.prefixes[j]) })
+	return mapper
+}
+
+// mapPath returns path with its longest mapped prefix rewritten, cleaned.
+func (m pathMapper) mapPath(path string) string {
+	slashed := filepath.ToSlash(path)
+	for _, prefix := range m.prefixes {
+		switch {
+		case slashed == prefix:
+			return filepath.Clean(m.targets[prefix])
+		case prefix == "/" && strings.HasPrefix(slashed, "/"):
+			return filepath.Join(m.targets[prefix], slashed)
+		case strings.HasPrefix(slashed, prefix+"/"):
+			return filepath.Join(m.targets[prefix], strings.TrimPrefix(slashed, prefix))
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// folderSet is a list of folders a dry run would add.
+type folderSet []string
+
+// holds reports whether path lies in one of the folders.
+func (f folderSet) holds(path string) bool {
+	for _, folder := range f {
+		if path == folder || strings.HasPrefix(path, folder+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// absMatcher finds the audiobook an Audiobookshelf item is.
+type absMatcher struct {
+	byPath  map[string]*repository.AudiobookIdentity
+	byASIN  map[string]*repository.AudiobookIdentity
+	byISBN  map[string]*repository.AudiobookIdentity
+	byTitle map[string]*repository.AudiobookIdentity
+}
+
+func newABSMatcher(identities []repository.AudiobookIdentity) *absMatcher {
+	m := &absMatcher{
+		byPath:  make(map[string]*repository.AudiobookIdentity, len(identities)),
+		byASIN:  make(map[string]*repository.AudiobookIdentity),
+		byISBN:  make(map[string]*repository.AudiobookIdentity),
+		byTitle: make(map[string]*repository.AudiobookIdentity),
+	}
+	// Titles shared by several audiobooks are left out rather than guessed.
+	ambiguous := make(map[string]bool)
+	for i := range identities {
+		identity := &identities[i]
+		m.byPath[filepath.Clean(identity.AssetPath)] = identity
+		if asin := providers.NormalizeASIN(identity.ASIN); asin != "" {
+			m.byASIN[asin] = identity
+		}
+		if isbn := providers.NormalizeISBN(identity.ISBN); isbn != "" {
+			for _, variant := range providers.ISBNVariants(isbn) {
+				m.byISBN[variant] = identity
+			}
+		}
+		if key := titleAuthorKey(identity.Title, identity.Author); key != "" {
+			if _, seen := m.byTitle[key]; seen {
+				ambiguous[key] = true
+			}
+			m.byTitle[key] = identity
+		}
+	}
+	for key := range ambiguous {
+		delete(m.byTitle, key)
+	}
+	return m
+}
+
+// match returns the audiobook at path or with the metadata's identifiers or
+// title and author, and how it was matched.
+func (m *absMatcher) match(path string, metadata abs.Metadata) (*repository.AudiobookIdentity, string) {
+	if identity, ok := m.byPath[path]; ok {
+		return identity, MatchedByPath
+	}
+	if asin := providers.NormalizeASIN(metadata.ASIN); asin != "" {
+		if identity, ok := m.byASIN[asin]; ok {
+			return identity, MatchedByASIN
+		}
+	}
+	if isbn := providers.NormalizeISBN(metadata.ISBN); isbn != "" {
+		for _, variant := range providers.ISBNVariants(isbn) {
+			if identity, ok := m.byISBN[variant]; ok {
+				return identity, MatchedByISBN
+			}
+		}
+	}
+	if key := titleAuthorKey(metadata.Title, metadata.AuthorNames()); key != "" {
+		if identity, ok := m.byTitle[key]; ok {
+			return identity, MatchedByTitleAuthor
+		}
+	}
+	return nil, ""
+}
+
+// titleAuthorKey folds a title and its first author to letters and digits,
+// or returns "" when either is missing.
+func titleAuthorKey(title, author string) string {
+	author, _, _ = strings.Cut(author, ",")
+	fold := func(s string) string {
+		var b strings.Builder
+		for _, r := range strings.ToLower(s) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+	title, author = fold(title), fold(author)
+	if title == "" || author == "" {
+		return ""
+	}
+	return title + "|" + author
+}
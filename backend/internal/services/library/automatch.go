@@ -0,0 +1,51 @@
+package library
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lore/backend/internal/models"
+)
+
+// Matcher links an audiobook to the best metadata providerName finds for
+// it, or every provider's when providerName is empty. It reports whether a
+// match was close enough to link.
+type Matcher func(ctx context.Context, audiobookID, providerName string) (bool, error)
+
+// AutoMatchResult summarizes the auto-matching of the new books of a scan.
+type AutoMatchResult struct {
+	// Matched counts books linked to provider metadata.
+	Matched int `json:"matched"`
+	// Unmatched counts books no result agreed with closely enough.
+	Unmatched int `json:"unmatched"`
+	// Failed lists books whose search or link failed.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// SetMatcher links new books found by scans of libraries with auto_match
+// set through m.
+func (s *Service) SetMatcher(m Matcher) {
+	s.match = m
+}
+
+// autoMatch matches each of books against the library's preferred
+// provider. A failure only skips its book.
+func (s *Service) autoMatch(ctx context.Context, library *models.Library, books []models.Audiobook) *AutoMatchResult {
+	result := &AutoMatchResult{}
+	for _, book := range books {
+		if ctx.Err() != nil {
+			break
+		}
+		matched, err := s.match(ctx, book.ID, library.Settings.PreferredProvider)
+		switch {
+		case err != nil:
+			fmt.Printf("Failed to auto-match audiobook %s in library %s: %v\n", book.ID, library.DisplayName, err)
+			result.Failed = append(result.Failed, book.ID)
+		case matched:
+			result.Matched++
+		default:
+			result.Unmatched++
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WatchAutoScans checks each interval for libraries due an auto-scan until
+// ctx ends, handing each to scan. scan is expected to return quickly, e.g.
+// by starting a background job.
+func (s *Service) WatchAutoScans(ctx context.Context, interval time.Duration, scan func(libraryID string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, err := s.DueForAutoScan(ctx, now)
+			if err != nil {
+				fmt.Printf("Failed to check libraries for auto-scans: %v\n", err)
+				continue
+			}
+			for _, id := range due {
+				scan(id)
+			}
+		}
+	}
+}
+
+// DueForAutoScan returns the libraries with an auto-scan interval whose
+// least recently scanned enabled directory was last scanned, or last
+// auto-scanned, at least that long before now. A directory never scanned
+// is always due. The libraries returned are recorded as auto-scanned at
+// now.
+func (s *Service) DueForAutoScan(ctx context.Context, now time.Time) ([]string, error) {
+	libraries, err := s.repo.ListLibraries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.autoScanMu.Lock()
+	defer s.autoScanMu.Unlock()
+	var due []string
+	for _, library := range libraries {
+		minutes := library.Settings.AutoScanIntervalMinutes
+		if minutes <= 0 {
+			continue
+		}
+		var oldest *time.Time
+		enabled := false
+		for _, dir := range library.Directories {
+			if !dir.Enabled {
+				continue
+			}
+			enabled = true
+			if dir.LastScannedAt == nil {
+				oldest = &time.Time{}
+				break
+			}
+			if oldest == nil || dir.LastScannedAt.Before(*oldest) {
+				oldest = dir.LastScannedAt
+			}
+		}
+		if !enabled {
+			continue
+		}
+		last := *oldest
+		if attempted := s.autoScanned[library.ID]; attempted.After(last) {
+			last = attempted
+		}
+		if now.Sub(last) >= time.Duration(minutes)*time.Minute {
+			s.autoScanned[library.ID] = now
+			due = append(due, library.ID)
+		}
+	}
+	return due, nil
+}
@@ -0,0 +1,163 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lore/backend/internal/pathutil"
+)
+
+// Problem codes reported by library path validation.
+const (
+	PathMissing      = "missing"
+	PathNotDirectory = "not_directory"
+	PathUnreadable   = "unreadable"
+	// PathDuplicate, PathNested and PathContains report overlaps with other
+	// library paths; PathImportOverlap an overlap with an import folder.
+	PathDuplicate     = "duplicate"
+	PathNested        = "nested"
+	PathContains      = "contains"
+	PathImportOverlap = "import_folder_overlap"
+)
+
+// PathProblem is a reason a library path cannot be used.
+type PathProblem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// ConflictID and ConflictPath name the library path or import folder
+	// the path overlaps with.
+	ConflictID   string `json:"conflict_id,omitempty"`
+	ConflictPath string `json:"conflict_path,omitempty"`
+}
+
+// PathValidation is the result of validating a library path.
+type PathValidation struct {
+	ID       string        `json:"id,omitempty"`
+	Path     string        `json:"path"`
+	Valid    bool          `json:"valid"`
+	Problems []PathProblem `json:"problems"`
+}
+
+// PathValidationError is returned when a library path is created or moved
+// to a location that fails validation.
+type PathValidationError struct {
+	Validation PathValidation
+}
+
+func (e *PathValidationError) Error() string {
+	messages := make([]string, len(e.Validation.Problems))
+	for i, problem := range e.Validation.Problems {
+		messages[i] = problem.Message
+	}
+	return fmt.Sprintf("invalid library path %s: %s", e.Validation.Path, strings.Join(messages, "; "))
+}
+
+// ValidateLibraryPath checks that path is a readable directory that
+// neither overlaps another library path nor an import folder. Nested library
+// paths make asset lookups ambiguous, and an import folder inside a library
+// would have its staged files scanned as audiobooks. excludeID names the
+// library path being validated, which is not compared to itself.
+func (s *Service) ValidateLibraryPath(ctx context.Context, path, excludeID string) (*PathValidation, error) {
+	validation := &PathValidation{ID: excludeID, Path: path, Problems: []PathProblem{}}
+	validation.Problems = append(validation.Problems, checkDirectory(path)...)
+
+	libraryPaths, err := s.repo.GetLibraryPaths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library paths: %w", err)
+	}
+	for _, other := range libraryPaths {
+		if other.ID == excludeID {
+			continue
+		}
+		problem := PathProblem{ConflictID: other.ID, ConflictPath: other.Path}
+		switch {
+		case pathutil.Within(other.Path, path):
+			problem.Code = PathNested
+			problem.Message = fmt.Sprintf("inside library path %q", other.Name)
+		case pathutil.Within(path, other.Path):
+			problem.Code = PathContains
+			problem.Message = fmt.Sprintf("contains library path %q", other.Name)
+		case pathutil.Contains(other.Path, path):
+			problem.Code = PathDuplicate
+			problem.Message = fmt.Sprintf("same directory as library path %q", other.Name)
+		default:
+			continue
+		}
+		validation.Problems = append(validation.Problems, problem)
+	}
+
+	importFolders, err := s.repo.GetImportFolders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list import folders: %w", err)
+	}
+	for _, folder := range importFolders {
+		if pathutil.Contains(folder.Path, path) || pathutil.Contains(path, folder.Path) {
+			validation.Problems = append(validation.Problems, PathProblem{
+				Code:         PathImportOverlap,
+				Message:      fmt.Sprintf("overlaps import folder %q", folder.Name),
+				ConflictID:   folder.ID,
+				ConflictPath: folder.Path,
+			})
+		}
+	}
+
+	validation.Valid = len(validation.Problems) == 0
+	return validation, nil
+}
+
+// ValidateLibraryPaths validates every configured library path against the
+// file system and the other paths.
+func (s *Service) ValidateLibraryPaths(ctx context.Context) ([]PathValidation, error) {
+	libraryPaths, err := s.repo.GetLibraryPaths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library paths: %w", err)
+	}
+
+	validations := make([]PathValidation, 0, len(libraryPaths))
+	for _, lp := range libraryPaths {
+		validation, err := s.ValidateLibraryPath(ctx, lp.Path, lp.ID)
+		if err != nil {
+			return nil, err
+		}
+		validations = append(validations, *validation)
+	}
+	return validations, nil
+}
+
+// checkDirectory reports why path is not a readable directory.
+func checkDirectory(path string) []PathProblem {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return []PathProblem{{Code: PathMissing, Message: "directory does not exist"}}
+	}
+	if err != nil {
+		return []PathProblem{{Code: PathUnreadable, Message: err.Error()}}
+	}
+	if !info.IsDir() {
+		return []PathProblem{{Code: PathNotDirectory, Message: "path is not a directory"}}
+	}
+
+	f, err := os.Open(path)
+	if err == nil {
+		_, err = f.Readdirnames(1)
+		f.Close()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return []PathProblem{{Code: PathUnreadable, Message: "directory is not readable"}}
+	}
+	return nil
+}
+
+// absolutePath returns path cleaned and made absolute, or just cleaned when
+// the working directory is unknown.
+func absolutePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,152 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/sidecar"
+)
+
+// ProgressImportResult summarizes an import of progress sidecars.
+type ProgressImportResult struct {
+	LibraryID string `json:"library_id"`
+	UserID    string `json:"user_id"`
+	// SidecarsFound counts audiobooks with a readable progress sidecar.
+	SidecarsFound int `json:"sidecars_found"`
+	// Imported counts audiobooks whose progress was seeded.
+	Imported int `json:"imported"`
+	// Skipped counts sidecars that were not applied because the user had
+	// already started the book, or the sidecar names a file the book does
+	// not play.
+	Skipped int `json:"skipped"`
+	// Failed lists sidecars that could not be read.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// progressImportUser returns the user a library seeds progress for during
+// scans, or "" when it has none.
+func progressImportUser(library *models.Library) string {
+	return strings.TrimSpace(library.Settings.ProgressImportUserID)
+}
+
+// ImportProgress seeds userID's progress from the progress sidecars of every
+// audiobook in a library. Books the user has already started are left
+// alone, so running it again is safe.
+func (s *Service) ImportProgress(ctx context.Context, libraryID, userID string) (*ProgressImportResult, error) {
+	library, err := s.repo.GetLibraryByID(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("library lookup failed: %w", err)
+	}
+
+	var books []models.Audiobook
+	for _, directory := range library.Directories {
+		known, err := s.repo.ListScannedAudiobooks(ctx, directory.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recorded audiobooks: %w", err)
+		}
+		for assetPath, book := range known {
+			books = append(books, models.Audiobook{ID: book.ID, AssetPath: assetPath})
+		}
+	}
+	return s.importProgress(ctx, library.ID, userID, books)
+}
+
+// importProgress seeds userID's progress from the sidecars of books. Media
+// files are loaded only for books that have a sidecar.
+func (s *Service) importProgress(ctx context.Context, libraryID, userID string, books []models.Audiobook) (*ProgressImportResult, error) {
+	result := &ProgressImportResult{LibraryID: libraryID, UserID: userID}
+	for _, book := range books {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		progress, err := sidecar.FindProgress(book.AssetPath)
+		if err != nil {
+			fmt.Printf("Failed to read progress sidecar of %s: %v\n", book.AssetPath, err)
+			result.Failed = append(result.Failed, book.AssetPath)
+			continue
+		}
+		if progress == nil {
+			continue
+		}
+		result.SidecarsFound++
+
+		files := book.MediaFiles
+		if files == nil {
+			full, err := s.repo.GetAudiobook(ctx, book.ID, "")
+			if err != nil {
+				return result, fmt.Errorf("failed to load audiobook %s: %w", book.ID, err)
+			}
+			files = full.MediaFiles
+		}
+		position, ok := bookPosition(progress, files)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		seeded, err := s.repo.SeedUserProgress(ctx, userID, book.ID, position, progress.Favorite, progress.LastPlayedAt)
+		if err != nil {
+			return result, fmt.Errorf("failed to seed progress of %s: %w", book.AssetPath, err)
+		}
+		if seeded {
+			result.Imported++
+		} else {
+			result.Skipped++
+		}
+	}
+
+	if result.Imported > 0 {
+		s.events.Publish(events.Event{Type: events.UserDataChanged, UserID: userID})
+	}
+	return result, nil
+}
+
+// bookPosition converts a sidecar position to seconds from the start of the
+// book, adding the durations of the files before the one it names. It
+// reports false when the named file is not part of the book.
+func bookPosition(progress *sidecar.Progress, files []models.MediaFile) (float64, bool) {
+	var total float64
+	for _, mf := range files {
+		total += mf.DurationSec
+	}
+	if progress.Finished {
+		return total, true
+	}
+
+	position := progress.PositionSec
+	if progress.File != "" {
+		var offset float64
+		found := false
+		for _, mf := range files {
+			if sameMediaFile(mf.Filename, progress.File) {
+				found = true
+				break
+			}
+			offset += mf.DurationSec
+		}
+		if !found {
+			return 0, false
+		}
+		position += offset
+	}
+	if total > 0 && position > total {
+		position = total
+	}
+	return position, true
+}
+
+// sameMediaFile matches a file named by a sidecar, which other players may
+// record without its folder or in different case, to a media file.
+func sameMediaFile(filename, named string) bool {
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	named = strings.ReplaceAll(named, "\\", "/")
+	if strings.EqualFold(filename, named) {
+		return true
+	}
+	return strings.EqualFold(path.Base(filename), path.Base(named))
+}
@@ -2,23 +2,66 @@ package library
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/lore/backend/internal/events"
+	"github.com/lore/backend/internal/media"
+	"github.com/lore/backend/internal/metadata"
 	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/notify"
+	"github.com/lore/backend/internal/perf"
 	"github.com/lore/backend/internal/repository"
+	"github.com/lore/backend/internal/webhooks"
 )
 
+// JobTypeScan is the background job type of library scans. Scans of the
+// same target, e.g. "all" for the startup scan and a manual scan of every
+// library, share one job instead of overlapping.
+const JobTypeScan = "library_scan"
+
+// DefaultScanWorkers is how many directories are walked, and media files
+// analysed, in parallel when no other number is configured.
+const DefaultScanWorkers = 4
+
 // Service handles library management operations.
 type Service struct {
 	repo       *repository.Repository
 	browseRoot string
+	mime       media.Detector
+	notifier   *notify.Notifier
+	webhooks   *webhooks.Service
+	events     *events.Bus
+	prober     media.Prober
+	workers    int
+
+	// scanFailures counts the consecutive failed scans of each library.
+	scanFailMu       sync.Mutex
+	scanFailures     map[string]int
+	scanFailureLimit int
+
+	// providerNames lists the metadata providers for settings validation;
+	// match links new books to them when a library auto-matches.
+	providerNames func() []string
+	match         Matcher
+
+	// autoScanned records when each library's auto-scan last started, so
+	// a library whose scans keep failing is not retried every check.
+	autoScanMu  sync.Mutex
+	autoScanned map[string]time.Time
 }
 
 // LibraryInfo contains information about a library path.
@@ -30,11 +73,27 @@ type LibraryInfo struct {
 
 // ScanResult contains the results of a library scan.
 type DirectoryScanResult struct {
-	DirectoryID   string             `json:"directory_id"`
-	DirectoryPath string             `json:"directory_path"`
-	BooksFound    int                `json:"books_found"`
-	NewBooks      []models.Audiobook `json:"new_books"`
-	ScanDuration  string             `json:"scan_duration"`
+	DirectoryID    string             `json:"directory_id"`
+	DirectoryPath  string             `json:"directory_path"`
+	BooksFound     int                `json:"books_found"`
+	NewBooks       []models.Audiobook `json:"new_books"`
+	BooksUpdated   int                `json:"books_updated"`
+	BooksUnchanged int                `json:"books_unchanged"`
+	FilesAnalyzed  int                `json:"files_analyzed"`
+	MissingBooks   []string           `json:"missing_books,omitempty"`
+	ScanDuration   string             `json:"scan_duration"`
+	Timing         ScanTiming         `json:"timing"`
+	// RestoredBooks lists books marked missing by an earlier scan whose
+	// folder is back on disk.
+	RestoredBooks []string `json:"restored_books,omitempty"`
+}
+
+// ScanTiming breaks a directory scan down by phase, in milliseconds.
+type ScanTiming struct {
+	DiscoverMs int64 `json:"discover_ms"`
+	AnalyzeMs  int64 `json:"analyze_ms"`
+	PersistMs  int64 `json:"persist_ms"`
+	TotalMs    int64 `json:"total_ms"`
 }
 
 type ScanResult struct {
@@ -43,11 +102,21 @@ type ScanResult struct {
 	Directories   []DirectoryScanResult `json:"directories"`
 	TotalBooks    int                   `json:"total_books_found"`
 	TotalNewBooks int                   `json:"total_new_books"`
+	TotalMissing  int                   `json:"total_missing_books"`
+	TotalRestored int                   `json:"total_restored_books"`
 	ScanDuration  string                `json:"scan_duration"`
+	// Errors lists the library paths that could not be scanned.
+	Errors []string `json:"errors,omitempty"`
+	// ProgressImport reports the progress seeded from sidecars of new
+	// books, when the library names a progress import user.
+	ProgressImport *ProgressImportResult `json:"progress_import,omitempty"`
+	// AutoMatch reports the new books linked to provider metadata, when
+	// the library auto-matches.
+	AutoMatch *AutoMatchResult `json:"auto_match,omitempty"`
 }
 
 // NewService creates a new library service.
-func NewService(repo *repository.Repository, browseRoot string) *Service {
+func NewService(repo *repository.Repository, browseRoot string, detector media.Detector) *Service {
 	absRoot := browseRoot
 	if abs, err := filepath.Abs(browseRoot); err == nil {
 		tmp := abs
@@ -57,14 +126,108 @@ func NewService(repo *repository.Repository, browseRoot string) *Service {
 	return &Service{
 		repo:       repo,
 		browseRoot: absRoot,
+		mime:       detector,
+		prober:     media.NewProber(),
+		workers:    DefaultScanWorkers,
+
+		scanFailures:     make(map[string]int),
+		scanFailureLimit: DefaultScanFailureLimit,
+		autoScanned:      make(map[string]time.Time),
+	}
+}
+
+// SetEvents publishes the catalog changes made by scans and library edits
+// to bus.
+func (s *Service) SetEvents(bus *events.Bus) {
+	s.events = bus
+}
+
+// catalogChanged tells subscribers audiobooks in libraryID, or in any
+// library when it is empty, were added, edited or removed.
+func (s *Service) catalogChanged(libraryID string) {
+	s.events.Publish(events.Event{Type: events.CatalogChanged, LibraryID: libraryID})
+}
+
+// SetProber reads media durations with p instead of the default prober.
+func (s *Service) SetProber(p media.Prober) {
+	if p != nil {
+		s.prober = p
 	}
 }
 
+// SetScanWorkers sets how many directories are walked, and media files
+// analysed, in parallel during a scan.
+func (s *Service) SetScanWorkers(n int) {
+	if n > 0 {
+		s.workers = n
+	}
+}
+
+// SetNotifier sends scan problems to admins through n.
+func (s *Service) SetNotifier(n *notify.Notifier) {
+	s.notifier = n
+}
+
+// SetWebhooks publishes new audiobooks and finished scans to w.
+func (s *Service) SetWebhooks(w *webhooks.Service) {
+	s.webhooks = w
+}
+
 // GetLibraries returns information about all configured libraries including directories.
 func (s *Service) GetLibraries(ctx context.Context) ([]models.Library, error) {
 	return s.repo.ListLibraries(ctx)
 }
 
+// GetLibrariesForUser returns the libraries the user may see: unrestricted
+// ones and, unless they are an admin, only the restricted ones they are a
+// member of.
+func (s *Service) GetLibrariesForUser(ctx context.Context, userID string) ([]models.Library, error) {
+	libraries, err := s.repo.ListLibraries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	visible := libraries[:0]
+	for _, library := range libraries {
+		if library.Restricted {
+			allowed, err := s.repo.CanUserAccessLibrary(ctx, userID, library.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				continue
+			}
+		}
+		visible = append(visible, library)
+	}
+	return visible, nil
+}
+
+// CanUserAccessLibrary reports whether the user may see a library.
+func (s *Service) CanUserAccessLibrary(ctx context.Context, userID, libraryID string) (bool, error) {
+	return s.repo.CanUserAccessLibrary(ctx, userID, libraryID)
+}
+
+// GetLibraryAccess returns whether a library is restricted and its members.
+func (s *Service) GetLibraryAccess(ctx context.Context, libraryID string) (*models.LibraryAccess, error) {
+	return s.repo.GetLibraryAccess(ctx, libraryID)
+}
+
+// SetLibraryAccess restricts a library to admins and the given members, or
+// opens it to everyone again. Members are kept while the library is open,
+// so restricting it later needs no new list.
+func (s *Service) SetLibraryAccess(ctx context.Context, libraryID string, restricted bool, userIDs []string) (*models.LibraryAccess, error) {
+	for _, userID := range userIDs {
+		if strings.TrimSpace(userID) == "" {
+			return nil, fmt.Errorf("user IDs cannot be empty")
+		}
+	}
+	if err := s.repo.SetLibraryAccess(ctx, libraryID, restricted, userIDs); err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.Event{Type: events.AccessChanged})
+	return s.repo.GetLibraryAccess(ctx, libraryID)
+}
+
 // GetBrowseRoot returns the configured browse root path.
 func (s *Service) GetBrowseRoot() string {
 	return s.browseRoot
@@ -77,6 +240,12 @@ func (s *Service) ListLibraryPaths(ctx context.Context) ([]models.LibraryPath, e
 
 // ScanLibrary scans all directories assigned to a library for new audiobooks.
 func (s *Service) ScanLibrary(ctx context.Context, libraryID string) (*ScanResult, error) {
+	result, err := s.scanLibrary(ctx, libraryID)
+	s.recordScanOutcome(ctx, libraryID, result, err)
+	return result, err
+}
+
+func (s *Service) scanLibrary(ctx context.Context, libraryID string) (*ScanResult, error) {
 	library, err := s.repo.GetLibraryByID(ctx, libraryID)
 	if err != nil {
 		return nil, fmt.Errorf("library lookup failed: %w", err)
@@ -88,48 +257,176 @@ func (s *Service) ScanLibrary(ctx context.Context, libraryID string) (*ScanResul
 		LibraryName: library.DisplayName,
 	}
 
+	profile := perf.Profile{
+		Kind:      perf.KindScan,
+		ID:        library.ID,
+		Name:      library.DisplayName,
+		StartedAt: startTime.UTC(),
+		Workers:   s.scanWorkers(ctx),
+	}
+	filter := media.FileFilterFromSettings(library.Settings)
 	for _, directory := range library.Directories {
 		if !directory.Enabled {
 			continue
 		}
 
 		dir := directory // copy to avoid referencing loop variable
-		dirResult, err := s.scanLibraryPath(ctx, library.ID, &dir)
+		dirResult, err := s.scanLibraryPath(ctx, library.ID, &dir, filter)
 		if err != nil {
 			fmt.Printf("Failed to scan directory %s for library %s: %v\n", dir.Path, library.DisplayName, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dir.Path, err))
 			continue
 		}
 
 		result.Directories = append(result.Directories, *dirResult)
 		result.TotalBooks += dirResult.BooksFound
 		result.TotalNewBooks += len(dirResult.NewBooks)
+		result.TotalMissing += len(dirResult.MissingBooks)
+		result.TotalRestored += len(dirResult.RestoredBooks)
+		profile.Books += dirResult.BooksFound
+		profile.FilesProbed += dirResult.FilesAnalyzed
+		profile.BooksWritten += len(dirResult.NewBooks) + dirResult.BooksUpdated
+		profile.WalkMs += dirResult.Timing.DiscoverMs
+		profile.ProbeMs += dirResult.Timing.AnalyzeMs
+		profile.WriteMs += dirResult.Timing.PersistMs
+	}
+
+	var added []models.Audiobook
+	for _, dir := range result.Directories {
+		added = append(added, dir.NewBooks...)
+	}
+	if userID := progressImportUser(library); userID != "" && len(added) > 0 {
+		imported, err := s.importProgress(ctx, library.ID, userID, added)
+		if err != nil {
+			fmt.Printf("Failed to import progress sidecars for library %s: %v\n", library.DisplayName, err)
+		}
+		result.ProgressImport = imported
+	}
+	if library.Settings.AutoMatch && s.match != nil && len(added) > 0 {
+		result.AutoMatch = s.autoMatch(ctx, library, added)
 	}
 
-	result.ScanDuration = time.Since(startTime).String()
+	elapsed := time.Since(startTime)
+	result.ScanDuration = elapsed.String()
+	profile.TotalMs = elapsed.Milliseconds()
+	perf.Record(profile)
+	if result.TotalMissing > 0 {
+		s.notifyMissing(result)
+	}
+	s.webhooks.Publish(webhooks.EventScanCompleted, map[string]interface{}{
+		"library_id":           result.LibraryID,
+		"library_name":         result.LibraryName,
+		"total_books_found":    result.TotalBooks,
+		"total_new_books":      result.TotalNewBooks,
+		"total_missing_books":  result.TotalMissing,
+		"total_restored_books": result.TotalRestored,
+		"scan_duration":        result.ScanDuration,
+	})
 	return result, nil
 }
 
-func (s *Service) scanLibraryPath(ctx context.Context, libraryID string, pathConfig *models.LibraryPath) (*DirectoryScanResult, error) {
+// notifyMissing tells admins which audiobooks a scan could not find on disk.
+func (s *Service) notifyMissing(result *ScanResult) {
+	var body strings.Builder
+	var missing []string
+	fmt.Fprintf(&body, "Scanning library %q found %d audiobook(s) missing on disk:\n\n", result.LibraryName, result.TotalMissing)
+	for _, dir := range result.Directories {
+		for _, path := range dir.MissingBooks {
+			fmt.Fprintf(&body, "  - %s\n", path)
+			missing = append(missing, path)
+		}
+	}
+
+	s.notifier.Notify(notify.Event{
+		Type:    notify.EventScanMissing,
+		Subject: fmt.Sprintf("Library %s: %d audiobook(s) missing", result.LibraryName, result.TotalMissing),
+		Body:    body.String(),
+		Data: map[string]interface{}{
+			"library_id":    result.LibraryID,
+			"missing_books": missing,
+		},
+	})
+}
+
+// scanLibraryPath discovers the audiobooks under a library path, creates the
+// new ones and re-reads the media files of recorded ones whose folder
+// changed since the last scan. Folders with an unchanged fingerprint are
+// skipped. filter picks the audio files.
+func (s *Service) scanLibraryPath(ctx context.Context, libraryID string, pathConfig *models.LibraryPath, filter media.FileFilter) (*DirectoryScanResult, error) {
 	startTime := time.Now()
+	result := &DirectoryScanResult{
+		DirectoryID:   pathConfig.ID,
+		DirectoryPath: pathConfig.Path,
+	}
 
-	discoveries, err := s.discoverAudiobooks(pathConfig.Path)
+	discoveries, err := s.discoverAudiobooks(ctx, pathConfig.Path, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover audiobooks: %w", err)
 	}
-
-	fmt.Printf("Discovered %d audiobooks in %s\n", len(discoveries), pathConfig.Path)
-	for i, d := range discoveries {
-		fmt.Printf("  Discovery %d: %s with %d files\n", i+1, d.AssetPath, len(d.MediaFiles))
+	known, err := s.repo.ListScannedAudiobooks(ctx, pathConfig.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recorded audiobooks: %w", err)
 	}
+	result.BooksFound = len(discoveries)
+	fmt.Printf("Discovered %d audiobooks in %s\n", len(discoveries), pathConfig.Path)
 
-	var newBooks []models.Audiobook
-	for _, discovery := range discoveries {
-		existing, err := s.repo.GetAudiobookByPath(ctx, discovery.AssetPath)
-		if err == nil && existing != nil {
-			fmt.Printf("Audiobook already exists at %s, skipping\n", discovery.AssetPath)
-			continue
+	type changedBook struct {
+		id          string
+		assetPath   string
+		fingerprint string
+		files       []models.MediaFile
+		supplements []models.SupplementFile
+	}
+	var added []*AudiobookDiscovery
+	var changed []*changedBook
+	var jobs []analysisJob
+	for i := range discoveries {
+		discovery := &discoveries[i]
+		book, ok := known[discovery.AssetPath]
+		switch {
+		case !ok:
+			added = append(added, discovery)
+			for j := range discovery.MediaFiles {
+				jobs = append(jobs, analysisJob{
+					path: mediaFilePath(discovery.AssetPath, discovery.MediaFiles[j].Filename),
+					file: &discovery.MediaFiles[j],
+				})
+			}
+		case book.Fingerprint == discovery.Fingerprint:
+			result.BooksUnchanged++
+		default:
+			// The folder changed: re-read the files the audiobook plays from.
+			// The file list itself is left alone, since merges deliberately
+			// leave files in the folder that are no longer played.
+			existing, err := s.repo.GetAudiobook(ctx, book.ID, "")
+			if err != nil {
+				fmt.Printf("Failed to load audiobook at %s: %v\n", discovery.AssetPath, err)
+				continue
+			}
+			cb := &changedBook{id: book.ID, assetPath: discovery.AssetPath, fingerprint: discovery.Fingerprint, supplements: discovery.SupplementFiles}
+			for _, mf := range existing.MediaFiles {
+				path := mediaFilePath(existing.AssetPath, mf.Filename)
+				if _, err := os.Stat(path); err == nil {
+					cb.files = append(cb.files, mf)
+				}
+			}
+			for j := range cb.files {
+				jobs = append(jobs, analysisJob{path: mediaFilePath(existing.AssetPath, cb.files[j].Filename), file: &cb.files[j]})
+			}
+			changed = append(changed, cb)
 		}
+	}
+	discovered := time.Now()
+	result.Timing.DiscoverMs = discovered.Sub(startTime).Milliseconds()
+
+	if err := s.analyzeMediaFiles(ctx, jobs); err != nil {
+		return nil, err
+	}
+	result.FilesAnalyzed = len(jobs)
+	analyzed := time.Now()
+	result.Timing.AnalyzeMs = analyzed.Sub(discovered).Milliseconds()
 
+	for _, discovery := range added {
 		libID := libraryID
 		audiobook := &models.Audiobook{
 			ID:            uuid.NewString(),
@@ -138,8 +435,6 @@ func (s *Service) scanLibraryPath(ctx context.Context, libraryID string, pathCon
 			AssetPath:     discovery.AssetPath,
 		}
 
-		fmt.Printf("Creating audiobook with library_id=%s library_path_id=%s for path=%s\n", libraryID, pathConfig.ID, discovery.AssetPath)
-
 		for i := range discovery.MediaFiles {
 			if discovery.MediaFiles[i].AudiobookID == "" {
 				discovery.MediaFiles[i].AudiobookID = audiobook.ID
@@ -150,22 +445,105 @@ func (s *Service) scanLibraryPath(ctx context.Context, libraryID string, pathCon
 			fmt.Printf("Failed to create audiobook at %s for library %s: %v\n", discovery.AssetPath, libraryID, err)
 			continue
 		}
+		if err := s.repo.ReplaceSupplementFiles(ctx, audiobook.ID, discovery.SupplementFiles); err != nil {
+			fmt.Printf("Failed to record supplement files of %s: %v\n", discovery.AssetPath, err)
+		} else if err := s.repo.SetScanFingerprint(ctx, audiobook.ID, discovery.Fingerprint); err != nil {
+			fmt.Printf("Failed to record scan fingerprint for %s: %v\n", discovery.AssetPath, err)
+		}
+		if _, err := s.readSidecarMetadata(ctx, audiobook.ID, discovery.AssetPath); err != nil {
+			fmt.Printf("Failed to read metadata sidecars of %s: %v\n", discovery.AssetPath, err)
+		}
 
 		created, err := s.repo.GetAudiobook(ctx, audiobook.ID, "")
 		if err != nil {
 			continue
 		}
 
-		newBooks = append(newBooks, *created)
+		result.NewBooks = append(result.NewBooks, *created)
+		s.webhooks.Publish(webhooks.EventBookAdded, created)
 	}
 
-	return &DirectoryScanResult{
-		DirectoryID:   pathConfig.ID,
-		DirectoryPath: pathConfig.Path,
-		BooksFound:    len(discoveries),
-		NewBooks:      newBooks,
-		ScanDuration:  time.Since(startTime).String(),
-	}, nil
+	for _, book := range changed {
+		// Supplements go first: the new fingerprint is only stored once
+		// everything it covers is recorded.
+		if err := s.repo.ReplaceSupplementFiles(ctx, book.id, book.supplements); err != nil {
+			fmt.Printf("Failed to update supplement files of audiobook %s: %v\n", book.id, err)
+			continue
+		}
+		if err := s.repo.UpdateScannedMediaFiles(ctx, book.id, book.files, book.fingerprint); err != nil {
+			fmt.Printf("Failed to update media files of audiobook %s: %v\n", book.id, err)
+			continue
+		}
+		if _, err := s.readSidecarMetadata(ctx, book.id, book.assetPath); err != nil {
+			fmt.Printf("Failed to read metadata sidecars of %s: %v\n", book.assetPath, err)
+		}
+		result.BooksUpdated++
+	}
+
+	if len(result.NewBooks) > 0 || result.BooksUpdated > 0 {
+		s.catalogChanged(libraryID)
+	}
+
+	result.MissingBooks, result.RestoredBooks, err = s.reconcileMissingBooks(ctx, libraryID, pathConfig.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for missing audiobooks: %w", err)
+	}
+
+	stats := scanStats(discoveries)
+	stats.ScannedAt = time.Now()
+	stats.Duration = stats.ScannedAt.Sub(startTime)
+	if err := s.repo.RecordLibraryPathScan(ctx, pathConfig.ID, stats); err != nil {
+		return nil, fmt.Errorf("failed to record scan statistics: %w", err)
+	}
+
+	result.Timing.PersistMs = stats.ScannedAt.Sub(analyzed).Milliseconds()
+	result.Timing.TotalMs = stats.Duration.Milliseconds()
+	result.ScanDuration = stats.Duration.String()
+	return result, nil
+}
+
+// scanStats counts the audiobooks, media files and bytes found on disk.
+func scanStats(discoveries []AudiobookDiscovery) repository.LibraryPathScan {
+	stats := repository.LibraryPathScan{Books: len(discoveries)}
+	for _, discovery := range discoveries {
+		stats.Files += len(discovery.MediaFiles)
+		stats.TotalSize += discovery.Size
+	}
+	return stats
+}
+
+// reconcileMissingBooks marks the audiobooks recorded under a library path
+// whose folder no longer exists on disk as missing, and restores those
+// marked by an earlier scan whose folder is back. It returns the asset paths
+// of the books missing now and of those restored.
+func (s *Service) reconcileMissingBooks(ctx context.Context, libraryID, libraryPathID string) (missing, restored []string, err error) {
+	books, err := s.repo.ListLibraryPathAudiobooks(ctx, libraryPathID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed := false
+	for _, book := range books {
+		_, statErr := os.Stat(book.AssetPath)
+		gone := errors.Is(statErr, fs.ErrNotExist)
+		if gone {
+			missing = append(missing, book.AssetPath)
+		}
+		if gone == book.Missing {
+			continue
+		}
+		if err := s.repo.SetAudiobookMissing(ctx, book.ID, gone); err != nil {
+			return nil, nil, err
+		}
+		if !gone {
+			restored = append(restored, book.AssetPath)
+		}
+		changed = true
+	}
+	if changed {
+		s.catalogChanged(libraryID)
+	}
+	return missing, restored, nil
 }
 
 // ScanAllLibraries scans all libraries and aggregates their results.
@@ -188,11 +566,130 @@ func (s *Service) ScanAllLibraries(ctx context.Context) ([]ScanResult, error) {
 	return results, nil
 }
 
+// ScanAllLibrariesLowPriority scans every library like ScanAllLibraries, but
+// on a single worker so a background scan leaves disk and CPU to streaming.
+// report is called after each library.
+func (s *Service) ScanAllLibrariesLowPriority(ctx context.Context, report func(done, total int)) ([]ScanResult, error) {
+	libraries, err := s.repo.ListLibraries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+
+	ctx = context.WithValue(ctx, lowPriorityKey{}, true)
+	results := []ScanResult{}
+	for i, library := range libraries {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result, err := s.ScanLibrary(ctx, library.ID)
+		if err != nil {
+			fmt.Printf("Failed to scan library %s: %v\n", library.DisplayName, err)
+		} else {
+			results = append(results, *result)
+		}
+		report(i+1, len(libraries))
+	}
+	return results, nil
+}
+
+// lowPriorityKey marks the context of a scan that runs on a single worker.
+type lowPriorityKey struct{}
+
+// scanWorkers returns how many directories a scan walks, and files it
+// analyses, at once.
+func (s *Service) scanWorkers(ctx context.Context) int {
+	if low, _ := ctx.Value(lowPriorityKey{}).(bool); low {
+		return 1
+	}
+	return s.workers
+}
+
 // GetLibrary fetches a library by identifier.
 func (s *Service) GetLibrary(ctx context.Context, id string) (*models.Library, error) {
 	return s.repo.GetLibraryByID(ctx, id)
 }
 
+// RebuildResolvedMetadata refreshes the resolved metadata snapshots for the
+// given libraries, or for every audiobook when none are given.
+func (s *Service) RebuildResolvedMetadata(ctx context.Context, libraryIDs []string, progress func(done, total int)) (int, error) {
+	n, err := s.repo.RebuildResolvedMetadata(ctx, libraryIDs, progress)
+	if n > 0 {
+		s.catalogChanged("")
+	}
+	return n, err
+}
+
+// MimeDetectResult summarises a media MIME re-detection pass.
+type MimeDetectResult struct {
+	Checked    int `json:"checked"`
+	Corrected  int `json:"corrected"`
+	Mismatches int `json:"mismatches"`
+	Missing    int `json:"missing"`
+}
+
+// RedetectMimeTypes sniffs every stored media file and corrects mime_type
+// where the content disagrees with what was recorded. Sniffing is always
+// enabled here, regardless of the scan-time setting.
+func (s *Service) RedetectMimeTypes(ctx context.Context, progress func(done, total int)) (MimeDetectResult, error) {
+	var result MimeDetectResult
+
+	locations, err := s.repo.ListMediaFileLocations(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	detector := media.Detector{Sniff: true}
+	for i, loc := range locations {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if progress != nil {
+			progress(i, len(locations))
+		}
+
+		path := mediaFilePath(loc.AssetPath, loc.MediaFile.Filename)
+		if _, err := os.Stat(path); err != nil {
+			result.Missing++
+			continue
+		}
+		result.Checked++
+
+		var mf models.MediaFile
+		applyMimeType(&mf, path, detector)
+		if mf.ExtensionMimeType != nil {
+			result.Mismatches++
+		}
+		if mf.MimeType != loc.MediaFile.MimeType {
+			result.Corrected++
+		}
+		if err := s.repo.UpdateMediaFileMimeType(ctx, loc.MediaFile.ID, mf.MimeType, mf.ExtensionMimeType); err != nil {
+			return result, err
+		}
+	}
+	if progress != nil {
+		progress(len(locations), len(locations))
+	}
+	if result.Corrected > 0 {
+		s.catalogChanged("")
+	}
+
+	return result, nil
+}
+
+// ListMimeMismatches returns media files whose content disagrees with their extension.
+func (s *Service) ListMimeMismatches(ctx context.Context, offset, limit int) ([]models.MimeMismatch, int, error) {
+	return s.repo.ListMimeMismatches(ctx, offset, limit)
+}
+
+// mediaFilePath locates a media file on disk. Single-file audiobooks in a
+// library root store the file itself as their asset path.
+func mediaFilePath(assetPath, filename string) string {
+	if info, err := os.Stat(assetPath); err == nil && !info.IsDir() {
+		return assetPath
+	}
+	return filepath.Join(assetPath, filepath.FromSlash(filename))
+}
+
 // CreateLibrary registers a new library with optional directories.
 func (s *Service) CreateLibrary(ctx context.Context, library *models.Library) (*models.Library, error) {
 	if library == nil {
@@ -215,6 +712,10 @@ func (s *Service) CreateLibrary(ctx context.Context, library *models.Library) (*
 		library.Type = "audiobook"
 	}
 
+	if err := s.ValidateSettings(ctx, library.Settings); err != nil {
+		return nil, err
+	}
+
 	if err := s.repo.CreateLibrary(ctx, library); err != nil {
 		return nil, err
 	}
@@ -228,15 +729,20 @@ func (s *Service) UpdateLibrary(ctx context.Context, id string, updates map[stri
 		updates = map[string]interface{}{}
 	}
 
-	if settings, ok := updates["settings"]; ok {
-		switch value := settings.(type) {
-		case map[string]interface{}:
-			updates["settings"] = cloneSettings(value)
-		case *map[string]interface{}:
-			if value != nil {
-				cloned := cloneSettings(*value)
-				updates["settings"] = cloned
-			}
+	var before metadata.Collation
+	var beforeFormat metadata.ContributorFormat
+	var beforeOrder []string
+	if _, ok := updates["settings"]; ok {
+		if current, err := s.repo.GetLibraryByID(ctx, id); err == nil {
+			before = metadata.CollationFromSettings(current.Settings)
+			beforeFormat = metadata.ContributorFormatFromSettings(current.Settings)
+			beforeOrder = metadata.MetadataOrderFromSettings(current.Settings)
+		}
+	}
+
+	if settings, ok := updates["settings"].(models.LibrarySettings); ok {
+		if err := s.ValidateSettings(ctx, settings); err != nil {
+			return nil, err
 		}
 	}
 
@@ -244,12 +750,38 @@ func (s *Service) UpdateLibrary(ctx context.Context, id string, updates map[stri
 		return nil, err
 	}
 
-	return s.repo.GetLibraryByID(ctx, id)
+	library, err := s.repo.GetLibraryByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// A new metadata order or contributor format rewrites every book's
+	// resolved metadata; a new sort locale or article rule changes its sort
+	// keys.
+	if _, ok := updates["settings"]; ok {
+		switch {
+		case !slices.Equal(metadata.MetadataOrderFromSettings(library.Settings), beforeOrder),
+			metadata.ContributorFormatFromSettings(library.Settings) != beforeFormat:
+			if _, err := s.repo.RebuildResolvedMetadata(ctx, []string{id}, nil); err != nil {
+				return nil, err
+			}
+		case metadata.CollationFromSettings(library.Settings) != before:
+			if err := s.repo.UpdateLibrarySortKeys(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	s.catalogChanged(id)
+
+	return library, nil
 }
 
 // DeleteLibrary removes a library and any associated assignments.
 func (s *Service) DeleteLibrary(ctx context.Context, id string) error {
-	return s.repo.DeleteLibrary(ctx, id)
+	if err := s.repo.DeleteLibrary(ctx, id); err != nil {
+		return err
+	}
+	s.catalogChanged(id)
+	return nil
 }
 
 // SetLibraryDirectories updates the directories assigned to a library.
@@ -257,22 +789,11 @@ func (s *Service) SetLibraryDirectories(ctx context.Context, libraryID string, d
 	if err := s.repo.SetLibraryDirectories(ctx, libraryID, directoryIDs); err != nil {
 		return nil, err
 	}
+	s.catalogChanged(libraryID)
 
 	return s.repo.GetLibraryByID(ctx, libraryID)
 }
 
-func cloneSettings(src map[string]interface{}) map[string]interface{} {
-	if src == nil {
-		return nil
-	}
-
-	clone := make(map[string]interface{}, len(src))
-	for k, v := range src {
-		clone[k] = v
-	}
-	return clone
-}
-
 func generateLibraryName(displayName string) string {
 	slug := strings.ToLower(strings.TrimSpace(displayName))
 	re := regexp.MustCompile(`[^a-z0-9]+`)
@@ -377,171 +898,293 @@ func resolveWithinRoot(root, child string) (string, string, error) {
 type AudiobookDiscovery struct {
 	AssetPath  string
 	MediaFiles []models.MediaFile
+	// SupplementFiles are the companion files next to the audio, such as
+	// cover art, cue sheets and PDFs.
+	SupplementFiles []models.SupplementFile
+	// Size is the combined size of the media files in bytes.
+	Size int64
+	// Fingerprint changes whenever a media or supplement file is added,
+	// removed, resized or modified.
+	Fingerprint string
+}
+
+// discoveredFile is a media or supplement file found while walking a
+// library path, with its name relative to the audiobook's asset path.
+type discoveredFile struct {
+	rel  string
+	info fs.FileInfo
 }
 
-// discoverAudiobooks finds audiobooks in a library path.
-func (s *Service) discoverAudiobooks(libraryPath string) ([]AudiobookDiscovery, error) {
+// newDiscovery describes an audiobook made of files. MIME types and
+// durations are filled in later, and only for audiobooks that need them.
+func newDiscovery(assetPath string, files, supplements []discoveredFile) AudiobookDiscovery {
+	discovery := AudiobookDiscovery{
+		AssetPath:  assetPath,
+		MediaFiles: make([]models.MediaFile, 0, len(files)),
+	}
+	hash := sha256.New()
+	for _, f := range files {
+		discovery.MediaFiles = append(discovery.MediaFiles, models.MediaFile{
+			ID:       uuid.NewString(),
+			Filename: f.rel,
+		})
+		discovery.Size += f.info.Size()
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", f.rel, f.info.Size(), f.info.ModTime().UnixNano())
+	}
+	// Books without supplements keep the fingerprint they had before
+	// supplements were recorded.
+	for _, f := range supplements {
+		supplement, _ := media.SupplementFor(f.rel)
+		discovery.SupplementFiles = append(discovery.SupplementFiles, models.SupplementFile{
+			Filename:  f.rel,
+			Kind:      supplement.Kind,
+			MimeType:  supplement.MimeType,
+			SizeBytes: f.info.Size(),
+		})
+		fmt.Fprintf(hash, "supplement\x00%s\x00%d\x00%d\n", f.rel, f.info.Size(), f.info.ModTime().UnixNano())
+	}
+	discovery.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	return discovery
+}
+
+// discoverAudiobooks finds audiobooks in a library path. Audio files in the
+// root are audiobooks of their own; each directory below it is walked by a
+// pool of workers. Hidden directories, and files and directories the filter
+// ignores, are skipped.
+func (s *Service) discoverAudiobooks(ctx context.Context, libraryPath string, filter media.FileFilter) ([]AudiobookDiscovery, error) {
 	var discoveries []AudiobookDiscovery
 
-	// First, handle individual audio files in the library root
 	rootEntries, err := os.ReadDir(libraryPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read library path: %w", err)
 	}
 
+	var dirs []string
 	for _, entry := range rootEntries {
-		if entry.IsDir() {
-			continue // Skip directories in this pass
-		}
-
 		fullPath := filepath.Join(libraryPath, entry.Name())
-		if isAudioFile(fullPath) {
-			// Individual file in root becomes its own audiobook
-			discovery := AudiobookDiscovery{
-				AssetPath: fullPath, // Use full file path as unique identifier
-				MediaFiles: []models.MediaFile{
-					{
-						ID:          uuid.NewString(),
-						AudiobookID: "", // Will be set when creating audiobook
-						Filename:    entry.Name(),
-						DurationSec: 0, // TODO: Extract duration
-						MimeType:    getMimeType(fullPath),
-					},
-				},
+		if entry.IsDir() {
+			// Hidden directories hold trash, thumbnails and in-progress
+			// imports rather than audiobooks.
+			if strings.HasPrefix(entry.Name(), ".") || filter.Ignored(entry.Name()) {
+				continue
 			}
-			discoveries = append(discoveries, discovery)
+			dirs = append(dirs, fullPath)
+			continue
 		}
+		if !filter.IsAudioFile(fullPath) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		// Use the full file path as the audiobook's unique identifier
+		discoveries = append(discoveries, newDiscovery(fullPath, []discoveredFile{{rel: entry.Name(), info: info}}, nil))
 	}
 
-	// Now handle directories as books
-	for _, entry := range rootEntries {
-		if !entry.IsDir() {
-			continue // Skip files in this pass
+	paths := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < min(s.scanWorkers(ctx), len(dirs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dirPath := range paths {
+				found := s.discoverDirectory(dirPath, filter)
+				mu.Lock()
+				discoveries = append(discoveries, found...)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, dirPath := range dirs {
+		if ctx.Err() != nil {
+			break
 		}
+		paths <- dirPath
+	}
+	close(paths)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-		dirPath := filepath.Join(libraryPath, entry.Name())
-
-		// Check if directory contains audio files
-		mediaFiles, err := s.findMediaFilesInDir(dirPath)
-		if err != nil || len(mediaFiles) == 0 {
-			// If no audio files directly in this directory, check subdirectories
-			err := filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
-				if err != nil {
-					return nil // Skip problematic paths
-				}
+	sort.Slice(discoveries, func(i, j int) bool {
+		return discoveries[i].AssetPath < discoveries[j].AssetPath
+	})
+	return discoveries, nil
+}
 
-				// Skip the root directory itself
-				if path == dirPath {
-					return nil
-				}
+// discoverDirectory returns the audiobooks in one top-level directory of a
+// library path: the directory itself when it holds audio files or disc
+// folders, otherwise the first directories below it that do.
+func (s *Service) discoverDirectory(dirPath string, filter media.FileFilter) []AudiobookDiscovery {
+	if discovery, ok := discoverBook(dirPath, filter); ok {
+		return []AudiobookDiscovery{discovery}
+	}
 
-				if d.IsDir() {
-					// Check if this subdirectory has audio files
-					subMediaFiles, err := s.findMediaFilesInDir(path)
-					if err == nil && len(subMediaFiles) > 0 {
-						discovery := AudiobookDiscovery{
-							AssetPath:  path,
-							MediaFiles: subMediaFiles,
-						}
-						discoveries = append(discoveries, discovery)
-						return filepath.SkipDir // Don't go deeper
-					}
-				}
+	var discoveries []AudiobookDiscovery
+	err := filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip problematic paths
+		}
+		if path == dirPath || !d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || filter.Ignored(d.Name()) {
+			return filepath.SkipDir
+		}
 
-				return nil
-			})
-			if err != nil {
-				fmt.Printf("Error walking directory %s: %v\n", dirPath, err)
-			}
-		} else {
-			// Directory has audio files directly in it
-			discovery := AudiobookDiscovery{
-				AssetPath:  dirPath,
-				MediaFiles: mediaFiles,
-			}
+		if discovery, ok := discoverBook(path, filter); ok {
 			discoveries = append(discoveries, discovery)
+			return filepath.SkipDir // Don't go deeper
 		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error walking directory %s: %v\n", dirPath, err)
 	}
-
-	return discoveries, nil
+	return discoveries
 }
 
-// findMediaFilesInDir finds all audio files in a directory.
-func (s *Service) findMediaFilesInDir(dirPath string) ([]models.MediaFile, error) {
+// discFolder matches the folders discs of one audiobook are ripped into,
+// such as "CD1", "Disc 02" or "disk_3 - Part Three".
+var discFolder = regexp.MustCompile(`(?i)^(?:cd|dis[ck])[\s._-]*\d+\b`)
+
+// discoverBook describes the audiobook in dirPath: its own audio files
+// followed by those of the disc folders right below it, grouped into one
+// audiobook, e.g. "intro.mp3" with "CD1/" and "CD2/". Disc files are named
+// relative to dirPath ("CD2/01.mp3"), so natural ordering plays the book's
+// own files first and then the discs in order.
+func discoverBook(dirPath string, filter media.FileFilter) (AudiobookDiscovery, bool) {
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return nil, err
+		return AudiobookDiscovery{}, false
 	}
-
-	var mediaFiles []models.MediaFile
+	files, supplements := mediaFilesIn(entries, filter)
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if !entry.IsDir() || !discFolder.MatchString(entry.Name()) || filter.Ignored(entry.Name()) {
 			continue
 		}
-
-		fullPath := filepath.Join(dirPath, entry.Name())
-		if !isAudioFile(fullPath) {
+		discFiles, discSupplements, err := findMediaFilesInDir(filepath.Join(dirPath, entry.Name()), filter)
+		if err != nil {
 			continue
 		}
-
-		rel, err := filepath.Rel(dirPath, fullPath)
-		if err != nil {
-			rel = entry.Name()
+		for _, f := range discFiles {
+			files = append(files, discoveredFile{rel: filepath.Join(entry.Name(), f.rel), info: f.info})
 		}
-
-		mediaFile := models.MediaFile{
-			ID:          uuid.NewString(),
-			AudiobookID: "", // Will be set when creating audiobook
-			Filename:    rel,
-			DurationSec: 0, // TODO: Extract duration
-			MimeType:    getMimeType(fullPath),
+		for _, f := range discSupplements {
+			supplements = append(supplements, discoveredFile{rel: filepath.Join(entry.Name(), f.rel), info: f.info})
 		}
+	}
+	if len(files) == 0 {
+		return AudiobookDiscovery{}, false
+	}
+	return newDiscovery(dirPath, files, supplements), true
+}
 
-		mediaFiles = append(mediaFiles, mediaFile)
+// findMediaFilesInDir finds the audio files filter accepts in a directory,
+// and the supplement files next to them.
+func findMediaFilesInDir(dirPath string, filter media.FileFilter) (files, supplements []discoveredFile, err error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, nil, err
 	}
+	files, supplements = mediaFilesIn(entries, filter)
+	return files, supplements, nil
+}
 
-	return mediaFiles, nil
+// mediaFilesIn picks the audio files filter accepts, and the supplement
+// files, from the entries of a directory. Hidden and ignored files are not
+// supplements.
+func mediaFilesIn(entries []os.DirEntry, filter media.FileFilter) (files, supplements []discoveredFile) {
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		isAudio := filter.IsAudioFile(entry.Name())
+		if !isAudio {
+			if _, ok := media.SupplementFor(entry.Name()); !ok || strings.HasPrefix(entry.Name(), ".") || filter.Ignored(entry.Name()) {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if isAudio {
+			files = append(files, discoveredFile{rel: entry.Name(), info: info})
+		} else {
+			supplements = append(supplements, discoveredFile{rel: entry.Name(), info: info})
+		}
+	}
+	return files, supplements
 }
 
-// isAudioFile checks if a file is an audio file based on extension.
-func isAudioFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	audioExts := []string{".mp3", ".m4a", ".m4b", ".flac", ".wav", ".ogg", ".aac"}
+// analysisJob is a media file whose MIME type and duration need reading.
+type analysisJob struct {
+	path string
+	file *models.MediaFile
+}
 
-	for _, audioExt := range audioExts {
-		if ext == audioExt {
-			return true
+// analyzeMediaFiles detects the MIME type and duration of each file,
+// spreading the work over the scan workers.
+func (s *Service) analyzeMediaFiles(ctx context.Context, jobs []analysisJob) error {
+	queue := make(chan analysisJob)
+	var wg sync.WaitGroup
+	for i := 0; i < min(s.scanWorkers(ctx), len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				applyMimeType(job.file, job.path, s.mime)
+				probe, err := s.prober.Probe(ctx, job.path)
+				if err != nil {
+					if ctx.Err() == nil {
+						fmt.Printf("Warning: Failed to extract duration for %s: %v\n", job.path, err)
+					}
+					continue
+				}
+				job.file.DurationSec = probe.DurationSec
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
 		}
+		queue <- job
 	}
-	return false
+	close(queue)
+	wg.Wait()
+	return ctx.Err()
 }
 
-// getMimeType returns the MIME type for an audio file.
-func getMimeType(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".mp3":
-		return "audio/mpeg"
-	case ".m4a", ".m4b":
-		return "audio/mp4"
-	case ".flac":
-		return "audio/flac"
-	case ".wav":
-		return "audio/wav"
-	case ".ogg":
-		return "audio/ogg"
-	case ".aac":
-		return "audio/aac"
-	default:
-		return "audio/mpeg" // Default fallback
+// applyMimeType sets the media file's MIME type, recording the extension's
+// type when sniffing disagrees with it.
+func applyMimeType(mf *models.MediaFile, path string, detector media.Detector) {
+	detection := detector.Detect(path)
+	mf.MimeType = detection.MimeType
+	if detection.Mismatch() {
+		mf.ExtensionMimeType = &detection.ExtensionMimeType
 	}
 }
 
 // Library Path Management
 
-// CreateLibraryPath adds a new library path.
+// CreateLibraryPath adds a new library path. It returns a
+// *PathValidationError when the path fails ValidateLibraryPath.
 func (s *Service) CreateLibraryPath(ctx context.Context, path, name string) (*models.LibraryPath, error) {
+	path = absolutePath(path)
+	validation, err := s.ValidateLibraryPath(ctx, path, "")
+	if err != nil {
+		return nil, err
+	}
+	if !validation.Valid {
+		return nil, &PathValidationError{Validation: *validation}
+	}
+
 	libraryPath := &models.LibraryPath{
 		ID:      uuid.NewString(),
 		Path:    path,
@@ -556,14 +1199,39 @@ func (s *Service) CreateLibraryPath(ctx context.Context, path, name string) (*mo
 	return libraryPath, nil
 }
 
-// UpdateLibraryPath updates an existing library path.
+// UpdateLibraryPath updates an existing library path. A new path is
+// validated like one being created.
 func (s *Service) UpdateLibraryPath(ctx context.Context, id string, updates map[string]interface{}) error {
-	return s.repo.UpdateLibraryPath(ctx, id, updates)
+	if value, ok := updates["path"]; ok {
+		path, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("path must be a string")
+		}
+		path = absolutePath(path)
+		validation, err := s.ValidateLibraryPath(ctx, path, id)
+		if err != nil {
+			return err
+		}
+		if !validation.Valid {
+			return &PathValidationError{Validation: *validation}
+		}
+		updates["path"] = path
+	}
+
+	if err := s.repo.UpdateLibraryPath(ctx, id, updates); err != nil {
+		return err
+	}
+	s.catalogChanged("")
+	return nil
 }
 
 // DeleteLibraryPath removes a library path.
 func (s *Service) DeleteLibraryPath(ctx context.Context, id string) error {
-	return s.repo.DeleteLibraryPath(ctx, id)
+	if err := s.repo.DeleteLibraryPath(ctx, id); err != nil {
+		return err
+	}
+	s.catalogChanged("")
+	return nil
 }
 
 // UpdateLastScanned updates the last scanned timestamp for a library path.
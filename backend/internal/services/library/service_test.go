@@ -0,0 +1,36 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lore/backend/internal/media"
+)
+
+func TestDiscoverBookMixedLayout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Title")
+	for _, name := range []string{"intro.mp3", "CD1/01.mp3", "CD1/02.mp3", "CD2/01.mp3", "Extras/bonus.mp3"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	discovery, ok := discoverBook(dir, media.FileFilter{})
+	if !ok {
+		t.Fatal("no audiobook discovered")
+	}
+	var got []string
+	for _, file := range discovery.MediaFiles {
+		got = append(got, file.Filename)
+	}
+	want := []string{"intro.mp3", filepath.Join("CD1", "01.mp3"), filepath.Join("CD1", "02.mp3"), filepath.Join("CD2", "01.mp3")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("media files = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	apperrors "github.com/lore/backend/internal/errors"
+	"github.com/lore/backend/internal/metadata"
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/providers"
+)
+
+// MinAutoScanInterval is the shortest auto-scan interval, in minutes, a
+// library may set.
+const MinAutoScanInterval = 5
+
+var (
+	extensionPattern = regexp.MustCompile(`^\.?[a-z0-9]+$`)
+	localePattern    = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+)
+
+var (
+	contributorNameOrders = []string{metadata.NameCredited, metadata.NameFirstLast, metadata.NameLastFirst}
+	contributorSeparators = []string{metadata.SeparatorCredited, metadata.SeparatorComma, metadata.SeparatorAmpersand}
+	contributorSortOrders = []string{metadata.NameFirstLast, metadata.NameLastFirst}
+)
+
+// SetProviders tells the service which metadata providers can be named as
+// a library's preferred provider.
+func (s *Service) SetProviders(names func() []string) {
+	s.providerNames = names
+}
+
+// ValidateSettings checks library settings beyond their types, returning a
+// *apperrors.ValidationError for the first setting that cannot be used.
+func (s *Service) ValidateSettings(ctx context.Context, settings models.LibrarySettings) error {
+	invalid := func(key, message string, value interface{}) error {
+		return apperrors.NewValidationError("settings."+key, message, value)
+	}
+
+	if n := settings.AutoScanIntervalMinutes; n != 0 && n < MinAutoScanInterval {
+		return invalid("auto_scan_interval_minutes", fmt.Sprintf("must be 0 (off) or at least %d", MinAutoScanInterval), n)
+	}
+	for _, ext := range settings.AudioExtensions {
+		if !extensionPattern.MatchString(strings.ToLower(strings.TrimSpace(ext))) {
+			return invalid("audio_extensions", "must be file extensions such as \"mka\" or \".dts\"", ext)
+		}
+	}
+	for _, pattern := range settings.IgnorePatterns {
+		if _, err := filepath.Match(strings.TrimSpace(pattern), ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return invalid("ignore_patterns", "must be valid glob patterns", pattern)
+		}
+	}
+	if userID := strings.TrimSpace(settings.ProgressImportUserID); userID != "" {
+		exists, err := s.repo.UserExists(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return invalid("progress_import_user_id", "user not found", userID)
+		}
+	}
+
+	if name := settings.PreferredProvider; name != "" && name != providers.AllProviders && !slices.Contains(s.knownProviders(), name) {
+		return invalid("preferred_provider", "unknown provider", name)
+	}
+	seen := make(map[string]bool)
+	for _, tier := range settings.MetadataOrder {
+		tier = strings.ToLower(strings.TrimSpace(tier))
+		if !slices.Contains(models.DefaultMetadataOrder, tier) {
+			return invalid("metadata_order", "must list tiers from "+strings.Join(models.DefaultMetadataOrder, ", "), tier)
+		}
+		if seen[tier] {
+			return invalid("metadata_order", "lists a tier twice", tier)
+		}
+		seen[tier] = true
+	}
+
+	if locale := strings.TrimSpace(settings.SortLocale); locale != "" && !localePattern.MatchString(locale) {
+		return invalid("sort_locale", "must be a language tag such as \"en\" or \"sv-SE\"", locale)
+	}
+	enums := []struct {
+		key, value string
+		allowed    []string
+	}{
+		{"contributor_name_order", settings.ContributorNameOrder, contributorNameOrders},
+		{"contributor_separator", settings.ContributorSeparator, contributorSeparators},
+		{"contributor_sort_order", settings.ContributorSortOrder, contributorSortOrders},
+	}
+	for _, enum := range enums {
+		if enum.value != "" && !slices.Contains(enum.allowed, enum.value) {
+			return invalid(enum.key, "must be one of "+strings.Join(enum.allowed, ", "), enum.value)
+		}
+	}
+	return nil
+}
+
+// SettingsSchema describes library settings as a JSON Schema, so the admin
+// UI can build its settings form and check values before saving.
+func (s *Service) SettingsSchema() map[string]interface{} {
+	stringList := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": description,
+		}
+	}
+	enum := func(values []string, description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "enum": values, "description": description}
+	}
+	flag := func(description string, def bool) map[string]interface{} {
+		return map[string]interface{}{"type": "boolean", "default": def, "description": description}
+	}
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Library settings",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"auto_scan_interval_minutes": map[string]interface{}{
+				"type":        "integer",
+				"default":     0,
+				"anyOf":       []interface{}{map[string]interface{}{"const": 0}, map[string]interface{}{"minimum": MinAutoScanInterval}},
+				"description": "Rescan the library when this many minutes have passed since its last scan; 0 leaves scans to admins.",
+			},
+			"audio_extensions": stringList("File extensions scanned as audio on top of the built-in formats."),
+			"ignore_patterns":  stringList("Glob patterns for file and directory names scans skip."),
+			"progress_import_user_id": map[string]interface{}{
+				"type":        "string",
+				"description": "The user whose progress is seeded from sidecar files of new books.",
+			},
+			"auto_match": flag("Link new books to the best provider match when it agrees with their title and author.", false),
+			"preferred_provider": enum(append([]string{providers.AllProviders}, s.knownProviders()...),
+				"The provider auto-matching searches; unset searches all of them."),
+			"metadata_order": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": models.DefaultMetadataOrder},
+				"uniqueItems": true,
+				"default":     models.DefaultMetadataOrder,
+				"description": "The order metadata tiers are used in below custom values; tiers left out follow in their default order.",
+			},
+			"export_metadata_sidecar": flag("Write resolved metadata to metadata.json in each book's folder.", false),
+			"write_tags":              flag("Allow writing resolved metadata into the library's audio files.", false),
+			"sort_locale": map[string]interface{}{
+				"type":        "string",
+				"pattern":     localePattern.String(),
+				"default":     metadata.DefaultCollation.Locale,
+				"description": "The language tag titles and names are sorted by.",
+			},
+			"sort_ignore_articles":   flag("Drop leading articles when sorting.", metadata.DefaultCollation.IgnoreArticles),
+			"contributor_name_order": enum(contributorNameOrders, "How contributor names are displayed."),
+			"contributor_separator":  enum(contributorSeparators, "How several contributor names are joined."),
+			"contributor_sort_order": enum(contributorSortOrders, "How the first author's name is filed."),
+		},
+	}
+}
+
+// knownProviders returns the names of the metadata providers.
+func (s *Service) knownProviders() []string {
+	if s.providerNames == nil {
+		return nil
+	}
+	return s.providerNames()
+}
@@ -0,0 +1,108 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lore/backend/internal/models"
+	"github.com/lore/backend/internal/sidecar"
+)
+
+// SidecarReadResult summarizes re-reading a library's metadata sidecars.
+type SidecarReadResult struct {
+	LibraryID  string `json:"library_id"`
+	Audiobooks int    `json:"audiobooks"`
+	// WithSidecars counts audiobooks with at least one readable sidecar.
+	WithSidecars int `json:"with_sidecars"`
+	// Failed lists sidecars that could not be read.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// ReadSidecarMetadata re-reads the metadata sidecars of every audiobook in a
+// library. Scans only read them for new and changed books, so this picks up
+// sidecars of books scanned before they were read.
+func (s *Service) ReadSidecarMetadata(ctx context.Context, libraryID string) (*SidecarReadResult, error) {
+	library, err := s.repo.GetLibraryByID(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("library lookup failed: %w", err)
+	}
+
+	result := &SidecarReadResult{LibraryID: library.ID}
+	for _, directory := range library.Directories {
+		known, err := s.repo.ListScannedAudiobooks(ctx, directory.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recorded audiobooks: %w", err)
+		}
+		for assetPath, book := range known {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			result.Audiobooks++
+			found, err := s.readSidecarMetadata(ctx, book.ID, assetPath)
+			if err != nil {
+				result.Failed = append(result.Failed, err.Error())
+				continue
+			}
+			if found {
+				result.WithSidecars++
+			}
+		}
+	}
+	s.catalogChanged(library.ID)
+	return result, nil
+}
+
+// readSidecarMetadata stores the metadata sidecars in the folder of an
+// audiobook as its sidecar layer, or clears the layer when there are none,
+// and refreshes its resolved metadata. It reports whether sidecars were
+// found.
+func (s *Service) readSidecarMetadata(ctx context.Context, audiobookID, assetPath string) (bool, error) {
+	meta, err := sidecar.FindMetadata(assetPath)
+	if err != nil {
+		return false, err
+	}
+	if err := s.repo.SetSidecarMetadata(ctx, audiobookID, sidecarModel(meta)); err != nil {
+		return false, fmt.Errorf("failed to store sidecar metadata of %s: %w", assetPath, err)
+	}
+	if err := s.repo.RefreshResolvedMetadata(ctx, audiobookID); err != nil {
+		return false, fmt.Errorf("failed to resolve metadata of %s: %w", assetPath, err)
+	}
+	return meta != nil, nil
+}
+
+// sidecarModel converts sidecar metadata for storage. Credits are joined
+// with commas, the way providers list them.
+func sidecarModel(meta *sidecar.Metadata) *models.SidecarMetadata {
+	if meta == nil {
+		return nil
+	}
+	optional := func(s string) *string {
+		if s = strings.TrimSpace(s); s == "" {
+			return nil
+		}
+		return &s
+	}
+	model := &models.SidecarMetadata{
+		Sources:        meta.Sources,
+		Title:          optional(meta.Title),
+		Subtitle:       optional(meta.Subtitle),
+		Author:         optional(strings.Join(meta.Authors, ", ")),
+		Narrator:       optional(strings.Join(meta.Narrators, ", ")),
+		Description:    optional(meta.Description),
+		SeriesName:     optional(meta.SeriesName),
+		SeriesSequence: optional(meta.SeriesSequence),
+		ReleaseDate:    optional(meta.ReleaseDate),
+		ISBN:           optional(meta.ISBN),
+		ASIN:           optional(meta.ASIN),
+		Language:       optional(meta.Language),
+		Publisher:      optional(meta.Publisher),
+	}
+	if len(meta.Genres) > 0 {
+		if data, err := json.Marshal(meta.Genres); err == nil {
+			model.Genres = optional(string(data))
+		}
+	}
+	return model
+}
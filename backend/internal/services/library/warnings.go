@@ -0,0 +1,217 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lore/backend/internal/diskspace"
+	"github.com/lore/backend/internal/notify"
+	"github.com/lore/backend/internal/webhooks"
+)
+
+// DefaultScanFailureLimit is how many scans of a library in a row must fail
+// before admins are warned.
+const DefaultScanFailureLimit = 3
+
+// Storage levels, from the free space left on a file system.
+const (
+	StorageOK       = "ok"
+	StorageLow      = "low"
+	StorageCritical = "critical"
+)
+
+// StorageThresholds are the free space percentages below which a file
+// system is low or critical.
+type StorageThresholds struct {
+	LowPercent      float64
+	CriticalPercent float64
+}
+
+func (t StorageThresholds) level(freePercent float64) string {
+	switch {
+	case freePercent < t.CriticalPercent:
+		return StorageCritical
+	case freePercent < t.LowPercent:
+		return StorageLow
+	}
+	return StorageOK
+}
+
+// SetScanFailureLimit sets how many scans of a library in a row must fail
+// before admins are warned.
+func (s *Service) SetScanFailureLimit(n int) {
+	if n > 0 {
+		s.scanFailureLimit = n
+	}
+}
+
+// recordScanOutcome counts a failed scan of a library, one that errored or
+// could not read one of its paths, and warns admins once the failures in a
+// row reach the limit. A successful scan resets the count. Cancelled scans
+// and unknown libraries are not counted.
+func (s *Service) recordScanOutcome(ctx context.Context, libraryID string, result *ScanResult, err error) {
+	if ctx.Err() != nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	var problems []string
+	name := libraryID
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if result != nil {
+		name = result.LibraryName
+		problems = append(problems, result.Errors...)
+	}
+
+	s.scanFailMu.Lock()
+	if len(problems) == 0 {
+		delete(s.scanFailures, libraryID)
+		s.scanFailMu.Unlock()
+		return
+	}
+	s.scanFailures[libraryID]++
+	failures := s.scanFailures[libraryID]
+	s.scanFailMu.Unlock()
+
+	if failures != s.scanFailureLimit {
+		return
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "The last %d scans of library %q failed. The latest reported:\n\n", failures, name)
+	for _, problem := range problems {
+		fmt.Fprintf(&body, "  - %s\n", problem)
+	}
+	s.notifier.Notify(notify.Event{
+		Type:    notify.EventScanFailing,
+		Subject: fmt.Sprintf("Library %s: %d scans in a row failed", name, failures),
+		Body:    body.String(),
+		Data: map[string]interface{}{
+			"library_id":           libraryID,
+			"consecutive_failures": failures,
+			"errors":               problems,
+		},
+	})
+	s.webhooks.Publish(webhooks.EventScanFailing, map[string]interface{}{
+		"library_id":           libraryID,
+		"library_name":         name,
+		"consecutive_failures": failures,
+		"errors":               problems,
+	})
+}
+
+// fileSystem groups the watched paths on one file system.
+type fileSystem struct {
+	usage diskspace.Usage
+	paths []string
+}
+
+// WatchStorage checks the free space under dirs and every enabled library
+// path each interval until ctx ends. Admins and webhooks are told when a
+// file system drops below a threshold, gets worse, or recovers; paths on
+// the same file system are reported together.
+func (s *Service) WatchStorage(ctx context.Context, dirs []string, interval time.Duration, thresholds StorageThresholds) {
+	if !diskspace.Supported {
+		fmt.Println("Storage warnings are not available on this platform")
+		return
+	}
+
+	levels := make(map[uint64]string)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.checkStorage(ctx, dirs, thresholds, levels)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkStorage compares each file system's level with the one recorded in
+// levels at the previous check and reports the changes.
+func (s *Service) checkStorage(ctx context.Context, dirs []string, thresholds StorageThresholds, levels map[uint64]string) {
+	paths := append([]string(nil), dirs...)
+	libraryPaths, err := s.repo.GetLibraryPaths(ctx)
+	if err != nil {
+		fmt.Printf("Failed to list library paths for storage check: %v\n", err)
+	}
+	for _, lp := range libraryPaths {
+		if lp.Enabled {
+			paths = append(paths, lp.Path)
+		}
+	}
+
+	var devices []uint64
+	systems := make(map[uint64]*fileSystem)
+	for _, path := range paths {
+		// Missing or unreadable paths are reported by path validation.
+		usage, err := diskspace.Stat(path)
+		if err != nil {
+			continue
+		}
+		system, ok := systems[usage.Device]
+		if !ok {
+			system = &fileSystem{usage: usage}
+			systems[usage.Device] = system
+			devices = append(devices, usage.Device)
+		}
+		system.paths = append(system.paths, path)
+	}
+
+	for _, device := range devices {
+		system := systems[device]
+		level := thresholds.level(system.usage.FreePercent())
+		previous, ok := levels[device]
+		if !ok {
+			previous = StorageOK
+		}
+		levels[device] = level
+		if level != previous {
+			s.notifyStorage(level, previous, system)
+		}
+	}
+}
+
+// notifyStorage reports a file system whose storage level changed.
+func (s *Service) notifyStorage(level, previous string, system *fileSystem) {
+	usage := system.usage
+	var subject string
+	switch level {
+	case StorageCritical:
+		subject = fmt.Sprintf("Storage critical: %.1f%% free on %s", usage.FreePercent(), system.paths[0])
+	case StorageLow:
+		subject = fmt.Sprintf("Storage low: %.1f%% free on %s", usage.FreePercent(), system.paths[0])
+	default:
+		subject = fmt.Sprintf("Storage recovered: %.1f%% free on %s", usage.FreePercent(), system.paths[0])
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%d MB of %d MB free (%.1f%%) on the file system holding:\n\n",
+		usage.FreeBytes>>20, usage.TotalBytes>>20, usage.FreePercent())
+	for _, path := range system.paths {
+		fmt.Fprintf(&body, "  - %s\n", path)
+	}
+
+	data := map[string]interface{}{
+		"level":          level,
+		"previous_level": previous,
+		"free_bytes":     usage.FreeBytes,
+		"total_bytes":    usage.TotalBytes,
+		"free_percent":   usage.FreePercent(),
+		"paths":          system.paths,
+	}
+	s.notifier.Notify(notify.Event{
+		Type:    notify.EventStorageWarning,
+		Subject: subject,
+		Body:    body.String(),
+		Data:    data,
+	})
+	s.webhooks.Publish(webhooks.EventStorageWarning, data)
+}
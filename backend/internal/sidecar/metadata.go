@@ -0,0 +1,560 @@
+package sidecar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetadataFile is the name of the metadata sidecar Audiobookshelf reads and
+// writes, and the one ExportMetadata writes.
+const MetadataFile = "metadata.json"
+
+// maxMetadataSize bounds the size of a metadata sidecar; descriptions and
+// chapter lists make them larger than progress files.
+const maxMetadataSize = 1 << 20
+
+// Metadata is book metadata read from sidecar files. Empty fields were not
+// found.
+type Metadata struct {
+	// Sources lists the sidecar files read, relative to the audiobook
+	// folder, in order of precedence.
+	Sources        []string `json:"sources"`
+	Title          string   `json:"title,omitempty"`
+	Subtitle       string   `json:"subtitle,omitempty"`
+	Authors        []string `json:"authors,omitempty"`
+	Narrators      []string `json:"narrators,omitempty"`
+	SeriesName     string   `json:"series_name,omitempty"`
+	SeriesSequence string   `json:"series_sequence,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	ReleaseDate    string   `json:"release_date,omitempty"`
+	Publisher      string   `json:"publisher,omitempty"`
+	ISBN           string   `json:"isbn,omitempty"`
+	ASIN           string   `json:"asin,omitempty"`
+	Language       string   `json:"language,omitempty"`
+	Genres         []string `json:"genres,omitempty"`
+}
+
+// FindMetadata reads the metadata sidecars in the audiobook folder at
+// assetPath: metadata.json (Audiobookshelf), an .nfo file (book.nfo when
+// there are several), desc.txt holding the description and reader.txt
+// naming the narrator. Earlier files win where they overlap. It returns nil
+// without an error when the folder has none, or assetPath is a single file.
+func FindMetadata(assetPath string) (*Metadata, error) {
+	info, err := os.Stat(assetPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(assetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]string, len(entries))
+	var nfos []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		lower := strings.ToLower(entry.Name())
+		byName[lower] = entry.Name()
+		if strings.HasSuffix(lower, ".nfo") {
+			nfos = append(nfos, entry.Name())
+		}
+	}
+	sort.Slice(nfos, func(i, j int) bool {
+		if bi, bj := strings.EqualFold(nfos[i], "book.nfo"), strings.EqualFold(nfos[j], "book.nfo"); bi != bj {
+			return bi
+		}
+		return nfos[i] < nfos[j]
+	})
+
+	var names []string
+	if name, ok := byName[MetadataFile]; ok {
+		names = append(names, name)
+	}
+	if len(nfos) > 0 {
+		names = append(names, nfos[0])
+	}
+	for _, name := range []string{"desc.txt", "reader.txt"} {
+		if actual, ok := byName[name]; ok {
+			names = append(names, actual)
+		}
+	}
+
+	var merged *Metadata
+	for _, name := range names {
+		path := filepath.Join(assetPath, name)
+		data, err := readSidecar(path, maxMetadataSize)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta, err := ParseMetadata(name, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if merged == nil {
+			merged = &Metadata{}
+		}
+		merged.fill(meta)
+		merged.Sources = append(merged.Sources, name)
+	}
+	return merged, nil
+}
+
+// ParseMetadata reads a metadata sidecar by its name: metadata.json is an
+// Audiobookshelf metadata file, .nfo files are XML or "Key: value" text, and
+// desc.txt and reader.txt hold just a description or a narrator.
+func ParseMetadata(name string, data []byte) (*Metadata, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	lower := strings.ToLower(filepath.Base(name))
+	switch {
+	case strings.HasSuffix(lower, ".json"):
+		return parseMetadataJSON(data)
+	case strings.HasSuffix(lower, ".nfo"):
+		if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("<")) {
+			return parseNFOXML(trimmed)
+		}
+		return parseNFOText(data)
+	case lower == "desc.txt":
+		return &Metadata{Description: strings.TrimSpace(string(data))}, nil
+	case lower == "reader.txt":
+		return &Metadata{Narrators: splitList(firstLine(string(data)))}, nil
+	}
+	return nil, fmt.Errorf("unknown metadata sidecar %s", name)
+}
+
+// fill copies the fields of other that m lacks.
+func (m *Metadata) fill(other *Metadata) {
+	fillString := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = strings.TrimSpace(src)
+		}
+	}
+	fillString(&m.Title, other.Title)
+	fillString(&m.Subtitle, other.Subtitle)
+	if len(m.Authors) == 0 {
+		m.Authors = other.Authors
+	}
+	if len(m.Narrators) == 0 {
+		m.Narrators = other.Narrators
+	}
+	if m.SeriesName == "" {
+		m.SeriesName = strings.TrimSpace(other.SeriesName)
+		m.SeriesSequence = strings.TrimSpace(other.SeriesSequence)
+	}
+	fillString(&m.Description, other.Description)
+	fillString(&m.ReleaseDate, other.ReleaseDate)
+	fillString(&m.Publisher, other.Publisher)
+	fillString(&m.ISBN, other.ISBN)
+	fillString(&m.ASIN, other.ASIN)
+	fillString(&m.Language, other.Language)
+	if len(m.Genres) == 0 {
+		m.Genres = other.Genres
+	}
+}
+
+// absMetadata is the metadata.json format of Audiobookshelf. Older versions
+// wrote authors and series as objects and years as numbers, so those fields
+// accept either.
+type absMetadata struct {
+	Title         string     `json:"title"`
+	Subtitle      flexString `json:"subtitle"`
+	Authors       nameList   `json:"authors"`
+	Narrators     nameList   `json:"narrators"`
+	Series        nameList   `json:"series"`
+	Genres        nameList   `json:"genres"`
+	PublishedYear flexString `json:"publishedYear"`
+	PublishedDate flexString `json:"publishedDate"`
+	Publisher     flexString `json:"publisher"`
+	Description   flexString `json:"description"`
+	ISBN          flexString `json:"isbn"`
+	ASIN          flexString `json:"asin"`
+	Language      flexString `json:"language"`
+}
+
+// flexString is a JSON string, number or null.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		*s = flexString(v)
+	case float64:
+		*s = flexString(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return nil
+}
+
+// nameList is a list of names given as a string, strings, or objects with a
+// name and, for series, a sequence. Sequences are appended as " #n".
+type nameList []string
+
+func (l *nameList) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			if item = strings.TrimSpace(item); item != "" {
+				*l = append(*l, item)
+			}
+		case map[string]interface{}:
+			name, _ := item["name"].(string)
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			var sequence flexString
+			if raw, err := json.Marshal(item["sequence"]); err == nil {
+				sequence.UnmarshalJSON(raw)
+			}
+			if sequence != "" {
+				name += " #" + string(sequence)
+			}
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+func parseMetadataJSON(data []byte) (*Metadata, error) {
+	var abs absMetadata
+	if err := json.Unmarshal(data, &abs); err != nil {
+		return nil, fmt.Errorf("invalid metadata JSON: %w", err)
+	}
+	meta := &Metadata{
+		Title:       abs.Title,
+		Subtitle:    string(abs.Subtitle),
+		Authors:     abs.Authors,
+		Narrators:   abs.Narrators,
+		Genres:      abs.Genres,
+		Description: string(abs.Description),
+		ReleaseDate: string(abs.PublishedDate),
+		Publisher:   string(abs.Publisher),
+		ISBN:        string(abs.ISBN),
+		ASIN:        string(abs.ASIN),
+		Language:    string(abs.Language),
+	}
+	if meta.ReleaseDate == "" {
+		meta.ReleaseDate = string(abs.PublishedYear)
+	}
+	if len(abs.Series) > 0 {
+		meta.SeriesName, meta.SeriesSequence = splitSeries(abs.Series[0])
+	}
+	return meta, nil
+}
+
+// nfoFields lists, for each Metadata field, the normalized NFO element
+// names and keys it is read from.
+var nfoFields = map[string][]string{
+	"title":       {"title", "booktitle"},
+	"subtitle":    {"subtitle"},
+	"author":      {"author", "authors", "artist", "albumartist", "writer", "creator"},
+	"narrator":    {"narrator", "narrators", "narratedby", "reader"},
+	"series":      {"series", "seriesname"},
+	"sequence":    {"seriesnumber", "seriespart", "seriessequence", "seriesindex", "booknumber", "volume"},
+	"description": {"description", "bookdescription", "plot", "summary", "synopsis", "outline"},
+	"date":        {"releasedate", "published", "publishdate", "publisheddate", "publishedyear", "premiered", "year", "copyright"},
+	"publisher":   {"publisher", "studio", "label"},
+	"isbn":        {"isbn"},
+	"asin":        {"asin"},
+	"language":    {"language"},
+	"genre":       {"genre", "genres"},
+}
+
+// nfoKeys maps normalized NFO element names and keys to their field.
+var nfoKeys = func() map[string]string {
+	keys := make(map[string]string)
+	for field, names := range nfoFields {
+		for _, name := range names {
+			keys[name] = field
+		}
+	}
+	return keys
+}()
+
+// parseNFOXML reads the text of known elements of an XML NFO, whatever its
+// root element; the first occurrence of each wins, except for genres.
+func parseNFOXML(data []byte) (*Metadata, error) {
+	values := make(map[string]string)
+	var genres []string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var path []string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid NFO XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(path) == 0 {
+				continue
+			}
+			name := normalizeKey(path[len(path)-1])
+			path = path[:len(path)-1]
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+			// Nested elements, e.g. <author><name>..., count as the parent.
+			if _, known := nfoKeys[name]; !known && name == "name" && len(path) > 0 {
+				name = normalizeKey(path[len(path)-1])
+			}
+			field, ok := nfoKeys[name]
+			if !ok || value == "" {
+				continue
+			}
+			if field == "genre" {
+				genres = append(genres, splitList(value)...)
+			} else if _, seen := values[field]; !seen {
+				values[field] = value
+			}
+		}
+	}
+	return metadataFromValues(values, genres), nil
+}
+
+// parseNFOText reads "Key: value" lines. A line naming the description on
+// its own, e.g. "Book Description" followed by a "=====" rule, starts the
+// description, which runs to the end of the file.
+func parseNFOText(data []byte) (*Metadata, error) {
+	values := make(map[string]string)
+	var genres []string
+	var description []string
+	inDescription := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), maxMetadataSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if inDescription {
+			if len(description) == 0 && (trimmed == "" || isRule(trimmed)) {
+				continue
+			}
+			description = append(description, strings.TrimRight(line, " \t\r"))
+			continue
+		}
+		if trimmed == "" || isRule(trimmed) {
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok || strings.TrimSpace(value) == "" {
+			if nfoKeys[normalizeKey(strings.TrimSuffix(trimmed, ":"))] == "description" {
+				inDescription = true
+			}
+			continue
+		}
+		field, known := nfoKeys[normalizeKey(key)]
+		if !known {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if field == "genre" {
+			genres = append(genres, splitList(value)...)
+		} else if _, seen := values[field]; !seen {
+			values[field] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(description) > 0 {
+		values["description"] = strings.TrimSpace(strings.Join(description, "\n"))
+	}
+	return metadataFromValues(values, genres), nil
+}
+
+// metadataFromValues builds Metadata from the fields named in nfoKeys.
+func metadataFromValues(values map[string]string, genres []string) *Metadata {
+	meta := &Metadata{
+		Title:          values["title"],
+		Subtitle:       values["subtitle"],
+		Authors:        splitList(values["author"]),
+		Narrators:      splitList(values["narrator"]),
+		SeriesName:     values["series"],
+		SeriesSequence: values["sequence"],
+		Description:    values["description"],
+		ReleaseDate:    values["date"],
+		Publisher:      values["publisher"],
+		ISBN:           values["isbn"],
+		ASIN:           values["asin"],
+		Language:       values["language"],
+		Genres:         genres,
+	}
+	if meta.SeriesName != "" && meta.SeriesSequence == "" {
+		meta.SeriesName, meta.SeriesSequence = splitSeries(meta.SeriesName)
+	}
+	return meta
+}
+
+// seriesSequence matches the sequence at the end of a series credit, as in
+// "The Expanse #3", "Discworld, Book 12" or "Dune (1)".
+var seriesSequence = regexp.MustCompile(`(?i)\s*(?:,?\s*(?:#|\bbook|\bvol\.?|\bvolume|\bpart)\s*([\d.]+)|\(([\d.]+)\))\s*$`)
+
+// splitSeries splits a series credit into its name and sequence.
+func splitSeries(series string) (name, sequence string) {
+	series = strings.TrimSpace(series)
+	m := seriesSequence.FindStringSubmatchIndex(series)
+	if m == nil {
+		return series, ""
+	}
+	if m[2] >= 0 {
+		sequence = series[m[2]:m[3]]
+	} else {
+		sequence = series[m[4]:m[5]]
+	}
+	return strings.TrimSpace(series[:m[0]]), sequence
+}
+
+// splitList splits a credit list on commas and semicolons. A single
+// "Last, First" name is split too, which callers joining the list undo.
+func splitList(value string) []string {
+	var list []string
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// isRule reports whether a line only draws a separator, e.g. "=====".
+func isRule(line string) bool {
+	return strings.Trim(line, "=-_*~ ") == ""
+}
+
+// ExportMetadata writes meta as an Audiobookshelf metadata.json into the
+// audiobook folder dir, through a rename so readers never see it half
+// written. It reports whether the file changed; an identical file is left
+// alone, so exporting again does not look like a change to the folder.
+func ExportMetadata(dir string, meta *Metadata) (bool, error) {
+	optional := func(s string) *string {
+		if s = strings.TrimSpace(s); s == "" {
+			return nil
+		}
+		return &s
+	}
+	list := func(l []string) []string {
+		if l == nil {
+			return []string{}
+		}
+		return l
+	}
+
+	out := struct {
+		Title         string   `json:"title"`
+		Subtitle      *string  `json:"subtitle"`
+		Authors       []string `json:"authors"`
+		Narrators     []string `json:"narrators"`
+		Series        []string `json:"series"`
+		Genres        []string `json:"genres"`
+		PublishedYear *string  `json:"publishedYear"`
+		PublishedDate *string  `json:"publishedDate"`
+		Publisher     *string  `json:"publisher"`
+		Description   *string  `json:"description"`
+		ISBN          *string  `json:"isbn"`
+		ASIN          *string  `json:"asin"`
+		Language      *string  `json:"language"`
+	}{
+		Title:       meta.Title,
+		Subtitle:    optional(meta.Subtitle),
+		Authors:     list(meta.Authors),
+		Narrators:   list(meta.Narrators),
+		Series:      []string{},
+		Genres:      list(meta.Genres),
+		Publisher:   optional(meta.Publisher),
+		Description: optional(meta.Description),
+		ISBN:        optional(meta.ISBN),
+		ASIN:        optional(meta.ASIN),
+		Language:    optional(meta.Language),
+	}
+	if name := strings.TrimSpace(meta.SeriesName); name != "" {
+		if meta.SeriesSequence != "" {
+			name += " #" + strings.TrimSpace(meta.SeriesSequence)
+		}
+		out.Series = []string{name}
+	}
+	if date := strings.TrimSpace(meta.ReleaseDate); date != "" {
+		if len(date) >= 4 {
+			out.PublishedYear = optional(date[:4])
+		}
+		if len(date) > 4 {
+			out.PublishedDate = &date
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	data = append(data, '\n')
+
+	path := filepath.Join(dir, MetadataFile)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	tmp, err := os.CreateTemp(dir, "."+MetadataFile+"-*")
+	if err != nil {
+		return false, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	os.Chmod(tmp.Name(), 0o644)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
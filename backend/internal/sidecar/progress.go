@@ -0,0 +1,266 @@
+// Package sidecar reads listening progress and book metadata that other
+// audiobook players and library managers leave next to the audio files, so
+// it can be carried over when a library is moved to Lore, and writes
+// metadata back for them.
+package sidecar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is a listening position read from a sidecar file.
+type Progress struct {
+	// Source is the path of the sidecar file.
+	Source string `json:"source"`
+	// File names the media file the position is in, relative to the
+	// audiobook folder. When empty, PositionSec counts from the start of
+	// the book.
+	File         string     `json:"file,omitempty"`
+	PositionSec  float64    `json:"position_sec"`
+	Finished     bool       `json:"finished"`
+	Favorite     bool       `json:"favorite"`
+	LastPlayedAt *time.Time `json:"last_played_at,omitempty"`
+}
+
+// progressNames are the sidecar files looked for in an audiobook folder, in
+// order of preference.
+var progressNames = []string{"lore-progress.json", "progress.json", "bookmark.txt", "position.txt", ".position"}
+
+// progressSuffixes are appended to the file name of a single-file audiobook
+// to find its sidecar, e.g. "Dune.m4b.position".
+var progressSuffixes = []string{".progress.json", ".position"}
+
+// maxSidecarSize bounds the size of a sidecar file; progress files are a few
+// lines long.
+const maxSidecarSize = 64 << 10
+
+// FindProgress looks for a progress sidecar of the audiobook at assetPath:
+// one of the known names inside its folder, or next to a single-file
+// audiobook. It returns nil without an error when there is none. Sidecars
+// without a timestamp are dated by their modification time.
+func FindProgress(assetPath string) (*Progress, error) {
+	info, err := os.Stat(assetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	if info.IsDir() {
+		entries, err := os.ReadDir(assetPath)
+		if err != nil {
+			return nil, err
+		}
+		byName := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				byName[strings.ToLower(entry.Name())] = entry.Name()
+			}
+		}
+		for _, name := range progressNames {
+			if actual, ok := byName[name]; ok {
+				candidates = append(candidates, filepath.Join(assetPath, actual))
+			}
+		}
+	} else {
+		for _, suffix := range progressSuffixes {
+			candidates = append(candidates, assetPath+suffix)
+		}
+	}
+
+	for _, path := range candidates {
+		data, err := readSidecar(path, maxSidecarSize)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		progress, err := ParseProgress(filepath.Base(path), data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		progress.Source = path
+		if progress.LastPlayedAt == nil {
+			// Players rewrite the file as they go, so its modification time
+			// is when the book was last played.
+			if info, err := os.Stat(path); err == nil {
+				modified := info.ModTime().UTC()
+				progress.LastPlayedAt = &modified
+			}
+		}
+		return progress, nil
+	}
+	return nil, nil
+}
+
+func readSidecar(path string, limit int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("%s: sidecar larger than %d bytes", path, limit)
+	}
+	return data, nil
+}
+
+// ParseProgress reads a progress sidecar. Files ending in .json hold an
+// object; any other file holds "key: value" lines, or just the position.
+// Keys are matched ignoring case, underscores and dashes, so "position_ms"
+// and "positionMs" are the same. Positions are seconds or "h:mm:ss".
+func ParseProgress(name string, data []byte) (*Progress, error) {
+	values := make(map[string]string)
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if strings.HasSuffix(strings.ToLower(name), ".json") {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid progress JSON: %w", err)
+		}
+		for key, value := range raw {
+			switch v := value.(type) {
+			case string:
+				values[normalizeKey(key)] = v
+			case float64:
+				values[normalizeKey(key)] = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				values[normalizeKey(key)] = strconv.FormatBool(v)
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if _, err := parsePosition(line); err == nil {
+				values["position"] = line
+				continue
+			}
+			if sep := strings.IndexAny(line, ":="); sep > 0 {
+				values[normalizeKey(line[:sep])] = strings.TrimSpace(line[sep+1:])
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return progressFromValues(values)
+}
+
+func normalizeKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(key)
+}
+
+// progressFromValues builds a Progress from normalized keys.
+func progressFromValues(values map[string]string) (*Progress, error) {
+	progress := &Progress{}
+	found := false
+
+	if value, ok := lookup(values, "positionms", "positionmillis", "timems"); ok {
+		ms, err := strconv.ParseFloat(value, 64)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid position %q", value)
+		}
+		progress.PositionSec = ms / 1000
+		found = true
+	} else if value, ok := lookup(values, "positionsec", "position", "time", "seconds"); ok {
+		sec, err := parsePosition(value)
+		if err != nil {
+			return nil, err
+		}
+		progress.PositionSec = sec
+		found = true
+	}
+
+	if value, ok := lookup(values, "finished", "completed", "done"); ok {
+		progress.Finished = parseBool(value)
+		found = found || progress.Finished
+	}
+	if value, ok := lookup(values, "favorite", "favourite", "starred"); ok {
+		progress.Favorite = parseBool(value)
+	}
+	if value, ok := lookup(values, "file", "filename", "track", "chapterfile"); ok {
+		progress.File = filepath.ToSlash(strings.TrimSpace(value))
+	}
+	if value, ok := lookup(values, "lastplayedat", "lastplayed", "updatedat", "date"); ok {
+		if t, ok := parseTimestamp(value); ok {
+			progress.LastPlayedAt = &t
+		}
+	}
+
+	if !found {
+		return nil, errors.New("no position in progress sidecar")
+	}
+	return progress, nil
+}
+
+func lookup(values map[string]string, keys ...string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := values[key]; ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// parsePosition reads seconds ("3723.5") or a clock time ("1:02:03.5",
+// "62:03").
+func parsePosition(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid position %q", value)
+	}
+	var total float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || (i < len(parts)-1 && strings.Contains(part, ".")) {
+			return 0, fmt.Errorf("invalid position %q", value)
+		}
+		total = total*60 + n
+	}
+	return total, nil
+}
+
+func parseBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "y":
+		return true
+	}
+	return false
+}
+
+// parseTimestamp reads an RFC 3339 time, a date, or Unix seconds or
+// milliseconds.
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+		if n > 1e12 {
+			return time.UnixMilli(n).UTC(), true
+		}
+		return time.Unix(n, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,290 @@
+// Package webhooks delivers library events to admin-registered URLs.
+//
+// Each delivery is a JSON POST signed with the webhook's secret:
+//
+//	X-Lore-Event:     book.added
+//	X-Lore-Delivery:  <unique id>
+//	X-Lore-Signature: sha256=<hex HMAC-SHA256 of the body>
+//
+// Deliveries happen in the background and are retried with exponential
+// backoff when the receiver is unreachable or answers 429 or 5xx.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lore/backend/internal/httpclient"
+	"github.com/lore/backend/internal/models"
+)
+
+// Event types.
+const (
+	EventBookAdded         = "book.added"
+	EventScanCompleted     = "scan.completed"
+	EventImportFailed      = "import.failed"
+	EventProgressCompleted = "user.progress.completed"
+	EventScanFailing       = "scan.failing"
+	EventStorageWarning    = "storage.warning"
+	// EventPing is only sent by Test.
+	EventPing = "ping"
+)
+
+// Events lists the event types webhooks can subscribe to.
+var Events = []string{EventBookAdded, EventScanCompleted, EventImportFailed, EventProgressCompleted,
+	EventScanFailing, EventStorageWarning}
+
+// ValidEvent reports whether event can be subscribed to.
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery headers.
+const (
+	HeaderEvent     = "X-Lore-Event"
+	HeaderDelivery  = "X-Lore-Delivery"
+	HeaderSignature = "X-Lore-Signature"
+)
+
+// Retry policy for failed deliveries.
+const (
+	maxAttempts = 5
+	baseDelay   = 2 * time.Second
+	maxDelay    = 5 * time.Minute
+)
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Store persists webhooks.
+type Store interface {
+	CreateWebhook(ctx context.Context, hook *models.Webhook) error
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, hook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	RecordWebhookDelivery(ctx context.Context, id string, at time.Time, deliveryErr *string) error
+}
+
+// Service manages webhooks and publishes events to them. A nil Service
+// drops events, so callers can publish unconditionally.
+type Service struct {
+	ctx    context.Context
+	store  Store
+	client *http.Client
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+// NewService creates a Service. Pending retries stop when ctx ends.
+func NewService(ctx context.Context, store Store) *Service {
+	return &Service{
+		ctx:   ctx,
+		store: store,
+		// Deliveries are POSTs, which the client never retries itself;
+		// retries are handled here so they can back off for longer.
+		client: httpclient.New(httpclient.Options{Name: "webhooks", Timeout: 15 * time.Second}),
+		sleep:  sleepContext,
+	}
+}
+
+// Create registers a webhook, generating a secret when none is given.
+func (s *Service) Create(ctx context.Context, hook *models.Webhook) error {
+	if hook.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return err
+		}
+		hook.Secret = secret
+	}
+	hook.ID = uuid.NewString()
+	return s.store.CreateWebhook(ctx, hook)
+}
+
+// List returns every webhook.
+func (s *Service) List(ctx context.Context) ([]models.Webhook, error) {
+	return s.store.ListWebhooks(ctx)
+}
+
+// Get returns a webhook, or sql.ErrNoRows if there is none.
+func (s *Service) Get(ctx context.Context, id string) (*models.Webhook, error) {
+	return s.store.GetWebhook(ctx, id)
+}
+
+// Update saves changes to a webhook.
+func (s *Service) Update(ctx context.Context, hook *models.Webhook) error {
+	return s.store.UpdateWebhook(ctx, hook)
+}
+
+// Delete removes a webhook.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.store.DeleteWebhook(ctx, id)
+}
+
+// Publish delivers event to every enabled webhook subscribed to it.
+func (s *Service) Publish(event string, data interface{}) {
+	if s == nil {
+		return
+	}
+
+	payload := Payload{ID: uuid.NewString(), Event: event, CreatedAt: time.Now().UTC(), Data: data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("webhook %s: encode payload: %v", event, err)
+		return
+	}
+
+	go func() {
+		hooks, err := s.store.ListWebhooks(s.ctx)
+		if err != nil {
+			log.Printf("webhook %s: list webhooks: %v", event, err)
+			return
+		}
+		for _, hook := range hooks {
+			if hook.Enabled && subscribed(hook, event) {
+				go s.deliver(hook, payload, body)
+			}
+		}
+	}()
+}
+
+// Test sends a ping to a webhook once and reports the outcome.
+func (s *Service) Test(ctx context.Context, hook *models.Webhook) error {
+	payload := Payload{ID: uuid.NewString(), Event: EventPing, CreatedAt: time.Now().UTC(), Data: map[string]string{"webhook_id": hook.ID}}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.send(ctx, hook, payload, body)
+	s.record(hook.ID, err)
+	return err
+}
+
+// deliver sends a payload, retrying transient failures with backoff.
+func (s *Service) deliver(hook models.Webhook, payload Payload, body []byte) {
+	delay := baseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = s.send(s.ctx, &hook, payload, body)
+		if err == nil || retryAfter < 0 || attempt == maxAttempts {
+			break
+		}
+
+		wait := delay
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > maxDelay {
+			wait = maxDelay
+		}
+		if s.sleep(s.ctx, wait) != nil {
+			break
+		}
+		delay *= 2
+	}
+
+	if err != nil {
+		log.Printf("webhook %s: deliver %s to %s: %v", hook.ID, payload.Event, hook.URL, err)
+	}
+	s.record(hook.ID, err)
+}
+
+// send makes one delivery attempt. On failure, retryAfter is negative when
+// retrying cannot help, or the delay the receiver asked for (possibly zero).
+func (s *Service) send(ctx context.Context, hook *models.Webhook, payload Payload, body []byte) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Event)
+	req.Header.Set(HeaderDelivery, payload.ID)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return httpclient.ParseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("receiver returned %s", resp.Status)
+	default:
+		return -1, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+}
+
+func (s *Service) record(id string, deliveryErr error) {
+	var msg *string
+	if deliveryErr != nil {
+		text := deliveryErr.Error()
+		msg = &text
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.store.RecordWebhookDelivery(ctx, id, time.Now(), msg); err != nil {
+		log.Printf("webhook %s: record delivery: %v", id, err)
+	}
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(hook models.Webhook, event string) bool {
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
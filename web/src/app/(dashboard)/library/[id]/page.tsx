@@ -110,14 +110,16 @@ export default function AudiobookDetailPage() {
     setIsSearching(true);
     try {
       const authorParam = audiobook?.metadata?.author ? `&author=${encodeURIComponent(audiobook.metadata.author)}` : '';
-      const response = await apiFetch(
+      const response = await apiFetch<{ data: unknown }>(
         `/metadata/search?provider=${selectedProvider}&title=${encodeURIComponent(searchQuery)}${authorParam}`,
         { authToken: apiKey ?? undefined }
       );
-      setSearchResults(Array.isArray(response) ? response : []);
+      setSearchResults(Array.isArray(response.data) ? response.data : []);
     } catch (err) {
       console.error("Failed to search metadata:", err);
       setSearchResults([]);
+      const errorMessage = err instanceof Error ? err.message : String(err);
+      alert(`Metadata search failed: ${errorMessage}`);
     } finally {
       setIsSearching(false);
     }
@@ -311,7 +313,7 @@ export default function AudiobookDetailPage() {
         };
       });
 
-      const response = await apiFetch<Audiobook>(`/admin/audiobooks/${audiobookId}/metadata`, {
+      const { data: response } = await apiFetch<{ data: Audiobook }>(`/admin/audiobooks/${audiobookId}/metadata`, {
         method: 'PATCH',
         authToken: apiKey ?? undefined,
         body: JSON.stringify({ overrides }),
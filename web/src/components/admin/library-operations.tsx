@@ -28,7 +28,7 @@ export function LibraryOperations() {
       });
       if (!res.ok) throw new Error("Failed to scan libraries");
       const payload = await res.json();
-      setScanResults(payload.results ?? []);
+      setScanResults(payload.data ?? []);
       await refetch();
     } catch (error) {
       console.error(error);
@@ -154,6 +154,11 @@ export function LibraryOperations() {
                             {dir.new_books.length} new entries added
                           </p>
                         )}
+                        {dir.missing_books && dir.missing_books.length > 0 && (
+                          <p className="text-xs text-destructive">
+                            {dir.missing_books.length} missing on disk
+                          </p>
+                        )}
                       </div>
                     ))}
                   </div>
@@ -217,6 +222,10 @@ function LibraryCard({
                 <span>Books</span>
                 <span>{directory.book_count ?? 0}</span>
               </div>
+              <div className="flex items-center justify-between text-xs text-muted-foreground">
+                <span>Files</span>
+                <span>{directory.file_count ?? 0}</span>
+              </div>
               {directory.last_scanned_at && (
                 <p className="mt-1 text-xs text-muted-foreground flex items-center gap-1">
                   <Clock className="h-3 w-3" />{" "}
@@ -8,12 +8,16 @@ export type ApiRequestOptions = RequestInit & {
 export class ApiError extends Error {
   public readonly status: number;
   public readonly causePayload: unknown;
+  // code is the server's machine-readable error code, e.g. "not_found" or
+  // "validation_failed", when the response carried one.
+  public readonly code?: string;
 
-  constructor(message: string, status: number, causePayload?: unknown) {
+  constructor(message: string, status: number, causePayload?: unknown, code?: string) {
     super(message);
     this.name = "ApiError";
     this.status = status;
     this.causePayload = causePayload;
+    this.code = code;
   }
 }
 
@@ -40,6 +44,25 @@ const buildUrl = (path: string, searchParams?: ApiRequestOptions["searchParams"]
   return url.toString();
 };
 
+// errorMessage extracts the server's explanation from an error payload:
+// `{"error": "...", "code": "...", "status": 400}` JSON or a plain-text body.
+const errorMessage = (body: unknown): string | undefined => {
+  if (body && typeof body === "object" && "error" in body && typeof body.error === "string") {
+    return body.error;
+  }
+  if (typeof body === "string" && body.trim() !== "") {
+    return body.trim();
+  }
+  return undefined;
+};
+
+const errorCode = (body: unknown): string | undefined => {
+  if (body && typeof body === "object" && "code" in body && typeof body.code === "string") {
+    return body.code;
+  }
+  return undefined;
+};
+
 export async function apiFetch<TResponse>(path: string, options: ApiRequestOptions = {}): Promise<TResponse> {
   const { authToken, headers, searchParams, ...rest } = options;
   const url = buildUrl(path, searchParams);
@@ -54,15 +77,15 @@ export async function apiFetch<TResponse>(path: string, options: ApiRequestOptio
   });
 
   if (!response.ok) {
-    let body: unknown;
+    // Read the body once; it can only be consumed a single time.
+    let body: unknown = await response.text();
     try {
-      body = await response.json();
+      body = JSON.parse(body as string);
     } catch (error) {
       // ignore JSON parse errors; fallback to text
-      body = await response.text();
     }
 
-    throw new ApiError(response.statusText, response.status, body);
+    throw new ApiError(errorMessage(body) ?? response.statusText, response.status, body, errorCode(body));
   }
 
   if (response.status === 204) {
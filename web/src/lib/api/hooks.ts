@@ -74,12 +74,14 @@ export const useContinueListeningQuery = (libraryId?: string | null) => {
   const { apiKey } = useAuth();
   return useQuery({
     queryKey: queryKeys.library.continueListening(libraryId ?? null),
-    queryFn: () =>
-      apiFetch<Audiobook[]>("/library/continue", {
+    queryFn: async () => {
+      const response = await apiFetch<{ data: Audiobook[] }>("/library/continue", {
         method: "GET",
         authToken: apiKey ?? undefined,
         searchParams: libraryId ? { library_id: libraryId } : undefined,
-      }),
+      });
+      return response.data ?? [];
+    },
     enabled: !!apiKey,
     staleTime: 1000 * 60 * 2,
   });
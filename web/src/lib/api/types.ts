@@ -15,6 +15,18 @@ export interface User {
   display_name?: string;
   is_admin: boolean;
   created_at: string;
+  disabled: boolean;
+  disabled_at?: string;
+  pending_approval: boolean;
+  pending_approval_at?: string;
+}
+
+export interface RegistrationSettings {
+  open: boolean;
+  require_approval: boolean;
+  default_role: 'admin' | 'user';
+  library_ids: string[];
+  updated_at?: string;
 }
 
 export interface LibraryDirectory {
@@ -23,6 +35,9 @@ export interface LibraryDirectory {
   name: string;
   enabled: boolean;
   book_count?: number;
+  file_count?: number;
+  total_size?: number;
+  last_scan_duration_ms?: number;
   last_scanned_at?: string | null;
 }
 
@@ -33,6 +48,7 @@ export interface Library {
   type: string;
   description?: string | null;
   settings?: Record<string, unknown> | null;
+  restricted?: boolean;
   book_count?: number;
   directories?: LibraryDirectory[];
 }
@@ -57,6 +73,8 @@ export interface Audiobook {
   user_data?: UserAudiobookData | null;
   file_count?: number;
   total_duration_sec?: number;
+  cover_blurhash?: string;
+  cover_color?: string;
   media_files?: MediaFile[];
 }
 
@@ -156,7 +174,19 @@ export interface DirectoryScanResult {
   directory_path: string;
   books_found: number;
   new_books?: Audiobook[];
+  books_updated: number;
+  books_unchanged: number;
+  files_analyzed: number;
+  missing_books?: string[];
   scan_duration: string;
+  timing: ScanTiming;
+}
+
+export interface ScanTiming {
+  discover_ms: number;
+  analyze_ms: number;
+  persist_ms: number;
+  total_ms: number;
 }
 
 export interface LibraryScanResult {
@@ -165,6 +195,7 @@ export interface LibraryScanResult {
   directories: DirectoryScanResult[];
   total_books_found: number;
   total_new_books: number;
+  total_missing_books: number;
   scan_duration: string;
 }
 
@@ -212,3 +243,20 @@ export interface FilterCounts {
   favorites: number;
 }
 
+// Offline download manifest
+export interface DownloadManifest {
+  audiobook_id: string;
+  title: string;
+  expires_at: string;
+  total_size: number;
+  files: DownloadManifestFile[];
+}
+
+export interface DownloadManifestFile {
+  id: string;
+  filename: string;
+  mime_type: string;
+  duration_sec: number;
+  size: number;
+  url: string;
+}